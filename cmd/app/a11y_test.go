@@ -0,0 +1,205 @@
+package main
+
+import (
+	"cmp"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// An accessibility audit of the rendered pages: a subset of axe-core's rules, named as there,
+// run over the golden files (golden_test.go pins them to the templates). Fragments are
+// checked element by element; rules about a whole document (document-title,
+// landmark-one-main) apply to files that are one, and to the home page put together from its
+// parts as writeHome streams them.
+
+// a11yVoid are the elements without an end tag.
+var a11yVoid = map[string]bool{"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true}
+
+type a11yNode struct {
+	name   string
+	attrs  map[string]string
+	text   strings.Builder // text content, with the alt text of images
+	parent *a11yNode
+}
+
+func (n *a11yNode) has(attr string) bool { _, ok := n.attrs[attr]; return ok }
+
+func (n *a11yNode) within(name string) bool {
+	for p := n.parent; p != nil; p = p.parent {
+		if p.name == name { return true }
+	}
+	return false
+}
+
+// describe names n in a violation: its tag and id, or else its first attributes.
+func (n *a11yNode) describe() string {
+	if id := n.attrs["id"]; id != "" { return "<" + n.name + " id=" + id + ">" }
+	for _, a := range []string{"name", "href", "src", "class"} {
+		if v := n.attrs[a]; v != "" { return "<" + n.name + " " + a + "=" + v + ">" }
+	}
+	return "<" + n.name + ">"
+}
+
+// auditA11y returns the violations in doc, one line each.
+func auditA11y(doc string) ([]string, error) {
+	d := xml.NewDecoder(strings.NewReader(doc))
+	d.Strict, d.Entity = false, xml.HTMLEntity
+	var out []string
+	report := func(rule string, n *a11yNode, format string, args ...any) {
+		out = append(out, rule+": "+n.describe()+" "+fmt.Sprintf(format, args...))
+	}
+	ids := map[string]bool{}
+	labelFor := map[string]bool{}
+	var unlabelled []*a11yNode // form fields whose label may come later in the document
+	var mains, titles int
+	root := &a11yNode{name: "#document"}
+	cur := root
+	closeNode := func(n *a11yNode) {
+		text := strings.TrimSpace(n.text.String())
+		name := cmp.Or(text, strings.TrimSpace(n.attrs["aria-label"]), strings.TrimSpace(n.attrs["title"]))
+		switch {
+		case n.name == "button" && name == "" && !n.has("aria-labelledby"):
+			report("button-name", n, "has no text or aria-label")
+		case n.name == "a" && n.has("href") && name == "" && !n.has("aria-labelledby"):
+			report("link-name", n, "has no text or aria-label")
+		case n.name == "title":
+			if text == "" { report("document-title", n, "is empty") }
+			titles++
+		}
+		if n.parent != nil { n.parent.text.WriteString(" " + n.text.String()) }
+	}
+	for {
+		tok, err := d.RawToken()
+		if errors.Is(err, io.EOF) { break }
+		if err != nil { return out, err }
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &a11yNode{name: strings.ToLower(t.Name.Local), attrs: map[string]string{}, parent: cur}
+			for _, a := range t.Attr {
+				name := strings.ToLower(a.Name.Local)
+				if a.Name.Space != "" { name = strings.ToLower(a.Name.Space) + ":" + name }
+				n.attrs[name] = a.Value
+			}
+			if id, ok := n.attrs["id"]; ok {
+				if ids[id] { report("duplicate-id", n, "repeats an id") }
+				ids[id] = true
+			}
+			switch n.name {
+			case "html":
+				if strings.TrimSpace(n.attrs["lang"]) == "" { report("html-has-lang", n, "has no lang") }
+			case "main":
+				mains++
+			case "label":
+				if f := n.attrs["for"]; f != "" { labelFor[f] = true }
+			case "img":
+				alt, ok := n.attrs["alt"]
+				if !ok && n.attrs["aria-hidden"] != "true" && n.attrs["role"] != "presentation" { report("image-alt", n, "has no alt") }
+				cur.text.WriteString(" " + alt)
+			case "input", "select", "textarea":
+				switch n.attrs["type"] {
+				case "hidden", "submit", "button", "image", "reset":
+				default:
+					if !n.has("aria-label") && !n.has("aria-labelledby") && !n.has("title") && !n.within("label") {
+						unlabelled = append(unlabelled, n)
+					}
+				}
+			case "meta":
+				if n.attrs["name"] == "viewport" && strings.Contains(strings.ReplaceAll(n.attrs["content"], " ", ""), "user-scalable=no") {
+					report("meta-viewport", n, "disables zoom")
+				}
+			}
+			if n.attrs["role"] == "main" { mains++ }
+			if a11yVoid[n.name] {
+				closeNode(n)
+				continue
+			}
+			cur = n
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			if a11yVoid[name] { continue }
+			// Close up to the matching element, as browsers recover from a missing end tag.
+			for n := cur; n != root; n = n.parent {
+				if n.name != name { continue }
+				for cur != n.parent {
+					closeNode(cur)
+					cur = cur.parent
+				}
+				break
+			}
+		case xml.CharData:
+			cur.text.Write(t)
+		}
+	}
+	for cur != root {
+		closeNode(cur)
+		cur = cur.parent
+	}
+	for _, n := range unlabelled {
+		if !labelFor[n.attrs["id"]] || n.attrs["id"] == "" { report("label", n, "has no label") }
+	}
+	if strings.Contains(doc, "<html") && strings.Contains(doc, "</html>") {
+		if mains != 1 { out = append(out, fmt.Sprintf("landmark-one-main: the page has %d main landmarks", mains)) }
+		if titles == 0 { out = append(out, "document-title: the page has no title") }
+	}
+	return out, nil
+}
+
+func TestAccessibility(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "golden", "*.html"))
+	if err != nil || len(files) == 0 { t.Fatalf("no golden files: %v", err) }
+	docs := map[string]string{}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil { t.Fatal(err) }
+		docs[strings.TrimSuffix(filepath.Base(f), ".html")] = string(b)
+	}
+	// The home page as writeHome streams it: shell, cards and the closing parts.
+	home := []string{"home_head_spotlight", "home_cloud", "home_card", "home_card_bare", "home_tail_more", "home_foot"}
+	var page strings.Builder
+	for _, name := range home { page.WriteString(docs[name]) }
+	docs["home (assembled)"] = page.String()
+	names := make([]string, 0, len(docs))
+	for name := range docs { names = append(names, name) }
+	slices.Sort(names)
+	for _, name := range names {
+		issues, err := auditA11y(docs[name])
+		if err != nil { t.Errorf("%s: parse: %v", name, err) }
+		for _, issue := range issues { t.Errorf("%s: %s", name, issue) }
+	}
+}
+
+// TestAuditA11y checks that each rule catches what it is for.
+func TestAuditA11y(t *testing.T) {
+	page := func(body string) string {
+		return `<!DOCTYPE html><html lang="en"><head><title>t</title></head><body><main>` + body + `</main></body></html>`
+	}
+	tests := []struct{ doc, rule string }{
+		{`<html><head><title>t</title></head><body><main></main></body></html>`, "html-has-lang"},
+		{`<html lang="en"><head><title> </title></head><body><main></main></body></html>`, "document-title"},
+		{`<html lang="en"><head><title>t</title></head><body><div></div></body></html>`, "landmark-one-main"},
+		{page(`<img src="x.png">`), "image-alt"},
+		{page(`<input type="text" name="q">`), "label"},
+		{page(`<label for="a">A</label><input id="b" name="b">`), "label"},
+		{page(`<button type="submit"> </button>`), "button-name"},
+		{page(`<a href="/x"><span></span></a>`), "link-name"},
+		{page(`<p id="x"></p><p id="x"></p>`), "duplicate-id"},
+		{`<meta name="viewport" content="width=device-width, user-scalable=no">`, "meta-viewport"},
+	}
+	for _, tt := range tests {
+		issues, err := auditA11y(tt.doc)
+		if err != nil || len(issues) != 1 || !strings.HasPrefix(issues[0], tt.rule+":") {
+			t.Errorf("auditA11y(%q) = %q, %v; want one %s violation", tt.doc, issues, err, tt.rule)
+		}
+	}
+	ok := page(`<label>Name<input name="n"></label><label for="c">City</label><input id="c" name="c"><input type="search" aria-label="Search">` +
+		`<a href="/p"><img src="p.png" alt="Ada"></a><button aria-label="Vote">♥</button><img src="d.png" alt="">`)
+	if issues, err := auditA11y(ok); err != nil || len(issues) > 0 { t.Errorf("auditA11y(accessible page) = %q, %v", issues, err) }
+}
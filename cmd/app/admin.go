@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// requireAdmin guards admin routes with LEADERBOARD_ADMIN_TOKEN, accepted either as a
+// bearer token (API clients) or as the basic-auth password (browsers). The basic-auth
+// username is free-form and only recorded for auditing. Without a token the routes 404.
+// Browsers resend basic-auth credentials with requests any site makes, so requests that
+// change something must come from the board's own pages (sameOrigin).
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.AdminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if _, ok := s.adminActor(r); !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="bestfriends admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !s.sameOrigin(r) {
+			http.Error(w, "cross-site request refused", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// sameOrigin reports whether r was sent by a page of the board itself, by Sec-Fetch-Site, or
+// by Origin in browsers without it. A request with neither doesn't come from a web page (an
+// API client, lbctl, curl), so no other site can have made it.
+func (s *Server) sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" { return true }
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" { return false }
+	if u.Host == r.Host { return true }
+	pub, err := url.Parse(s.cfg.PublicURL)
+	return s.cfg.PublicURL != "" && err == nil && u.Scheme == pub.Scheme && u.Host == pub.Host
+}
+
+// adminActor checks the credentials on r and returns a label for audit records.
+func (s *Server) adminActor(r *http.Request) (string, bool) {
+	token := []byte(s.cfg.AdminToken)
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return "api", subtle.ConstantTimeCompare([]byte(bearer), token) == 1
+	}
+	if user, pass, ok := r.BasicAuth(); ok {
+		if user == "" { user = "admin" }
+		return user, subtle.ConstantTimeCompare([]byte(pass), token) == 1
+	}
+	return "", false
+}
+
+// VoteReset describes a request to archive all votes cast in [From, To).
+type VoteReset struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Reason  string    `json:"reason"`
+	Confirm bool      `json:"confirm"`
+}
+
+// VoteResetResult reports what a reset archived, or would archive when not confirmed.
+type VoteResetResult struct {
+	ID       string    `json:"id,omitempty"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Votes    int       `json:"votes"`
+	Profiles int       `json:"profiles"`
+	Applied  bool      `json:"applied"`
+}
+
+func adminResetView(req VoteReset, res *VoteResetResult, errMsg string) views.AdminResetView {
+	v := views.AdminResetView{Form: views.AdminResetForm{From: req.From, To: req.To, Reason: req.Reason}, Error: errMsg}
+	if res != nil {
+		v.Result = &views.AdminResetResult{ID: res.ID, From: res.From, To: res.To, Votes: res.Votes, Profiles: res.Profiles, Applied: res.Applied}
+	}
+	return v
+}
+
+// handleAdminVoteReset is the browser flow: GET renders the form, a first POST previews the
+// affected votes, and a POST with confirm=yes performs the reset.
+func (s *Server) handleAdminVoteReset(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		now := time.Now().UTC().Truncate(time.Minute)
+		s.render(w, "admin_reset.gohtml", adminResetView(VoteReset{From: now.AddDate(0, 0, -7), To: now}, nil, ""))
+	case http.MethodPost:
+		req, err := parseVoteResetForm(r)
+		if err != nil {
+			s.renderStatus(w, http.StatusBadRequest, "admin_reset.gohtml", adminResetView(req, nil, err.Error()))
+			return
+		}
+		actor, _ := s.adminActor(r)
+		res, err := s.resetVotes(r.Context(), req, actor)
+		if errors.As(err, new(interface{ ReadOnly() })) {
+			writeReadOnly(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+		s.render(w, "admin_reset.gohtml", adminResetView(req, &res, ""))
+	}
+}
+
+// handleAPIAdminVoteReset is the JSON variant; without "confirm": true it only previews.
+func (s *Server) handleAPIAdminVoteReset(w http.ResponseWriter, r *http.Request) {
+	var req VoteReset
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad json")
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	actor, _ := s.adminActor(r)
+	res, err := s.resetVotes(r.Context(), req, actor)
+	if errors.As(err, new(interface{ ReadOnly() })) {
+		writeReadOnly(w, r)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func parseVoteResetForm(r *http.Request) (VoteReset, error) {
+	req := VoteReset{
+		Reason:  strings.TrimSpace(r.FormValue("reason")),
+		Confirm: r.FormValue("confirm") == "yes",
+	}
+	var err error
+	// datetime-local inputs carry no zone; treat them as UTC like the rest of the admin UI.
+	if req.From, err = parseAdminTime(r.FormValue("from")); err != nil { return req, fmt.Errorf("from: %w", err) }
+	if req.To, err = parseAdminTime(r.FormValue("to")); err != nil { return req, fmt.Errorf("to: %w", err) }
+	return req, req.validate()
+}
+
+func parseAdminTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil { return t.UTC(), nil }
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", v)
+}
+
+func (v VoteReset) validate() error {
+	if v.From.IsZero() || v.To.IsZero() {
+		return errors.New("from and to are required")
+	}
+	if !v.From.Before(v.To) {
+		return errors.New("from must be before to")
+	}
+	if len(v.Reason) > 200 {
+		return errors.New("reason too long")
+	}
+	return nil
+}
+
+// resetVotes moves the votes cast in the window into votes_archive (dropping their
+// dual-written copies too; votes the previous build cast only into votes_recent are archived
+// from there) and subtracts them from votes_count in one serializable transaction,
+// recording the reset in vote_resets. When req.Confirm is false it only counts what would
+// be archived.
+func (s *Server) resetVotes(ctx context.Context, req VoteReset, actor string) (VoteResetResult, error) {
+	res := VoteResetResult{From: req.From, To: req.To}
+	if !req.Confirm {
+		err := s.db.QueryRowContext(ctx, `
+			SELECT count(*), count(DISTINCT profile_id) FROM (
+				SELECT id, profile_id FROM votes WHERE created_at >= $1 AND created_at < $2
+				UNION SELECT id, profile_id FROM votes_recent WHERE created_at >= $1 AND created_at < $2
+			) v
+		`, req.From, req.To).Scan(&res.Votes, &res.Profiles)
+		return res, err
+	}
+	if err := s.writable(); err != nil { return VoteResetResult{}, err }
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// Count buffered votes first, so the subtraction below only takes back counted ones.
+		if err := s.store.FlushVotes(store.WithTx(ctx, tx)); err != nil { return err }
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO vote_resets (window_start, window_end, reason, requested_by) VALUES ($1, $2, $3, $4)
+			RETURNING id::string
+		`, req.From, req.To, req.Reason, actor).Scan(&res.ID); err != nil { return err }
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO votes_archive (id, profile_id, created_at, reset_id)
+			SELECT id, profile_id, created_at, $3 FROM votes WHERE created_at >= $1 AND created_at < $2
+		`, req.From, req.To, res.ID); err != nil { return err }
+		// The flush above copied uncounted legacy-only rows into votes; counted ones are only here.
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO votes_archive (id, profile_id, created_at, reset_id)
+			SELECT id, profile_id, created_at, $3 FROM votes_recent WHERE created_at >= $1 AND created_at < $2
+			ON CONFLICT (id) DO NOTHING
+		`, req.From, req.To, res.ID); err != nil { return err }
+		for _, table := range []string{"votes", "votes_recent", "votes_history"} {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE created_at >= $1 AND created_at < $2`, req.From, req.To); err != nil { return err }
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE profiles p SET votes_count = greatest(p.votes_count - a.n, 0), updated_at = now()
+			FROM (SELECT profile_id, count(*) AS n FROM votes_archive WHERE reset_id = $1 GROUP BY profile_id) a
+			WHERE p.id = a.profile_id
+		`, res.ID); err != nil { return err }
+		return tx.QueryRowContext(ctx, `
+			UPDATE vote_resets SET
+				votes_archived = (SELECT count(*) FROM votes_archive WHERE reset_id = $1),
+				profiles_affected = (SELECT count(DISTINCT profile_id) FROM votes_archive WHERE reset_id = $1)
+			WHERE id = $1
+			RETURNING votes_archived, profiles_affected
+		`, res.ID).Scan(&res.Votes, &res.Profiles)
+	})
+	if err != nil { return VoteResetResult{}, err }
+	res.Applied = true
+	s.log.Info("votes reset", "id", res.ID, "from", req.From, "to", req.To, "votes", res.Votes,
+		"profiles", res.Profiles, "reason", req.Reason, "by", actor)
+	return res, nil
+}
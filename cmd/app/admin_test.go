@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireAdminRefusesCrossSiteForms(t *testing.T) {
+	s := &Server{cfg: Config{AdminToken: "admin-secret", PublicURL: "https://board.example"}}
+	h := s.requireAdmin(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	tests := []struct {
+		name, method string
+		headers      map[string]string
+		want         int
+	}{
+		{"page", "GET", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusNoContent},
+		{"own form", "POST", map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusNoContent},
+		{"other site", "POST", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"sibling subdomain", "POST", map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"own origin", "POST", map[string]string{"Origin": "http://board.internal"}, http.StatusNoContent},
+		{"public origin", "POST", map[string]string{"Origin": "https://board.example"}, http.StatusNoContent},
+		{"other origin", "POST", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"opaque origin", "POST", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"api client", "PUT", nil, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://board.internal/admin/votes/reset", strings.NewReader("confirm=yes"))
+		r.SetBasicAuth("ada", "admin-secret")
+		for k, v := range tt.headers { r.Header.Set(k, v) }
+		w := httptest.NewRecorder()
+		h(w, r)
+		if w.Code != tt.want { t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want) }
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// alertStats counts fired and suppressed alerts and webhook failures on /debug/vars.
+var alertStats = expvar.NewMap("vote_alerts")
+
+const alertWebhookTimeout = 5 * time.Second
+
+// voteAlert is one vote spike, as posted to LEADERBOARD_ALERT_WEBHOOK_URL.
+type voteAlert struct {
+	Kind      string    `json:"kind"` // "global" or "profile"
+	ProfileID string    `json:"profile_id,omitempty"`
+	FullName  string    `json:"full_name,omitempty"`
+	Votes     int       `json:"votes"`     // votes in the last minute
+	Threshold int       `json:"threshold"` // votes per minute that trigger the alert
+	At        time.Time `json:"at"`
+}
+
+func (a voteAlert) key() string {
+	if a.Kind == "profile" { return "profile:" + a.ProfileID }
+	return a.Kind
+}
+
+// checkVoteVelocity compares the last minute of votes with the configured thresholds and
+// notifies about each spike, at most once per cool-off per profile (or globally).
+func (s *Server) checkVoteVelocity(ctx context.Context) error {
+	var alerts []voteAlert
+	now := time.Now().UTC()
+	if t := s.cfg.AlertGlobalPerMinute; t > 0 {
+		var n int
+		if err := s.db.QueryRowContext(ctx, `
+			SELECT count(*) FROM votes WHERE created_at > now() - interval '1 minute'
+		`).Scan(&n); err != nil { return err }
+		if n >= t { alerts = append(alerts, voteAlert{Kind: "global", Votes: n, Threshold: t, At: now}) }
+	}
+	if t := s.cfg.AlertProfilePerMinute; t > 0 {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT v.profile_id::string, p.full_name, count(*)
+			FROM votes v JOIN profiles p ON p.id = v.profile_id
+			WHERE v.created_at > now() - interval '1 minute'
+			GROUP BY v.profile_id, p.full_name
+			HAVING count(*) >= $1
+		`, t)
+		if err != nil { return err }
+		defer rows.Close()
+		for rows.Next() {
+			a := voteAlert{Kind: "profile", Threshold: t, At: now}
+			if err := rows.Scan(&a.ProfileID, &a.FullName, &a.Votes); err != nil { return err }
+			alerts = append(alerts, a)
+		}
+		if err := rows.Err(); err != nil { return err }
+	}
+	for _, a := range alerts {
+		fire, err := s.claimAlert(ctx, a)
+		if err != nil { return err }
+		if !fire {
+			alertStats.Add("suppressed", 1)
+			continue
+		}
+		alertStats.Add("fired", 1)
+		s.log.Warn("vote spike", "kind", a.Kind, "profile", a.ProfileID, "votes", a.Votes, "threshold", a.Threshold)
+		if err := s.postWebhook(ctx, a); err != nil {
+			alertStats.Add("webhook_errors", 1)
+			s.log.Error("vote alert webhook failed", "err", err)
+		}
+	}
+	return nil
+}
+
+// claimAlert records that a fires now unless it already fired within the cool-off, and
+// reports whether this caller should send it.
+func (s *Server) claimAlert(ctx context.Context, a voteAlert) (bool, error) {
+	var key string
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO vote_alerts (key, fired_at, votes) VALUES ($1, now(), $2)
+		ON CONFLICT (key) DO UPDATE SET fired_at = excluded.fired_at, votes = excluded.votes
+		WHERE vote_alerts.fired_at < now() - $3::INT * interval '1 second'
+		RETURNING key
+	`, a.key(), a.Votes, int64(s.cfg.AlertCooloff.Seconds())).Scan(&key)
+	if err == sql.ErrNoRows { return false, nil }
+	return err == nil, err
+}
+
+// postWebhook posts v as JSON to LEADERBOARD_ALERT_WEBHOOK_URL, the admins' notification
+// channel; without one it does nothing. Payloads tell themselves apart by their "kind".
+func (s *Server) postWebhook(ctx context.Context, v any) error {
+	if s.cfg.AlertWebhookURL == "" { return nil }
+	body, err := json.Marshal(v)
+	if err != nil { return err }
+	ctx, cancel := context.WithTimeout(ctx, alertWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.AlertWebhookURL, bytes.NewReader(body))
+	if err != nil { return err }
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil { return err }
+	resp.Body.Close()
+	if resp.StatusCode >= 300 { return fmt.Errorf("webhook answered %s", resp.Status) }
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// APIProfile is the JSON representation of a profile in /api/v1 responses.
+type APIProfile struct {
+	ID          string    `json:"id"`
+	FullName    string    `json:"full_name"`
+	Country     string    `json:"country"`
+	City        string    `json:"city"`
+	Description string    `json:"description"`
+	Votes       int       `json:"votes"`
+	RateLimited bool      `json:"rate_limited"`
+	Champion    bool      `json:"champion"`
+	Pinned      bool      `json:"pinned"`
+	Retired     bool      `json:"retired,omitempty"`
+	FinalRank   int       `json:"final_rank,omitempty"`     // overall rank when retired
+	FinalChampion string  `json:"final_champion,omitempty"` // country it was champion of when retired
+	PhotoURL    string    `json:"photo_url"`
+	PhotoAlt    string    `json:"photo_alt"` // the photo described for people who can't see it; "" on older profiles
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"` // last name or description edit
+	// Matches are where the search query q occurs, per field: [start, end) in Unicode code
+	// points. Only fields with a match are listed; the field is omitted without q.
+	Matches map[string][][2]int `json:"matches,omitempty"`
+}
+
+func (s *Server) apiProfile(p Profile) APIProfile {
+	return APIProfile{
+		ID: p.ID, FullName: p.FullName, Country: p.Country, City: p.City, Description: p.Description,
+		Votes: p.Votes, RateLimited: p.RateLimited, Champion: p.Champion, Pinned: p.Pinned, PhotoURL: s.photoURL(p.ID), PhotoAlt: p.PhotoAlt,
+		Retired: p.Retired, FinalRank: p.FinalRank, FinalChampion: p.FinalChampion,
+		CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt, EditedAt: p.EditedAt,
+	}
+}
+
+// handleAPIProfiles lists profiles in leaderboard order: GET /api/v1/profiles?q=&country=&limit=&status=
+// status=retired lists the alumni instead of the active leaderboard. fields= and filter[...]=
+// are described in apifields.go.
+func (s *Server) handleAPIProfiles(w http.ResponseWriter, r *http.Request) {
+	f := profileFilter{
+		Query:   strings.TrimSpace(r.URL.Query().Get("q")),
+		Country: strings.TrimSpace(r.URL.Query().Get("country")),
+		Limit:   clampAtoi(r.URL.Query().Get("limit"), 1, maxProfiles, 100),
+	}
+	switch r.URL.Query().Get("status") {
+	case "", statusActive:
+	case statusRetired:
+		f.Status = statusRetired
+	default:
+		writeJSONError(w, http.StatusBadRequest, "status must be active or retired")
+		return
+	}
+	if err := parseFilters(r.URL.Query(), &f); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Has("fields") {
+		fields, err := parseFields(r.URL.Query().Get("fields"))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		list, err := s.queryProfileFields(r.Context(), f, fields)
+		if isQueryTimeout(err) {
+			s.writeSearchTimeout(w, r, f)
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "query error")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"profiles": list})
+		return
+	}
+
+	profiles, err := s.loadProfiles(r.Context(), f)
+	if isQueryTimeout(err) {
+		s.writeSearchTimeout(w, r, f)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "query error")
+		return
+	}
+	list := make([]APIProfile, 0, len(profiles))
+	for _, p := range profiles {
+		ap := s.apiProfile(p)
+		if f.Query != "" { ap.Matches = searchMatches(p, f.Query) }
+		list = append(list, ap)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"profiles": list})
+}
+
+// searchMatches locates query in the searchable fields of p for APIProfile.Matches.
+func searchMatches(p Profile, query string) map[string][][2]int {
+	m := map[string][][2]int{}
+	for field, text := range map[string]string{"full_name": p.FullName, "country": p.Country, "city": p.City, "description": p.Description} {
+		for _, sp := range matchSpans(text, query) {
+			start := utf8.RuneCountInString(text[:sp[0]])
+			m[field] = append(m[field], [2]int{start, start + utf8.RuneCountInString(text[sp[0]:sp[1]])})
+		}
+	}
+	return m
+}
+
+// handleAPIVote casts a vote: POST /api/v1/profiles/{id}/vote
+func (s *Server) handleAPIVote(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	err := s.castScreenedVote(r, id, "")
+	if err == nil || errors.As(err, new(interface{ RateLimited() })) {
+		if now, limits, err := s.voteRateLimits(r.Context(), id, s.voterOf(r), err == nil); err == nil { writeRateLimits(w, now, limits...) }
+	}
+	if err != nil {
+		switch {
+		case errors.As(err, new(interface{ CaptchaRequired() })):
+			s.writeCaptchaRequiredJSON(w)
+		case errors.Is(err, ErrVotedRecently):
+			writeJSONError(w, http.StatusTooManyRequests, "you already voted for this exhibit, try again later")
+		case errors.As(err, new(interface{ RateLimited() })):
+			writeJSONError(w, http.StatusTooManyRequests, "too many votes for this exhibit, try again later")
+		case errors.As(err, new(interface{ NotFound() })):
+			writeJSONError(w, http.StatusNotFound, "not found")
+		case errors.As(err, new(interface{ Retired() })):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+		default:
+			writeJSONError(w, http.StatusInternalServerError, "db error")
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+func TestHandleAPIProfiles(t *testing.T) {
+	mem := store.NewMemory()
+	mem.Put(Profile{ID: "p1", FullName: "Ada Lovelace", Country: "UK", City: "London", Votes: 3}, "", nil, "")
+	mem.Put(Profile{ID: "p2", FullName: "Rex", Country: "Chile", City: "Arica", Votes: 7}, "", nil, "")
+	mem.Put(Profile{ID: "p3", FullName: "Bo", Country: "Chile", City: "Arica", Votes: 9}, store.StatusRetired, nil, "")
+	mem.Put(Profile{ID: "p4", FullName: "Kit", Votes: 20}, store.StatusHeld, nil, "")
+	s := &Server{store: mem, profileFlight: newFlightGroup[[]Profile]("profiles")}
+	list := func(query string) ([]APIProfile, int) {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/profiles"+query, nil)
+		w := httptest.NewRecorder()
+		s.handleAPIProfiles(w, r)
+		var out struct{ Profiles []APIProfile }
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&out); err != nil { t.Fatal(err) }
+		}
+		return out.Profiles, w.Code
+	}
+	ids := func(l []APIProfile) (ids []string) {
+		for _, p := range l { ids = append(ids, p.ID) }
+		return ids
+	}
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"p2", "p1"}}, // by votes; retired and held ones left out
+		{"?country=chile", []string{"p2"}},
+		{"?q=lovelase", []string{"p1"}},
+		{"?status=retired", []string{"p3"}},
+		{"?limit=1", []string{"p2"}},
+	} {
+		l, code := list(tt.query)
+		if code != http.StatusOK || !slices.Equal(ids(l), tt.want) { t.Errorf("%q = %d %v, want %v", tt.query, code, ids(l), tt.want) }
+	}
+	if l, _ := list("?q=ada"); len(l) != 1 || l[0].Matches["full_name"] == nil { t.Errorf("search matches = %+v", l) }
+	if _, code := list("?status=held"); code != http.StatusBadRequest { t.Errorf("status=held = %d", code) }
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GET /api/v1/profiles takes ?fields= to return only some fields of each profile, for
+// embedded widgets that show a name and a count, and ?filter[name]= to narrow the listing.
+// Both are checked against allowlists; the query selects only the expressions of the
+// requested fields, so nothing the client sends reaches the SQL text.
+
+// apiField is a field ?fields= may select: its JSON name, the expression it's projected
+// from and a new destination to scan it into.
+type apiField struct {
+	name string
+	expr string
+	dest func() any
+}
+
+func scanString() any { return new(string) }
+func scanInt() any    { return new(int) }
+func scanBool() any   { return new(bool) }
+func scanTime() any   { return new(time.Time) }
+func scanNullTime() any { return new(*time.Time) }
+
+// apiFields are the selectable fields in APIProfile order. matches is left out: it needs q
+// and the text fields, so it only comes with full profiles.
+var apiFields = []apiField{
+	{"id", "p.id::string", scanString},
+	{"full_name", "p.full_name", scanString},
+	{"country", profileCountryCol, scanString},
+	{"city", profileCityCol, scanString},
+	{"description", "p.description", scanString},
+	{"votes", "p.votes_count", scanInt},
+	{"rate_limited", "", scanBool}, // profileRateLimitedCol for the current cooldown and cap
+	{"champion", profileChampionCol, scanBool},
+	{"pinned", "pp.position IS NOT NULL", scanBool},
+	{"retired", "p.status = 'retired'", scanBool},
+	{"final_rank", "COALESCE(p.final_rank, 0)", scanInt},
+	{"final_champion", "COALESCE(p.final_champion, '')", scanString},
+	{"photo_url", "p.id::string", scanString}, // the URL is built from the id
+	{"photo_alt", "p.photo_alt", scanString},
+	{"created_at", "p.created_at", scanTime},
+	{"updated_at", "p.updated_at", scanTime},
+	{"edited_at", "p.edited_at", scanNullTime},
+}
+
+// apiFieldAliases are shorter names accepted for fields.
+var apiFieldAliases = map[string]string{"name": "full_name"}
+
+// parseFields resolves a ?fields= list, in APIProfile order without duplicates. An unknown
+// field is an error rather than ignored, so a typo doesn't silently drop data.
+func parseFields(list string) ([]apiField, error) {
+	want := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" { continue }
+		if alias, ok := apiFieldAliases[name]; ok { name = alias }
+		known := false
+		for _, fd := range apiFields { known = known || fd.name == name }
+		if !known { return nil, fmt.Errorf("unknown field %q", name) }
+		want[name] = true
+	}
+	if len(want) == 0 { return nil, fmt.Errorf("fields is empty") }
+	var out []apiField
+	for _, fd := range apiFields {
+		if want[fd.name] { out = append(out, fd) }
+	}
+	return out, nil
+}
+
+// parseFilters applies the filter[name]= parameters of q to f: country and city (exact,
+// ignoring case) and min_votes.
+func parseFilters(q url.Values, f *profileFilter) error {
+	for key, vals := range q {
+		name, ok := strings.CutPrefix(key, "filter[")
+		if !ok { continue }
+		name, ok = strings.CutSuffix(name, "]")
+		if !ok { return fmt.Errorf("malformed filter %q", key) }
+		v := strings.TrimSpace(vals[0])
+		switch name {
+		case "country":
+			f.Country = v
+		case "city":
+			f.City = v
+		case "min_votes":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 { return fmt.Errorf("filter[min_votes] must be a non-negative integer") }
+			f.MinVotes = n
+		default:
+			return fmt.Errorf("unknown filter %q", name)
+		}
+	}
+	return nil
+}
+
+// queryProfileFields lists the profiles f selects like loadProfiles does, projected to
+// fields. These listings are not coalesced.
+func (s *Server) queryProfileFields(ctx context.Context, f profileFilter, fields []apiField) (_ []map[string]any, err error) {
+	ctx, cancel := s.searchContext(ctx)
+	defer cancel()
+	defer func() { err = queryTimeout(err) }()
+	cols := make([]string, len(fields))
+	for i, fd := range fields {
+		cols[i] = fd.expr
+		if fd.name == "rate_limited" { cols[i] = profileRateLimitedCol(s.settings.GetDuration(settingVoteCooldown), s.settings.GetInt(settingVoteCap)) }
+	}
+	cond, order, args := f.SQL()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+strings.Join(cols, ", ")+`
+		FROM `+profileListFrom+`
+		`+cond+`
+		ORDER BY `+order+`
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	list := make([]map[string]any, 0, f.Limit)
+	dest := make([]any, len(fields))
+	for rows.Next() {
+		for i, fd := range fields { dest[i] = fd.dest() }
+		if err := rows.Scan(dest...); err != nil { return nil, err }
+		m := make(map[string]any, len(fields))
+		for i, fd := range fields {
+			switch v := dest[i].(type) {
+			case *string:
+				m[fd.name] = *v
+			case *int:
+				m[fd.name] = *v
+			case *bool:
+				m[fd.name] = *v
+			case *time.Time:
+				m[fd.name] = *v
+			case **time.Time:
+				m[fd.name] = *v
+			}
+		}
+		if id, ok := m["photo_url"].(string); ok { m["photo_url"] = s.photoURL(id) }
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	fields, err := parseFields(" votes,name, id,votes")
+	if err != nil { t.Fatal(err) }
+	var names []string
+	for _, fd := range fields { names = append(names, fd.name) }
+	if want := []string{"id", "full_name", "votes"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("parseFields = %v, want %v (APIProfile order, alias resolved, no duplicates)", names, want)
+	}
+	for _, bad := range []string{"", ",", "id,secret", "p.id", "matches"} {
+		if _, err := parseFields(bad); err == nil {
+			t.Errorf("parseFields(%q) accepted", bad)
+		}
+	}
+}
+
+// Selectable fields are named like their APIProfile JSON keys, so a client can switch
+// between full and slim responses without renaming anything.
+func TestAPIFieldsMatchJSON(t *testing.T) {
+	keys := map[string]bool{}
+	typ := reflect.TypeOf(APIProfile{})
+	for i := 0; i < typ.NumField(); i++ {
+		keys[strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	for _, fd := range apiFields {
+		if !keys[fd.name] { t.Errorf("field %q is not an APIProfile JSON key", fd.name) }
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	q, _ := url.ParseQuery("filter[country]=France&filter[city]=Lyon&filter[min_votes]=3&q=x")
+	var f profileFilter
+	if err := parseFilters(q, &f); err != nil { t.Fatal(err) }
+	if f.Country != "France" || f.City != "Lyon" || f.MinVotes != 3 {
+		t.Errorf("parseFilters = %+v", f)
+	}
+	for _, bad := range []string{"filter[status]=held", "filter[min_votes]=-1", "filter[min_votes]=x", "filter[country=x"} {
+		q, _ := url.ParseQuery(bad)
+		if err := parseFilters(q, &profileFilter{}); err == nil {
+			t.Errorf("parseFilters(%q) accepted", bad)
+		}
+	}
+}
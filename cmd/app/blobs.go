@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/doesnotcommit/bestfriends/internal/blob"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// Photos can live in object storage instead of the profiles table, which then keeps only
+// their keys (migrations/035): LEADERBOARD_BLOB_STORE=disk keeps them under
+// LEADERBOARD_BLOB_DIR, s3 in the bucket LEADERBOARD_S3_* names. New and reprocessed photos go
+// there; `app move-photos` moves the ones already in the database. Photos are read from
+// wherever their row says, so the switch needs no downtime, but once any photo has moved the
+// store must stay configured.
+
+// newBlobStore returns the object storage cfg configures; nil keeps photos in the database.
+func newBlobStore(cfg Config) (blob.Store, error) {
+	switch cfg.BlobStore {
+	case "":
+		return nil, nil
+	case "disk":
+		d, err := blob.NewDisk(cfg.BlobDir)
+		if err != nil { return nil, fmt.Errorf("blob store: %w", err) }
+		return d, nil
+	case "s3":
+		s, err := blob.NewS3(cfg.S3)
+		if err != nil { return nil, fmt.Errorf("blob store: %w", err) }
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown LEADERBOARD_BLOB_STORE %q (disk or s3)", cfg.BlobStore)
+}
+
+func cmdMovePhotos(ctx context.Context, logger *slog.Logger, cfg Config, args []string) error {
+	fs := newFlagSet("move-photos", "[-batch 100]")
+	batch := fs.Int("batch", 100, "profiles listed per query")
+	if err := fs.Parse(args); err != nil { return err }
+	if *batch < 1 { return fmt.Errorf("-batch must be at least 1") }
+	if cfg.BlobStore == "" { return fmt.Errorf("LEADERBOARD_BLOB_STORE is unset: there is nowhere to move photos to") }
+	s, err := openServer(ctx, logger, cfg)
+	if err != nil { return err }
+	defer s.db.Close()
+	if err := s.writable(); err != nil { return err }
+	return s.movePhotos(ctx, *batch)
+}
+
+// movePhotos moves every photo kept in the database to object storage, batch profiles at a
+// time in id order. It can be stopped and rerun at any point: a photo is moved in one update,
+// and a rerun lists only those still in the database.
+func (s *Server) movePhotos(ctx context.Context, batch int) error {
+	photos := store.NewPostgres(s.db, s.blobs)
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM profiles WHERE photo_webp IS NOT NULL`).Scan(&total); err != nil { return err }
+	s.log.Info("moving photos to object storage", "store", s.cfg.BlobStore, "total", total)
+	after, moved := "00000000-0000-0000-0000-000000000000", 0
+	for {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT id::string FROM profiles WHERE photo_webp IS NOT NULL AND id > $1::UUID ORDER BY id LIMIT $2
+		`, after, batch)
+		if err != nil { return err }
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil { return err }
+		if len(ids) == 0 { break }
+		for _, id := range ids {
+			ok, err := photos.MovePhoto(ctx, id)
+			if err != nil { return fmt.Errorf("move photo of %s: %w", id, err) }
+			if ok { moved++ }
+		}
+		after = ids[len(ids)-1]
+		s.log.Info("progress", "moved", moved, "total", total)
+	}
+	s.log.Info("done", "moved", moved)
+	return nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/doesnotcommit/bestfriends/internal/blob"
+)
+
+func TestNewBlobStore(t *testing.T) {
+	if b, err := newBlobStore(Config{}); b != nil || err != nil { t.Errorf("unset = %v, %v; want the database", b, err) }
+	if b, err := newBlobStore(Config{BlobStore: "disk", BlobDir: t.TempDir()}); err != nil { t.Error(err) } else if _, ok := b.(*blob.Disk); !ok { t.Errorf("disk = %T", b) }
+	for _, cfg := range []Config{{BlobStore: "disk"}, {BlobStore: "s3", S3: blob.S3Config{Bucket: "b"}}, {BlobStore: "ftp"}} {
+		if _, err := newBlobStore(cfg); err == nil { t.Errorf("%+v accepted", cfg) }
+	}
+}
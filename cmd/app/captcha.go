@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// CAPTCHAs are asked of visitors IP reputation rates risky (see reputation.go). Turnstile and
+// hCaptcha work alike: the page loads the provider's script and widget, the widget adds its
+// response to the form, and the server checks the response with the provider's siteverify.
+
+type ErrorCaptchaRequired string
+
+func (e ErrorCaptchaRequired) Error() string { return string(e) }
+func (ErrorCaptchaRequired) CaptchaRequired() {}
+
+const ErrCaptchaRequired ErrorCaptchaRequired = "captcha required"
+
+const captchaTimeout = 5 * time.Second
+
+// captchaVerifier checks CAPTCHA responses with one provider.
+type captchaVerifier struct {
+	provider  string
+	siteKey   string
+	secret    string
+	verifyURL string
+	script    string // widget script for pages
+	class     string // widget element class
+	field     string // form field the widget fills in
+	client    *http.Client
+}
+
+// newCaptchaVerifier picks the provider named by LEADERBOARD_CAPTCHA_PROVIDER; nil means
+// no CAPTCHAs, and IP reputation only quarantines.
+func newCaptchaVerifier(cfg Config) (*captchaVerifier, error) {
+	if cfg.CaptchaProvider == "" { return nil, nil }
+	if cfg.CaptchaSiteKey == "" || cfg.CaptchaSecret == "" {
+		return nil, errors.New("LEADERBOARD_CAPTCHA_SITE_KEY and LEADERBOARD_CAPTCHA_SECRET are required with a CAPTCHA provider")
+	}
+	v := &captchaVerifier{provider: cfg.CaptchaProvider, siteKey: cfg.CaptchaSiteKey, secret: cfg.CaptchaSecret,
+		client: &http.Client{Timeout: captchaTimeout}}
+	switch cfg.CaptchaProvider {
+	case "turnstile":
+		v.verifyURL, v.script = "https://challenges.cloudflare.com/turnstile/v0/siteverify", "https://challenges.cloudflare.com/turnstile/v0/api.js"
+		v.class, v.field = "cf-turnstile", "cf-turnstile-response"
+	case "hcaptcha":
+		v.verifyURL, v.script = "https://api.hcaptcha.com/siteverify", "https://js.hcaptcha.com/1/api.js"
+		v.class, v.field = "h-captcha", "h-captcha-response"
+	default:
+		return nil, fmt.Errorf("unknown CAPTCHA provider %q", cfg.CaptchaProvider)
+	}
+	return v, nil
+}
+
+// verify asks the provider whether response is a valid, unused CAPTCHA solution from ip.
+func (v *captchaVerifier) verify(ctx context.Context, response, ip string) (bool, error) {
+	form := url.Values{"secret": {v.secret}, "response": {response}}
+	if ip != "" { form.Set("remoteip", ip) }
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil { return false, err }
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.client.Do(req)
+	if err != nil { return false, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { return false, fmt.Errorf("captcha verify: %s", resp.Status) }
+	var body struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil { return false, err }
+	return body.Success, nil
+}
+
+// captchaResponse is the CAPTCHA solution in r: the widget's form field, or captcha_token
+// for API clients that solved the widget elsewhere.
+func (v *captchaVerifier) captchaResponse(r *http.Request) string {
+	if t := r.FormValue(v.field); t != "" { return t }
+	return r.FormValue("captcha_token")
+}
+
+// captchaPassed reports whether r carries a CAPTCHA solution the provider accepts. Provider
+// errors count as failures: the visitor can try again, and quarantine remains for the worst.
+func (s *Server) captchaPassed(r *http.Request) bool {
+	response := s.captcha.captchaResponse(r)
+	if response == "" { return false }
+	ok, err := s.captcha.verify(r.Context(), response, s.clientIP(r))
+	if err != nil { s.log.Warn("captcha verify failed", "err", err, "request_id", requestID(r)) }
+	if ok { reputationStats.Add("captcha_passed", 1) } else { reputationStats.Add("captcha_failed", 1) }
+	return ok
+}
+
+// captchaView is the widget for a page, or nil when r's visitor isn't challenged.
+func (s *Server) captchaView(r *http.Request, force bool) *views.Captcha {
+	if s.captcha == nil || !(force || s.challenged(r)) { return nil }
+	return &views.Captcha{SiteKey: s.captcha.siteKey, Script: s.captcha.script, Class: s.captcha.class}
+}
+
+// writeCaptchaRequiredJSON tells an API client to solve a CAPTCHA and retry with captcha_token.
+func (s *Server) writeCaptchaRequiredJSON(w http.ResponseWriter) {
+	writeJSON(w, http.StatusForbidden, map[string]any{
+		"error":   "captcha required: solve it and retry with captcha_token",
+		"captcha": map[string]string{"provider": s.captcha.provider, "site_key": s.captcha.siteKey},
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+)
+
+// refreshChampions recomputes the top profile of every country: the one ranked first on the
+// country's leaderboard, provided it has at least one vote. awarded_at only moves when a
+// country's champion changes, so it reads as "champion since".
+func (s *Server) refreshChampions(ctx context.Context) error {
+	if err := s.writable(); err != nil { return err }
+	const top = `
+		WITH top AS (
+			SELECT DISTINCT ON (lower(location_country)) lower(location_country) AS country, id, votes_count
+			FROM profiles
+			WHERE votes_count > 0 AND status = 'active'
+			ORDER BY lower(location_country), votes_count DESC, created_at DESC
+		)`
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, top+`
+			DELETE FROM country_champions c WHERE NOT EXISTS (SELECT 1 FROM top WHERE top.country = c.country)
+		`); err != nil { return err }
+		_, err := tx.ExecContext(ctx, top+`
+			INSERT INTO country_champions (country, profile_id, votes, awarded_at, refreshed_at)
+			SELECT country, id, votes_count, now(), now() FROM top
+			ON CONFLICT (country) DO UPDATE SET
+				profile_id = excluded.profile_id,
+				votes = excluded.votes,
+				awarded_at = CASE WHEN country_champions.profile_id = excluded.profile_id
+					THEN country_champions.awarded_at ELSE excluded.awarded_at END,
+				refreshed_at = excluded.refreshed_at
+		`)
+		return err
+	})
+}
+
+// APIChampion is a country's current champion in /api/v1/champions.
+type APIChampion struct {
+	Country   string     `json:"country"`
+	Votes     int        `json:"votes"`
+	AwardedAt time.Time  `json:"awarded_at"`
+	Profile   APIProfile `json:"profile"`
+}
+
+// handleAPIChampions lists current country champions, most votes first: GET /api/v1/champions
+func (s *Server) handleAPIChampions(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT p.id::string, p.full_name, `+profileLocationCols+`, p.description, p.votes_count, p.created_at, p.updated_at,
+			c.votes, c.awarded_at
+		FROM country_champions c JOIN profiles p ON p.id = c.profile_id `+profileLocationJoin+`
+		ORDER BY c.votes DESC, p.location_country`)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "query error")
+		return
+	}
+	defer rows.Close()
+	list := []APIChampion{}
+	for rows.Next() {
+		var p Profile
+		var c APIChampion
+		if err := rows.Scan(&p.ID, &p.FullName, &p.Country, &p.City, &p.Description, &p.Votes, &p.CreatedAt, &p.UpdatedAt,
+			&c.Votes, &c.AwardedAt); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "scan error")
+			return
+		}
+		p.Champion = true
+		c.Country = p.Country
+		c.Profile = s.apiProfile(p)
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "query error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"champions": list})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Chaos mode injects faults into requests so operators can rehearse failures in staging:
+// slow responses, 500s and database connections dropping under a request. It is configured
+// by LEADERBOARD_CHAOS and refused unless LEADERBOARD_ENV names an environment other than
+// production. The syntax is rules separated by ';', each a route (as in the route table, or
+// * for every route) followed by faults:
+//
+//	GET /profiles/{id}/photo latency=300ms@0.2 error@0.05; POST /profiles/{id}/vote dbdrop@0.1
+//
+// fault@rate fires on that fraction of the route's requests, each fault rolled on its own.
+
+type chaosFault struct {
+	kind    string // "latency", "error" or "dbdrop"
+	latency time.Duration
+	rate    float64
+}
+
+type chaosRule struct {
+	route  string // "METHOD /pattern" or "*"
+	faults []chaosFault
+}
+
+// parseChaos reads a LEADERBOARD_CHAOS spec.
+func parseChaos(spec string) ([]chaosRule, error) {
+	var rules []chaosRule
+	for _, part := range strings.Split(spec, ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 { continue }
+		rule := chaosRule{route: fields[0]}
+		if rule.route != "*" {
+			if len(fields) < 2 { return nil, fmt.Errorf("chaos rule %q: want METHOD /pattern or *", part) }
+			rule.route, fields = fields[0]+" "+fields[1], fields[1:]
+		}
+		for _, f := range fields[1:] {
+			fault, err := parseChaosFault(f)
+			if err != nil { return nil, fmt.Errorf("chaos rule %q: %w", strings.TrimSpace(part), err) }
+			rule.faults = append(rule.faults, fault)
+		}
+		if len(rule.faults) == 0 { return nil, fmt.Errorf("chaos rule %q has no faults", strings.TrimSpace(part)) }
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseChaosFault(f string) (chaosFault, error) {
+	name, rate, ok := strings.Cut(f, "@")
+	if !ok { return chaosFault{}, fmt.Errorf("fault %q: want fault@rate", f) }
+	var fault chaosFault
+	var err error
+	if fault.rate, err = strconv.ParseFloat(rate, 64); err != nil || fault.rate <= 0 || fault.rate > 1 {
+		return chaosFault{}, fmt.Errorf("fault %q: rate must be in (0, 1]", f)
+	}
+	fault.kind, name, _ = strings.Cut(name, "=")
+	switch fault.kind {
+	case "latency":
+		if fault.latency, err = time.ParseDuration(name); err != nil || fault.latency <= 0 {
+			return chaosFault{}, fmt.Errorf("fault %q: want latency=<duration>@rate", f)
+		}
+	case "error", "dbdrop":
+		if name != "" { return chaosFault{}, fmt.Errorf("fault %q takes no value", f) }
+	default:
+		return chaosFault{}, fmt.Errorf("unknown fault %q", fault.kind)
+	}
+	return fault, nil
+}
+
+// checkChaos refuses chaos in production and rules naming no route, so a typo doesn't
+// leave a drill quietly doing nothing.
+func (s *Server) checkChaos() error {
+	if len(s.chaos) == 0 { return nil }
+	if s.cfg.Environment == "" || s.cfg.Environment == "production" {
+		return fmt.Errorf("LEADERBOARD_CHAOS is only allowed with LEADERBOARD_ENV set to a non-production environment")
+	}
+	for _, rule := range s.chaos {
+		found := rule.route == "*"
+		for _, rt := range s.routes() { found = found || rt.Method+" "+rt.Pattern == rule.route }
+		if !found { return fmt.Errorf("chaos rule for %q matches no route", rule.route) }
+	}
+	s.log.Warn("chaos mode on: injecting faults", "env", s.cfg.Environment, "rules", s.cfg.Chaos)
+	return nil
+}
+
+// withChaos puts a chaos middleware in front of every route a rule names, outermost so the
+// injected latency counts against the whole request.
+func (s *Server) withChaos(routes []route) []route {
+	for i, rt := range routes {
+		var faults []chaosFault
+		for _, rule := range s.chaos {
+			if rule.route == "*" || rule.route == rt.Method+" "+rt.Pattern { faults = append(faults, rule.faults...) }
+		}
+		if len(faults) == 0 { continue }
+		routes[i].Middleware = append([]middleware{{"chaos", s.chaosMiddleware(faults)}}, rt.Middleware...)
+	}
+	return routes
+}
+
+func (s *Server) chaosMiddleware(faults []chaosFault) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			for _, f := range faults {
+				if rand.Float64() >= f.rate { continue }
+				s.log.Warn("chaos", "fault", f.kind, "path", r.URL.Path, "request_id", requestID(r))
+				switch f.kind {
+				case "latency":
+					select {
+					case <-time.After(f.latency):
+					case <-r.Context().Done():
+						return
+					}
+				case "error":
+					http.Error(w, "injected fault", http.StatusInternalServerError)
+					return
+				case "dbdrop":
+					r = r.WithContext(context.WithValue(r.Context(), ctxKeyChaosDrop{}, true))
+				}
+			}
+			next(w, r)
+		}
+	}
+}
+
+type ctxKeyChaosDrop struct{}
+
+func chaosDropped(ctx context.Context) bool {
+	v, _ := ctx.Value(ctxKeyChaosDrop{}).(bool)
+	return v
+}
+
+// openChaosDB opens the database with connections that fail with driver.ErrBadConn for
+// queries made under a request the dbdrop fault picked. database/sql handles that like a
+// real dropped connection: it discards the connection and retries on new ones, then fails.
+func openChaosDB(dsn string) (*sql.DB, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil { return nil, err }
+	return sql.OpenDB(chaosConnector{c}), nil
+}
+
+type chaosConnector struct{ driver.Connector }
+
+func (c chaosConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if chaosDropped(ctx) { return nil, driver.ErrBadConn }
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil { return nil, err }
+	return chaosConn{conn}, nil
+}
+
+// chaosConn passes the context-aware driver interfaces through, failing them when the
+// context is marked.
+type chaosConn struct{ driver.Conn }
+
+func (c chaosConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if chaosDropped(ctx) { return nil, driver.ErrBadConn }
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok { return nil, driver.ErrSkip }
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c chaosConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if chaosDropped(ctx) { return nil, driver.ErrBadConn }
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok { return nil, driver.ErrSkip }
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c chaosConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if chaosDropped(ctx) { return nil, driver.ErrBadConn }
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok { return p.PrepareContext(ctx, query) }
+	return c.Conn.Prepare(query)
+}
+
+func (c chaosConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if chaosDropped(ctx) { return nil, driver.ErrBadConn }
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok { return b.BeginTx(ctx, opts) }
+	return nil, fmt.Errorf("driver does not support BeginTx")
+}
+
+func (c chaosConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok { return n.CheckNamedValue(nv) }
+	return driver.ErrSkip
+}
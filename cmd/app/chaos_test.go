@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseChaos(t *testing.T) {
+	rules, err := parseChaos("GET /profiles/{id}/photo latency=300ms@0.2 error@0.05; * dbdrop@1;")
+	if err != nil { t.Fatal(err) }
+	if len(rules) != 2 || rules[0].route != "GET /profiles/{id}/photo" || len(rules[0].faults) != 2 || rules[1].route != "*" {
+		t.Fatalf("rules = %+v", rules)
+	}
+	if f := rules[0].faults[0]; f.kind != "latency" || f.latency != 300*time.Millisecond || f.rate != 0.2 {
+		t.Errorf("latency fault = %+v", f)
+	}
+	for _, bad := range []string{"GET", "* error", "* error@0", "* error@1.5", "* latency@0.1", "* error=1@0.1", "* crash@0.1", "GET /x"} {
+		if _, err := parseChaos(bad); err == nil {
+			t.Errorf("parseChaos(%q) accepted", bad)
+		}
+	}
+}
+
+func TestCheckChaos(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rules, _ := parseChaos("* error@1")
+	for env, ok := range map[string]bool{"": false, "production": false, "staging": true} {
+		s := &Server{log: log, cfg: Config{Environment: env}, chaos: rules}
+		if err := s.checkChaos(); (err == nil) != ok {
+			t.Errorf("env %q: err = %v", env, err)
+		}
+	}
+	rules, _ = parseChaos("GET /nowhere error@1")
+	if err := (&Server{log: log, cfg: Config{Environment: "staging"}, chaos: rules}).checkChaos(); err == nil {
+		t.Error("rule for an unknown route accepted")
+	}
+}
+
+func TestChaosMiddleware(t *testing.T) {
+	s := &Server{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	var dropped, called bool
+	next := func(w http.ResponseWriter, r *http.Request) { called, dropped = true, chaosDropped(r.Context()) }
+
+	rec := httptest.NewRecorder()
+	s.chaosMiddleware([]chaosFault{{kind: "error", rate: 1}})(next)(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusInternalServerError || called {
+		t.Errorf("error fault: status %d, handler called %t", rec.Code, called)
+	}
+
+	s.chaosMiddleware([]chaosFault{{kind: "dbdrop", rate: 1}})(next)(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !called || !dropped { t.Errorf("dbdrop fault: handler called %t, context marked %t", called, dropped) }
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// coalesceStats counts, per group, how many calls ran the underlying fetch ("<name>_misses")
+// and how many shared a fetch already in flight ("<name>_hits"). Served on /debug/vars.
+var coalesceStats = expvar.NewMap("coalesce")
+
+// coalesceTimeout bounds a shared fetch, which no longer follows any one caller's context.
+const coalesceTimeout = 10 * time.Second
+
+// flightGroup coalesces concurrent calls with the same key: the first caller runs fn and
+// everyone arriving while it runs gets the same result. Nothing is kept once fn returns,
+// so this only smooths bursts (e.g. many clients revalidating a popular photo at once).
+type flightGroup[T any] struct {
+	name  string
+	mu    sync.Mutex
+	calls map[string]*flightCall[T]
+}
+
+type flightCall[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+func newFlightGroup[T any](name string) *flightGroup[T] {
+	return &flightGroup[T]{name: name, calls: map[string]*flightCall[T]{}}
+}
+
+// inFlight is the number of keys being fetched right now.
+func (g *flightGroup[T]) inFlight() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.calls)
+}
+
+// do returns fn's result for key, running fn at most once for all concurrent callers. fn
+// gets a context detached from ctx so one client hanging up doesn't fail the others; each
+// caller still stops waiting when its own ctx is done.
+func (g *flightGroup[T]) do(ctx context.Context, key string, fn func(context.Context) (T, error)) (T, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if !ok {
+		c = &flightCall[T]{done: make(chan struct{})}
+		g.calls[key] = c
+	}
+	g.mu.Unlock()
+
+	if ok {
+		coalesceStats.Add(g.name+"_hits", 1)
+	} else {
+		coalesceStats.Add(g.name+"_misses", 1)
+		go func() {
+			fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), coalesceTimeout)
+			defer cancel()
+			c.val, c.err = fn(fctx)
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFlightGroupCoalesces(t *testing.T) {
+	g := newFlightGroup[int]("test")
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn := func(context.Context) (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	hits := func() int64 {
+		if v, ok := coalesceStats.Get("test_hits").(*expvar.Int); ok { return v.Value() }
+		return 0
+	}
+	base := hits()
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]int, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = g.do(context.Background(), "k", fn)
+		}()
+	}
+	// Wait until every caller has joined the in-flight call before letting it finish.
+	for hits()-base < n-1 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("fn ran %d times, want 1", got)
+	}
+	for i, v := range results {
+		if v != 42 { t.Errorf("caller %d got %d, want 42", i, v) }
+	}
+}
+
+func TestFlightGroupCallerCancel(t *testing.T) {
+	g := newFlightGroup[int]("cancel")
+	release := make(chan struct{})
+	fnErr := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, "k", func(fctx context.Context) (int, error) {
+			<-release
+			fnErr <- fctx.Err()
+			return 1, nil
+		})
+		done <- err
+	}()
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("cancelled caller got %v, want context.Canceled", err)
+	}
+	close(release)
+	if err := <-fnErr; err != nil {
+		t.Fatalf("shared fetch saw %v after the caller left", err)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/doesnotcommit/bestfriends/internal/migrate"
+	"github.com/doesnotcommit/bestfriends/internal/reprocess"
+	"github.com/doesnotcommit/bestfriends/internal/schemadoc"
+	"github.com/doesnotcommit/bestfriends/migrations"
+)
+
+// command is one subcommand of the app binary. All of them read the same LEADERBOARD_*
+// environment through loadConfig.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, logger *slog.Logger, cfg Config, args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "run the web server (the default without a command)", cmdServe},
+		{"migrate", "apply, roll back or list the schema migrations", cmdMigrate},
+		{"seed", "add demo profiles with generated photos and votes to an empty database", cmdSeed},
+		{"reconcile", "recount votes_count from the vote tables; previews unless -yes", cmdReconcile},
+		{"reprocess", "re-derive stored photos with the current pipeline (checkpointed, resumable)", cmdReprocess},
+		{"copy-legacy-votes", "copy votes the previous build left in the legacy vote tables only into votes", cmdCopyLegacyVotes},
+		{"move-photos", "move photos kept in the database to object storage (LEADERBOARD_BLOB_STORE)", cmdMovePhotos},
+	}
+}
+
+// runCommand dispatches args[0]. Without a command, or when the first argument is a flag,
+// the binary serves, as it did before it had subcommands.
+func runCommand(logger *slog.Logger, cfg Config, args []string) error {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") { name, args = args[0], args[1:] }
+	for _, c := range commands() {
+		if c.name != name { continue }
+		ctx := context.Background()
+		if name != "serve" {
+			// One-off commands stop at the next checkpoint on Ctrl-C; the server handles
+			// its signals in cmdServe.
+			var stop context.CancelFunc
+			ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+			defer stop()
+		}
+		return c.run(ctx, logger, cfg, args)
+	}
+	if name == "help" {
+		commandUsage(os.Stdout)
+		return nil
+	}
+	commandUsage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func commandUsage(w *os.File) {
+	fmt.Fprintln(w, "usage: app [command] [flags]\n\nCommands:")
+	for _, c := range commands() {
+		fmt.Fprintf(w, "  %-18s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nConfiguration comes from the LEADERBOARD_* environment; run app <command> -h for flags.")
+}
+
+// newFlagSet returns a flag set for command name whose usage line names the binary.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: app %s %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// openDB connects to LEADERBOARD_DB_URL once, without the server's startup retries: a
+// one-off command should fail fast when the database is unreachable.
+func openDB(ctx context.Context, cfg Config) (*sql.DB, error) {
+	if cfg.DBURL == "" { return nil, fmt.Errorf("LEADERBOARD_DB_URL is required") }
+	db, err := sql.Open("postgres", cfg.DBURL)
+	if err != nil { return nil, fmt.Errorf("open db: %w", err) }
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+	return db, nil
+}
+
+// openServer is openDB plus a Server over it whose schema has been checked, for commands that
+// share the server's queries.
+func openServer(ctx context.Context, logger *slog.Logger, cfg Config) (*Server, error) {
+	db, err := openDB(ctx, cfg)
+	if err != nil { return nil, err }
+	s, err := newServer(logger, cfg, db)
+	if err == nil { err = s.checkSchema(ctx) }
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func cmdServe(ctx context.Context, logger *slog.Logger, cfg Config, args []string) error {
+	fs := newFlagSet("serve", "")
+	if err := fs.Parse(args); err != nil { return err }
+	// SIGINT or SIGTERM drains the server (see drain); a second signal kills it outright.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return run(ctx, logger, cfg)
+}
+
+func cmdMigrate(ctx context.Context, logger *slog.Logger, cfg Config, args []string) error {
+	action := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") { action, args = args[0], args[1:] }
+	fs := newFlagSet("migrate", "[up|down|status|dry-run|graph] [-to N] [-dry-run] [-parallel N] [-dir DIR] [-schema-doc FILE]")
+	dir := fs.String("dir", cfg.MigrationsDir, "directory of .sql migrations (default: the ones built in)")
+	to := fs.Int("to", migrate.Latest, "target version: up applies through it, down rolls back everything above it (default: up all, down one)")
+	dryRun := fs.Bool("dry-run", false, "print the SQL up or down would run instead of running it")
+	parallel := fs.Int("parallel", 0, "apply up to N files marked \"-- migrate: parallel\" at once, each on its own connection (default: one file at a time)")
+	doc := fs.String("schema-doc", os.Getenv("LEADERBOARD_SCHEMA_DOC"), "write the schema reference here after migrating (.html or Markdown)")
+	if err := fs.Parse(args); err != nil { return err }
+	if *to < migrate.Latest { return fmt.Errorf("-to must be a version number") }
+	if *parallel < 0 { return fmt.Errorf("-parallel must not be negative") }
+	if action == "graph" { return migrate.WriteGraph(os.Stdout, migrations.Open(*dir)) }
+	db, err := openDB(ctx, cfg)
+	if err != nil { return err }
+	defer db.Close()
+	o := migrate.Options{Env: cfg.Environment, To: *to, DryRun: *dryRun, Parallel: *parallel}
+	if err := migrate.Do(ctx, logger, db, migrations.Open(*dir), action, o); err != nil { return err }
+	if *doc == "" || *dryRun || action == "dry-run" || action == "status" { return nil }
+	if err := schemadoc.WriteFile(ctx, db, migrations.Open(*dir), *doc); err != nil { return fmt.Errorf("schema doc: %w", err) }
+	logger.Info("schema doc written", "file", *doc)
+	return nil
+}
+
+func cmdSeed(ctx context.Context, logger *slog.Logger, cfg Config, args []string) error {
+	fs := newFlagSet("seed", "[-n 24] [-votes 40] [-force]")
+	n := fs.Int("n", 24, "profiles to add")
+	votes := fs.Int("votes", 40, "most votes per profile, spread over the last week")
+	force := fs.Bool("force", false, "seed even when the database already has profiles")
+	if err := fs.Parse(args); err != nil { return err }
+	if *n < 1 || *n > maxProfiles || *votes < 0 { return fmt.Errorf("-n must be 1..%d and -votes at least 0", maxProfiles) }
+	s, err := openServer(ctx, logger, cfg)
+	if err != nil { return err }
+	defer s.db.Close()
+	return s.seed(ctx, *n, *votes, *force)
+}
+
+func cmdReconcile(ctx context.Context, logger *slog.Logger, cfg Config, args []string) error {
+	fs := newFlagSet("reconcile", "[-yes]")
+	yes := fs.Bool("yes", false, "correct the counts instead of listing the drift")
+	if err := fs.Parse(args); err != nil { return err }
+	s, err := openServer(ctx, logger, cfg)
+	if err != nil { return err }
+	defer s.db.Close()
+	return s.reconcile(ctx, *yes)
+}
+
+func cmdReprocess(ctx context.Context, logger *slog.Logger, cfg Config, args []string) error {
+	fs := newFlagSet("reprocess", "[-batch 100] [-concurrency N] [-run name] [-restart]")
+	var o reprocess.Options
+	fs.StringVar(&o.Run, "run", reprocess.DefaultRun(), "checkpoint name; rerunning the same name resumes")
+	fs.IntVar(&o.Batch, "batch", 100, "profiles per batch (checkpointed after each)")
+	fs.IntVar(&o.Concurrency, "concurrency", runtime.NumCPU(), "photos processed in parallel")
+	fs.BoolVar(&o.Restart, "restart", false, "discard the checkpoint and start from the first profile")
+	if err := fs.Parse(args); err != nil { return err }
+	if o.Batch < 1 || o.Concurrency < 1 || o.Run == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	s, err := openServer(ctx, logger, cfg)
+	if err != nil { return err }
+	defer s.db.Close()
+	if err := s.writable(); err != nil { return err }
+	o.Blobs = s.blobs
+	return reprocess.Run(ctx, logger, s.db, o)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+	"github.com/doesnotcommit/bestfriends/internal/profile"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// Profile creation is one pipeline for the add form (POST /profiles) and the API (POST
+// /api/v1/profiles, multipart or JSON with a base64 photo): validation, IP screening,
+// moderation, the daily quota, the photo pipeline and its quality warnings, then the insert.
+// createProfile returns typed errors; each handler words them for its clients.
+
+// profileSubmission is one profile to create. photo is called only once the cheaper checks
+// have passed, so a rejected submission doesn't cost a photo decode.
+type profileSubmission struct {
+	FullName, Country, City, Description string
+	PhotoAlt                             string // the photo described for people who can't see it; required
+	PhotoOK                              bool   // keep the photo despite quality warnings
+	NameOK                               bool // add it although its name is taken in its city (name_uniqueness warn)
+	ShowPhotoDate                        bool // keep the month the photo was taken, from its EXIF
+	photo                                func() ([]byte, *multipart.FileHeader, error)
+}
+
+// createdProfile is what createProfile stored.
+type createdProfile struct {
+	ID, Status                           string // Status is active, or held for review
+	FullName, Country, City, Description string // as stored, after moderation redactions
+	PhotoAlt                             string
+	CreatedAt                            time.Time
+	Photo                                []byte // as stored
+	ContentType                          string
+	PhotoTaken                           *time.Time // month the photo was taken; nil unless asked for and known
+	Width, Height                        int
+	Warnings                             []imaging.Warning // kept with PhotoOK
+}
+
+// ErrorPhotoWarnings stops a submission whose photo has quality warnings, unless PhotoOK.
+type ErrorPhotoWarnings []imaging.Warning
+
+func (e ErrorPhotoWarnings) Error() string {
+	codes := make([]string, len(e))
+	for i, wn := range e { codes[i] = wn.Code }
+	return "photo quality warnings (" + strings.Join(codes, ", ") + "); resubmit with photo_ok=1 to keep the photo"
+}
+func (ErrorPhotoWarnings) PhotoWarnings() {}
+
+// ErrPhotoProcessing is a photo that passed the upload checks but could not be stored.
+const ErrPhotoProcessing ErrorBadUpload = "image processing failed"
+
+// createProfile runs sub through the creation pipeline on behalf of r's visitor.
+func (s *Server) createProfile(r *http.Request, sub profileSubmission) (createdProfile, error) {
+	ctx := r.Context()
+	var c createdProfile
+	sub.FullName, sub.Country = strings.TrimSpace(sub.FullName), strings.TrimSpace(sub.Country)
+	sub.City, sub.Description = strings.TrimSpace(sub.City), strings.TrimSpace(sub.Description)
+	sub.PhotoAlt = strings.TrimSpace(sub.PhotoAlt)
+	if err := profile.Validate(sub.FullName, sub.Country, sub.City, sub.Description); err != nil { return c, err }
+	if err := profile.ValidatePhotoAlt(sub.PhotoAlt); err != nil { return c, err }
+	screen := s.screenRequest(r, "create")
+	if screen.decision == repChallenge { return c, ErrCaptchaRequired }
+	mod, err := s.moderateProfile(ctx, sub.FullName, sub.Description)
+	if err != nil { return c, err }
+
+	visitor := s.visitor(r)
+	if mod.Action == modReject {
+		if s.writable() == nil {
+			if err := recordModerationMatches(ctx, s.db, mod.Matches, "", visitor.current()); err != nil {
+				s.log.Error("record moderation matches", "err", err)
+			}
+		}
+		return c, ErrModerated
+	}
+	c.FullName, c.Country, c.City, c.Description = mod.FullName, sub.Country, sub.City, mod.Description
+	c.PhotoAlt = sub.PhotoAlt
+	c.Status = statusActive
+	// High-risk sources are held for review like moderation holds, with the same answer.
+	if mod.Action == modHold || screen.decision == repQuarantine { c.Status = statusHeld }
+	if err := s.checkCreateQuota(ctx, visitor); err != nil { return c, err }
+	nameUnique, err := s.checkDuplicateName(ctx, c.FullName, c.Country, c.City, sub.NameOK)
+	if err != nil { return c, err }
+
+	upload, header, err := sub.photo()
+	if err != nil { return c, err }
+	if err := imaging.CheckUpload(upload, header); err != nil { return c, err }
+	if t, ok := imaging.CaptureTime(upload); sub.ShowPhotoDate && ok {
+		month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		c.PhotoTaken = &month
+	}
+	processed, contentType, warnings, err := imaging.ProcessInspect(upload, imaging.MaxWidth, imaging.MaxBytes)
+	if err != nil {
+		if errors.As(err, new(interface{ InvalidImage() })) { return c, err }
+		return c, ErrPhotoProcessing
+	}
+	if len(warnings) > 0 && !sub.PhotoOK { return c, ErrorPhotoWarnings(warnings) }
+	c.Photo, c.ContentType, c.Warnings = processed, contentType, warnings
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(processed)); err == nil { c.Width, c.Height = cfg.Width, cfg.Height }
+	variants := makeVariants(processed)
+
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.writable(); err != nil { return err }
+		if err := s.takeCreateQuota(ctx, tx, visitor); err != nil { return err }
+		cityID, err := resolveCity(ctx, tx, c.Country, c.City)
+		if err != nil { return err }
+		c.ID, c.CreatedAt, err = s.store.CreateProfile(store.WithTx(ctx, tx), store.NewProfile{FullName: c.FullName, Country: c.Country, City: c.City,
+			CityID: cityID, Description: c.Description, PhotoAlt: c.PhotoAlt, Photo: processed, ContentType: contentType, Status: c.Status, PhotoTaken: c.PhotoTaken, NameUnique: nameUnique})
+		if err != nil { return err }
+		if err := recordModerationMatches(ctx, tx, mod.Matches, c.ID, visitor.current()); err != nil { return err }
+		if err := storePlaceholder(ctx, tx, c.ID, processed); err != nil { return err }
+		if err := storeVariants(ctx, tx, c.ID, variants); err != nil { return err }
+		return s.keepOriginal(ctx, tx, c.ID, upload)
+	})
+	if isNameConflict(err) {
+		// Another submission with the name won the race since checkDuplicateName.
+		_, existing, lerr := s.duplicateNames(ctx, c.FullName, c.Country, c.City)
+		if lerr != nil { return c, lerr }
+		return c, ErrorDuplicateName{Existing: existing, Enforced: true}
+	}
+	return c, err
+}
+
+// maxJSONCreateBytes bounds a JSON profile body: the largest photo in base64 plus the fields.
+const maxJSONCreateBytes = (maxUploadAcceptBytes+2)/3*4 + 64<<10
+
+// APICreateProfile is the JSON body of POST /api/v1/profiles.
+type APICreateProfile struct {
+	FullName         string `json:"full_name"`
+	Country          string `json:"country"`
+	City             string `json:"city"`
+	Description      string `json:"description"`
+	Photo            string `json:"photo"`              // base64 (standard alphabet), optionally as a data: URL
+	PhotoAlt         string `json:"photo_alt"`          // the photo described for people who can't see it; required
+	PhotoFilename    string `json:"photo_filename"`     // optional; checked against the image like a form upload's
+	PhotoContentType string `json:"photo_content_type"` // optional, likewise
+	PhotoOK          bool   `json:"photo_ok"`
+	NameOK           bool   `json:"name_ok"` // add it although the name is taken in the city, when name_uniqueness is warn
+	ShowPhotoDate    bool   `json:"show_photo_date"` // keep the month the photo was taken, from its EXIF
+	CaptchaToken     string `json:"captcha_token"`
+}
+
+// APICreatedProfile is the answer to POST /api/v1/profiles.
+type APICreatedProfile struct {
+	APIProfile
+	Status   string            `json:"status"` // active, or held for review
+	Photo    *APIStoredPhoto   `json:"photo,omitempty"`
+	Warnings []imaging.Warning `json:"warnings,omitempty"`
+}
+
+// APIStoredPhoto describes the photo as the pipeline stored it.
+type APIStoredPhoto struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Bytes       int    `json:"bytes"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+// decodePhoto decodes a JSON photo field: base64, with or without a data: URL prefix.
+func decodePhoto(s string) ([]byte, error) {
+	if rest, ok := strings.CutPrefix(s, "data:"); ok {
+		_, data, found := strings.Cut(rest, ";base64,")
+		if !found { return nil, ErrorBadUpload("photo must be base64") }
+		s = data
+	}
+	if s == "" { return nil, ErrPhotoRequired }
+	if base64.StdEncoding.DecodedLen(len(s)) > maxUploadAcceptBytes+3 { return nil, ErrPhotoTooLarge }
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil { return nil, ErrorBadUpload("photo must be base64") }
+	if len(b) > maxUploadAcceptBytes { return nil, ErrPhotoTooLarge }
+	return b, nil
+}
+
+// handleAPICreateProfile creates a profile: POST /api/v1/profiles with the add form's
+// multipart fields, or JSON (APICreateProfile) with the photo in base64. Created profiles
+// answer 201 with a Location; held ones 202.
+func (s *Server) handleAPICreateProfile(w http.ResponseWriter, r *http.Request) {
+	if !s.settings.GetBool(settingSubmissionsOpen) {
+		writeJSONError(w, http.StatusForbidden, "submissions are closed")
+		return
+	}
+	var sub profileSubmission
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "multipart/form-data":
+		if err := parseUploadForm(w, r); err != nil {
+			s.writeAPICreateError(w, r, err)
+			return
+		}
+		sub = profileSubmission{FullName: r.FormValue("full_name"), Country: r.FormValue("country"), City: r.FormValue("city"),
+			Description: r.FormValue("description"), PhotoAlt: r.FormValue("photo_alt"), PhotoOK: r.FormValue("photo_ok") != "", ShowPhotoDate: r.FormValue("show_photo_date") != "",
+			NameOK: r.FormValue("name_ok") != "", photo: func() ([]byte, *multipart.FileHeader, error) { return readPhoto(r) }}
+	case "application/json":
+		var req APICreateProfile
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONCreateBytes)).Decode(&req); err != nil {
+			if errors.As(err, new(*http.MaxBytesError)) {
+				s.writeAPICreateError(w, r, ErrFormTooLarge)
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "bad json")
+			return
+		}
+		// The CAPTCHA check reads captcha_token from the form, as for the add form.
+		if err := r.ParseForm(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad query")
+			return
+		}
+		if req.CaptchaToken != "" { r.Form.Set("captcha_token", req.CaptchaToken) }
+		header := &multipart.FileHeader{Filename: req.PhotoFilename, Header: textproto.MIMEHeader{}}
+		if req.PhotoContentType != "" { header.Header.Set("Content-Type", req.PhotoContentType) }
+		sub = profileSubmission{FullName: req.FullName, Country: req.Country, City: req.City, Description: req.Description, PhotoAlt: req.PhotoAlt, PhotoOK: req.PhotoOK,
+			ShowPhotoDate: req.ShowPhotoDate, NameOK: req.NameOK,
+			photo: func() ([]byte, *multipart.FileHeader, error) {
+				b, err := decodePhoto(req.Photo)
+				header.Size = int64(len(b))
+				return b, header, err
+			}}
+	default:
+		writeJSONError(w, http.StatusUnsupportedMediaType, "send multipart/form-data or application/json")
+		return
+	}
+
+	c, err := s.createProfile(r, sub)
+	if now, limits, err := s.createRateLimits(r); err == nil { writeRateLimits(w, now, limits...) }
+	if err != nil {
+		s.writeAPICreateError(w, r, err)
+		return
+	}
+	res := APICreatedProfile{Status: c.Status, Warnings: c.Warnings}
+	res.ID, res.CreatedAt, res.UpdatedAt = c.ID, c.CreatedAt, c.CreatedAt
+	res.FullName, res.Country, res.City, res.Description = c.FullName, c.Country, c.City, c.Description
+	res.PhotoAlt = c.PhotoAlt
+	if c.Status == statusHeld {
+		// Held profiles aren't public yet: no page or photo to point at.
+		writeJSON(w, http.StatusAccepted, res)
+		return
+	}
+	res.PhotoURL = s.photoURL(c.ID)
+	res.Photo = &APIStoredPhoto{URL: res.PhotoURL, ContentType: c.ContentType, Bytes: len(c.Photo), Width: c.Width, Height: c.Height}
+	w.Header().Set("Location", "/profiles/"+c.ID)
+	writeJSON(w, http.StatusCreated, res)
+}
+
+// writeAPICreateError answers a failed API profile creation.
+func (s *Server) writeAPICreateError(w http.ResponseWriter, r *http.Request, err error) {
+	var warnings ErrorPhotoWarnings
+	var dup ErrorDuplicateName
+	switch {
+	case errors.As(err, &warnings):
+		s.writePhotoWarnings(w, r, views.AddForm{}, warnings)
+	case errors.As(err, &dup):
+		s.writeDuplicateName(w, r, views.AddForm{}, dup)
+	case errors.As(err, new(interface{ CaptchaRequired() })):
+		s.writeCaptchaRequiredJSON(w)
+	case errors.Is(err, ErrFormTooLarge):
+		writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.As(err, new(interface{ InvalidProfile() })), errors.As(err, new(interface{ Moderated() })),
+		errors.As(err, new(interface{ BadUpload() })), errors.As(err, new(interface{ InvalidImage() })):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, new(interface{ QuotaExceeded() })):
+		s.writeQuotaExceeded(w, r)
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	default:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodePhoto(t *testing.T) {
+	raw := []byte("\x89PNG\r\n\x1a\nrest")
+	enc := base64.StdEncoding.EncodeToString(raw)
+	for _, in := range []string{enc, "data:image/png;base64," + enc} {
+		if b, err := decodePhoto(in); err != nil || !bytes.Equal(b, raw) { t.Errorf("decodePhoto(%.30q) = %q, %v", in, b, err) }
+	}
+	for in, want := range map[string]error{
+		"":                      ErrPhotoRequired,
+		"data:image/png,abc":    ErrorBadUpload("photo must be base64"),
+		"not base64!":           ErrorBadUpload("photo must be base64"),
+		strings.Repeat("A", (maxUploadAcceptBytes+3)/3*4+8): ErrPhotoTooLarge,
+	} {
+		if _, err := decodePhoto(in); !errors.Is(err, want) { t.Errorf("decodePhoto(%.30q) = %v, want %v", in, err, want) }
+	}
+}
+
+// The API answers requests that fail before the database in JSON.
+func TestAPICreateProfileRejects(t *testing.T) {
+	s := &Server{}
+	for _, tt := range []struct {
+		contentType, body string
+		status            int
+	}{
+		{"text/plain", "hi", http.StatusUnsupportedMediaType},
+		{"application/json", "{", http.StatusBadRequest},
+		{"application/json", `{"full_name": "Ada", "country": "UK"}`, http.StatusBadRequest},
+		{"application/json", `{"photo": "` + strings.Repeat("A", maxJSONCreateBytes) + `"}`, http.StatusRequestEntityTooLarge},
+		{"multipart/form-data; boundary=b", "--b\r\nbroken", http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest("POST", "/api/v1/profiles", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		s.handleAPICreateProfile(w, r)
+		if w.Code != tt.status || w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s %.40q: %d %s, want %d JSON", tt.contentType, tt.body, w.Code, w.Header().Get("Content-Type"), tt.status)
+		}
+	}
+}
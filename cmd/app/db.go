@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// dbState tracks the initial connection so /readyz can report it while startup retries, and
+// then the startup migrations (LEADERBOARD_AUTO_MIGRATE).
+type dbState struct {
+	mu        sync.Mutex
+	ready     bool
+	attempts  int
+	lastErr   error
+	migrating bool
+}
+
+func (d *dbState) set(ready bool, attempts int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ready, d.attempts, d.lastErr = ready, attempts, err
+}
+
+func (d *dbState) setMigrating(migrating bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.migrating = migrating
+}
+
+// status returns whether the database has been reached at least once and is migrated and, if
+// not, why.
+func (d *dbState) status() (bool, string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.ready && d.migrating { return false, "db: applying migrations" }
+	if d.ready { return true, "" }
+	if d.attempts == 0 { return false, "db: connecting" }
+	return false, fmt.Sprintf("db: connecting (attempt %d): %v", d.attempts, d.lastErr)
+}
+
+// connectWithRetry pings db with exponential backoff (initial delay doubling up to max, with
+// jitter) until it succeeds or the window elapses. Databases often come up after the app in
+// container orchestration, so a brief outage at boot should not crash the process.
+func connectWithRetry(ctx context.Context, db *sql.DB, cfg Config, state *dbState, onRetry func(attempt int, wait time.Duration, err error)) error {
+	deadline := time.Now().Add(cfg.DBConnectWindow)
+	delay := cfg.DBRetryInitial
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			state.set(true, attempt, nil)
+			return nil
+		}
+		state.set(false, attempt, err)
+		wait := delay/2 + rand.N(delay) // jitter in [delay/2, 1.5*delay)
+		if time.Now().Add(wait).After(deadline) {
+			return fmt.Errorf("ping db: giving up after %d attempts: %w", attempt, err)
+		}
+		onRetry(attempt, wait, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, cfg.DBRetryMax)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// The /admin/debug endpoints answer the first questions of production triage: what is this
+// instance configured with, what does it serve, and what is it busy with. They describe the
+// instance that answers, like /api/v1/admin/read-only.
+
+// APIConfigEntry is one Config field in /admin/debug/config.
+type APIConfigEntry struct {
+	Field string `json:"field"`
+	Value any    `json:"value"`
+}
+
+// secretConfigField matches Config fields whose values are never shown, only whether they
+// are set. Webhook URLs count: most carry their credential in the path.
+func secretConfigField(name string) bool {
+	for _, s := range []string{"Key", "Token", "Secret", "Password", "Webhook"} {
+		if strings.Contains(name, s) { return true }
+	}
+	return false
+}
+
+// redactedConfig lists every field of cfg in declaration order, so new settings show up
+// without touching this. Secrets become "(set)" or "(unset)"; URLs lose their password and
+// query values (connection strings can carry credentials in either); durations are strings.
+// Nested structs (S3) are listed the same way, field by field.
+func redactedConfig(cfg Config) []APIConfigEntry { return redactedFields(reflect.ValueOf(cfg)) }
+
+func redactedFields(v reflect.Value) []APIConfigEntry {
+	out := make([]APIConfigEntry, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		field, f := v.Type().Field(i), v.Field(i)
+		if !field.IsExported() { continue }
+		name := field.Name
+		var val any = f.Interface()
+		switch x := val.(type) {
+		case time.Duration:
+			val = x.String()
+		case string:
+			switch {
+			case secretConfigField(name) && x == "":
+				val = "(unset)"
+			case secretConfigField(name):
+				val = "(set)"
+			default:
+				val = redactURL(x)
+			}
+		default:
+			if f.Kind() == reflect.Struct { val = redactedFields(f) }
+		}
+		out = append(out, APIConfigEntry{Field: name, Value: val})
+	}
+	return out
+}
+
+// redactURL hides the password and query values of s when it is a URL with a host, and the
+// password of a libpq key=value connection string ("host=db user=app password=..."); other
+// strings are returned as they are.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" { return dsnPassword.ReplaceAllString(s, "${1}xxxxx") }
+	q := u.Query()
+	for k := range q { q[k] = []string{"xxxxx"} }
+	u.RawQuery = q.Encode()
+	return u.Redacted()
+}
+
+// dsnPassword matches a password (or sslpassword) in a key=value connection string, its value
+// bare or single-quoted.
+var dsnPassword = regexp.MustCompile(`(?i)(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S*)`)
+
+// handleAdminDebugConfig serves the effective configuration: GET /admin/debug/config
+func (s *Server) handleAdminDebugConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"config": redactedConfig(s.cfg)})
+}
+
+// handleAdminDebugStats serves what the instance is doing: GET /admin/debug/stats
+func (s *Server) handleAdminDebugStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	db := s.db.Stats()
+	readOnly := map[string]bool{"maintenance": s.readOnly.maintenance.Load(), "schema": s.readOnly.schema.Load()}
+	// Coalescing keeps nothing after a fetch, so in-flight keys are its whole cache.
+	inFlight := map[string]int{"photo": s.photoFlight.inFlight(), "profiles": s.profileFlight.inFlight(),
+		"translate": s.translateFlight.inFlight()}
+	queued := -1 // -1: votes are written through, there is no buffer
+	if s.votes != nil { queued = s.votes.queued() }
+	ready, dbStatus := s.dbState.status()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"uptime":    time.Since(s.started).Round(time.Second).String(),
+		"go":        map[string]any{"version": runtime.Version(), "goroutines": runtime.NumGoroutine(), "heap_alloc_bytes": mem.HeapAlloc, "gc_runs": mem.NumGC},
+		"db":        map[string]any{"ready": ready, "status": dbStatus, "open": db.OpenConnections, "in_use": db.InUse, "idle": db.Idle, "wait_count": db.WaitCount, "wait_duration": db.WaitDuration.String()},
+		"read_only": readOnly,
+		"in_flight": inFlight,
+		"vote_buffer_queued": queued,
+		"jobs":      s.jobs.snapshot(),
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/blob"
+)
+
+func TestRedactedConfigHidesSecrets(t *testing.T) {
+	cfg := Config{
+		Addr:            ":8080",
+		DBURL:           "postgresql://app:hunter2@db:26257/bestfriends?sslmode=verify-full&password=hunter3",
+		AdminToken:      "admin-secret",
+		PhotoSigningKey: "photo-secret",
+		VoteLinkKey:     "",
+		TranslateAPIKey: "deepl-secret",
+		AlertWebhookURL: "https://hooks.example.com/services/T000/B000/webhook-secret",
+		TranslateURL:    "https://translate.example.com/?api_key=query-secret",
+		PhotoURLTTL:     time.Hour,
+		S3:              blob.S3Config{Endpoint: "https://s3.example.com", Bucket: "photos", AccessKey: "s3-access", SecretKey: "s3-secret"},
+	}
+	entries := redactedConfig(cfg)
+	b, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "hunter3", "admin-secret", "photo-secret", "deepl-secret", "webhook-secret", "query-secret", "s3-access", "s3-secret"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("config dump leaks %q: %s", secret, b)
+		}
+	}
+	got := map[string]any{}
+	for _, e := range entries { got[e.Field] = e.Value }
+	for field, want := range map[string]any{
+		"Addr": ":8080", "AdminToken": "(set)", "VoteLinkKey": "(unset)", "PhotoURLTTL": "1h0m0s",
+		"DBURL": "postgresql://app:xxxxx@db:26257/bestfriends?password=xxxxx&sslmode=xxxxx",
+	} {
+		if got[field] != want {
+			t.Errorf("%s = %v, want %v", field, got[field], want)
+		}
+	}
+	s3 := map[string]any{}
+	if nested, ok := got["S3"].([]APIConfigEntry); ok {
+		for _, e := range nested { s3[e.Field] = e.Value }
+	}
+	for field, want := range map[string]any{"Endpoint": "https://s3.example.com", "Bucket": "photos", "AccessKey": "(set)", "SecretKey": "(set)", "PathStyle": false} {
+		if s3[field] != want {
+			t.Errorf("S3.%s = %v, want %v", field, s3[field], want)
+		}
+	}
+	for dsn, want := range map[string]string{
+		"host=db user=app password=hunter2 sslmode=verify-full": "host=db user=app password=xxxxx sslmode=verify-full",
+		`host=db password='hunter 2\'s' dbname=app`:             "host=db password=xxxxx dbname=app",
+		"host=db sslpassword=hunter2":                           "host=db sslpassword=xxxxx",
+	} {
+		for _, e := range redactedConfig(Config{DBURL: dsn}) {
+			if e.Field == "DBURL" && e.Value != want {
+				t.Errorf("DBURL %q = %v, want %s", dsn, e.Value, want)
+			}
+		}
+	}
+	if n := reflect.TypeOf(cfg).NumField(); len(entries) != n {
+		t.Errorf("%d entries, want one per Config field (%d)", len(entries), n)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// Moderation digest: while profiles wait for review, the admins in LEADERBOARD_DIGEST_TO get
+// one email per hour or UTC day (LEADERBOARD_DIGEST_SCHEDULE) listing them with thumbnails
+// and approve and reject links. The links open /admin/moderation/review behind the admin
+// login like the rest of /admin, and carry a signature over the profile, the action and an
+// expiry: mail scanners following them only meet the login, and a link can't be edited into
+// acting on another profile.
+
+const (
+	digestCheckInterval = 5 * time.Minute
+	digestMaxProfiles   = 25                 // listed per email; the rest are counted
+	digestLinkTTL       = 7 * 24 * time.Hour // review links and thumbnails
+	smtpTimeout         = 30 * time.Second
+)
+
+// Review actions of a digest link.
+const (
+	reviewApprove = "approve"
+	reviewReject  = "reject"
+)
+
+type ErrorReviewLink string
+
+func (e ErrorReviewLink) Error() string { return string(e) }
+func (ErrorReviewLink) ReviewLink()     {}
+
+const (
+	ErrReviewLinkInvalid ErrorReviewLink = "This review link is not valid."
+	ErrReviewLinkExpired ErrorReviewLink = "This review link has expired; the queue below is current."
+)
+
+// checkDigestConfig reports what the digest lacks in cfg to be sent.
+func checkDigestConfig(cfg Config) error {
+	switch {
+	case cfg.SMTPAddr == "" || cfg.SMTPFrom == "":
+		return errors.New("LEADERBOARD_SMTP_ADDR and LEADERBOARD_SMTP_FROM are required")
+	case cfg.AdminToken == "":
+		return errors.New("LEADERBOARD_ADMIN_TOKEN is required for the review links")
+	case cfg.PublicURL == "":
+		return errors.New("LEADERBOARD_PUBLIC_URL is required for absolute links")
+	case cfg.DigestSchedule != "hourly" && cfg.DigestSchedule != "daily":
+		return fmt.Errorf("LEADERBOARD_DIGEST_SCHEDULE must be hourly or daily, not %q", cfg.DigestSchedule)
+	}
+	if _, err := mail.ParseAddress(cfg.SMTPFrom); err != nil { return fmt.Errorf("LEADERBOARD_SMTP_FROM: %w", err) }
+	for _, to := range cfg.DigestTo {
+		if _, err := mail.ParseAddress(to); err != nil { return fmt.Errorf("LEADERBOARD_DIGEST_TO: %w", err) }
+	}
+	return nil
+}
+
+// digestPeriod is the period a digest sent at t belongs to.
+func digestPeriod(schedule string, t time.Time) time.Time {
+	if schedule == "hourly" { return t.UTC().Truncate(time.Hour) }
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// sendModerationDigest emails the review queue unless it is empty or this period's digest was
+// sent. Replicas claim the period with ON CONFLICT DO NOTHING, so only one of them sends it;
+// a failed send gives the period back for the next run.
+func (s *Server) sendModerationDigest(ctx context.Context) error {
+	var pending int
+	if err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM profiles WHERE status = 'held'`).Scan(&pending); err != nil { return err }
+	if pending == 0 { return nil }
+	period := digestPeriod(s.cfg.DigestSchedule, time.Now())
+	res, err := s.db.ExecContext(ctx, `INSERT INTO moderation_digests (period, profiles) VALUES ($1, $2) ON CONFLICT (period) DO NOTHING`, period, pending)
+	if err != nil { return err }
+	if n, err := res.RowsAffected(); err != nil || n == 0 { return err }
+
+	err = s.mailModerationDigest(ctx, pending)
+	if err != nil {
+		if _, derr := s.db.ExecContext(context.WithoutCancel(ctx), `DELETE FROM moderation_digests WHERE period = $1`, period); derr != nil {
+			s.log.Error("moderation digest: releasing the period failed", "period", period, "err", derr)
+		}
+		return err
+	}
+	s.log.Info("moderation digest sent", "period", period, "pending", pending, "recipients", len(s.cfg.DigestTo))
+	return nil
+}
+
+func (s *Server) mailModerationDigest(ctx context.Context, pending int) error {
+	held, err := s.loadProfiles(ctx, profileFilter{Status: statusHeld, Newest: true, Limit: digestMaxProfiles})
+	if err != nil { return err }
+	v := s.digestView(held, pending, time.Now().Add(digestLinkTTL))
+	var body bytes.Buffer
+	if err := s.tmpl.ExecuteTemplate(&body, "moderation_digest.gohtml", v); err != nil { return err }
+	subject := fmt.Sprintf("%s: %s waiting for review", s.site().Title, plural(pending, "exhibit"))
+	msg := composeMail(s.cfg.SMTPFrom, s.cfg.DigestTo, subject, body.Bytes(), time.Now())
+	return s.sendMail(ctx, s.cfg.DigestTo, msg)
+}
+
+// digestView lists held with absolute photo and review URLs valid until exp.
+func (s *Server) digestView(held []Profile, pending int, exp time.Time) views.ModerationDigestView {
+	base := strings.TrimRight(s.cfg.PublicURL, "/")
+	v := views.ModerationDigestView{Pending: pending, More: max(pending-len(held), 0), QueueURL: base + "/admin/moderation"}
+	for _, p := range held {
+		photo := unsignedPhotoURL(p.ID)
+		if s.cfg.PhotoSigningKey != "" { photo = s.embedPhotoURL(p.ID, exp) }
+		v.Profiles = append(v.Profiles, views.DigestProfile{Profile: profileView(p), PhotoURL: base + photo,
+			ApproveURL: base + "/admin/moderation/review?" + url.Values{"t": {s.reviewToken(p.ID, reviewApprove, exp)}}.Encode(),
+			RejectURL:  base + "/admin/moderation/review?" + url.Values{"t": {s.reviewToken(p.ID, reviewReject, exp)}}.Encode(),
+		})
+	}
+	return v
+}
+
+// reviewToken encodes "<profile>.<action>.<exp>.<sig>"; every part is URL-safe.
+func (s *Server) reviewToken(profileID, action string, exp time.Time) string {
+	payload := strings.Join([]string{profileID, action, strconv.FormatInt(exp.Unix(), 10)}, ".")
+	return payload + "." + s.reviewSig(payload)
+}
+
+// parseReviewToken verifies a token made by reviewToken and returns its profile and action.
+func (s *Server) parseReviewToken(token string) (profileID, action string, err error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || s.cfg.AdminToken == "" { return "", "", ErrReviewLinkInvalid }
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.reviewSig(payload))) { return "", "", ErrReviewLinkInvalid }
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 || (parts[1] != reviewApprove && parts[1] != reviewReject) { return "", "", ErrReviewLinkInvalid }
+	exp, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil { return "", "", ErrReviewLinkInvalid }
+	if time.Now().After(time.Unix(exp, 0)) { return "", "", ErrReviewLinkExpired }
+	return parts[0], parts[1], nil
+}
+
+// reviewSig signs with the admin token, so rotating it revokes every link sent.
+func (s *Server) reviewSig(payload string) string {
+	m := hmac.New(sha256.New, []byte(s.cfg.AdminToken))
+	m.Write([]byte("moderation-review\x00"))
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil)[:16])
+}
+
+// handleAdminModerationReview acts on a digest link: GET /admin/moderation/review?t=<token>
+// approves or discards its profile, then shows the moderation page with the outcome.
+func (s *Server) handleAdminModerationReview(w http.ResponseWriter, r *http.Request) {
+	id, action, err := s.parseReviewToken(r.URL.Query().Get("t"))
+	var notice string
+	if err == nil {
+		if action == reviewApprove {
+			err, notice = s.setProfileStatus(r.Context(), id, statusActive), "Profile approved."
+		} else {
+			err, notice = s.discardHeldProfile(r.Context(), id), "Profile discarded."
+		}
+		actor, _ := s.adminActor(r)
+		if err == nil { s.log.Info("moderation", "op", action, "id", id, "by", actor, "via", "digest") }
+	}
+	s.writeModerationPage(w, r, err, notice, views.ModerationRule{})
+}
+
+// composeMail formats an HTML email, quoted-printable so long lines survive any relay.
+func composeMail(from string, to []string, subject string, html []byte, date time.Time) []byte {
+	var b bytes.Buffer
+	for _, h := range [][2]string{
+		{"From", from},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/html; charset=utf-8"},
+		{"Content-Transfer-Encoding", "quoted-printable"},
+	} {
+		fmt.Fprintf(&b, "%s: %s\r\n", h[0], h[1])
+	}
+	b.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	qp.Write(html)
+	qp.Close()
+	return b.Bytes()
+}
+
+// sendMail delivers msg through LEADERBOARD_SMTP_ADDR, upgrading to TLS when the server
+// offers STARTTLS and authenticating when a username is set.
+func (s *Server) sendMail(ctx context.Context, to []string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	host, _, err := net.SplitHostPort(s.cfg.SMTPAddr)
+	if err != nil { return err }
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.cfg.SMTPAddr)
+	if err != nil { return err }
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil { return err }
+	}
+	if s.cfg.SMTPUsername != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.SMTPUsername, s.cfg.SMTPPassword, host)); err != nil { return err }
+	}
+	from, _ := mail.ParseAddress(s.cfg.SMTPFrom)
+	if err := c.Mail(from.Address); err != nil { return err }
+	for _, rcpt := range to {
+		a, _ := mail.ParseAddress(rcpt)
+		if err := c.Rcpt(a.Address); err != nil { return err }
+	}
+	w, err := c.Data()
+	if err != nil { return err }
+	if _, err := w.Write(msg); err != nil { return err }
+	if err := w.Close(); err != nil { return err }
+	return c.Quit()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"mime/quotedprintable"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReviewToken(t *testing.T) {
+	s := &Server{cfg: Config{AdminToken: "admin"}}
+	exp := time.Now().Add(time.Hour)
+	token := s.reviewToken("p1", reviewApprove, exp)
+	if id, action, err := s.parseReviewToken(token); err != nil || id != "p1" || action != reviewApprove {
+		t.Fatalf("parseReviewToken = %q, %q, %v", id, action, err)
+	}
+	for _, tok := range []string{
+		strings.Replace(token, "p1", "p2", 1),
+		strings.Replace(token, reviewApprove, reviewReject, 1),
+		s.reviewToken("p1", "retire", exp),
+		token[:len(token)-1],
+		"",
+	} {
+		if _, _, err := s.parseReviewToken(tok); !errors.Is(err, ErrReviewLinkInvalid) { t.Errorf("parseReviewToken(%q) = %v, want invalid", tok, err) }
+	}
+	if _, _, err := s.parseReviewToken(s.reviewToken("p1", reviewReject, time.Now().Add(-time.Second))); !errors.Is(err, ErrReviewLinkExpired) {
+		t.Errorf("expired token: %v", err)
+	}
+	rotated := &Server{cfg: Config{AdminToken: "new"}}
+	if _, _, err := rotated.parseReviewToken(token); !errors.Is(err, ErrReviewLinkInvalid) { t.Errorf("token after admin token rotation: %v", err) }
+}
+
+func TestCheckDigestConfig(t *testing.T) {
+	ok := Config{DigestTo: []string{"ops@example.com", "Mod <mod@example.com>"}, DigestSchedule: "hourly", SMTPAddr: "smtp.example.com:587",
+		SMTPFrom: "Board <board@example.com>", AdminToken: "t", PublicURL: "https://board.example"}
+	if err := checkDigestConfig(ok); err != nil { t.Fatalf("valid config: %v", err) }
+	for name, change := range map[string]func(*Config){
+		"no smtp":       func(c *Config) { c.SMTPAddr = "" },
+		"no admin":      func(c *Config) { c.AdminToken = "" },
+		"no public url": func(c *Config) { c.PublicURL = "" },
+		"weekly":        func(c *Config) { c.DigestSchedule = "weekly" },
+		"bad recipient": func(c *Config) { c.DigestTo = []string{"not an address"} },
+	} {
+		c := ok
+		change(&c)
+		if err := checkDigestConfig(c); err == nil { t.Errorf("%s: accepted", name) }
+	}
+	at := time.Date(2026, 10, 16, 14, 35, 0, 0, time.UTC)
+	if p := digestPeriod("hourly", at); !p.Equal(time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC)) { t.Errorf("hourly period = %v", p) }
+	if p := digestPeriod("daily", at); !p.Equal(time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)) { t.Errorf("daily period = %v", p) }
+}
+
+func TestComposeMail(t *testing.T) {
+	body := "<p>" + strings.Repeat("Ünïcode ", 20) + "</p>"
+	msg := composeMail("Board <board@example.com>", []string{"a@example.com", "b@example.com"}, "Bestfriends: 3 exhibits waiting — review",
+		[]byte(body), time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))
+	head, rest, ok := strings.Cut(string(msg), "\r\n\r\n")
+	if !ok { t.Fatalf("no header/body separator:\n%s", msg) }
+	for _, want := range []string{"To: a@example.com, b@example.com", "Subject: =?utf-8?q?", "Content-Transfer-Encoding: quoted-printable",
+		"Date: Fri, 16 Oct 2026 09:00:00 +0000"} {
+		if !strings.Contains(head, want) { t.Errorf("headers lack %q:\n%s", want, head) }
+	}
+	for _, line := range strings.Split(rest, "\r\n") {
+		if len(line) > 76 { t.Errorf("body line of %d bytes", len(line)) }
+	}
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(rest)))
+	if err != nil || string(decoded) != body { t.Errorf("decoded body = %q, %v", decoded, err) }
+}
+
+// TestSendMail talks to a minimal SMTP server that offers neither STARTTLS nor AUTH.
+func TestSendMail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	defer ln.Close()
+	got := make(chan []string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil { return }
+		defer c.Close()
+		tp := textproto.NewConn(c)
+		var log []string
+		tp.PrintfLine("220 test")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil { break }
+			log = append(log, line)
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO":
+				tp.PrintfLine("250 test")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, _ := tp.ReadDotLines()
+				log = append(log, data...)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				got <- log
+				return
+			default:
+				tp.PrintfLine("250 ok")
+			}
+		}
+		got <- log
+	}()
+	s := &Server{log: slog.New(slog.NewTextHandler(io.Discard, nil)), cfg: Config{SMTPAddr: ln.Addr().String(), SMTPFrom: "Board <board@example.com>"}}
+	msg := composeMail(s.cfg.SMTPFrom, []string{"Mod <mod@example.com>"}, "Digest", []byte("<p>hi</p>"), time.Now())
+	if err := s.sendMail(context.Background(), []string{"Mod <mod@example.com>"}, msg); err != nil { t.Fatal(err) }
+	session := strings.Join(<-got, "\n")
+	for _, want := range []string{"MAIL FROM:<board@example.com>", "RCPT TO:<mod@example.com>", "Subject: Digest", "<p>hi</p>"} {
+		if !strings.Contains(session, want) { t.Errorf("session lacks %q:\n%s", want, session) }
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// The name_uniqueness setting decides whether a new profile may share its name with one in
+// the same city, both compared normalized: case and extra spaces don't count, and cities
+// are the normalized ones (see locations.go). allow takes duplicates as before; warn stops
+// the submission with the matching profiles until it is sent again with name_ok; enforce
+// refuses it. Profiles submitted under enforce are marked name_unique, which the
+// profiles_name_city_key index (migrations/032) keeps unique even when two submissions race.
+const (
+	nameAllow   = "allow"
+	nameWarn    = "warn"
+	nameEnforce = "enforce"
+)
+
+// nameUniqueIndex is the unique index behind the enforce policy.
+const nameUniqueIndex = "profiles_name_city_key"
+
+// nameKey is the SQL normalization of a name, the expression nameUniqueIndex is built on.
+func nameKey(expr string) string { return `lower(regexp_replace(btrim(` + expr + `), '\s+', ' ', 'g'))` }
+
+// duplicateLimit caps the matches a duplicate error lists.
+const duplicateLimit = 5
+
+// DuplicateProfile is an existing public profile with a submission's name and city.
+type DuplicateProfile struct {
+	ID       string `json:"id"`
+	FullName string `json:"full_name"`
+	Country  string `json:"country"`
+	City     string `json:"city"`
+	URL      string `json:"url"`
+}
+
+// ErrorDuplicateName is a submission whose name is taken in its city. Existing lists the
+// public matches to point the submitter at (held ones count but aren't shown); Enforced is
+// set when resubmitting with name_ok doesn't help.
+type ErrorDuplicateName struct {
+	Existing []DuplicateProfile
+	Enforced bool
+}
+
+func (e ErrorDuplicateName) Error() string {
+	if e.Enforced { return "an exhibit with this name already exists in this city" }
+	return "an exhibit with this name already exists in this city; resubmit with name_ok=1 to add another"
+}
+func (ErrorDuplicateName) DuplicateName() {}
+
+// checkDuplicateName applies the name_uniqueness policy to a submission, nameOK being the
+// submitter's confirmation under warn. It returns whether the profile is to be marked
+// name_unique.
+func (s *Server) checkDuplicateName(ctx context.Context, name, country, city string, nameOK bool) (bool, error) {
+	policy := s.settings.GetString(settingNameUniqueness)
+	if policy == nameAllow || policy == nameWarn && nameOK { return false, nil }
+	found, existing, err := s.duplicateNames(ctx, name, country, city)
+	if err != nil || !found { return policy == nameEnforce, err }
+	return false, ErrorDuplicateName{Existing: existing, Enforced: policy == nameEnforce}
+}
+
+// duplicateNames reports whether any profile but a discarded one has name in city, and
+// lists the public ones.
+func (s *Server) duplicateNames(ctx context.Context, name, country, city string) (bool, []DuplicateProfile, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id::string, p.full_name, p.location_country, p.location_city, p.status
+		FROM profiles p
+		JOIN cities ci ON ci.id = p.city_id
+		JOIN countries co ON co.id = ci.country_id
+		WHERE co.name_key = lower($2) AND ci.name_key = lower($3) AND `+nameKey("p.full_name")+` = `+nameKey("$1")+`
+		ORDER BY p.status = 'active' DESC, p.votes_count DESC
+		LIMIT $4
+	`, name, country, city, duplicateLimit)
+	if err != nil { return false, nil, err }
+	defer rows.Close()
+	found := false
+	var out []DuplicateProfile
+	for rows.Next() {
+		var d DuplicateProfile
+		var status string
+		if err := rows.Scan(&d.ID, &d.FullName, &d.Country, &d.City, &status); err != nil { return false, nil, err }
+		found = true
+		if status == statusHeld { continue }
+		d.URL = "/profiles/" + d.ID
+		out = append(out, d)
+	}
+	return found, out, rows.Err()
+}
+
+// isNameConflict reports whether err is a write refused by nameUniqueIndex.
+func isNameConflict(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && (pqErr.Constraint == nameUniqueIndex || strings.Contains(pqErr.Message, nameUniqueIndex))
+}
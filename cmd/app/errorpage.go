@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+)
+
+// Template errors are rare but, once a page has started going out, leave visitors with half
+// a page and a 200. Whole-page renders are buffered (renderStatus) so a failure can still
+// answer a proper 500; the streamed home page can only end with a notice. Both show the
+// request id, which the logs carry too, so a report can be matched to the error.
+
+const requestIDHeader = "X-Request-Id"
+
+// maxRenderBytes caps a buffered render; a template that runs away (a loop over far more
+// data than expected) fails instead of growing the buffer without bound.
+const maxRenderBytes = 8 << 20
+
+var errRenderTooLarge = errors.New("render exceeds maxRenderBytes")
+
+type ctxKeyRequestID struct{}
+
+// requestIDMiddleware gives every request an id, in the X-Request-Id response header and
+// the request context. Behind a trusted proxy a well-formed incoming id is kept, so proxy
+// and app logs line up.
+func (s *Server) requestIDMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !s.cfg.TrustProxy || !validRequestID(id) { id = newRequestID() }
+		w.Header().Set(requestIDHeader, id)
+		next(w, r.WithContext(context.WithValue(r.Context(), ctxKeyRequestID{}, id)))
+	}
+}
+
+// validRequestID accepts up to 64 letters, digits, '-', '_' and '.', enough for the usual
+// proxy formats and nothing that could break a log line or the error page.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 { return false }
+	for _, c := range id {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.'
+		if !ok { return false }
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestID is the id requestIDMiddleware gave r, or "" outside it (tests, jobs).
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(ctxKeyRequestID{}).(string)
+	return id
+}
+
+// cappedWriter fails writes that would take w past n bytes.
+type cappedWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	if len(p) > c.n { return 0, errRenderTooLarge }
+	c.n -= len(p)
+	return c.w.Write(p)
+}
+
+// errorPage is the 500 page. It is plain HTML rather than a template so it still renders
+// when the templates are what failed; %s is the escaped request id.
+const errorPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Something went wrong</title>
+<style>
+:root{--paper:#FAFAF7; --ink:#2B2B2B; --line:#E6E2D9; --gold:#C8A96A; --plaque:#F5F2EB}
+body{font-family:Inter,system-ui,-apple-system,Segoe UI,Roboto; color:var(--ink); background:var(--paper); max-width:720px; margin:0 auto; padding:24px}
+h1{font-family:'Playfair Display',Georgia,serif; font-weight:600}
+.notice{background:var(--plaque); border:1px solid var(--gold); border-radius:6px; padding:10px 12px; margin-top:12px}
+.small{color:#6B6A66; font-size:12px}
+</style>
+</head>
+<body>
+  <h1>Something went wrong</h1>
+  <div class="notice">This page failed to load. Please try again in a moment.</div>
+  <p class="small">If it keeps happening, mention reference <code>%s</code> when you report it.</p>
+  <p><a href="/">Back to the leaderboard</a></p>
+</body>
+</html>
+`
+
+// writeErrorPage answers 500 with errorPage for the request w belongs to.
+func writeErrorPage(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, errorPage, html.EscapeString(h.Get(requestIDHeader)))
+}
+
+// writeStreamError ends a streamed page whose render failed partway; the status is already
+// out, so the notice is all the visitor gets.
+func writeStreamError(w http.ResponseWriter) {
+	fmt.Fprintf(w, `<div class="notice" role="alert">Part of this page failed to load. Reference: <code>%s</code></div>`,
+		html.EscapeString(w.Header().Get(requestIDHeader)))
+}
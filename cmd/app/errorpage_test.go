@@ -0,0 +1,59 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderStatusTemplateError(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(`{{define "bad"}}<p>half{{.Missing}}</p>{{end}}`))
+	s := &Server{tmpl: tmpl, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	h := s.requestIDMiddleware(func(w http.ResponseWriter, r *http.Request) { s.render(w, "bad", struct{}{}) })
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/", nil))
+	id := rec.Header().Get(requestIDHeader)
+	if rec.Code != http.StatusInternalServerError || id == "" {
+		t.Fatalf("status %d, request id %q", rec.Code, id)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "half") || !strings.Contains(body, id) {
+		t.Errorf("body has partial output or lacks the request id:\n%s", body)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	for _, tc := range []struct {
+		trust bool
+		in    string
+		keep  bool
+	}{
+		{true, "abc-123_x.y", true},
+		{false, "abc-123", false},
+		{true, "", false},
+		{true, "<script>", false},
+		{true, strings.Repeat("a", 65), false},
+	} {
+		s := &Server{cfg: Config{TrustProxy: tc.trust}}
+		var got string
+		h := s.requestIDMiddleware(func(w http.ResponseWriter, r *http.Request) { got = requestID(r) })
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(requestIDHeader, tc.in)
+		rec := httptest.NewRecorder()
+		h(rec, r)
+		if got == "" || got != rec.Header().Get(requestIDHeader) || (got == tc.in) != tc.keep {
+			t.Errorf("trust=%t in=%q: got %q", tc.trust, tc.in, got)
+		}
+	}
+}
+
+func TestCappedWriter(t *testing.T) {
+	var b strings.Builder
+	c := &cappedWriter{&b, 5}
+	if _, err := io.WriteString(c, "abc"); err != nil { t.Fatal(err) }
+	if _, err := io.WriteString(c, "def"); err != errRenderTooLarge { t.Errorf("err = %v, want errRenderTooLarge", err) }
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Fragments render parts of the home page on their own, for htmx (or any client) to swap
+// in place. They share the home page templates, so a fragment always matches a full render.
+
+// fragmentMaxAge lets browsers and proxies reuse a fragment briefly; listings change with
+// every vote, so this only absorbs bursts such as search-as-you-type.
+const fragmentMaxAge = "max-age=5"
+
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+func (s *Server) fragmentHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Signed photo URLs are per-window and must not be shared across visitors.
+	scope := "public, "
+	if s.cfg.PhotoSigningKey != "" { scope = "private, " }
+	w.Header().Set("Cache-Control", scope+fragmentMaxAge)
+	w.Header().Add("Vary", "HX-Request")
+	if s.translator != nil { w.Header().Add("Vary", "Accept-Language") }
+}
+
+// handleLeaderboardFragment renders the cards of the home listing: GET /fragments/leaderboard?q=&country=&alumni=1&after=
+// The response replaces the contents of #cloud; with after= it is the next page, which
+// replaces the "Load more" link and keeps the vote range of the first.
+func (s *Server) handleLeaderboardFragment(w http.ResponseWriter, r *http.Request) {
+	after, err := parseAfter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := profileFilter{
+		Query:   strings.TrimSpace(r.URL.Query().Get("q")),
+		Country: strings.TrimSpace(r.URL.Query().Get("country")),
+		Limit:   s.settings.GetInt(settingPageSize),
+		After:   after,
+	}
+	if r.URL.Query().Get("alumni") == "1" { f.Status = statusRetired }
+	f.PinsFirst = f.Query == "" && f.Country == "" && f.Status == ""
+	list, more, err := s.loadPage(r.Context(), f)
+	if isQueryTimeout(err) {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "search took too long; try again", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	s.fragmentHeaders(w)
+	fw := newFlushWriter(w)
+	defer fw.Flush()
+	next := func(p *Profile) (bool, error) {
+		if len(list) == 0 { return false, nil }
+		*p, list = list[0], list[1:]
+		return true, nil
+	}
+	tail, err := s.writeCards(fw, cardOptions{translateTo: s.translateTarget(r), highlight: f.Query}, next)
+	tail.Alumni, tail.More = f.Status == statusRetired, nextPage(f, more)
+	name := "leaderboard_tail"
+	if f.After != nil { name = "load_more" }
+	if err == nil { err = s.tmpl.ExecuteTemplate(fw, name, tail) }
+	if err != nil {
+		s.log.Error("render leaderboard fragment", "request_id", requestID(r), "err", err)
+		fw.Flush()
+		writeStreamError(w)
+	}
+}
+
+// handleCardFragment renders one card: GET /fragments/profile-card/{id}
+func (s *Server) handleCardFragment(w http.ResponseWriter, r *http.Request) {
+	s.writeCardFragment(w, r, pathID(r), true)
+}
+
+// writeCardFragment renders the current card of profile id. After a vote the card must be
+// fresh, so cacheable is false there.
+func (s *Server) writeCardFragment(w http.ResponseWriter, r *http.Request, id string, cacheable bool) {
+	list, err := s.loadProfiles(r.Context(), profileFilter{ID: id, Limit: 1})
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	if len(list) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if cacheable {
+		s.fragmentHeaders(w)
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	pv := cardView(list[0], s.translateTarget(r))
+	if !cacheable && !pv.Retired {
+		pv.VoteToken = newVoteToken()
+		voted, err := s.votedRecently(r.Context(), s.voterOf(r))
+		if err != nil {
+			http.Error(w, "query error", http.StatusInternalServerError)
+			return
+		}
+		pv.Voted = voted[id]
+	}
+	s.render(w, "home_card", &pv)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// parseTemplates parses the embedded templates with the helper funcs registered.
+// Server-dependent funcs (photoURL, photoSizeURL, site) get their real implementation in run via Funcs.
+func parseTemplates() (*template.Template, error) {
+	return template.New("").Funcs(templateFuncs).ParseFS(templatesFS, "templates/*.gohtml")
+}
+
+var templateFuncs = template.FuncMap{
+	"timeAgo":      timeAgo,
+	"fullTime":     fullTime,
+	"isoTime":      isoTime,
+	"photoURL":     unsignedPhotoURL,
+	"photoSizeURL": unsignedPhotoSizeURL,
+	"sparkline":    sparkline,
+	"highlight":    highlight,
+	"snippet":      snippet,
+	"site":         func() views.SiteCopy { return defaultSiteCopy },
+	"cooldown":     func() string { return cooldownText(time.Hour) },
+	"byteSize":     byteSize,
+	"count":        func(n int) template.HTML { return countHTML(n, numberFormats["en"]) },
+	"placeholder":  photoPlaceholder,
+	"abs":          func(n int) int { return max(n, -n) },
+	"plural":       plural,
+}
+
+// photoPlaceholder is the style that shows a photo's average colour and BlurHash preview
+// behind it until it loads; empty when neither is known. The preview is a few pixels wide
+// and left to the browser to smooth when scaling it to the frame.
+func photoPlaceholder(color, hash string) template.CSS {
+	if !validColor(color) { color = "" }
+	bg := color
+	if hash != "" {
+		if url, err := imaging.PlaceholderDataURL(hash); err == nil { bg = strings.TrimSpace(bg + " url(" + url + ") center/cover no-repeat") }
+	}
+	if bg == "" { return "" }
+	return template.CSS("background: " + bg)
+}
+
+// validColor reports whether c is a "#rrggbb" colour, the only form stored placeholders use.
+func validColor(c string) bool {
+	if len(c) != 7 || c[0] != '#' { return false }
+	for _, r := range c[1:] {
+		if !strings.ContainsRune("0123456789abcdef", r) { return false }
+	}
+	return true
+}
+
+// numberFormat is how a locale writes counts: its decimal and grouping separators and the
+// short suffixes for thousands, millions and billions.
+type numberFormat struct {
+	decimal, group string
+	units          [3]string
+}
+
+// numberFormats are the locales LEADERBOARD_LOCALE may name; others fall back to en.
+var numberFormats = map[string]numberFormat{
+	"en": {".", ",", [3]string{"k", "M", "B"}},
+	"de": {",", ".", [3]string{"\u00a0Tsd.", "\u00a0Mio.", "\u00a0Mrd."}},
+	"es": {",", ".", [3]string{"\u00a0mil", "\u00a0M", "\u00a0mil\u00a0M"}},
+	"fr": {",", "\u202f", [3]string{"\u00a0k", "\u00a0M", "\u00a0Md"}},
+	"it": {",", ".", [3]string{"k", "\u00a0Mln", "\u00a0Mrd"}},
+	"nl": {",", ".", [3]string{"K", "\u00a0mln.", "\u00a0mld."}},
+	"pt": {",", ".", [3]string{"\u00a0mil", "\u00a0mi", "\u00a0bi"}},
+}
+
+// localeNumberFormat picks the format for a locale such as "de" or "pt-BR".
+func localeNumberFormat(locale string) numberFormat {
+	lang, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	if f, ok := numberFormats[lang]; ok { return f }
+	return numberFormats["en"]
+}
+
+// groupNumber writes n in full with the locale's grouping separator, e.g. "1,234,567".
+func groupNumber(n int, f numberFormat) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 { sign, digits = "-", digits[1:] }
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 { b.WriteString(f.group) }
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
+
+// compactNumber shortens n to at most three significant digits and a suffix: 1.2k, 34.5k,
+// 678k, 3.4M. It truncates rather than rounds, so a count never reads higher than it is.
+// Below 1000 it is n itself.
+func compactNumber(n int, f numberFormat) string {
+	sign, v := "", int64(n)
+	if v < 0 { sign, v = "-", -v }
+	if v < 1000 { return sign + strconv.FormatInt(v, 10) }
+	unit, scale := 0, int64(1000)
+	for unit < len(f.units)-1 && v >= scale*1000 { unit, scale = unit+1, scale*1000 }
+	whole := v / scale
+	if whole >= 100 || unit == len(f.units)-1 && whole >= 1000 { return sign + strconv.FormatInt(whole, 10) + f.units[unit] }
+	tenth := v % scale * 10 / scale
+	if tenth == 0 { return sign + strconv.FormatInt(whole, 10) + f.units[unit] }
+	return sign + strconv.FormatInt(whole, 10) + f.decimal + strconv.FormatInt(tenth, 10) + f.units[unit]
+}
+
+// countHTML is a count for display. From 1000 up it is compacted inside a <data> element that
+// carries the raw value and shows the full number as its tooltip; below that it is just n.
+func countHTML(n int, f numberFormat) template.HTML {
+	short := compactNumber(n, f)
+	if short == strconv.Itoa(n) { return template.HTML(short) }
+	// Only digits, separators and the fixed suffixes above are interpolated.
+	return template.HTML(fmt.Sprintf(`<data value="%d" title="%s">%s</data>`, n, groupNumber(n, f), short))
+}
+
+// byteSize renders n bytes in binary units with one decimal, e.g. "1.5 MiB".
+func byteSize(n int64) string {
+	if n < 1024 { return fmt.Sprintf("%d B", n) }
+	v, unit := float64(n)/1024, 0
+	for v >= 1024 && unit < 3 { v, unit = v/1024, unit+1 }
+	return fmt.Sprintf("%.1f %s", v, [...]string{"KiB", "MiB", "GiB", "TiB"}[unit])
+}
+
+// timeAgo renders t relative to now, e.g. "3 hours ago"; pair it with fullTime in a title
+// attribute so the exact timestamp stays available.
+func timeAgo(t time.Time) string {
+	return relativeTime(t, time.Now())
+}
+
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	if d < 0 { d = 0 }
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute") + " ago"
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour") + " ago"
+	case d < 48*time.Hour:
+		return "yesterday"
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day") + " ago"
+	case d < 365*24*time.Hour:
+		return plural(int(d/(30*24*time.Hour)), "month") + " ago"
+	default:
+		return plural(int(d/(365*24*time.Hour)), "year") + " ago"
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 { return "1 " + unit }
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// fullTime is the long UTC form used for tooltips.
+func fullTime(t time.Time) string {
+	return t.UTC().Format("Mon, 2 Jan 2006 15:04 MST")
+}
+
+// isoTime is for the datetime attribute of <time> elements.
+func isoTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Sparkline size in CSS pixels; the line keeps 1px clear of the edges for the stroke.
+const (
+	sparkWidth  = 56
+	sparkHeight = 16
+)
+
+// sparkline draws counts as a small inline SVG polyline scaled to the largest value, so
+// cards show momentum without any client-side code. It renders nothing for empty input.
+func sparkline(counts []int) template.HTML {
+	if len(counts) == 0 { return "" }
+	peak := 0
+	total := 0
+	for _, n := range counts {
+		peak = max(peak, n)
+		total += n
+	}
+	var pts strings.Builder
+	for i, n := range counts {
+		x := 1.0
+		if len(counts) > 1 { x += float64(i) * (sparkWidth - 2) / float64(len(counts)-1) }
+		y := float64(sparkHeight - 1)
+		if peak > 0 { y -= float64(n) * (sparkHeight - 2) / float64(peak) }
+		if i > 0 { pts.WriteByte(' ') }
+		pts.WriteString(strconv.FormatFloat(x, 'f', 1, 64) + "," + strconv.FormatFloat(y, 'f', 1, 64))
+	}
+	// Only numbers are interpolated, so the markup is safe to mark as HTML.
+	return template.HTML(fmt.Sprintf(
+		`<svg class="spark" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s in the last %d days">`+
+			`<polyline points="%s" fill="none" stroke="currentColor" stroke-width="1.5" stroke-linejoin="round"/></svg>`,
+		sparkWidth, sparkHeight, sparkWidth, sparkHeight, plural(total, "vote"), len(counts), pts.String()))
+}
+
+// snippetRunes is how much of a description search results show around the first match.
+const snippetRunes = 100
+
+// matchSpans returns the byte ranges of text that match the words of query the way search
+// does (store.ParseSearch): case-insensitive substrings, left to right without overlaps, the
+// longest word where several start at once. Fuzzy matches are not marked, nor the country:
+// and city: filters. Runes are compared lowercased one by one, so the ranges always fall on
+// rune boundaries of text.
+func matchSpans(text, query string) [][2]int {
+	var words [][]rune
+	for _, w := range store.ParseSearch(query).Words { words = append(words, []rune(w)) }
+	if len(words) == 0 { return nil }
+	var spans [][2]int
+	for i := 0; i < len(text); {
+		end := i
+		for _, q := range words {
+			j, k := i, 0
+			for k < len(q) && j < len(text) {
+				r, n := utf8.DecodeRuneInString(text[j:])
+				if unicode.ToLower(r) != q[k] { break }
+				j += n
+				k++
+			}
+			if k == len(q) && j > end { end = j }
+		}
+		if end > i {
+			spans = append(spans, [2]int{i, end})
+			i = end
+			continue
+		}
+		_, n := utf8.DecodeRuneInString(text[i:])
+		i += n
+	}
+	return spans
+}
+
+// highlight escapes text and wraps every match of query in <mark>. An empty query leaves
+// the text as it is.
+func highlight(text, query string) template.HTML {
+	return markSpans(text, 0, len(text), matchSpans(text, query))
+}
+
+// snippet is highlight for longer text: when text has more than snippetRunes runes, it keeps
+// a window of that size centered on the first match (the start without one) and marks the
+// cut ends with an ellipsis. Without a query the text is returned whole.
+func snippet(text, query string) template.HTML {
+	spans := matchSpans(text, query)
+	if query == "" || utf8.RuneCountInString(text) <= snippetRunes { return markSpans(text, 0, len(text), spans) }
+	// Work in runes to pick the window, then map it back to byte offsets.
+	idx := make([]int, 0, len(text)+1) // byte offset of each rune, plus len(text)
+	for i := range text { idx = append(idx, i) }
+	idx = append(idx, len(text))
+	runes := len(idx) - 1
+	start := 0
+	if len(spans) > 0 {
+		first, firstEnd := runeIndex(idx, spans[0][0]), runeIndex(idx, spans[0][1])
+		start = max(0, min(first-(snippetRunes-(firstEnd-first))/2, runes-snippetRunes))
+	}
+	end := min(runes, start+snippetRunes)
+	var b strings.Builder
+	if start > 0 { b.WriteString("…") }
+	b.WriteString(string(markSpans(text, idx[start], idx[end], spans)))
+	if end < runes { b.WriteString("…") }
+	return template.HTML(b.String())
+}
+
+// runeIndex is the rune number of byte offset off, given the byte offsets of every rune.
+func runeIndex(idx []int, off int) int {
+	lo, hi := 0, len(idx)-1
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if idx[mid] < off { lo = mid + 1 } else { hi = mid }
+	}
+	return lo
+}
+
+// markSpans escapes text[from:to] and wraps the parts covered by spans in <mark>; spans
+// reaching outside the window are clipped to it.
+func markSpans(text string, from, to int, spans [][2]int) template.HTML {
+	var b strings.Builder
+	at := from
+	for _, sp := range spans {
+		s, e := max(sp[0], from), min(sp[1], to)
+		if s >= e { continue }
+		b.WriteString(template.HTMLEscapeString(text[at:s]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(text[s:e]) + "</mark>")
+		at = e
+	}
+	b.WriteString(template.HTMLEscapeString(text[at:to]))
+	// Every piece of text went through HTMLEscapeString; only the <mark> tags are markup.
+	return template.HTML(b.String())
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRelativeTime(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ago  time.Duration
+		want string
+	}{
+		{-time.Minute, "just now"},
+		{30 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{59 * time.Minute, "59 minutes ago"},
+		{3 * time.Hour, "3 hours ago"},
+		{30 * time.Hour, "yesterday"},
+		{5 * 24 * time.Hour, "5 days ago"},
+		{65 * 24 * time.Hour, "2 months ago"},
+		{800 * 24 * time.Hour, "2 years ago"},
+	}
+	for _, tt := range tests {
+		if got := relativeTime(now.Add(-tt.ago), now); got != tt.want {
+			t.Errorf("relativeTime(-%v) = %q, want %q", tt.ago, got, tt.want)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline(nil); got != "" {
+		t.Errorf("sparkline(nil) = %q, want empty", got)
+	}
+	got := string(sparkline([]int{0, 2, 1}))
+	if !strings.Contains(got, `points="1.0,15.0 28.0,1.0 55.0,8.0"`) {
+		t.Errorf("unexpected points in %s", got)
+	}
+	if !strings.Contains(got, `aria-label="3 votes in the last 3 days"`) {
+		t.Errorf("unexpected label in %s", got)
+	}
+	if flat := string(sparkline([]int{0, 0})); !strings.Contains(flat, `points="1.0,15.0 55.0,15.0"`) {
+		t.Errorf("all-zero trend should be a flat baseline: %s", flat)
+	}
+}
+
+func TestMatchSpans(t *testing.T) {
+	tests := []struct {
+		text, query string
+		want        [][2]int
+	}{
+		{"Ada Lovelace", "", nil},
+		{"Ada Lovelace", "a", [][2]int{{0, 1}, {2, 3}, {9, 10}}},
+		{"aaaa", "aa", [][2]int{{0, 2}, {2, 4}}},
+		{"Lucía", "CÍA", [][2]int{{2, 6}}}, // í is two bytes
+		{"ÖSTERREICH", "öst", [][2]int{{0, 4}}},
+		{"Lima, Peru", "peru lima", [][2]int{{0, 4}, {6, 10}}},
+		{"Lima", `"lima peru"`, nil},
+		{"Ana Anabel", "ana anabel country:peru", [][2]int{{0, 3}, {4, 10}}},
+	}
+	for _, tt := range tests {
+		got := matchSpans(tt.text, tt.query)
+		if len(got) != len(tt.want) {
+			t.Errorf("matchSpans(%q, %q) = %v, want %v", tt.text, tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("matchSpans(%q, %q) = %v, want %v", tt.text, tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestHighlightEscapes(t *testing.T) {
+	got := string(highlight(`<b>Bo & "bob"</b>`, "b"))
+	want := `&lt;<mark>b</mark>&gt;<mark>B</mark>o &amp; &#34;<mark>b</mark>o<mark>b</mark>&#34;&lt;/<mark>b</mark>&gt;`
+	if got != want {
+		t.Fatalf("highlight = %s\nwant        %s", got, want)
+	}
+	if got := string(highlight("<i>", "")); got != "&lt;i&gt;" {
+		t.Fatalf("highlight without query = %s", got)
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	long := strings.Repeat("x", 150) + "needle" + strings.Repeat("y", 150)
+	got := string(snippet(long, "needle"))
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "<mark>needle</mark>") {
+		t.Fatalf("snippet = %s", got)
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(got, "…"), "…")
+	inner = strings.NewReplacer("<mark>", "", "</mark>", "").Replace(inner)
+	if n := len([]rune(inner)); n != snippetRunes {
+		t.Fatalf("snippet window has %d runes, want %d", n, snippetRunes)
+	}
+	// The match sits in the middle of the window.
+	if before, after := strings.Count(inner, "x"), strings.Count(inner, "y"); before-after > 1 || after-before > 1 {
+		t.Fatalf("snippet not centered: %d before, %d after", before, after)
+	}
+
+	// Near the end the window slides back instead of shrinking; near the start nothing is cut.
+	tail := strings.Repeat("é", 200) + "end"
+	if got := string(snippet(tail, "END")); strings.HasSuffix(got, "…") || !strings.HasSuffix(got, "<mark>end</mark>") ||
+		len([]rune(strings.NewReplacer("<mark>", "", "</mark>", "", "…", "").Replace(got))) != snippetRunes {
+		t.Fatalf("snippet at the end = %s", got)
+	}
+	if got := string(snippet("start"+strings.Repeat("z", 200), "start")); !strings.HasPrefix(got, "<mark>start</mark>") {
+		t.Fatalf("snippet at the start = %s", got)
+	}
+
+	// Short text and no query keep everything; no match shows the beginning.
+	if got := string(snippet("short & sweet", "sweet")); got != "short &amp; <mark>sweet</mark>" {
+		t.Fatalf("short snippet = %s", got)
+	}
+	if got := string(snippet(long, "")); got != long {
+		t.Fatal("snippet without query truncated the text")
+	}
+	if got := string(snippet(long, "absent")); !strings.HasPrefix(got, "xxx") || !strings.HasSuffix(got, "…") {
+		t.Fatalf("snippet without a match = %s", got)
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 20: "5.0 MiB", 3 << 40: "3.0 TiB", 2048 << 40: "2048.0 TiB"} {
+		if got := byteSize(n); got != want { t.Errorf("byteSize(%d) = %q, want %q", n, got, want) }
+	}
+}
+
+func TestCompactNumber(t *testing.T) {
+	en, de := numberFormats["en"], numberFormats["de"]
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1k", 1234: "1.2k", 1299: "1.2k", 34567: "34.5k",
+		678901: "678k", 999999: "999k", 3_456_789: "3.4M", 2_000_000_000: "2B", -1500: "-1.5k"} {
+		if got := compactNumber(n, en); got != want { t.Errorf("compactNumber(%d) = %q, want %q", n, got, want) }
+	}
+	if got := compactNumber(1234, de); got != "1,2 Tsd." { t.Errorf("de compactNumber(1234) = %q", got) }
+	if got := groupNumber(1234567, de); got != "1.234.567" { t.Errorf("de groupNumber = %q", got) }
+	if got := localeNumberFormat("pt-BR"); got != numberFormats["pt"] { t.Errorf("pt-BR = %+v", got) }
+	if got := localeNumberFormat("xx"); got != en { t.Errorf("unknown locale = %+v", got) }
+}
+
+func TestCountHTML(t *testing.T) {
+	if got := countHTML(42, numberFormats["en"]); got != "42" { t.Errorf("countHTML(42) = %s", got) }
+	want := template.HTML(`<data value="1234567" title="1,234,567">1.2M</data>`)
+	if got := countHTML(1234567, numberFormats["en"]); got != want { t.Errorf("countHTML(1234567) = %s", got) }
+}
+
+func TestPhotoPlaceholder(t *testing.T) {
+	const hash = "LEHV6nWB2yk8pyo0adR*.7kCMdnj"
+	got := string(photoPlaceholder("#6d5a4e", hash))
+	if !strings.HasPrefix(got, "background: #6d5a4e url(data:image/bmp;base64,") || !strings.HasSuffix(got, ") center/cover no-repeat") {
+		t.Errorf("placeholder = %s", got)
+	}
+	if got := photoPlaceholder("red;}", "not a hash"); got != "" { t.Errorf("bad colour and hash = %q", got) }
+	if got := photoPlaceholder("#6d5a4e", ""); got != "background: #6d5a4e" { t.Errorf("colour only = %q", got) }
+	if got := photoPlaceholder("", ""); got != "" { t.Errorf("none = %q", got) }
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// Golden rendering tests: every case renders one template with a fixture and compares the
+// normalized output with testdata/golden/<name>.html. After an intended template change,
+// regenerate with `go test ./cmd/app -run Golden -update` and review the diff.
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// goldenNow pins relative times ("3 hours ago") so the output doesn't drift.
+var goldenNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// hostile is text that must come out escaped wherever a template prints user input.
+const hostile = `<script>alert("x")</script> & 'quotes'`
+
+func goldenCases() []struct {
+	name, tmpl string
+	data       any
+} {
+	created := goldenNow.Add(-3 * time.Hour)
+	card := views.ProfileView{
+		ID: "00000000-0000-0000-0000-000000000001", FullName: "Ada " + hostile, Country: "Chile", City: "Valparaíso",
+		Description: "Note " + hostile, Votes: 42, CreatedAt: created, Trend: []int{0, 1, 3, 0, 2, 5, 1},
+		VoteToken: "7c9e6679-7425-40de-944b-e07fc1f90ae7", PhotoAlt: "Ada laughing on a beach " + hostile,
+	}
+	flagged := card
+	flagged.RateLimited, flagged.Champion, flagged.Pinned, flagged.TranslateTo = true, true, true, "de"
+	flagged.PhotoColor, flagged.PhotoBlurHash = "#6d5a4e", "LEHV6nWB2yk8pyo0adR*.7kCMdnj"
+	flagged.RankDelta = 3
+	retired := card
+	retired.Retired, retired.FinalRank, retired.FinalChampion = true, 3, "Chile"
+	linked := card
+	linked.Slug = "script-alert-x-00000000"
+	searched := card
+	searched.Highlight = "SOUP"
+	searched.Description = "A friend since school, " + hostile + ", always there with soup when the flu hits and a bad joke when the rain does."
+	edited := card
+	editedAt := goldenNow.Add(-30 * time.Minute)
+	edited.EditedAt = &editedAt
+	edited.RankDelta = -2
+	edited.Voted = true
+	taken := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	edited.PhotoTaken = &taken
+	voted := card
+	voted.Voted = true
+	bare := views.ProfileView{ID: "00000000-0000-0000-0000-000000000002", FullName: "Bo", Country: "Peru", City: "Lima", CreatedAt: created}
+	more := *nextPage(profileFilter{Query: hostile}, &store.Cursor{Votes: 3, CreatedAt: created, ID: bare.ID})
+	return []struct {
+		name, tmpl string
+		data       any
+	}{
+		{"home_head", "home_head", views.HomeHead{}},
+		{"home_head_filtered", "home_head", views.HomeHead{Query: hostile, Country: "Chile", ReadOnly: true, HTMXURL: "/static/htmx.js"}},
+		{"home_head_alumni", "home_head", views.HomeHead{Country: "Chile", Alumni: true}},
+		{"home_head_single", "home_head", views.HomeHead{Single: true}},
+		{"home_head_paged", "home_head", views.HomeHead{More: &more}},
+		{"home_head_person", "home_head", views.HomeHead{Single: true, Person: func() *views.PersonLD {
+			ld := views.ProfileLD(views.ProfileView{FullName: hostile, Country: "Chile", Description: hostile, Votes: 3}, "https://lb.example/profiles/p1",
+				&views.ProfileImage{URL: "https://lb.example/profiles/p1/photo", ThumbnailURL: "https://lb.example/profiles/p1/photo?size=thumb"})
+			return &ld
+		}()}},
+		{"home_head_spotlight", "home_head", views.HomeHead{Spotlight: &views.Spotlight{Day: goldenNow.Truncate(24 * time.Hour),
+			Profile: views.ProfileView{ID: "p1", FullName: hostile, Country: "Chile", City: "Arica"}}}},
+		{"spotlights", "spotlights.gohtml", views.SpotlightsView{Paged: true, Next: "2026-09-01", Spotlights: []views.Spotlight{
+			{Day: goldenNow.Truncate(24 * time.Hour), Profile: views.ProfileView{ID: "p1", FullName: hostile, Country: "Chile", City: "Arica", Votes: 3}},
+			{Day: goldenNow.Truncate(24*time.Hour).AddDate(0, 0, -1), Profile: views.ProfileView{ID: "p2", FullName: "Rex", Country: "Peru", City: "Lima", Retired: true}}}}},
+		{"spotlights_empty", "spotlights.gohtml", views.SpotlightsView{}},
+		{"vote_receipt", "vote_receipt.gohtml", views.VoteReceiptView{Profile: views.ProfileView{ID: "p1", FullName: hostile, Country: "Chile", City: "Arica", Votes: 42},
+			Rank: 3, Total: 120, ShareURL: "https://board.example/profiles/p1", ShareText: "I voted for " + hostile,
+			Shares: shareLinks("I voted for "+hostile, "https://board.example/profiles/p1")}},
+		{"profile", "profile.gohtml", views.ProfilePageView{Profile: views.ProfileView{ID: "p1", FullName: hostile, Country: "Chile", City: "Arica",
+			Description: hostile, Votes: 42, CreatedAt: created, Champion: true, Slug: "script-alert-x-p1"}, URL: "https://lb.example/p/script-alert-x-p1",
+			ImageURL: "https://lb.example/profiles/p1/photo", History: []int{0, 3, 1, 0, 5}, Person: &views.PersonLD{Context: "https://schema.org", Type: "Person", Name: hostile}}},
+		{"profile_retired", "profile.gohtml", views.ProfilePageView{Profile: views.ProfileView{ID: "p2", FullName: "Rex", Country: "Peru", City: "Lima",
+			Votes: 1, CreatedAt: created, Retired: true, FinalRank: 4}, URL: "https://lb.example/p/rex-p2"}},
+		{"vote_receipt_retired", "vote_receipt.gohtml", views.VoteReceiptView{Profile: views.ProfileView{ID: "p2", FullName: "Rex", Votes: 1, Retired: true}}},
+		{"moderation_digest", "moderation_digest.gohtml", views.ModerationDigestView{Pending: 4, More: 2, QueueURL: "https://board.example/admin/moderation",
+			Profiles: []views.DigestProfile{
+				{Profile: card, PhotoURL: "https://board.example/profiles/p1/photo", ApproveURL: "https://board.example/admin/moderation/review?t=p1.approve.1.sig",
+					RejectURL: "https://board.example/admin/moderation/review?t=p1.reject.1.sig"},
+				{Profile: bare, PhotoURL: "https://board.example/profiles/p2/photo", ApproveURL: "https://board.example/admin/moderation/review?t=p2.approve.1.sig",
+					RejectURL: "https://board.example/admin/moderation/review?t=p2.reject.1.sig"}}}},
+		{"home_card", "home_card", &card},
+		{"home_card_retired", "home_card", &retired},
+		{"home_card_flags", "home_card", &flagged},
+		{"home_card_bare", "home_card", &bare},
+		{"home_card_edited", "home_card", &edited},
+		{"home_card_search", "home_card", &searched},
+		{"home_card_linked", "home_card", &linked},
+		{"home_tail", "home_tail", views.HomeTail{Count: 2, MinVotes: 0, MaxVotes: 42}},
+		{"home_tail_empty", "home_tail", views.HomeTail{}},
+		{"home_tail_alumni_empty", "home_tail", views.HomeTail{Alumni: true}},
+		{"leaderboard_tail", "leaderboard_tail", views.HomeTail{Count: 2, MinVotes: 1, MaxVotes: 2}},
+		{"home_tail_more", "home_tail", views.HomeTail{Count: 2, MinVotes: 3, MaxVotes: 42, More: &more}},
+		{"load_more", "load_more", views.HomeTail{Count: 2, More: &more}},
+		{"kiosk", "kiosk.gohtml", views.KioskView{Label: "Fair " + hostile, Profile: &card, N: 3, Next: "/kiosk?n=4", Advance: 12}},
+		{"kiosk_voted", "kiosk.gohtml", views.KioskView{Profile: &retired, N: 3, Next: "/kiosk?n=4", Advance: 3, Flash: &views.Flash{Message: "Thank you for voting!"}}},
+		{"kiosk_error", "kiosk.gohtml", views.KioskView{Error: "This screen is not a vote kiosk. An admin starts one and opens its link here."}},
+		{"home_cloud", "home_cloud", nil},
+		{"home_foot", "home_foot", nil},
+		{"section_open", "section_open", views.HomeSection{ID: "s-2", Kind: "country", Title: "Top of " + hostile, MinVotes: 3, MaxVotes: 12}},
+		{"section_close", "section_close", nil},
+		{"description_translated", "description", views.DescriptionView{ProfileID: card.ID, Text: "Notiz " + hostile,
+			Original: card.Description, Source: "en", Target: "de", Translated: true}},
+		{"description_error", "description", views.DescriptionView{ProfileID: card.ID, Text: card.Description, Error: "Translation is unavailable right now."}},
+		{"add", "add.gohtml", views.AddView{}},
+		{"add_read_only", "add.gohtml", views.AddView{ReadOnly: true}},
+		{"add_held", "add.gohtml", views.AddView{Held: true}},
+		{"add_photo_warnings", "add.gohtml", views.AddView{
+			Warnings: []views.PhotoWarning{{Code: "small", Message: "The photo is small."}, {Code: "dark", Message: "The photo looks very dark."}},
+			Form: views.AddForm{FullName: "Ada <Lovelace>", Country: "UK", City: "London", Description: "Poet of numbers", PhotoAlt: "Ada at her <desk>",
+				ShowPhotoDate: true}}},
+		{"add_duplicate_warn", "add.gohtml", views.AddView{
+			Duplicate: &views.DuplicateName{Existing: []views.Duplicate{{URL: "/profiles/" + card.ID, FullName: hostile, Country: "UK", City: "London"}}},
+			Form:      views.AddForm{FullName: "Ada Lovelace", Country: "UK", City: "London"}}},
+		{"add_duplicate_enforced", "add.gohtml", views.AddView{Duplicate: &views.DuplicateName{Enforced: true},
+			Form: views.AddForm{FullName: "Ada Lovelace", Country: "UK", City: "London", NameOK: true}}},
+		{"admin_moderation", "admin_moderation.gohtml", views.AdminModerationView{
+			Rules: []views.ModerationRule{{ID: "r1", Kind: "regex", Pattern: `(?i)buy\s+now ` + hostile, Action: "reject", Note: hostile,
+				CreatedAt: created, CreatedBy: "ops"}},
+			Held:    []views.ProfileView{bare},
+			Matches: []views.ModerationMatch{{Pattern: "spam", Action: "hold", Field: "description", Value: hostile, ProfileID: bare.ID, CreatedAt: created},
+				{Pattern: "scam", Action: "reject", Field: "full_name", Value: "scam", CreatedAt: created}},
+			Notice: "Rule added."}},
+		{"admin_moderation_empty", "admin_moderation.gohtml", views.AdminModerationView{Form: views.ModerationRule{Kind: "regex",
+			Pattern: "(", Action: "hold"}, Error: "pattern: missing closing )"}},
+		{"takedown", "takedown.gohtml", views.TakedownView{Form: views.TakedownForm{Profile: card.ID, Reason: "privacy",
+			Details: hostile, Contact: "ada@example.com"}, FullName: card.FullName, Reasons: []string{"copyright", "privacy", "abuse", "other"},
+			CSRF: "csrf-token", Error: "Please give an email address we can reply to."}},
+		{"takedown_filed", "takedown.gohtml", views.TakedownView{Reference: "00000000-0000-0000-0000-0000000000aa",
+			Form: views.TakedownForm{Profile: card.ID, Contact: "ada@example.com"}}},
+		{"admin_takedowns", "admin_takedowns.gohtml", views.AdminTakedownsView{
+			Open: []views.Takedown{{ID: "t1", ProfileID: card.ID, FullName: card.FullName, Reason: "copyright", Details: "Line one\n" + hostile,
+				Contact: "owner@example.com", Status: "open", CreatedAt: created}},
+			Resolved: []views.Takedown{{ID: "t0", ProfileID: bare.ID, FullName: bare.FullName, Reason: "abuse", Status: "upheld",
+				CreatedAt: created, ResolvedAt: created.Add(time.Hour), ResolvedBy: "ops", Note: hostile}},
+			Notice: "Request upheld."}},
+		{"admin_takedowns_empty", "admin_takedowns.gohtml", views.AdminTakedownsView{}},
+		{"quota", "quota.gohtml", views.QuotaView{Limit: 10, ResetsAt: goldenNow.Add(12 * time.Hour)}},
+		{"search_timeout", "search_timeout.gohtml", views.SearchTimeoutView{Query: hostile, Country: "France"}},
+		{"admin_reset_form", "admin_reset.gohtml", views.AdminResetView{Form: views.AdminResetForm{From: goldenNow.AddDate(0, 0, -7), To: goldenNow}}},
+		{"admin_reset_preview", "admin_reset.gohtml", views.AdminResetView{
+			Form:   views.AdminResetForm{From: goldenNow.AddDate(0, 0, -7), To: goldenNow, Reason: hostile},
+			Result: &views.AdminResetResult{From: goldenNow.AddDate(0, 0, -7), To: goldenNow, Votes: 12, Profiles: 3}}},
+		{"admin_reset_applied", "admin_reset.gohtml", views.AdminResetView{Result: &views.AdminResetResult{ID: "r1", Votes: 12, Profiles: 3, Applied: true}}},
+		{"add_closed", "add.gohtml", views.AddView{Closed: true}},
+		{"admin_settings", "admin_settings.gohtml", views.AdminSettingsView{Settings: []views.Setting{
+			{Key: "vote_cooldown", Type: "duration", Value: "30m", Default: "1h", Doc: "How long a profile takes no votes after each vote.",
+				Custom: true, UpdatedAt: created, UpdatedBy: hostile},
+			{Key: "page_size", Type: "int", Value: "500", Default: "500", Doc: "Profiles listed on the home page."},
+			{Key: "sparklines", Type: "bool", Value: "false", Default: "true", Doc: "Sparklines.", Custom: true, UpdatedAt: created},
+			{Key: "name_uniqueness", Type: "choice", Value: "warn", Default: "allow", Choices: []string{"allow", "warn", "enforce"}, Doc: "Duplicate names."}},
+			Notice: "Saved vote_cooldown."}},
+		{"admin_layout", "admin_layout.gohtml", views.AdminLayoutView{
+			Rows: []views.LayoutRow{{Position: 1, Section: views.LayoutSection{Kind: "random"}},
+				{Position: 2, Section: views.LayoutSection{Kind: "country", Title: hostile, Size: 5, Country: "Chile"}},
+				{Position: 3, Section: views.LayoutSection{Kind: "leaderboard"}}, {Position: 4}},
+			Kinds: []views.LayoutKind{{Name: "leaderboard", Description: "The leaderboard."}, {Name: "random", Description: "Random."},
+				{Name: "country", Description: "One country."}},
+			Notice: "Saved."}},
+		{"admin_site", "admin_site.gohtml", views.AdminSiteView{Copy: views.SiteCopy{Title: "Best Friends", Tagline: hostile,
+			Welcome: "Line one\nLine two", Footer: "Footer"}, Saved: true}},
+		{"vote_link_confirm", "vote_link.gohtml", views.VoteLinkView{Token: "tok.en", FullName: "Ada " + hostile, Country: "Chile",
+			City: "Valparaíso", Expires: goldenNow.Add(48 * time.Hour), State: "confirm"}},
+		{"vote_link_done", "vote_link.gohtml", views.VoteLinkView{FullName: "Ada", Country: "Chile", City: "Valparaíso", State: "done"}},
+		{"vote_link_error", "vote_link.gohtml", views.VoteLinkView{State: "error", Message: "this vote link has expired"}},
+		{"vote_confirm", "vote_confirm.gohtml", views.VoteConfirmView{Profile: card, CSRF: "csrf-token"}},
+		{"vote_confirm_voted", "vote_confirm.gohtml", views.VoteConfirmView{Profile: voted, CSRF: "csrf-token",
+			Flash: &views.Flash{Message: "Thanks, your vote was counted."}}},
+		{"vote_confirm_capped", "vote_confirm.gohtml", views.VoteConfirmView{Profile: flagged, CSRF: "csrf-token"}},
+		{"vote_confirm_error", "vote_confirm.gohtml", views.VoteConfirmView{Profile: bare, CSRF: "csrf-token", ReadOnly: true,
+			Flash: &views.Flash{Message: "This form expired. Please confirm your vote again.", Error: true}}},
+	}
+}
+
+func TestGoldenTemplates(t *testing.T) {
+	tmpl, err := parseTemplates()
+	if err != nil { t.Fatal(err) }
+	tmpl.Funcs(template.FuncMap{"timeAgo": func(ts time.Time) string { return relativeTime(ts, goldenNow) }})
+	for _, tc := range goldenCases() {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tmpl.ExecuteTemplate(&buf, tc.tmpl, tc.data); err != nil { t.Fatal(err) }
+			got := normalizeHTML(buf.String())
+			if strings.Contains(got, "<script>alert") { t.Errorf("unescaped user input in output") }
+			path := filepath.Join("testdata", "golden", tc.name+".html")
+			if *update {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { t.Fatal(err) }
+				if err := os.WriteFile(path, []byte(got), 0o644); err != nil { t.Fatal(err) }
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil { t.Fatalf("%v (run with -update to create it)", err) }
+			if got != string(want) {
+				t.Errorf("%s differs from golden file; rerun with -update if intended\n%s", tc.name, firstDiff(string(want), got))
+			}
+		})
+	}
+}
+
+var styleBlock = regexp.MustCompile(`(?s)<style>.*?</style>`)
+
+// normalizeHTML drops what golden files shouldn't pin: stylesheet contents (the inline
+// <style> blocks carrying per-render values are kept), indentation and blank lines.
+func normalizeHTML(s string) string {
+	s = styleBlock.ReplaceAllStringFunc(s, func(b string) string {
+		if strings.Contains(b, "--min-votes:") && len(b) < 200 { return b }
+		return "<style>…</style>"
+	})
+	var out strings.Builder
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+	return out.String()
+}
+
+// firstDiff shows the first differing line of two normalized documents.
+func firstDiff(want, got string) string {
+	w, g := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < max(len(w), len(g)); i++ {
+		var wl, gl string
+		if i < len(w) { wl = w[i] }
+		if i < len(g) { gl = g[i] }
+		if wl != gl { return "line " + strconv.Itoa(i+1) + ":\n  want: " + wl + "\n  got:  " + gl }
+	}
+	return ""
+}
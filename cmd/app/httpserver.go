@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Slow-client protection. Every phase of a connection has a deadline: headers
+// (ReadHeaderTimeout), the whole request body (ReadTimeout), the response (WriteTimeout) and
+// the wait for the next request on a kept-alive connection (IdleTimeout). Photos stream in
+// chunks with a fresh write deadline per chunk instead, so a slow but steady client gets its
+// photo and a stalled one lets go of the DB connection within PhotoWriteTimeout. On top, the
+// listener caps open connections overall and per client address, so a few hosts holding many
+// idle or trickling connections can't take every slot.
+
+var httpConnStats = expvar.NewMap("http_conns") // open, rejected_per_ip
+
+// httpServer is the app's http.Server over h, with the configured timeouts.
+func (s *Server) httpServer(h http.Handler) *http.Server {
+	return &http.Server{Addr: s.cfg.Addr, Handler: h,
+		ReadHeaderTimeout: s.cfg.HTTPReadHeaderTimeout,
+		ReadTimeout:       s.cfg.HTTPReadTimeout,
+		WriteTimeout:      s.cfg.HTTPWriteTimeout,
+		IdleTimeout:       s.cfg.HTTPIdleTimeout,
+	}
+}
+
+// drain stops srv gracefully on SIGINT or SIGTERM. /readyz turns 503 at once while requests
+// are still served for ShutdownDelay, so load balancers take the instance out of rotation
+// before the listener closes; keep-alives are off meanwhile, so clients reconnect elsewhere.
+// Shutdown then closes the listener and idle connections and waits up to ShutdownTimeout for
+// in-flight requests (uploads, votes, photo streams); connections still busy after that are
+// closed.
+func (s *Server) drain(srv *http.Server) error {
+	s.draining.Store(true)
+	srv.SetKeepAlivesEnabled(false)
+	s.log.Info("draining", "delay", s.cfg.ShutdownDelay, "timeout", s.cfg.ShutdownTimeout)
+	time.Sleep(s.cfg.ShutdownDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		s.log.Warn("drain timed out; closing remaining connections", "err", err)
+		return srv.Close()
+	}
+	s.log.Info("drained")
+	return nil
+}
+
+// flushCounters writes the in-memory photo traffic and vote referrer counts once more before
+// the process exits, rather than losing up to a minute of them.
+func (s *Server) flushCounters(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := s.flushPhotoTraffic(ctx); err != nil { s.log.Error("final photo traffic flush failed", "err", err) }
+	if err := s.flushVoteReferrers(ctx); err != nil { s.log.Error("final vote referrers flush failed", "err", err) }
+}
+
+// listen opens cfg.Addr, or takes the socket systemd passed (see systemd.go; inherited is
+// then true and cfg.Addr unused), with the configured connection limits.
+func listen(cfg Config) (ln net.Listener, inherited bool, err error) {
+	ln, err = inheritedListener()
+	if err != nil { return nil, false, err }
+	inherited = ln != nil
+	if !inherited { ln, err = net.Listen("tcp", cfg.Addr) }
+	if err != nil { return nil, false, err }
+	return newLimitListener(ln, cfg.HTTPMaxConns, cfg.HTTPMaxConnsPerIP), inherited, nil
+}
+
+// limitListener holds Accept while max connections are open, and closes new connections from
+// an address that already has perIP open. Zero disables either limit.
+type limitListener struct {
+	net.Listener
+	slots chan struct{} // nil without a total limit
+	perIP int
+
+	mu   sync.Mutex
+	open map[string]int
+}
+
+func newLimitListener(ln net.Listener, max, perIP int) *limitListener {
+	l := &limitListener{Listener: ln, perIP: perIP, open: map[string]int{}}
+	if max > 0 { l.slots = make(chan struct{}, max) }
+	return l
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		if l.slots != nil { l.slots <- struct{}{} }
+		c, err := l.Listener.Accept()
+		if err != nil {
+			l.release()
+			return nil, err
+		}
+		host := remoteHost(c.RemoteAddr())
+		if !l.admit(host) {
+			httpConnStats.Add("rejected_per_ip", 1)
+			c.Close()
+			l.release()
+			continue
+		}
+		httpConnStats.Add("open", 1)
+		return &limitedConn{Conn: c, done: func() { l.leave(host) }}, nil
+	}
+}
+
+func (l *limitListener) release() {
+	if l.slots != nil { <-l.slots }
+}
+
+// admit counts a connection from host, unless host is at its limit.
+func (l *limitListener) admit(host string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perIP > 0 && l.open[host] >= l.perIP { return false }
+	l.open[host]++
+	return true
+}
+
+func (l *limitListener) leave(host string) {
+	l.mu.Lock()
+	if l.open[host]--; l.open[host] <= 0 { delete(l.open, host) }
+	l.mu.Unlock()
+	l.release()
+	httpConnStats.Add("open", -1)
+}
+
+func remoteHost(a net.Addr) string {
+	if ta, ok := a.(*net.TCPAddr); ok { return ta.IP.String() }
+	host, _, err := net.SplitHostPort(a.String())
+	if err != nil { return a.String() }
+	return host
+}
+
+// limitedConn gives its slot back on the first Close.
+type limitedConn struct {
+	net.Conn
+	once sync.Once
+	done func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.done)
+	return err
+}
+
+// deadlineWriter renews the response's write deadline before every write, for streams that
+// may outlast the server's WriteTimeout as long as they keep moving.
+type deadlineWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+	d  time.Duration
+}
+
+func newDeadlineWriter(w http.ResponseWriter, d time.Duration) io.Writer {
+	if d <= 0 { return w }
+	return &deadlineWriter{w: w, rc: http.NewResponseController(w), d: d}
+}
+
+func (dw *deadlineWriter) Write(p []byte) (int, error) {
+	// Recorders in tests and wrapped writers without Unwrap can't take deadlines; the
+	// server's WriteTimeout still applies to them.
+	if err := dw.rc.SetWriteDeadline(time.Now().Add(dw.d)); err != nil && !errors.Is(err, http.ErrNotSupported) { return 0, err }
+	return dw.w.Write(p)
+}
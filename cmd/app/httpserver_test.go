@@ -0,0 +1,146 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimitListenerPerIP(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	ln := newLimitListener(inner, 0, 2)
+	defer ln.Close()
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil { return }
+			accepted <- c
+		}
+	}()
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil { t.Fatal(err) }
+		return c
+	}
+	waitAccept := func() net.Conn {
+		select {
+		case c := <-accepted:
+			return c
+		case <-time.After(2 * time.Second):
+			t.Fatal("connection not accepted")
+			return nil
+		}
+	}
+	a, b := dial(), dial()
+	defer a.Close()
+	defer b.Close()
+	first, second := waitAccept(), waitAccept()
+
+	// A third connection from the same address is closed by the server.
+	c := dial()
+	defer c.Close()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err == nil { t.Fatal("third connection was not closed") }
+	select {
+	case <-accepted:
+		t.Fatal("third connection was accepted")
+	default:
+	}
+
+	// Closing one frees its slot, once.
+	first.Close()
+	first.Close()
+	d := dial()
+	defer d.Close()
+	waitAccept().Close()
+	second.Close()
+	if n := len(ln.open); n != 0 { t.Errorf("open = %v after all closed", ln.open) }
+}
+
+func TestLimitListenerTotal(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil { t.Fatal(err) }
+	ln := newLimitListener(inner, 1, 0)
+	defer ln.Close()
+	a, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil { t.Fatal(err) }
+	defer a.Close()
+	first, err := ln.Accept()
+	if err != nil { t.Fatal(err) }
+
+	b, err := net.Dial("tcp", inner.Addr().String()) // queued by the kernel, not accepted
+	if err != nil { t.Fatal(err) }
+	defer b.Close()
+	got := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err == nil { got <- c }
+	}()
+	select {
+	case <-got:
+		t.Fatal("accepted past the limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+	first.Close()
+	select {
+	case c := <-got:
+		c.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("slot not released")
+	}
+}
+
+func TestDeadlineWriterWithoutDeadlines(t *testing.T) {
+	w := httptest.NewRecorder()
+	if n, err := newDeadlineWriter(w, time.Second).Write([]byte("abc")); n != 3 || err != nil || w.Body.String() != "abc" {
+		t.Errorf("Write = %d, %v; body %q", n, err, w.Body.String())
+	}
+}
+
+func TestDrainFinishesInFlightRequests(t *testing.T) {
+	s := &Server{log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cfg: Config{ShutdownDelay: 50 * time.Millisecond, ShutdownTimeout: 2 * time.Second}}
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	mux.HandleFunc("GET /slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	slow := make(chan string, 1)
+	go func() {
+		res, err := http.Get(srv.URL + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		slow <- string(b)
+	}()
+	<-started
+	drained := make(chan error, 1)
+	go func() { drained <- s.drain(srv.Config) }()
+
+	// During the delay the server still answers, but not as ready.
+	time.Sleep(10 * time.Millisecond)
+	res, err := http.Get(srv.URL + "/readyz")
+	if err != nil { t.Fatal(err) }
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable { t.Errorf("/readyz while draining = %d", res.StatusCode) }
+
+	close(release)
+	if got := <-slow; got != "done" { t.Errorf("in-flight request got %q", got) }
+	if err := <-drained; err != nil { t.Errorf("drain = %v", err) }
+	if _, err := http.Get(srv.URL + "/readyz"); err == nil { t.Error("server still accepting after drain") }
+}
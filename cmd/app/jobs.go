@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// runEvery calls fn right away and then every interval until ctx is done. Failures are
+// logged and retried on the next tick; jobs must be safe to run on several replicas. Ticks
+// are skipped while the server is read-only.
+func (s *Server) runEvery(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if s.readOnly.active() {
+			s.log.Debug("job skipped: read-only", "job", name)
+			s.jobs.record(name, interval, time.Now(), 0, nil, true)
+		} else {
+			start := time.Now()
+			err := fn(ctx)
+			s.jobs.record(name, interval, start, time.Since(start), err, false)
+			if err != nil && ctx.Err() == nil { s.log.Error("job failed", "job", name, "err", err) }
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// jobStatus is the latest run of a periodic job, as /admin/debug/stats shows it.
+type jobStatus struct {
+	Interval     string    `json:"interval"`
+	Runs         int64     `json:"runs"`
+	Failures     int64     `json:"failures"`
+	Skipped      int64     `json:"skipped"` // ticks skipped while read-only
+	LastRun      time.Time `json:"last_run"`
+	LastDuration string    `json:"last_duration"`
+	LastError    string    `json:"last_error,omitempty"` // from the last failed run, cleared by a success
+}
+
+// jobTable collects jobStatus per job name; the zero value is ready to use.
+type jobTable struct {
+	mu   sync.Mutex
+	jobs map[string]*jobStatus
+}
+
+func (t *jobTable) record(name string, interval time.Duration, start time.Time, took time.Duration, err error, skipped bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.jobs == nil { t.jobs = map[string]*jobStatus{} }
+	j := t.jobs[name]
+	if j == nil {
+		j = &jobStatus{Interval: interval.String()}
+		t.jobs[name] = j
+	}
+	if skipped {
+		j.Skipped++
+		return
+	}
+	j.Runs++
+	j.LastRun, j.LastDuration, j.LastError = start, took.String(), ""
+	if err != nil {
+		j.Failures++
+		j.LastError = err.Error()
+	}
+}
+
+// snapshot copies the table for reporting.
+func (t *jobTable) snapshot() map[string]jobStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]jobStatus, len(t.jobs))
+	for name, j := range t.jobs { out[name] = *j }
+	return out
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// A vote kiosk is a tablet at an event showing one exhibit at a time, full screen, with a vote
+// button big enough to hit in passing. An admin starts a kiosk session (kiosk_sessions) and
+// opens its link on the tablet, which keeps the session in a cookie. The screen advances by
+// itself through the active profiles, in the random pool's order (random.go), with a meta
+// refresh, so it needs no JavaScript. Votes there are cast by the session's voter,
+// "kiosk.<id>" in votes.voter, so each can be traced to its session afterwards. Many people
+// vote on one tablet, so the per-voter cooldown doesn't apply: a kiosk takes one vote per
+// kioskVoteGap, and vote_profile_cap applies as everywhere. Nor is the tablet's IP screened;
+// the admin vouched for it. The link is the key: end a session whose link got out.
+
+const (
+	kioskCookie     = "kiosk"
+	kioskAdvance    = 12 * time.Second // how long each exhibit is shown
+	kioskThanks     = 3 * time.Second  // how long the outcome of a vote is shown before the next exhibit
+	kioskVoteGap    = 2 * time.Second
+	kioskDefaultTTL = 12 * time.Hour
+	kioskMaxTTL     = 7 * 24 * time.Hour
+	kioskMaxLabel   = 100
+)
+
+const ErrKioskBusy ErrorRateLimited = "this kiosk takes one vote at a time"
+
+type ErrorInvalidKiosk string
+
+func (e ErrorInvalidKiosk) Error() string { return string(e) }
+func (ErrorInvalidKiosk) InvalidKiosk()   {}
+
+// kioskFlashes are the outcomes a vote redirects back with (?flash=); anything else is
+// ignored, so the URL can't put text on the screen.
+var kioskFlashes = map[string]views.Flash{
+	"voted":   {Message: "Thank you for voting!"},
+	"wait":    {Message: "One vote at a time, please. Try again in a moment.", Error: true},
+	"limited": {Message: "This exhibit has had too many votes lately.", Error: true},
+	"retired": {Message: "This exhibit is retired and no longer takes votes.", Error: true},
+	"failed":  {Message: "Something went wrong and the vote was not counted.", Error: true},
+}
+
+// kioskSession is a live kiosk session.
+type kioskSession struct {
+	ID      string
+	Label   string
+	Expires time.Time
+}
+
+func (k kioskSession) voter() voter {
+	return voter{kind: voterKiosk, ids: []string{voterKiosk + "." + k.ID}}
+}
+
+// liveKiosk returns session id unless it is unknown, ended or expired.
+func (s *Server) liveKiosk(ctx context.Context, id string) (kioskSession, bool, error) {
+	if !validVoteToken(id) { return kioskSession{}, false, nil }
+	k := kioskSession{ID: id}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT label, expires_at FROM kiosk_sessions WHERE id = $1 AND ended_at IS NULL AND expires_at > now()
+	`, id).Scan(&k.Label, &k.Expires)
+	if err == sql.ErrNoRows { return kioskSession{}, false, nil }
+	return k, err == nil, err
+}
+
+// kioskOf returns the live session of r's kiosk cookie, if it has one.
+func (s *Server) kioskOf(r *http.Request) (kioskSession, bool, error) {
+	c, err := r.Cookie(kioskCookie)
+	if err != nil { return kioskSession{}, false, nil }
+	return s.liveKiosk(r.Context(), c.Value)
+}
+
+// handleKiosk shows a kiosk screen: GET /kiosk?n=&flash=
+// n is the place in the cycle, flash the outcome of the vote just cast there. The session's
+// link, /kiosk?k=<id>, sets the cookie and redirects to the first screen.
+func (s *Server) handleKiosk(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if id := r.URL.Query().Get("k"); id != "" {
+		k, ok, err := s.liveKiosk(r.Context(), id)
+		if err != nil {
+			http.Error(w, "query error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			s.renderStatus(w, http.StatusForbidden, "kiosk.gohtml", views.KioskView{Error: "This kiosk link is not valid, or its session has ended."})
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: kioskCookie, Value: k.ID, Path: "/kiosk", Expires: k.Expires, HttpOnly: true,
+			Secure: s.secureCookies(r), SameSite: http.SameSiteStrictMode})
+		http.Redirect(w, r, "/kiosk", http.StatusSeeOther)
+		return
+	}
+	k, ok, err := s.kioskOf(r)
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		s.renderStatus(w, http.StatusForbidden, "kiosk.gohtml", views.KioskView{Error: "This screen is not a vote kiosk. An admin starts one and opens its link here."})
+		return
+	}
+	ids, err := s.randomPoolIDs(r.Context())
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	// Without exhibits the screen still reloads, to pick up the first one added.
+	v := views.KioskView{Label: k.Label, Next: "/kiosk", Advance: int(kioskAdvance / time.Second), ReadOnly: s.readOnly.active()}
+	if len(ids) > 0 {
+		n := clampAtoi(r.URL.Query().Get("n"), 0, math.MaxInt32, 0) % len(ids)
+		v.N, v.Next = n, "/kiosk?n="+strconv.Itoa((n+1)%len(ids))
+		list, err := s.loadProfiles(r.Context(), profileFilter{ID: ids[n], Limit: 1})
+		if err != nil {
+			http.Error(w, "query error", http.StatusInternalServerError)
+			return
+		}
+		if len(list) > 0 {
+			pv := profileView(list[0])
+			if !pv.Retired { pv.VoteToken = newVoteToken() }
+			v.Profile = &pv
+		}
+	}
+	if f, ok := kioskFlashes[r.URL.Query().Get("flash")]; ok {
+		v.Flash, v.Advance = &f, int(kioskThanks/time.Second)
+	}
+	s.render(w, "kiosk.gohtml", v)
+}
+
+// handleKioskVote records a kiosk's vote: POST /kiosk/vote with profile, n and vote_token.
+// It redirects back to the screen it came from with the outcome, which then moves on.
+func (s *Server) handleKioskVote(w http.ResponseWriter, r *http.Request) {
+	k, ok, err := s.kioskOf(r)
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "this screen is not a vote kiosk", http.StatusForbidden)
+		return
+	}
+	code := "voted"
+	id := r.PostFormValue("profile")
+	err = ErrNotFound
+	if validVoteToken(id) { err = s.castVote(r.Context(), id, r.PostFormValue("vote_token"), k.voter()) }
+	if err != nil {
+		switch {
+		case errors.As(err, new(interface{ DuplicateVote() })):
+		case errors.Is(err, ErrKioskBusy):
+			code = "wait"
+		case errors.As(err, new(interface{ RateLimited() })):
+			code = "limited"
+		case errors.As(err, new(interface{ Retired() })):
+			code = "retired"
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+			return
+		default:
+			if !errors.As(err, new(interface{ NotFound() })) { s.log.Error("kiosk vote", "kiosk", k.ID, "err", err) }
+			code = "failed"
+		}
+	}
+	n := clampAtoi(r.PostFormValue("n"), 0, math.MaxInt32, 0)
+	http.Redirect(w, r, "/kiosk?n="+strconv.Itoa(n)+"&flash="+code, http.StatusSeeOther)
+}
+
+// APIKiosk is a kiosk session in the admin API. URL, the session's link, is absolute when
+// LEADERBOARD_PUBLIC_URL is set, otherwise a path.
+type APIKiosk struct {
+	ID        string     `json:"id"`
+	Label     string     `json:"label"`
+	URL       string     `json:"url"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	Votes     int        `json:"votes"` // cast by the session, counted or not yet
+}
+
+func (s *Server) kioskURL(id string) string {
+	return strings.TrimRight(s.cfg.PublicURL, "/") + "/kiosk?k=" + id
+}
+
+// startKiosk starts a kiosk session labelled label, for ttl.
+func (s *Server) startKiosk(ctx context.Context, label string, ttl time.Duration, actor string) (APIKiosk, error) {
+	if err := s.writable(); err != nil { return APIKiosk{}, err }
+	label = strings.TrimSpace(label)
+	if label == "" || len([]rune(label)) > kioskMaxLabel { return APIKiosk{}, ErrorInvalidKiosk("label must be 1 to 100 characters") }
+	k := APIKiosk{Label: label, CreatedBy: actor}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO kiosk_sessions (label, created_by, expires_at) VALUES ($1, $2, now() + `+sqlInterval(ttl)+`)
+		RETURNING id::string, created_at, expires_at
+	`, label, actor).Scan(&k.ID, &k.CreatedAt, &k.ExpiresAt)
+	k.URL = s.kioskURL(k.ID)
+	return k, err
+}
+
+// loadKiosks lists kiosk sessions, newest first, with their votes.
+func (s *Server) loadKiosks(ctx context.Context) ([]APIKiosk, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT k.id::string, k.label, k.created_by, k.created_at, k.expires_at, k.ended_at,
+			(SELECT count(*) FROM votes v WHERE v.voter = 'kiosk.' || k.id::string)
+		FROM kiosk_sessions k ORDER BY k.created_at DESC LIMIT 200
+	`)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	list := []APIKiosk{}
+	for rows.Next() {
+		var k APIKiosk
+		if err := rows.Scan(&k.ID, &k.Label, &k.CreatedBy, &k.CreatedAt, &k.ExpiresAt, &k.EndedAt, &k.Votes); err != nil { return nil, err }
+		k.URL = s.kioskURL(k.ID)
+		list = append(list, k)
+	}
+	return list, rows.Err()
+}
+
+// endKiosk ends kiosk session id; its screen stops at the next refresh.
+func (s *Server) endKiosk(ctx context.Context, id string) error {
+	if err := s.writable(); err != nil { return err }
+	if !validVoteToken(id) { return ErrNotFound }
+	res, err := s.db.ExecContext(ctx, `UPDATE kiosk_sessions SET ended_at = now() WHERE id = $1 AND ended_at IS NULL`, id)
+	if err != nil { return err }
+	if n, err := res.RowsAffected(); err != nil { return err } else if n == 0 { return ErrNotFound }
+	return nil
+}
+
+// handleAPIAdminKiosks lists (GET) or starts (POST {"label", "ttl": "12h"}) kiosk sessions.
+// The last 200 are listed, newest first.
+func (s *Server) handleAPIAdminKiosks(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var req struct {
+			Label string `json:"label"`
+			TTL   string `json:"ttl"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad json")
+			return
+		}
+		ttl := kioskDefaultTTL
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d < time.Minute || d > kioskMaxTTL {
+				writeJSONError(w, http.StatusBadRequest, "ttl must be a duration from 1m to 168h")
+				return
+			}
+			ttl = d
+		}
+		actor, _ := s.adminActor(r)
+		k, err := s.startKiosk(r.Context(), req.Label, ttl, actor)
+		switch {
+		case errors.As(err, new(interface{ InvalidKiosk() })):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+		case err != nil:
+			writeJSONError(w, http.StatusInternalServerError, "db error")
+		default:
+			s.log.Info("kiosk started", "id", k.ID, "label", k.Label, "ttl", ttl, "by", actor)
+			writeJSON(w, http.StatusCreated, k)
+		}
+		return
+	}
+	list, err := s.loadKiosks(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"kiosks": list})
+}
+
+// handleAPIAdminEndKiosk ends a kiosk session: DELETE /api/v1/admin/kiosks/{id}. It stays
+// listed, with its votes.
+func (s *Server) handleAPIAdminEndKiosk(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	err := s.endKiosk(r.Context(), id)
+	switch {
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "no running kiosk session with that id")
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+	default:
+		actor, _ := s.adminActor(r)
+		s.log.Info("kiosk ended", "id", id, "by", actor)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestKioskRequiresSession checks that only a kiosk session's screen shows exhibits or takes
+// votes; a cookie that isn't a session id is refused before any query.
+func TestKioskRequiresSession(t *testing.T) {
+	tmpl, err := parseTemplates()
+	if err != nil { t.Fatal(err) }
+	s := &Server{tmpl: tmpl, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, cookie := range []string{"", "not-a-session", "../../admin"} {
+		r := httptest.NewRequest(http.MethodGet, "/kiosk", nil)
+		if cookie != "" { r.AddCookie(&http.Cookie{Name: kioskCookie, Value: cookie}) }
+		w := httptest.NewRecorder()
+		s.handleKiosk(w, r)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "not a vote kiosk") { t.Errorf("GET with cookie %q = %d %q", cookie, w.Code, w.Body) }
+
+		r = httptest.NewRequest(http.MethodPost, "/kiosk/vote", strings.NewReader("profile=00000000-0000-4000-8000-000000000001&n=0"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" { r.AddCookie(&http.Cookie{Name: kioskCookie, Value: cookie}) }
+		w = httptest.NewRecorder()
+		s.handleKioskVote(w, r)
+		if w.Code != http.StatusForbidden { t.Errorf("POST with cookie %q = %d", cookie, w.Code) }
+	}
+	r := httptest.NewRequest(http.MethodGet, "/kiosk?k=nope", nil)
+	w := httptest.NewRecorder()
+	s.handleKiosk(w, r)
+	if w.Code != http.StatusForbidden || w.Header().Get("Set-Cookie") != "" { t.Errorf("bad link = %d, Set-Cookie %q", w.Code, w.Header().Get("Set-Cookie")) }
+}
+
+func TestKioskVoter(t *testing.T) {
+	v := kioskSession{ID: "3f2a9c1e-0000-4000-8000-000000000001"}.voter()
+	if v.kind != voterKiosk || v.id() != "kiosk.3f2a9c1e-0000-4000-8000-000000000001" { t.Errorf("voter = %+v", v) }
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// Profiles read their location through the normalized tables; see internal/store.
+const (
+	profileCountryCol   = store.CountryCol
+	profileCityCol      = store.CityCol
+	profileLocationCols = store.LocationCols
+	profileLocationJoin = store.LocationJoin
+)
+
+// resolveCity returns the id of city in country, creating either when new. Names match
+// case-insensitively; the first spelling seen is kept.
+func resolveCity(ctx context.Context, tx *sql.Tx, country, city string) (string, error) {
+	if _, err := tx.ExecContext(ctx, `INSERT INTO countries (name) VALUES ($1) ON CONFLICT (name_key) DO NOTHING`, country); err != nil { return "", err }
+	var countryID string
+	if err := tx.QueryRowContext(ctx, `SELECT id::string FROM countries WHERE name_key = lower($1)`, country).Scan(&countryID); err != nil { return "", err }
+	if _, err := tx.ExecContext(ctx, `INSERT INTO cities (country_id, name) VALUES ($1, $2) ON CONFLICT (country_id, name_key) DO NOTHING`, countryID, city); err != nil { return "", err }
+	var cityID string
+	err := tx.QueryRowContext(ctx, `SELECT id::string FROM cities WHERE country_id = $1 AND name_key = lower($2)`, countryID, city).Scan(&cityID)
+	return cityID, err
+}
+
+// APICity is a city in the admin listing, with how many profiles use it.
+type APICity struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Country  string `json:"country"`
+	Profiles int    `json:"profiles"`
+}
+
+// handleAPIAdminCities lists cities to spot misspelled variants: GET /api/v1/admin/cities?country=&q=
+func (s *Server) handleAPIAdminCities(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT ci.id::string, ci.name, co.name, count(p.id)
+		FROM cities ci JOIN countries co ON co.id = ci.country_id LEFT JOIN profiles p ON p.city_id = ci.id
+		WHERE ($1 = '' OR co.name_key = lower($1)) AND ($2 = '' OR ci.name_key LIKE '%' || lower($2) || '%')
+		GROUP BY ci.id, ci.name, co.name
+		ORDER BY co.name, ci.name_key
+		LIMIT 1000`,
+		strings.TrimSpace(r.URL.Query().Get("country")), strings.TrimSpace(r.URL.Query().Get("q")))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "query error")
+		return
+	}
+	defer rows.Close()
+	list := []APICity{}
+	for rows.Next() {
+		var c APICity
+		if err := rows.Scan(&c.ID, &c.Name, &c.Country, &c.Profiles); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "scan error")
+			return
+		}
+		list = append(list, c)
+	}
+	if err := rows.Err(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "query error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"cities": list})
+}
+
+type ErrorInvalidMerge string
+
+func (e ErrorInvalidMerge) Error() string { return string(e) }
+func (ErrorInvalidMerge) InvalidMerge()   {}
+
+// CityMerge folds the From cities into Into.
+type CityMerge struct {
+	From []string `json:"from"`
+	Into string   `json:"into"`
+}
+
+// handleAPIAdminMergeCities merges misspelled variants: POST /api/v1/admin/cities/merge {"from": [...], "into": id}
+func (s *Server) handleAPIAdminMergeCities(w http.ResponseWriter, r *http.Request) {
+	var req CityMerge
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad json")
+		return
+	}
+	actor, _ := s.adminActor(r)
+	moved, err := s.mergeCities(r.Context(), req, actor)
+	switch {
+	case errors.As(err, new(interface{ InvalidMerge() })):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "unknown city id")
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"into": req.Into, "merged": len(req.From), "profiles": moved})
+	}
+}
+
+// mergeCities points every profile of the From cities at Into, rewrites their location text
+// to Into's spelling (so search and country leaderboards follow) and deletes the variants.
+func (s *Server) mergeCities(ctx context.Context, req CityMerge, actor string) (int64, error) {
+	if req.Into == "" || len(req.From) == 0 { return 0, ErrorInvalidMerge("from and into are required") }
+	for _, id := range req.From {
+		if id == req.Into { return 0, ErrorInvalidMerge("into must not be listed in from") }
+	}
+	if err := s.writable(); err != nil { return 0, err }
+	var moved int64
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var city, country string
+		err := tx.QueryRowContext(ctx, `
+			SELECT ci.name, co.name FROM cities ci JOIN countries co ON co.id = ci.country_id WHERE ci.id = $1
+		`, req.Into).Scan(&city, &country)
+		if errors.Is(err, sql.ErrNoRows) { return ErrNotFound }
+		if err != nil { return err }
+		for _, id := range req.From {
+			res, err := tx.ExecContext(ctx, `
+				UPDATE profiles SET city_id = $2, location_city = $3, location_country = $4, updated_at = now() WHERE city_id = $1
+			`, id, req.Into, city, country)
+			if isNameConflict(err) { return ErrorInvalidMerge("merging would give two exhibits in one city the same name") }
+			if err != nil { return err }
+			n, _ := res.RowsAffected()
+			moved += n
+			res, err = tx.ExecContext(ctx, `DELETE FROM cities WHERE id = $1`, id)
+			if err != nil { return err }
+			if n, _ := res.RowsAffected(); n == 0 { return ErrNotFound }
+		}
+		// Drop countries left without cities (a misspelled country merged away).
+		_, err = tx.ExecContext(ctx, `DELETE FROM countries co WHERE NOT EXISTS (SELECT 1 FROM cities ci WHERE ci.country_id = co.id)`)
+		return err
+	})
+	if err != nil { return 0, err }
+	s.log.Info("cities merged", "into", req.Into, "from", req.From, "profiles", moved, "by", actor)
+	return moved, nil
+}
@@ -1,25 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"database/sql"
 	"embed"
 	"errors"
+	"flag"
 	"fmt"
 	"html/template"
-	"image"
-	"image/jpeg"
-	_ "image/png"
 	"io"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/doesnotcommit/bestfriends/internal/blob"
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
 )
 
 //go:embed templates/*
@@ -28,22 +33,141 @@ var templatesFS embed.FS
 // Configurable constants (can be overridden via env)
 const (
 	defaultAddr            = ":8080"
-	maxUploadAcceptBytes   = 1 * 1024 * 1024 // 1MB input
-	maxStoredImageBytes    = 500 * 1024       // 500KB in DB
-	maxImageWidth          = 1024
+	maxUploadAcceptBytes   = imaging.MaxUploadBytes
 )
 
 type Config struct {
-	Addr      string
-	DBURL     string
-	DebugHTTP bool
+	Addr       string
+	DBURL      string
+	DebugHTTP  bool
+
+	HTTPReadHeaderTimeout time.Duration // time to read a request's headers
+	HTTPReadTimeout       time.Duration // time to read a whole request, body included; 0 disables
+	HTTPWriteTimeout      time.Duration // time from the end of the headers to the end of the response; 0 disables
+	HTTPIdleTimeout       time.Duration // how long a kept-alive connection may wait for its next request
+	HTTPMaxConns          int           // open connections accepted at once; 0 is unlimited
+	HTTPMaxConnsPerIP     int           // open connections per client address; 0 is unlimited
+	PhotoWriteTimeout     time.Duration // deadline per streamed photo chunk, renewed as chunks go out; 0 uses HTTPWriteTimeout
+	ShutdownDelay         time.Duration // how long a draining server keeps accepting requests with /readyz at 503
+	ShutdownTimeout       time.Duration // how long Shutdown then waits for in-flight requests
+
+	MigrationsDir string // SQL files applied by the migrate command; "" for the embedded ones
+	AutoMigrate   bool   // apply pending migrations at startup, before checking the schema
+
+	DBConnectWindow time.Duration // how long startup keeps retrying the initial connection
+	DBRetryInitial  time.Duration // first backoff delay, doubled per attempt
+	DBRetryMax      time.Duration // backoff delay cap
+
+	DBStatementTimeout time.Duration // statement_timeout of every connection; 0 keeps the database's default
+	SearchTimeout      time.Duration // deadline of leaderboard listing queries; 0 leaves them to the statement timeout
+
+	AdminToken     string // enables /admin and /api/v1/admin routes when set
+	ReadOnly       bool   // start in read-only maintenance mode
+	TrustProxy     bool   // take the client IP from X-Forwarded-For (set behind a reverse proxy)
+
+	CreateLimitPerDay int // profiles one visitor (IP) may create per UTC day; 0 disables
+	VisitorKey         string        // keys the HMAC visitor ids are stored as; random per process when unset
+	VisitorKeyRotation time.Duration // how often the visitor id key rotates
+	SchemaMismatch string // "read-only" serves reads when the schema is newer than this build; otherwise startup fails
+	MaxPins        int    // how many profiles admins may pin to the top of the home page
+
+	VotesRetentionInterval time.Duration // how often expired votes_recent rows move to votes_history; 0 disables
+	VotesDualWrite         bool          // also write votes to the legacy votes_recent and votes_history tables
+	ChampionsInterval      time.Duration // how often country champions are recomputed; 0 disables
+
+	PhotoSigningKey string        // when set, photo URLs are HMAC-signed and expire
+	VoteLinkKey     string        // enables /vote and signed vote links when set
+	HTMXURL         string        // htmx script to load; enables in-place search and voting
+	VoteRedirect    bool          // plain-form votes go straight back home instead of to the vote receipt
+	PublicURL       string        // base URL for links sent outside the site, e.g. vote links
+	PhotoURLTTL     time.Duration // lifetime window of signed photo URLs
+	PhotoReferers   []string      // other hosts allowed to show photos under hotlink protection
+
+	BlobStore string        // "disk" or "s3" keeps photos in object storage (see blobs.go); "" in the database
+	BlobDir   string        // directory of the disk store
+	S3        blob.S3Config // bucket of the s3 store
+
+	OriginalsMaxBytes  int           // largest original upload kept for reprocessing; 0 keeps none
+	OriginalsRetention time.Duration // how long originals are kept; 0 keeps them forever
+
+	AlertInterval         time.Duration // how often vote velocity is checked; 0 disables alerting
+	AlertGlobalPerMinute  int           // votes per minute across all profiles that raise an alert; 0 disables
+	AlertProfilePerMinute int           // votes per minute on one profile that raise an alert; 0 disables
+	AlertCooloff          time.Duration // minimum time between two alerts for the same profile (or globally)
+	AlertWebhookURL       string        // receives alerts as JSON POSTs; without it alerts are only logged
+
+	DigestTo       []string // admins emailed the moderation digest; empty disables it
+	DigestSchedule string   // hourly or daily
+	SMTPAddr       string   // mail server host:port (STARTTLS when offered)
+	SMTPUsername   string   // PLAIN auth when set
+	SMTPPassword   string
+	SMTPFrom       string
+
+	SiteCopyReload time.Duration // how often site copy edited on other instances is picked up
+
+	TranslateProvider string // "libretranslate" or "deepl" enables description translation
+	TranslateURL      string // provider base URL (required for libretranslate)
+	TranslateAPIKey   string // provider API key (required for deepl)
+
+	VoteFlushInterval time.Duration // batch votes_count updates this often; 0 updates on every vote
+	VoteFlushBatch    int           // pending votes that trigger an early flush
+
+	IPReputation           string // "static" or "abuseipdb" screens votes and creations by client IP
+	IPReputationFile       string // network list for static
+	IPReputationURL        string // API base URL for abuseipdb
+	IPReputationAPIKey     string // API key for abuseipdb
+	IPReputationChallenge  int    // score (0-100) from which visitors must solve a CAPTCHA; 0 disables
+	IPReputationQuarantine int    // score from which votes are quarantined and new profiles held; 0 disables
+
+	CaptchaProvider string // "turnstile" or "hcaptcha" enables CAPTCHA challenges
+	CaptchaSiteKey  string
+	CaptchaSecret   string
+
+	Environment string // deployment name, e.g. "staging"; anything but "production" allows Chaos
+	Chaos       string // fault injection rules, see chaos.go
+
+	Locale string // how counts are written on pages: en, de, es, fr, it, nl or pt
 }
 
 type Server struct {
 	log    *slog.Logger
 	tmpl   *template.Template
 	db     *sql.DB
+	store  store.ProfileStore
+	blobs  blob.Store // photo object storage; nil keeps photos in the database
 	cfg    Config
+
+	dbState  dbState
+	draining atomic.Bool // set on SIGINT/SIGTERM; /readyz answers 503 from then on
+	readOnly readOnlyState
+
+	photoFlight   *flightGroup[photo]
+	profileFlight *flightGroup[[]Profile]
+
+	siteCopy atomic.Pointer[views.SiteCopy] // cached site_settings; see site()
+
+	translator      translator // nil when translation is off
+	translateFlight *flightGroup[translation]
+
+	votes *voteBuffer // nil writes votes_count through on every vote
+
+	jobs    jobTable  // periodic job runs, for /admin/debug/stats
+	started time.Time // when newServer ran
+
+	visitorKeys visitorKeys // see visitor.go
+	settings    settingsCache // app_settings; see settings.go
+	chaos       []chaosRule   // injected faults; see chaos.go
+
+	layout     atomic.Pointer[[]views.LayoutSection] // home_sections; see sections.go
+	spotlight  atomic.Pointer[views.Spotlight]       // today's exhibit of the day; see spotlight.go
+	randomPool randomPool                            // see random.go
+	photoTraffic photoTraffic                        // see phototraffic.go
+	referrals    voteReferrals                       // see referrers.go
+	schemaDocs   schemaDocCache                      // see schemadoc.go
+
+	reputation      ipReputation     // nil when IP reputation is off; see reputation.go
+	reputationCache reputationCache
+	captcha         *captchaVerifier // nil without a CAPTCHA provider; see captcha.go
 }
 
 type ErrorRateLimited string
@@ -53,23 +177,37 @@ func (ErrorRateLimited) RateLimited()   {}
 
 const ErrRateLimited ErrorRateLimited = "rate limited"
 
-type Profile struct {
-	ID              string
-	FullName        string
-	Country         string
-	City            string
-	Description     string
-	Votes           int
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
+// ErrorNotFound is the store's, so either side's not-found errors compare equal.
+type ErrorNotFound = store.ErrorNotFound
+
+const ErrNotFound = store.ErrNotFound
+
+// Profile is a profile as the pages and API show it; see internal/store.
+type Profile = store.Profile
+
+func profileView(p Profile) views.ProfileView {
+	return views.ProfileView{
+		ID: p.ID, FullName: p.FullName, Country: p.Country, City: p.City, Description: p.Description,
+		Votes: p.Votes, CreatedAt: p.CreatedAt, EditedAt: p.EditedAt, RateLimited: p.RateLimited, Champion: p.Champion, Pinned: p.Pinned,
+		Trend: p.Trend, Retired: p.Retired, FinalRank: p.FinalRank, FinalChampion: p.FinalChampion,
+		PhotoColor: p.PhotoColor, PhotoBlurHash: p.PhotoBlurHash, RankDelta: p.RankDelta, Slug: p.Slug, PhotoAlt: p.PhotoAlt,
+	}
+}
+
+// cardView is p's card for a viewer reading translateTo. The translate link is left out when
+// p's description is known to be in that language already.
+func cardView(p Profile, translateTo string) views.ProfileView {
+	pv := profileView(p)
+	if translateTo != "" && p.Description != "" && p.DescriptionLang != translateTo { pv.TranslateTo = translateTo }
+	return pv
 }
 
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
 	cfg := loadConfig()
 
-	ctx := context.Background()
-	if err := run(ctx, logger, cfg); err != nil {
+	if err := runCommand(logger, cfg, os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) { os.Exit(2) }
 		logger.Error("fatal", "err", err)
 		os.Exit(1)
 	}
@@ -79,7 +217,94 @@ func loadConfig() Config {
 	addr := getenv("LEADERBOARD_ADDR", defaultAddr)
 	dburl := getenv("LEADERBOARD_DB_URL", "")
 	debugHTTP := strings.EqualFold(os.Getenv("LEADERBOARD_DEBUG_HTTP"), "1") || strings.EqualFold(os.Getenv("LEADERBOARD_DEBUG_HTTP"), "true")
-	return Config{Addr: addr, DBURL: dburl, DebugHTTP: debugHTTP}
+	trustProxy := strings.EqualFold(os.Getenv("LEADERBOARD_TRUST_PROXY"), "1") || strings.EqualFold(os.Getenv("LEADERBOARD_TRUST_PROXY"), "true")
+	readOnly := strings.EqualFold(os.Getenv("LEADERBOARD_READ_ONLY"), "1") || strings.EqualFold(os.Getenv("LEADERBOARD_READ_ONLY"), "true")
+	autoMigrate := strings.EqualFold(os.Getenv("LEADERBOARD_AUTO_MIGRATE"), "1") || strings.EqualFold(os.Getenv("LEADERBOARD_AUTO_MIGRATE"), "true")
+	dualWrite := os.Getenv("LEADERBOARD_VOTES_DUAL_WRITE") != "0" && !strings.EqualFold(os.Getenv("LEADERBOARD_VOTES_DUAL_WRITE"), "false")
+	visitorRotation := getenvDuration("LEADERBOARD_VISITOR_KEY_ROTATION", 24*time.Hour)
+	if visitorRotation < time.Hour { visitorRotation = time.Hour }
+	photoTTL := getenvDuration("LEADERBOARD_PHOTO_URL_TTL", time.Hour)
+	if photoTTL < time.Second { photoTTL = time.Hour }
+	retryInitial := getenvDuration("LEADERBOARD_DB_RETRY_INITIAL", 500*time.Millisecond)
+	if retryInitial <= 0 { retryInitial = 500 * time.Millisecond }
+	siteCopyReload := getenvDuration("LEADERBOARD_SITE_COPY_RELOAD", 30*time.Second)
+	if siteCopyReload < time.Second { siteCopyReload = 30 * time.Second }
+	return Config{
+		Addr:                   addr,
+		DBURL:                  dburl,
+		HTTPReadHeaderTimeout:  getenvDuration("LEADERBOARD_HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		HTTPReadTimeout:        getenvDuration("LEADERBOARD_HTTP_READ_TIMEOUT", 30*time.Second),
+		HTTPWriteTimeout:       getenvDuration("LEADERBOARD_HTTP_WRITE_TIMEOUT", 60*time.Second),
+		HTTPIdleTimeout:        getenvDuration("LEADERBOARD_HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		HTTPMaxConns:           clampAtoi(os.Getenv("LEADERBOARD_HTTP_MAX_CONNS"), 0, 1_000_000, 4096),
+		HTTPMaxConnsPerIP:      clampAtoi(os.Getenv("LEADERBOARD_HTTP_MAX_CONNS_PER_IP"), 0, 1_000_000, 0),
+		PhotoWriteTimeout:      getenvDuration("LEADERBOARD_PHOTO_WRITE_TIMEOUT", 10*time.Second),
+		ShutdownDelay:          getenvDuration("LEADERBOARD_SHUTDOWN_DELAY", 5*time.Second),
+		ShutdownTimeout:        getenvDuration("LEADERBOARD_SHUTDOWN_TIMEOUT", 25*time.Second),
+		MigrationsDir:          os.Getenv("LEADERBOARD_MIGRATIONS_DIR"),
+		AutoMigrate:            autoMigrate,
+		DBConnectWindow:        getenvDuration("LEADERBOARD_DB_CONNECT_WINDOW", time.Minute),
+		DBRetryInitial:         retryInitial,
+		DBRetryMax:             max(retryInitial, getenvDuration("LEADERBOARD_DB_RETRY_MAX", 10*time.Second)),
+		DBStatementTimeout:     getenvDuration("LEADERBOARD_DB_STATEMENT_TIMEOUT", 30*time.Second),
+		SearchTimeout:          getenvDuration("LEADERBOARD_SEARCH_TIMEOUT", 5*time.Second),
+		DebugHTTP:              debugHTTP,
+		AdminToken:             os.Getenv("LEADERBOARD_ADMIN_TOKEN"),
+		ReadOnly:               readOnly,
+		TrustProxy:             trustProxy,
+		CreateLimitPerDay:      clampAtoi(os.Getenv("LEADERBOARD_CREATE_LIMIT_PER_DAY"), 0, 10000, 10),
+		VisitorKey:             os.Getenv("LEADERBOARD_VISITOR_KEY"),
+		VisitorKeyRotation:     visitorRotation,
+		VotesRetentionInterval: getenvDuration("LEADERBOARD_VOTES_RETENTION_INTERVAL", 5*time.Minute),
+		VotesDualWrite:         dualWrite,
+		ChampionsInterval:      getenvDuration("LEADERBOARD_CHAMPIONS_INTERVAL", 10*time.Minute),
+		MaxPins:                clampAtoi(os.Getenv("LEADERBOARD_MAX_PINS"), 0, 50, 5),
+		SchemaMismatch:         getenv("LEADERBOARD_SCHEMA_MISMATCH", "refuse"),
+		PhotoSigningKey:        os.Getenv("LEADERBOARD_PHOTO_SIGNING_KEY"),
+		VoteLinkKey:            os.Getenv("LEADERBOARD_VOTE_LINK_KEY"),
+		HTMXURL:                os.Getenv("LEADERBOARD_HTMX_URL"),
+		PublicURL:              os.Getenv("LEADERBOARD_PUBLIC_URL"),
+		VoteRedirect:           strings.EqualFold(os.Getenv("LEADERBOARD_VOTE_REDIRECT"), "1") || strings.EqualFold(os.Getenv("LEADERBOARD_VOTE_REDIRECT"), "true"),
+		PhotoURLTTL:            photoTTL,
+		PhotoReferers:          strings.FieldsFunc(strings.ToLower(os.Getenv("LEADERBOARD_PHOTO_REFERERS")), func(r rune) bool { return r == ',' || r == ' ' }),
+		BlobStore:              strings.ToLower(os.Getenv("LEADERBOARD_BLOB_STORE")),
+		BlobDir:                os.Getenv("LEADERBOARD_BLOB_DIR"),
+		S3: blob.S3Config{Endpoint: os.Getenv("LEADERBOARD_S3_ENDPOINT"), Region: os.Getenv("LEADERBOARD_S3_REGION"),
+			Bucket: os.Getenv("LEADERBOARD_S3_BUCKET"), Prefix: os.Getenv("LEADERBOARD_S3_PREFIX"),
+			AccessKey: os.Getenv("LEADERBOARD_S3_ACCESS_KEY"), SecretKey: os.Getenv("LEADERBOARD_S3_SECRET_KEY"),
+			PathStyle: strings.EqualFold(os.Getenv("LEADERBOARD_S3_PATH_STYLE"), "1") || strings.EqualFold(os.Getenv("LEADERBOARD_S3_PATH_STYLE"), "true")},
+		OriginalsMaxBytes:      clampAtoi(os.Getenv("LEADERBOARD_ORIGINALS_MAX_BYTES"), 0, maxUploadAcceptBytes, maxUploadAcceptBytes),
+		OriginalsRetention:     getenvDuration("LEADERBOARD_ORIGINALS_RETENTION", 0),
+		AlertInterval:          getenvDuration("LEADERBOARD_ALERT_INTERVAL", time.Minute),
+		AlertGlobalPerMinute:   clampAtoi(os.Getenv("LEADERBOARD_ALERT_GLOBAL_PER_MINUTE"), 0, 1_000_000, 0),
+		AlertProfilePerMinute:  clampAtoi(os.Getenv("LEADERBOARD_ALERT_PROFILE_PER_MINUTE"), 0, 1_000_000, 0),
+		AlertCooloff:           getenvDuration("LEADERBOARD_ALERT_COOLOFF", 15*time.Minute),
+		AlertWebhookURL:        os.Getenv("LEADERBOARD_ALERT_WEBHOOK_URL"),
+		DigestTo:               strings.FieldsFunc(os.Getenv("LEADERBOARD_DIGEST_TO"), func(r rune) bool { return r == ',' || r == ' ' }),
+		DigestSchedule:         strings.ToLower(getenv("LEADERBOARD_DIGEST_SCHEDULE", "daily")),
+		SMTPAddr:               os.Getenv("LEADERBOARD_SMTP_ADDR"),
+		SMTPUsername:           os.Getenv("LEADERBOARD_SMTP_USERNAME"),
+		SMTPPassword:           os.Getenv("LEADERBOARD_SMTP_PASSWORD"),
+		SMTPFrom:               os.Getenv("LEADERBOARD_SMTP_FROM"),
+		SiteCopyReload:         siteCopyReload,
+		TranslateProvider:      strings.ToLower(os.Getenv("LEADERBOARD_TRANSLATE_PROVIDER")),
+		TranslateURL:           os.Getenv("LEADERBOARD_TRANSLATE_URL"),
+		TranslateAPIKey:        os.Getenv("LEADERBOARD_TRANSLATE_API_KEY"),
+		VoteFlushInterval:      getenvDuration("LEADERBOARD_VOTE_FLUSH_INTERVAL", 0),
+		VoteFlushBatch:         clampAtoi(os.Getenv("LEADERBOARD_VOTE_FLUSH_BATCH"), 1, 100000, 100),
+		IPReputation:           strings.ToLower(os.Getenv("LEADERBOARD_IP_REPUTATION")),
+		IPReputationFile:       os.Getenv("LEADERBOARD_IP_REPUTATION_FILE"),
+		IPReputationURL:        os.Getenv("LEADERBOARD_IP_REPUTATION_URL"),
+		IPReputationAPIKey:     os.Getenv("LEADERBOARD_IP_REPUTATION_API_KEY"),
+		IPReputationChallenge:  clampAtoi(os.Getenv("LEADERBOARD_IP_REPUTATION_CHALLENGE"), 0, 100, 50),
+		IPReputationQuarantine: clampAtoi(os.Getenv("LEADERBOARD_IP_REPUTATION_QUARANTINE"), 0, 100, 90),
+		CaptchaProvider:        strings.ToLower(os.Getenv("LEADERBOARD_CAPTCHA_PROVIDER")),
+		CaptchaSiteKey:         os.Getenv("LEADERBOARD_CAPTCHA_SITE_KEY"),
+		CaptchaSecret:          os.Getenv("LEADERBOARD_CAPTCHA_SECRET"),
+		Environment:            strings.ToLower(getenv("LEADERBOARD_ENV", "production")),
+		Chaos:                  os.Getenv("LEADERBOARD_CHAOS"),
+		Locale:                 strings.ToLower(getenv("LEADERBOARD_LOCALE", "en")),
+	}
 }
 
 func run(ctx context.Context, logger *slog.Logger, cfg Config) error {
@@ -87,316 +312,728 @@ func run(ctx context.Context, logger *slog.Logger, cfg Config) error {
 		return fmt.Errorf("DB_URL is required")
 	}
 
-	db, err := sql.Open("postgres", cfg.DBURL)
+	dsn := withStatementTimeout(cfg.DBURL, cfg.DBStatementTimeout)
+	db, err := sql.Open("postgres", dsn)
+	if cfg.Chaos != "" { db, err = openChaosDB(dsn) }
 	if err != nil {
 		return fmt.Errorf("open db: %w", err)
 	}
 	defer db.Close()
-	if err := db.PingContext(ctx); err != nil {
-		return fmt.Errorf("ping db: %w", err)
-	}
 
-	tmpl, err := template.ParseFS(templatesFS, "templates/*.gohtml")
-	if err != nil {
-		return fmt.Errorf("parse templates: %w", err)
+	s, err := newServer(logger, cfg, db)
+	if err != nil { return err }
+	if cfg.VisitorKey == "" { logger.Warn("LEADERBOARD_VISITOR_KEY is unset; visitor throttles reset on restart and are per instance") }
+	if cfg.AutoMigrate { s.dbState.setMigrating(true) }
+
+	h := buildMux(s.routes(), s.serverMiddleware())
+	srv := s.httpServer(h)
+	ln, inherited, err := listen(cfg)
+	if err != nil { return err }
+	logger.Info("listening", "addr", ln.Addr().String(), "inherited", inherited, "max_conns", cfg.HTTPMaxConns, "max_conns_per_ip", cfg.HTTPMaxConnsPerIP)
+	s.notify("STATUS=connecting to the database")
+	// The watchdog is fed until run returns, through the drain.
+	wdCtx, stopWatchdog := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopWatchdog()
+	go s.pingWatchdog(wdCtx)
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	// Serve /healthz and /readyz while the database comes up; /readyz stays 503 until then.
+	connCtx, cancelConn := context.WithCancel(ctx)
+	defer cancelConn()
+	connc := make(chan error, 1)
+	go func() {
+		connc <- connectWithRetry(connCtx, db, cfg, &s.dbState, func(attempt int, wait time.Duration, err error) {
+			logger.Warn("db not reachable, retrying", "attempt", attempt, "wait", wait, "err", err)
+		})
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case err := <-connc:
+		if err != nil {
+			_ = srv.Close()
+			return err
+		}
+	}
+	logger.Info("db connected")
+	if cfg.AutoMigrate {
+		s.notify("STATUS=applying migrations")
+		if err := s.autoMigrate(ctx); err != nil {
+			_ = srv.Close()
+			return err
+		}
+		s.dbState.setMigrating(false)
+	}
+	if err := s.checkSchema(ctx); err != nil {
+		_ = srv.Close()
+		return err
 	}
 
-	s := &Server{log: logger, tmpl: tmpl, db: db, cfg: cfg}
+	if err := s.loadSiteCopy(ctx); err != nil {
+		logger.Error("site copy load failed; using defaults", "err", err)
+	}
+	if err := s.loadSettings(ctx); err != nil {
+		logger.Error("settings load failed; using defaults", "err", err)
+	}
+	if err := s.loadLayout(ctx); err != nil {
+		logger.Error("home layout load failed; showing the leaderboard", "err", err)
+	}
+	if err := s.loadSpotlight(ctx); err != nil {
+		logger.Error("spotlight load failed", "err", err)
+	}
+	// Background work outlives the signal: votes waiting for a flush and the counters of
+	// requests still being drained need it until the server has stopped.
+	bg, stopBG := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopBG()
+	go s.reloadSiteCopy(bg, cfg.SiteCopyReload)
+	if s.votes != nil {
+		go s.votes.run(bg, func(err error) { s.log.Error("vote flush failed", "err", err) })
+	}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", s.handleHome)
-	mux.HandleFunc("/add", s.handleAdd)
-	mux.HandleFunc("/profiles", s.handleCreateProfile)
-	mux.HandleFunc("/profiles/", s.handleProfileSubroutes) // /profiles/{id}/photo and /profiles/{id}/vote
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		if err := s.db.PingContext(r.Context()); err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			return
+	if cfg.VotesRetentionInterval > 0 {
+		go s.runEvery(bg, "vote_retention", cfg.VotesRetentionInterval, s.voteRetention)
+	}
+	go s.runEvery(bg, "photo_traffic", photoTrafficInterval, s.flushPhotoTraffic)
+	go s.runEvery(bg, "vote_referrers", voteReferrersInterval, s.flushVoteReferrers)
+	go s.runEvery(bg, "spotlight", spotlightInterval, s.chooseSpotlight)
+	go s.runEvery(bg, "photo_placeholders", placeholderInterval, s.fillPlaceholders)
+	go s.runEvery(bg, "photo_variants", variantInterval, s.fillVariants)
+	go s.runEvery(bg, "slugs", slugInterval, s.fillSlugs)
+	go s.runEvery(bg, "rank_snapshots", rankSnapshotInterval, s.snapshotRanks)
+	// Hourly, so retired keys' ids outlive their key by at most an hour.
+	go s.runEvery(bg, "visitor_keys", time.Hour, s.retireVisitorKeys)
+	if cfg.ChampionsInterval > 0 {
+		go s.runEvery(bg, "country_champions", cfg.ChampionsInterval, s.refreshChampions)
+	}
+	if cfg.AlertInterval > 0 && (cfg.AlertGlobalPerMinute > 0 || cfg.AlertProfilePerMinute > 0) {
+		go s.runEvery(bg, "vote_alerts", cfg.AlertInterval, s.checkVoteVelocity)
+	}
+	if len(cfg.DigestTo) > 0 {
+		if err := checkDigestConfig(cfg); err != nil {
+			logger.Warn("moderation digest disabled", "err", err)
+		} else {
+			go s.runEvery(bg, "moderation_digest", digestCheckInterval, s.sendModerationDigest)
 		}
-		w.WriteHeader(http.StatusOK)
-	})
+	}
+	s.notify("READY=1\nSTATUS=serving")
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	s.notify("STOPPING=1\nSTATUS=draining")
+	err = s.drain(srv)
+	s.flushCounters(bg)
+	return err
+}
+
+// newServer wires a Server over db without starting anything: run adds the listener and
+// background jobs, the other commands use it for its queries.
+func newServer(logger *slog.Logger, cfg Config, db *sql.DB) (*Server, error) {
+	tmpl, err := parseTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("parse templates: %w", err)
+	}
 
-	h := http.Handler(mux)
-	if cfg.DebugHTTP { h = debugRequestLogger(logger, h) }
-	srv := &http.Server{Addr: cfg.Addr, Handler: logMiddleware(logger, h), ReadHeaderTimeout: 10 * time.Second}
-	logger.Info("listening", "addr", cfg.Addr)
-	return srv.ListenAndServe()
+	blobs, err := newBlobStore(cfg)
+	if err != nil { return nil, err }
+	profiles := store.NewPostgres(db, blobs)
+	profiles.VotesDualWrite = cfg.VotesDualWrite
+	s := &Server{log: logger, tmpl: tmpl, db: db, store: profiles, blobs: blobs, cfg: cfg, started: time.Now(),
+		photoFlight: newFlightGroup[photo]("photo"), profileFlight: newFlightGroup[[]Profile]("profiles")}
+	tmpl.Funcs(template.FuncMap{"photoURL": s.photoURL, "photoSizeURL": s.photoSizeURL, "site": s.site,
+		"cooldown": func() string { return cooldownText(s.settings.GetDuration(settingVoteCooldown)) },
+		"count":    func(n int) template.HTML { return countHTML(n, localeNumberFormat(cfg.Locale)) }})
+	if s.translator, err = newTranslator(cfg); err != nil { return nil, err }
+	s.translateFlight = newFlightGroup[translation]("translate")
+	if s.reputation, err = newIPReputation(cfg); err != nil { return nil, fmt.Errorf("ip reputation: %w", err) }
+	if s.captcha, err = newCaptchaVerifier(cfg); err != nil { return nil, err }
+	if cfg.VoteFlushInterval > 0 { s.votes = newVoteBuffer(cfg.VoteFlushInterval, cfg.VoteFlushBatch, s.flushVotes) }
+	s.readOnly.maintenance.Store(cfg.ReadOnly)
+	s.visitorKeys = newVisitorKeys(cfg.VisitorKey, cfg.VisitorKeyRotation)
+	if s.chaos, err = parseChaos(cfg.Chaos); err != nil { return nil, err }
+	if err := s.checkChaos(); err != nil { return nil, err }
+	return s, nil
 }
 
+// maxProfiles caps the home listing (a reasonable limit to prevent abuse)
+const maxProfiles = 500
+
+// defaultPageSize is the default page_size: profiles per page of the home listing (see pages.go).
+const defaultPageSize = 60
+
+// flushEvery controls how many cards are rendered between flushes to the client.
+const flushEvery = 25
 
+// handleHome lists the leaderboard: GET /?q=&country=&after=
+// after= is the cursor of a "Load more" link (pages.go); later pages leave out the sections.
 func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+	after, err := parseAfter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f := profileFilter{
+		Query:   strings.TrimSpace(r.URL.Query().Get("q")),
+		Country: strings.TrimSpace(r.URL.Query().Get("country")),
+		Limit:   s.settings.GetInt(settingPageSize),
+		After:   after,
+	}
+	f.PinsFirst = f.Query == "" && f.Country == ""
+	var blocks []homeBlock
+	if f.PinsFirst && f.After == nil { blocks = s.homeBlocks(r.Context()) }
+	s.writeListing(w, r, f, blocks)
+}
+
+// handleAlumni lists retired profiles: GET /alumni?q=&country=&after=
+func (s *Server) handleAlumni(w http.ResponseWriter, r *http.Request) {
+	after, err := parseAfter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	s.writeListing(w, r, profileFilter{
+		Query:   strings.TrimSpace(r.URL.Query().Get("q")),
+		Country: strings.TrimSpace(r.URL.Query().Get("country")),
+		Limit:   s.settings.GetInt(settingPageSize),
+		After:   after,
+		Status:  statusRetired,
+	}, nil)
+}
 
-	ctx := r.Context()
-	var rows *sql.Rows
-	var err error
-	// Fetch all profiles (with a reasonable limit to prevent abuse)
-	const maxProfiles = 500
-	if q == "" {
-		rows, err = s.db.QueryContext(ctx, `
-			SELECT id::string, full_name, location_country, location_city, description, votes_count, created_at, updated_at
-			FROM profiles
-			ORDER BY votes_count DESC, created_at DESC
-			LIMIT $1`, maxProfiles)
-	} else {
-		like := "%" + strings.ToLower(q) + "%"
-		rows, err = s.db.QueryContext(ctx, `
-			SELECT id::string, full_name, location_country, location_city, description, votes_count, created_at, updated_at
-			FROM profiles
-			WHERE search_text LIKE $1
-			ORDER BY votes_count DESC, created_at DESC
-			LIMIT $2`, like, maxProfiles)
+// handleProfilePage shows one profile's card in the home page shell: GET /profiles/{id}.
+// Profiles held for review are not shown.
+func (s *Server) handleProfilePage(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	status, err := s.store.ProfileStatus(r.Context(), id)
+	if errors.As(err, new(interface{ NotFound() })) || (err == nil && status == statusHeld) {
+		http.NotFound(w, r)
+		return
 	}
 	if err != nil {
 		http.Error(w, "query error", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
+	s.writeListing(w, r, profileFilter{ID: id, Limit: 1}, nil)
+}
 
+// writeListing renders the home page for f: the active leaderboard or the alumni section,
+// among the sections of blocks when set (see writeHome).
+func (s *Server) writeListing(w http.ResponseWriter, r *http.Request, f profileFilter, blocks []homeBlock) {
 	var list []Profile
-	for rows.Next() {
-		var p Profile
-		if err := rows.Scan(&p.ID, &p.FullName, &p.Country, &p.City, &p.Description, &p.Votes, &p.CreatedAt, &p.UpdatedAt); err != nil {
-			http.Error(w, "scan error", http.StatusInternalServerError)
+	var more *store.Cursor
+	if hasLeaderboard(blocks) {
+		var err error
+		if list, more, err = s.loadPage(r.Context(), f); err != nil {
+			if isQueryTimeout(err) {
+				s.writeSearchTimeout(w, r, f)
+				return
+			}
+			http.Error(w, "query error", http.StatusInternalServerError)
 			return
 		}
-		list = append(list, p)
 	}
 
-	// Compute min/max votes for CSS scaling
-	minVotes, maxVotes := 0, 0
-	if len(list) > 0 {
-		minVotes = list[0].Votes
-		maxVotes = list[0].Votes
-		for _, p := range list {
-			if p.Votes < minVotes { minVotes = p.Votes }
-			if p.Votes > maxVotes { maxVotes = p.Votes }
-		}
-		// Avoid division by zero in CSS calc when all votes are equal
-		if minVotes == maxVotes {
-			maxVotes = minVotes + 1
-		}
+	next := func(p *Profile) (bool, error) {
+		if len(list) == 0 { return false, nil }
+		*p, list = list[0], list[1:]
+		return true, nil
 	}
+	head := views.HomeHead{Query: f.Query, Country: f.Country, Alumni: f.Status == statusRetired, Single: f.ID != "", ReadOnly: s.readOnly.active(),
+		HTMXURL: s.cfg.HTMXURL, TranslateTo: s.translateTarget(r), More: nextPage(f, more)}
+	if f.PinsFirst && f.After == nil { head.Spotlight = s.todaysSpotlight() }
+	if f.ID != "" && len(list) == 1 { head.Person = s.profileLD(r, list[0]) }
+	voted, err := s.votedRecently(r.Context(), s.issueVoter(w, r))
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	if err := s.writeHome(w, head, blocks, voted, next); err != nil {
+		// Headers are already out; all we can do is log and end the page with a notice.
+		s.log.Error("render home", "request_id", requestID(r), "err", err)
+		writeStreamError(w)
+	}
+}
+
+// profileFilter narrows a leaderboard listing; see store.Filter.
+type profileFilter = store.Filter
 
-	// Fetch profiles that have received a vote in the last hour to disable buttons client-side
-	// Note: This mirrors server-side rate limiting which is per-profile (global), not per-user.
-	recent := map[string]bool{}
-	rows2, err := s.db.QueryContext(ctx, `SELECT DISTINCT profile_id::string FROM votes_recent WHERE created_at > now() - interval '60 minutes'`)
-	if err == nil {
-		defer rows2.Close()
-		for rows2.Next() {
-			var pid string
-			if err := rows2.Scan(&pid); err == nil { recent[pid] = true }
+// profileRateLimitedCol selects whether p took limit votes within cooldown.
+func profileRateLimitedCol(cooldown time.Duration, limit int) string { return store.RateLimitedCol(cooldown, limit) }
+
+const (
+	profileListFrom    = store.ListFrom
+	profileChampionCol = store.ChampionCol
+)
+
+// sqlInterval is d as an INTERVAL literal, in whole seconds.
+func sqlInterval(d time.Duration) string {
+	return fmt.Sprintf("interval '%d seconds'", int64(d/time.Second))
+}
+
+// loadProfiles lists the profiles f selects from the store, under the current vote cooldown,
+// and adds what cards show beyond the profile itself. Identical listings requested at the
+// same time share one query; the result is shared too, so callers must not modify it. The
+// queries run under the search timeout, and fail with ErrQueryTimeout past it.
+func (s *Server) loadProfiles(ctx context.Context, f profileFilter) ([]Profile, error) {
+	return s.profileFlight.do(ctx, fmt.Sprintf("%q|%q|%q|%q|%q|%d|%d|%q|%t|%t|%q", f.ID, f.IDs, f.Query, f.Country, f.City, f.MinVotes, f.Limit, cursorKey(f.After), f.PinsFirst, f.Newest, f.Status), func(ctx context.Context) (_ []Profile, err error) {
+		ctx, cancel := s.searchContext(ctx)
+		defer cancel()
+		defer func() { err = queryTimeout(err) }()
+		f.Cooldown, f.VoteCap = s.settings.GetDuration(settingVoteCooldown), s.settings.GetInt(settingVoteCap)
+		list, err := s.store.ListProfiles(ctx, f)
+		if err != nil { return nil, err }
+		if s.settings.GetBool(settingSparklines) {
+			if err := s.loadTrends(ctx, list); err != nil { return nil, err }
 		}
-	} // if it fails, we just don't disable in UI; server still enforces
+		if err := s.loadPlaceholders(ctx, list); err != nil { return nil, err }
+		if err := s.loadRankDeltas(ctx, list); err != nil { return nil, err }
+		return list, s.loadDescriptionLangs(ctx, list)
+	})
+}
 
-	data := map[string]any{
-		"Profiles":       list,
-		"Query":          q,
-		"MinVotes":       minVotes,
-		"MaxVotes":       maxVotes,
-		"RateLimitedIDs": recent,
-	}
-	if err := s.tmpl.ExecuteTemplate(w, "home.gohtml", data); err != nil {
-		http.Error(w, "template error", http.StatusInternalServerError)
-		return
+// writeHome streams the home page: the shell is flushed first, then each block of blocks in
+// order, then the footer. The leaderboard block streams cards as next yields them, then a tail
+// carrying the vote range for CSS scaling (only known once every row was seen); nil blocks
+// are the leaderboard alone. voted are the profiles the viewer can't vote for again yet.
+func (s *Server) writeHome(w http.ResponseWriter, head views.HomeHead, blocks []homeBlock, voted map[string]bool, next func(*Profile) (bool, error)) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fw := newFlushWriter(w)
+	defer fw.Flush()
+
+	if err := s.tmpl.ExecuteTemplate(fw, "home_head", head); err != nil { return err }
+	fw.Flush()
+
+	if blocks == nil { blocks = []homeBlock{{}} }
+	o := cardOptions{translateTo: head.TranslateTo, voteTokens: true, voted: voted, single: head.Single}
+	for _, b := range blocks {
+		var err error
+		if b.section == nil {
+			err = s.writeLeaderboard(fw, head, o, next)
+		} else {
+			err = s.writeSection(fw, b, o)
+		}
+		if err != nil { return err }
 	}
+	return s.tmpl.ExecuteTemplate(fw, "home_foot", nil)
 }
 
-func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-		return
+// writeLeaderboard writes the leaderboard cloud of the home page.
+func (s *Server) writeLeaderboard(fw *flushWriter, head views.HomeHead, o cardOptions, next func(*Profile) (bool, error)) error {
+	if err := s.tmpl.ExecuteTemplate(fw, "home_cloud", nil); err != nil { return err }
+	o.highlight = head.Query
+	tail, err := s.writeCards(fw, o, next)
+	tail.Alumni, tail.More = head.Alumni, head.More
+	if terr := s.tmpl.ExecuteTemplate(fw, "home_tail", tail); terr != nil && err == nil { err = terr }
+	return err
+}
+
+// writeSection writes a section other than the leaderboard with its loaded cards.
+func (s *Server) writeSection(fw *flushWriter, b homeBlock, o cardOptions) error {
+	if err := s.tmpl.ExecuteTemplate(fw, "section_open", b.section); err != nil { return err }
+	cards := b.cards
+	next := func(p *Profile) (bool, error) {
+		if len(cards) == 0 { return false, nil }
+		*p, cards = cards[0], cards[1:]
+		return true, nil
 	}
-	if err := s.tmpl.ExecuteTemplate(w, "add.gohtml", nil); err != nil {
-		http.Error(w, "template error", http.StatusInternalServerError)
+	if _, err := s.writeCards(fw, o, next); err != nil { return err }
+	return s.tmpl.ExecuteTemplate(fw, "section_close", nil)
+}
+
+// cardOptions are the per-request parts of the cards writeCards renders.
+type cardOptions struct {
+	translateTo string // viewer's language for the translate link
+	highlight   string // search query to mark in names and descriptions
+	// voteTokens gives vote forms one-time tokens; a response shared through a cache would
+	// hand one token to many visitors, so cacheable responses leave it off.
+	voteTokens bool
+	voted      map[string]bool // profiles the viewer voted for within the cooldown
+	single     bool            // the profile's own page, which shows more of it
+}
+
+// writeCards renders a card per profile next yields, flushing every flushEvery cards, and
+// returns the vote range the cards are scaled by.
+func (s *Server) writeCards(fw *flushWriter, o cardOptions, next func(*Profile) (bool, error)) (views.HomeTail, error) {
+	card := s.tmpl.Lookup("home_card")
+	tail := views.HomeTail{}
+	var p Profile
+	var pv views.ProfileView
+	var err error
+	for {
+		var ok bool
+		if ok, err = next(&p); !ok || err != nil { break }
+		if tail.Count == 0 || p.Votes < tail.MinVotes { tail.MinVotes = p.Votes }
+		if tail.Count == 0 || p.Votes > tail.MaxVotes { tail.MaxVotes = p.Votes }
+		tail.Count++
+		pv = cardView(p, o.translateTo)
+		pv.Highlight = o.highlight
+		if o.voteTokens && !p.Retired { pv.VoteToken = newVoteToken() }
+		pv.Voted = o.voted[p.ID]
+		if o.single { pv.PhotoTaken = p.PhotoTaken }
+		if err = card.Execute(fw, &pv); err != nil { break }
+		if tail.Count%flushEvery == 0 { fw.Flush() }
 	}
+	// Avoid division by zero in CSS calc when all votes are equal
+	if tail.MinVotes == tail.MaxVotes { tail.MaxVotes = tail.MinVotes + 1 }
+	return tail, err
 }
 
-func (s *Server) handleCreateProfile(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.NotFound(w, r)
+// flushWriter buffers template output and pushes it to the client on Flush when the
+// ResponseWriter supports it, so the browser can start on the shell and early cards.
+type flushWriter struct {
+	bw *bufio.Writer
+	f  http.Flusher
+}
+
+func newFlushWriter(w http.ResponseWriter) *flushWriter {
+	f, _ := w.(http.Flusher)
+	return &flushWriter{bw: bufio.NewWriterSize(w, 16*1024), f: f}
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) { return fw.bw.Write(p) }
+
+func (fw *flushWriter) Flush() {
+	if err := fw.bw.Flush(); err != nil { return }
+	if fw.f != nil { fw.f.Flush() }
+}
+
+// maxPooledBuffer keeps unusually large renders from pinning memory in the pool.
+const maxPooledBuffer = 1 << 20
+
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// render executes template name with data, which should be the matching type from internal/views.
+func (s *Server) render(w http.ResponseWriter, name string, data any) {
+	s.renderStatus(w, http.StatusOK, name, data)
+}
+
+func (s *Server) renderStatus(w http.ResponseWriter, status int, name string, data any) {
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer { bufPool.Put(buf) }
+	}()
+	if err := s.tmpl.ExecuteTemplate(&cappedWriter{buf, maxRenderBytes}, name, data); err != nil {
+		s.log.Error("render", "template", name, "request_id", w.Header().Get(requestIDHeader), "err", err)
+		writeErrorPage(w)
 		return
 	}
-	if err := r.ParseMultipartForm(maxUploadAcceptBytes); err != nil {
-		http.Error(w, "bad form", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+// handleReadyz reports the startup connection state until the database was reached once,
+// then pings it. A draining server is never ready.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		http.Error(w, "draining", http.StatusServiceUnavailable)
 		return
 	}
-	fullName := strings.TrimSpace(r.FormValue("full_name"))
-	country := strings.TrimSpace(r.FormValue("country"))
-	city := strings.TrimSpace(r.FormValue("city"))
-	desc := strings.TrimSpace(r.FormValue("description"))
-	if fullName == "" || country == "" || city == "" {
-		http.Error(w, "missing required fields", http.StatusBadRequest)
+	if ok, msg := s.dbState.status(); !ok {
+		http.Error(w, msg, http.StatusServiceUnavailable)
 		return
 	}
-	if len(desc) > 160 {
-		http.Error(w, "description too long", http.StatusBadRequest)
+	if err := s.db.PingContext(r.Context()); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
+}
 
-	file, header, err := r.FormFile("photo")
-	if err != nil {
-		http.Error(w, "photo required", http.StatusBadRequest)
+func (s *Server) handleAdd(w http.ResponseWriter, r *http.Request) {
+	s.render(w, "add.gohtml", views.AddView{ReadOnly: s.readOnly.active(), Closed: !s.settings.GetBool(settingSubmissionsOpen),
+		Captcha: s.captchaView(r, false)})
+}
+
+func (s *Server) handleCreateProfile(w http.ResponseWriter, r *http.Request) {
+	if !s.settings.GetBool(settingSubmissionsOpen) {
+		s.renderStatus(w, http.StatusForbidden, "add.gohtml", views.AddView{Closed: true})
 		return
 	}
-	defer file.Close()
-	if header.Size > maxUploadAcceptBytes {
-		http.Error(w, "file too large", http.StatusBadRequest)
+	if err := parseUploadForm(w, r); err != nil {
+		writeBadUpload(w, err)
 		return
 	}
-
-	// Read uploaded bytes with a cap
-	var buf bytes.Buffer
-	if _, err := io.CopyN(&buf, file, maxUploadAcceptBytes+1); err != nil && !errors.Is(err, io.EOF) {
-		http.Error(w, "read error", http.StatusBadRequest)
+	sub := profileSubmission{FullName: r.FormValue("full_name"), Country: r.FormValue("country"), City: r.FormValue("city"),
+		Description: r.FormValue("description"), PhotoAlt: r.FormValue("photo_alt"), PhotoOK: r.FormValue("photo_ok") != "", ShowPhotoDate: r.FormValue("show_photo_date") != "",
+		NameOK: r.FormValue("name_ok") != "", photo: func() ([]byte, *multipart.FileHeader, error) { return readPhoto(r) }}
+	c, err := s.createProfile(r, sub)
+	var warnings ErrorPhotoWarnings
+	var dup ErrorDuplicateName
+	switch {
+	case err == nil:
+	case errors.As(err, new(interface{ CaptchaRequired() })):
+		if strings.Contains(r.Header.Get("Accept"), "application/json") {
+			s.writeCaptchaRequiredJSON(w)
+			return
+		}
+		s.renderStatus(w, http.StatusForbidden, "add.gohtml", views.AddView{Form: addForm(sub), Captcha: s.captchaView(r, true)})
 		return
-	}
-	if buf.Len() > maxUploadAcceptBytes {
-		http.Error(w, "file too large", http.StatusBadRequest)
+	case errors.As(err, &warnings):
+		s.writePhotoWarnings(w, r, addForm(sub), warnings)
 		return
-	}
-
-	processed, contentType, err := processImageToWebP(buf.Bytes(), maxImageWidth, maxStoredImageBytes)
-	if err != nil {
-		http.Error(w, "image processing failed", http.StatusBadRequest)
+	case errors.As(err, &dup):
+		s.writeDuplicateName(w, r, addForm(sub), dup)
 		return
-	}
-
-	// Insert profile
-	err = withTx(r.Context(), s.db, func(tx *sql.Tx) error {
-		var id string
-		err := tx.QueryRowContext(r.Context(), `
-			INSERT INTO profiles (full_name, location_country, location_city, description, photo_webp, photo_content_type)
-			VALUES ($1,$2,$3,$4,$5,$6)
-			RETURNING id::string
-		`, fullName, country, city, desc, processed, contentType).Scan(&id)
-		if err != nil { return err }
-		return nil
-	})
-	if err != nil {
+	case errors.As(err, new(interface{ QuotaExceeded() })):
+		s.writeQuotaExceeded(w, r)
+		return
+	case errors.As(err, new(interface{ BadUpload() })):
+		writeBadUpload(w, err)
+		return
+	case errors.As(err, new(interface{ InvalidProfile() })), errors.As(err, new(interface{ Moderated() })),
+		errors.As(err, new(interface{ InvalidImage() })):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+		return
+	default:
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
 	}
+	if c.Status == statusHeld {
+		s.renderStatus(w, http.StatusAccepted, "add.gohtml", views.AddView{Held: true})
+		return
+	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func (s *Server) handleProfileSubroutes(w http.ResponseWriter, r *http.Request) {
-	// Expect /profiles/{id}/photo or /profiles/{id}/vote
-	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/profiles/"), "/")
-	if len(parts) < 2 { http.NotFound(w, r); return }
-	id, action := parts[0], parts[1]
-	switch action {
-	case "photo":
-		s.servePhoto(w, r, id)
-	case "vote":
-		if r.Method != http.MethodPost { http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return }
-		s.incrementVote(w, r, id)
-	default:
-		http.NotFound(w, r)
+// addForm fills the add form back in from a submission.
+func addForm(sub profileSubmission) views.AddForm {
+	return views.AddForm{FullName: strings.TrimSpace(sub.FullName), Country: strings.TrimSpace(sub.Country),
+		City: strings.TrimSpace(sub.City), Description: strings.TrimSpace(sub.Description), PhotoAlt: strings.TrimSpace(sub.PhotoAlt),
+		ShowPhotoDate: sub.ShowPhotoDate, NameOK: sub.NameOK}
+}
+
+// writePhotoWarnings answers 422 with the photo's quality warnings instead of saving the
+// profile: the add form again, filled in, or JSON for API clients. Resubmitting with
+// photo_ok set keeps the photo.
+func (s *Server) writePhotoWarnings(w http.ResponseWriter, r *http.Request, form views.AddForm, warnings []imaging.Warning) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") || strings.HasPrefix(r.URL.Path, "/api/") {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": ErrorPhotoWarnings(warnings).Error(), "warnings": warnings})
+		return
 	}
+	v := views.AddView{Form: form}
+	for _, wn := range warnings { v.Warnings = append(v.Warnings, views.PhotoWarning{Code: wn.Code, Message: wn.Message}) }
+	s.renderStatus(w, http.StatusUnprocessableEntity, "add.gohtml", v)
 }
 
-func (s *Server) servePhoto(w http.ResponseWriter, r *http.Request, id string) {
-	var b []byte
-	var ct string
-	var updated time.Time
-	err := s.db.QueryRowContext(r.Context(), `SELECT photo_webp, photo_content_type, updated_at FROM profiles WHERE id = $1`, id).Scan(&b, &ct, &updated)
+// writeDuplicateName answers 409 for a submission whose name is taken in its city: the add
+// form again, filled in and listing the existing profiles, or JSON for API clients. Under
+// the warn policy resubmitting with name_ok set adds it anyway.
+func (s *Server) writeDuplicateName(w http.ResponseWriter, r *http.Request, form views.AddForm, dup ErrorDuplicateName) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") || strings.HasPrefix(r.URL.Path, "/api/") {
+		existing := dup.Existing
+		if existing == nil { existing = []DuplicateProfile{} }
+		writeJSON(w, http.StatusConflict, map[string]any{"error": dup.Error(), "existing": existing, "can_override": !dup.Enforced})
+		return
+	}
+	v := views.AddView{Form: form, Duplicate: &views.DuplicateName{Enforced: dup.Enforced}}
+	for _, d := range dup.Existing {
+		v.Duplicate.Existing = append(v.Duplicate.Existing, views.Duplicate{URL: d.URL, FullName: d.FullName, Country: d.Country, City: d.City})
+	}
+	s.renderStatus(w, http.StatusConflict, "add.gohtml", v)
+}
+
+func (s *Server) handlePhoto(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	size, ok := photoSize(r.URL.Query().Get("size"))
+	if !ok {
+		http.Error(w, "unknown photo size (thumb, card or full)", http.StatusBadRequest)
+		return
+	}
+	scope, maxAge := "public", 2592000 // 30 days
+	embed := r.URL.Query().Get("embed") != ""
+	if s.cfg.PhotoSigningKey != "" || embed {
+		check := s.checkPhotoSig
+		if embed { check = s.checkEmbedSig }
+		expires, ok := check(id, r.URL.Query())
+		if !ok {
+			http.Error(w, "link expired or invalid", http.StatusForbidden)
+			return
+		}
+		// Signed URLs must not outlive their expiry in shared caches.
+		scope, maxAge = "private", max(0, int(time.Until(expires).Seconds()))
+	}
+	if !embed && !s.photoRefererAllowed(r) {
+		s.photoTraffic.add(id, photoHit{blocked: 1})
+		s.log.Debug("photo hotlink blocked", "profile", id, "referer", refererHost(r), "request_id", requestID(r))
+		http.Error(w, "photos may not be embedded on other sites", http.StatusForbidden)
+		return
+	}
+	ph, err := s.loadPhoto(r.Context(), id)
 	if err != nil {
 		http.NotFound(w, r)
 		return
 	}
-	etag := fmt.Sprintf("\"%s-%d\"", id, updated.Unix())
+	if ph.hidden {
+		writeHiddenPhoto(w, r, fmt.Sprintf("\"%s-%d-hidden\"", id, ph.updated.Unix()))
+		return
+	}
+	if size != sizeFull {
+		data, contentType, err := s.store.PhotoVariant(r.Context(), id, size)
+		if err == nil {
+			s.writePhotoVariant(w, r, id, fmt.Sprintf("\"%s-%d-%s\"", id, ph.updated.Unix(), size), fmt.Sprintf("%s, max-age=%d", scope, maxAge), data, contentType)
+			return
+		}
+		if !errors.As(err, new(interface{ NotFound() })) { s.log.Warn("photo variant", "profile", id, "size", size, "err", err) }
+		// Not made yet: the full photo will do until the photo_variants job gets to it.
+		maxAge = min(maxAge, variantPendingMaxAge)
+	}
+	etag := fmt.Sprintf("\"%s-%d\"", id, ph.updated.Unix())
 	w.Header().Set("ETag", etag)
-	w.Header().Set("Cache-Control", "public, max-age=2592000") // 30 days
-	w.Header().Set("Content-Type", ct)
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, maxAge))
+	w.Header().Set("Content-Type", ph.contentType)
 	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		s.photoTraffic.add(id, photoHit{requests: 1, notModified: 1})
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
+	var object io.ReadCloser
+	if ph.key != "" && r.Method != http.MethodHead {
+		// Opened before the status goes out: a missing object is an error, not an empty photo.
+		if object, err = s.store.OpenPhoto(r.Context(), ph.key); err != nil {
+			s.log.Error("open photo object", "profile", id, "key", ph.key, "err", err)
+			http.Error(w, "photo unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		defer object.Close()
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(ph.size))
 	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(b)
+	if r.Method == http.MethodHead { return }
+	cw := &countingWriter{w: newDeadlineWriter(w, s.cfg.PhotoWriteTimeout)}
+	defer func() { s.photoTraffic.add(id, photoHit{requests: 1, bytes: cw.n}) }()
+	if object != nil {
+		err = copyPhoto(cw, object)
+	} else {
+		err = s.streamPhoto(r.Context(), cw, id, ph)
+	}
+	if err != nil {
+		// The status is out; a short body is all the client will notice.
+		s.log.Warn("stream photo", "profile", id, "err", err)
+	}
 }
 
-func (s *Server) incrementVote(w http.ResponseWriter, r *http.Request, id string) {
-	err := withTx(r.Context(), s.db, func(tx *sql.Tx) error {
-		var exists int
-		err := tx.QueryRowContext(r.Context(), `SELECT 1 FROM votes_recent WHERE profile_id = $1 AND created_at > now() - interval '60 minutes' LIMIT 1`, id).Scan(&exists)
-		if err != nil && err != sql.ErrNoRows { return err }
-		if err == nil && exists == 1 {
-			return ErrRateLimited
-		}
-		if _, err := tx.ExecContext(r.Context(), `INSERT INTO votes_recent (profile_id) VALUES ($1)`, id); err != nil { return err }
-		if _, err := tx.ExecContext(r.Context(), `UPDATE profiles SET votes_count = votes_count + 1, updated_at = now() WHERE id = $1`, id); err != nil { return err }
-		return nil
+// photo is what a photo response needs before its bytes: the bytes themselves are streamed.
+type photo struct {
+	contentType string
+	updated     time.Time
+	size        int
+	hidden      bool   // a takedown request hides it; see takedown.go
+	key         string // its object in object storage; "" when it is in the database
+}
+
+// loadPhoto fetches a profile photo's metadata; concurrent requests for the same id share
+// one query.
+func (s *Server) loadPhoto(ctx context.Context, id string) (photo, error) {
+	return s.photoFlight.do(ctx, id, func(ctx context.Context) (photo, error) {
+		sp, err := s.store.GetPhoto(ctx, id)
+		return photo{contentType: sp.ContentType, updated: sp.Updated, size: sp.Size, hidden: sp.Hidden, key: sp.Key}, err
 	})
+}
+
+// photoChunkSize is how much of a photo one store read returns (see store.PhotoChunk); it
+// bounds what a photo request holds in memory however big the photo or busy the endpoint.
+const photoChunkSize = 64 << 10
+
+// photoChunks recycles chunk buffers between photo requests.
+var photoChunks = sync.Pool{New: func() any { b := make([]byte, 0, photoChunkSize); return &b }}
+
+// streamPhoto writes the photo bytes of ph to w, photoChunkSize at a time. Each chunk is
+// read for the photo version in ph (photo_updated_at, which votes don't move), so a photo
+// rewritten mid-stream ends the response early instead of mixing two images.
+func (s *Server) streamPhoto(ctx context.Context, w io.Writer, id string, ph photo) error {
+	bp := photoChunks.Get().(*[]byte)
+	defer photoChunks.Put(bp)
+	for off := 0; off < ph.size; off += photoChunkSize {
+		var err error
+		*bp, err = s.store.PhotoChunk(ctx, id, ph.updated, off, photoChunkSize, *bp)
+		if err != nil { return err }
+		if len(*bp) == 0 { return io.ErrUnexpectedEOF }
+		if _, err := w.Write(*bp); err != nil { return err }
+	}
+	return nil
+}
+
+// copyPhoto writes a photo object to w through a pooled chunk buffer, like streamPhoto.
+func copyPhoto(w io.Writer, object io.Reader) error {
+	bp := photoChunks.Get().(*[]byte)
+	defer photoChunks.Put(bp)
+	_, err := io.CopyBuffer(w, object, (*bp)[:cap(*bp)])
+	return err
+}
+
+func (s *Server) handleVote(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	err := s.castScreenedVote(r, id, r.PostFormValue("vote_token"))
+	// Challenged voters solve the CAPTCHA on the confirmation page.
+	if errors.As(err, new(interface{ CaptchaRequired() })) {
+		if isHTMX(r) {
+			w.Header().Set("HX-Redirect", voteConfirmURL(id))
+			return
+		}
+		http.Redirect(w, r, voteConfirmURL(id), http.StatusSeeOther)
+		return
+	}
+	// A resubmitted form was counted the first time; answer it like that first submission.
+	if errors.As(err, new(interface{ DuplicateVote() })) { err = nil }
+	// htmx swaps the card in place; a card the voter can't vote for again yet comes back with
+	// its button disabled, a retired one without it.
+	if isHTMX(r) && (err == nil || errors.As(err, new(interface{ RateLimited() })) || errors.As(err, new(interface{ Retired() }))) {
+		s.writeCardFragment(w, r, id, false)
+		return
+	}
 	if err != nil {
+		if errors.Is(err, ErrVotedRecently) {
+			http.Error(w, "You already voted for this exhibit, try again later", http.StatusTooManyRequests)
+			return
+		}
 		if errors.As(err, new(interface{ RateLimited() })) {
 			http.Error(w, "Too many votes for this exhibit, try again later", http.StatusTooManyRequests)
 			return
 		}
+		if errors.As(err, new(interface{ NotFound() })) {
+			http.NotFound(w, r)
+			return
+		}
+		if errors.As(err, new(interface{ Retired() })) {
+			http.Error(w, "This exhibit is retired and no longer takes votes", http.StatusConflict)
+			return
+		}
+		if errors.As(err, new(interface{ ReadOnly() })) {
+			writeReadOnly(w, r)
+			return
+		}
 		http.Error(w, "db error", http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	target := voteReceiptURL(id)
+	if s.cfg.VoteRedirect { target = "/" }
+	http.Redirect(w, r, target, http.StatusSeeOther)
 }
 
-
-// processImageToWebP attempts to decode JPEG/PNG, resize to max width, and encode as JPEG as a pure-Go fallback
-// Note: Without CGO/libwebp, high-quality WebP encoding isn't available in stdlib. We'll use JPEG with quality tuning
-// but still set content type properly if/when a pure-Go webp encoder is added.
-func processImageToWebP(input []byte, maxWidth int, maxBytes int) ([]byte, string, error) {
-	img, format, err := image.Decode(bytes.NewReader(input))
-	if err != nil { return nil, "", fmt.Errorf("decode: %w", err) }
-	_ = format
-	// Simple nearest-neighbor resize to max width
-	b := img.Bounds()
-	w := b.Dx()
-	h := b.Dy()
-	if w > maxWidth {
-		newW := maxWidth
-		newH := int(float64(h) * float64(newW) / float64(w))
-		img = resizeNearest(img, newW, newH)
-	}
-	// Iterate jpeg quality to fit under maxBytes
-	for q := 80; q >= 40; q -= 5 {
-		var out bytes.Buffer
-		if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: q}); err != nil {
-			return nil, "", err
-		}
-		if out.Len() <= maxBytes {
-			return out.Bytes(), "image/jpeg", nil
+// castVote records one vote for profile id by v, enforcing the vote limits (see voters.go).
+// A valid form token (see votetoken.go) that was already used fails with ErrDuplicateVote.
+func (s *Server) castVote(ctx context.Context, id, token string, v voter) error {
+	if err := s.writable(); err != nil { return err }
+	if !validVoteToken(token) { token = "" }
+	err := s.store.InTx(ctx, func(ctx context.Context) error {
+		if token != "" {
+			used, err := s.store.VoteExists(ctx, token)
+			if err != nil { return err }
+			if used { return ErrDuplicateVote }
 		}
-	}
-	// Final attempt lower quality
-	var out bytes.Buffer
-	_ = jpeg.Encode(&out, img, &jpeg.Options{Quality: 35})
-	if out.Len() > maxBytes {
-		return nil, "", fmt.Errorf("cannot fit image under %d bytes", maxBytes)
-	}
-	return out.Bytes(), "image/jpeg", nil
-}
-
-// Very simple nearest-neighbor resize
-func resizeNearest(src image.Image, newW, newH int) image.Image {
-	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
-	b := src.Bounds()
-	w := b.Dx()
-	h := b.Dy()
-	for y := 0; y < newH; y++ {
-		for x := 0; x < newW; x++ {
-			sx := b.Min.X + int(float64(x)*float64(w)/float64(newW))
-			sy := b.Min.Y + int(float64(y)*float64(h)/float64(newH))
-			dst.Set(x, y, src.At(sx, sy))
-		}
-	}
-	return dst
+		if err := s.checkVoteLimits(ctx, id, v); err != nil { return err }
+		return s.recordVote(ctx, id, token, v)
+	})
+	if err == nil { s.voteRecorded(ctx) }
+	return err
 }
 
 func withTx(ctx context.Context, db *sql.DB, fn func(*sql.Tx) error) error {
@@ -416,10 +1053,13 @@ func logMiddleware(l *slog.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		next.ServeHTTP(w, r)
-		l.Info("req", "method", r.Method, "path", r.URL.Path, "dur", time.Since(start))
+		l.Info("req", "method", r.Method, "path", r.URL.Path, "dur", time.Since(start), "request_id", requestID(r))
 	})
 }
 
+// secretHeaders are the headers debugRequestLogger never logs the values of.
+var secretHeaders = map[string]bool{"Authorization": true, "Cookie": true, "Set-Cookie": true}
+
 // debugRequestLogger logs HTTP requests (without body) including headers and basic metadata when enabled.
 func debugRequestLogger(l *slog.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -427,7 +1067,10 @@ func debugRequestLogger(l *slog.Logger, next http.Handler) http.Handler {
 		for k, v := range r.Header {
 			// Copy headers; avoid logging very large values
 			if len(v) > 0 {
-				if len(strings.Join(v, ",")) > 2048 {
+				if secretHeaders[k] {
+					// Credentials (the admin token, the signed voter cookie) show only as set, as on /admin/debug/config.
+					headers[k] = []string{"(set)"}
+				} else if len(strings.Join(v, ",")) > 2048 {
 					headers[k] = []string{"<truncated>"}
 				} else {
 					headers[k] = v
@@ -458,3 +1101,11 @@ func getenv(k, def string) string {
 	if v := os.Getenv(k); v != "" { return v }
 	return def
 }
+
+func getenvDuration(k string, def time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" { return def }
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 { return def }
+	return d
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// discardWriter is a ResponseWriter that drops the body so benchmarks measure rendering only.
+type discardWriter struct{ h http.Header }
+
+func (d *discardWriter) Header() http.Header         { return d.h }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
+
+func benchProfiles(n int) []Profile {
+	list := make([]Profile, n)
+	now := time.Now()
+	for i := range list {
+		list[i] = Profile{
+			ID:          fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			FullName:    fmt.Sprintf("Exhibit %d", i),
+			Country:     "Country",
+			City:        "City",
+			Description: "A tasteful 160-character reminder",
+			Votes:       n - i,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			RateLimited: i%7 == 0,
+		}
+	}
+	return list
+}
+
+func BenchmarkRenderHome500(b *testing.B) {
+	tmpl, err := parseTemplates()
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := &Server{tmpl: tmpl}
+	list := benchProfiles(maxProfiles)
+	w := &discardWriter{h: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := 0
+		next := func(p *Profile) (bool, error) {
+			if j == len(list) {
+				return false, nil
+			}
+			*p = list[j]
+			j++
+			return true, nil
+		}
+		if err := s.writeHome(w, views.HomeHead{}, nil, nil, next); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHandlePhotoStreamsFromStore(t *testing.T) {
+	mem := store.NewMemory()
+	data := bytes.Repeat([]byte("0123456789"), photoChunkSize/4) // spans three chunks
+	mem.Put(Profile{ID: "p1"}, "", data, "image/jpeg")
+	mem.Put(Profile{ID: "p2"}, "", []byte("gone"), "image/jpeg")
+	mem.HidePhoto("p2")
+	s := &Server{store: mem, photoFlight: newFlightGroup[photo]("photo"), log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	get := func(id, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/profiles/"+id+"/photo", nil)
+		r.SetPathValue("id", id)
+		if etag != "" { r.Header.Set("If-None-Match", etag) }
+		w := httptest.NewRecorder()
+		s.handlePhoto(w, r)
+		return w
+	}
+
+	w := get("p1", "")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) || w.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("GET = %d, %d bytes, %q", w.Code, w.Body.Len(), w.Header().Get("Content-Type"))
+	}
+	if w := get("p1", w.Header().Get("ETag")); w.Code != http.StatusNotModified { t.Errorf("revalidation = %d", w.Code) }
+	if w := get("p2", ""); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/svg+xml" { t.Errorf("hidden photo = %d %q", w.Code, w.Header().Get("Content-Type")) }
+	if w := get("nope", ""); w.Code != http.StatusNotFound { t.Errorf("missing photo = %d", w.Code) }
+}
+
+// voteWriter casts a vote after the first chunk written to it.
+type voteWriter struct {
+	bytes.Buffer
+	vote func()
+}
+
+func (w *voteWriter) Write(p []byte) (int, error) {
+	if w.Len() == 0 { w.vote() }
+	return w.Buffer.Write(p)
+}
+
+// A vote bumps the profile's updated_at, but not the photo's version: a response streaming the
+// photo goes on to the end, and the ETag stays.
+func TestStreamPhotoAcrossVote(t *testing.T) {
+	mem := store.NewMemory()
+	data := bytes.Repeat([]byte("0123456789"), photoChunkSize/4)
+	mem.Put(Profile{ID: "p1", UpdatedAt: time.Now().Add(-time.Hour)}, "", data, "image/jpeg")
+	s := &Server{store: mem, photoFlight: newFlightGroup[photo]("photo"), log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ctx := context.Background()
+	ph, err := s.loadPhoto(ctx, "p1")
+	if err != nil { t.Fatal(err) }
+
+	w := &voteWriter{vote: func() {
+		if err := s.castVote(ctx, "p1", "", voter{}); err != nil { t.Error(err) }
+	}}
+	if err := s.streamPhoto(ctx, w, "p1", ph); err != nil || !bytes.Equal(w.Bytes(), data) { t.Fatalf("streamPhoto = %d bytes, %v", w.Len(), err) }
+	if n := votesOf(t, mem, "p1"); n != 1 { t.Errorf("votes = %d", n) }
+	if after, err := s.loadPhoto(ctx, "p1"); err != nil || !after.updated.Equal(ph.updated) { t.Errorf("photo version after a vote = %v, was %v (%v)", after.updated, ph.updated, err) }
+}
+
+func TestDebugRequestLoggerHidesCredentials(t *testing.T) {
+	var buf bytes.Buffer
+	h := debugRequestLogger(slog.New(slog.NewTextHandler(&buf, nil)), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	r := httptest.NewRequest("GET", "/admin/debug/config", nil)
+	r.Header.Set("Authorization", "Bearer admin-secret")
+	r.Header.Set("Cookie", "voter=cookie.signed-secret")
+	r.Header.Set("User-Agent", "curl/8")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	out := buf.String()
+	for _, secret := range []string{"admin-secret", "signed-secret"} {
+		if bytes.Contains(buf.Bytes(), []byte(secret)) { t.Errorf("log leaks %q: %s", secret, out) }
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("curl/8")) { t.Errorf("log lost the other headers: %s", out) }
+}
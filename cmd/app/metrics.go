@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+)
+
+// Image pipeline metrics: how long each stage of processing an upload takes (decode, resize,
+// inspect, and encode once per JPEG quality attempt), how big the stored photos come out, and
+// how many uploads of each format succeed or fail, and why. They are on /debug/vars under
+// "imaging" and on GET /debug/metrics in the Prometheus text format, for scraping with the admin
+// token as bearer token.
+
+// stageBuckets are upper bounds in seconds for stage durations; sizeBuckets in bytes for
+// stored photos, up to imaging.MaxBytes.
+var (
+	stageBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	sizeBuckets  = []float64{16 << 10, 32 << 10, 64 << 10, 128 << 10, 256 << 10, 512 << 10, 1 << 20}
+)
+
+// histogram counts observations into fixed cumulative buckets, like a Prometheus histogram.
+type histogram struct {
+	bounds []float64
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; the last is +Inf
+	sum    float64
+	n      uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i, _ := slices.BinarySearch(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.n++
+}
+
+// histogramSnapshot is a histogram at one moment, with cumulative bucket counts.
+type histogramSnapshot struct {
+	Buckets []uint64 `json:"buckets"` // observations <= each bound, then all of them (+Inf)
+	Sum     float64  `json:"sum"`
+	Count   uint64   `json:"count"`
+}
+
+func (h *histogram) snapshot() histogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := histogramSnapshot{Buckets: make([]uint64, len(h.counts)), Sum: h.sum, Count: h.n}
+	var c uint64
+	for i, n := range h.counts {
+		c += n
+		s.Buckets[i] = c
+	}
+	return s
+}
+
+// metricFamily is one named metric with a series per label set, e.g. `stage="encode",quality="80"`.
+// Series appear on first use.
+type metricFamily struct {
+	name, help, kind string // kind is histogram or counter
+	bounds           []float64
+	mu               sync.Mutex
+	hists            map[string]*histogram
+	counters         map[string]uint64
+}
+
+func (f *metricFamily) observe(labels string, v float64) {
+	f.mu.Lock()
+	h := f.hists[labels]
+	if h == nil {
+		if f.hists == nil { f.hists = map[string]*histogram{} }
+		h = newHistogram(f.bounds)
+		f.hists[labels] = h
+	}
+	f.mu.Unlock()
+	h.observe(v)
+}
+
+func (f *metricFamily) inc(labels string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.counters == nil { f.counters = map[string]uint64{} }
+	f.counters[labels]++
+}
+
+// labelSets returns the family's label sets in order, for stable output.
+func (f *metricFamily) labelSets() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for l := range f.hists { out = append(out, l) }
+	for l := range f.counters { out = append(out, l) }
+	slices.Sort(out)
+	return out
+}
+
+// writePrometheus writes the family in the Prometheus text exposition format.
+func (f *metricFamily) writePrometheus(w io.Writer) {
+	sets := f.labelSets()
+	if len(sets) == 0 { return }
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, l := range sets {
+		if f.kind == "counter" {
+			f.mu.Lock()
+			n := f.counters[l]
+			f.mu.Unlock()
+			fmt.Fprintf(w, "%s%s %d\n", f.name, braces(l), n)
+			continue
+		}
+		f.mu.Lock()
+		s := f.hists[l].snapshot()
+		f.mu.Unlock()
+		sep := ","
+		if l == "" { sep = "" }
+		for i, c := range s.Buckets {
+			le := "+Inf"
+			if i < len(f.bounds) { le = strconv.FormatFloat(f.bounds[i], 'g', -1, 64) }
+			fmt.Fprintf(w, "%s_bucket{%s%sle=%q} %d\n", f.name, l, sep, le, c)
+		}
+		fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", f.name, braces(l), strconv.FormatFloat(s.Sum, 'g', -1, 64), f.name, braces(l), s.Count)
+	}
+}
+
+// braces wraps a label set for a sample line; an empty one is left out.
+func braces(labels string) string {
+	if labels == "" { return "" }
+	return "{" + labels + "}"
+}
+
+// expvarValue is the family for /debug/vars: series by label set, with the bucket bounds.
+func (f *metricFamily) expvarValue() any {
+	series := map[string]any{}
+	for _, l := range f.labelSets() {
+		f.mu.Lock()
+		if h := f.hists[l]; h != nil {
+			f.mu.Unlock()
+			series[l] = h.snapshot()
+			continue
+		}
+		series[l] = f.counters[l]
+		f.mu.Unlock()
+	}
+	if f.kind == "counter" { return series }
+	return map[string]any{"bounds": f.bounds, "series": series}
+}
+
+// pipelineMetrics implements imaging.Observer.
+type pipelineMetrics struct {
+	stages  *metricFamily
+	sizes   *metricFamily
+	results *metricFamily
+}
+
+func newPipelineMetrics() *pipelineMetrics {
+	return &pipelineMetrics{
+		stages: &metricFamily{name: "bestfriends_image_stage_duration_seconds", kind: "histogram", bounds: stageBuckets,
+			help: "Time spent in each image pipeline stage; encode is observed once per JPEG quality attempt."},
+		sizes: &metricFamily{name: "bestfriends_image_output_bytes", kind: "histogram", bounds: sizeBuckets,
+			help: "Size of processed photos as stored."},
+		results: &metricFamily{name: "bestfriends_image_processed_total", kind: "counter",
+			help: "Images processed, by input format and outcome (ok or the failure reason)."},
+	}
+}
+
+func (m *pipelineMetrics) Stage(stage string, quality int, d time.Duration) {
+	labels := fmt.Sprintf("stage=%q", stage)
+	if quality > 0 { labels += fmt.Sprintf(",quality=%q", strconv.Itoa(quality)) }
+	m.stages.observe(labels, d.Seconds())
+}
+
+func (m *pipelineMetrics) Processed(format, outcome string, size int) {
+	m.results.inc(fmt.Sprintf("format=%q,outcome=%q", format, outcome))
+	if outcome == "ok" { m.sizes.observe("", float64(size)) }
+}
+
+func (m *pipelineMetrics) families() []*metricFamily {
+	return []*metricFamily{m.stages, m.sizes, m.results}
+}
+
+// String makes pipelineMetrics an expvar.Var.
+func (m *pipelineMetrics) String() string {
+	v := map[string]any{}
+	for _, f := range m.families() { v[strings.TrimPrefix(f.name, "bestfriends_image_")] = f.expvarValue() }
+	b, err := json.Marshal(v)
+	if err != nil { return "{}" }
+	return string(b)
+}
+
+// imagingMetrics observes every image processed by this process, uploads and seeding alike.
+var imagingMetrics = newPipelineMetrics()
+
+func init() {
+	expvar.Publish("imaging", imagingMetrics)
+	imaging.SetObserver(imagingMetrics)
+}
+
+// handleMetrics serves the image pipeline metrics in the Prometheus text format: GET /debug/metrics
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	for _, f := range imagingMetrics.families() { f.writePrometheus(w) }
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram([]float64{1, 2, 5})
+	for _, v := range []float64{0.5, 1, 1.5, 3, 10} { h.observe(v) }
+	s := h.snapshot()
+	if want := []uint64{2, 3, 4, 5}; !slicesEqual(s.Buckets, want) {
+		t.Errorf("buckets = %v, want %v", s.Buckets, want)
+	}
+	if s.Count != 5 || s.Sum != 16 {
+		t.Errorf("count, sum = %d, %v; want 5, 16", s.Count, s.Sum)
+	}
+}
+
+func slicesEqual(a, b []uint64) bool {
+	if len(a) != len(b) { return false }
+	for i := range a {
+		if a[i] != b[i] { return false }
+	}
+	return true
+}
+
+func TestPipelineMetricsPrometheus(t *testing.T) {
+	m := newPipelineMetrics()
+	m.Stage("decode", 0, 3*time.Millisecond)
+	m.Stage("encode", 80, 20*time.Millisecond)
+	m.Processed("png", "ok", 40<<10)
+	m.Processed("unknown", "unsupported", 0)
+	var buf bytes.Buffer
+	for _, f := range m.families() { f.writePrometheus(&buf) }
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE bestfriends_image_stage_duration_seconds histogram\n",
+		`bestfriends_image_stage_duration_seconds_bucket{stage="decode",le="0.0025"} 0` + "\n",
+		`bestfriends_image_stage_duration_seconds_bucket{stage="decode",le="0.005"} 1` + "\n",
+		`bestfriends_image_stage_duration_seconds_count{stage="encode",quality="80"} 1` + "\n",
+		`bestfriends_image_output_bytes_bucket{le="65536"} 1` + "\n",
+		`bestfriends_image_output_bytes_count 1` + "\n",
+		`bestfriends_image_processed_total{format="png",outcome="ok"} 1` + "\n",
+		`bestfriends_image_processed_total{format="unknown",outcome="unsupported"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) { t.Errorf("missing %q in:\n%s", want, out) }
+	}
+	var v map[string]any
+	if err := json.Unmarshal([]byte(m.String()), &v); err != nil {
+		t.Fatalf("expvar value is not JSON: %v", err)
+	}
+}
+
+func TestImagingReportsFailures(t *testing.T) {
+	before := imagingMetrics.results.counters[`format="unknown",outcome="unsupported"`]
+	if _, _, err := imaging.Process([]byte("not an image"), imaging.MaxWidth, imaging.MaxBytes); err == nil {
+		t.Fatal("want an error for garbage input")
+	}
+	if got := imagingMetrics.results.counters[`format="unknown",outcome="unsupported"`]; got != before+1 {
+		t.Errorf("unsupported count = %d, want %d", got, before+1)
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// Moderation rule actions, weakest first: redact stars out the match, hold parks the profile
+// for review, reject refuses the submission.
+const (
+	modRedact = "redact"
+	modHold   = "hold"
+	modReject = "reject"
+)
+
+// statusHeld is a profile waiting for an admin to approve (statusActive) or discard it.
+const statusHeld = store.StatusHeld
+
+var modActionRank = map[string]int{modRedact: 1, modHold: 2, modReject: 3}
+
+const maxRulePattern = 200
+
+type ErrorInvalidRule string
+
+func (e ErrorInvalidRule) Error() string { return string(e) }
+func (ErrorInvalidRule) InvalidRule()    {}
+
+type ErrorModerated string
+
+func (e ErrorModerated) Error() string { return string(e) }
+func (ErrorModerated) Moderated()      {}
+
+// ErrModerated doesn't say which rule matched, so rules can't be probed from the form.
+const ErrModerated ErrorModerated = "the name or description contains text that isn't allowed here"
+
+// moderationRule is a moderation_rules row with its compiled pattern.
+type moderationRule struct {
+	views.ModerationRule
+	re *regexp.Regexp
+}
+
+// compileRule validates r and compiles its pattern. Word rules match the word
+// case-insensitively and only as a whole word; regex rules are Go (RE2) syntax, matched as
+// written, so (?i) is up to the author.
+func compileRule(r views.ModerationRule) (moderationRule, error) {
+	if _, ok := modActionRank[r.Action]; !ok { return moderationRule{}, ErrorInvalidRule("action must be reject, hold or redact") }
+	if strings.TrimSpace(r.Pattern) == "" { return moderationRule{}, ErrorInvalidRule("pattern is required") }
+	if utf8.RuneCountInString(r.Pattern) > maxRulePattern { return moderationRule{}, ErrorInvalidRule("pattern is longer than 200 characters") }
+	var expr string
+	switch r.Kind {
+	case "word":
+		r.Pattern = strings.TrimSpace(r.Pattern)
+		expr = "(?i)" + regexp.QuoteMeta(r.Pattern)
+	case "regex":
+		expr = r.Pattern
+	default:
+		return moderationRule{}, ErrorInvalidRule("kind must be word or regex")
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil { return moderationRule{}, ErrorInvalidRule("pattern: " + err.Error()) }
+	if re.MatchString("") { return moderationRule{}, ErrorInvalidRule("pattern matches empty text") }
+	return moderationRule{ModerationRule: r, re: re}, nil
+}
+
+// find returns the byte spans of s the rule matches.
+func (r moderationRule) find(s string) [][]int {
+	spans := r.re.FindAllStringIndex(s, -1)
+	if r.Kind != "word" { return spans }
+	whole := spans[:0]
+	for _, sp := range spans {
+		before, _ := utf8.DecodeLastRuneInString(s[:sp[0]])
+		after, _ := utf8.DecodeRuneInString(s[sp[1]:])
+		if !isWordRune(before) && !isWordRune(after) { whole = append(whole, sp) }
+	}
+	return whole
+}
+
+func isWordRune(r rune) bool { return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r)) }
+
+// moderationMatch is one rule matching one field of a submission.
+type moderationMatch struct {
+	Rule  moderationRule
+	Field string
+	Value string // the field as submitted
+}
+
+// moderationResult is the verdict on a submission: the strongest action among the matching
+// rules ("" when none matched) and the fields with redact matches starred out.
+type moderationResult struct {
+	Action      string
+	FullName    string
+	Description string
+	Matches     []moderationMatch
+}
+
+// moderate checks fullName and description against rules.
+func moderate(rules []moderationRule, fullName, description string) moderationResult {
+	res := moderationResult{FullName: fullName, Description: description}
+	for _, f := range []struct {
+		name string
+		text *string
+	}{{"full_name", &res.FullName}, {"description", &res.Description}} {
+		value := *f.text
+		var redact [][]int
+		for _, r := range rules {
+			spans := r.find(value)
+			if len(spans) == 0 { continue }
+			res.Matches = append(res.Matches, moderationMatch{Rule: r, Field: f.name, Value: value})
+			if modActionRank[r.Action] > modActionRank[res.Action] { res.Action = r.Action }
+			if r.Action == modRedact { redact = append(redact, spans...) }
+		}
+		*f.text = redactSpans(value, redact)
+	}
+	return res
+}
+
+// redactSpans replaces every rune inside spans (which may overlap) with '*'.
+func redactSpans(s string, spans [][]int) string {
+	if len(spans) == 0 { return s }
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var b strings.Builder
+	pos := 0
+	for _, sp := range spans {
+		start := max(sp[0], pos)
+		if start >= sp[1] { continue }
+		b.WriteString(s[pos:start])
+		b.WriteString(strings.Repeat("*", utf8.RuneCountInString(s[start:sp[1]])))
+		pos = sp[1]
+	}
+	b.WriteString(s[pos:])
+	return b.String()
+}
+
+// loadModerationRules returns the rules in creation order. A stored rule that no longer
+// compiles (it was validated when saved) is logged and skipped rather than blocking creates.
+func (s *Server) loadModerationRules(ctx context.Context) ([]moderationRule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id::string, kind, pattern, action, note, created_at, created_by FROM moderation_rules ORDER BY created_at, id`)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var rules []moderationRule
+	for rows.Next() {
+		var v views.ModerationRule
+		if err := rows.Scan(&v.ID, &v.Kind, &v.Pattern, &v.Action, &v.Note, &v.CreatedAt, &v.CreatedBy); err != nil { return nil, err }
+		r, err := compileRule(v)
+		if err != nil {
+			s.log.Warn("skipping moderation rule", "rule", v.ID, "err", err)
+			continue
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// moderateProfile runs a submission through the current rules.
+func (s *Server) moderateProfile(ctx context.Context, fullName, description string) (moderationResult, error) {
+	rules, err := s.loadModerationRules(ctx)
+	if err != nil { return moderationResult{}, err }
+	return moderate(rules, fullName, description), nil
+}
+
+// recordModerationMatches writes the audit rows for matches; profileID is "" for rejected
+// submissions, which never became a profile.
+func recordModerationMatches(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}, matches []moderationMatch, profileID, visitor string) error {
+	for _, m := range matches {
+		if _, err := db.ExecContext(ctx, `
+			INSERT INTO moderation_matches (rule_id, pattern, action, field, value, profile_id, visitor)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::UUID, $7)
+		`, m.Rule.ID, m.Rule.Pattern, m.Rule.Action, m.Field, m.Value, profileID, visitor); err != nil { return err }
+	}
+	return nil
+}
+
+// addModerationRule validates and stores r.
+func (s *Server) addModerationRule(ctx context.Context, r views.ModerationRule, actor string) (views.ModerationRule, error) {
+	c, err := compileRule(r)
+	if err != nil { return r, err }
+	if err := s.writable(); err != nil { return r, err }
+	r = c.ModerationRule
+	r.CreatedBy = actor
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO moderation_rules (kind, pattern, action, note, created_by) VALUES ($1, $2, $3, $4, $5)
+		RETURNING id::string, created_at
+	`, r.Kind, r.Pattern, r.Action, r.Note, actor).Scan(&r.ID, &r.CreatedAt)
+	return r, err
+}
+
+func (s *Server) deleteModerationRule(ctx context.Context, id string) error {
+	if err := s.writable(); err != nil { return err }
+	res, err := s.db.ExecContext(ctx, `DELETE FROM moderation_rules WHERE id = $1`, id)
+	if err != nil { return err }
+	if n, err := res.RowsAffected(); err != nil { return err } else if n == 0 { return ErrNotFound }
+	return nil
+}
+
+// discardHeldProfile deletes a profile that is still waiting for review.
+func (s *Server) discardHeldProfile(ctx context.Context, id string) error {
+	if err := s.writable(); err != nil { return err }
+	res, err := s.db.ExecContext(ctx, `DELETE FROM profiles WHERE id = $1 AND status = 'held'`, id)
+	if err != nil { return err }
+	if n, err := res.RowsAffected(); err != nil { return err } else if n == 0 { return ErrNotFound }
+	return nil
+}
+
+func (s *Server) recentModerationMatches(ctx context.Context, limit int) ([]views.ModerationMatch, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT pattern, action, field, value, COALESCE(profile_id::string, ''), created_at
+		FROM moderation_matches ORDER BY created_at DESC LIMIT $1`, limit)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	list := []views.ModerationMatch{}
+	for rows.Next() {
+		var m views.ModerationMatch
+		if err := rows.Scan(&m.Pattern, &m.Action, &m.Field, &m.Value, &m.ProfileID, &m.CreatedAt); err != nil { return nil, err }
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// moderationView gathers the admin moderation page.
+func (s *Server) moderationView(ctx context.Context) (views.AdminModerationView, error) {
+	var v views.AdminModerationView
+	rules, err := s.loadModerationRules(ctx)
+	if err != nil { return v, err }
+	for _, r := range rules { v.Rules = append(v.Rules, r.ModerationRule) }
+	held, err := s.loadProfiles(ctx, profileFilter{Status: statusHeld, Limit: maxProfiles})
+	if err != nil { return v, err }
+	for _, p := range held { v.Held = append(v.Held, profileView(p)) }
+	v.Matches, err = s.recentModerationMatches(ctx, 50)
+	return v, err
+}
+
+// handleAdminModeration manages rules and the review queue. GET shows the page; POST runs
+// op=add (kind, pattern, action, note), op=delete (id), op=approve (id) or op=discard (id).
+func (s *Server) handleAdminModeration(w http.ResponseWriter, r *http.Request) {
+	var notice string
+	var form views.ModerationRule
+	var err error
+	if r.Method == http.MethodPost {
+		actor, _ := s.adminActor(r)
+		id := r.FormValue("id")
+		switch op := r.FormValue("op"); op {
+		case "add":
+			form = views.ModerationRule{Kind: r.FormValue("kind"), Pattern: r.FormValue("pattern"), Action: r.FormValue("action"),
+				Note: strings.TrimSpace(r.FormValue("note"))}
+			if form, err = s.addModerationRule(r.Context(), form, actor); err == nil {
+				notice, form = "Rule added.", views.ModerationRule{}
+			}
+		case "delete":
+			err, notice = s.deleteModerationRule(r.Context(), id), "Rule deleted."
+		case "approve":
+			err, notice = s.setProfileStatus(r.Context(), id, statusActive), "Profile approved."
+		case "discard":
+			err, notice = s.discardHeldProfile(r.Context(), id), "Profile discarded."
+		default:
+			err = ErrorInvalidRule("unknown operation")
+		}
+		if err == nil { s.log.Info("moderation", "op", r.FormValue("op"), "id", cmp.Or(id, form.ID), "by", actor) }
+	}
+	s.writeModerationPage(w, r, err, notice, form)
+}
+
+// writeModerationPage shows the moderation page after an operation that ended with err,
+// keeping form for correction when it was a rejected rule.
+func (s *Server) writeModerationPage(w http.ResponseWriter, r *http.Request, err error, notice string, form views.ModerationRule) {
+	status := http.StatusOK
+	var errMsg string
+	switch {
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+		return
+	case errors.As(err, new(interface{ InvalidRule() })), errors.As(err, new(interface{ InvalidStatus() })),
+		errors.As(err, new(interface{ ReviewLink() })):
+		status, errMsg, notice = http.StatusBadRequest, err.Error(), ""
+	case errors.As(err, new(interface{ NotFound() })):
+		status, errMsg, notice = http.StatusNotFound, "Already gone; the page below is current.", ""
+	case err != nil:
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	v, err := s.moderationView(r.Context())
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	v.Form, v.Notice, v.Error = form, notice, errMsg
+	s.renderStatus(w, status, "admin_moderation.gohtml", v)
+}
+
+// APIModerationRule is a rule in the admin moderation API.
+type APIModerationRule struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`   // word or regex
+	Pattern   string    `json:"pattern"`
+	Action    string    `json:"action"` // reject, hold or redact
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+}
+
+func apiModerationRule(r views.ModerationRule) APIModerationRule {
+	return APIModerationRule{ID: r.ID, Kind: r.Kind, Pattern: r.Pattern, Action: r.Action, Note: r.Note, CreatedAt: r.CreatedAt, CreatedBy: r.CreatedBy}
+}
+
+// handleAPIAdminModerationRules lists (GET) or adds (POST {kind, pattern, action, note}) rules.
+func (s *Server) handleAPIAdminModerationRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var req APIModerationRule
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad json")
+			return
+		}
+		actor, _ := s.adminActor(r)
+		rule, err := s.addModerationRule(r.Context(), views.ModerationRule{Kind: req.Kind, Pattern: req.Pattern, Action: req.Action,
+			Note: strings.TrimSpace(req.Note)}, actor)
+		switch {
+		case errors.As(err, new(interface{ InvalidRule() })):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+		case err != nil:
+			writeJSONError(w, http.StatusInternalServerError, "db error")
+		default:
+			s.log.Info("moderation", "op", "add", "id", rule.ID, "by", actor)
+			writeJSON(w, http.StatusCreated, apiModerationRule(rule))
+		}
+		return
+	}
+	rules, err := s.loadModerationRules(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	out := []APIModerationRule{}
+	for _, rule := range rules { out = append(out, apiModerationRule(rule.ModerationRule)) }
+	writeJSON(w, http.StatusOK, map[string]any{"rules": out})
+}
+
+// handleAPIAdminModerationRule deletes a rule: DELETE /api/v1/admin/moderation/rules/{id}.
+// Its past matches stay, with the pattern they matched.
+func (s *Server) handleAPIAdminModerationRule(w http.ResponseWriter, r *http.Request) {
+	s.writeAdminDelete(w, r, "delete", s.deleteModerationRule)
+}
+
+// handleAPIAdminHeld lists profiles waiting for review: GET /api/v1/admin/moderation/held.
+// Approve one with PUT /api/v1/admin/profiles/{id}/status {"status": "active"}.
+func (s *Server) handleAPIAdminHeld(w http.ResponseWriter, r *http.Request) {
+	list, err := s.loadProfiles(r.Context(), profileFilter{Status: statusHeld, Limit: maxProfiles})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	out := make([]APIProfile, 0, len(list))
+	for _, p := range list { out = append(out, s.apiProfile(p)) }
+	writeJSON(w, http.StatusOK, map[string]any{"profiles": out})
+}
+
+// handleAPIAdminDiscardHeld deletes a held profile: DELETE /api/v1/admin/moderation/held/{id}.
+func (s *Server) handleAPIAdminDiscardHeld(w http.ResponseWriter, r *http.Request) {
+	s.writeAdminDelete(w, r, "discard", s.discardHeldProfile)
+}
+
+func (s *Server) writeAdminDelete(w http.ResponseWriter, r *http.Request, op string, del func(context.Context, string) error) {
+	id := pathID(r)
+	err := del(r.Context(), id)
+	switch {
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "not found")
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+	default:
+		actor, _ := s.adminActor(r)
+		s.log.Info("moderation", "op", op, "id", id, "by", actor)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// APIModerationMatch is an audit entry in GET /api/v1/admin/moderation/matches.
+type APIModerationMatch struct {
+	Pattern   string    `json:"pattern"`
+	Action    string    `json:"action"`
+	Field     string    `json:"field"`
+	Value     string    `json:"value"`
+	ProfileID string    `json:"profile_id,omitempty"` // empty for rejected submissions
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// handleAPIAdminModerationMatches lists recent matches, newest first: GET ...?limit=
+func (s *Server) handleAPIAdminModerationMatches(w http.ResponseWriter, r *http.Request) {
+	list, err := s.recentModerationMatches(r.Context(), clampAtoi(r.URL.Query().Get("limit"), 1, 1000, 100))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	out := make([]APIModerationMatch, 0, len(list))
+	for _, m := range list {
+		out = append(out, APIModerationMatch{Pattern: m.Pattern, Action: m.Action, Field: m.Field, Value: m.Value, ProfileID: m.ProfileID, CreatedAt: m.CreatedAt})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"matches": out})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+func mustRule(t *testing.T, kind, pattern, action string) moderationRule {
+	t.Helper()
+	r, err := compileRule(views.ModerationRule{ID: pattern, Kind: kind, Pattern: pattern, Action: action})
+	if err != nil { t.Fatalf("compileRule(%q): %v", pattern, err) }
+	return r
+}
+
+func TestCompileRuleRejectsBadRules(t *testing.T) {
+	for _, r := range []views.ModerationRule{
+		{Kind: "word", Pattern: "x", Action: "ban"},
+		{Kind: "glob", Pattern: "x", Action: "hold"},
+		{Kind: "word", Pattern: "  ", Action: "hold"},
+		{Kind: "regex", Pattern: "(", Action: "hold"},
+		{Kind: "regex", Pattern: "a*", Action: "hold"}, // matches everything
+	} {
+		if _, err := compileRule(r); err == nil { t.Errorf("compileRule(%+v) succeeded", r) }
+	}
+}
+
+func TestWordRulesMatchWholeWordsOnly(t *testing.T) {
+	r := mustRule(t, "word", "ass", modRedact)
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"ass", 1},
+		{"You ASS!", 1},
+		{"class assignment", 0},
+		{"ass,ass", 2},
+		{"éass", 0}, // a letter outside ASCII still joins the word
+		{"«ass»", 1},
+	}
+	for _, tt := range tests {
+		if got := len(r.find(tt.in)); got != tt.want {
+			t.Errorf("find(%q) = %d matches, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestModerateStrongestActionAndRedaction(t *testing.T) {
+	rules := []moderationRule{
+		mustRule(t, "word", "darn", modRedact),
+		mustRule(t, "regex", `(?i)buy\s+now`, modHold),
+		mustRule(t, "word", "scam", modReject),
+	}
+	res := moderate(rules, "Darn Ñandú", "well darn, darn it")
+	if res.Action != modRedact || res.FullName != "**** Ñandú" || res.Description != "well ****, **** it" {
+		t.Errorf("redact: got %+v", res)
+	}
+	if len(res.Matches) != 2 || res.Matches[0].Field != "full_name" || res.Matches[1].Value != "well darn, darn it" {
+		t.Errorf("redact matches: %+v", res.Matches)
+	}
+
+	res = moderate(rules, "Ada", "darn, BUY  now")
+	if res.Action != modHold || res.Description != "****, BUY  now" { t.Errorf("hold: got %+v", res) }
+
+	res = moderate(rules, "scam", "buy now")
+	if res.Action != modReject || len(res.Matches) != 2 { t.Errorf("reject: got %+v", res) }
+
+	res = moderate(rules, "Ada", "Lovelace")
+	if res.Action != "" || len(res.Matches) != 0 || res.FullName != "Ada" { t.Errorf("clean: got %+v", res) }
+}
+
+func TestRedactSpansOverlapping(t *testing.T) {
+	if got := redactSpans("abcdef", [][]int{{3, 5}, {1, 4}}); got != "a****f" { t.Errorf("got %q", got) }
+	if got := redactSpans("añb", [][]int{{1, 3}}); got != "a*b" { t.Errorf("got %q", got) }
+}
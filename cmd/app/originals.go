@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+)
+
+// keepOriginal stores the upload a profile's photo was derived from, so cmd/reprocess can
+// redo it without re-encoding an already lossy copy. Its metadata is stripped first (GPS
+// positions aren't ours to keep); uploads over the cap, or that can't be stripped, are not kept.
+func (s *Server) keepOriginal(ctx context.Context, tx *sql.Tx, profileID string, data []byte) error {
+	if len(data) == 0 || len(data) > s.cfg.OriginalsMaxBytes { return nil }
+	contentType, err := imaging.Sniff(data)
+	if err != nil { return err }
+	data, ok := imaging.StripMetadata(data)
+	if !ok { return nil }
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO profile_originals (profile_id, data, content_type, size) VALUES ($1, $2, $3, $4)
+	`, profileID, data, contentType, len(data))
+	return err
+}
+
+// pruneOriginals drops originals older than the retention window, one batch per call.
+func (s *Server) pruneOriginals(ctx context.Context) (int64, error) {
+	if s.cfg.OriginalsRetention <= 0 { return 0, nil }
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM profile_originals WHERE created_at < now() - $1::INT * interval '1 second' ORDER BY created_at LIMIT $2
+	`, int64(s.cfg.OriginalsRetention.Seconds()), retentionBatchSize)
+	if err != nil { return 0, err }
+	return res.RowsAffected()
+}
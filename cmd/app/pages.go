@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// The home page, the alumni page and the leaderboard fragment list page_size profiles at a
+// time. When more follow, the last card is followed by a "Load more" link carrying the
+// position of that card in the vote order (store.Cursor) as ?after=: a plain link to the next
+// page, which works without JavaScript, and with htmx a request for the next cards from the
+// leaderboard fragment, swapped in for the link once it scrolls into view. A keyset costs the
+// same on every page, where an offset would read and skip every row before it.
+
+// startCursor is ?after= for the start of the vote order: the page after one of only pins.
+const startCursor = "start"
+
+type ErrorInvalidPageCursor string
+
+func (e ErrorInvalidPageCursor) Error() string { return string(e) }
+func (ErrorInvalidPageCursor) InvalidPageCursor() {}
+
+// encodeCursor writes c for ?after=: votes, created_at in Unix microseconds (the column's
+// precision) and id, dot-separated, led by the search rank in the results of a search.
+func encodeCursor(c store.Cursor) string {
+	if c.ID == "" { return startCursor }
+	s := strconv.Itoa(c.Votes) + "." + strconv.FormatInt(c.CreatedAt.UnixMicro(), 10) + "." + c.ID
+	if c.Rank > 0 { s = strconv.Itoa(c.Rank) + "." + s }
+	return s
+}
+
+// parseAfter reads ?after=; nil is the first page.
+func parseAfter(q url.Values) (*store.Cursor, error) {
+	s := q.Get("after")
+	if s == "" { return nil, nil }
+	if s == startCursor { return &store.Cursor{}, nil }
+	bad := ErrorInvalidPageCursor("after must be a cursor from a Load more link")
+	parts := strings.Split(s, ".")
+	rank := 0
+	if len(parts) == 4 {
+		r, err := strconv.Atoi(parts[0])
+		if err != nil || r <= 0 { return nil, bad }
+		rank, parts = r, parts[1:]
+	}
+	if len(parts) != 3 || !validVoteToken(parts[2]) { return nil, bad }
+	v, err := strconv.Atoi(parts[0])
+	if err != nil || v < 0 { return nil, bad }
+	us, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil { return nil, bad }
+	return &store.Cursor{Rank: rank, Votes: v, CreatedAt: time.UnixMicro(us).UTC(), ID: parts[2]}, nil
+}
+
+// loadPage lists one page of f and, when another follows, the cursor it starts after. It asks
+// for one profile more than the page to know; a lookup by ID is never paged.
+func (s *Server) loadPage(ctx context.Context, f profileFilter) ([]Profile, *store.Cursor, error) {
+	if f.ID != "" || f.Limit <= 0 {
+		list, err := s.loadProfiles(ctx, f)
+		return list, nil, err
+	}
+	g := f
+	g.Limit++
+	list, err := s.loadProfiles(ctx, g)
+	if err != nil || len(list) <= f.Limit { return list, nil, err }
+	list = list[:f.Limit]
+	// Pins lead the first page out of vote order and later pages leave them out, so a page
+	// ending in a pin is all pins, and the next one starts at the top of the vote order.
+	last := list[len(list)-1]
+	if f.PinsFirst && last.Pinned { return list, &store.Cursor{}, nil }
+	return list, &store.Cursor{Rank: last.SearchRank, Votes: last.Votes, CreatedAt: last.CreatedAt, ID: last.ID}, nil
+}
+
+// nextPage returns the links to the page of f after next, nil when there is none.
+func nextPage(f profileFilter, next *store.Cursor) *views.PageLinks {
+	if next == nil { return nil }
+	q := url.Values{}
+	if f.Query != "" { q.Set("q", f.Query) }
+	if f.Country != "" { q.Set("country", f.Country) }
+	q.Set("after", encodeCursor(*next))
+	page := "/"
+	if f.Status == statusRetired { page = "/alumni" }
+	links := &views.PageLinks{Page: page + "?" + q.Encode()}
+	if f.Status == statusRetired { q.Set("alumni", "1") }
+	links.Fragment = "/fragments/leaderboard?" + q.Encode()
+	return links
+}
+
+// cursorKey is f.After for a flight key.
+func cursorKey(c *store.Cursor) string {
+	if c == nil { return "" }
+	return encodeCursor(*c)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+func TestPageCursor(t *testing.T) {
+	c := store.Cursor{Votes: 42, CreatedAt: time.Date(2026, 10, 1, 12, 30, 0, 123456000, time.UTC), ID: "3f2a9c1e-0000-4000-8000-000000000001"}
+	got, err := parseAfter(url.Values{"after": {encodeCursor(c)}})
+	if err != nil || got == nil || *got != c { t.Fatalf("round trip of %v = %v, %v", c, got, err) }
+	c.Rank = 5 // in search results
+	if got, err := parseAfter(url.Values{"after": {encodeCursor(c)}}); err != nil || got == nil || *got != c { t.Fatalf("round trip of %v = %v, %v", c, got, err) }
+	if got, err := parseAfter(url.Values{"after": {encodeCursor(store.Cursor{})}}); err != nil || got == nil || *got != (store.Cursor{}) { t.Errorf("start = %v, %v", got, err) }
+	if got, err := parseAfter(url.Values{}); got != nil || err != nil { t.Errorf("no after = %v, %v", got, err) }
+	for _, bad := range []string{"x", "1.2", "-1.2.3f2a9c1e-0000-4000-8000-000000000001", "1.x.3f2a9c1e-0000-4000-8000-000000000001", "1.2.3F2A9C1E-0000-4000-8000-000000000001", "1.2.p1", "0.1.2.3f2a9c1e-0000-4000-8000-000000000001", "1.1.2.3.3f2a9c1e-0000-4000-8000-000000000001"} {
+		if _, err := parseAfter(url.Values{"after": {bad}}); !errors.As(err, new(interface{ InvalidPageCursor() })) { t.Errorf("parseAfter(%q) = %v", bad, err) }
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	if l := nextPage(profileFilter{}, nil); l != nil { t.Errorf("last page links = %+v", l) }
+	l := nextPage(profileFilter{Query: "a b", Country: "Chile", Status: statusRetired}, &store.Cursor{})
+	if l.Page != "/alumni?after=start&country=Chile&q=a+b" { t.Errorf("Page = %s", l.Page) }
+	if l.Fragment != "/fragments/leaderboard?after=start&alumni=1&country=Chile&q=a+b" { t.Errorf("Fragment = %s", l.Fragment) }
+}
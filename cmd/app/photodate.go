@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Submitters may ask for the month their photo was taken to be shown on the profile's page
+// ("photo taken June 2023"). It is read from the upload's EXIF before the photo pipeline
+// drops the metadata, and only the month is kept (profiles.photo_taken). Profiles have no
+// owner accounts, so an owner who wants it gone asks an admin, who hides it on the edit page
+// or through the API; hiding keeps the month, so it can be shown again.
+
+// photoDate is the stored capture month of a profile's photo, hidden or not.
+type photoDate struct {
+	Taken  *time.Time
+	Hidden bool
+}
+
+// loadPhotoDate reads profile id's capture month as stored, including a hidden one.
+func (s *Server) loadPhotoDate(ctx context.Context, id string) (photoDate, error) {
+	var d photoDate
+	err := s.db.QueryRowContext(ctx, `SELECT photo_taken, photo_taken_hidden FROM profiles WHERE id = $1`, id).Scan(&d.Taken, &d.Hidden)
+	if errors.Is(err, sql.ErrNoRows) { return d, ErrNotFound }
+	return d, err
+}
+
+// setPhotoDateHidden hides or shows again the capture month of profile id's photo.
+func (s *Server) setPhotoDateHidden(ctx context.Context, id string, hidden bool) error {
+	if err := s.writable(); err != nil { return err }
+	res, err := s.db.ExecContext(ctx, `UPDATE profiles SET photo_taken_hidden = $2, updated_at = now() WHERE id = $1`, id, hidden)
+	if err != nil { return err }
+	if n, err := res.RowsAffected(); err != nil { return err } else if n == 0 { return ErrNotFound }
+	return nil
+}
+
+// handleAPIAdminPhotoDate hides or shows a profile's photo date:
+// PUT /api/v1/admin/profiles/{id}/photo-date {"hidden": true}
+func (s *Server) handleAPIAdminPhotoDate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Hidden *bool `json:"hidden"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&req); err != nil || req.Hidden == nil {
+		writeJSONError(w, http.StatusBadRequest, `body must be {"hidden": true or false}`)
+		return
+	}
+	id := pathID(r)
+	err := s.setPhotoDateHidden(r.Context(), id, *req.Hidden)
+	switch {
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	actor, _ := s.adminActor(r)
+	s.log.Info("photo date visibility changed", "profile", id, "hidden", *req.Hidden, "by", actor)
+	d, err := s.loadPhotoDate(r.Context(), id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	out := map[string]any{"hidden": d.Hidden, "photo_taken": nil}
+	if d.Taken != nil { out["photo_taken"] = d.Taken.Format("2006-01") }
+	writeJSON(w, http.StatusOK, out)
+}
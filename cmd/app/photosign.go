@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// photoURLSkew tolerates clocks drifting between the replica that rendered a page and the
+// one serving the photo.
+const photoURLSkew = 2 * time.Minute
+
+// photoURL returns the photo path for a profile. With a signing key configured the URL
+// carries an HMAC signature and expiry so it stops working once shared outside the board.
+// Expiries are rounded up to TTL boundaries, keeping URLs stable (and cacheable) per window.
+func (s *Server) photoURL(id string) string {
+	path := unsignedPhotoURL(id)
+	if s.cfg.PhotoSigningKey == "" { return path }
+	ttl := int64(s.cfg.PhotoURLTTL / time.Second)
+	exp := (time.Now().Unix()/ttl + 2) * ttl // at least one full TTL remains
+	v := url.Values{"exp": {strconv.FormatInt(exp, 10)}, "sig": {s.photoSig(id, exp)}}
+	return path + "?" + v.Encode()
+}
+
+func unsignedPhotoURL(id string) string {
+	return "/profiles/" + url.PathEscape(id) + "/photo"
+}
+
+// checkPhotoSig validates the exp/sig query parameters produced by photoURL.
+func (s *Server) checkPhotoSig(id string, q url.Values) (time.Time, bool) {
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil { return time.Time{}, false }
+	expires := time.Unix(exp, 0)
+	if time.Now().After(expires.Add(photoURLSkew)) { return expires, false }
+	want := s.photoSig(id, exp)
+	return expires, hmac.Equal([]byte(q.Get("sig")), []byte(want))
+}
+
+func (s *Server) photoSig(id string, exp int64) string {
+	m := hmac.New(sha256.New, []byte(s.cfg.PhotoSigningKey))
+	m.Write([]byte(id))
+	m.Write([]byte{0})
+	m.Write([]byte(strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil)[:16])
+}
+
+// embedPhotoURL returns a photo URL for use on other sites, valid until exp whatever the
+// Referer, for hotlink protection (see phototraffic.go) and the page signature alike.
+func (s *Server) embedPhotoURL(id string, exp time.Time) string {
+	v := url.Values{"embed": {"1"}, "exp": {strconv.FormatInt(exp.Unix(), 10)}, "sig": {s.embedSig(id, exp.Unix())}}
+	return unsignedPhotoURL(id) + "?" + v.Encode()
+}
+
+// checkEmbedSig validates the parameters produced by embedPhotoURL.
+func (s *Server) checkEmbedSig(id string, q url.Values) (time.Time, bool) {
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil || s.cfg.PhotoSigningKey == "" { return time.Time{}, false }
+	expires := time.Unix(exp, 0)
+	if time.Now().After(expires.Add(photoURLSkew)) { return expires, false }
+	return expires, hmac.Equal([]byte(q.Get("sig")), []byte(s.embedSig(id, exp)))
+}
+
+// embedSig is photoSig for embed URLs; the prefix keeps a page URL's signature from passing
+// as an embed one.
+func (s *Server) embedSig(id string, exp int64) string {
+	return s.photoSig("embed\x00"+id, exp)
+}
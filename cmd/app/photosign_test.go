@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhotoURLSignature(t *testing.T) {
+	s := &Server{cfg: Config{PhotoSigningKey: "k", PhotoURLTTL: time.Hour}}
+	u, err := url.Parse(s.photoURL("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/profiles/abc/photo" {
+		t.Fatalf("path = %q", u.Path)
+	}
+	if _, ok := s.checkPhotoSig("abc", u.Query()); !ok {
+		t.Fatal("fresh URL rejected")
+	}
+	if _, ok := s.checkPhotoSig("other", u.Query()); ok {
+		t.Fatal("signature accepted for another profile")
+	}
+
+	q := u.Query()
+	exp, _ := strconv.ParseInt(q.Get("exp"), 10, 64)
+	q.Set("exp", strconv.FormatInt(exp+3600, 10))
+	if _, ok := s.checkPhotoSig("abc", q); ok {
+		t.Fatal("extended expiry accepted")
+	}
+
+	old := time.Now().Add(-photoURLSkew - time.Minute).Unix()
+	q = url.Values{"exp": {strconv.FormatInt(old, 10)}, "sig": {s.photoSig("abc", old)}}
+	if _, ok := s.checkPhotoSig("abc", q); ok {
+		t.Fatal("expired URL accepted")
+	}
+	within := time.Now().Add(-photoURLSkew / 2).Unix()
+	q = url.Values{"exp": {strconv.FormatInt(within, 10)}, "sig": {s.photoSig("abc", within)}}
+	if _, ok := s.checkPhotoSig("abc", q); !ok {
+		t.Fatal("URL within clock-skew tolerance rejected")
+	}
+}
+
+func TestPhotoURLUnsigned(t *testing.T) {
+	s := &Server{}
+	if got := s.photoURL("abc"); strings.Contains(got, "?") {
+		t.Fatalf("unsigned URL has query: %q", got)
+	}
+}
+
+func TestEmbedPhotoURL(t *testing.T) {
+	s := &Server{cfg: Config{PhotoSigningKey: "k", PhotoURLTTL: time.Hour}}
+	u, _ := url.Parse(s.embedPhotoURL("abc", time.Now().Add(24*time.Hour)))
+	if _, ok := s.checkEmbedSig("abc", u.Query()); !ok { t.Fatal("fresh embed URL rejected") }
+	if _, ok := s.checkPhotoSig("abc", u.Query()); ok { t.Error("embed signature accepted as a page signature") }
+	page, _ := url.Parse(s.photoURL("abc"))
+	if _, ok := s.checkEmbedSig("abc", page.Query()); ok { t.Error("page signature accepted as an embed signature") }
+	if _, ok := (&Server{}).checkEmbedSig("abc", u.Query()); ok { t.Error("embed URL accepted without a signing key") }
+}
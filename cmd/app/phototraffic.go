@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+	"github.com/lib/pq"
+)
+
+// Photo traffic: every photo response is counted per profile in memory and added to
+// photo_traffic (per UTC day) by the photo_traffic job, so admins can see which photos cost
+// the most bandwidth and which are being hotlinked. With the photo_hotlink_protection setting
+// on, photo requests referred by other sites are refused unless the site is listed in
+// LEADERBOARD_PHOTO_REFERERS or the URL is an embed URL issued by an admin.
+
+const (
+	photoTrafficInterval  = time.Minute
+	photoTrafficRetention = 90 * 24 * time.Hour
+	photoEmbedDefaultTTL  = 30 * 24 * time.Hour
+	photoEmbedMaxTTL      = 365 * 24 * time.Hour
+)
+
+// photoHit is what one or more photo requests add to a profile's counts.
+type photoHit struct {
+	requests, notModified, bytes, blocked int64
+}
+
+func (h *photoHit) merge(o photoHit) {
+	h.requests += o.requests
+	h.notModified += o.notModified
+	h.bytes += o.bytes
+	h.blocked += o.blocked
+}
+
+// photoTraffic holds the counts not yet written to photo_traffic, by profile id.
+type photoTraffic struct {
+	mu   sync.Mutex
+	hits map[string]photoHit
+}
+
+func (t *photoTraffic) add(id string, h photoHit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hits == nil { t.hits = map[string]photoHit{} }
+	c := t.hits[id]
+	c.merge(h)
+	t.hits[id] = c
+}
+
+// take returns the pending counts and starts afresh.
+func (t *photoTraffic) take() map[string]photoHit {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hits := t.hits
+	t.hits = nil
+	return hits
+}
+
+// putBack returns counts a failed flush took, to be written by the next one.
+func (t *photoTraffic) putBack(hits map[string]photoHit) {
+	for id, h := range hits { t.add(id, h) }
+}
+
+// flushPhotoTraffic adds the pending counts to today's photo_traffic rows and drops rows past
+// photoTrafficRetention. Counts for profiles deleted in the meantime are discarded.
+func (s *Server) flushPhotoTraffic(ctx context.Context) error {
+	hits := s.photoTraffic.take()
+	if len(hits) > 0 {
+		var ids []string
+		var requests, notModified, bytes, blocked []int64
+		for id, h := range hits {
+			ids = append(ids, id)
+			requests, notModified = append(requests, h.requests), append(notModified, h.notModified)
+			bytes, blocked = append(bytes, h.bytes), append(blocked, h.blocked)
+		}
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO photo_traffic AS t (day, profile_id, requests, not_modified, bytes, blocked)
+			SELECT current_date(), h.id, h.requests, h.not_modified, h.bytes, h.blocked
+			FROM unnest($1::uuid[], $2::int8[], $3::int8[], $4::int8[], $5::int8[]) AS h(id, requests, not_modified, bytes, blocked)
+			JOIN profiles p ON p.id = h.id
+			ON CONFLICT (day, profile_id) DO UPDATE SET
+				requests = t.requests + excluded.requests, not_modified = t.not_modified + excluded.not_modified,
+				bytes = t.bytes + excluded.bytes, blocked = t.blocked + excluded.blocked
+		`, pq.Array(ids), pq.Array(requests), pq.Array(notModified), pq.Array(bytes), pq.Array(blocked))
+		if err != nil {
+			s.photoTraffic.putBack(hits)
+			return err
+		}
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM photo_traffic WHERE day < $1::date`, time.Now().UTC().Add(-photoTrafficRetention))
+	return err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// refererHost is the host of the page that asked for r: Origin when the browser sent one,
+// else Referer. It is "" for direct requests and browsers that send neither.
+func refererHost(r *http.Request) string {
+	ref := r.Header.Get("Origin")
+	if ref == "" || ref == "null" { ref = r.Referer() }
+	u, err := url.Parse(ref)
+	if err != nil { return "" }
+	return strings.ToLower(u.Hostname())
+}
+
+// photoRefererAllowed reports whether hotlink protection lets r through: always when it is
+// off, and otherwise for requests without a referring page (direct visits, privacy settings),
+// from this site, or from an allowed host. "*.example.com" allows the subdomains of example.com.
+func (s *Server) photoRefererAllowed(r *http.Request) bool {
+	if !s.settings.GetBool(settingPhotoHotlink) { return true }
+	host := refererHost(r)
+	if host == "" || host == strings.ToLower(hostOnly(r.Host)) { return true }
+	if u, err := url.Parse(s.cfg.PublicURL); err == nil && host == strings.ToLower(u.Hostname()) { return true }
+	for _, allowed := range s.cfg.PhotoReferers {
+		if host == allowed { return true }
+		if suffix, ok := strings.CutPrefix(allowed, "*"); ok && strings.HasSuffix(host, suffix) { return true }
+	}
+	return false
+}
+
+// hostOnly strips the port from a Host header value.
+func hostOnly(hostport string) string {
+	if u, err := url.Parse("//" + hostport); err == nil { return u.Hostname() }
+	return hostport
+}
+
+// APIPhotoTraffic is one profile's photo traffic over the requested days.
+type APIPhotoTraffic struct {
+	ProfileID   string `json:"profile_id"`
+	FullName    string `json:"full_name"`
+	Requests    int64  `json:"requests"`
+	NotModified int64  `json:"not_modified"`
+	Bytes       int64  `json:"bytes"`
+	Blocked     int64  `json:"blocked"`
+}
+
+// loadPhotoTraffic sums photo_traffic over the last days UTC days (today included) and returns
+// the limit profiles with the most bytes served, plus the totals over all profiles.
+func (s *Server) loadPhotoTraffic(ctx context.Context, days, limit int) ([]APIPhotoTraffic, APIPhotoTraffic, error) {
+	since := time.Now().UTC().AddDate(0, 0, 1-days)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.profile_id::string, p.full_name, sum(t.requests)::int8, sum(t.not_modified)::int8, sum(t.bytes)::int8, sum(t.blocked)::int8
+		FROM photo_traffic t JOIN profiles p ON p.id = t.profile_id
+		WHERE t.day >= $1::date
+		GROUP BY t.profile_id, p.full_name
+		ORDER BY 5 DESC, 6 DESC, 1
+	`, since)
+	if err != nil { return nil, APIPhotoTraffic{}, err }
+	defer rows.Close()
+	list := []APIPhotoTraffic{}
+	var total APIPhotoTraffic
+	for rows.Next() {
+		var t APIPhotoTraffic
+		if err := rows.Scan(&t.ProfileID, &t.FullName, &t.Requests, &t.NotModified, &t.Bytes, &t.Blocked); err != nil { return nil, total, err }
+		total.Requests, total.NotModified = total.Requests+t.Requests, total.NotModified+t.NotModified
+		total.Bytes, total.Blocked = total.Bytes+t.Bytes, total.Blocked+t.Blocked
+		if len(list) < limit { list = append(list, t) }
+	}
+	return list, total, rows.Err()
+}
+
+// handleAdminPhotoTraffic is the photo traffic page: GET /admin/photos?days=7
+func (s *Server) handleAdminPhotoTraffic(w http.ResponseWriter, r *http.Request) {
+	days := clampAtoi(r.URL.Query().Get("days"), 1, 90, 7)
+	list, total, err := s.loadPhotoTraffic(r.Context(), days, 100)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	v := views.AdminPhotoTrafficView{Days: days, Total: photoTrafficView(total), Protection: s.settings.GetBool(settingPhotoHotlink),
+		Referers: slices.Clone(s.cfg.PhotoReferers), Embeds: s.cfg.PhotoSigningKey != ""}
+	for _, t := range list { v.Rows = append(v.Rows, photoTrafficView(t)) }
+	s.render(w, "admin_photos.gohtml", v)
+}
+
+func photoTrafficView(t APIPhotoTraffic) views.PhotoTraffic {
+	return views.PhotoTraffic{ProfileID: t.ProfileID, FullName: t.FullName, Requests: t.Requests, NotModified: t.NotModified, Bytes: t.Bytes, Blocked: t.Blocked}
+}
+
+// handleAPIAdminPhotoTraffic is the JSON variant: GET /api/v1/admin/photos/traffic?days=7&limit=50
+func (s *Server) handleAPIAdminPhotoTraffic(w http.ResponseWriter, r *http.Request) {
+	days := clampAtoi(r.URL.Query().Get("days"), 1, 90, 7)
+	list, total, err := s.loadPhotoTraffic(r.Context(), days, clampAtoi(r.URL.Query().Get("limit"), 1, 1000, 50))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"days": days, "total": total, "profiles": list})
+}
+
+// handleAPIAdminPhotoEmbed issues an embed URL for a profile's photo, for use on other sites
+// under hotlink protection: POST /api/v1/admin/profiles/{id}/photo-embed {"ttl": "720h"}.
+// URLs are absolute when LEADERBOARD_PUBLIC_URL is set, otherwise paths.
+func (s *Server) handleAPIAdminPhotoEmbed(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.PhotoSigningKey == "" {
+		writeJSONError(w, http.StatusNotFound, "embed URLs are not enabled (LEADERBOARD_PHOTO_SIGNING_KEY)")
+		return
+	}
+	var req struct {
+		TTL string `json:"ttl"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONError(w, http.StatusBadRequest, "bad json")
+		return
+	}
+	ttl := photoEmbedDefaultTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > photoEmbedMaxTTL {
+			writeJSONError(w, http.StatusBadRequest, "ttl must be a duration up to 8760h")
+			return
+		}
+		ttl = d
+	}
+	id := pathID(r)
+	if _, err := s.store.ProfileStatus(r.Context(), id); err != nil {
+		if errors.As(err, new(interface{ NotFound() })) {
+			writeJSONError(w, http.StatusNotFound, "unknown profile id")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	actor, _ := s.adminActor(r)
+	s.log.Info("photo embed url issued", "profile", id, "ttl", ttl, "by", actor)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"url":        strings.TrimRight(s.cfg.PublicURL, "/") + s.embedPhotoURL(id, expires),
+		"expires_at": expires.UTC(),
+	})
+}
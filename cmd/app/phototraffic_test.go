@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPhotoRefererAllowed(t *testing.T) {
+	s := &Server{cfg: Config{PublicURL: "https://friends.example", PhotoReferers: []string{"blog.example", "*.partner.example"}}}
+	check := func(header, value string) bool {
+		r := httptest.NewRequest("GET", "http://board.internal:8080/profiles/x/photo", nil)
+		if header != "" { r.Header.Set(header, value) }
+		return s.photoRefererAllowed(r)
+	}
+	if !check("Referer", "https://evil.example/") { t.Error("blocked with protection off") }
+
+	s.settings.rows.Store(&map[string]storedSetting{settingPhotoHotlink.key: {value: true}})
+	for _, tt := range []struct {
+		header, value string
+		want          bool
+	}{
+		{"", "", true},
+		{"Referer", "http://board.internal:8080/", true},
+		{"Referer", "https://friends.example/?q=x", true},
+		{"Referer", "https://blog.example/post", true},
+		{"Origin", "https://www.partner.example", true},
+		{"Referer", "https://partner.example.evil/", false},
+		{"Referer", "https://evil.example/", false},
+		{"Origin", "https://blog.example.evil", false},
+	} {
+		if got := check(tt.header, tt.value); got != tt.want { t.Errorf("%s: %s = %t, want %t", tt.header, tt.value, got, tt.want) }
+	}
+}
+
+func TestPhotoTrafficCounts(t *testing.T) {
+	var p photoTraffic
+	p.add("a", photoHit{requests: 1, bytes: 100})
+	p.add("a", photoHit{requests: 1, notModified: 1})
+	p.add("b", photoHit{blocked: 1})
+	hits := p.take()
+	if got := hits["a"]; got != (photoHit{requests: 2, notModified: 1, bytes: 100}) || hits["b"].blocked != 1 { t.Fatalf("hits = %+v", hits) }
+	if len(p.take()) != 0 { t.Error("take left counts behind") }
+	p.putBack(hits)
+	p.add("a", photoHit{requests: 1})
+	if got := p.take()["a"].requests; got != 3 { t.Errorf("requests after putBack = %d, want 3", got) }
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// handleAPIAdminPins reads (GET) or replaces (PUT) the ordered list of pinned profiles.
+// PUT takes {"profile_ids": [...]} in display order, so reordering, pinning and unpinning
+// are all the same call: send the list as it should look.
+func (s *Server) handleAPIAdminPins(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			ProfileIDs []string `json:"profile_ids"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad json")
+			return
+		}
+		if err := s.setPins(r.Context(), req.ProfileIDs); err != nil {
+			if errors.As(err, new(interface{ InvalidPins() })) {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if errors.As(err, new(interface{ NotFound() })) {
+				writeJSONError(w, http.StatusNotFound, "unknown profile id")
+				return
+			}
+			if errors.As(err, new(interface{ ReadOnly() })) {
+				writeReadOnly(w, r)
+				return
+			}
+			writeJSONError(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		actor, _ := s.adminActor(r)
+		s.log.Info("pins updated", "profiles", req.ProfileIDs, "by", actor)
+	}
+	pins, err := s.listPins(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"pins": pins, "max": s.cfg.MaxPins})
+}
+
+type ErrorInvalidPins string
+
+func (e ErrorInvalidPins) Error() string { return string(e) }
+func (ErrorInvalidPins) InvalidPins()    {}
+
+// setPins replaces all pins with ids in order.
+func (s *Server) setPins(ctx context.Context, ids []string) error {
+	if len(ids) > s.cfg.MaxPins {
+		return ErrorInvalidPins(fmt.Sprintf("at most %d profiles can be pinned", s.cfg.MaxPins))
+	}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] { return ErrorInvalidPins("duplicate profile id " + id) }
+		seen[id] = true
+	}
+	if err := s.writable(); err != nil { return err }
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM profile_pins WHERE true`); err != nil { return err }
+		for i, id := range ids {
+			status, err := s.store.ProfileStatus(store.WithTx(ctx, tx), id)
+			if err != nil { return err }
+			if status != statusActive { return ErrorInvalidPins("profile " + id + " is " + status) }
+			if _, err := tx.ExecContext(ctx, `INSERT INTO profile_pins (profile_id, position) VALUES ($1, $2)`, id, i+1); err != nil { return err }
+		}
+		return nil
+	})
+}
+
+func (s *Server) listPins(ctx context.Context) ([]APIProfile, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id::string, p.full_name, `+profileLocationCols+`, p.description, p.votes_count, p.created_at, p.updated_at
+		FROM profile_pins pp JOIN profiles p ON p.id = pp.profile_id `+profileLocationJoin+`
+		ORDER BY pp.position`)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	list := []APIProfile{}
+	for rows.Next() {
+		p := Profile{Pinned: true}
+		if err := rows.Scan(&p.ID, &p.FullName, &p.Country, &p.City, &p.Description, &p.Votes, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s.apiProfile(p))
+	}
+	return list, rows.Err()
+}
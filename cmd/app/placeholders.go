@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+)
+
+// Photo placeholders: every card's photo is lazy-loaded, so a long page shows empty frames
+// until each arrives. Cards instead start with the photo's average colour and a blurred
+// preview rendered from its BlurHash, inlined in the page and read for all cards at once by
+// loadPlaceholders. Uploads store theirs right away; the photo_placeholders job fills in
+// the rest (older photos, seeded and reprocessed ones).
+
+const (
+	placeholderInterval = time.Minute
+	placeholderBatch    = 100
+)
+
+// storePlaceholder records the placeholder of a profile's stored photo. A photo that cannot
+// be summarized gets an empty one, so the job does not retry it forever.
+func storePlaceholder(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}, profileID string, photo []byte) error {
+	color, hash, err := imaging.Placeholder(photo)
+	if err != nil { color, hash = "", "" }
+	_, err = db.ExecContext(ctx, `
+		UPSERT INTO photo_placeholders (profile_id, color, blurhash) VALUES ($1, $2, $3)
+	`, profileID, color, hash)
+	return err
+}
+
+// fillPlaceholders computes placeholders for photos without one, a batch per run.
+func (s *Server) fillPlaceholders(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id::string FROM profiles p LEFT JOIN photo_placeholders pp ON pp.profile_id = p.id
+		WHERE pp.profile_id IS NULL LIMIT $1
+	`, placeholderBatch)
+	if err != nil { return err }
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil { return err }
+	for _, id := range ids {
+		photo, err := s.store.ReadPhoto(ctx, id)
+		if errors.Is(err, ErrNotFound) { continue } // deleted since
+		if err != nil { return err }
+		if err := storePlaceholder(ctx, s.db, id, photo); err != nil { return err }
+	}
+	return nil
+}
+
+// loadPlaceholders fills PhotoColor and PhotoBlurHash for each profile in one query. Hidden
+// photos get none: a blurred preview of a taken-down photo is still the photo.
+func (s *Server) loadPlaceholders(ctx context.Context, list []Profile) error {
+	if len(list) == 0 { return nil }
+	ids := make([]string, len(list))
+	for i := range list { ids[i] = list[i].ID }
+	found, err := s.store.Placeholders(ctx, ids)
+	if err != nil { return err }
+	for i := range list {
+		if ph, ok := found[list[i].ID]; ok { list[i].PhotoColor, list[i].PhotoBlurHash = ph.Color, ph.BlurHash }
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// Quarantined votes come from sources IP reputation rates high-risk (see reputation.go). To
+// the voter they look cast, so abusers learn nothing; they wait in quarantined_votes until an
+// admin releases them (counted then, as a new vote) or discards them.
+
+type ErrorInvalidQuarantine string
+
+func (e ErrorInvalidQuarantine) Error() string { return string(e) }
+func (ErrorInvalidQuarantine) InvalidQuarantine() {}
+
+// castScreenedVote is castVote for a visitor's own request. IP reputation may ask for a
+// CAPTCHA first (ErrCaptchaRequired) or quarantine the vote.
+func (s *Server) castScreenedVote(r *http.Request, id, token string) error {
+	switch sc := s.screenRequest(r, "vote"); sc.decision {
+	case repChallenge:
+		return ErrCaptchaRequired
+	case repQuarantine:
+		return s.quarantineVote(r.Context(), id, s.visitor(r).current(), s.voterOf(r), sc.score)
+	}
+	err := s.castVote(r.Context(), id, token, s.voterOf(r))
+	if err == nil { s.voteAttributed(r, id) }
+	return err
+}
+
+// quarantineVote keeps a vote for id aside. It fails like castVote for unknown, retired and
+// profiles and over the vote limits, so a quarantined voter sees the same answers as anyone else.
+func (s *Server) quarantineVote(ctx context.Context, id, visitor string, v voter, score int) error {
+	if err := s.writable(); err != nil { return err }
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		status, err := s.store.ProfileStatus(store.WithTx(ctx, tx), id)
+		if err != nil { return err }
+		switch status {
+		case statusActive:
+		case statusRetired:
+			return ErrRetired
+		default:
+			return ErrNotFound
+		}
+		if err := s.checkVoteLimits(store.WithTx(ctx, tx), id, v); err != nil { return err }
+		_, err = tx.ExecContext(ctx, `INSERT INTO quarantined_votes (profile_id, visitor, score, source) VALUES ($1, $2, $3, $4)`,
+			id, visitor, score, s.cfg.IPReputation)
+		return err
+	})
+}
+
+// resolveQuarantinedVote releases (counts) or discards a pending quarantined vote. Release
+// skips the cooldown, like imported votes, but not a retirement since.
+func (s *Server) resolveQuarantinedVote(ctx context.Context, id, action, actor string) error {
+	status := map[string]string{"release": "released", "discard": "discarded"}[action]
+	if status == "" { return ErrorInvalidQuarantine("action must be release or discard") }
+	if err := s.writable(); err != nil { return err }
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var profileID string
+		err := tx.QueryRowContext(ctx, `
+			UPDATE quarantined_votes SET status = $2, resolved_by = $3, resolved_at = now()
+			WHERE id = $1 AND status = 'pending'
+			RETURNING profile_id::string
+		`, id, status, actor).Scan(&profileID)
+		if errors.Is(err, sql.ErrNoRows) {
+			var exists bool
+			if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM quarantined_votes WHERE id = $1)`, id).Scan(&exists); err != nil { return err }
+			if exists { return ErrorInvalidQuarantine("this vote was already resolved") }
+			return ErrNotFound
+		}
+		if err != nil || status == "discarded" { return err }
+		return s.recordVote(store.WithTx(ctx, tx), profileID, "", voter{})
+	})
+	if err == nil && status == "released" { s.voteRecorded(ctx) }
+	return err
+}
+
+// APIQuarantinedVote is one quarantined vote in the admin API.
+type APIQuarantinedVote struct {
+	ID         string     `json:"id"`
+	ProfileID  string     `json:"profile_id"`
+	FullName   string     `json:"full_name"`
+	Visitor    string     `json:"visitor"`
+	Score      int        `json:"score"`
+	Source     string     `json:"source"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+}
+
+// handleAPIAdminQuarantine lists quarantined votes, newest first:
+// GET /api/v1/admin/votes/quarantine?status=pending&limit=100
+func (s *Server) handleAPIAdminQuarantine(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" { status = "pending" }
+	if status != "pending" && status != "released" && status != "discarded" {
+		writeJSONError(w, http.StatusBadRequest, "status must be pending, released or discarded")
+		return
+	}
+	rows, err := s.db.QueryContext(r.Context(), `
+		SELECT q.id::string, q.profile_id::string, p.full_name, q.visitor, q.score, q.source, q.status, q.created_at, q.resolved_at, q.resolved_by
+		FROM quarantined_votes q JOIN profiles p ON p.id = q.profile_id
+		WHERE q.status = $1 ORDER BY q.created_at DESC LIMIT $2
+	`, status, clampAtoi(r.URL.Query().Get("limit"), 1, 1000, 100))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	defer rows.Close()
+	list := []APIQuarantinedVote{}
+	for rows.Next() {
+		var v APIQuarantinedVote
+		if err := rows.Scan(&v.ID, &v.ProfileID, &v.FullName, &v.Visitor, &v.Score, &v.Source, &v.Status, &v.CreatedAt, &v.ResolvedAt, &v.ResolvedBy); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		list = append(list, v)
+	}
+	if err := rows.Err(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"votes": list})
+}
+
+// handleAPIAdminQuarantinedVote releases or discards one: PUT /api/v1/admin/votes/quarantine/{id}
+// {"action": "release"}.
+func (s *Server) handleAPIAdminQuarantinedVote(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action string `json:"action"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad json")
+		return
+	}
+	id := pathID(r)
+	actor, _ := s.adminActor(r)
+	err := s.resolveQuarantinedVote(r.Context(), id, req.Action, actor)
+	switch {
+	case errors.As(err, new(interface{ InvalidQuarantine() })):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "not found")
+	case errors.As(err, new(interface{ Retired() })):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+	default:
+		s.log.Info("quarantined vote resolved", "vote", id, "action", req.Action, "by", actor)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// Query timeouts: every connection runs with statement_timeout (LEADERBOARD_DB_STATEMENT_TIMEOUT)
+// so no query holds a connection for minutes, whoever issued it, and leaderboard listings (the
+// home page, search, the fragments and /api/v1/profiles) run under a shorter deadline of their
+// own (LEADERBOARD_SEARCH_TIMEOUT). Either way the database cancels the query and visitors get
+// a "search took too long" page rather than a generic error.
+
+// queryTimeoutStats counts cancelled queries on /debug/vars: "search" for listings past their
+// deadline, "statement" for statement_timeout elsewhere.
+var queryTimeoutStats = expvar.NewMap("query_timeouts")
+
+type ErrorQueryTimeout string
+
+func (e ErrorQueryTimeout) Error() string { return string(e) }
+func (ErrorQueryTimeout) QueryTimeout()   {}
+
+const ErrQueryTimeout ErrorQueryTimeout = "query took too long"
+
+// withStatementTimeout adds statement_timeout d to the connection string dsn, as the session
+// option CockroachDB and PostgreSQL both accept. dsn is left alone when d is 0 or dsn already
+// sets statement_timeout.
+func withStatementTimeout(dsn string, d time.Duration) string {
+	if d <= 0 || strings.Contains(dsn, "statement_timeout") { return dsn }
+	opt := fmt.Sprintf("-c statement_timeout=%d", d.Milliseconds())
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil { return dsn } // sql.Open reports it
+		q := u.Query()
+		q.Set("options", strings.TrimSpace(q.Get("options")+" "+opt))
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " options='" + opt + "'"
+}
+
+// searchContext bounds a listing query by LEADERBOARD_SEARCH_TIMEOUT.
+func (s *Server) searchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.cfg.SearchTimeout <= 0 { return context.WithCancel(ctx) }
+	return context.WithTimeout(ctx, s.cfg.SearchTimeout)
+}
+
+// queryTimeout turns a query cancelled for taking too long, by a context deadline or by
+// statement_timeout (SQLSTATE 57014), into ErrQueryTimeout; other errors pass through.
+func queryTimeout(err error) error {
+	if err == nil { return nil }
+	if errors.Is(err, context.DeadlineExceeded) {
+		queryTimeoutStats.Add("search", 1)
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "57014" {
+		queryTimeoutStats.Add("statement", 1)
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	}
+	return err
+}
+
+// isQueryTimeout reports whether err is (or wraps) ErrQueryTimeout.
+func isQueryTimeout(err error) bool {
+	return errors.As(err, new(interface{ QueryTimeout() }))
+}
+
+// writeSearchTimeout answers a listing whose query timed out: the "search took too long" page,
+// or a JSON error under /api/. Both are 503 with Retry-After, since a retry may well succeed
+// once the database is less busy.
+func (s *Server) writeSearchTimeout(w http.ResponseWriter, r *http.Request, f profileFilter) {
+	s.log.Warn("listing query timed out", "q", f.Query, "country", f.Country, "request_id", requestID(r))
+	w.Header().Set("Retry-After", "10")
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeJSONError(w, http.StatusServiceUnavailable, "search took too long; try again or narrow it down")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.renderStatus(w, http.StatusServiceUnavailable, "search_timeout.gohtml", views.SearchTimeoutView{Query: f.Query, Country: f.Country})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestWithStatementTimeout(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		d    time.Duration
+		want string
+	}{
+		{"postgresql://root@db:26257/bestfriends?sslmode=disable", 30 * time.Second,
+			"postgresql://root@db:26257/bestfriends?options=-c+statement_timeout%3D30000&sslmode=disable"},
+		{"postgres://db/x?options=-c+search_path%3Dapp", time.Second,
+			"postgres://db/x?options=-c+search_path%3Dapp+-c+statement_timeout%3D1000"},
+		{"host=db dbname=bestfriends", 1500 * time.Millisecond, "host=db dbname=bestfriends options='-c statement_timeout=1500'"},
+		{"postgresql://db/x", 0, "postgresql://db/x"},
+		{"postgresql://db/x?options=-c+statement_timeout%3D5000", time.Second, "postgresql://db/x?options=-c+statement_timeout%3D5000"},
+	}
+	for _, tt := range tests {
+		if got := withStatementTimeout(tt.dsn, tt.d); got != tt.want {
+			t.Errorf("withStatementTimeout(%q, %v) = %q, want %q", tt.dsn, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("scan: %w", context.DeadlineExceeded), true},
+		{&pq.Error{Code: "57014", Message: "query execution canceled due to statement timeout"}, true},
+		{&pq.Error{Code: "23505"}, false},
+		{context.Canceled, false},
+		{errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		err := queryTimeout(tt.err)
+		if got := isQueryTimeout(err); got != tt.want {
+			t.Errorf("queryTimeout(%v): timeout %v, want %v", tt.err, got, tt.want)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) { t.Errorf("queryTimeout(%v) lost the cause: %v", tt.err, err) }
+	}
+}
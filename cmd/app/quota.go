@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+	"github.com/lib/pq"
+)
+
+type ErrorQuotaExceeded string
+
+func (e ErrorQuotaExceeded) Error() string { return string(e) }
+func (ErrorQuotaExceeded) QuotaExceeded()  {}
+
+const ErrQuotaExceeded ErrorQuotaExceeded = "daily profile limit reached"
+
+// clientIP is the address the request came from. Behind a proxy (LEADERBOARD_TRUST_PROXY)
+// it is the last X-Forwarded-For entry: the one our proxy appended, which clients can't forge.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.cfg.TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil { return r.RemoteAddr }
+	return host
+}
+
+// quotaResetsAt is when today's creation quota starts over: the next UTC midnight.
+func quotaResetsAt(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// checkCreateQuota reports early whether visitor is already out of creations today, so the
+// upload isn't processed for nothing. The binding check is takeCreateQuota.
+func (s *Server) checkCreateQuota(ctx context.Context, visitor visitorIDs) error {
+	if s.cfg.CreateLimitPerDay <= 0 { return nil }
+	n, err := s.createQuotaUsed(ctx, visitor)
+	if err != nil { return err }
+	if n >= s.cfg.CreateLimitPerDay { return ErrQuotaExceeded }
+	return nil
+}
+
+// createQuotaUsed counts the profiles visitor created today.
+func (s *Server) createQuotaUsed(ctx context.Context, visitor visitorIDs) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT coalesce(sum(count), 0) FROM profile_creations WHERE visitor = ANY($1) AND day = (now() AT TIME ZONE 'UTC')::date
+	`, pq.Array(visitor)).Scan(&n)
+	return n, err
+}
+
+// takeCreateQuota counts one creation for visitor inside the creating transaction; over the
+// limit it fails and the rollback undoes the increment along with the insert. The counter is
+// kept under the current visitor id; ones made with earlier keys today still count.
+func (s *Server) takeCreateQuota(ctx context.Context, tx *sql.Tx, visitor visitorIDs) error {
+	if s.cfg.CreateLimitPerDay <= 0 { return nil }
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO profile_creations (visitor, day, count) VALUES ($1, (now() AT TIME ZONE 'UTC')::date, 1)
+		ON CONFLICT (visitor, day) DO UPDATE SET count = profile_creations.count + 1
+	`, visitor.current()); err != nil { return err }
+	var n int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT sum(count) FROM profile_creations WHERE visitor = ANY($1) AND day = (now() AT TIME ZONE 'UTC')::date
+	`, pq.Array(visitor)).Scan(&n); err != nil { return err }
+	if n > s.cfg.CreateLimitPerDay { return ErrQuotaExceeded }
+	return nil
+}
+
+// writeQuotaExceeded answers 429 with the page explaining when the visitor may add again.
+func (s *Server) writeQuotaExceeded(w http.ResponseWriter, r *http.Request) {
+	resets := quotaResetsAt(time.Now())
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(resets).Seconds())+1))
+	if strings.Contains(r.Header.Get("Accept"), "application/json") || strings.HasPrefix(r.URL.Path, "/api/") {
+		writeJSONError(w, http.StatusTooManyRequests, ErrQuotaExceeded.Error())
+		return
+	}
+	s.renderStatus(w, http.StatusTooManyRequests, "quota.gohtml", views.QuotaView{Limit: s.cfg.CreateLimitPerDay, ResetsAt: resets})
+}
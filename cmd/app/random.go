@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Random picks come from the ids of all active profiles, kept in memory and refreshed every
+// randomPoolTTL: every profile is equally likely, and a pick costs no query. Picking in SQL
+// is either a full sort (ORDER BY random()) or biased (the first id after a random UUID
+// favours profiles after large gaps). Profiles added since the last refresh are not picked
+// yet; ones retired or held since are dropped when their rows are loaded.
+
+const randomPoolTTL = time.Minute
+
+type randomPool struct {
+	mu     sync.Mutex
+	ids    []string
+	loaded time.Time
+}
+
+// randomProfileIDs returns up to n distinct active profile ids in random order.
+func (s *Server) randomProfileIDs(ctx context.Context, n int) ([]string, error) {
+	ids, err := s.randomPoolIDs(ctx)
+	if err != nil { return nil, err }
+	return pickRandom(ids, n), nil
+}
+
+// randomPoolIDs returns the pooled ids, refreshing them when stale. Callers must not modify
+// the slice.
+func (s *Server) randomPoolIDs(ctx context.Context) ([]string, error) {
+	p := &s.randomPool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ids != nil && time.Since(p.loaded) < randomPoolTTL { return p.ids, nil }
+	rows, err := s.db.QueryContext(ctx, `SELECT id::string FROM profiles WHERE status = $1`, statusActive)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil { return nil, err }
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil { return nil, err }
+	p.ids, p.loaded = ids, time.Now()
+	return ids, nil
+}
+
+// pickRandom returns min(n, len(ids)) distinct elements of ids, uniformly, in random order.
+func pickRandom(ids []string, n int) []string {
+	n = min(n, len(ids))
+	out := make([]string, 0, n)
+	if n*2 >= len(ids) {
+		for _, i := range rand.Perm(len(ids))[:n] { out = append(out, ids[i]) }
+		return out
+	}
+	seen := make(map[int]bool, n)
+	for len(out) < n {
+		i := rand.IntN(len(ids))
+		if !seen[i] { seen[i], out = true, append(out, ids[i]) }
+	}
+	return out
+}
+
+// maxRandomProfiles caps GET /api/v1/profiles/random?n=.
+const maxRandomProfiles = 50
+
+// handleRandom redirects to a random active profile's page: GET /random. Every response
+// picks again, so it must not be cached. With no profiles it goes to the home page.
+func (s *Server) handleRandom(w http.ResponseWriter, r *http.Request) {
+	ids, err := s.randomProfileIDs(r.Context(), 1)
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	target := "/"
+	if len(ids) > 0 { target = "/profiles/" + ids[0] }
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleAPIRandomProfiles returns up to n distinct random active profiles:
+// GET /api/v1/profiles/random?n=5 (default 1, at most 50).
+func (s *Server) handleAPIRandomProfiles(w http.ResponseWriter, r *http.Request) {
+	n := clampAtoi(r.URL.Query().Get("n"), 1, maxRandomProfiles, 1)
+	ids, err := s.randomProfileIDs(r.Context(), n)
+	if err == nil {
+		var profiles []Profile
+		if profiles, err = s.loadProfilesByID(r.Context(), ids); err == nil {
+			list := make([]APIProfile, 0, len(profiles))
+			for _, p := range profiles { list = append(list, s.apiProfile(p)) }
+			w.Header().Set("Cache-Control", "no-store")
+			writeJSON(w, http.StatusOK, map[string]any{"profiles": list})
+			return
+		}
+	}
+	writeJSONError(w, http.StatusInternalServerError, "query error")
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Rank deltas: cards carry a ▲/▼ badge with the places a profile gained or lost since the
+// start of the UTC day. The rank_snapshots job records every active profile's rank once per
+// day (whichever replica gets there first); cards compare their current rank with it.
+
+// rankSnapshotInterval is how often the job checks whether today has a snapshot yet, so a
+// new day's is taken at most this late.
+const rankSnapshotInterval = 10 * time.Minute
+
+// snapshotRanks takes today's rank snapshot unless another replica already has.
+func (s *Server) snapshotRanks(ctx context.Context) error {
+	took, err := s.store.SnapshotRanks(ctx, time.Now().UTC().Truncate(24*time.Hour))
+	if took { s.log.Info("rank snapshot taken") }
+	return err
+}
+
+// loadRankDeltas fills RankDelta for each active profile of list ranked in the newest
+// snapshot; profiles that are new since keep 0 and show no badge.
+func (s *Server) loadRankDeltas(ctx context.Context, list []Profile) error {
+	if len(list) == 0 { return nil }
+	ids := make([]string, 0, len(list))
+	for _, p := range list {
+		if !p.Retired { ids = append(ids, p.ID) }
+	}
+	deltas, err := s.store.RankDeltas(ctx, ids)
+	if err != nil { return err }
+	for i := range list { list[i].RankDelta = deltas[list[i].ID] }
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API responses on limited routes tell clients where they stand, so they can pace themselves
+// instead of running into 429s: POST /api/v1/profiles reports the daily creation quota, and
+// POST /api/v1/profiles/{id}/vote the vote limits (see voters.go). Both the common
+// X-RateLimit-* headers (Reset as Unix time) and the IETF draft's RateLimit-* headers (Reset
+// in seconds, RateLimit-Policy listing every limit) describe the limit closest to running
+// out. Routes without a limit send none.
+
+// rateLimit is one limit a request counts against: Limit requests per Window, Remaining of
+// them left until Reset, when the oldest counted request drops out of the window.
+type rateLimit struct {
+	Limit     int
+	Remaining int
+	Window    time.Duration
+	Reset     time.Time
+}
+
+// binding picks the limit that runs out first: the fewest remaining, then the latest reset.
+func binding(limits []rateLimit) rateLimit {
+	b := limits[0]
+	for _, l := range limits[1:] {
+		if l.Remaining < b.Remaining || l.Remaining == b.Remaining && l.Reset.After(b.Reset) { b = l }
+	}
+	return b
+}
+
+// writeRateLimits sets the rate limit headers for limits as of now, which is the clock the
+// limits were read with. It does nothing without limits.
+func writeRateLimits(w http.ResponseWriter, now time.Time, limits ...rateLimit) {
+	if len(limits) == 0 { return }
+	b := binding(limits)
+	reset := max(0, int(math.Ceil(b.Reset.Sub(now).Seconds())))
+	policies := make([]string, len(limits))
+	for i, l := range limits { policies[i] = fmt.Sprintf("%d;w=%d", l.Limit, int(l.Window/time.Second)) }
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(b.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(b.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Duration(reset)*time.Second).Unix(), 10))
+	h.Set("RateLimit-Limit", strconv.Itoa(b.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(b.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("RateLimit-Policy", strings.Join(policies, ", "))
+	if b.Remaining == 0 && reset > 0 { h.Set("Retry-After", strconv.Itoa(reset)) }
+}
+
+// createRateLimits is where r's visitor stands against the daily creation quota; none when
+// the quota is off.
+func (s *Server) createRateLimits(r *http.Request) (time.Time, []rateLimit, error) {
+	now := time.Now()
+	if s.cfg.CreateLimitPerDay <= 0 { return now, nil, nil }
+	n, err := s.createQuotaUsed(r.Context(), s.visitor(r))
+	if err != nil { return now, nil, err }
+	return now, []rateLimit{{Limit: s.cfg.CreateLimitPerDay, Remaining: max(0, s.cfg.CreateLimitPerDay-n), Window: 24 * time.Hour,
+		Reset: quotaResetsAt(now)}}, nil
+}
+
+// voteRateLimits is where v stands against the vote limits for profile id, read with the
+// database's clock: one vote per vote cooldown, whose reset is the cooldown v has left, and
+// the profile's vote_profile_cap when there is one. voted says v's vote was just taken; a
+// quarantined one isn't in votes, and counting it here keeps the answer the same.
+func (s *Server) voteRateLimits(ctx context.Context, id string, v voter, voted bool) (time.Time, []rateLimit, error) {
+	cooldown := s.settings.GetDuration(settingVoteCooldown)
+	limit := s.settings.GetInt(settingVoteCap)
+	rv, err := s.store.RecentVotes(ctx, id, v.ids, cooldown, limit)
+	if err != nil { return rv.Now, nil, err }
+	now, last, oldest, recent := rv.Now, rv.Last, rv.Oldest, rv.Count
+	if voted && last == nil {
+		last = &now
+		recent++
+		if oldest == nil { oldest = &now }
+	}
+	own := rateLimit{Limit: 1, Remaining: 1, Window: cooldown, Reset: now}
+	if last != nil { own.Remaining, own.Reset = 0, last.Add(cooldown) }
+	limits := []rateLimit{own}
+	if limit > 0 {
+		capped := rateLimit{Limit: limit, Remaining: max(0, limit-recent), Window: cooldown, Reset: now}
+		if oldest != nil { capped.Reset = oldest.Add(cooldown) }
+		limits = append(limits, capped)
+	}
+	return now, limits, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWriteRateLimits(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	w := httptest.NewRecorder()
+	writeRateLimits(w, now)
+	if len(w.Header()) != 0 { t.Fatalf("headers without limits: %v", w.Header()) }
+
+	// The voter may vote again, but the profile took its 60 votes and takes more in 10 minutes.
+	w = httptest.NewRecorder()
+	writeRateLimits(w, now,
+		rateLimit{Limit: 1, Remaining: 1, Window: time.Hour, Reset: now},
+		rateLimit{Limit: 60, Remaining: 0, Window: time.Hour, Reset: now.Add(10*time.Minute - 500*time.Millisecond)})
+	want := map[string]string{
+		"X-RateLimit-Limit": "60", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10),
+		"RateLimit-Limit": "60", "RateLimit-Remaining": "0", "RateLimit-Reset": "600", "RateLimit-Policy": "1;w=3600, 60;w=3600",
+		"Retry-After": "600",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v { t.Errorf("%s = %q, want %q", k, got, v) }
+	}
+
+	// Having voted, the voter's cooldown binds: both are out, and it resets later.
+	w = httptest.NewRecorder()
+	writeRateLimits(w, now,
+		rateLimit{Limit: 60, Remaining: 0, Window: time.Hour, Reset: now.Add(time.Minute)},
+		rateLimit{Limit: 1, Remaining: 0, Window: time.Hour, Reset: now.Add(time.Hour)})
+	if h := w.Header(); h.Get("RateLimit-Limit") != "1" || h.Get("RateLimit-Reset") != "3600" || h.Get("Retry-After") != "3600" {
+		t.Errorf("headers = %v", h)
+	}
+
+	// A reset in the past (clock skew) is now.
+	w = httptest.NewRecorder()
+	writeRateLimits(w, now, rateLimit{Limit: 10, Remaining: 0, Window: 24 * time.Hour, Reset: now.Add(-time.Second)})
+	if h := w.Header(); h.Get("RateLimit-Reset") != "0" || h.Get("Retry-After") != "" || h.Get("RateLimit-Policy") != "10;w=86400" {
+		t.Errorf("headers = %v", h)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// readOnlyState records why the server refuses writes. Maintenance is switched by
+// LEADERBOARD_READ_ONLY or the admin API; schema is set at startup when the database schema
+// is newer than this build (see checkSchema). Both are per-instance.
+type readOnlyState struct {
+	maintenance atomic.Bool
+	schema      atomic.Bool
+}
+
+func (ro *readOnlyState) active() bool { return ro.maintenance.Load() || ro.schema.Load() }
+
+type ErrorReadOnly string
+
+func (e ErrorReadOnly) Error() string { return string(e) }
+func (ErrorReadOnly) ReadOnly()       {}
+
+const ErrReadOnly ErrorReadOnly = "read-only"
+
+// writable is checked by every function that changes data, so writes that don't come through
+// an HTTP handler (jobs, future callers) respect read-only mode as well.
+func (s *Server) writable() error {
+	if s.readOnly.active() { return ErrReadOnly }
+	return nil
+}
+
+const readOnlyMessage = "The leaderboard is in read-only maintenance mode. Browsing works; adding exhibits and voting are paused. Please try again later."
+
+// readOnlyGuard rejects mutating requests with 503 while the server is read-only. The admin
+// toggle stays reachable so maintenance can be switched off again.
+func (s *Server) readOnlyGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.readOnly.active() && r.Method != http.MethodGet && r.Method != http.MethodHead && r.URL.Path != "/api/v1/admin/read-only" {
+			writeReadOnly(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeReadOnly(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "60")
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeJSONError(w, http.StatusServiceUnavailable, "read-only: maintenance in progress")
+		return
+	}
+	http.Error(w, readOnlyMessage, http.StatusServiceUnavailable)
+}
+
+// handleAPIAdminReadOnly reads (GET) or sets (PUT {"read_only": bool}) maintenance mode on
+// this instance. It cannot lift the read-only mode caused by a schema mismatch.
+func (s *Server) handleAPIAdminReadOnly(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req struct {
+			ReadOnly *bool `json:"read_only"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.ReadOnly == nil {
+			writeJSONError(w, http.StatusBadRequest, `expected {"read_only": true|false}`)
+			return
+		}
+		if s.readOnly.maintenance.Swap(*req.ReadOnly) != *req.ReadOnly {
+			actor, _ := s.adminActor(r)
+			s.log.Warn("read-only maintenance changed", "read_only", *req.ReadOnly, "by", actor)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{
+		"read_only":       s.readOnly.active(),
+		"maintenance":     s.readOnly.maintenance.Load(),
+		"schema_mismatch": s.readOnly.schema.Load(),
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// After a plain-form vote from the home page the voter lands on a receipt: the profile's
+// rank and count as they stand after the vote, and links to share it. The vote POST still
+// redirects (POST/redirect/GET), to the receipt instead of the home page, so a reload doesn't
+// vote again. LEADERBOARD_VOTE_REDIRECT keeps the instant redirect home; htmx votes swap the
+// card in place either way.
+
+func voteReceiptURL(id string) string {
+	return "/profiles/" + url.PathEscape(id) + "/receipt"
+}
+
+// profileRank returns profile id's place on the active leaderboard (votes, then newest first,
+// as listed) and the number of active profiles.
+func profileRank(ctx context.Context, db *sql.DB, id string) (rank, total int, err error) {
+	err = db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT count(*) + 1 FROM profiles o
+				WHERE o.status = 'active' AND o.id != p.id
+					AND (o.votes_count > p.votes_count OR (o.votes_count = p.votes_count AND o.created_at > p.created_at))),
+			(SELECT count(*) FROM profiles WHERE status = 'active')
+		FROM profiles p WHERE p.id = $1
+	`, id).Scan(&rank, &total)
+	if errors.Is(err, sql.ErrNoRows) { return 0, 0, ErrNotFound }
+	return rank, total, err
+}
+
+// absoluteURL is path on this site as others reach it: under LEADERBOARD_PUBLIC_URL when set,
+// else on the host r came to.
+func (s *Server) absoluteURL(r *http.Request, path string) string {
+	if s.cfg.PublicURL != "" { return strings.TrimRight(s.cfg.PublicURL, "/") + path }
+	scheme := "http"
+	if r.TLS != nil { scheme = "https" }
+	return scheme + "://" + r.Host + path
+}
+
+// shareLinks are the share buttons for text and link u.
+func shareLinks(text, u string) []views.ShareLink {
+	return []views.ShareLink{
+		{Name: "X", URL: "https://twitter.com/intent/tweet?" + url.Values{"text": {text}, "url": {u}}.Encode()},
+		{Name: "Facebook", URL: "https://www.facebook.com/sharer/sharer.php?" + url.Values{"u": {u}}.Encode()},
+		{Name: "WhatsApp", URL: "https://wa.me/?" + url.Values{"text": {text + " " + u}}.Encode()},
+		{Name: "Email", URL: "mailto:?subject=" + mailtoEscape(text) + "&body=" + mailtoEscape(u)},
+	}
+}
+
+// mailtoEscape escapes s for a mailto header, where mail clients read "+" literally.
+func mailtoEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// handleVoteReceipt is the receipt: GET /profiles/{id}/receipt. It shows the current standing,
+// so it is never cached; held profiles are not found, like their pages.
+func (s *Server) handleVoteReceipt(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	status, err := s.store.ProfileStatus(r.Context(), id)
+	if err == nil && status == statusHeld { err = ErrNotFound }
+	var list []Profile
+	if err == nil { list, err = s.loadProfiles(r.Context(), profileFilter{ID: id, Limit: 1}) }
+	if err == nil && len(list) == 0 { err = ErrNotFound }
+	var rank, total int
+	if err == nil { rank, total, err = profileRank(r.Context(), s.db, id) }
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	pv := profileView(list[0])
+	v := views.VoteReceiptView{Profile: pv, Rank: rank, Total: total, ShareURL: s.absoluteURL(r, profilePagePath(list[0]))}
+	if pv.Retired {
+		v.Rank = 0
+	} else {
+		v.ShareText = fmt.Sprintf("I voted for %s: #%d with %s on %s", pv.FullName, rank, plural(pv.Votes, "vote"), s.site().Title)
+		v.Shares = shareLinks(v.ShareText, v.ShareURL)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.render(w, "vote_receipt.gohtml", v)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestShareLinks(t *testing.T) {
+	links := shareLinks("I voted for Rex & Co: #2", "https://board.example/profiles/p1")
+	if len(links) != 4 { t.Fatalf("got %d links", len(links)) }
+	for _, l := range links {
+		u, err := url.Parse(l.URL)
+		if err != nil { t.Fatalf("%s: %v", l.Name, err) }
+		if u.Scheme != "https" && u.Scheme != "mailto" { t.Errorf("%s: scheme %q", l.Name, u.Scheme) }
+		raw, _ := url.QueryUnescape(u.RawQuery)
+		if !strings.Contains(raw, "https://board.example/profiles/p1") { t.Errorf("%s: link missing from %q", l.Name, l.URL) }
+	}
+	if q, _ := url.ParseQuery(strings.SplitN(links[3].URL, "?", 2)[1]); q.Get("subject") != "I voted for Rex & Co: #2" {
+		t.Errorf("email subject = %q", q.Get("subject"))
+	}
+	if q, _ := url.ParseQuery(strings.SplitN(links[0].URL, "?", 2)[1]); q.Get("text") != "I voted for Rex & Co: #2" {
+		t.Errorf("X text = %q", q.Get("text"))
+	}
+}
+
+func TestAbsoluteURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/profiles/p1/receipt", nil)
+	r.Host = "localhost:8080"
+	s := &Server{}
+	if got := s.absoluteURL(r, "/profiles/p1"); got != "http://localhost:8080/profiles/p1" { t.Errorf("got %q", got) }
+	s.cfg.PublicURL = "https://board.example/"
+	if got := s.absoluteURL(r, "/profiles/p1"); got != "https://board.example/profiles/p1" { t.Errorf("got %q", got) }
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// voteRecount compares each profile's stored votes_count with the votes on record: its counted
+// rows in votes (archived votes were subtracted when reset).
+const voteRecount = `
+	SELECT p.id, p.full_name, p.votes_count, coalesce(v.n, 0) AS recounted
+	FROM profiles p
+	LEFT JOIN (SELECT profile_id, count(*) AS n FROM votes WHERE counted GROUP BY profile_id) v ON v.profile_id = p.id`
+
+// voteDrift is one profile whose votes_count disagrees with its recount.
+type voteDrift struct {
+	ID        string
+	FullName  string
+	Stored    int
+	Recounted int
+}
+
+// reconcile lists profiles whose votes_count drifted from the vote tables and, when apply is
+// set, rewrites them to the recount in one transaction (after counting buffered votes), then
+// refreshes the champions. Profiles with votes older than the vote tables would be lowered to
+// what is on record, which is why the default only lists.
+func (s *Server) reconcile(ctx context.Context, apply bool) error {
+	var drift []voteDrift
+	scan := func(rows *sql.Rows, err error) error {
+		if err != nil { return err }
+		defer rows.Close()
+		drift = drift[:0]
+		for rows.Next() {
+			var d voteDrift
+			if err := rows.Scan(&d.ID, &d.FullName, &d.Stored, &d.Recounted); err != nil { return err }
+			drift = append(drift, d)
+		}
+		return rows.Err()
+	}
+	if !apply {
+		if err := scan(s.db.QueryContext(ctx, `SELECT id::string, full_name, votes_count, recounted FROM (`+voteRecount+`) WHERE votes_count != recounted ORDER BY id`)); err != nil { return err }
+		for _, d := range drift {
+			s.log.Info("drift", "profile", d.ID, "name", d.FullName, "stored", d.Stored, "recounted", d.Recounted)
+		}
+		s.log.Info("reconcile preview; rerun with -yes to apply", "profiles", len(drift))
+		return nil
+	}
+	if err := s.writable(); err != nil { return err }
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if err := s.store.FlushVotes(store.WithTx(ctx, tx)); err != nil { return err }
+		return scan(tx.QueryContext(ctx, `
+			WITH drift AS (SELECT * FROM (`+voteRecount+`) WHERE votes_count != recounted),
+			fixed AS (
+				UPDATE profiles p SET votes_count = d.recounted, updated_at = now()
+				FROM drift d WHERE p.id = d.id
+				RETURNING p.id
+			)
+			SELECT d.id::string, d.full_name, d.votes_count, d.recounted FROM drift d JOIN fixed f ON f.id = d.id ORDER BY d.id
+		`))
+	})
+	if err != nil { return err }
+	for _, d := range drift {
+		s.log.Info("corrected", "profile", d.ID, "name", d.FullName, "from", d.Stored, "to", d.Recounted)
+	}
+	s.log.Info("reconciled", "profiles", len(drift))
+	if len(drift) == 0 { return nil }
+	return s.refreshChampions(ctx)
+}
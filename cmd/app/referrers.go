@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+	"github.com/lib/pq"
+)
+
+// Vote referrers: each counted vote is attributed to where the voter came from, scrubbed to a
+// domain and a campaign name, counted in memory and added to vote_referrers (per profile and
+// UTC day) by the vote_referrers job. /admin/referrers shows the top sources and campaigns.
+//
+// The source is the referring page's domain when that page is on another site, else its
+// utm_source; the campaign is utm_campaign. Both are read from the vote request's URL first,
+// then from its Referer: a vote form posts from this site, so a campaign survives when the
+// landing page keeps its utm_ parameters. Paths, other parameters and visitor ids are never kept.
+
+const (
+	voteReferrersInterval  = time.Minute
+	voteReferrersRetention = 90 * 24 * time.Hour
+	maxAttributionLen      = 64
+)
+
+// voteAttribution is where a vote came from; "" fields are unknown.
+type voteAttribution struct {
+	source, campaign string
+}
+
+// attribution scrubs r's referring page down to a voteAttribution.
+func (s *Server) attribution(r *http.Request) voteAttribution {
+	var a voteAttribution
+	ref, _ := url.Parse(r.Referer())
+	if ref == nil { ref = &url.URL{} }
+	param := func(name string) string {
+		if v := scrubLabel(r.URL.Query().Get(name)); v != "" { return v }
+		return scrubLabel(ref.Query().Get(name))
+	}
+	host := strings.TrimPrefix(strings.ToLower(ref.Hostname()), "www.")
+	own := strings.TrimPrefix(strings.ToLower(hostOnly(r.Host)), "www.")
+	if u, err := url.Parse(s.cfg.PublicURL); err == nil && host == strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") { host = own }
+	if host != "" && host != own && len(host) <= maxAttributionLen {
+		a.source = host
+	} else {
+		a.source = param("utm_source")
+	}
+	a.campaign = param("utm_campaign")
+	return a
+}
+
+// scrubLabel lowercases a utm_ value and keeps it only when it is a short plain label
+// (letters, digits, dot, dash, underscore), so free text and ids don't end up in the rollup.
+func scrubLabel(v string) string {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if len(v) > maxAttributionLen { return "" }
+	for _, c := range v {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') { return "" }
+	}
+	return v
+}
+
+type referralKey struct {
+	profileID string
+	voteAttribution
+}
+
+// voteReferrals holds the vote counts not yet written to vote_referrers.
+type voteReferrals struct {
+	mu     sync.Mutex
+	counts map[referralKey]int64
+}
+
+func (v *voteReferrals) add(k referralKey, n int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.counts == nil { v.counts = map[referralKey]int64{} }
+	v.counts[k] += n
+}
+
+// take returns the pending counts and starts afresh.
+func (v *voteReferrals) take() map[referralKey]int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	counts := v.counts
+	v.counts = nil
+	return counts
+}
+
+// voteAttributed counts a vote for profile id that r cast.
+func (s *Server) voteAttributed(r *http.Request, id string) {
+	s.referrals.add(referralKey{id, s.attribution(r)}, 1)
+}
+
+// flushVoteReferrers adds the pending counts to today's vote_referrers rows and drops rows past
+// voteReferrersRetention. Counts for profiles deleted in the meantime are discarded.
+func (s *Server) flushVoteReferrers(ctx context.Context) error {
+	counts := s.referrals.take()
+	if len(counts) > 0 {
+		var ids, sources, campaigns []string
+		var votes []int64
+		for k, n := range counts {
+			ids, sources, campaigns = append(ids, k.profileID), append(sources, k.source), append(campaigns, k.campaign)
+			votes = append(votes, n)
+		}
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO vote_referrers AS t (day, profile_id, source, campaign, votes)
+			SELECT current_date(), c.id, c.source, c.campaign, c.votes
+			FROM unnest($1::uuid[], $2::string[], $3::string[], $4::int8[]) AS c(id, source, campaign, votes)
+			JOIN profiles p ON p.id = c.id
+			ON CONFLICT (day, profile_id, source, campaign) DO UPDATE SET votes = t.votes + excluded.votes
+		`, pq.Array(ids), pq.Array(sources), pq.Array(campaigns), pq.Array(votes))
+		if err != nil {
+			for k, n := range counts { s.referrals.add(k, n) }
+			return err
+		}
+	}
+	_, err := s.db.ExecContext(ctx, `DELETE FROM vote_referrers WHERE day < $1::date`, time.Now().UTC().Add(-voteReferrersRetention))
+	return err
+}
+
+// APIVoteReferrer is the votes of one source, campaign or profile over the requested days.
+type APIVoteReferrer struct {
+	Source    string `json:"source,omitempty"`
+	Campaign  string `json:"campaign,omitempty"`
+	ProfileID string `json:"profile_id,omitempty"`
+	FullName  string `json:"full_name,omitempty"`
+	Votes     int64  `json:"votes"`
+}
+
+// APIVoteReferrers is vote_referrers summed over the last days UTC days.
+type APIVoteReferrers struct {
+	Days      int               `json:"days"`
+	Total     int64             `json:"total"`
+	Sources   []APIVoteReferrer `json:"sources"`
+	Campaigns []APIVoteReferrer `json:"campaigns"`
+	Profiles  []APIVoteReferrer `json:"profiles"` // by profile, source and campaign
+}
+
+// loadVoteReferrers sums vote_referrers over the last days UTC days (today included), with up
+// to limit rows per list, most votes first.
+func (s *Server) loadVoteReferrers(ctx context.Context, days, limit int) (APIVoteReferrers, error) {
+	out := APIVoteReferrers{Days: days, Sources: []APIVoteReferrer{}, Campaigns: []APIVoteReferrer{}, Profiles: []APIVoteReferrer{}}
+	since := time.Now().UTC().AddDate(0, 0, 1-days)
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(sum(votes), 0)::int8 FROM vote_referrers WHERE day >= $1::date`, since).Scan(&out.Total); err != nil {
+		return out, err
+	}
+	for _, q := range []struct {
+		query string
+		list  *[]APIVoteReferrer
+		scan  func(*APIVoteReferrer) []any
+	}{
+		{`SELECT source, sum(votes)::int8 FROM vote_referrers WHERE day >= $1::date GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT $2`,
+			&out.Sources, func(v *APIVoteReferrer) []any { return []any{&v.Source, &v.Votes} }},
+		{`SELECT campaign, sum(votes)::int8 FROM vote_referrers WHERE day >= $1::date AND campaign != '' GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT $2`,
+			&out.Campaigns, func(v *APIVoteReferrer) []any { return []any{&v.Campaign, &v.Votes} }},
+		{`SELECT t.profile_id::string, p.full_name, t.source, t.campaign, sum(t.votes)::int8
+			FROM vote_referrers t JOIN profiles p ON p.id = t.profile_id
+			WHERE t.day >= $1::date GROUP BY 1, 2, 3, 4 ORDER BY 5 DESC, 1, 3, 4 LIMIT $2`,
+			&out.Profiles, func(v *APIVoteReferrer) []any { return []any{&v.ProfileID, &v.FullName, &v.Source, &v.Campaign, &v.Votes} }},
+	} {
+		rows, err := s.db.QueryContext(ctx, q.query, since, limit)
+		if err != nil { return out, err }
+		for rows.Next() {
+			var v APIVoteReferrer
+			if err := rows.Scan(q.scan(&v)...); err != nil {
+				rows.Close()
+				return out, err
+			}
+			*q.list = append(*q.list, v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil { return out, err }
+	}
+	return out, nil
+}
+
+// handleAdminVoteReferrers is the vote referrers page: GET /admin/referrers?days=7
+func (s *Server) handleAdminVoteReferrers(w http.ResponseWriter, r *http.Request) {
+	days := clampAtoi(r.URL.Query().Get("days"), 1, 90, 7)
+	refs, err := s.loadVoteReferrers(r.Context(), days, 50)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	v := views.AdminVoteReferrersView{Days: days, Total: refs.Total}
+	conv := func(list []APIVoteReferrer) []views.VoteReferrer {
+		var out []views.VoteReferrer
+		for _, r := range list {
+			out = append(out, views.VoteReferrer{Source: r.Source, Campaign: r.Campaign, ProfileID: r.ProfileID, FullName: r.FullName, Votes: r.Votes})
+		}
+		return out
+	}
+	v.Sources, v.Campaigns, v.Profiles = conv(refs.Sources), conv(refs.Campaigns), conv(refs.Profiles)
+	s.render(w, "admin_referrers.gohtml", v)
+}
+
+// handleAPIAdminVoteReferrers is the JSON variant: GET /api/v1/admin/votes/referrers?days=7&limit=50
+func (s *Server) handleAPIAdminVoteReferrers(w http.ResponseWriter, r *http.Request) {
+	refs, err := s.loadVoteReferrers(r.Context(), clampAtoi(r.URL.Query().Get("days"), 1, 90, 7), clampAtoi(r.URL.Query().Get("limit"), 1, 1000, 50))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, refs)
+}
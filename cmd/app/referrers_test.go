@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVoteAttribution(t *testing.T) {
+	s := &Server{cfg: Config{PublicURL: "https://friends.example"}}
+	for _, tt := range []struct {
+		target, referer string
+		want            voteAttribution
+	}{
+		{"/profiles/x/vote", "", voteAttribution{}},
+		{"/profiles/x/vote", "https://www.News.example/story/123?reader=42", voteAttribution{source: "news.example"}},
+		{"/profiles/x/vote", "https://friends.example/?utm_source=Newsletter&utm_campaign=spring-2026&email=a@b", voteAttribution{"newsletter", "spring-2026"}},
+		{"/profiles/x/vote", "http://board.internal:8080/?utm_campaign=spring", voteAttribution{campaign: "spring"}},
+		{"/vote?utm_campaign=oct", "https://blog.example/?utm_campaign=ignored", voteAttribution{"blog.example", "oct"}},
+		{"/profiles/x/vote", "https://friends.example/?utm_source=a+b&utm_campaign=" + strings.Repeat("a", 65), voteAttribution{}},
+		{"/profiles/x/vote", "not a url\x7f", voteAttribution{}},
+	} {
+		r := httptest.NewRequest("POST", "http://board.internal:8080"+tt.target, nil)
+		if tt.referer != "" { r.Header.Set("Referer", tt.referer) }
+		if got := s.attribution(r); got != tt.want { t.Errorf("%s from %q = %+v, want %+v", tt.target, tt.referer, got, tt.want) }
+	}
+}
+
+func TestVoteReferralCounts(t *testing.T) {
+	var v voteReferrals
+	k := referralKey{"p1", voteAttribution{"news.example", "spring"}}
+	v.add(k, 1)
+	v.add(k, 2)
+	v.add(referralKey{profileID: "p2"}, 1)
+	counts := v.take()
+	if len(counts) != 2 || counts[k] != 3 { t.Fatalf("counts = %v", counts) }
+	if again := v.take(); again != nil { t.Errorf("take after take = %v", again) }
+}
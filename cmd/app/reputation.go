@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IP reputation screens votes and profile creations by where they come from. A provider
+// rates the client IP from 0 (clean) to 100 (known abuse); at LEADERBOARD_IP_REPUTATION_CHALLENGE
+// the visitor must solve a CAPTCHA (see captcha.go), at LEADERBOARD_IP_REPUTATION_QUARANTINE
+// votes are quarantined instead of counted and new profiles are held for review.
+
+// reputationStats counts lookups and decisions on /debug/vars.
+var reputationStats = expvar.NewMap("ip_reputation")
+
+const (
+	reputationTimeout  = 2 * time.Second
+	reputationCacheTTL = time.Hour
+	reputationCacheMax = 50000
+)
+
+// ipReputation rates an address from 0 (no known abuse) to 100.
+type ipReputation interface {
+	score(ctx context.Context, ip netip.Addr) (int, error)
+}
+
+// newIPReputation picks the provider named by LEADERBOARD_IP_REPUTATION; nil disables screening.
+func newIPReputation(cfg Config) (ipReputation, error) {
+	switch cfg.IPReputation {
+	case "":
+		return nil, nil
+	case "static":
+		if cfg.IPReputationFile == "" { return nil, errors.New("LEADERBOARD_IP_REPUTATION_FILE is required for static") }
+		f, err := os.Open(cfg.IPReputationFile)
+		if err != nil { return nil, err }
+		defer f.Close()
+		return parseReputationList(f)
+	case "abuseipdb":
+		if cfg.IPReputationAPIKey == "" { return nil, errors.New("LEADERBOARD_IP_REPUTATION_API_KEY is required for abuseipdb") }
+		u := cfg.IPReputationURL
+		if u == "" { u = "https://api.abuseipdb.com" }
+		return abuseIPDB{url: strings.TrimRight(u, "/"), apiKey: cfg.IPReputationAPIKey, client: &http.Client{Timeout: reputationTimeout}}, nil
+	}
+	return nil, fmt.Errorf("unknown IP reputation provider %q", cfg.IPReputation)
+}
+
+// staticReputation rates addresses from a fixed list of networks; the most specific network
+// containing an address wins, and addresses in none score 0.
+type staticReputation []reputationRange
+
+type reputationRange struct {
+	prefix netip.Prefix
+	score  int
+}
+
+// parseReputationList reads one network per line, a CIDR or a single address, optionally
+// followed by a score (default 100). Blank lines and lines starting with # are skipped.
+func parseReputationList(r io.Reader) (staticReputation, error) {
+	var list staticReputation
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") { continue }
+		prefix, err := netip.ParsePrefix(fields[0])
+		if err != nil {
+			addr, aerr := netip.ParseAddr(fields[0])
+			if aerr != nil { return nil, fmt.Errorf("line %d: %q is not a network or address", n, fields[0]) }
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		score := 100
+		if len(fields) > 1 {
+			if score, err = strconv.Atoi(fields[1]); err != nil || score < 0 || score > 100 {
+				return nil, fmt.Errorf("line %d: score must be 0 to 100", n)
+			}
+		}
+		list = append(list, reputationRange{prefix: prefix.Masked(), score: score})
+	}
+	return list, sc.Err()
+}
+
+func (l staticReputation) score(_ context.Context, ip netip.Addr) (int, error) {
+	best, bits := 0, -1
+	for _, r := range l {
+		if r.prefix.Bits() > bits && r.prefix.Contains(ip) { best, bits = r.score, r.prefix.Bits() }
+	}
+	return best, nil
+}
+
+// abuseIPDB asks an AbuseIPDB-compatible API (GET /api/v2/check) for the abuse confidence
+// score of reports from the last 90 days.
+type abuseIPDB struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func (a abuseIPDB) score(ctx context.Context, ip netip.Addr) (int, error) {
+	q := url.Values{"ipAddress": {ip.String()}, "maxAgeInDays": {"90"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.url+"/api/v2/check?"+q.Encode(), nil)
+	if err != nil { return 0, err }
+	req.Header.Set("Key", a.apiKey)
+	req.Header.Set("Accept", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil { return 0, err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { return 0, fmt.Errorf("abuseipdb: %s", resp.Status) }
+	var body struct {
+		Data struct {
+			AbuseConfidenceScore int `json:"abuseConfidenceScore"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil { return 0, err }
+	return min(max(body.Data.AbuseConfidenceScore, 0), 100), nil
+}
+
+// reputationCache keeps scores for reputationCacheTTL so a busy visitor costs one lookup an
+// hour. When full it starts over rather than tracking age.
+type reputationCache struct {
+	mu     sync.Mutex
+	scores map[netip.Addr]cachedScore
+}
+
+type cachedScore struct {
+	score int
+	at    time.Time
+}
+
+func (c *reputationCache) get(ip netip.Addr, now time.Time) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.scores[ip]
+	if !ok || now.Sub(e.at) >= reputationCacheTTL { return 0, false }
+	return e.score, true
+}
+
+func (c *reputationCache) put(ip netip.Addr, score int, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.scores == nil || len(c.scores) >= reputationCacheMax { c.scores = map[netip.Addr]cachedScore{} }
+	c.scores[ip] = cachedScore{score: score, at: now}
+}
+
+// reputationDecision is what screening makes of a request.
+type reputationDecision string
+
+const (
+	repAllow      reputationDecision = "allow"
+	repChallenge  reputationDecision = "challenge"
+	repQuarantine reputationDecision = "quarantine"
+)
+
+// screening is the outcome of screenRequest: the decision and the score behind it.
+type screening struct {
+	decision reputationDecision
+	score    int
+}
+
+// screenRequest rates r's client IP for action ("vote" or "create"). Lookups that fail are
+// allowed: a provider outage must not stop voting. A challenge is only made when a CAPTCHA
+// provider is configured, and is passed by a valid CAPTCHA response in the request.
+func (s *Server) screenRequest(r *http.Request, action string) screening {
+	if s.reputation == nil { return screening{decision: repAllow} }
+	ip, err := netip.ParseAddr(s.clientIP(r))
+	if err != nil { return screening{decision: repAllow} }
+	ip = ip.Unmap()
+	now := time.Now()
+	score, ok := s.reputationCache.get(ip, now)
+	if ok {
+		reputationStats.Add("cache_hits", 1)
+	} else {
+		ctx, cancel := context.WithTimeout(r.Context(), reputationTimeout)
+		score, err = s.reputation.score(ctx, ip)
+		cancel()
+		reputationStats.Add("lookups", 1)
+		if err != nil {
+			reputationStats.Add("errors", 1)
+			s.log.Warn("ip reputation lookup failed", "err", err, "request_id", requestID(r))
+			return screening{decision: repAllow}
+		}
+		s.reputationCache.put(ip, score, now)
+	}
+	sc := screening{decision: repAllow, score: score}
+	switch {
+	case s.cfg.IPReputationQuarantine > 0 && score >= s.cfg.IPReputationQuarantine:
+		sc.decision = repQuarantine
+	case s.captcha != nil && s.cfg.IPReputationChallenge > 0 && score >= s.cfg.IPReputationChallenge:
+		sc.decision = repChallenge
+		if s.captchaPassed(r) { sc.decision = repAllow }
+	}
+	reputationStats.Add(action+"_"+string(sc.decision), 1)
+	if sc.decision != repAllow || score > 0 {
+		s.log.Info("ip reputation", "action", action, "decision", sc.decision, "score", score, "provider", s.cfg.IPReputation, "request_id", requestID(r))
+	}
+	return sc
+}
+
+// challenged reports whether r's client would be asked for a CAPTCHA, for pages that show
+// the widget up front. It doesn't log or count.
+func (s *Server) challenged(r *http.Request) bool {
+	if s.reputation == nil || s.captcha == nil || s.cfg.IPReputationChallenge <= 0 { return false }
+	ip, err := netip.ParseAddr(s.clientIP(r))
+	if err != nil { return false }
+	score, ok := s.reputationCache.get(ip.Unmap(), time.Now())
+	if !ok || score < s.cfg.IPReputationChallenge { return false }
+	return s.cfg.IPReputationQuarantine <= 0 || score < s.cfg.IPReputationQuarantine
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestParseReputationList(t *testing.T) {
+	list, err := parseReputationList(strings.NewReader("# known abuse\n203.0.113.0/24 60\n\n203.0.113.7\n2001:db8::/32 95\n"))
+	if err != nil { t.Fatal(err) }
+	for ip, want := range map[string]int{"203.0.113.1": 60, "203.0.113.7": 100, "198.51.100.1": 0, "2001:db8::1": 95} {
+		if got, _ := list.score(context.Background(), netip.MustParseAddr(ip)); got != want {
+			t.Errorf("score(%s) = %d, want %d", ip, got, want)
+		}
+	}
+	for _, bad := range []string{"not-an-ip", "203.0.113.0/24 101", "203.0.113.0/24 high"} {
+		if _, err := parseReputationList(strings.NewReader(bad)); err == nil { t.Errorf("%q accepted", bad) }
+	}
+}
+
+// fixedReputation scores every address the same.
+type fixedReputation int
+
+func (f fixedReputation) score(context.Context, netip.Addr) (int, error) { return int(f), nil }
+
+func TestScreenRequest(t *testing.T) {
+	verify := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		io.WriteString(w, `{"success": `+map[bool]string{true: "true", false: "false"}[r.PostForm.Get("response") == "good"]+`}`)
+	}))
+	defer verify.Close()
+	captcha := &captchaVerifier{provider: "turnstile", siteKey: "site", secret: "s", verifyURL: verify.URL, field: "cf-turnstile-response", client: verify.Client()}
+	cfg := Config{IPReputation: "static", IPReputationChallenge: 50, IPReputationQuarantine: 90}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	for _, tt := range []struct {
+		score   int
+		captcha *captchaVerifier
+		form    string
+		want    reputationDecision
+	}{
+		{10, captcha, "", repAllow},
+		{60, captcha, "", repChallenge},
+		{60, captcha, "cf-turnstile-response=bad", repChallenge},
+		{60, captcha, "cf-turnstile-response=good", repAllow},
+		{60, captcha, "captcha_token=good", repAllow},
+		{60, nil, "", repAllow}, // without a CAPTCHA provider only quarantine applies
+		{95, captcha, "captcha_token=good", repQuarantine},
+	} {
+		s := &Server{log: log, cfg: cfg, reputation: fixedReputation(tt.score), captcha: tt.captcha}
+		r := httptest.NewRequest("POST", "/profiles/x/vote", strings.NewReader(tt.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if got := s.screenRequest(r, "vote"); got.decision != tt.want || got.score != tt.score {
+			t.Errorf("score %d, form %q: %+v, want %s", tt.score, tt.form, got, tt.want)
+		}
+		if want := tt.captcha != nil && tt.score >= 50 && tt.score < 90; s.challenged(httptest.NewRequest("GET", "/add", nil)) != want {
+			t.Errorf("score %d: challenged = %t, want %t", tt.score, !want, want)
+		}
+	}
+
+	if got := (&Server{log: log}).screenRequest(httptest.NewRequest("GET", "/", nil), "vote"); got.decision != repAllow {
+		t.Errorf("screening off: %s", got.decision)
+	}
+}
+
+func TestResolveQuarantinedVoteAction(t *testing.T) {
+	err := (&Server{}).resolveQuarantinedVote(context.Background(), "id", "count", "admin")
+	if !strings.Contains(err.Error(), "release or discard") { t.Errorf("err = %v", err) }
+}
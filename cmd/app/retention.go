@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Retention batches are small so each DELETE holds its locks only briefly.
+const (
+	retentionBatchSize  = 1000
+	retentionBatchPause = 100 * time.Millisecond
+)
+
+// voteRetention moves votes older than the vote cooldown from votes_recent to votes_history and
+// forgets redeemed vote links that have expired (their tokens are rejected anyway), old
+// creation throttle counters, idle cookie voters and original uploads past their retention.
+func (s *Server) voteRetention(ctx context.Context) error {
+	moved, err := s.moveOldVotes(ctx)
+	if moved > 0 { s.log.Info("vote retention", "moved", moved) }
+	if err != nil { return err }
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM vote_link_uses WHERE expires_at < now() - interval '1 hour' ORDER BY expires_at LIMIT $1
+	`, retentionBatchSize)
+	if err != nil { return err }
+	if n, _ := res.RowsAffected(); n > 0 { s.log.Info("vote retention", "expired_vote_links", n) }
+	_, err = s.db.ExecContext(ctx, `DELETE FROM profile_creations WHERE day < (now() AT TIME ZONE 'UTC')::date - 2 LIMIT $1`, retentionBatchSize)
+	if err != nil { return err }
+	voters, err := s.pruneVoters(ctx)
+	if voters > 0 { s.log.Info("vote retention", "idle_voters", voters) }
+	if err != nil { return err }
+	n, err := s.pruneOriginals(ctx)
+	if n > 0 { s.log.Info("vote retention", "expired_originals", n) }
+	return err
+}
+
+// moveOldVotes drains expired votes_recent rows in batches and returns how many were moved. It
+// only tends the legacy tables kept for the dual-write transition (see votes.go); the
+// cooldown reads votes, so raising it applies at once.
+func (s *Server) moveOldVotes(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		if err := s.writable(); err != nil { return total, err }
+		res, err := s.db.ExecContext(ctx, `
+			WITH moved AS (
+				DELETE FROM votes_recent
+				WHERE created_at < now() - `+sqlInterval(s.settings.GetDuration(settingVoteCooldown))+` AND counted
+				ORDER BY created_at
+				LIMIT $1
+				RETURNING id, profile_id, created_at
+			)
+			INSERT INTO votes_history (id, profile_id, created_at)
+			SELECT id, profile_id, created_at FROM moved
+		`, retentionBatchSize)
+		if err != nil { return total, err }
+		n, err := res.RowsAffected()
+		if err != nil { return total, err }
+		total += n
+		if n < retentionBatchSize { return total, nil }
+		select {
+		case <-ctx.Done():
+			return total, ctx.Err()
+		case <-time.After(retentionBatchPause):
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// Profile statuses (profiles.status).
+const (
+	statusActive  = store.StatusActive
+	statusRetired = store.StatusRetired
+)
+
+type ErrorRetired string
+
+func (e ErrorRetired) Error() string { return string(e) }
+func (ErrorRetired) Retired()        {}
+
+const ErrRetired ErrorRetired = "this exhibit is retired and no longer takes votes"
+
+// setProfileStatus retires or reinstates profile id, or approves it when it is held for
+// review (see moderation.go). Retiring freezes the profile's overall
+// rank and current country title into final_rank and final_champion, and drops its pin and
+// champion row so the active boards move on; reinstating clears them again.
+func (s *Server) setProfileStatus(ctx context.Context, id, status string) error {
+	if status != statusActive && status != statusRetired { return ErrorInvalidStatus("status must be active or retired") }
+	if err := s.writable(); err != nil { return err }
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		current, err := s.store.ProfileStatus(store.WithTx(ctx, tx), id)
+		if err != nil { return err }
+		if current == status { return nil }
+		if current == statusHeld && status != statusActive { return ErrorInvalidStatus("a held profile can only be approved (active) or discarded") }
+		if status == statusActive {
+			_, err := tx.ExecContext(ctx, `
+				UPDATE profiles SET status = 'active', retired_at = NULL, final_rank = NULL, final_champion = NULL WHERE id = $1
+			`, id)
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE profiles p SET status = 'retired', retired_at = now(),
+				final_rank = (
+					SELECT count(*) + 1 FROM profiles o
+					WHERE o.status = 'active' AND o.id != p.id
+						AND (o.votes_count > p.votes_count OR (o.votes_count = p.votes_count AND o.created_at > p.created_at))
+				),
+				final_champion = (SELECT c.country FROM country_champions c WHERE c.profile_id = p.id)
+			WHERE p.id = $1
+		`, id); err != nil { return err }
+		if _, err := tx.ExecContext(ctx, `DELETE FROM profile_pins WHERE profile_id = $1`, id); err != nil { return err }
+		_, err = tx.ExecContext(ctx, `DELETE FROM country_champions WHERE profile_id = $1`, id)
+		return err
+	})
+}
+
+type ErrorInvalidStatus string
+
+func (e ErrorInvalidStatus) Error() string { return string(e) }
+func (ErrorInvalidStatus) InvalidStatus()  {}
+
+// handleAPIAdminProfileStatus retires, reinstates or approves a profile:
+// PUT /api/v1/admin/profiles/{id}/status {"status": "retired"|"active"}
+func (s *Server) handleAPIAdminProfileStatus(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4*1024)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad json")
+		return
+	}
+	id := pathID(r)
+	err := s.setProfileStatus(r.Context(), id, req.Status)
+	switch {
+	case errors.As(err, new(interface{ InvalidStatus() })):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	actor, _ := s.adminActor(r)
+	s.log.Info("profile status changed", "profile", id, "status", req.Status, "by", actor)
+	list, err := s.loadProfiles(r.Context(), profileFilter{ID: id, Limit: 1})
+	if err != nil || len(list) == 0 {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.apiProfile(list[0]))
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/profile"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// Admins can edit a profile's name and description. Every change is kept in
+// profile_revisions (who, when, the previous and new value), written in the transaction that
+// updates the profile, and any revision can be reverted: the field gets the revision's
+// previous value back, recorded as a revision of its own.
+
+// revisionFields are the profile columns with an edit history.
+var revisionFields = []string{"full_name", "description"}
+
+type ErrorInvalidEdit string
+
+func (e ErrorInvalidEdit) Error() string { return string(e) }
+func (ErrorInvalidEdit) InvalidEdit()   {}
+
+// ProfileEdit is an admin edit; nil fields are left as they are.
+type ProfileEdit struct {
+	FullName    *string `json:"full_name"`
+	Description *string `json:"description"`
+}
+
+// APIRevision is one change to a profile field.
+type APIRevision struct {
+	ID        string    `json:"id"`
+	ProfileID string    `json:"profile_id"`
+	Field     string    `json:"field"`
+	Previous  string    `json:"previous"`
+	Value     string    `json:"value"`
+	EditedBy  string    `json:"edited_by"`
+	Reverts   string    `json:"reverts,omitempty"` // the revision this one undid
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// editProfile applies e to profile id as actor and returns the revisions it recorded, none
+// when nothing changed. Names and descriptions are checked like on submission.
+func (s *Server) editProfile(ctx context.Context, id string, e ProfileEdit, actor string) ([]APIRevision, error) {
+	values := map[string]string{}
+	if e.FullName != nil { values["full_name"] = strings.TrimSpace(*e.FullName) }
+	if e.Description != nil { values["description"] = strings.TrimSpace(*e.Description) }
+	if len(values) == 0 { return nil, ErrorInvalidEdit("nothing to change: set full_name or description") }
+	if err := s.writable(); err != nil { return nil, err }
+	var out []APIRevision
+	err := s.store.InTx(ctx, func(ctx context.Context) (err error) {
+		out, err = s.applyProfileEdit(ctx, id, values, actor, "")
+		return err
+	})
+	return out, err
+}
+
+// revertRevision restores the previous value of revision revID of profile id.
+func (s *Server) revertRevision(ctx context.Context, id, revID, actor string) ([]APIRevision, error) {
+	if err := s.writable(); err != nil { return nil, err }
+	var out []APIRevision
+	err := s.store.InTx(ctx, func(ctx context.Context) error {
+		rev, err := s.store.GetRevision(ctx, id, revID)
+		if err != nil { return err }
+		out, err = s.applyProfileEdit(ctx, id, map[string]string{rev.Field: rev.Previous}, actor, revID)
+		return err
+	})
+	return out, err
+}
+
+// applyProfileEdit sets the fields in values on profile id within the transaction ctx
+// carries, recording a revision for each one that changes; reverts names the revision being
+// undone, if any.
+func (s *Server) applyProfileEdit(ctx context.Context, id string, values map[string]string, actor, reverts string) ([]APIRevision, error) {
+	list, err := s.store.ListProfiles(ctx, profileFilter{ID: id, Limit: 1})
+	if err != nil { return nil, err }
+	if len(list) == 0 { return nil, ErrNotFound }
+	cur := list[0]
+	old := map[string]string{"full_name": cur.FullName, "description": cur.Description}
+	next := map[string]string{"full_name": cur.FullName, "description": cur.Description}
+	for f, v := range values { next[f] = v }
+	if err := profile.Validate(next["full_name"], cur.Country, cur.City, next["description"]); err != nil { return nil, ErrorInvalidEdit(err.Error()) }
+
+	revs := []APIRevision{}
+	for _, field := range revisionFields {
+		if next[field] == old[field] { continue }
+		r, err := s.store.InsertRevision(ctx, store.Revision{Profile: id, Field: field, Previous: old[field], Value: next[field], EditedBy: actor, Reverts: reverts})
+		if err != nil { return nil, err }
+		revs = append(revs, apiRevision(r))
+	}
+	if len(revs) == 0 { return revs, nil }
+	// A renamed profile's page moves with its name (see slugs.go).
+	err = s.store.SetProfileText(ctx, id, next["full_name"], next["description"])
+	if isNameConflict(err) { return nil, ErrorInvalidEdit("another exhibit in this city already has that name") }
+	return revs, err
+}
+
+// listRevisions returns profile id's revisions, newest first.
+func (s *Server) listRevisions(ctx context.Context, id string) ([]APIRevision, error) {
+	revs, err := s.store.Revisions(ctx, id)
+	if err != nil { return nil, err }
+	list := make([]APIRevision, len(revs))
+	for i, r := range revs { list[i] = apiRevision(r) }
+	return list, nil
+}
+
+func apiRevision(r store.Revision) APIRevision {
+	return APIRevision{ID: r.ID, ProfileID: r.Profile, Field: r.Field, Previous: r.Previous, Value: r.Value, EditedBy: r.EditedBy,
+		Reverts: r.Reverts, CreatedAt: r.CreatedAt}
+}
+
+// handleAdminProfileEdit is the edit page: GET /admin/profiles/{id}/edit shows the form and
+// the history; POST saves the form, reverts the revision named by revert, or hides or shows
+// the photo date (photo_date=hide or show).
+func (s *Server) handleAdminProfileEdit(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	var v views.AdminProfileEditView
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		actor, _ := s.adminActor(r)
+		var err error
+		if rev := r.FormValue("revert"); rev != "" {
+			_, err = s.revertRevision(r.Context(), id, rev, actor)
+			v.Notice = "Revision reverted."
+		} else if pd := r.FormValue("photo_date"); pd != "" {
+			err = s.setPhotoDateHidden(r.Context(), id, pd == "hide")
+			v.Notice = "Photo date shown."
+			if pd == "hide" { v.Notice = "Photo date hidden." }
+		} else {
+			name, desc := r.FormValue("full_name"), r.FormValue("description")
+			var revs []APIRevision
+			revs, err = s.editProfile(r.Context(), id, ProfileEdit{FullName: &name, Description: &desc}, actor)
+			v.Notice = "Saved."
+			if len(revs) == 0 { v.Notice = "Nothing changed." }
+		}
+		switch {
+		case errors.As(err, new(interface{ InvalidEdit() })):
+			v.Notice, v.Error, status = "", err.Error(), http.StatusBadRequest
+		case errors.As(err, new(interface{ NotFound() })):
+			http.NotFound(w, r)
+			return
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+			return
+		case err != nil:
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+	list, err := s.loadProfiles(r.Context(), profileFilter{ID: id, Limit: 1})
+	if err == nil && len(list) == 0 { err = ErrNotFound }
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	revs, err := s.listRevisions(r.Context(), id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	pd, err := s.loadPhotoDate(r.Context(), id)
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	v.Profile = profileView(list[0])
+	v.PhotoTaken, v.PhotoTakenHidden = pd.Taken, pd.Hidden
+	if v.Error != "" {
+		v.Profile.FullName, v.Profile.Description = r.FormValue("full_name"), r.FormValue("description")
+	}
+	for _, rv := range revs {
+		v.Revisions = append(v.Revisions, views.Revision{ID: rv.ID, Field: rv.Field, Previous: rv.Previous, Value: rv.Value,
+			EditedBy: rv.EditedBy, Reverts: rv.Reverts, CreatedAt: rv.CreatedAt})
+	}
+	s.renderStatus(w, status, "admin_profile.gohtml", v)
+}
+
+// handleAPIAdminProfileEdit edits a profile: PATCH /api/v1/admin/profiles/{id}
+// {"full_name": "...", "description": "..."}; omitted fields are kept.
+func (s *Server) handleAPIAdminProfileEdit(w http.ResponseWriter, r *http.Request) {
+	var e ProfileEdit
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024)).Decode(&e); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad json")
+		return
+	}
+	actor, _ := s.adminActor(r)
+	revs, err := s.editProfile(r.Context(), pathID(r), e, actor)
+	s.writeRevisionResult(w, r, revs, err)
+}
+
+// handleAPIAdminRevisions lists a profile's revisions, newest first:
+// GET /api/v1/admin/profiles/{id}/revisions
+func (s *Server) handleAPIAdminRevisions(w http.ResponseWriter, r *http.Request) {
+	revs, err := s.listRevisions(r.Context(), pathID(r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"revisions": revs})
+}
+
+// handleAPIAdminRevert reverts one revision: POST /api/v1/admin/profiles/{id}/revisions/{rev}/revert
+func (s *Server) handleAPIAdminRevert(w http.ResponseWriter, r *http.Request) {
+	actor, _ := s.adminActor(r)
+	revs, err := s.revertRevision(r.Context(), pathID(r), r.PathValue("rev"), actor)
+	s.writeRevisionResult(w, r, revs, err)
+}
+
+func (s *Server) writeRevisionResult(w http.ResponseWriter, r *http.Request, revs []APIRevision, err error) {
+	switch {
+	case errors.As(err, new(interface{ InvalidEdit() })):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "not found")
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+	default:
+		actor, _ := s.adminActor(r)
+		if len(revs) > 0 { s.log.Info("profile edited", "profile", pathID(r), "revisions", len(revs), "by", actor) }
+		writeJSON(w, http.StatusOK, map[string]any{"revisions": revs})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+func TestEditProfileNeedsAField(t *testing.T) {
+	_, err := (&Server{}).editProfile(context.Background(), "id", ProfileEdit{}, "admin")
+	if !errors.As(err, new(interface{ InvalidEdit() })) { t.Errorf("empty edit: err = %v", err) }
+}
+
+// Edits record a revision per changed field, the history lists them newest first, and a
+// revert writes the revision's previous value back as a revision of its own.
+func TestAdminProfileRevisions(t *testing.T) {
+	mem := store.NewMemory()
+	at := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	mem.SetClock(func() time.Time { at = at.Add(time.Second); return at })
+	mem.Put(Profile{ID: "p1", FullName: "Rex", Country: "Chile", City: "Santiago", Description: "A good dog"}, "", nil, "")
+	s := &Server{store: mem, cfg: Config{AdminToken: "admin-secret"}, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	call := func(h http.HandlerFunc, method, body, rev string) (int, []APIRevision) {
+		t.Helper()
+		r := httptest.NewRequest(method, "/api/v1/admin/profiles/p1/revisions", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer admin-secret")
+		r.SetPathValue("id", "p1")
+		r.SetPathValue("rev", rev)
+		w := httptest.NewRecorder()
+		h(w, r)
+		var out struct{ Revisions []APIRevision }
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&out); err != nil { t.Fatal(err) }
+		}
+		return w.Code, out.Revisions
+	}
+	edit := func(body string) (int, []APIRevision) { return call(s.handleAPIAdminProfileEdit, http.MethodPatch, body, "") }
+	current := func() Profile {
+		t.Helper()
+		list, err := mem.ListProfiles(context.Background(), store.Filter{ID: "p1", Limit: 1})
+		if err != nil || len(list) != 1 { t.Fatalf("profile: %v %v", list, err) }
+		return list[0]
+	}
+
+	code, revs := edit(`{"full_name": " Rexie ", "description": "The best dog"}`)
+	if code != http.StatusOK || len(revs) != 2 || revs[0].Field != "full_name" || revs[0].Previous != "Rex" || revs[0].Value != "Rexie" ||
+		revs[1].Field != "description" || revs[1].EditedBy != "api" {
+		t.Fatalf("edit = %d %+v", code, revs)
+	}
+	if p := current(); p.FullName != "Rexie" || p.Description != "The best dog" || p.EditedAt == nil { t.Errorf("after the edit: %+v", p) }
+	if code, revs := edit(`{"description": "The best dog"}`); code != http.StatusOK || len(revs) != 0 { t.Errorf("unchanged edit = %d %+v", code, revs) }
+	if code, _ := edit(`{"full_name": ""}`); code != http.StatusBadRequest { t.Errorf("empty name = %d", code) }
+	if code, revs := edit(`{"description": "Fetches sticks"}`); code != http.StatusOK || len(revs) != 1 { t.Fatalf("second edit = %d %+v", code, revs) }
+
+	_, list := call(s.handleAPIAdminRevisions, http.MethodGet, "", "")
+	var got []string
+	for _, r := range list { got = append(got, r.Field+"="+r.Value) }
+	if want := "description=Fetches sticks,description=The best dog,full_name=Rexie"; strings.Join(got, ",") != want { t.Fatalf("revisions = %v, want %s", got, want) }
+
+	// Reverting the first description edit restores what it replaced, whatever came after.
+	code, revs = call(s.handleAPIAdminRevert, http.MethodPost, "", list[1].ID)
+	if code != http.StatusOK || len(revs) != 1 || revs[0].Previous != "Fetches sticks" || revs[0].Value != "A good dog" || revs[0].Reverts != list[1].ID {
+		t.Fatalf("revert = %d %+v", code, revs)
+	}
+	if code, _ := call(s.handleAPIAdminRevert, http.MethodPost, "", list[2].ID); code != http.StatusOK { t.Fatalf("revert name = %d", code) }
+	if p := current(); p.FullName != "Rex" || p.Description != "A good dog" { t.Errorf("after the reverts: %q %q", p.FullName, p.Description) }
+	if _, list := call(s.handleAPIAdminRevisions, http.MethodGet, "", ""); len(list) != 5 || list[0].Reverts != list[4].ID { t.Errorf("revisions after the reverts = %+v", list) }
+	if code, _ := call(s.handleAPIAdminRevert, http.MethodPost, "", "nope"); code != http.StatusNotFound { t.Errorf("unknown revision = %d", code) }
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"strings"
+)
+
+// middleware wraps a handler; the name shows up in the route listing.
+type middleware struct {
+	name string
+	wrap func(http.HandlerFunc) http.HandlerFunc
+}
+
+// route is one entry of the route table. Patterns use the Go 1.22 ServeMux syntax without
+// the method, which is kept separate so the table reads as a listing; "GET" also serves HEAD.
+type route struct {
+	Method     string
+	Pattern    string
+	Handler    http.HandlerFunc
+	Middleware []middleware // applied in order, the first one outermost
+}
+
+// routes is the full route table. Routes in a group share its middleware list, so e.g. every
+// admin route is guarded the same way.
+func (s *Server) routes() []route {
+	admin := []middleware{{"require_admin", s.requireAdmin}}
+	return s.withChaos([]route{
+		{"GET", "/{$}", s.handleHome, nil},
+		{"GET", "/add", s.handleAdd, nil},
+		{"POST", "/profiles", s.handleCreateProfile, nil},
+		{"GET", "/profiles/{id}", s.handleProfilePage, nil},
+		{"GET", "/p/{slug}", s.handleProfileDetail, nil},
+		{"GET", "/profiles/{id}/photo", s.handlePhoto, nil},
+		{"POST", "/profiles/{id}/vote", s.handleVote, nil},
+		{"GET", "/profiles/{id}/vote/confirm", s.handleVoteConfirm, nil},
+		{"POST", "/profiles/{id}/vote/confirm", s.handleVoteConfirm, nil},
+		{"GET", "/alumni", s.handleAlumni, nil},
+		{"GET", "/random", s.handleRandom, nil},
+		{"GET", "/spotlights", s.handleSpotlights, nil},
+		{"GET", "/profiles/{id}/receipt", s.handleVoteReceipt, nil},
+		{"GET", "/fragments/leaderboard", s.handleLeaderboardFragment, nil},
+		{"GET", "/fragments/profile-card/{id}", s.handleCardFragment, nil},
+		{"GET", "/fragments/profile/{id}/description", s.handleDescriptionFragment, nil},
+		{"GET", "/takedown", s.handleTakedown, nil},
+		{"POST", "/takedown", s.handleTakedown, nil},
+		{"GET", "/vote", s.handleVoteLink, nil},
+		{"POST", "/vote", s.handleVoteLink, nil},
+		{"GET", "/kiosk", s.handleKiosk, nil},
+		{"POST", "/kiosk/vote", s.handleKioskVote, nil},
+
+		{"GET", "/api/v1/profiles", s.handleAPIProfiles, nil},
+		{"POST", "/api/v1/profiles", s.handleAPICreateProfile, nil},
+		{"GET", "/api/v1/profiles/random", s.handleAPIRandomProfiles, nil},
+		{"GET", "/api/v1/spotlights", s.handleAPISpotlights, nil},
+		{"POST", "/api/v1/profiles/{id}/vote", s.handleAPIVote, nil},
+		{"GET", "/api/v1/champions", s.handleAPIChampions, nil},
+
+		{"GET", "/admin/votes/reset", s.handleAdminVoteReset, admin},
+		{"POST", "/admin/votes/reset", s.handleAdminVoteReset, admin},
+		{"POST", "/api/v1/admin/votes/reset", s.handleAPIAdminVoteReset, admin},
+		{"POST", "/api/v1/admin/votes:import", s.handleAPIAdminVoteImport, admin},
+		{"GET", "/api/v1/admin/votes/quarantine", s.handleAPIAdminQuarantine, admin},
+		{"PUT", "/api/v1/admin/votes/quarantine/{id}", s.handleAPIAdminQuarantinedVote, admin},
+		{"GET", "/api/v1/admin/pins", s.handleAPIAdminPins, admin},
+		{"PUT", "/api/v1/admin/pins", s.handleAPIAdminPins, admin},
+		{"POST", "/api/v1/admin/vote-links", s.handleAPIAdminVoteLinks, admin},
+		{"GET", "/api/v1/admin/kiosks", s.handleAPIAdminKiosks, admin},
+		{"POST", "/api/v1/admin/kiosks", s.handleAPIAdminKiosks, admin},
+		{"DELETE", "/api/v1/admin/kiosks/{id}", s.handleAPIAdminEndKiosk, admin},
+		{"GET", "/api/v1/admin/cities", s.handleAPIAdminCities, admin},
+		{"POST", "/api/v1/admin/cities/merge", s.handleAPIAdminMergeCities, admin},
+		{"GET", "/api/v1/admin/read-only", s.handleAPIAdminReadOnly, admin},
+		{"PUT", "/api/v1/admin/read-only", s.handleAPIAdminReadOnly, admin},
+		{"GET", "/api/v1/admin/routes", s.handleAPIAdminRoutes, admin},
+		{"PUT", "/api/v1/admin/profiles/{id}/status", s.handleAPIAdminProfileStatus, admin},
+		{"GET", "/admin/profiles/{id}/edit", s.handleAdminProfileEdit, admin},
+		{"POST", "/admin/profiles/{id}/edit", s.handleAdminProfileEdit, admin},
+		{"PATCH", "/api/v1/admin/profiles/{id}", s.handleAPIAdminProfileEdit, admin},
+		{"GET", "/api/v1/admin/profiles/{id}/revisions", s.handleAPIAdminRevisions, admin},
+		{"POST", "/api/v1/admin/profiles/{id}/revisions/{rev}/revert", s.handleAPIAdminRevert, admin},
+		{"GET", "/admin/moderation", s.handleAdminModeration, admin},
+		{"POST", "/admin/moderation", s.handleAdminModeration, admin},
+		{"GET", "/admin/moderation/review", s.handleAdminModerationReview, admin},
+		{"GET", "/api/v1/admin/moderation/rules", s.handleAPIAdminModerationRules, admin},
+		{"POST", "/api/v1/admin/moderation/rules", s.handleAPIAdminModerationRules, admin},
+		{"DELETE", "/api/v1/admin/moderation/rules/{id}", s.handleAPIAdminModerationRule, admin},
+		{"GET", "/api/v1/admin/moderation/matches", s.handleAPIAdminModerationMatches, admin},
+		{"GET", "/api/v1/admin/moderation/held", s.handleAPIAdminHeld, admin},
+		{"DELETE", "/api/v1/admin/moderation/held/{id}", s.handleAPIAdminDiscardHeld, admin},
+		{"GET", "/admin/takedowns", s.handleAdminTakedowns, admin},
+		{"POST", "/admin/takedowns", s.handleAdminTakedowns, admin},
+		{"GET", "/api/v1/admin/takedowns", s.handleAPIAdminTakedowns, admin},
+		{"PUT", "/api/v1/admin/takedowns/{id}", s.handleAPIAdminTakedown, admin},
+		{"GET", "/admin/site", s.handleAdminSite, admin},
+		{"POST", "/admin/site", s.handleAdminSite, admin},
+		{"GET", "/api/v1/admin/site", s.handleAPIAdminSite, admin},
+		{"PUT", "/api/v1/admin/site", s.handleAPIAdminSite, admin},
+		{"GET", "/admin/layout", s.handleAdminLayout, admin},
+		{"POST", "/admin/layout", s.handleAdminLayout, admin},
+		{"GET", "/api/v1/admin/layout", s.handleAPIAdminLayout, admin},
+		{"PUT", "/api/v1/admin/layout", s.handleAPIAdminLayout, admin},
+		{"GET", "/admin/photos", s.handleAdminPhotoTraffic, admin},
+		{"GET", "/api/v1/admin/photos/traffic", s.handleAPIAdminPhotoTraffic, admin},
+		{"GET", "/admin/referrers", s.handleAdminVoteReferrers, admin},
+		{"GET", "/api/v1/admin/votes/referrers", s.handleAPIAdminVoteReferrers, admin},
+		{"POST", "/api/v1/admin/profiles/{id}/photo-embed", s.handleAPIAdminPhotoEmbed, admin},
+		{"PUT", "/api/v1/admin/profiles/{id}/photo-date", s.handleAPIAdminPhotoDate, admin},
+		{"GET", "/admin/settings", s.handleAdminSettings, admin},
+		{"POST", "/admin/settings", s.handleAdminSettings, admin},
+		{"GET", "/api/v1/admin/settings", s.handleAPIAdminSettings, admin},
+		{"PUT", "/api/v1/admin/settings/{key}", s.handleAPIAdminSetting, admin},
+		{"DELETE", "/api/v1/admin/settings/{key}", s.handleAPIAdminSetting, admin},
+		{"GET", "/debug/vars", expvar.Handler().ServeHTTP, admin},
+		{"GET", "/debug/metrics", s.handleMetrics, admin},
+		{"GET", "/admin/debug/config", s.handleAdminDebugConfig, admin},
+		{"GET", "/admin/debug/routes", s.handleAPIAdminRoutes, admin},
+		{"GET", "/admin/debug/stats", s.handleAdminDebugStats, admin},
+		{"GET", "/admin/schema", s.handleAdminSchema, admin},
+
+		{"GET", "/healthz", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }, nil},
+		{"GET", "/readyz", s.handleReadyz, nil},
+	})
+}
+
+// serverMiddleware wraps the whole mux, outermost first. It runs for every request,
+// including ones no route matches.
+func (s *Server) serverMiddleware() []middleware {
+	list := []middleware{{"request_id", s.requestIDMiddleware}, {"log", func(h http.HandlerFunc) http.HandlerFunc { return logMiddleware(s.log, h).ServeHTTP }}}
+	if s.cfg.DebugHTTP {
+		list = append(list, middleware{"debug_http", func(h http.HandlerFunc) http.HandlerFunc { return debugRequestLogger(s.log, h).ServeHTTP }})
+	}
+	return append(list, middleware{"read_only_guard", func(h http.HandlerFunc) http.HandlerFunc { return s.readOnlyGuard(h).ServeHTTP }})
+}
+
+// buildMux registers every route with its middleware and wraps the result in the server-wide
+// middleware. It panics on conflicting patterns, like ServeMux.Handle.
+func buildMux(routes []route, global []middleware) http.Handler {
+	return chain(routeMux(routes).ServeHTTP, global)
+}
+
+func routeMux(routes []route) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, rt := range routes {
+		mux.HandleFunc(rt.Method+" "+rt.Pattern, chain(rt.Handler, rt.Middleware))
+	}
+	return mux
+}
+
+func chain(h http.HandlerFunc, list []middleware) http.HandlerFunc {
+	for i := len(list) - 1; i >= 0; i-- { h = list[i].wrap(h) }
+	return h
+}
+
+// APIRoute describes a route in the admin route listing.
+type APIRoute struct {
+	Method     string   `json:"method"`
+	Pattern    string   `json:"pattern"`
+	Middleware []string `json:"middleware"`
+}
+
+// handleAPIAdminRoutes lists the route table: GET /api/v1/admin/routes
+func (s *Server) handleAPIAdminRoutes(w http.ResponseWriter, r *http.Request) {
+	names := func(list []middleware) []string {
+		out := make([]string, 0, len(list))
+		for _, m := range list { out = append(out, m.name) }
+		return out
+	}
+	routes := s.routes()
+	list := make([]APIRoute, 0, len(routes))
+	for _, rt := range routes {
+		list = append(list, APIRoute{Method: rt.Method, Pattern: rt.Pattern, Middleware: names(rt.Middleware)})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"server_middleware": names(s.serverMiddleware()), "routes": list})
+}
+
+// pathID is the {id} wildcard of the matched pattern.
+func pathID(r *http.Request) string {
+	return strings.TrimSpace(r.PathValue("id"))
+}
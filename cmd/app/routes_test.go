@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRouteTable(t *testing.T) {
+	s := &Server{}
+	routes := s.routes()
+	mux := routeMux(routes) // panics on conflicting patterns
+
+	tests := []struct {
+		method, path, want string
+	}{
+		{"GET", "/", "GET /{$}"},
+		{"HEAD", "/", "GET /{$}"},
+		{"GET", "/nope", ""},
+		{"GET", "/profiles/abc/photo", "GET /profiles/{id}/photo"},
+		{"POST", "/profiles/abc/vote", "POST /profiles/{id}/vote"},
+		{"POST", "/api/v1/profiles/abc/vote", "POST /api/v1/profiles/{id}/vote"},
+		{"PUT", "/api/v1/admin/pins", "PUT /api/v1/admin/pins"},
+		{"DELETE", "/api/v1/admin/pins", ""},
+	}
+	for _, tt := range tests {
+		_, pattern := mux.Handler(httptest.NewRequest(tt.method, tt.path, nil))
+		if pattern != tt.want {
+			t.Errorf("%s %s matched %q, want %q", tt.method, tt.path, pattern, tt.want)
+		}
+	}
+
+	for _, rt := range routes {
+		private := strings.HasPrefix(rt.Pattern, "/admin/") || strings.HasPrefix(rt.Pattern, "/api/v1/admin/") || strings.HasPrefix(rt.Pattern, "/debug/")
+		guarded := slices.ContainsFunc(rt.Middleware, func(m middleware) bool { return m.name == "require_admin" })
+		if private != guarded {
+			t.Errorf("%s %s: admin path %v but require_admin %v", rt.Method, rt.Pattern, private, guarded)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/doesnotcommit/bestfriends/internal/migrate"
+	"github.com/doesnotcommit/bestfriends/migrations"
+)
+
+// The schema versions this build works with, by migration number (the numeric prefix of the
+// files in migrations/). Bump schemaMinVersion when the app starts depending on a migration,
+// and schemaMaxVersion to the newest migration the app has been checked against.
+const (
+	schemaMinVersion = 41
+	schemaMaxVersion = 41
+)
+
+type ErrorSchemaMismatch string
+
+func (e ErrorSchemaMismatch) Error() string { return string(e) }
+func (ErrorSchemaMismatch) SchemaMismatch() {}
+
+// schemaVersion returns the highest applied migration number, or 0 when none are recorded.
+func (s *Server) schemaVersion(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil { return 0, fmt.Errorf("read schema_migrations: %w", err) }
+	defer rows.Close()
+	max := 0
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil { return 0, err }
+		if n := migrationNumber(v); n > max { max = n }
+	}
+	return max, rows.Err()
+}
+
+// migrationNumber parses the numeric prefix of a migration file name ("006_profile_pins.sql" is 6).
+func migrationNumber(name string) int {
+	digits := name[:len(name)-len(strings.TrimLeft(name, "0123456789"))]
+	n, _ := strconv.Atoi(digits)
+	return n
+}
+
+// checkSchema compares the applied schema with what this build supports. An older schema is
+// always fatal: queries would hit missing tables. A newer one is fatal too unless
+// LEADERBOARD_SCHEMA_MISMATCH=read-only, in which case the server keeps serving reads and
+// rejects writes, so an old instance can't corrupt data during a rolling deploy.
+func (s *Server) checkSchema(ctx context.Context) error {
+	v, err := s.schemaVersion(ctx)
+	if err != nil { return err }
+	switch {
+	case v < schemaMinVersion:
+		return ErrorSchemaMismatch(fmt.Sprintf("schema version %d is older than the minimum %d; run the migrator first", v, schemaMinVersion))
+	case v > schemaMaxVersion:
+		msg := fmt.Sprintf("schema version %d is newer than this build supports (max %d)", v, schemaMaxVersion)
+		if s.cfg.SchemaMismatch != "read-only" { return ErrorSchemaMismatch(msg) }
+		s.readOnly.schema.Store(true)
+		s.log.Warn("starting read-only: "+msg, "schema", v)
+		return nil
+	}
+	s.log.Info("schema compatible", "schema", v, "min", schemaMinVersion, "max", schemaMaxVersion)
+	return nil
+}
+
+// autoMigrate applies the pending migrations at startup (LEADERBOARD_AUTO_MIGRATE), the
+// embedded ones unless LEADERBOARD_MIGRATIONS_DIR says otherwise. It connects without the
+// statement timeout, since a migration may take longer. Replicas starting together take turns
+// under the migration lock and the later ones find nothing left to apply.
+func (s *Server) autoMigrate(ctx context.Context) error {
+	db, err := sql.Open("postgres", s.cfg.DBURL)
+	if err != nil { return fmt.Errorf("open db: %w", err) }
+	defer db.Close()
+	s.log.Info("applying pending migrations")
+	if err := migrate.Run(ctx, s.log, db, migrations.Open(s.cfg.MigrationsDir), s.cfg.Environment); err != nil { return fmt.Errorf("auto-migrate: %w", err) }
+	return nil
+}
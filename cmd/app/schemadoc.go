@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/doesnotcommit/bestfriends/internal/schemadoc"
+	"github.com/doesnotcommit/bestfriends/migrations"
+)
+
+// schemaDocCache keeps the rendered schema reference for one schema version, so /admin/schema
+// introspects the database again only after a migration has run.
+type schemaDocCache struct {
+	mu       sync.Mutex
+	version  int
+	md, html []byte
+}
+
+// schemaDoc returns the schema reference as Markdown or HTML, regenerating it when the applied
+// schema version has changed since it was last built.
+func (s *Server) schemaDoc(ctx context.Context, markdown bool) ([]byte, error) {
+	v, err := s.schemaVersion(ctx)
+	if err != nil { return nil, err }
+	c := &s.schemaDocs
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.md == nil || c.version != v {
+		doc, err := schemadoc.Inspect(ctx, s.db)
+		if err != nil { return nil, err }
+		if err := doc.Annotate(migrations.Open(s.cfg.MigrationsDir)); err != nil { return nil, err }
+		var md, html bytes.Buffer
+		if err := doc.Markdown(&md); err != nil { return nil, err }
+		if err := doc.HTML(&html); err != nil { return nil, err }
+		c.version, c.md, c.html = v, md.Bytes(), html.Bytes()
+	}
+	if markdown { return c.md, nil }
+	return c.html, nil
+}
+
+// handleAdminSchema serves the database schema reference: GET /admin/schema, with ?format=md
+// for Markdown.
+func (s *Server) handleAdminSchema(w http.ResponseWriter, r *http.Request) {
+	markdown := r.URL.Query().Get("format") == "md"
+	doc, err := s.schemaDoc(r.Context(), markdown)
+	if err != nil {
+		s.log.Error("schema doc", "err", err)
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if markdown {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	w.Write(doc)
+}
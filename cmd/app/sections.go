@@ -0,0 +1,323 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// The home page is composed of sections in the order of the layout admins set on
+// /admin/layout: the leaderboard (the searchable cloud the page always had) and blocks of
+// cards picked by the section kinds below. Without a layout, or while searching or
+// filtering by country, the page is the leaderboard alone.
+
+const (
+	maxSections    = 12
+	maxSectionSize = 50
+	trendingWindow = 24 * time.Hour
+)
+
+// sectionKind is a kind of section: how the editor describes it, its default size and title,
+// and how its profiles are loaded. The leaderboard has no loader; writeHome streams it.
+type sectionKind struct {
+	name  string
+	doc   string
+	size  int
+	title func(sec views.LayoutSection, n int) string
+	load  func(s *Server, ctx context.Context, sec views.LayoutSection, n int) ([]Profile, error)
+}
+
+var sectionKinds = []sectionKind{
+	{name: "leaderboard", doc: "The full leaderboard with search (page_size profiles, pins first).",
+		title: func(views.LayoutSection, int) string { return "" }},
+	{name: "top", doc: "The most voted profiles.", size: 10,
+		title: func(_ views.LayoutSection, n int) string { return fmt.Sprintf("Top %d", n) },
+		load: func(s *Server, ctx context.Context, _ views.LayoutSection, n int) ([]Profile, error) {
+			return s.loadProfiles(ctx, profileFilter{Limit: n})
+		}},
+	{name: "trending", doc: "Most votes in the last 24 hours.", size: 10,
+		title: func(views.LayoutSection, int) string { return "Trending today" },
+		load: func(s *Server, ctx context.Context, _ views.LayoutSection, n int) ([]Profile, error) {
+			ids, err := s.trendingIDs(ctx, time.Now().Add(-trendingWindow), n)
+			if err != nil { return nil, err }
+			return s.loadProfilesByID(ctx, ids)
+		}},
+	{name: "newest", doc: "The most recently added profiles.", size: 10,
+		title: func(views.LayoutSection, int) string { return "Newest exhibits" },
+		load: func(s *Server, ctx context.Context, _ views.LayoutSection, n int) ([]Profile, error) {
+			return s.loadProfiles(ctx, profileFilter{Limit: n, Newest: true})
+		}},
+	{name: "random", doc: "Profiles picked at random on every page view, to give every entry a turn.", size: 1,
+		title: func(views.LayoutSection, int) string { return "Spotlight" },
+		load: func(s *Server, ctx context.Context, _ views.LayoutSection, n int) ([]Profile, error) {
+			ids, err := s.randomProfileIDs(ctx, n)
+			if err != nil { return nil, err }
+			return s.loadProfilesByID(ctx, ids)
+		}},
+	{name: "country", doc: "The most voted profiles of one country (set Country).", size: 5,
+		title: func(sec views.LayoutSection, _ int) string { return "Top of " + sec.Country },
+		load: func(s *Server, ctx context.Context, sec views.LayoutSection, n int) ([]Profile, error) {
+			return s.loadProfiles(ctx, profileFilter{Country: sec.Country, Limit: n})
+		}},
+}
+
+func lookupSectionKind(name string) *sectionKind {
+	for i := range sectionKinds {
+		if sectionKinds[i].name == name { return &sectionKinds[i] }
+	}
+	return nil
+}
+
+// defaultLayout is the home page without a layout set.
+var defaultLayout = []views.LayoutSection{{Kind: "leaderboard"}}
+
+// homeLayout returns the cached layout.
+func (s *Server) homeLayout() []views.LayoutSection {
+	if l := s.layout.Load(); l != nil && len(*l) > 0 { return *l }
+	return defaultLayout
+}
+
+// loadLayout refreshes the layout cache from home_sections; it reloads with the site copy.
+func (s *Server) loadLayout(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT kind, title, size, country FROM home_sections ORDER BY position`)
+	if err != nil { return err }
+	defer rows.Close()
+	var list []views.LayoutSection
+	for rows.Next() {
+		var sec views.LayoutSection
+		if err := rows.Scan(&sec.Kind, &sec.Title, &sec.Size, &sec.Country); err != nil { return err }
+		if lookupSectionKind(sec.Kind) == nil { continue } // written by a newer build
+		list = append(list, sec)
+	}
+	if err := rows.Err(); err != nil { return err }
+	s.layout.Store(&list)
+	return nil
+}
+
+type ErrorInvalidLayout string
+
+func (e ErrorInvalidLayout) Error() string { return string(e) }
+func (ErrorInvalidLayout) InvalidLayout()   {}
+
+func validateLayout(list []views.LayoutSection) error {
+	if len(list) > maxSections { return ErrorInvalidLayout(fmt.Sprintf("at most %d sections", maxSections)) }
+	leaderboards := 0
+	for i, sec := range list {
+		if lookupSectionKind(sec.Kind) == nil { return ErrorInvalidLayout(fmt.Sprintf("section %d: unknown kind %q", i+1, sec.Kind)) }
+		if sec.Kind == "leaderboard" { leaderboards++ }
+		if sec.Size < 0 || sec.Size > maxSectionSize {
+			return ErrorInvalidLayout(fmt.Sprintf("section %d: size must be between 1 and %d (0 for the default)", i+1, maxSectionSize))
+		}
+		if sec.Kind == "country" && strings.TrimSpace(sec.Country) == "" { return ErrorInvalidLayout(fmt.Sprintf("section %d: country is required", i+1)) }
+		if len([]rune(sec.Title)) > 80 || len([]rune(sec.Country)) > 80 { return ErrorInvalidLayout(fmt.Sprintf("section %d: title and country are limited to 80 characters", i+1)) }
+	}
+	if leaderboards > 1 { return ErrorInvalidLayout("the leaderboard can only appear once") }
+	return nil
+}
+
+// saveLayout replaces the layout; an empty list restores the plain leaderboard.
+func (s *Server) saveLayout(ctx context.Context, list []views.LayoutSection, actor string) error {
+	for i := range list {
+		list[i].Title, list[i].Country = strings.TrimSpace(list[i].Title), strings.TrimSpace(list[i].Country)
+		if list[i].Kind != "country" { list[i].Country = "" }
+	}
+	if err := validateLayout(list); err != nil { return err }
+	if err := s.writable(); err != nil { return err }
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM home_sections WHERE true`); err != nil { return err }
+		for i, sec := range list {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO home_sections (position, kind, title, size, country, updated_by) VALUES ($1, $2, $3, $4, $5, $6)
+			`, i+1, sec.Kind, sec.Title, sec.Size, sec.Country, actor); err != nil { return err }
+		}
+		return nil
+	})
+	if err != nil { return err }
+	s.layout.Store(&list)
+	s.log.Info("home layout updated", "sections", len(list), "by", actor)
+	return nil
+}
+
+// homeBlock is a section ready to write: the leaderboard (section nil) or loaded cards.
+type homeBlock struct {
+	section *views.HomeSection
+	cards   []Profile
+}
+
+// homeBlocks loads the sections of the current layout. A section that fails to load is
+// logged and left out rather than failing the page, and empty ones are left out too.
+func (s *Server) homeBlocks(ctx context.Context) []homeBlock {
+	blocks := []homeBlock{}
+	for i, sec := range s.homeLayout() {
+		kind := lookupSectionKind(sec.Kind)
+		if kind.load == nil {
+			blocks = append(blocks, homeBlock{})
+			continue
+		}
+		n := cmp.Or(sec.Size, kind.size)
+		cards, err := kind.load(s, ctx, sec, n)
+		if err != nil {
+			s.log.Warn("home section", "kind", sec.Kind, "err", err)
+			continue
+		}
+		if len(cards) == 0 { continue }
+		hs := &views.HomeSection{ID: "s-" + strconv.Itoa(i+1), Kind: sec.Kind, Title: sec.Title, MinVotes: cards[0].Votes, MaxVotes: cards[0].Votes}
+		if hs.Title == "" { hs.Title = kind.title(sec, n) }
+		for _, p := range cards {
+			hs.MinVotes, hs.MaxVotes = min(hs.MinVotes, p.Votes), max(hs.MaxVotes, p.Votes)
+		}
+		if hs.MaxVotes == hs.MinVotes { hs.MaxVotes++ } // the card scale divides by the range
+		blocks = append(blocks, homeBlock{section: hs, cards: cards})
+	}
+	return blocks
+}
+
+// hasLeaderboard reports whether blocks include the leaderboard; nil blocks are the default layout.
+func hasLeaderboard(blocks []homeBlock) bool {
+	return blocks == nil || slices.ContainsFunc(blocks, func(b homeBlock) bool { return b.section == nil })
+}
+
+// trendingIDs returns the profiles with the most votes since since, most first.
+func (s *Server) trendingIDs(ctx context.Context, since time.Time, n int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT profile_id::string FROM votes WHERE created_at >= $1
+		GROUP BY profile_id
+		ORDER BY count(*) DESC, profile_id
+		LIMIT $2
+	`, since, n)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil { return nil, err }
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// loadProfilesByID loads the active profiles among ids, in the order of ids.
+func (s *Server) loadProfilesByID(ctx context.Context, ids []string) ([]Profile, error) {
+	if len(ids) == 0 { return nil, nil }
+	list, err := s.loadProfiles(ctx, profileFilter{IDs: ids, Limit: len(ids)})
+	if err != nil { return nil, err }
+	pos := make(map[string]int, len(ids))
+	for i, id := range ids { pos[id] = i }
+	out := slices.Clone(list) // loadProfiles results are shared
+	slices.SortFunc(out, func(a, b Profile) int { return pos[a.ID] - pos[b.ID] })
+	return out, nil
+}
+
+// layoutKinds describes the section kinds for the editor.
+func layoutKinds() []views.LayoutKind {
+	out := make([]views.LayoutKind, len(sectionKinds))
+	for i, k := range sectionKinds { out[i] = views.LayoutKind{Name: k.name, Description: k.doc} }
+	return out
+}
+
+// layoutEditorRows is the layout followed by blank rows for new sections.
+func layoutEditorRows(list []views.LayoutSection) []views.LayoutRow {
+	rows := make([]views.LayoutRow, len(list)+3)
+	for i := range rows {
+		rows[i].Position = i + 1
+		if i < len(list) { rows[i].Section = list[i] }
+	}
+	return rows
+}
+
+// handleAdminLayout is the layout editor: GET shows the sections, POST saves them. Rows
+// come as parallel kind/title/size/country/position fields; rows without a kind are dropped
+// and the rest are ordered by position.
+func (s *Server) handleAdminLayout(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		var list []views.LayoutSection
+		if l := s.layout.Load(); l != nil { list = *l }
+		s.render(w, "admin_layout.gohtml", views.AdminLayoutView{Rows: layoutEditorRows(list), Kinds: layoutKinds()})
+		return
+	}
+	list, err := parseLayoutForm(r)
+	if err == nil {
+		actor, _ := s.adminActor(r)
+		err = s.saveLayout(r.Context(), list, actor)
+	}
+	switch {
+	case errors.As(err, new(interface{ InvalidLayout() })):
+		s.renderStatus(w, http.StatusBadRequest, "admin_layout.gohtml", views.AdminLayoutView{Rows: layoutEditorRows(list), Kinds: layoutKinds(), Error: err.Error()})
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		http.Error(w, "db error", http.StatusInternalServerError)
+	default:
+		s.render(w, "admin_layout.gohtml", views.AdminLayoutView{Rows: layoutEditorRows(list), Kinds: layoutKinds(),
+			Notice: "Saved."})
+	}
+}
+
+func parseLayoutForm(r *http.Request) ([]views.LayoutSection, error) {
+	if err := r.ParseForm(); err != nil { return nil, ErrorInvalidLayout("bad form") }
+	type row struct {
+		pos int
+		sec views.LayoutSection
+	}
+	var rows []row
+	for i, kind := range r.PostForm["kind"] {
+		field := func(name string) string {
+			if v := r.PostForm[name]; i < len(v) { return v[i] }
+			return ""
+		}
+		if kind == "" { continue }
+		size, err := strconv.Atoi(zeroIfEmpty(field("size")))
+		if err != nil { return nil, ErrorInvalidLayout(fmt.Sprintf("row %d: size must be a number", i+1)) }
+		pos, err := strconv.Atoi(zeroIfEmpty(field("position")))
+		if err != nil { return nil, ErrorInvalidLayout(fmt.Sprintf("row %d: position must be a number", i+1)) }
+		rows = append(rows, row{pos, views.LayoutSection{Kind: kind, Title: field("title"), Size: size, Country: field("country")}})
+	}
+	slices.SortStableFunc(rows, func(a, b row) int { return a.pos - b.pos })
+	list := make([]views.LayoutSection, len(rows))
+	for i, rw := range rows { list[i] = rw.sec }
+	return list, nil
+}
+
+// zeroIfEmpty reads an empty number field as 0.
+func zeroIfEmpty(v string) string {
+	if v = strings.TrimSpace(v); v == "" { return "0" }
+	return v
+}
+
+// handleAPIAdminLayout reads (GET) or replaces (PUT) the home page layout:
+// {"sections": [{"kind", "title", "size", "country"}, ...]}; an empty list restores the default.
+func (s *Server) handleAPIAdminLayout(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var req struct {
+			Sections []views.LayoutSection `json:"sections"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad json")
+			return
+		}
+		actor, _ := s.adminActor(r)
+		err := s.saveLayout(r.Context(), req.Sections, actor)
+		switch {
+		case errors.As(err, new(interface{ InvalidLayout() })):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+			return
+		case err != nil:
+			writeJSONError(w, http.StatusInternalServerError, "db error")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sections": s.homeLayout()})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+func TestValidateLayout(t *testing.T) {
+	ok := []views.LayoutSection{{Kind: "random"}, {Kind: "leaderboard"}, {Kind: "country", Country: "Chile", Size: 5}, {Kind: "top", Size: maxSectionSize}}
+	if err := validateLayout(ok); err != nil { t.Fatal(err) }
+	for name, bad := range map[string][]views.LayoutSection{
+		"unknown kind":      {{Kind: "carousel"}},
+		"two leaderboards":  {{Kind: "leaderboard"}, {Kind: "leaderboard"}},
+		"country missing":   {{Kind: "country"}},
+		"size too large":    {{Kind: "top", Size: maxSectionSize + 1}},
+		"negative size":     {{Kind: "newest", Size: -1}},
+		"long title":        {{Kind: "top", Title: strings.Repeat("x", 81)}},
+		"too many sections": make([]views.LayoutSection, maxSections+1),
+	} {
+		if err := validateLayout(bad); err == nil { t.Errorf("%s: accepted", name) }
+	}
+}
+
+func TestParseLayoutForm(t *testing.T) {
+	form := url.Values{
+		"position": {"2", "1", "3", "4"},
+		"kind":     {"leaderboard", "country", "", "top"},
+		"title":    {"", "Chile's best", "", ""},
+		"size":     {"", "3", "", "x"},
+		"country":  {"", "Chile", "", ""},
+	}
+	r := httptest.NewRequest("POST", "/admin/layout", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := parseLayoutForm(r); err == nil { t.Fatal("non-numeric size accepted") }
+
+	form["size"][3] = "0"
+	r = httptest.NewRequest("POST", "/admin/layout", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	list, err := parseLayoutForm(r)
+	if err != nil { t.Fatal(err) }
+	want := []views.LayoutSection{{Kind: "country", Title: "Chile's best", Size: 3, Country: "Chile"}, {Kind: "leaderboard"}, {Kind: "top"}}
+	if !reflect.DeepEqual(list, want) { t.Errorf("parseLayoutForm = %+v, want %+v (by position, blank kinds dropped)", list, want) }
+}
+
+func TestHasLeaderboard(t *testing.T) {
+	if !hasLeaderboard(nil) || !hasLeaderboard([]homeBlock{{section: &views.HomeSection{}}, {}}) {
+		t.Error("default or explicit leaderboard not found")
+	}
+	if hasLeaderboard([]homeBlock{}) || hasLeaderboard([]homeBlock{{section: &views.HomeSection{}}}) {
+		t.Error("layout without the leaderboard reported one")
+	}
+}
+
+func TestPickRandom(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	for _, n := range []int{0, 1, 3, 5, 8, 20} {
+		got := pickRandom(ids, n)
+		if len(got) != min(n, len(ids)) { t.Errorf("pickRandom(%d) = %d ids", n, len(got)) }
+		seen := map[string]bool{}
+		for _, id := range got {
+			if seen[id] || !slices.Contains(ids, id) { t.Errorf("pickRandom(%d) = %v: duplicate or unknown id", n, got) }
+			seen[id] = true
+		}
+	}
+	// Every id turns up as a single pick.
+	seen := map[string]bool{}
+	for i := 0; i < 1000 && len(seen) < len(ids); i++ { seen[pickRandom(ids, 1)[0]] = true }
+	if len(seen) != len(ids) { t.Errorf("1000 picks saw only %d of %d ids", len(seen), len(ids)) }
+}
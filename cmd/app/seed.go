@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand/v2"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// seedPeople and seedPlaces are combined into demo profiles. The places repeat countries so
+// the per-country leaderboards and champions have something to rank.
+var (
+	seedPeople = []string{"Ada", "Bruno", "Chiara", "Dmitri", "Esi", "Farah", "Goran", "Hana", "Ines", "Jonas",
+		"Kemal", "Lucía", "Mateo", "Nia", "Olek", "Priya", "Quentin", "Rosa", "Sven", "Tomoko", "Uma", "Viktor", "Wen", "Yara"}
+	seedPlaces = [][2]string{{"Chile", "Valparaíso"}, {"Chile", "Santiago"}, {"Peru", "Lima"}, {"Germany", "Berlin"},
+		{"Germany", "Leipzig"}, {"Japan", "Osaka"}, {"Kenya", "Nairobi"}, {"Portugal", "Porto"}}
+)
+
+// seed adds n demo profiles with generated photos and up to maxVotes votes each, recorded in
+// votes over the past week so sparklines and reconcile see them like real votes.
+// It refuses to touch a database that has profiles unless force is set.
+func (s *Server) seed(ctx context.Context, n, maxVotes int, force bool) error {
+	if err := s.writable(); err != nil { return err }
+	var existing int
+	if err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM profiles`).Scan(&existing); err != nil { return err }
+	if existing > 0 && !force { return fmt.Errorf("database already has %d profiles; use -force to seed anyway", existing) }
+
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("%s (demo %d)", seedPeople[i%len(seedPeople)], i+1)
+		place := seedPlaces[i%len(seedPlaces)]
+		photo, contentType, err := imaging.Process(seedPhoto(i), imaging.MaxWidth, imaging.MaxBytes)
+		if err != nil { return fmt.Errorf("seed photo: %w", err) }
+		votes := 0
+		if maxVotes > 0 { votes = rand.IntN(maxVotes + 1) }
+		inline, key, err := store.PutPhoto(ctx, s.blobs, photo, contentType)
+		if err != nil { return err }
+		err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+			cityID, err := resolveCity(ctx, tx, place[0], place[1])
+			if err != nil { return err }
+			var id string
+			if err := tx.QueryRowContext(ctx, `
+				INSERT INTO profiles (full_name, location_country, location_city, city_id, description, photo_webp, photo_key, photo_size, photo_content_type, votes_count)
+				VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10)
+				RETURNING id::string
+			`, name, place[0], place[1], cityID, "Seeded for local development.", inline, key, len(photo), contentType, votes).Scan(&id); err != nil { return err }
+			return s.insertPastVotes(ctx, tx, `
+				SELECT gen_random_uuid(), $1, now() - interval '1 hour' - random() * interval '6 days'
+				FROM generate_series(1, $2)
+			`, id, votes)
+		})
+		if err != nil { return fmt.Errorf("seed %s: %w", name, err) }
+	}
+	s.log.Info("seeded", "profiles", n, "max_votes", maxVotes)
+	if err := s.refreshChampions(ctx); err != nil { s.log.Warn("refresh champions after seeding", "err", err) }
+	return nil
+}
+
+// seedPhoto draws a small two-tone PNG, different for every i, for the pipeline to encode.
+func seedPhoto(i int) []byte {
+	const w, h = 240, 300
+	hue := uint8(i * 47)
+	bg := color.RGBA{hue, 200 - hue/2, 255 - hue, 255}
+	fg := color.RGBA{255 - hue, hue / 2, 120 + hue/3, 255}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := x-w/2, y-h/3
+			c := bg
+			if dx*dx+dy*dy < 60*60 || (y > h*2/3 && dx*dx < 90*90) { c = fg }
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	return buf.Bytes()
+}
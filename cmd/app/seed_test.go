@@ -0,0 +1,19 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+)
+
+func TestSeedPhotosPassThePipeline(t *testing.T) {
+	var prev []byte
+	for i := 0; i < 3; i++ {
+		out, contentType, err := imaging.Process(seedPhoto(i), imaging.MaxWidth, imaging.MaxBytes)
+		if err != nil { t.Fatalf("photo %d: %v", i, err) }
+		if contentType != imaging.ContentType || len(out) > imaging.MaxBytes { t.Errorf("photo %d: %s, %d bytes", i, contentType, len(out)) }
+		if bytes.Equal(out, prev) { t.Errorf("photo %d is the same as the one before", i) }
+		prev = out
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// Settings are operational knobs admins can change at runtime without a deploy. Each is
+// declared below with its type, default and bounds; app_settings only holds the ones an
+// admin changed. Instances cache the table and pick up edits made elsewhere on the site
+// copy reload interval (LEADERBOARD_SITE_COPY_RELOAD).
+
+type settingKind string
+
+const (
+	settingInt      settingKind = "int"
+	settingBool     settingKind = "bool"
+	settingDuration settingKind = "duration"
+	settingChoice   settingKind = "choice" // one of the def's choices
+)
+
+// settingDef declares a setting. min and max bound ints, and durations in nanoseconds;
+// choices lists a choice setting's values.
+type settingDef struct {
+	key      string
+	kind     settingKind
+	def      any
+	min, max int64
+	choices  []string
+	doc      string
+}
+
+var (
+	settingVoteCooldown = &settingDef{key: "vote_cooldown", kind: settingDuration, def: time.Hour,
+		min: int64(time.Minute), max: int64(24 * time.Hour), doc: "How long each voter waits before voting for the same profile again."}
+	settingVoteCap = &settingDef{key: "vote_profile_cap", kind: settingInt, def: 60,
+		min: 0, max: 100000, doc: "Most votes a profile takes per vote cooldown from all voters together; 0 is no cap."}
+	settingPageSize = &settingDef{key: "page_size", kind: settingInt, def: defaultPageSize,
+		min: 1, max: maxProfiles, doc: "Profiles per page of the home page and the leaderboard fragment; Load more fetches the next page."}
+	settingSubmissionsOpen = &settingDef{key: "submissions_open", kind: settingBool, def: true,
+		doc: "Whether visitors may submit new profiles."}
+	settingSparklines = &settingDef{key: "sparklines", kind: settingBool, def: true,
+		doc: "Whether cards show the 7-day vote sparkline (off saves the trend query)."}
+	settingPhotoHotlink = &settingDef{key: "photo_hotlink_protection", kind: settingBool, def: false,
+		doc: "Whether photos refuse requests referred by other sites (except LEADERBOARD_PHOTO_REFERERS and embed URLs)."}
+	settingSpotlight = &settingDef{key: "spotlight", kind: settingBool, def: true,
+		doc: "Whether an exhibit of the day is chosen daily and shown in the home page header."}
+	settingNameUniqueness = &settingDef{key: "name_uniqueness", kind: settingChoice, def: nameAllow, choices: []string{nameAllow, nameWarn, nameEnforce},
+		doc: "Whether a new profile may share its name with one in the same city (ignoring case and spacing): allow, warn (the submitter confirms first) or enforce (refused, pointing at the existing profile)."}
+)
+
+// settingDefs lists every setting in the order admin pages show them.
+var settingDefs = []*settingDef{settingVoteCooldown, settingVoteCap, settingPageSize, settingSubmissionsOpen, settingSparklines, settingPhotoHotlink, settingSpotlight, settingNameUniqueness}
+
+func lookupSetting(key string) *settingDef {
+	for _, d := range settingDefs {
+		if d.key == key { return d }
+	}
+	return nil
+}
+
+type ErrorInvalidSetting string
+
+func (e ErrorInvalidSetting) Error() string { return string(e) }
+func (ErrorInvalidSetting) InvalidSetting()  {}
+
+// parse checks raw against d's type and bounds and returns its value.
+func (d *settingDef) parse(raw string) (any, error) {
+	raw = strings.TrimSpace(raw)
+	switch d.kind {
+	case settingInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil { return nil, ErrorInvalidSetting(d.key + " must be a whole number") }
+		if int64(n) < d.min || int64(n) > d.max { return nil, ErrorInvalidSetting(fmt.Sprintf("%s must be between %d and %d", d.key, d.min, d.max)) }
+		return n, nil
+	case settingBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil { return nil, ErrorInvalidSetting(d.key + " must be true or false") }
+		return b, nil
+	case settingDuration:
+		v, err := time.ParseDuration(raw)
+		if err != nil { return nil, ErrorInvalidSetting(d.key + " must be a duration like 30m or 2h") }
+		if int64(v) < d.min || int64(v) > d.max {
+			return nil, ErrorInvalidSetting(fmt.Sprintf("%s must be between %s and %s", d.key, time.Duration(d.min), time.Duration(d.max)))
+		}
+		return v, nil
+	case settingChoice:
+		if !slices.Contains(d.choices, raw) { return nil, ErrorInvalidSetting(d.key + " must be one of " + strings.Join(d.choices, ", ")) }
+		return raw, nil
+	}
+	return nil, ErrorInvalidSetting("unknown setting type " + string(d.kind))
+}
+
+// format renders v the way parse reads it.
+func (d *settingDef) format(v any) string {
+	if v, ok := v.(time.Duration); ok { return shortDuration(v) }
+	return fmt.Sprint(v)
+}
+
+// shortDuration is time.Duration's String without trailing zero units ("1h" for 1h0m0s).
+func shortDuration(v time.Duration) string {
+	s := v.String()
+	if strings.HasSuffix(s, "m0s") { s = s[:len(s)-2] }
+	if strings.HasSuffix(s, "h0m") { s = s[:len(s)-2] }
+	return s
+}
+
+// storedSetting is an app_settings row that passed parse.
+type storedSetting struct {
+	value     any
+	raw       string
+	updatedAt time.Time
+	updatedBy string
+}
+
+// settingsCache holds the app_settings rows; settings without one read as their default.
+type settingsCache struct {
+	rows atomic.Pointer[map[string]storedSetting]
+}
+
+func (c *settingsCache) value(d *settingDef) any {
+	if m := c.rows.Load(); m != nil {
+		if r, ok := (*m)[d.key]; ok { return r.value }
+	}
+	return d.def
+}
+
+func (c *settingsCache) GetInt(d *settingDef) int                { return c.value(d).(int) }
+func (c *settingsCache) GetBool(d *settingDef) bool              { return c.value(d).(bool) }
+func (c *settingsCache) GetDuration(d *settingDef) time.Duration { return c.value(d).(time.Duration) }
+func (c *settingsCache) GetString(d *settingDef) string          { return c.value(d).(string) }
+
+// loadSettings refreshes the cache from app_settings. Rows for settings this build doesn't
+// know (written by a newer one), or that no longer parse, are skipped.
+func (s *Server) loadSettings(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT key, type, value, updated_at, updated_by FROM app_settings`)
+	if err != nil { return err }
+	defer rows.Close()
+	m := map[string]storedSetting{}
+	for rows.Next() {
+		var key, kind string
+		var r storedSetting
+		if err := rows.Scan(&key, &kind, &r.raw, &r.updatedAt, &r.updatedBy); err != nil { return err }
+		d := lookupSetting(key)
+		if d == nil || string(d.kind) != kind { continue }
+		if r.value, err = d.parse(r.raw); err != nil {
+			s.log.Warn("setting ignored", "key", key, "err", err)
+			continue
+		}
+		m[key] = r
+	}
+	if err := rows.Err(); err != nil { return err }
+	s.settings.rows.Store(&m)
+	return nil
+}
+
+// saveSetting stores raw for key, or with reset deletes the row so the default applies again.
+func (s *Server) saveSetting(ctx context.Context, key, raw string, reset bool, actor string) error {
+	d := lookupSetting(key)
+	if d == nil { return ErrNotFound }
+	if !reset {
+		v, err := d.parse(raw)
+		if err != nil { return err }
+		raw = d.format(v)
+	}
+	if err := s.writable(); err != nil { return err }
+	var err error
+	if reset {
+		_, err = s.db.ExecContext(ctx, `DELETE FROM app_settings WHERE key = $1`, key)
+	} else {
+		_, err = s.db.ExecContext(ctx, `
+			UPSERT INTO app_settings (key, type, value, updated_at, updated_by) VALUES ($1, $2, $3, now(), $4)
+		`, key, string(d.kind), raw, actor)
+	}
+	if err != nil { return err }
+	s.log.Info("setting updated", "key", key, "value", raw, "reset", reset, "by", actor)
+	return s.loadSettings(ctx)
+}
+
+// settingViews lists every setting with its current value.
+func (s *Server) settingViews() []views.Setting {
+	m := map[string]storedSetting{}
+	if p := s.settings.rows.Load(); p != nil { m = *p }
+	out := make([]views.Setting, 0, len(settingDefs))
+	for _, d := range settingDefs {
+		v := views.Setting{Key: d.key, Type: string(d.kind), Value: d.format(s.settings.value(d)), Default: d.format(d.def), Choices: d.choices, Doc: d.doc}
+		if r, ok := m[d.key]; ok { v.Custom, v.UpdatedAt, v.UpdatedBy = true, r.updatedAt, r.updatedBy }
+		out = append(out, v)
+	}
+	return out
+}
+
+// handleAdminSettings is the settings editor: GET lists them, POST saves one (key, value)
+// or resets it to its default (reset=1).
+func (s *Server) handleAdminSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.render(w, "admin_settings.gohtml", views.AdminSettingsView{Settings: s.settingViews()})
+		return
+	}
+	actor, _ := s.adminActor(r)
+	key := r.FormValue("key")
+	err := s.saveSetting(r.Context(), key, r.FormValue("value"), r.FormValue("reset") == "1", actor)
+	switch {
+	case errors.As(err, new(interface{ InvalidSetting() })):
+		s.renderStatus(w, http.StatusBadRequest, "admin_settings.gohtml", views.AdminSettingsView{Settings: s.settingViews(), Error: err.Error()})
+	case errors.As(err, new(interface{ NotFound() })):
+		http.Error(w, "unknown setting", http.StatusBadRequest)
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		http.Error(w, "db error", http.StatusInternalServerError)
+	default:
+		s.render(w, "admin_settings.gohtml", views.AdminSettingsView{Settings: s.settingViews(), Notice: "Saved " + key + "."})
+	}
+}
+
+// handleAPIAdminSettings lists the settings: GET /api/v1/admin/settings
+func (s *Server) handleAPIAdminSettings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"settings": s.settingViews()})
+}
+
+// handleAPIAdminSetting changes one setting: PUT /api/v1/admin/settings/{key} {"value": "..."};
+// DELETE resets it to its default.
+func (s *Server) handleAPIAdminSetting(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Value string `json:"value"`
+	}
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad json")
+			return
+		}
+	}
+	actor, _ := s.adminActor(r)
+	key := r.PathValue("key")
+	err := s.saveSetting(r.Context(), key, body.Value, r.Method == http.MethodDelete, actor)
+	switch {
+	case errors.As(err, new(interface{ InvalidSetting() })):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "unknown setting")
+		return
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+		return
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	for _, v := range s.settingViews() {
+		if v.Key == key { writeJSON(w, http.StatusOK, v) }
+	}
+}
+
+// cooldownText is the vote cooldown as page text says it: "an hour", "2 hours", "30 minutes".
+func cooldownText(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "an hour"
+	case d%time.Hour == 0:
+		return plural(int(d/time.Hour), "hour")
+	default:
+		return plural(int((d+time.Minute-1)/time.Minute), "minute")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettingParse(t *testing.T) {
+	tests := []struct {
+		def  *settingDef
+		raw  string
+		want any
+	}{
+		{settingVoteCooldown, " 30m ", 30 * time.Minute},
+		{settingVoteCooldown, "24h", 24 * time.Hour},
+		{settingVoteCooldown, "30s", nil},
+		{settingVoteCooldown, "25h", nil},
+		{settingVoteCooldown, "60", nil},
+		{settingPageSize, "50", 50},
+		{settingPageSize, "0", nil},
+		{settingPageSize, "501", nil},
+		{settingPageSize, "5.5", nil},
+		{settingSparklines, "false", false},
+		{settingSparklines, "off", nil},
+	}
+	for _, tt := range tests {
+		got, err := tt.def.parse(tt.raw)
+		if tt.want == nil {
+			if err == nil { t.Errorf("%s: parse(%q) = %v, want an error", tt.def.key, tt.raw, got) }
+			continue
+		}
+		if err != nil || got != tt.want { t.Errorf("%s: parse(%q) = %v, %v; want %v", tt.def.key, tt.raw, got, err, tt.want) }
+	}
+}
+
+// Defaults must pass their own checks and survive a format/parse round trip, since the
+// editor shows them formatted and saves what it shows.
+func TestSettingDefaults(t *testing.T) {
+	var c settingsCache
+	for _, d := range settingDefs {
+		v, err := d.parse(d.format(d.def))
+		if err != nil || v != d.def { t.Errorf("%s: default %v round-trips to %v, %v", d.key, d.def, v, err) }
+		switch d.kind {
+		case settingInt:
+			c.GetInt(d)
+		case settingBool:
+			c.GetBool(d)
+		case settingDuration:
+			c.GetDuration(d)
+		}
+	}
+	if got := c.GetDuration(settingVoteCooldown); got != time.Hour { t.Errorf("vote_cooldown without a row = %v, want 1h", got) }
+	c.rows.Store(&map[string]storedSetting{"vote_cooldown": {value: 90 * time.Minute}})
+	if got := c.GetDuration(settingVoteCooldown); got != 90*time.Minute { t.Errorf("vote_cooldown = %v, want 90m", got) }
+}
+
+func TestCooldownText(t *testing.T) {
+	for d, want := range map[time.Duration]string{time.Hour: "an hour", 2 * time.Hour: "2 hours", 30 * time.Minute: "30 minutes",
+		time.Minute: "1 minute", 90 * time.Minute: "90 minutes"} {
+		if got := cooldownText(d); got != want { t.Errorf("cooldownText(%v) = %q, want %q", d, got, want) }
+	}
+	if got := shortDuration(90 * time.Minute); got != "1h30m" { t.Errorf("shortDuration(90m) = %q", got) }
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// defaultSiteCopy is shown until an admin changes it, and for keys missing from site_settings.
+var defaultSiteCopy = views.SiteCopy{
+	Title:  "Best Friends",
+	Footer: "Curated by anonymous cowards since 2025",
+}
+
+// siteCopyFields maps site_settings keys to SiteCopy fields, with their length limits.
+var siteCopyFields = []struct {
+	key   string
+	max   int
+	field func(*views.SiteCopy) *string
+}{
+	{"title", 80, func(c *views.SiteCopy) *string { return &c.Title }},
+	{"tagline", 160, func(c *views.SiteCopy) *string { return &c.Tagline }},
+	{"welcome", 1000, func(c *views.SiteCopy) *string { return &c.Welcome }},
+	{"footer", 200, func(c *views.SiteCopy) *string { return &c.Footer }},
+}
+
+// site returns the cached site copy; templates call it as the site func.
+func (s *Server) site() views.SiteCopy {
+	if c := s.siteCopy.Load(); c != nil { return *c }
+	return defaultSiteCopy
+}
+
+// loadSiteCopy refreshes the cache from site_settings.
+func (s *Server) loadSiteCopy(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT key, value FROM site_settings`)
+	if err != nil { return err }
+	defer rows.Close()
+	values := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil { return err }
+		values[k] = v
+	}
+	if err := rows.Err(); err != nil { return err }
+	c := defaultSiteCopy
+	for _, f := range siteCopyFields {
+		if v, ok := values[f.key]; ok { *f.field(&c) = v }
+	}
+	s.siteCopy.Store(&c)
+	return nil
+}
+
+// reloadSiteCopy keeps the site copy, settings and home layout caches in step with edits made through
+// other instances. Unlike the jobs in jobs.go it keeps running while read-only, since it
+// only reads.
+func (s *Server) reloadSiteCopy(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		if err := s.loadSiteCopy(ctx); err != nil && ctx.Err() == nil {
+			s.log.Error("site copy reload failed", "err", err)
+		}
+		if err := s.loadSettings(ctx); err != nil && ctx.Err() == nil {
+			s.log.Error("settings reload failed", "err", err)
+		}
+		if err := s.loadLayout(ctx); err != nil && ctx.Err() == nil {
+			s.log.Error("home layout reload failed", "err", err)
+		}
+	}
+}
+
+type ErrorInvalidSiteCopy string
+
+func (e ErrorInvalidSiteCopy) Error() string { return string(e) }
+func (ErrorInvalidSiteCopy) InvalidSiteCopy() {}
+
+func validateSiteCopy(c views.SiteCopy) error {
+	if strings.TrimSpace(c.Title) == "" { return ErrorInvalidSiteCopy("title is required") }
+	for _, f := range siteCopyFields {
+		if n := len([]rune(*f.field(&c))); n > f.max {
+			return ErrorInvalidSiteCopy(fmt.Sprintf("%s is longer than %d characters", f.key, f.max))
+		}
+	}
+	return nil
+}
+
+// saveSiteCopy stores c and updates this instance's cache right away; other instances pick
+// it up on their next reload.
+func (s *Server) saveSiteCopy(ctx context.Context, c views.SiteCopy, actor string) error {
+	if err := validateSiteCopy(c); err != nil { return err }
+	if err := s.writable(); err != nil { return err }
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		for _, f := range siteCopyFields {
+			if _, err := tx.ExecContext(ctx, `
+				UPSERT INTO site_settings (key, value, updated_at, updated_by) VALUES ($1, $2, now(), $3)
+			`, f.key, *f.field(&c), actor); err != nil { return err }
+		}
+		return nil
+	})
+	if err != nil { return err }
+	s.siteCopy.Store(&c)
+	return nil
+}
+
+// handleAdminSite is the site copy editor: GET shows the form, POST saves it.
+func (s *Server) handleAdminSite(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.render(w, "admin_site.gohtml", views.AdminSiteView{Copy: s.site()})
+		return
+	}
+	c := views.SiteCopy{
+		Title:   strings.TrimSpace(r.FormValue("title")),
+		Tagline: strings.TrimSpace(r.FormValue("tagline")),
+		Welcome: strings.TrimSpace(r.FormValue("welcome")),
+		Footer:  strings.TrimSpace(r.FormValue("footer")),
+	}
+	actor, _ := s.adminActor(r)
+	err := s.saveSiteCopy(r.Context(), c, actor)
+	switch {
+	case errors.As(err, new(interface{ InvalidSiteCopy() })):
+		s.renderStatus(w, http.StatusBadRequest, "admin_site.gohtml", views.AdminSiteView{Copy: c, Error: err.Error()})
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		http.Error(w, "db error", http.StatusInternalServerError)
+	default:
+		s.log.Info("site copy updated", "by", actor)
+		s.render(w, "admin_site.gohtml", views.AdminSiteView{Copy: c, Saved: true})
+	}
+}
+
+// handleAPIAdminSite reads (GET) or replaces (PUT) the site copy as JSON.
+func (s *Server) handleAPIAdminSite(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		var c views.SiteCopy
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&c); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad json")
+			return
+		}
+		actor, _ := s.adminActor(r)
+		err := s.saveSiteCopy(r.Context(), c, actor)
+		switch {
+		case errors.As(err, new(interface{ InvalidSiteCopy() })):
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+			return
+		case err != nil:
+			writeJSONError(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		s.log.Info("site copy updated", "by", actor)
+	}
+	writeJSON(w, http.StatusOK, s.site())
+}
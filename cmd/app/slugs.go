@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/profile"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// Profile pages: /p/{slug} shows one profile on its own, with the full photo and description,
+// its votes over the last historyDays days and Open Graph tags, so a shared link unfurls into
+// a card. The slug (profiles.slug, migration 036) is the name made URL-friendly and the start
+// of the id (profile.Slug); it follows name edits, and a slug from before one still finds the
+// profile by that id part and redirects. Rows older than the column get theirs from the slugs
+// job; until then their cards don't link anywhere.
+
+const (
+	historyDays  = 30
+	slugInterval = time.Minute
+	slugBatch    = 500
+
+	// shareImageTTL is how long the og:image URL stays valid when photo URLs are signed: long
+	// enough for a social network to fetch it after a share. It moves on once a day, so the
+	// page's tags stay the same in between.
+	shareImageTTL = 7 * 24 * time.Hour
+)
+
+// profilePagePath is p's page: /p/{slug}, or /profiles/{id} while it has no slug yet.
+func profilePagePath(p Profile) string {
+	if p.Slug == "" { return "/profiles/" + url.PathEscape(p.ID) }
+	return "/p/" + url.PathEscape(p.Slug)
+}
+
+// fillSlugs gives a batch of profiles without a slug theirs.
+func (s *Server) fillSlugs(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT id::string, full_name FROM profiles WHERE slug IS NULL LIMIT $1`, slugBatch)
+	if err != nil { return err }
+	var list []Profile
+	for rows.Next() {
+		var p Profile
+		if err := rows.Scan(&p.ID, &p.FullName); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil { return err }
+	for _, p := range list {
+		// Only if still unset: a name edit since then has set it already.
+		_, err := s.db.ExecContext(ctx, `UPDATE profiles SET slug = $2 WHERE id = $1 AND slug IS NULL`, p.ID, profile.Slug(p.FullName, p.ID))
+		if err != nil { return err }
+	}
+	return nil
+}
+
+// handleProfileDetail is a profile's page: GET /p/{slug}. Held profiles are not found, like
+// their other pages; a slug that is not the profile's current one redirects to it.
+func (s *Server) handleProfileDetail(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+	id, current, err := s.store.ProfileBySlug(r.Context(), slug)
+	var status string
+	if err == nil { status, err = s.store.ProfileStatus(r.Context(), id) }
+	if err == nil && status == statusHeld { err = ErrNotFound }
+	if err == nil && current != "" && current != slug {
+		http.Redirect(w, r, "/p/"+url.PathEscape(current), http.StatusMovedPermanently)
+		return
+	}
+	var list []Profile
+	if err == nil { list, err = s.loadProfiles(r.Context(), profileFilter{ID: id, Limit: 1}) }
+	if err == nil && len(list) == 0 { err = ErrNotFound }
+	var ph photo
+	if err == nil { ph, err = s.loadPhoto(r.Context(), id) }
+	history := []Profile{{ID: id}}
+	if err == nil { err = s.loadTrendDays(r.Context(), history, historyDays) }
+	if errors.Is(err, ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	p := list[0]
+	v := views.ProfilePageView{Profile: profileView(p), URL: s.absoluteURL(r, profilePagePath(p)), History: history[0].Trend, Person: s.profileLD(r, p)}
+	if !ph.hidden {
+		image := unsignedPhotoURL(id)
+		if s.cfg.PhotoSigningKey != "" { image = s.embedPhotoURL(id, time.Now().Add(shareImageTTL).Truncate(24*time.Hour)) }
+		v.ImageURL = s.absoluteURL(r, image)
+	}
+	s.render(w, "profile.gohtml", v)
+}
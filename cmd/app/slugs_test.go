@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/doesnotcommit/bestfriends/internal/profile"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+func TestHandleProfileDetail(t *testing.T) {
+	tmpl, err := parseTemplates()
+	if err != nil { t.Fatal(err) }
+	const id, held = "3f2a9c1e-7b4d-4e8a-9c1e-000000000001", "5b1d0e2f-7b4d-4e8a-9c1e-000000000002"
+	mem := store.NewMemory()
+	mem.Put(Profile{ID: id, FullName: "Rex Rover", Country: "Chile", City: "Arica", Slug: profile.Slug("Rex Rover", id)}, "", []byte("photo"), "image/jpeg")
+	mem.Put(Profile{ID: held, FullName: "Kit", Slug: profile.Slug("Kit", held)}, store.StatusHeld, []byte("photo"), "image/jpeg")
+	s := &Server{store: mem, tmpl: tmpl, photoFlight: newFlightGroup[photo]("photo"), profileFlight: newFlightGroup[[]Profile]("profiles"),
+		log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	if err := mem.InsertVote(context.Background(), store.Vote{Profile: id, Counted: true}); err != nil { t.Fatal(err) }
+	get := func(slug string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/p/"+slug, nil)
+		r.SetPathValue("slug", slug)
+		w := httptest.NewRecorder()
+		s.handleProfileDetail(w, r)
+		return w
+	}
+
+	slug := profile.Slug("Rex Rover", id)
+	w := get(slug)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Rex Rover") || !strings.Contains(w.Body.String(), "og:image") {
+		t.Fatalf("GET /p/%s = %d\n%s", slug, w.Code, w.Body)
+	}
+	// A slug from before a rename still finds the profile by its short id, and redirects.
+	if w := get("rex-" + id[:8]); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/p/"+slug {
+		t.Errorf("old slug = %d %s", w.Code, w.Header().Get("Location"))
+	}
+	for _, slug := range []string{profile.Slug("Kit", held), "nobody-00000000"} {
+		if w := get(slug); w.Code != http.StatusNotFound { t.Errorf("GET /p/%s = %d", slug, w.Code) }
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// The exhibit of the day is a profile shown in the home page header for a UTC day. It is
+// chosen by weighted random, each active profile weighing 1/(1+views) where views are its
+// photo requests over the last 30 days (photo_traffic), so rarely seen profiles get their turn
+// more often. Profiles spotlighted in the last 30 days are left out while others remain. The
+// spotlight job makes the choice once per day; the spotlights primary key keeps it to one
+// choice across replicas, and the rows are the history on /spotlights.
+
+const (
+	spotlightInterval    = 5 * time.Minute
+	spotlightViewsWindow = 30 * 24 * time.Hour
+	spotlightRepeatAfter = 30 * 24 * time.Hour
+	spotlightPageSize    = 30
+)
+
+// spotlightCandidate is a profile the spotlight may fall on.
+type spotlightCandidate struct {
+	id     string
+	views  int64
+	recent bool // spotlighted within spotlightRepeatAfter
+}
+
+// pickSpotlight picks from cands by weight 1/(1+views), preferring profiles not spotlighted
+// recently; u is uniform in [0, 1). It returns false when cands is empty.
+func pickSpotlight(cands []spotlightCandidate, u float64) (spotlightCandidate, bool) {
+	pool := make([]spotlightCandidate, 0, len(cands))
+	for _, c := range cands {
+		if !c.recent { pool = append(pool, c) }
+	}
+	if len(pool) == 0 { pool = cands }
+	if len(pool) == 0 { return spotlightCandidate{}, false }
+	var total float64
+	for _, c := range pool { total += 1 / float64(1+max(c.views, 0)) }
+	target := u * total
+	for _, c := range pool {
+		target -= 1 / float64(1+max(c.views, 0))
+		if target < 0 { return c, true }
+	}
+	return pool[len(pool)-1], true
+}
+
+// chooseSpotlight makes today's choice unless one was made, then refreshes the cached
+// spotlight. Replicas racing at midnight insert with ON CONFLICT DO NOTHING, so the first
+// choice stands and everyone loads it.
+func (s *Server) chooseSpotlight(ctx context.Context) error {
+	if !s.settings.GetBool(settingSpotlight) {
+		s.spotlight.Store(nil)
+		return nil
+	}
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM spotlights WHERE day = current_date())`).Scan(&exists); err != nil { return err }
+	if !exists {
+		if err := s.writable(); err != nil { return err }
+		now := time.Now().UTC()
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT p.id::string,
+				COALESCE((SELECT sum(t.requests) FROM photo_traffic t WHERE t.profile_id = p.id AND t.day >= $1::date), 0)::int8,
+				EXISTS (SELECT 1 FROM spotlights sp WHERE sp.profile_id = p.id AND sp.day >= $2::date)
+			FROM profiles p
+			WHERE p.status = 'active' AND NOT p.photo_hidden
+		`, now.Add(-spotlightViewsWindow), now.Add(-spotlightRepeatAfter))
+		if err != nil { return err }
+		var cands []spotlightCandidate
+		for rows.Next() {
+			var c spotlightCandidate
+			if err := rows.Scan(&c.id, &c.views, &c.recent); err != nil {
+				rows.Close()
+				return err
+			}
+			cands = append(cands, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil { return err }
+		if c, ok := pickSpotlight(cands, rand.Float64()); ok {
+			res, err := s.db.ExecContext(ctx, `INSERT INTO spotlights (day, profile_id, views) VALUES (current_date(), $1, $2) ON CONFLICT (day) DO NOTHING`, c.id, c.views)
+			if err != nil { return err }
+			if n, _ := res.RowsAffected(); n > 0 { s.log.Info("spotlight chosen", "profile", c.id, "views", c.views, "candidates", len(cands)) }
+		}
+	}
+	return s.loadSpotlight(ctx)
+}
+
+// loadSpotlight caches today's spotlight for the home page header; none when there is no
+// choice yet or its profile is no longer active.
+func (s *Server) loadSpotlight(ctx context.Context) error {
+	list, err := s.listSpotlights(ctx, time.Now().UTC().AddDate(0, 0, 1), 1)
+	if err != nil { return err }
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if len(list) == 0 || !list[0].Day.Equal(today) || list[0].Profile.Retired {
+		s.spotlight.Store(nil)
+		return nil
+	}
+	v := list[0]
+	s.spotlight.Store(&v)
+	return nil
+}
+
+// todaysSpotlight is the cached spotlight while it is still today's.
+func (s *Server) todaysSpotlight() *views.Spotlight {
+	v := s.spotlight.Load()
+	if v == nil || !v.Day.Equal(time.Now().UTC().Truncate(24*time.Hour)) || !s.settings.GetBool(settingSpotlight) { return nil }
+	return v
+}
+
+// listSpotlights returns up to limit spotlights of days before before, newest first. Profiles
+// held for moderation since are left out.
+func (s *Server) listSpotlights(ctx context.Context, before time.Time, limit int) ([]views.Spotlight, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT sp.day, sp.views, sp.chosen_at, p.id::string, p.full_name, `+profileLocationCols+`, p.votes_count, p.status = 'retired'
+		FROM spotlights sp JOIN profiles p ON p.id = sp.profile_id `+profileLocationJoin+`
+		WHERE sp.day < $1::date AND p.status != $2
+		ORDER BY sp.day DESC
+		LIMIT $3
+	`, before.Format(time.DateOnly), statusHeld, limit)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var list []views.Spotlight
+	for rows.Next() {
+		var v views.Spotlight
+		p := &v.Profile
+		if err := rows.Scan(&v.Day, &v.Views, &v.ChosenAt, &p.ID, &p.FullName, &p.Country, &p.City, &p.Votes, &p.Retired); err != nil { return nil, err }
+		v.Day = v.Day.UTC()
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+// spotlightPage reads ?before=YYYY-MM-DD (default: after today) and returns the page of
+// history before it and the cursor of the next page, zero when this is the last.
+func (s *Server) spotlightPage(r *http.Request, limit int) ([]views.Spotlight, time.Time, error) {
+	before := time.Now().UTC().AddDate(0, 0, 1)
+	if b := r.URL.Query().Get("before"); b != "" {
+		t, err := time.Parse(time.DateOnly, b)
+		if err != nil { return nil, time.Time{}, ErrorInvalidSpotlightCursor("before must be a date like 2006-01-02") }
+		before = t
+	}
+	list, err := s.listSpotlights(r.Context(), before, limit+1)
+	if err != nil { return nil, time.Time{}, err }
+	var next time.Time
+	if len(list) > limit {
+		list = list[:limit]
+		next = list[limit-1].Day
+	}
+	return list, next, nil
+}
+
+type ErrorInvalidSpotlightCursor string
+
+func (e ErrorInvalidSpotlightCursor) Error() string { return string(e) }
+func (ErrorInvalidSpotlightCursor) InvalidSpotlightCursor() {}
+
+// handleSpotlights is the history of exhibits of the day: GET /spotlights?before=2026-10-01
+func (s *Server) handleSpotlights(w http.ResponseWriter, r *http.Request) {
+	list, next, err := s.spotlightPage(r, spotlightPageSize)
+	if errors.As(err, new(interface{ InvalidSpotlightCursor() })) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	v := views.SpotlightsView{Spotlights: list, Paged: r.URL.Query().Has("before")}
+	if !next.IsZero() { v.Next = next.Format(time.DateOnly) }
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	s.render(w, "spotlights.gohtml", v)
+}
+
+// APISpotlight is one day's spotlight in /api/v1/spotlights.
+type APISpotlight struct {
+	Day      string              `json:"day"`
+	Views    int64               `json:"views"` // photo views over the 30 days before the choice
+	ChosenAt time.Time           `json:"chosen_at"`
+	Profile  APISpotlightProfile `json:"profile"`
+}
+
+// APISpotlightProfile is the spotlighted profile in brief; /api/v1/profiles/{id} has the rest.
+type APISpotlightProfile struct {
+	ID       string `json:"id"`
+	FullName string `json:"full_name"`
+	Country  string `json:"country"`
+	City     string `json:"city"`
+	Votes    int    `json:"votes"`
+	Retired  bool   `json:"retired"`
+}
+
+// handleAPISpotlights lists spotlights, newest first: GET /api/v1/spotlights?before=2026-10-01&limit=30
+// next is the before of the following page, absent on the last one.
+func (s *Server) handleAPISpotlights(w http.ResponseWriter, r *http.Request) {
+	list, next, err := s.spotlightPage(r, clampAtoi(r.URL.Query().Get("limit"), 1, 100, spotlightPageSize))
+	if errors.As(err, new(interface{ InvalidSpotlightCursor() })) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "query error")
+		return
+	}
+	out := make([]APISpotlight, 0, len(list))
+	for _, v := range list {
+		p := v.Profile
+		out = append(out, APISpotlight{Day: v.Day.Format(time.DateOnly), Views: v.Views, ChosenAt: v.ChosenAt,
+			Profile: APISpotlightProfile{ID: p.ID, FullName: p.FullName, Country: p.Country, City: p.City, Votes: p.Votes, Retired: p.Retired}})
+	}
+	body := map[string]any{"spotlights": out}
+	if !next.IsZero() { body["next"] = next.Format(time.DateOnly) }
+	writeJSON(w, http.StatusOK, body)
+}
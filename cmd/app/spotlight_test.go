@@ -0,0 +1,28 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPickSpotlightWeights(t *testing.T) {
+	cands := []spotlightCandidate{{id: "seen", views: 99}, {id: "unseen", views: 0}, {id: "recent", views: 0, recent: true}}
+	// Weights 0.01 and 1 (recent is left out while others remain): "unseen" covers u >= 0.01/1.01.
+	counts := map[string]int{}
+	const n = 10000
+	for i := 0; i < n; i++ {
+		c, ok := pickSpotlight(cands, float64(i)/n)
+		if !ok { t.Fatal("no pick") }
+		counts[c.id]++
+	}
+	if counts["recent"] != 0 { t.Errorf("picked a recent spotlight %d times", counts["recent"]) }
+	if got, want := float64(counts["seen"])/n, 0.01/1.01; math.Abs(got-want) > 0.001 {
+		t.Errorf("seen picked %.4f of the time, want %.4f", got, want)
+	}
+}
+
+func TestPickSpotlightFallsBackToRecent(t *testing.T) {
+	c, ok := pickSpotlight([]spotlightCandidate{{id: "a", recent: true}}, 0.5)
+	if !ok || c.id != "a" { t.Errorf("got %+v, %v; want a", c, ok) }
+	if _, ok := pickSpotlight(nil, 0.5); ok { t.Error("picked from no candidates") }
+}
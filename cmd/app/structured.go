@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// profileLD is the schema.org structured data of p's page (see views.ProfileLD). The photo is
+// left out when it is hidden, and when photo URLs are signed: a search engine keeps the URL far
+// longer than one is valid. A failed photo lookup leaves it out too; the page still renders.
+func (s *Server) profileLD(r *http.Request, p Profile) *views.PersonLD {
+	var image *views.ProfileImage
+	if s.cfg.PhotoSigningKey == "" {
+		if ph, err := s.loadPhoto(r.Context(), p.ID); err == nil && !ph.hidden {
+			image = &views.ProfileImage{URL: s.absoluteURL(r, unsignedPhotoURL(p.ID)), ThumbnailURL: s.absoluteURL(r, unsignedPhotoSizeURL(p.ID, sizeThumb))}
+		}
+	}
+	ld := views.ProfileLD(profileView(p), s.absoluteURL(r, profilePagePath(p)), image)
+	return &ld
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+func TestProfileLD(t *testing.T) {
+	mem := store.NewMemory()
+	mem.Put(Profile{ID: "p1"}, "", []byte("photo"), "image/jpeg")
+	mem.Put(Profile{ID: "p2"}, "", []byte("photo"), "image/jpeg")
+	mem.HidePhoto("p2")
+	s := &Server{store: mem, photoFlight: newFlightGroup[photo]("photo"), cfg: Config{PublicURL: "https://lb.example/"}}
+	r := httptest.NewRequest("GET", "/profiles/p1", nil)
+
+	b, _ := json.Marshal(s.profileLD(r, Profile{ID: "p1", FullName: "Rex", Country: "Chile", City: "Arica", Votes: 7}))
+	want := `{"@context":"https://schema.org","@type":"Person","url":"https://lb.example/profiles/p1","name":"Rex",` +
+		`"homeLocation":{"@type":"Place","address":{"@type":"PostalAddress","addressLocality":"Arica","addressCountry":"Chile"}},` +
+		`"image":{"@type":"ImageObject","contentUrl":"https://lb.example/profiles/p1/photo","thumbnailUrl":"https://lb.example/profiles/p1/photo?size=thumb","caption":"Photo of Rex"},` +
+		`"aggregateRating":{"@type":"AggregateRating","ratingValue":5,"bestRating":5,"worstRating":1,"ratingCount":7}}`
+	if string(b) != want { t.Errorf("profileLD =\n%s\nwant\n%s", b, want) }
+
+	if ld := s.profileLD(r, Profile{ID: "p2", FullName: "Bo"}); ld.Image != nil || ld.AggregateRating != nil || ld.HomeLocation != nil {
+		t.Errorf("hidden photo, no votes, no location = %+v", ld)
+	}
+	s.cfg.PhotoSigningKey = "k"
+	if ld := s.profileLD(r, Profile{ID: "p1", FullName: "Rex"}); ld.Image != nil { t.Errorf("signed photo URL in structured data: %+v", ld.Image) }
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemd integration, driven by the variables systemd sets and a no-op without them. With
+// Type=notify the unit learns when the server is ready (READY=1: database reached, schema
+// checked, background jobs started) and when it starts draining (STOPPING=1), with a STATUS=
+// line for systemctl status along the way. WatchdogSec= gets a ping every half interval. A
+// .socket unit can hand over the listening socket (LISTEN_FDS): the port is bound before the
+// server starts, and connections queue in the kernel across restarts instead of being refused.
+
+// sdNotify sends state to the service manager's notification socket; nothing without one.
+// Abstract socket names ("@...") are handled by the net package.
+func sdNotify(state string) error {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" { return nil }
+	c, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil { return err }
+	defer c.Close()
+	_, err = c.Write([]byte(state))
+	return err
+}
+
+// notify is sdNotify for the server's state changes, which only log a failure.
+func (s *Server) notify(state string) {
+	if err := sdNotify(state); err != nil { s.log.Warn("sd_notify failed", "state", state, "err", err) }
+}
+
+// watchdogInterval is how often to ping systemd's watchdog: half of WATCHDOG_USEC, when it is
+// meant for this process. 0 without a watchdog.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 { return 0 }
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) { return 0 }
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// pingWatchdog keeps systemd's watchdog fed until ctx ends. It proves the process is
+// scheduling goroutines, not that the database is up: an outage shows on /readyz, and
+// restarting the service would not fix it.
+func (s *Server) pingWatchdog(ctx context.Context) {
+	every := watchdogInterval()
+	if every <= 0 { return }
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.notify("WATCHDOG=1")
+		}
+	}
+}
+
+// listenFDsStart is the first descriptor systemd passes sockets from (SD_LISTEN_FDS_START).
+const listenFDsStart = 3
+
+// inheritedListener takes the listening socket systemd passed this process, or returns nil
+// without one. With several (more than one Listen line in the .socket unit) the one named
+// "http" (FileDescriptorName=) is served and the others closed.
+func inheritedListener() (net.Listener, error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	n, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if pid != os.Getpid() || n <= 0 { return nil, nil }
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// The sockets are ours now: commands run from here must not think they were passed them.
+	for _, k := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} { os.Unsetenv(k) }
+	pick := 0
+	if n > 1 { pick = slices.Index(names, "http") }
+	var ln net.Listener
+	var err error
+	for i := 0; i < n; i++ {
+		f := os.NewFile(uintptr(listenFDsStart+i), "LISTEN_FD_"+strconv.Itoa(listenFDsStart+i))
+		// FileListener works on a duplicate, so every passed descriptor is closed either way.
+		if i == pick { ln, err = net.FileListener(f) }
+		f.Close()
+	}
+	switch {
+	case pick < 0 || pick >= n:
+		return nil, fmt.Errorf("systemd passed %d sockets and none is named \"http\" (FileDescriptorName=)", n)
+	case err != nil:
+		return nil, fmt.Errorf("inherited socket: %w", err)
+	}
+	return ln, nil
+}
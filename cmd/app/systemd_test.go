@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSDNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil { t.Fatalf("without a socket: %v", err) }
+
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil { t.Skip("no unix datagram sockets:", err) }
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err := sdNotify("READY=1\nSTATUS=serving"); err != nil { t.Fatal(err) }
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1\nSTATUS=serving" { t.Errorf("received %q, %v", buf[:n], err) }
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	for _, c := range []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"30000000", "", 15 * time.Second},
+		{"30000000", strconv.Itoa(os.Getpid()), 15 * time.Second},
+		{"30000000", "1", 0}, // meant for another process
+		{"soon", "", 0},
+	} {
+		t.Setenv("WATCHDOG_USEC", c.usec)
+		t.Setenv("WATCHDOG_PID", c.pid)
+		if got := watchdogInterval(); got != c.want { t.Errorf("WATCHDOG_USEC=%q WATCHDOG_PID=%q: %v, want %v", c.usec, c.pid, got, c.want) }
+	}
+}
+
+func TestInheritedListenerForAnotherProcess(t *testing.T) {
+	// Sockets passed to a parent (LISTEN_PID is its pid) are left alone.
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if ln, err := inheritedListener(); ln != nil || err != nil { t.Fatalf("inheritedListener = %v, %v", ln, err) }
+	if os.Getenv("LISTEN_FDS") != "1" { t.Error("LISTEN_FDS unset for another process") }
+}
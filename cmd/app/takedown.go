@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+	"github.com/lib/pq"
+)
+
+// Takedown requests: anyone may ask for a photo to come down (copyright, privacy, abuse).
+// Filing one hides the photo right away, since waiting for review is the harm; admins are
+// notified and then uphold the request (the photo stays hidden) or reject it (the photo is
+// shown again unless another request for it is still open).
+
+const (
+	takedownOpen     = "open"
+	takedownUpheld   = "upheld"
+	takedownRejected = "rejected"
+
+	// takedownPerVisitorPerDay bounds how many photos one visitor can hide in a day.
+	takedownPerVisitorPerDay = 5
+	takedownMaxDetails       = 2000
+	takedownMaxContact       = 200
+)
+
+var takedownReasons = []string{"copyright", "privacy", "abuse", "other"}
+
+type ErrorInvalidTakedown string
+
+func (e ErrorInvalidTakedown) Error() string { return string(e) }
+func (ErrorInvalidTakedown) InvalidTakedown() {}
+
+const ErrTakedownLimit ErrorRateLimited = "too many takedown requests from your network today"
+
+// uuidPattern finds a profile id in whatever the requester pasted: the id itself, a photo
+// URL or a page link.
+var uuidPattern = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+
+// checkTakedown validates a request from the public form and normalizes its profile id.
+func checkTakedown(f views.TakedownForm) (views.TakedownForm, error) {
+	f.Profile = strings.ToLower(uuidPattern.FindString(f.Profile))
+	f.Details, f.Contact = strings.TrimSpace(f.Details), strings.TrimSpace(f.Contact)
+	switch {
+	case f.Profile == "":
+		return f, ErrorInvalidTakedown("Please give the link to the exhibit or its photo.")
+	case !slices.Contains(takedownReasons, f.Reason):
+		return f, ErrorInvalidTakedown("Please choose a reason.")
+	case f.Details == "" || len([]rune(f.Details)) > takedownMaxDetails:
+		return f, ErrorInvalidTakedown("Please describe the problem in up to 2000 characters.")
+	case len(f.Contact) > takedownMaxContact:
+		return f, ErrorInvalidTakedown("Please give an email address we can reply to.")
+	}
+	if _, err := mail.ParseAddress(f.Contact); err != nil { return f, ErrorInvalidTakedown("Please give an email address we can reply to.") }
+	return f, nil
+}
+
+// fileTakedown records a checked request and hides the profile's photo in one transaction,
+// returning the request id.
+func (s *Server) fileTakedown(ctx context.Context, f views.TakedownForm, visitor visitorIDs) (string, error) {
+	if err := s.writable(); err != nil { return "", err }
+	var id string
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		status, err := s.store.ProfileStatus(store.WithTx(ctx, tx), f.Profile)
+		if err != nil { return err }
+		if status == statusHeld { return ErrNotFound }
+		var n int
+		if err := tx.QueryRowContext(ctx, `
+			SELECT count(*) FROM takedown_requests WHERE visitor = ANY($1) AND created_at > now() - interval '24 hours'
+		`, pq.Array(visitor)).Scan(&n); err != nil { return err }
+		if n >= takedownPerVisitorPerDay { return ErrTakedownLimit }
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO takedown_requests (profile_id, reason, details, contact, visitor) VALUES ($1, $2, $3, $4, $5)
+			RETURNING id::string
+		`, f.Profile, f.Reason, f.Details, f.Contact, visitor.current()).Scan(&id); err != nil { return err }
+		// photo_updated_at is part of the photo ETag, so revalidating clients get the placeholder.
+		_, err = tx.ExecContext(ctx, `UPDATE profiles SET photo_hidden = true, photo_updated_at = now(), updated_at = now() WHERE id = $1`, f.Profile)
+		return err
+	})
+	return id, err
+}
+
+// resolveTakedown closes open request id as upheld or rejected. The photo stays hidden while
+// any request for it is open or upheld.
+func (s *Server) resolveTakedown(ctx context.Context, id, status, note, actor string) error {
+	if status != takedownUpheld && status != takedownRejected { return ErrorInvalidTakedown("status must be upheld or rejected") }
+	if err := s.writable(); err != nil { return err }
+	return withTx(ctx, s.db, func(tx *sql.Tx) error {
+		var profileID string
+		err := tx.QueryRowContext(ctx, `
+			UPDATE takedown_requests SET status = $2, resolution_note = $3, resolved_by = $4, resolved_at = now()
+			WHERE id = $1 AND status = 'open'
+			RETURNING profile_id::string
+		`, id, status, note, actor).Scan(&profileID)
+		if errors.Is(err, sql.ErrNoRows) {
+			var exists bool
+			if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM takedown_requests WHERE id = $1)`, id).Scan(&exists); err != nil { return err }
+			if exists { return ErrorInvalidTakedown("this request was already resolved") }
+			return ErrNotFound
+		}
+		if err != nil { return err }
+		_, err = tx.ExecContext(ctx, `
+			UPDATE profiles SET photo_updated_at = now(), updated_at = now(),
+				photo_hidden = EXISTS (SELECT 1 FROM takedown_requests WHERE profile_id = $1 AND status IN ('open', 'upheld'))
+			WHERE id = $1
+		`, profileID)
+		return err
+	})
+}
+
+// listTakedowns returns up to limit requests with the given status, newest first.
+func (s *Server) listTakedowns(ctx context.Context, status string, limit int) ([]views.Takedown, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.id::string, t.profile_id::string, p.full_name, t.reason, t.details, t.contact, t.status, t.created_at,
+			t.resolved_at, t.resolved_by, t.resolution_note
+		FROM takedown_requests t JOIN profiles p ON p.id = t.profile_id
+		WHERE t.status = $1 ORDER BY t.created_at DESC LIMIT $2`, status, limit)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	list := []views.Takedown{}
+	for rows.Next() {
+		var t views.Takedown
+		var resolved sql.NullTime
+		if err := rows.Scan(&t.ID, &t.ProfileID, &t.FullName, &t.Reason, &t.Details, &t.Contact, &t.Status, &t.CreatedAt,
+			&resolved, &t.ResolvedBy, &t.Note); err != nil { return nil, err }
+		t.ResolvedAt = resolved.Time
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// takedownNotice is posted to LEADERBOARD_ALERT_WEBHOOK_URL when a request comes in.
+type takedownNotice struct {
+	Kind      string    `json:"kind"` // "takedown"
+	ID        string    `json:"id"`
+	ProfileID string    `json:"profile_id"`
+	Reason    string    `json:"reason"`
+	ReviewURL string    `json:"review_url"`
+	At        time.Time `json:"at"`
+}
+
+// notifyTakedown tells admins about a new request: in the log always, through the alert
+// webhook when one is configured. It runs after the response, so a slow webhook doesn't
+// hold up the requester.
+func (s *Server) notifyTakedown(ctx context.Context, id string, f views.TakedownForm) {
+	s.log.Warn("takedown requested; photo hidden pending review", "request", id, "profile", f.Profile, "reason", f.Reason)
+	n := takedownNotice{Kind: "takedown", ID: id, ProfileID: f.Profile, Reason: f.Reason, At: time.Now().UTC(),
+		ReviewURL: strings.TrimRight(s.cfg.PublicURL, "/") + "/admin/takedowns"}
+	if err := s.postWebhook(ctx, n); err != nil { s.log.Error("takedown webhook failed", "request", id, "err", err) }
+}
+
+// handleTakedown serves the public form: GET /takedown?profile={id}, POST /takedown.
+func (s *Server) handleTakedown(w http.ResponseWriter, r *http.Request) {
+	v := views.TakedownView{Reasons: takedownReasons, ReadOnly: s.readOnly.active()}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		v.Form = views.TakedownForm{Profile: r.PostFormValue("profile"), Reason: r.PostFormValue("reason"),
+			Details: r.PostFormValue("details"), Contact: r.PostFormValue("contact")}
+		var err error
+		if !checkCSRF(r) {
+			err = ErrorInvalidTakedown("This form expired. Please send it again.")
+		} else if v.Form, err = checkTakedown(v.Form); err == nil {
+			v.Reference, err = s.fileTakedown(r.Context(), v.Form, s.visitor(r))
+		}
+		switch {
+		case err == nil:
+			go s.notifyTakedown(context.WithoutCancel(r.Context()), v.Reference, v.Form)
+			status = http.StatusAccepted
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+			return
+		case errors.As(err, new(interface{ InvalidTakedown() })):
+			status, v.Error = http.StatusBadRequest, err.Error()
+		case errors.As(err, new(interface{ NotFound() })):
+			status, v.Error = http.StatusBadRequest, "We couldn't find that exhibit. Please check the link."
+		case errors.As(err, new(interface{ RateLimited() })):
+			status, v.Error = http.StatusTooManyRequests, "We've received several requests from your network today. Please try again tomorrow."
+		default:
+			s.log.Error("file takedown", "err", err)
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		v.Form.Profile = strings.ToLower(uuidPattern.FindString(r.URL.Query().Get("profile")))
+	}
+	if v.Form.Profile != "" && v.Reference == "" {
+		// Name the exhibit when the link worked; an unknown id just leaves the field to edit.
+		if list, err := s.loadProfiles(r.Context(), profileFilter{ID: v.Form.Profile, Limit: 1}); err == nil && len(list) > 0 {
+			v.FullName = list[0].FullName
+		}
+	}
+	v.CSRF = s.csrfToken(w, r)
+	w.Header().Set("Cache-Control", "no-store")
+	s.renderStatus(w, status, "takedown.gohtml", v)
+}
+
+// handleAdminTakedowns is the review page. GET lists open and recently resolved requests;
+// POST op=uphold or op=reject (id, note) resolves one.
+func (s *Server) handleAdminTakedowns(w http.ResponseWriter, r *http.Request) {
+	var v views.AdminTakedownsView
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		actor, _ := s.adminActor(r)
+		id := r.FormValue("id")
+		resolution := map[string]string{"uphold": takedownUpheld, "reject": takedownRejected}[r.FormValue("op")]
+		err := s.resolveTakedown(r.Context(), id, resolution, strings.TrimSpace(r.FormValue("note")), actor)
+		switch {
+		case err == nil:
+			s.log.Info("takedown resolved", "request", id, "status", resolution, "by", actor)
+			v.Notice = "Request " + resolution + "."
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+			return
+		case errors.As(err, new(interface{ InvalidTakedown() })):
+			status, v.Error = http.StatusBadRequest, err.Error()
+		case errors.As(err, new(interface{ NotFound() })):
+			status, v.Error = http.StatusNotFound, "Already gone; the page below is current."
+		default:
+			http.Error(w, "db error", http.StatusInternalServerError)
+			return
+		}
+	}
+	var err error
+	if v.Open, err = s.listTakedowns(r.Context(), takedownOpen, 200); err == nil {
+		var upheld, rejected []views.Takedown
+		if upheld, err = s.listTakedowns(r.Context(), takedownUpheld, 25); err == nil {
+			rejected, err = s.listTakedowns(r.Context(), takedownRejected, 25)
+		}
+		v.Resolved = append(upheld, rejected...)
+		slices.SortFunc(v.Resolved, func(a, b views.Takedown) int { return b.ResolvedAt.Compare(a.ResolvedAt) })
+	}
+	if err != nil {
+		http.Error(w, "db error", http.StatusInternalServerError)
+		return
+	}
+	s.renderStatus(w, status, "admin_takedowns.gohtml", v)
+}
+
+// APITakedown is a request in the admin takedown API.
+type APITakedown struct {
+	ID         string     `json:"id"`
+	ProfileID  string     `json:"profile_id"`
+	FullName   string     `json:"full_name"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Contact    string     `json:"contact"`
+	Status     string     `json:"status"` // open, upheld or rejected
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+	Note       string     `json:"note,omitempty"`
+}
+
+// handleAPIAdminTakedowns lists requests: GET /api/v1/admin/takedowns?status=open&limit=
+func (s *Server) handleAPIAdminTakedowns(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" { status = takedownOpen }
+	if status != takedownOpen && status != takedownUpheld && status != takedownRejected {
+		writeJSONError(w, http.StatusBadRequest, "status must be open, upheld or rejected")
+		return
+	}
+	list, err := s.listTakedowns(r.Context(), status, clampAtoi(r.URL.Query().Get("limit"), 1, 1000, 100))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	out := make([]APITakedown, 0, len(list))
+	for _, t := range list {
+		a := APITakedown{ID: t.ID, ProfileID: t.ProfileID, FullName: t.FullName, Reason: t.Reason, Details: t.Details, Contact: t.Contact,
+			Status: t.Status, CreatedAt: t.CreatedAt, ResolvedBy: t.ResolvedBy, Note: t.Note}
+		if !t.ResolvedAt.IsZero() { a.ResolvedAt = &t.ResolvedAt }
+		out = append(out, a)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"takedowns": out})
+}
+
+// handleAPIAdminTakedown resolves a request: PUT /api/v1/admin/takedowns/{id} {"status": "upheld"|"rejected", "note"}
+func (s *Server) handleAPIAdminTakedown(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16*1024)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad json")
+		return
+	}
+	id := pathID(r)
+	actor, _ := s.adminActor(r)
+	err := s.resolveTakedown(r.Context(), id, req.Status, strings.TrimSpace(req.Note), actor)
+	switch {
+	case errors.As(err, new(interface{ InvalidTakedown() })):
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+	case errors.As(err, new(interface{ NotFound() })):
+		writeJSONError(w, http.StatusNotFound, "not found")
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case err != nil:
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+	default:
+		s.log.Info("takedown resolved", "request", id, "status", req.Status, "by", actor)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// hiddenPhotoSVG stands in for a photo hidden by a takedown request.
+const hiddenPhotoSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="240" height="300" viewBox="0 0 240 300" role="img" aria-label="Photo hidden pending review">` +
+	`<rect width="240" height="300" fill="#F5F2EB"/><rect x="8" y="8" width="224" height="284" fill="none" stroke="#C8A96A"/>` +
+	`<text x="120" y="146" text-anchor="middle" font-family="Georgia,serif" font-size="16" fill="#6B6A66">Photo hidden</text>` +
+	`<text x="120" y="168" text-anchor="middle" font-family="Georgia,serif" font-size="13" fill="#6B6A66">pending review</text></svg>`
+
+// writeHiddenPhoto serves the placeholder. It is revalidated on every use so the photo comes
+// back as soon as a request is rejected.
+func writeHiddenPhoto(w http.ResponseWriter, r *http.Request, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "image/svg+xml")
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead { _, _ = w.Write([]byte(hiddenPhotoSVG)) }
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+func TestCheckTakedown(t *testing.T) {
+	valid := views.TakedownForm{Profile: "https://example.com/profiles/8B1B6E3C-0000-4000-8000-000000000001/photo?exp=1",
+		Reason: "privacy", Details: "  That's me, I never agreed.  ", Contact: "Ada <ada@example.com>"}
+	got, err := checkTakedown(valid)
+	if err != nil {
+		t.Fatalf("valid request rejected: %v", err)
+	}
+	if got.Profile != "8b1b6e3c-0000-4000-8000-000000000001" || got.Details != "That's me, I never agreed." {
+		t.Fatalf("checkTakedown normalised to %+v", got)
+	}
+
+	for name, mod := range map[string]func(*views.TakedownForm){
+		"no profile":     func(f *views.TakedownForm) { f.Profile = "https://example.com/" },
+		"unknown reason": func(f *views.TakedownForm) { f.Reason = "spite" },
+		"no details":     func(f *views.TakedownForm) { f.Details = "   " },
+		"long details":   func(f *views.TakedownForm) { f.Details = strings.Repeat("é", takedownMaxDetails+1) },
+		"no contact":     func(f *views.TakedownForm) { f.Contact = "" },
+		"not an email":   func(f *views.TakedownForm) { f.Contact = "call me" },
+		"long contact":   func(f *views.TakedownForm) { f.Contact = strings.Repeat("a", takedownMaxContact) + "@example.com" },
+	} {
+		f := valid
+		mod(&f)
+		if _, err := checkTakedown(f); !errors.As(err, new(interface{ InvalidTakedown() })) {
+			t.Errorf("%s: err = %v, want invalid", name, err)
+		}
+	}
+}
+
+func TestWriteHiddenPhoto(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeHiddenPhoto(rec, httptest.NewRequest("GET", "/profiles/x/photo", nil), `"x-1-hidden"`)
+	if rec.Code != 200 || rec.Header().Get("Content-Type") != "image/svg+xml" || rec.Header().Get("Cache-Control") != "no-cache" ||
+		!strings.HasPrefix(rec.Body.String(), "<svg") {
+		t.Fatalf("placeholder = %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+	r := httptest.NewRequest("GET", "/profiles/x/photo", nil)
+	r.Header.Set("If-None-Match", `"x-1-hidden"`)
+	rec = httptest.NewRecorder()
+	writeHiddenPhoto(rec, r, `"x-1-hidden"`)
+	if rec.Code != 304 || rec.Body.Len() != 0 {
+		t.Fatalf("revalidation = %d with %d bytes, want 304", rec.Code, rec.Body.Len())
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// translator is a machine translation provider. Languages are lowercase ISO 639-1 codes.
+type translator interface {
+	translate(ctx context.Context, text, target string) (translation, error)
+}
+
+// translation is a provider's answer: the text in the target language and the language it
+// detected in the source.
+type translation struct {
+	Text   string
+	Source string
+}
+
+const translateTimeout = 10 * time.Second
+
+// newTranslator picks the provider named by LEADERBOARD_TRANSLATE_PROVIDER; nil disables
+// translation.
+func newTranslator(cfg Config) (translator, error) {
+	client := &http.Client{Timeout: translateTimeout}
+	switch cfg.TranslateProvider {
+	case "":
+		return nil, nil
+	case "libretranslate":
+		if cfg.TranslateURL == "" { return nil, errors.New("LEADERBOARD_TRANSLATE_URL is required for libretranslate") }
+		return libreTranslate{url: strings.TrimRight(cfg.TranslateURL, "/"), apiKey: cfg.TranslateAPIKey, client: client}, nil
+	case "deepl":
+		if cfg.TranslateAPIKey == "" { return nil, errors.New("LEADERBOARD_TRANSLATE_API_KEY is required for deepl") }
+		url := cfg.TranslateURL
+		if url == "" { url = "https://api-free.deepl.com" }
+		return deepL{url: strings.TrimRight(url, "/"), apiKey: cfg.TranslateAPIKey, client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown translation provider %q", cfg.TranslateProvider)
+}
+
+// libreTranslate talks to a LibreTranslate server (POST /translate).
+type libreTranslate struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func (t libreTranslate) translate(ctx context.Context, text, target string) (translation, error) {
+	req := map[string]string{"q": text, "source": "auto", "target": target, "format": "text"}
+	if t.apiKey != "" { req["api_key"] = t.apiKey }
+	var resp struct {
+		TranslatedText   string `json:"translatedText"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err := postJSON(ctx, t.client, t.url+"/translate", nil, req, &resp); err != nil { return translation{}, err }
+	return translation{Text: resp.TranslatedText, Source: strings.ToLower(resp.DetectedLanguage.Language)}, nil
+}
+
+// deepL talks to the DeepL API (POST /v2/translate).
+type deepL struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func (t deepL) translate(ctx context.Context, text, target string) (translation, error) {
+	req := map[string]any{"text": []string{text}, "target_lang": strings.ToUpper(target)}
+	var resp struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	header := http.Header{"Authorization": {"DeepL-Auth-Key " + t.apiKey}}
+	if err := postJSON(ctx, t.client, t.url+"/v2/translate", header, req, &resp); err != nil { return translation{}, err }
+	if len(resp.Translations) == 0 { return translation{}, errors.New("deepl: empty response") }
+	tr := resp.Translations[0]
+	return translation{Text: tr.Text, Source: strings.ToLower(tr.DetectedSourceLanguage)}, nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body, out any) error {
+	b, err := json.Marshal(body)
+	if err != nil { return err }
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil { return err }
+	for k, v := range header { req.Header[k] = v }
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { return fmt.Errorf("translate: %s", resp.Status) }
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// viewerLanguage returns the primary language the client prefers most, from Accept-Language,
+// or "" when there is none.
+func viewerLanguage(header string) string {
+	type pref struct {
+		lang string
+		q    float64
+	}
+	var prefs []pref
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil { q = f }
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if len(lang) < 2 || len(lang) > 3 || q <= 0 { continue }
+		prefs = append(prefs, pref{lang, q})
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	if len(prefs) == 0 { return "" }
+	return prefs[0].lang
+}
+
+// translateTarget is the language descriptions are offered in for r's viewer; "" when
+// translation is off.
+func (s *Server) translateTarget(r *http.Request) string {
+	if s.translator == nil { return "" }
+	return viewerLanguage(r.Header.Get("Accept-Language"))
+}
+
+// loadDescriptionLangs fills DescriptionLang from earlier translations, where known.
+func (s *Server) loadDescriptionLangs(ctx context.Context, list []Profile) error {
+	if s.translator == nil || len(list) == 0 { return nil }
+	ids := make([]string, len(list))
+	idx := make(map[string]int, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+		idx[list[i].ID] = i
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (profile_id) profile_id::string, source_lang
+		FROM description_translations WHERE profile_id = ANY($1::uuid[])
+		ORDER BY profile_id, created_at DESC
+	`, pq.Array(ids))
+	if err != nil { return err }
+	defer rows.Close()
+	for rows.Next() {
+		var id, lang string
+		if err := rows.Scan(&id, &lang); err != nil { return err }
+		if i, ok := idx[id]; ok { list[i].DescriptionLang = lang }
+	}
+	return rows.Err()
+}
+
+// translateDescription returns profile id's description in target, from the cache when the
+// description hasn't changed since it was translated.
+func (s *Server) translateDescription(ctx context.Context, id, target string) (views.DescriptionView, error) {
+	v := views.DescriptionView{ProfileID: id, Target: target}
+	err := s.db.QueryRowContext(ctx, `SELECT description FROM profiles WHERE id = $1`, id).Scan(&v.Original)
+	if err == sql.ErrNoRows { return v, ErrNotFound }
+	if err != nil { return v, err }
+	v.Text = v.Original
+	if v.Original == "" { return v, nil }
+	sum := sha256.Sum256([]byte(v.Original))
+	tr, err := s.translateFlight.do(ctx, id+"|"+target, func(ctx context.Context) (translation, error) {
+		var tr translation
+		err := s.db.QueryRowContext(ctx, `
+			SELECT text, source_lang FROM description_translations WHERE profile_id = $1 AND target = $2 AND source_hash = $3
+		`, id, target, sum[:]).Scan(&tr.Text, &tr.Source)
+		if err != sql.ErrNoRows { return tr, err }
+		if tr, err = s.translator.translate(ctx, v.Original, target); err != nil { return tr, err }
+		if tr.Source == target { tr.Text = v.Original }
+		if s.writable() != nil { return tr, nil } // serve it, cache it once writable again
+		_, err = s.db.ExecContext(ctx, `
+			UPSERT INTO description_translations (profile_id, target, source_hash, source_lang, text, created_at)
+			VALUES ($1, $2, $3, $4, $5, now())
+		`, id, target, sum[:], tr.Source, tr.Text)
+		if err != nil { s.log.Warn("cache translation", "profile", id, "to", target, "err", err) }
+		return tr, nil
+	})
+	if err != nil { return v, err }
+	v.Source = tr.Source
+	v.Translated = tr.Source != target
+	if v.Translated { v.Text = tr.Text }
+	return v, nil
+}
+
+// handleDescriptionFragment renders a card's description translated into ?to=:
+// GET /fragments/profile/{id}/description?to=de. It replaces the card's description element.
+func (s *Server) handleDescriptionFragment(w http.ResponseWriter, r *http.Request) {
+	target := viewerLanguage(r.URL.Query().Get("to"))
+	if s.translator == nil || target == "" {
+		http.NotFound(w, r)
+		return
+	}
+	v, err := s.translateDescription(r.Context(), pathID(r), target)
+	if errors.As(err, new(interface{ NotFound() })) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		s.log.Warn("translate description", "profile", v.ProfileID, "to", target, "err", err)
+		v.Error = "Translation is unavailable right now."
+		w.Header().Set("Cache-Control", "no-store")
+	} else {
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+	}
+	s.render(w, "description", v)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestViewerLanguage(t *testing.T) {
+	tests := []struct{ header, want string }{
+		{"", ""},
+		{"de-CH", "de"},
+		{"fr;q=0.8, en-US, *;q=0.1", "en"},
+		{"en;q=0.5, pt-BR;q=0.9", "pt"},
+		{"*", ""},
+		{"es;q=0", ""},
+	}
+	for _, tt := range tests {
+		if got := viewerLanguage(tt.header); got != tt.want {
+			t.Errorf("viewerLanguage(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestLibreTranslate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/translate" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req["target"] != "de" || req["q"] != "hello" || req["api_key"] != "k" {
+			t.Errorf("request = %v", req)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"translatedText": "hallo", "detectedLanguage": map[string]any{"language": "EN"}})
+	}))
+	defer srv.Close()
+	tr, err := newTranslator(Config{TranslateProvider: "libretranslate", TranslateURL: srv.URL + "/", TranslateAPIKey: "k"})
+	if err != nil { t.Fatal(err) }
+	got, err := tr.translate(context.Background(), "hello", "de")
+	if err != nil { t.Fatal(err) }
+	if got != (translation{Text: "hallo", Source: "en"}) {
+		t.Fatalf("got %+v", got)
+	}
+}
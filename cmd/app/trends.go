@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// trendDays is how many days of votes the card sparklines show, today included.
+const trendDays = 7
+
+// loadTrends fills Trend for each profile with its votes per UTC day over the last trendDays
+// days, oldest first, in one grouped query.
+func (s *Server) loadTrends(ctx context.Context, list []Profile) error {
+	return s.loadTrendDays(ctx, list, trendDays)
+}
+
+// loadTrendDays is loadTrends over any number of days.
+func (s *Server) loadTrendDays(ctx context.Context, list []Profile, days int) error {
+	if len(list) == 0 { return nil }
+	ids := make([]string, len(list))
+	idx := make(map[string]int, len(list))
+	for i := range list {
+		ids[i] = list[i].ID
+		idx[list[i].ID] = i
+		list[i].Trend = make([]int, days)
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(days - 1))
+	counts, err := s.store.VotesPerDay(ctx, ids, since)
+	if err != nil { return err }
+	for _, c := range counts {
+		i, ok := idx[c.Profile]
+		slot := int(c.Day.Sub(since) / (24 * time.Hour))
+		if ok && slot >= 0 && slot < days { list[i].Trend[slot] += c.Votes }
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// The profile form is multipart: a few short text fields and one photo. The whole body is
+// capped, not just the photo, so a client can't stream an unbounded form (many parts, a
+// huge text field, a boundary that never closes) into memory or temp files before the
+// photo is even looked at.
+
+// maxFormBytes bounds a profile form body: the largest photo plus room for the text fields
+// and multipart framing.
+const maxFormBytes = maxUploadAcceptBytes + 64<<10
+
+type ErrorBadUpload string
+
+func (e ErrorBadUpload) Error() string { return string(e) }
+func (ErrorBadUpload) BadUpload()      {}
+
+const (
+	ErrBadForm       ErrorBadUpload = "bad form"
+	ErrFormTooLarge  ErrorBadUpload = "form too large"
+	ErrPhotoRequired ErrorBadUpload = "photo required"
+	ErrPhotoTooLarge ErrorBadUpload = "file too large"
+	ErrPhotoRead     ErrorBadUpload = "read error"
+)
+
+// parseUploadForm parses the multipart profile form into r.MultipartForm, capping the body at
+// maxFormBytes. The server removes any temp files it spilled to once the handler returns.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+	if err := r.ParseMultipartForm(maxUploadAcceptBytes); err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) { return ErrFormTooLarge }
+		return ErrBadForm
+	}
+	return nil
+}
+
+// readPhoto returns the bytes of the form's photo part and its header, after parseUploadForm.
+func readPhoto(r *http.Request) ([]byte, *multipart.FileHeader, error) {
+	file, header, err := r.FormFile("photo")
+	if err != nil { return nil, nil, ErrPhotoRequired }
+	defer file.Close()
+	if header.Size > maxUploadAcceptBytes { return nil, nil, ErrPhotoTooLarge }
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, file, maxUploadAcceptBytes+1); err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, ErrPhotoRead
+	}
+	if buf.Len() > maxUploadAcceptBytes { return nil, nil, ErrPhotoTooLarge }
+	return buf.Bytes(), header, nil
+}
+
+// writeBadUpload answers an ErrorBadUpload: 413 for an oversized form, 400 otherwise.
+func writeBadUpload(w http.ResponseWriter, err error) {
+	code := http.StatusBadRequest
+	if err == ErrFormTooLarge { code = http.StatusRequestEntityTooLarge }
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// profileForm builds a multipart profile form with the given boundary and photo.
+func profileForm(t testing.TB, boundary string, photo []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	if err := mw.SetBoundary(boundary); err != nil { t.Fatal(err) }
+	for k, v := range map[string]string{"full_name": "Ada", "country": "UK", "city": "London"} { mw.WriteField(k, v) }
+	fw, err := mw.CreateFormFile("photo", "a.png")
+	if err != nil { t.Fatal(err) }
+	fw.Write(photo)
+	mw.Close()
+	return b.Bytes()
+}
+
+func uploadRequest(boundary string, body []byte) *http.Request {
+	r := httptest.NewRequest("POST", "/profiles", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	return r
+}
+
+func TestParseUploadForm(t *testing.T) {
+	photo := []byte("\x89PNG\r\n\x1a\n....")
+	r := uploadRequest("b0und", profileForm(t, "b0und", photo))
+	if err := parseUploadForm(httptest.NewRecorder(), r); err != nil { t.Fatal(err) }
+	got, h, err := readPhoto(r)
+	if err != nil || !bytes.Equal(got, photo) || h.Filename != "a.png" { t.Fatalf("readPhoto = %q, %v, %v", got, h, err) }
+
+	big := uploadRequest("b0und", profileForm(t, "b0und", bytes.Repeat([]byte{1}, maxFormBytes)))
+	if err := parseUploadForm(httptest.NewRecorder(), big); err != ErrFormTooLarge { t.Errorf("oversized form: %v", err) }
+	w := httptest.NewRecorder()
+	writeBadUpload(w, ErrFormTooLarge)
+	if w.Code != http.StatusRequestEntityTooLarge { t.Errorf("status = %d", w.Code) }
+
+	tooBig := uploadRequest("b0und", profileForm(t, "b0und", bytes.Repeat([]byte{1}, maxUploadAcceptBytes+1)))
+	if err := parseUploadForm(httptest.NewRecorder(), tooBig); err != nil { t.Fatal(err) }
+	if _, _, err := readPhoto(tooBig); err != ErrPhotoTooLarge { t.Errorf("oversized photo: %v", err) }
+
+	noPhoto := uploadRequest("b0und", []byte("--b0und\r\nContent-Disposition: form-data; name=\"city\"\r\n\r\nLondon\r\n--b0und--\r\n"))
+	if err := parseUploadForm(httptest.NewRecorder(), noPhoto); err != nil { t.Fatal(err) }
+	if _, _, err := readPhoto(noPhoto); err != ErrPhotoRequired { t.Errorf("no photo: %v", err) }
+}
+
+// FuzzUploadForm feeds malformed multipart bodies and boundaries through the profile form
+// parsing: it must fail with an ErrorBadUpload, never panic or hand back an oversized photo.
+//
+//	go test ./cmd/app -run '^$' -fuzz FuzzUploadForm -fuzztime 1m
+func FuzzUploadForm(f *testing.F) {
+	valid := profileForm(f, "b0und", []byte("\x89PNG\r\n\x1a\n...."))
+	f.Add("b0und", valid)
+	f.Add("b0und", valid[:len(valid)/2])                            // truncated mid-part
+	f.Add("b0und", bytes.TrimSuffix(valid, []byte("--b0und--\r\n"))) // no closing boundary
+	f.Add("other", valid)                                           // boundary mismatch
+	f.Add(`"quoted boundary"`, valid)
+	f.Add(strings.Repeat("x", 80), valid) // longer than RFC 2046 allows
+	f.Add("b0und", []byte("--b0und\r\nContent-Disposition: form-data; name=\"photo\"; filename=\"a.png\"\r\n\r\n"))
+	f.Add("b0und", []byte("--b0und\r\nContent-Disposition: form-data; name=\"photo\"; filename*=UTF-8''%ZZ\r\n\r\nx\r\n--b0und--\r\n"))
+	f.Fuzz(func(t *testing.T, boundary string, body []byte) {
+		r := uploadRequest(boundary, body)
+		err := parseUploadForm(httptest.NewRecorder(), r)
+		if err == nil {
+			var photo []byte
+			photo, _, err = readPhoto(r)
+			if err == nil && len(photo) > maxUploadAcceptBytes { t.Fatalf("photo of %d bytes", len(photo)) }
+		}
+		if err == nil { return }
+		if !errors.As(err, new(interface{ BadUpload() })) { t.Fatalf("untyped error %v", err) }
+	})
+}
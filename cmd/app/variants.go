@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+)
+
+// Photo variants: the leaderboard grid and the small avatars elsewhere don't need the full
+// MaxWidth photo. Each photo also gets smaller renditions (photo_variants, migration 034),
+// served by /profiles/{id}/photo?size=thumb|card; size=full, or none, is the stored photo.
+// Uploads make theirs before their transaction; the photo_variants job fills in the rest
+// (older photos, seeded and reprocessed ones). Until a photo has them its smaller sizes are
+// the full photo, cached briefly so browsers come back for the real thing.
+
+const (
+	sizeThumb = "thumb"
+	sizeCard  = "card"
+	sizeFull  = "full"
+
+	variantInterval = time.Minute
+	variantBatch    = 50 // resizing is the slow part, not the queries
+
+	// variantPendingMaxAge bounds caching of the full photo served for a size not made yet.
+	variantPendingMaxAge = 5 * 60
+)
+
+// photoVariants are the widths of the smaller sizes.
+var photoVariants = []struct {
+	size  string
+	width int
+}{{sizeThumb, 160}, {sizeCard, 480}}
+
+// photoSize parses the size query parameter of a photo URL; "" is sizeFull.
+func photoSize(q string) (string, bool) {
+	switch q {
+	case "", sizeFull:
+		return sizeFull, true
+	case sizeThumb, sizeCard:
+		return q, true
+	}
+	return "", false
+}
+
+// variant is one smaller rendition of a photo.
+type variant struct {
+	size        string
+	data        []byte
+	contentType string
+}
+
+// makeVariants resizes photo, a processed one, to each of the smaller sizes. A size it
+// cannot be resized to gets empty data, so the job does not retry it forever; it is served
+// as the full photo.
+func makeVariants(photo []byte) []variant {
+	out := make([]variant, len(photoVariants))
+	for i, pv := range photoVariants {
+		out[i].size = pv.size
+		data, contentType, err := imaging.Process(photo, pv.width, imaging.MaxBytes)
+		if err == nil { out[i].data, out[i].contentType = data, contentType }
+	}
+	return out
+}
+
+// storeVariants records the smaller renditions of a profile's stored photo.
+func storeVariants(ctx context.Context, db interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+}, profileID string, variants []variant) error {
+	for _, v := range variants {
+		_, err := db.ExecContext(ctx, `
+			UPSERT INTO photo_variants (profile_id, size, data, content_type) VALUES ($1, $2, $3, $4)
+		`, profileID, v.size, v.data, v.contentType)
+		if err != nil { return err }
+	}
+	return nil
+}
+
+// fillVariants makes the smaller renditions of photos missing one, a batch per run.
+func (s *Server) fillVariants(ctx context.Context) error {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id::string FROM profiles p
+		WHERE (SELECT count(*) FROM photo_variants v WHERE v.profile_id = p.id) < $1 LIMIT $2
+	`, len(photoVariants), variantBatch)
+	if err != nil { return err }
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil { return err }
+	for _, id := range ids {
+		photo, err := s.store.ReadPhoto(ctx, id)
+		if errors.Is(err, ErrNotFound) { continue } // deleted since
+		if err != nil { return err }
+		if err := storeVariants(ctx, s.db, id, makeVariants(photo)); err != nil { return err }
+	}
+	return nil
+}
+
+// photoSizeURL is photoURL for one size of the photo.
+func (s *Server) photoSizeURL(id, size string) string {
+	return withPhotoSize(s.photoURL(id), size)
+}
+
+func unsignedPhotoSizeURL(id, size string) string {
+	return withPhotoSize(unsignedPhotoURL(id), size)
+}
+
+// withPhotoSize adds size to photo URL u. The signature doesn't cover it: every size is the
+// same photo.
+func withPhotoSize(u, size string) string {
+	if size == "" || size == sizeFull { return u }
+	sep := "?"
+	if strings.Contains(u, "?") { sep = "&" }
+	return u + sep + "size=" + size
+}
+
+// writePhotoVariant answers a photo request with a smaller rendition, small enough to write
+// in one piece.
+func (s *Server) writePhotoVariant(w http.ResponseWriter, r *http.Request, id, etag, cacheControl string, data []byte, contentType string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-Type", contentType)
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		s.photoTraffic.add(id, photoHit{requests: 1, notModified: 1})
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead { return }
+	n, err := newDeadlineWriter(w, s.cfg.PhotoWriteTimeout).Write(data)
+	s.photoTraffic.add(id, photoHit{requests: 1, bytes: int64(n)})
+	if err != nil { s.log.Warn("write photo variant", "profile", id, "err", err) }
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+func TestMakeVariants(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, imaging.MaxWidth, 768))
+	for i := range img.Pix { img.Pix[i] = uint8(i) }
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil { t.Fatal(err) }
+	got := makeVariants(buf.Bytes())
+	if len(got) != len(photoVariants) { t.Fatalf("%d variants, want %d", len(got), len(photoVariants)) }
+	for i, v := range got {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(v.data))
+		if err != nil { t.Fatalf("%s: %v", v.size, err) }
+		if want := photoVariants[i].width; v.size != photoVariants[i].size || cfg.Width != want || cfg.Height != want*3/4 || v.contentType != imaging.ContentType {
+			t.Errorf("%s: %dx%d %s, want %d wide", v.size, cfg.Width, cfg.Height, v.contentType, want)
+		}
+	}
+	for _, v := range makeVariants([]byte("not a photo")) {
+		if v.data != nil { t.Errorf("%s of a broken photo = %d bytes, want none", v.size, len(v.data)) }
+	}
+}
+
+func TestHandlePhotoSizes(t *testing.T) {
+	mem := store.NewMemory()
+	full := []byte("full photo")
+	mem.Put(Profile{ID: "p1"}, "", full, "image/jpeg")
+	mem.PutVariant("p1", sizeThumb, []byte("thumb"), "image/jpeg")
+	mem.Put(Profile{ID: "p2"}, "", []byte("gone"), "image/jpeg")
+	mem.PutVariant("p2", sizeThumb, []byte("thumb"), "image/jpeg")
+	mem.HidePhoto("p2")
+	s := &Server{store: mem, photoFlight: newFlightGroup[photo]("photo"), log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	get := func(id, query, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/profiles/"+id+"/photo"+query, nil)
+		r.SetPathValue("id", id)
+		if etag != "" { r.Header.Set("If-None-Match", etag) }
+		w := httptest.NewRecorder()
+		s.handlePhoto(w, r)
+		return w
+	}
+
+	w := get("p1", "?size=thumb", "")
+	if w.Code != http.StatusOK || w.Body.String() != "thumb" || w.Header().Get("Cache-Control") != "public, max-age=2592000" {
+		t.Fatalf("thumb = %d %q, %q", w.Code, w.Body, w.Header().Get("Cache-Control"))
+	}
+	thumbTag := w.Header().Get("ETag")
+	if w := get("p1", "?size=thumb", thumbTag); w.Code != http.StatusNotModified { t.Errorf("thumb revalidation = %d", w.Code) }
+	if w := get("p1", "?size=full", ""); w.Body.String() != string(full) || w.Header().Get("ETag") == thumbTag { t.Errorf("full = %q, ETag %s", w.Body, w.Header().Get("ETag")) }
+	// No card yet: the full photo stands in, cached briefly.
+	w = get("p1", "?size=card", "")
+	if w.Code != http.StatusOK || w.Body.String() != string(full) || !strings.HasSuffix(w.Header().Get("Cache-Control"), "max-age=300") {
+		t.Errorf("missing card = %d %q, %q", w.Code, w.Body, w.Header().Get("Cache-Control"))
+	}
+	if w := get("p2", "?size=thumb", ""); w.Header().Get("Content-Type") != "image/svg+xml" { t.Errorf("hidden thumb = %q", w.Header().Get("Content-Type")) }
+	if w := get("p1", "?size=huge", ""); w.Code != http.StatusBadRequest { t.Errorf("unknown size = %d", w.Code) }
+}
+
+func TestPhotoSizeURL(t *testing.T) {
+	if got := unsignedPhotoSizeURL("abc", sizeCard); got != "/profiles/abc/photo?size=card" { t.Errorf("unsigned = %s", got) }
+	if got := unsignedPhotoSizeURL("abc", sizeFull); got != "/profiles/abc/photo" { t.Errorf("full = %s", got) }
+	s := &Server{cfg: Config{PhotoSigningKey: "k", PhotoURLTTL: time.Hour}}
+	u, err := url.Parse(s.photoSizeURL("abc", sizeThumb))
+	if err != nil { t.Fatal(err) }
+	if u.Query().Get("size") != sizeThumb { t.Errorf("signed URL %s lost its size", u) }
+	if _, ok := s.checkPhotoSig("abc", u.Query()); !ok { t.Errorf("signed URL %s rejected", u) }
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// TestTemplatesRenderViews executes every template with its view model, populated so that
+// conditional sections run too; a template naming a field its view lacks fails here.
+func TestTemplatesRenderViews(t *testing.T) {
+	tmpl, err := parseTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tests := []struct {
+		name string
+		data any
+	}{
+		{"home_head", views.HomeHead{Query: "q", Country: "Chile", ReadOnly: true, HTMXURL: "/htmx.js"}},
+		{"home_card", &views.ProfileView{ID: "id", FullName: "Name", Country: "Chile", City: "Santiago", Description: "d",
+			Votes: 3, CreatedAt: now, RateLimited: true, Champion: true, Pinned: true, Trend: []int{0, 1, 0, 0, 2, 0, 0}, TranslateTo: "de"}},
+		{"home_head", views.HomeHead{Country: "Chile", Alumni: true}},
+		{"home_head", views.HomeHead{Single: true}},
+		{"home_head", views.HomeHead{Spotlight: &views.Spotlight{Day: now, Profile: views.ProfileView{ID: "p", FullName: "n"}}}},
+		{"spotlights.gohtml", views.SpotlightsView{Spotlights: []views.Spotlight{{Day: now}}, Next: "2026-01-01"}},
+		{"kiosk.gohtml", views.KioskView{Label: "l", Profile: &views.ProfileView{ID: "id", FullName: "n", VoteToken: "t"}, Next: "/kiosk?n=1", Advance: 3,
+			Flash: &views.Flash{Message: "m", Error: true}, ReadOnly: true}},
+		{"kiosk.gohtml", views.KioskView{Error: "e"}},
+		{"vote_receipt.gohtml", views.VoteReceiptView{Rank: 1, Total: 1, Shares: shareLinks("t", "https://x/p")}},
+		{"profile.gohtml", views.ProfilePageView{Profile: views.ProfileView{ID: "id", FullName: "Name", Description: "d", Champion: true, Slug: "name-1"},
+			URL: "https://x/p/name-1", ImageURL: "https://x/profiles/id/photo", History: []int{0, 1}, Person: &views.PersonLD{Name: "Name"}}},
+		{"profile.gohtml", views.ProfilePageView{Profile: views.ProfileView{ID: "id", Retired: true, FinalRank: 2}}},
+		{"home_card", &views.ProfileView{ID: "id", FullName: "Name", Country: "Chile", City: "Santiago", CreatedAt: now,
+			Retired: true, FinalRank: 4, FinalChampion: "Chile"}},
+		{"description", views.DescriptionView{ProfileID: "id", Text: "t", Original: "o", Source: "en", Target: "de", Translated: true}},
+		{"description", views.DescriptionView{ProfileID: "id", Text: "o", Error: "unavailable"}},
+		{"home_tail", views.HomeTail{Count: 1, MinVotes: 0, MaxVotes: 3}},
+		{"leaderboard_tail", views.HomeTail{}},
+		{"load_more", views.HomeTail{More: &views.PageLinks{Page: "/?after=start", Fragment: "/fragments/leaderboard?after=start"}}},
+		{"home_cloud", nil},
+		{"home_foot", nil},
+		{"section_open", views.HomeSection{ID: "s-1", Kind: "top", Title: "Top 10", MinVotes: 1, MaxVotes: 9}},
+		{"section_close", nil},
+		{"home_tail", views.HomeTail{Alumni: true}},
+		{"add.gohtml", views.AddView{ReadOnly: true}},
+		{"quota.gohtml", views.QuotaView{Limit: 10, ResetsAt: now}},
+		{"search_timeout.gohtml", views.SearchTimeoutView{Query: "x", Country: "y"}},
+		{"search_timeout.gohtml", views.SearchTimeoutView{}},
+		{"admin_reset.gohtml", views.AdminResetView{Form: views.AdminResetForm{From: now, To: now}, Error: "bad",
+			Result: &views.AdminResetResult{ID: "r", From: now, To: now, Votes: 2, Profiles: 1}}},
+		{"admin_reset.gohtml", views.AdminResetView{Result: &views.AdminResetResult{Applied: true}}},
+		{"vote_link.gohtml", views.VoteLinkView{Token: "t", FullName: "Name", Country: "Chile", City: "Santiago", Expires: now, State: "confirm"}},
+		{"vote_link.gohtml", views.VoteLinkView{State: "error", Message: "expired"}},
+		{"vote_confirm.gohtml", views.VoteConfirmView{Profile: views.ProfileView{ID: "id", FullName: "Name", Votes: 1, Description: "d"},
+			CSRF: "c", Flash: &views.Flash{Message: "m", Error: true}, ReadOnly: true}},
+		{"vote_confirm.gohtml", views.VoteConfirmView{Profile: views.ProfileView{ID: "id", RateLimited: true}}},
+		{"vote_confirm.gohtml", views.VoteConfirmView{Profile: views.ProfileView{ID: "id", Retired: true}}},
+		{"add.gohtml", views.AddView{Held: true}},
+		{"add.gohtml", views.AddView{Captcha: &views.Captcha{SiteKey: "k", Script: "https://captcha.example/api.js", Class: "cf-turnstile"}}},
+		{"vote_confirm.gohtml", views.VoteConfirmView{Profile: views.ProfileView{ID: "id"}, Captcha: &views.Captcha{SiteKey: "k"}}},
+		{"add.gohtml", views.AddView{Warnings: []views.PhotoWarning{{Code: "dark", Message: "m"}},
+			Form: views.AddForm{FullName: "Name", Country: "Chile", City: "Santiago", Description: "d"}}},
+		{"moderation_digest.gohtml", views.ModerationDigestView{Pending: 1, Profiles: []views.DigestProfile{{Profile: views.ProfileView{ID: "id", FullName: "Name"}}}}},
+		{"admin_moderation.gohtml", views.AdminModerationView{
+			Rules:   []views.ModerationRule{{ID: "r", Kind: "word", Pattern: "p", Action: "hold", Note: "n", CreatedAt: now, CreatedBy: "a"}},
+			Held:    []views.ProfileView{{ID: "id", FullName: "Name", Country: "Chile", City: "Santiago", Description: "d", CreatedAt: now}},
+			Matches: []views.ModerationMatch{{Pattern: "p", Action: "reject", Field: "full_name", Value: "v", CreatedAt: now}},
+			Form:    views.ModerationRule{Kind: "regex", Action: "redact"}, Notice: "ok", Error: "bad"}},
+		{"takedown.gohtml", views.TakedownView{Form: views.TakedownForm{Profile: "id", Reason: "other"}, FullName: "Name",
+			Reasons: []string{"other"}, CSRF: "c", Error: "bad", ReadOnly: true}},
+		{"takedown.gohtml", views.TakedownView{Reference: "r", Form: views.TakedownForm{Contact: "a@example.com"}}},
+		{"admin_profile.gohtml", views.AdminProfileEditView{Profile: views.ProfileView{ID: "id", FullName: "Name", EditedAt: &now},
+			Revisions: []views.Revision{{ID: "r", Field: "full_name", Previous: "a", Value: "b", EditedBy: "admin", Reverts: "q", CreatedAt: now}},
+			Notice: "ok", Error: "bad", PhotoTaken: &now}},
+		{"admin_profile.gohtml", views.AdminProfileEditView{Profile: views.ProfileView{ID: "id"}, PhotoTaken: &now, PhotoTakenHidden: true}},
+		{"admin_profile.gohtml", views.AdminProfileEditView{}},
+		{"admin_photos.gohtml", views.AdminPhotoTrafficView{Days: 7, Protection: true, Referers: []string{"blog.example"}, Embeds: true,
+			Rows: []views.PhotoTraffic{{ProfileID: "id", FullName: "Name", Requests: 3, NotModified: 1, Bytes: 2048, Blocked: 2}}, Total: views.PhotoTraffic{Requests: 3}}},
+		{"admin_photos.gohtml", views.AdminPhotoTrafficView{Days: 1}},
+		{"admin_referrers.gohtml", views.AdminVoteReferrersView{Days: 7, Total: 5,
+			Sources:   []views.VoteReferrer{{Source: "news.example", Votes: 3}, {Votes: 2}},
+			Campaigns: []views.VoteReferrer{{Campaign: "spring", Votes: 3}},
+			Profiles:  []views.VoteReferrer{{ProfileID: "id", FullName: "Name", Source: "news.example", Campaign: "spring", Votes: 3}}}},
+		{"admin_referrers.gohtml", views.AdminVoteReferrersView{Days: 1}},
+		{"admin_takedowns.gohtml", views.AdminTakedownsView{
+			Open:     []views.Takedown{{ID: "t", ProfileID: "id", FullName: "Name", Reason: "privacy", Details: "d", Contact: "a@example.com", Status: "open", CreatedAt: now}},
+			Resolved: []views.Takedown{{ID: "u", FullName: "Name", Reason: "other", Status: "rejected", ResolvedAt: now, ResolvedBy: "ops", Note: "n"}},
+			Notice:   "ok", Error: "bad"}},
+		{"add.gohtml", views.AddView{Closed: true}},
+		{"add.gohtml", views.AddView{Duplicate: &views.DuplicateName{Existing: []views.Duplicate{{URL: "/profiles/id", FullName: "Name"}}}, Form: views.AddForm{NameOK: true}}},
+		{"admin_settings.gohtml", views.AdminSettingsView{Settings: []views.Setting{
+			{Key: "vote_cooldown", Type: "duration", Value: "30m", Default: "1h", Doc: "d", Custom: true, UpdatedAt: now, UpdatedBy: "ops"},
+			{Key: "sparklines", Type: "bool", Value: "true", Default: "true"}}, Notice: "ok", Error: "bad"}},
+		{"admin_layout.gohtml", views.AdminLayoutView{Rows: layoutEditorRows(defaultLayout), Kinds: layoutKinds(), Error: "bad"}},
+		{"admin_site.gohtml", views.AdminSiteView{Copy: views.SiteCopy{Title: "t", Welcome: "w"}, Saved: true, Error: "bad"}},
+	}
+	for _, tt := range tests {
+		if err := tmpl.ExecuteTemplate(io.Discard, tt.name, tt.data); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Visitors are stored (for throttles and audit) as an HMAC of their client IP, never the IP.
+// The key rotates every LEADERBOARD_VISITOR_KEY_ROTATION: each period's key is derived from
+// LEADERBOARD_VISITOR_KEY and the period number, and an id is "<period>.<mac>", so it says
+// which key made it. Checks look back at most visitorLookback, so the keys of the periods
+// overlapping that window are still tried; once a key leaves it, retireVisitorKeys blanks
+// the ids it made and they can no longer be linked to anyone.
+
+// visitorLookback is the longest any check looks back at a visitor's rows: the creation
+// quota counts the current UTC day and takedowns the last 24 hours.
+const visitorLookback = 24 * time.Hour
+
+type visitorKeys struct {
+	secret   []byte
+	rotation time.Duration
+}
+
+// newVisitorKeys keys visitor ids with secret. Without one a random key is used, which is
+// fine for a single instance but resets the throttles on restart and splits them across
+// replicas.
+func newVisitorKeys(secret string, rotation time.Duration) visitorKeys {
+	k := visitorKeys{secret: []byte(secret), rotation: rotation}
+	if secret == "" {
+		k.secret = make([]byte, 32)
+		_, _ = rand.Read(k.secret)
+	}
+	return k
+}
+
+func (k visitorKeys) period(t time.Time) int64 { return t.Unix() / int64(k.rotation/time.Second) }
+
+// kept is how many periods before the current one still have a live key.
+func (k visitorKeys) kept() int64 { return int64((visitorLookback + k.rotation - 1) / k.rotation) }
+
+// id is ip's visitor id under period's key.
+func (k visitorKeys) id(ip string, period int64) string {
+	p := strconv.FormatInt(period, 10)
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte("visitor-key\x00" + p))
+	mac = hmac.New(sha256.New, mac.Sum(nil))
+	mac.Write([]byte(ip))
+	return p + "." + hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+// ids are ip's visitor ids under every live key at now, current first.
+func (k visitorKeys) ids(ip string, now time.Time) visitorIDs {
+	cur := k.period(now)
+	ids := make(visitorIDs, 0, k.kept()+1)
+	for p := cur; p >= cur-k.kept(); p-- { ids = append(ids, k.id(ip, p)) }
+	return ids
+}
+
+// live are the period prefixes of ids that may still be matched at now.
+func (k visitorKeys) live(now time.Time) []string {
+	cur := k.period(now)
+	var out []string
+	for p := cur; p >= cur-k.kept(); p-- { out = append(out, strconv.FormatInt(p, 10)) }
+	return out
+}
+
+// visitorIDs are one visitor's ids under the live keys. New rows are written with the
+// current one; lookbacks match any of them.
+type visitorIDs []string
+
+func (v visitorIDs) current() string { return v[0] }
+
+// visitor identifies the request's client for throttling and audit.
+func (s *Server) visitor(r *http.Request) visitorIDs {
+	return s.visitorKeys.ids(s.clientIP(r), time.Now())
+}
+
+// retireVisitorKeys blanks visitor ids made with keys that have left the lookback window,
+// including unkeyed ids from before keys existed. The ids can't be re-hashed under the
+// current key (only the IP could), so retiring them is what unlinks old rows: counters
+// nobody checks any more are dropped, audit rows keep everything but the visitor.
+func (s *Server) retireVisitorKeys(ctx context.Context) error {
+	live := s.visitorKeys.live(time.Now())
+	type job struct {
+		table string
+		run   func() (int64, error)
+	}
+	var jobs []job
+	for _, q := range []struct{ table, query string }{
+		{"profile_creations", `DELETE FROM profile_creations WHERE split_part(visitor, '.', 1) != ALL($1) LIMIT $2`},
+		{"takedown_requests", `UPDATE takedown_requests SET visitor = '' WHERE visitor != '' AND split_part(visitor, '.', 1) != ALL($1) LIMIT $2`},
+		{"moderation_matches", `UPDATE moderation_matches SET visitor = '' WHERE visitor != '' AND split_part(visitor, '.', 1) != ALL($1) LIMIT $2`},
+	} {
+		jobs = append(jobs, job{q.table, func() (int64, error) {
+			res, err := s.db.ExecContext(ctx, q.query, pq.Array(live), retentionBatchSize)
+			if err != nil { return 0, err }
+			return res.RowsAffected()
+		}})
+	}
+	// Voter fingerprints are keyed the same way. Cookie and kiosk voters are not: they are
+	// pruned by vote retention (pruneVoters), and their votes keep them.
+	jobs = append(jobs, job{"voters and votes", func() (int64, error) { return s.store.RetireFingerprints(ctx, live, retentionBatchSize) }})
+	for _, job := range jobs {
+		var total int64
+		for {
+			if err := s.writable(); err != nil { return err }
+			n, err := job.run()
+			if err != nil { return err }
+			total += n
+			if n < retentionBatchSize { break }
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retentionBatchPause):
+			}
+		}
+		if total > 0 { s.log.Info("visitor keys retired", "table", job.table, "rows", total) }
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVisitorIDs(t *testing.T) {
+	k := newVisitorKeys("secret", 6*time.Hour)
+	now := time.Date(2026, 3, 1, 13, 0, 0, 0, time.UTC)
+
+	ids := k.ids("203.0.113.7", now)
+	if len(ids) != 5 {
+		t.Fatalf("ids = %d, want the current key and the 4 covering the last 24h", len(ids))
+	}
+	if ids.current() != k.id("203.0.113.7", k.period(now)) {
+		t.Fatal("current id is not the one of the current period")
+	}
+	for _, id := range ids {
+		if strings.Contains(id, "203.0.113.7") || !slices.Contains(k.live(now), strings.SplitN(id, ".", 2)[0]) {
+			t.Errorf("id %q leaks the IP or is not under a live key %v", id, k.live(now))
+		}
+	}
+
+	// A row written a day ago is still found; the key before that is retired.
+	day := now.Add(-visitorLookback)
+	if !slices.Contains(ids, k.ids("203.0.113.7", day).current()) {
+		t.Error("id from 24h ago is not among the live ids")
+	}
+	if slices.Contains(ids, k.ids("203.0.113.7", day.Add(-6*time.Hour)).current()) {
+		t.Error("id from a retired key still matches")
+	}
+
+	if k.id("203.0.113.7", 1) == k.id("203.0.113.8", 1) || k.id("203.0.113.7", 1) == k.id("203.0.113.7", 2) {
+		t.Error("ids collide across visitors or periods")
+	}
+	if newVisitorKeys("other", 6*time.Hour).id("203.0.113.7", 1) == k.id("203.0.113.7", 1) {
+		t.Error("ids don't depend on the key")
+	}
+	if newVisitorKeys("", time.Hour).id("203.0.113.7", 1) == newVisitorKeys("", time.Hour).id("203.0.113.7", 1) {
+		t.Error("unset keys are not random")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// voteBuffer batches votes_count increments. Votes are still written to votes one by one
+// (with counted = false), but the hot profiles row is updated once per flush instead of
+// once per vote. Callers wait for the flush that covers their vote, so a vote's effect is
+// visible once castVote returns, as in write-through mode.
+type voteBuffer struct {
+	interval time.Duration
+	batch    int // pending votes that trigger an early flush
+	flush    func(context.Context) error
+
+	mu      sync.Mutex
+	pending int
+	done    chan struct{} // closed when the flush covering the pending votes finished
+	kick    chan struct{}
+}
+
+func newVoteBuffer(interval time.Duration, batch int, flush func(context.Context) error) *voteBuffer {
+	return &voteBuffer{interval: interval, batch: batch, flush: flush, done: make(chan struct{}), kick: make(chan struct{}, 1)}
+}
+
+// add registers a vote already in votes and returns a channel closed once it is counted (or
+// the flush attempt failed; the vote then waits in votes for the next one).
+func (b *voteBuffer) add() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending++
+	if b.pending >= b.batch {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+	return b.done
+}
+
+// queued is the number of votes waiting for the next flush.
+func (b *voteBuffer) queued() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.pending
+}
+
+// run flushes every interval, or early when a batch filled up, until ctx is done. The first
+// flush runs right away to count votes a previous process left behind.
+func (b *voteBuffer) run(ctx context.Context, onErr func(error)) {
+	t := time.NewTicker(b.interval)
+	defer t.Stop()
+	retry := true
+	for {
+		b.mu.Lock()
+		n, done := b.pending, b.done
+		if n > 0 || retry {
+			b.pending, b.done = 0, make(chan struct{})
+		}
+		b.mu.Unlock()
+		if n > 0 || retry {
+			err := b.flush(ctx)
+			retry = err != nil
+			if err != nil && ctx.Err() == nil { onErr(err) }
+			close(done)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-b.kick:
+		}
+	}
+}
+
+// wait blocks until ch is closed or ctx is done. The vote is recorded either way.
+func (b *voteBuffer) wait(ctx context.Context, ch <-chan struct{}) {
+	select {
+	case <-ch:
+	case <-ctx.Done():
+	}
+}
+
+// flushVotes folds the uncounted votes of every instance into votes_count (store.FlushVotes).
+func (s *Server) flushVotes(ctx context.Context) error {
+	if err := s.writable(); err != nil { return err }
+	return s.store.FlushVotes(ctx)
+}
+
+// recordVote writes one vote for profile id within the transaction ctx carries: straight
+// into votes_count without a buffer, otherwise as an uncounted votes row for the next flush.
+// voteID is the id of the votes row (a form's vote token); "" generates one. v is who cast
+// it, if anyone.
+func (s *Server) recordVote(ctx context.Context, id, voteID string, v voter) error {
+	status, err := s.store.ProfileStatus(ctx, id)
+	if err != nil { return err }
+	switch status {
+	case statusActive:
+	case statusRetired:
+		return ErrRetired
+	default:
+		return ErrNotFound // held for review: not public yet
+	}
+	if s.votes == nil {
+		if err := s.store.IncrementVote(ctx, id); err != nil { return err }
+	}
+	if err := s.store.InsertVote(ctx, store.Vote{ID: voteID, Profile: id, Voter: v.id(), Counted: s.votes == nil}); err != nil { return err }
+	if v.kind == "" { return nil }
+	return s.store.NoteVoter(ctx, v.id(), v.kind)
+}
+
+// voteRecorded is called after a vote's transaction committed; with a buffer it waits for
+// the vote to be counted.
+func (s *Server) voteRecorded(ctx context.Context) {
+	if s.votes == nil { return }
+	s.votes.wait(ctx, s.votes.add())
+}
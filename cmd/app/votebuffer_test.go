@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// startVoteBuffer runs a buffer whose flushes report on the returned channel (the startup
+// flush already drained), with results taken from results in order, then nil.
+func startVoteBuffer(t *testing.T, interval time.Duration, batch int, results ...error) (*voteBuffer, <-chan struct{}) {
+	t.Helper()
+	flushed := make(chan struct{}, 16)
+	b := newVoteBuffer(interval, batch, func(context.Context) error {
+		var err error
+		if len(results) > 0 { err, results = results[0], results[1:] }
+		flushed <- struct{}{}
+		return err
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go b.run(ctx, func(error) {})
+	waitFlush(t, flushed)
+	return b, flushed
+}
+
+func waitFlush(t *testing.T, flushed <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-flushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no flush")
+	}
+}
+
+func TestVoteBufferFlushesFullBatchEarly(t *testing.T) {
+	b, flushed := startVoteBuffer(t, time.Hour, 3)
+	var waits []<-chan struct{}
+	for range 3 {
+		waits = append(waits, b.add())
+	}
+	waitFlush(t, flushed)
+	for i, ch := range waits {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("vote %d was not released", i)
+		}
+	}
+}
+
+func TestVoteBufferRetriesFailedFlush(t *testing.T) {
+	b, flushed := startVoteBuffer(t, 10*time.Millisecond, 100, nil, errors.New("boom"))
+	b.add()
+	waitFlush(t, flushed) // fails
+	// No further votes arrive: the failed flush must be retried on its own.
+	waitFlush(t, flushed)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// The confirmation page is a plain-form path to a vote for keyboard and screen-reader users,
+// or anyone without JavaScript: GET shows the exhibit and one button, POST records the vote
+// and redirects back (POST/redirect/GET), where a flash cookie says how it went.
+
+const (
+	csrfCookie  = "csrf"
+	flashCookie = "vote_flash"
+)
+
+// voteFlashes are the outcomes a flash cookie may carry; anything else is ignored, so the
+// cookie can't inject text into the page.
+var voteFlashes = map[string]views.Flash{
+	"voted":   {Message: "Thanks, your vote was counted."},
+	"limited": {Message: "This exhibit has had too many votes lately. Please try again later.", Error: true},
+	"repeat":  {Message: "You already voted for this exhibit recently. Please try again later.", Error: true},
+	"retired": {Message: "This exhibit is retired and no longer takes votes.", Error: true},
+	"expired": {Message: "This form expired. Please confirm your vote again.", Error: true},
+	"already": {Message: "Your vote was already counted."},
+	"captcha": {Message: "Please complete the check below, then confirm your vote again.", Error: true},
+	"failed":  {Message: "Something went wrong and your vote was not counted. Please try again later.", Error: true},
+}
+
+func voteConfirmURL(id string) string {
+	return "/profiles/" + url.PathEscape(id) + "/vote/confirm"
+}
+
+// csrfToken returns the visitor's CSRF token, issuing a cookie when there is none. Forms
+// echo it back in a hidden field (double submit): a cross-site page can make the browser
+// send the cookie but can't read it to fill in the field.
+func (s *Server) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookie); err == nil && len(c.Value) >= 22 { return c.Value }
+	b := make([]byte, 18)
+	_, _ = rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{Name: csrfCookie, Value: token, Path: "/", HttpOnly: true,
+		Secure: s.secureCookies(r), SameSite: http.SameSiteStrictMode})
+	return token
+}
+
+// checkCSRF reports whether the form's csrf field matches the visitor's cookie.
+func checkCSRF(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil || len(c.Value) < 22 { return false }
+	return hmac.Equal([]byte(c.Value), []byte(r.PostFormValue("csrf")))
+}
+
+// secureCookies marks cookies Secure when the board is served over HTTPS, directly or (per
+// LEADERBOARD_PUBLIC_URL) behind a proxy.
+func (s *Server) secureCookies(r *http.Request) bool {
+	return r.TLS != nil || strings.HasPrefix(s.cfg.PublicURL, "https://")
+}
+
+func (s *Server) setVoteFlash(w http.ResponseWriter, r *http.Request, id, code string) {
+	http.SetCookie(w, &http.Cookie{Name: flashCookie, Value: code, Path: voteConfirmURL(id), MaxAge: 60, HttpOnly: true,
+		Secure: s.secureCookies(r), SameSite: http.SameSiteLaxMode})
+}
+
+// takeVoteFlash returns the pending flash for the page and clears it, so a reload doesn't
+// repeat the message.
+func (s *Server) takeVoteFlash(w http.ResponseWriter, r *http.Request, id string) *views.Flash {
+	c, err := r.Cookie(flashCookie)
+	if err != nil { return nil }
+	http.SetCookie(w, &http.Cookie{Name: flashCookie, Path: voteConfirmURL(id), MaxAge: -1, HttpOnly: true,
+		Secure: s.secureCookies(r), SameSite: http.SameSiteLaxMode})
+	f, ok := voteFlashes[c.Value]
+	if !ok { return nil }
+	return &f
+}
+
+// handleVoteConfirm serves GET and POST /profiles/{id}/vote/confirm.
+func (s *Server) handleVoteConfirm(w http.ResponseWriter, r *http.Request) {
+	id := pathID(r)
+	if r.Method == http.MethodPost {
+		s.confirmVote(w, r, id)
+		return
+	}
+	if status, err := s.store.ProfileStatus(r.Context(), id); errors.Is(err, ErrNotFound) || (err == nil && status == statusHeld) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	list, err := s.loadProfiles(r.Context(), profileFilter{ID: id, Limit: 1})
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	if len(list) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	pv := profileView(list[0])
+	if !pv.Retired { pv.VoteToken = newVoteToken() }
+	voted, err := s.votedRecently(r.Context(), s.issueVoter(w, r))
+	if err != nil {
+		http.Error(w, "query error", http.StatusInternalServerError)
+		return
+	}
+	pv.Voted = voted[id]
+	w.Header().Set("Cache-Control", "no-store")
+	s.render(w, "vote_confirm.gohtml", views.VoteConfirmView{
+		Profile:  pv,
+		CSRF:     s.csrfToken(w, r),
+		Flash:    s.takeVoteFlash(w, r, id),
+		ReadOnly: s.readOnly.active(),
+		Captcha:  s.captchaView(r, false),
+	})
+}
+
+// confirmVote records the vote of a confirmation form and redirects back to the page with
+// the outcome as a flash. Only unknown profiles and read-only mode answer directly.
+func (s *Server) confirmVote(w http.ResponseWriter, r *http.Request, id string) {
+	code := "voted"
+	if !checkCSRF(r) {
+		code = "expired"
+	} else if err := s.castScreenedVote(r, id, r.PostFormValue("vote_token")); err != nil {
+		switch {
+		case errors.As(err, new(interface{ CaptchaRequired() })):
+			code = "captcha"
+		case errors.As(err, new(interface{ DuplicateVote() })):
+			code = "already"
+		case errors.Is(err, ErrVotedRecently):
+			code = "repeat"
+		case errors.As(err, new(interface{ RateLimited() })):
+			code = "limited"
+		case errors.As(err, new(interface{ Retired() })):
+			code = "retired"
+		case errors.As(err, new(interface{ NotFound() })):
+			http.NotFound(w, r)
+			return
+		case errors.As(err, new(interface{ ReadOnly() })):
+			writeReadOnly(w, r)
+			return
+		default:
+			s.log.Error("confirmed vote", "profile", id, "err", err)
+			code = "failed"
+		}
+	}
+	s.setVoteFlash(w, r, id, code)
+	http.Redirect(w, r, voteConfirmURL(id), http.StatusSeeOther)
+}
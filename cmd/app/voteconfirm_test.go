@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	s := &Server{cfg: Config{PublicURL: "https://example.com"}}
+	rec := httptest.NewRecorder()
+	token := s.csrfToken(rec, httptest.NewRequest("GET", "/profiles/x/vote/confirm", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != token || !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("csrf cookie = %+v, want HttpOnly, Secure, SameSite=Strict with the token", cookies)
+	}
+
+	post := func(cookie, field string) *http.Request {
+		r := httptest.NewRequest("POST", "/profiles/x/vote/confirm", strings.NewReader(url.Values{"csrf": {field}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" { r.AddCookie(&http.Cookie{Name: csrfCookie, Value: cookie}) }
+		return r
+	}
+	if !checkCSRF(post(token, token)) {
+		t.Fatal("matching cookie and field rejected")
+	}
+	for _, tc := range [][2]string{{token, ""}, {token, token + "x"}, {"", token}, {"", ""}, {"short", "short"}} {
+		if checkCSRF(post(tc[0], tc[1])) {
+			t.Errorf("checkCSRF(cookie %q, field %q) accepted", tc[0], tc[1])
+		}
+	}
+
+	// An existing cookie is reused rather than rotated, so open forms in other tabs stay valid.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: csrfCookie, Value: token})
+	rec = httptest.NewRecorder()
+	if got := s.csrfToken(rec, r); got != token || len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("csrfToken with cookie = %q (set %v), want %q unchanged", got, rec.Result().Cookies(), token)
+	}
+}
+
+func TestVoteFlashOnlyKnownCodes(t *testing.T) {
+	s := &Server{}
+	for code, want := range map[string]bool{"voted": true, "limited": true, "<script>": false, "": false} {
+		r := httptest.NewRequest("GET", voteConfirmURL("x"), nil)
+		r.AddCookie(&http.Cookie{Name: flashCookie, Value: code})
+		rec := httptest.NewRecorder()
+		f := s.takeVoteFlash(rec, r, "x")
+		if (f != nil) != want {
+			t.Errorf("takeVoteFlash(%q) = %v, want shown %t", code, f, want)
+		}
+		if c := rec.Result().Cookies(); len(c) != 1 || c[0].MaxAge >= 0 {
+			t.Errorf("takeVoteFlash(%q) did not clear the cookie: %v", code, c)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Vote imports bring over vote totals from another system when a leaderboard moves here:
+// POST /api/v1/admin/votes:import with a batch of (profile, timestamp, count) rows, as JSON
+// or CSV. Each row becomes count votes in votes at its timestamp, and votes_count
+// goes up by the same amount, so trends, champions and reconcile see them like any other
+// archived vote. Batches are all or nothing and applied once per batch id.
+
+// Import limits keep one batch to a transaction CockroachDB handles comfortably; split
+// larger histories into several batches.
+const (
+	maxImportRows     = 10000
+	maxImportVotes    = 100000 // sum of counts in a batch
+	maxImportBodySize = 4 << 20
+)
+
+// VoteImport is a batch of historical votes.
+type VoteImport struct {
+	BatchID string         `json:"batch_id"`
+	Source  string         `json:"source"`
+	Votes   []ImportedVote `json:"votes"`
+}
+
+type ImportedVote struct {
+	Profile   string    `json:"profile"`
+	Timestamp time.Time `json:"timestamp"`
+	Count     int       `json:"count"`
+}
+
+// VoteImportResult is what a batch added; Replayed is set when the batch id was imported before.
+type VoteImportResult struct {
+	BatchID   string    `json:"batch_id"`
+	Votes     int       `json:"votes"`
+	Profiles  int       `json:"profiles"`
+	Oldest    time.Time `json:"oldest"`
+	Newest    time.Time `json:"newest"`
+	CreatedAt time.Time `json:"created_at"`
+	Replayed  bool      `json:"replayed"`
+}
+
+// importRowError is a problem with one row, by its index in the batch (0-based).
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ErrorImportConflict string
+
+func (e ErrorImportConflict) Error() string { return string(e) }
+func (ErrorImportConflict) Conflict()       {}
+
+// validate checks the batch without the database. Rows are checked one by one so a client
+// fixing an export sees every bad row at once.
+func (b VoteImport) validate(now time.Time) (errs []importRowError, err error) {
+	// Batch ids follow the request id rules: short, and safe in logs and URLs.
+	if !validRequestID(b.BatchID) { return nil, errors.New("batch_id must be 1-64 letters, digits, '-', '_' or '.'") }
+	if len(b.Source) > 200 { return nil, errors.New("source too long") }
+	if len(b.Votes) == 0 { return nil, errors.New("votes is empty") }
+	if len(b.Votes) > maxImportRows { return nil, fmt.Errorf("at most %d rows per batch", maxImportRows) }
+	total := 0
+	for i, v := range b.Votes {
+		switch {
+		case !looksLikeUUID(v.Profile):
+			errs = append(errs, importRowError{i, "profile must be a profile id"})
+		case v.Timestamp.IsZero():
+			errs = append(errs, importRowError{i, "timestamp is required"})
+		case v.Timestamp.After(now):
+			errs = append(errs, importRowError{i, "timestamp is in the future"})
+		case v.Count < 1 || v.Count > maxImportVotes:
+			errs = append(errs, importRowError{i, fmt.Sprintf("count must be between 1 and %d", maxImportVotes)})
+		}
+		total += max(v.Count, 0)
+	}
+	if total > maxImportVotes { return errs, fmt.Errorf("at most %d votes per batch", maxImportVotes) }
+	return errs, nil
+}
+
+// looksLikeUUID checks the canonical 8-4-4-4-12 hex form.
+func looksLikeUUID(s string) bool {
+	if len(s) != 36 { return false }
+	for i, c := range s {
+		if i == 8 || i == 13 || i == 18 || i == 23 {
+			if c != '-' { return false }
+			continue
+		}
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') { return false }
+	}
+	return true
+}
+
+// digest identifies the batch contents, so a retried batch id can be told from a reused one.
+func (b VoteImport) digest() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", b.Source)
+	for _, v := range b.Votes {
+		fmt.Fprintf(h, "%s,%s,%d\n", strings.ToLower(v.Profile), v.Timestamp.UTC().Format(time.RFC3339Nano), v.Count)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseVoteImportCSV reads a CSV batch: a header naming profile, timestamp and optionally
+// count (1 when missing), in any order, then one row per line. Timestamps are RFC 3339.
+func parseVoteImportCSV(r io.Reader) ([]ImportedVote, []importRowError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil { return nil, nil, fmt.Errorf("csv header: %w", err) }
+	col := map[string]int{}
+	for i, h := range header { col[strings.ToLower(strings.TrimSpace(h))] = i }
+	pi, ok1 := col["profile"]
+	ti, ok2 := col["timestamp"]
+	ci, hasCount := col["count"]
+	if !ok1 || !ok2 { return nil, nil, errors.New("csv header must name profile and timestamp columns") }
+	var out []ImportedVote
+	var errs []importRowError
+	for row := 0; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF { break }
+		if err != nil { return nil, nil, fmt.Errorf("csv: %w", err) }
+		if row >= maxImportRows { return nil, nil, fmt.Errorf("at most %d rows per batch", maxImportRows) }
+		field := func(i int) string {
+			if i < len(rec) { return strings.TrimSpace(rec[i]) }
+			return ""
+		}
+		v := ImportedVote{Profile: field(pi), Count: 1}
+		if v.Timestamp, err = time.Parse(time.RFC3339, field(ti)); err != nil {
+			errs = append(errs, importRowError{row, "timestamp must be RFC 3339"})
+		}
+		if hasCount {
+			if v.Count, err = strconv.Atoi(field(ci)); err != nil { errs = append(errs, importRowError{row, "count must be a whole number"}) }
+		}
+		out = append(out, v)
+	}
+	return out, errs, nil
+}
+
+// importVotes applies b once. A batch id seen before returns its recorded result, marked
+// replayed, or ErrorImportConflict when the payload is different. Rows naming profiles that
+// don't exist fail the whole batch with their row errors.
+func (s *Server) importVotes(ctx context.Context, b VoteImport, actor string) (VoteImportResult, []importRowError, error) {
+	if err := s.writable(); err != nil { return VoteImportResult{}, nil, err }
+	digest := b.digest()
+	if res, err := s.lookupVoteImport(ctx, b.BatchID, digest); err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return res, nil, err
+	}
+
+	ids := make([]string, 0, len(b.Votes))
+	for _, v := range b.Votes { ids = append(ids, strings.ToLower(v.Profile)) }
+	known := map[string]bool{}
+	rows, err := s.db.QueryContext(ctx, `SELECT id::string FROM profiles WHERE id = ANY($1::uuid[])`, pq.Array(ids))
+	if err != nil { return VoteImportResult{}, nil, err }
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil { return VoteImportResult{}, nil, err }
+		known[id] = true
+	}
+	if err := rows.Err(); err != nil { return VoteImportResult{}, nil, err }
+	var errs []importRowError
+	for i, id := range ids {
+		if !known[id] { errs = append(errs, importRowError{i, "unknown profile " + id}) }
+	}
+	if len(errs) > 0 { return VoteImportResult{}, errs, nil }
+
+	res := VoteImportResult{BatchID: b.BatchID, Oldest: b.Votes[0].Timestamp.UTC(), Newest: b.Votes[0].Timestamp.UTC()}
+	perProfile := map[string]int{}
+	stamps := make([]string, len(b.Votes))
+	counts := make([]int64, len(b.Votes))
+	for i, v := range b.Votes {
+		t := v.Timestamp.UTC()
+		if t.Before(res.Oldest) { res.Oldest = t }
+		if t.After(res.Newest) { res.Newest = t }
+		stamps[i], counts[i] = t.Format(time.RFC3339Nano), int64(v.Count)
+		perProfile[ids[i]] += v.Count
+		res.Votes += v.Count
+	}
+	res.Profiles = len(perProfile)
+	profiles := make([]string, 0, len(perProfile))
+	totals := make([]int64, 0, len(perProfile))
+	for id, n := range perProfile {
+		profiles = append(profiles, id)
+		totals = append(totals, int64(n))
+	}
+
+	err = withTx(ctx, s.db, func(tx *sql.Tx) error {
+		// The batch row goes first: a concurrent import of the same id conflicts here.
+		if err := tx.QueryRowContext(ctx, `
+			INSERT INTO vote_imports (batch_id, source, payload_sha256, votes, profiles, oldest, newest, requested_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING created_at
+		`, b.BatchID, b.Source, digest, res.Votes, res.Profiles, res.Oldest, res.Newest, actor).Scan(&res.CreatedAt); err != nil { return err }
+		if err := s.insertPastVotes(ctx, tx, `
+			SELECT gen_random_uuid(), v.profile_id, v.created_at
+			FROM unnest($1::uuid[], $2::timestamptz[], $3::int[]) AS v(profile_id, created_at, n)
+			CROSS JOIN LATERAL generate_series(1, v.n)
+		`, pq.Array(ids), pq.Array(stamps), pq.Array(counts)); err != nil { return err }
+		_, err := tx.ExecContext(ctx, `
+			UPDATE profiles p SET votes_count = p.votes_count + a.n, updated_at = now()
+			FROM unnest($1::uuid[], $2::int[]) AS a(id, n)
+			WHERE p.id = a.id
+		`, pq.Array(profiles), pq.Array(totals))
+		return err
+	})
+	if err != nil {
+		// Lost a race with the same batch id: answer like a retry.
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" { res, err := s.lookupVoteImport(ctx, b.BatchID, digest); return res, nil, err }
+		return VoteImportResult{}, nil, err
+	}
+	s.log.Info("votes imported", "batch", b.BatchID, "source", b.Source, "votes", res.Votes, "profiles", res.Profiles,
+		"oldest", res.Oldest, "newest", res.Newest, "by", actor)
+	if err := s.refreshChampions(ctx); err != nil { s.log.Warn("refresh champions after vote import", "err", err) }
+	return res, nil, nil
+}
+
+// lookupVoteImport returns the recorded result of batch id, sql.ErrNoRows when there is none,
+// or ErrorImportConflict when it was imported with a different payload.
+func (s *Server) lookupVoteImport(ctx context.Context, id, digest string) (VoteImportResult, error) {
+	res := VoteImportResult{BatchID: id, Replayed: true}
+	var stored string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT payload_sha256, votes, profiles, oldest, newest, created_at FROM vote_imports WHERE batch_id = $1
+	`, id).Scan(&stored, &res.Votes, &res.Profiles, &res.Oldest, &res.Newest, &res.CreatedAt)
+	if err != nil { return VoteImportResult{}, err }
+	if stored != digest { return VoteImportResult{}, ErrorImportConflict("batch " + id + " was already imported with different votes") }
+	return res, nil
+}
+
+// handleAPIAdminVoteImport imports a batch: POST /api/v1/admin/votes:import with a VoteImport
+// as JSON, or as text/csv with ?batch_id= and ?source=.
+func (s *Server) handleAPIAdminVoteImport(w http.ResponseWriter, r *http.Request) {
+	var b VoteImport
+	var rowErrs []importRowError
+	body := http.MaxBytesReader(w, r.Body, maxImportBodySize)
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "text/csv":
+		b.BatchID, b.Source = r.URL.Query().Get("batch_id"), r.URL.Query().Get("source")
+		var err error
+		if b.Votes, rowErrs, err = parseVoteImportCSV(body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case "application/json", "":
+		if err := json.NewDecoder(body).Decode(&b); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bad json")
+			return
+		}
+	default:
+		writeJSONError(w, http.StatusUnsupportedMediaType, "send application/json or text/csv")
+		return
+	}
+	errs, err := b.validate(time.Now())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs = mergeRowErrors(rowErrs, errs); len(errs) > 0 {
+		writeImportRowErrors(w, errs)
+		return
+	}
+
+	actor, _ := s.adminActor(r)
+	res, errs, err := s.importVotes(r.Context(), b, actor)
+	switch {
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	case errors.As(err, new(interface{ Conflict() })):
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		s.log.Error("vote import", "batch", b.BatchID, "err", err)
+		writeJSONError(w, http.StatusInternalServerError, "db error")
+	case len(errs) > 0:
+		writeImportRowErrors(w, errs)
+	case res.Replayed:
+		writeJSON(w, http.StatusOK, res)
+	default:
+		writeJSON(w, http.StatusCreated, res)
+	}
+}
+
+// mergeRowErrors keeps the first error of each row, parse errors before validation ones.
+func mergeRowErrors(lists ...[]importRowError) []importRowError {
+	seen := map[int]bool{}
+	var out []importRowError
+	for _, list := range lists {
+		for _, e := range list {
+			if !seen[e.Row] { seen[e.Row], out = true, append(out, e) }
+		}
+	}
+	return out
+}
+
+// writeImportRowErrors answers 400 with every row error; the error message names the first
+// few for clients that only show it.
+func writeImportRowErrors(w http.ResponseWriter, errs []importRowError) {
+	var first []string
+	for _, e := range errs[:min(len(errs), 3)] { first = append(first, fmt.Sprintf("row %d: %s", e.Row, e.Error)) }
+	writeJSON(w, http.StatusBadRequest, map[string]any{
+		"error":  fmt.Sprintf("%d invalid rows (%s)", len(errs), strings.Join(first, "; ")),
+		"errors": errs,
+	})
+}
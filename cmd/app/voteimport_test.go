@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const importProfile = "3f2b8a3e-1c4d-4e5f-9a6b-7c8d9e0f1a2b"
+
+func TestParseVoteImportCSV(t *testing.T) {
+	in := "timestamp,profile,count\n" +
+		"2024-05-01T10:00:00Z," + importProfile + ",3\n" +
+		"yesterday," + importProfile + ",1\n" +
+		"2024-05-02T10:00:00Z," + importProfile + ",x\n"
+	votes, errs, err := parseVoteImportCSV(strings.NewReader(in))
+	if err != nil { t.Fatal(err) }
+	if len(votes) != 3 || votes[0].Profile != importProfile || votes[0].Count != 3 || !votes[0].Timestamp.Equal(time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Fatalf("votes = %+v", votes)
+	}
+	if len(errs) != 2 || errs[0].Row != 1 || errs[1].Row != 2 {
+		t.Errorf("row errors = %+v, want rows 1 and 2", errs)
+	}
+
+	votes, _, err = parseVoteImportCSV(strings.NewReader("profile,timestamp\n" + importProfile + ",2024-05-01T10:00:00Z\n"))
+	if err != nil || len(votes) != 1 || votes[0].Count != 1 {
+		t.Errorf("without a count column: %+v, %v (want count 1)", votes, err)
+	}
+	if _, _, err := parseVoteImportCSV(strings.NewReader("id,when\n")); err == nil {
+		t.Error("header without profile and timestamp accepted")
+	}
+}
+
+func TestVoteImportValidate(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	ok := ImportedVote{Profile: importProfile, Timestamp: now.Add(-time.Hour), Count: 2}
+	b := VoteImport{BatchID: "legacy-2024.1", Votes: []ImportedVote{
+		ok,
+		{Profile: "nope", Timestamp: ok.Timestamp, Count: 1},
+		{Profile: importProfile, Timestamp: now.Add(time.Hour), Count: 1},
+		{Profile: importProfile, Timestamp: ok.Timestamp, Count: 0},
+		{Profile: importProfile, Count: 1},
+	}}
+	errs, err := b.validate(now)
+	if err != nil { t.Fatal(err) }
+	if len(errs) != 4 || errs[0].Row != 1 || errs[3].Row != 4 {
+		t.Errorf("row errors = %+v, want rows 1-4", errs)
+	}
+
+	for name, bad := range map[string]VoteImport{
+		"no batch id":  {Votes: []ImportedVote{ok}},
+		"bad batch id": {BatchID: "a b", Votes: []ImportedVote{ok}},
+		"empty":        {BatchID: "x"},
+		"too many":     {BatchID: "x", Votes: []ImportedVote{{Profile: importProfile, Timestamp: ok.Timestamp, Count: maxImportVotes}, ok}},
+	} {
+		if _, err := bad.validate(now); err == nil { t.Errorf("%s: accepted", name) }
+	}
+}
+
+// A retry of the same batch must hash the same however the client wrote ids and zones.
+func TestVoteImportDigest(t *testing.T) {
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	a := VoteImport{BatchID: "x", Votes: []ImportedVote{{Profile: importProfile, Timestamp: at, Count: 1}}}
+	b := VoteImport{BatchID: "x", Votes: []ImportedVote{{Profile: strings.ToUpper(importProfile), Timestamp: at.In(time.FixedZone("", 7200)), Count: 1}}}
+	if a.digest() != b.digest() { t.Error("equivalent batches hash differently") }
+	b.Votes[0].Count = 2
+	if a.digest() == b.digest() { t.Error("different batches hash the same") }
+}
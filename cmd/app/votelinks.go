@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+	"github.com/doesnotcommit/bestfriends/internal/views"
+)
+
+// voteLinkStats counts issued links and what happened when they were used, so abuse (mass
+// forwarding, guessing, replays) shows up on /debug/vars under "vote_links".
+var voteLinkStats = expvar.NewMap("vote_links")
+
+const (
+	voteLinkDefaultTTL  = 7 * 24 * time.Hour
+	voteLinkMaxTTL      = 90 * 24 * time.Hour
+	voteLinkMaxPerBatch = 10000
+)
+
+type ErrorVoteLink string
+
+func (e ErrorVoteLink) Error() string { return string(e) }
+func (ErrorVoteLink) VoteLink()       {}
+
+const (
+	ErrVoteLinkInvalid ErrorVoteLink = "this vote link is not valid"
+	ErrVoteLinkExpired ErrorVoteLink = "this vote link has expired"
+	ErrVoteLinkUsed    ErrorVoteLink = "this vote link has already been used"
+)
+
+// voteLink is what a signed vote token carries: one vote for ProfileID by one newsletter
+// recipient (a keyed hash, so tokens don't leak addresses), usable once before Expires.
+type voteLink struct {
+	ProfileID string
+	Recipient string
+	Nonce     string
+	Expires   time.Time
+}
+
+// newVoteLink issues a link for recipient with a fresh random nonce.
+func (s *Server) newVoteLink(profileID, recipient string, ttl time.Duration) voteLink {
+	nonce := make([]byte, 12)
+	_, _ = rand.Read(nonce)
+	return voteLink{
+		ProfileID: profileID,
+		Recipient: s.recipientHash(recipient),
+		Nonce:     base64.RawURLEncoding.EncodeToString(nonce),
+		Expires:   time.Now().Add(ttl).Truncate(time.Second),
+	}
+}
+
+// token encodes l as "<profile>.<recipient>.<nonce>.<exp>.<sig>"; every part is URL-safe.
+func (s *Server) voteLinkToken(l voteLink) string {
+	payload := strings.Join([]string{l.ProfileID, l.Recipient, l.Nonce, strconv.FormatInt(l.Expires.Unix(), 10)}, ".")
+	return payload + "." + s.voteLinkSig(payload)
+}
+
+// parseVoteLinkToken verifies the signature and expiry of a token made by voteLinkToken.
+func (s *Server) parseVoteLinkToken(token string) (voteLink, error) {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 { return voteLink{}, ErrVoteLinkInvalid }
+	payload, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(s.voteLinkSig(payload))) { return voteLink{}, ErrVoteLinkInvalid }
+	parts := strings.Split(payload, ".")
+	if len(parts) != 4 { return voteLink{}, ErrVoteLinkInvalid }
+	exp, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil { return voteLink{}, ErrVoteLinkInvalid }
+	l := voteLink{ProfileID: parts[0], Recipient: parts[1], Nonce: parts[2], Expires: time.Unix(exp, 0)}
+	if time.Now().After(l.Expires) { return l, ErrVoteLinkExpired }
+	return l, nil
+}
+
+func (s *Server) voteLinkSig(payload string) string {
+	m := hmac.New(sha256.New, []byte(s.cfg.VoteLinkKey))
+	m.Write([]byte("vote-link\x00"))
+	m.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil)[:16])
+}
+
+func (s *Server) recipientHash(recipient string) string {
+	m := hmac.New(sha256.New, []byte(s.cfg.VoteLinkKey))
+	m.Write([]byte("recipient\x00"))
+	m.Write([]byte(strings.ToLower(strings.TrimSpace(recipient))))
+	return hex.EncodeToString(m.Sum(nil)[:8])
+}
+
+// handleVoteLink serves /vote?t=<token>. GET only shows a confirmation page: mail scanners
+// and link previews fetch URLs from newsletters, and must not spend the vote. The form then
+// POSTs the token back to record it.
+func (s *Server) handleVoteLink(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.VoteLinkKey == "" {
+		http.NotFound(w, r)
+		return
+	}
+	token := r.URL.Query().Get("t")
+	if r.Method == http.MethodPost { token = r.PostFormValue("t") }
+	view := views.VoteLinkView{Token: token}
+	l, err := s.parseVoteLinkToken(token)
+	if err == nil {
+		var status string
+		err = s.db.QueryRowContext(r.Context(), `SELECT p.full_name, `+profileLocationCols+`, p.status FROM profiles p `+profileLocationJoin+` WHERE p.id = $1`,
+			l.ProfileID).Scan(&view.FullName, &view.Country, &view.City, &status)
+		if errors.Is(err, sql.ErrNoRows) { err = ErrNotFound }
+		if err == nil && status != statusActive { err = ErrRetired }
+	}
+	if err == nil {
+		if r.Method == http.MethodGet {
+			err = s.checkVoteLinkUnused(r.Context(), l)
+		} else {
+			err = s.redeemVoteLink(r.Context(), l)
+		}
+	}
+	switch {
+	case err == nil && r.Method == http.MethodGet:
+		view.State = "confirm"
+		view.Expires = l.Expires
+		s.render(w, "vote_link.gohtml", view)
+	case err == nil:
+		voteLinkStats.Add("redeemed", 1)
+		s.voteAttributed(r, l.ProfileID)
+		view.State = "done"
+		s.render(w, "vote_link.gohtml", view)
+	case errors.As(err, new(interface{ ReadOnly() })):
+		writeReadOnly(w, r)
+	default:
+		view.State = "error"
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrVoteLinkExpired):
+			voteLinkStats.Add("expired", 1)
+			status = http.StatusGone
+		case errors.Is(err, ErrVoteLinkUsed):
+			voteLinkStats.Add("reused", 1)
+			status = http.StatusConflict
+		case errors.Is(err, ErrVoteLinkInvalid):
+			voteLinkStats.Add("invalid", 1)
+		case errors.As(err, new(interface{ NotFound() })):
+			err, status = ErrorVoteLink("this exhibit no longer exists"), http.StatusNotFound
+		case errors.As(err, new(interface{ Retired() })):
+			status = http.StatusConflict
+		default:
+			s.log.Error("vote link", "err", err)
+			err, status = ErrorVoteLink("something went wrong, please try again later"), http.StatusInternalServerError
+		}
+		view.Message = err.Error()
+		s.renderStatus(w, status, "vote_link.gohtml", view)
+	}
+}
+
+func (s *Server) checkVoteLinkUnused(ctx context.Context, l voteLink) error {
+	var used bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM vote_link_uses WHERE nonce = $1)`, l.Nonce).Scan(&used); err != nil { return err }
+	if used { return ErrVoteLinkUsed }
+	return nil
+}
+
+// redeemVoteLink spends the link and records its vote. The link itself is the rate limit:
+// the vote is cast by the zero voter, so no cooldown applies to it or starts with it. It
+// still counts towards the profile's vote_profile_cap for everyone else.
+func (s *Server) redeemVoteLink(ctx context.Context, l voteLink) error {
+	if err := s.writable(); err != nil { return err }
+	err := withTx(ctx, s.db, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO vote_link_uses (nonce, profile_id, recipient, expires_at) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (nonce) DO NOTHING
+		`, l.Nonce, l.ProfileID, l.Recipient, l.Expires)
+		if err != nil { return err }
+		if n, err := res.RowsAffected(); err != nil { return err } else if n == 0 { return ErrVoteLinkUsed }
+		return s.recordVote(store.WithTx(ctx, tx), l.ProfileID, "", voter{})
+	})
+	if err == nil { s.voteRecorded(ctx) }
+	return err
+}
+
+// APIVoteLink is one issued link in the admin API response.
+type APIVoteLink struct {
+	Recipient string    `json:"recipient"`
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleAPIAdminVoteLinks issues links: POST {"profile_id", "recipients": [...], "ttl": "168h"}.
+// URLs are absolute when LEADERBOARD_PUBLIC_URL is set, otherwise paths.
+func (s *Server) handleAPIAdminVoteLinks(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.VoteLinkKey == "" {
+		writeJSONError(w, http.StatusNotFound, "vote links are not enabled (LEADERBOARD_VOTE_LINK_KEY)")
+		return
+	}
+	var req struct {
+		ProfileID  string   `json:"profile_id"`
+		Recipients []string `json:"recipients"`
+		TTL        string   `json:"ttl"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<20)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "bad json")
+		return
+	}
+	ttl := voteLinkDefaultTTL
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d <= 0 || d > voteLinkMaxTTL {
+			writeJSONError(w, http.StatusBadRequest, "ttl must be a duration up to 2160h")
+			return
+		}
+		ttl = d
+	}
+	if len(req.Recipients) == 0 || len(req.Recipients) > voteLinkMaxPerBatch {
+		writeJSONError(w, http.StatusBadRequest, "recipients must list 1 to 10000 addresses")
+		return
+	}
+	var exists bool
+	if err := s.db.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM profiles WHERE id = $1)`, req.ProfileID).Scan(&exists); err != nil || !exists {
+		writeJSONError(w, http.StatusNotFound, "unknown profile id")
+		return
+	}
+
+	links := make([]APIVoteLink, 0, len(req.Recipients))
+	for _, rcpt := range req.Recipients {
+		l := s.newVoteLink(req.ProfileID, rcpt, ttl)
+		links = append(links, APIVoteLink{
+			Recipient: rcpt,
+			URL:       strings.TrimRight(s.cfg.PublicURL, "/") + "/vote?" + url.Values{"t": {s.voteLinkToken(l)}}.Encode(),
+			ExpiresAt: l.Expires,
+		})
+	}
+	voteLinkStats.Add("issued", int64(len(links)))
+	actor, _ := s.adminActor(r)
+	s.log.Info("vote links issued", "profile", req.ProfileID, "count", len(links), "ttl", ttl, "by", actor)
+	writeJSON(w, http.StatusOK, map[string]any{"links": links})
+}
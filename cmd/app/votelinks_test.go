@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVoteLinkToken(t *testing.T) {
+	s := &Server{cfg: Config{VoteLinkKey: "k"}}
+	l := s.newVoteLink("8b1b6e3c-0000-4000-8000-000000000001", "Ada@Example.com ", time.Hour)
+	token := s.voteLinkToken(l)
+
+	got, err := s.parseVoteLinkToken(token)
+	if err != nil {
+		t.Fatalf("fresh token rejected: %v", err)
+	}
+	if got != l {
+		t.Fatalf("parsed %+v, want %+v", got, l)
+	}
+	if l.Recipient != s.recipientHash("ada@example.com") || strings.Contains(token, "example") {
+		t.Fatalf("recipient not normalised and hashed: %q", l.Recipient)
+	}
+	if s.newVoteLink(l.ProfileID, "ada@example.com", time.Hour).Nonce == l.Nonce {
+		t.Fatal("nonce reused")
+	}
+
+	parts := strings.Split(token, ".")
+	tampered := []string{
+		strings.Replace(token, l.ProfileID, "8b1b6e3c-0000-4000-8000-000000000002", 1),
+		strings.Join(append(parts[:3:3], "9999999999", parts[4]), "."),
+		token[:len(token)-1],
+		"",
+		"no-dots",
+	}
+	for _, tok := range tampered {
+		if _, err := s.parseVoteLinkToken(tok); !errors.Is(err, ErrVoteLinkInvalid) {
+			t.Errorf("parseVoteLinkToken(%q) = %v, want invalid", tok, err)
+		}
+	}
+	other := &Server{cfg: Config{VoteLinkKey: "other"}}
+	if _, err := other.parseVoteLinkToken(token); !errors.Is(err, ErrVoteLinkInvalid) {
+		t.Errorf("token accepted under another key: %v", err)
+	}
+
+	expired := s.voteLinkToken(s.newVoteLink(l.ProfileID, "ada@example.com", -time.Minute))
+	if _, err := s.parseVoteLinkToken(expired); !errors.Is(err, ErrVoteLinkExpired) {
+		t.Errorf("expired token: %v, want expired", err)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Votes are limited per voter: a voter votes for each profile at most once per vote cooldown.
+// A browser is its voter cookie, issued by the pages with vote forms and signed so ids can't
+// be made up; a client without one (API clients, cookies off) is a fingerprint of its client
+// IP and User-Agent, keyed and rotated like visitor ids (see visitor.go). Clearing cookies
+// makes a new voter, so the vote_profile_cap setting still bounds the votes one profile takes
+// per cooldown from everyone together. Voters are kept in the voters table: fingerprints
+// until their key retires, cookies until they haven't voted for voterRetention. A vote kiosk's
+// session is a voter of its own, "kiosk.<id>", with a limit of its own (see kiosk.go), kept
+// like a cookie; its votes keep it for good, for the session's counts.
+
+const (
+	voterCookie       = "voter"
+	voterCookieMaxAge = 365 * 24 * time.Hour
+	voterRetention    = 90 * 24 * time.Hour
+)
+
+const ErrVotedRecently ErrorRateLimited = "you already voted for this exhibit recently"
+
+// voterKiosk is the kind of a kiosk session's voter (see kiosk.go).
+const voterKiosk = "kiosk"
+
+// voter is who casts a vote. The zero voter stands for votes nobody cast directly (vote
+// links, imports, released quarantined votes), which no per-voter limit applies to.
+type voter struct {
+	kind   string   // "cookie", "fingerprint" or voterKiosk
+	ids    []string // the voter's ids, current first; a fingerprint has one per live key
+	issued bool     // the cookie was issued by this response, so it has no votes yet
+}
+
+// id is what votes.voter records for v's votes.
+func (v voter) id() string {
+	if len(v.ids) == 0 { return "" }
+	return v.ids[0]
+}
+
+// voterSig signs a voter cookie's id with a key derived from the visitor key.
+func (k visitorKeys) voterSig(id string) string {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte("voter-cookie\x00"))
+	mac = hmac.New(sha256.New, mac.Sum(nil))
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// cookieVoter is the voter of r's voter cookie, if it carries a valid one.
+func (s *Server) cookieVoter(r *http.Request) (voter, bool) {
+	c, err := r.Cookie(voterCookie)
+	if err != nil { return voter{}, false }
+	id, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !validVoteToken(id) || !hmac.Equal([]byte(sig), []byte(s.visitorKeys.voterSig(id))) { return voter{}, false }
+	return voter{kind: "cookie", ids: []string{"cookie." + id}}, true
+}
+
+// voterOf identifies who casts r's vote: its voter cookie, else its fingerprint.
+func (s *Server) voterOf(r *http.Request) voter {
+	if v, ok := s.cookieVoter(r); ok { return v }
+	return voter{kind: "fingerprint", ids: s.visitorKeys.ids(s.clientIP(r)+"\x00"+r.UserAgent(), time.Now())}
+}
+
+// issueVoter is voterOf for pages with vote forms, which give a browser without a valid
+// voter cookie a new one, so its votes count per browser from then on.
+func (s *Server) issueVoter(w http.ResponseWriter, r *http.Request) voter {
+	if v, ok := s.cookieVoter(r); ok { return v }
+	id := newVoteToken()
+	http.SetCookie(w, &http.Cookie{Name: voterCookie, Value: id + "." + s.visitorKeys.voterSig(id), Path: "/",
+		MaxAge: int(voterCookieMaxAge / time.Second), HttpOnly: true, Secure: s.secureCookies(r), SameSite: http.SameSiteLaxMode})
+	return voter{kind: "cookie", ids: []string{"cookie." + id}, issued: true}
+}
+
+// checkVoteLimits fails with ErrVotedRecently when v voted for profile id within the vote
+// cooldown, and with ErrRateLimited when the profile took vote_profile_cap votes in it. A
+// kiosk is many voters in turn, so it fails with ErrKioskBusy instead when it took any vote
+// within kioskVoteGap. ctx carries the vote's transaction.
+func (s *Server) checkVoteLimits(ctx context.Context, id string, v voter) error {
+	limit := s.settings.GetInt(settingVoteCap)
+	if v.kind == voterKiosk {
+		rv, err := s.store.RecentVotes(ctx, "", v.ids, kioskVoteGap, 0)
+		if err != nil { return err }
+		if rv.Last != nil { return ErrKioskBusy }
+	}
+	rv, err := s.store.RecentVotes(ctx, id, v.ids, s.settings.GetDuration(settingVoteCooldown), limit)
+	switch {
+	case err != nil:
+		return err
+	case rv.Last != nil && v.kind != voterKiosk:
+		return ErrVotedRecently
+	case limit > 0 && rv.Count >= limit:
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// votedRecently returns the profiles v voted for within the vote cooldown, so pages can show
+// their vote buttons disabled to v.
+func (s *Server) votedRecently(ctx context.Context, v voter) (map[string]bool, error) {
+	if v.issued || len(v.ids) == 0 { return nil, nil }
+	return s.store.VotedProfiles(ctx, v.ids, s.settings.GetDuration(settingVoteCooldown))
+}
+
+// pruneVoters forgets cookie and kiosk voters that haven't voted for voterRetention; a
+// returning cookie is recorded afresh with its next vote. Fingerprints go with their key (see
+// retireVisitorKeys).
+func (s *Server) pruneVoters(ctx context.Context) (int64, error) {
+	var total int64
+	for _, kind := range []string{"cookie", voterKiosk} {
+		n, err := s.store.PruneVoters(ctx, kind, voterRetention, retentionBatchSize)
+		total += n
+		if err != nil { return total, err }
+	}
+	return total, nil
+}
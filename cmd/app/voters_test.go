@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVoterCookie(t *testing.T) {
+	s := &Server{visitorKeys: newVisitorKeys("secret", 6*time.Hour)}
+	request := func(ua string, cookies ...*http.Cookie) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/profiles/p1/vote", nil)
+		r.RemoteAddr, r.Header["User-Agent"] = "203.0.113.7:1234", []string{ua}
+		for _, c := range cookies { r.AddCookie(c) }
+		return r
+	}
+
+	// Without a cookie the voter is a fingerprint, which tells browsers on one IP apart.
+	fp := s.voterOf(request("Firefox"))
+	if fp.kind != "fingerprint" || len(fp.ids) != 5 || strings.Contains(fp.id(), "203.0.113.7") {
+		t.Fatalf("voter without cookie = %+v", fp)
+	}
+	if s.voterOf(request("Chrome")).id() == fp.id() { t.Error("fingerprint ignores the User-Agent") }
+
+	// A page with vote forms issues a cookie, which identifies the browser from then on.
+	w := httptest.NewRecorder()
+	issued := s.issueVoter(w, request("Firefox"))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != voterCookie || !cookies[0].HttpOnly || !issued.issued {
+		t.Fatalf("issued %+v with cookies %v", issued, cookies)
+	}
+	if v := s.voterOf(request("Chrome", cookies[0])); v.kind != "cookie" || v.id() != issued.id() || v.issued {
+		t.Errorf("voter with cookie = %+v, want %+v", v, issued)
+	}
+	w = httptest.NewRecorder()
+	if v := s.issueVoter(w, request("Firefox", cookies[0])); v.id() != issued.id() || len(w.Result().Cookies()) != 0 {
+		t.Errorf("a valid cookie was replaced: %+v", v)
+	}
+
+	// Made-up or tampered cookies fall back to the fingerprint.
+	id, sig, _ := strings.Cut(cookies[0].Value, ".")
+	for _, value := range []string{newVoteToken() + "." + sig, id + ".00", id, "cookie." + id} {
+		if v := s.voterOf(request("Firefox", &http.Cookie{Name: voterCookie, Value: value})); v.id() != fp.id() {
+			t.Errorf("cookie %q accepted as %+v", value, v)
+		}
+	}
+	if other := (&Server{visitorKeys: newVisitorKeys("other", 6*time.Hour)}); other.voterOf(request("Firefox", cookies[0])).kind != "fingerprint" {
+		t.Error("cookie accepted under another key")
+	}
+
+	if (voter{}).id() != "" { t.Error("the zero voter has an id") }
+}
+
+// Cookie and kiosk voters are forgotten after voterRetention without a vote; fingerprints go
+// with their key instead.
+func TestPruneVoters(t *testing.T) {
+	s, mem := newVoteServer(t)
+	now := time.Now()
+	mem.SetClock(func() time.Time { return now })
+	ctx := context.Background()
+	for _, v := range []voter{{kind: "cookie", ids: []string{"cookie.a"}}, {kind: voterKiosk, ids: []string{"kiosk.k1"}}, {kind: "fingerprint", ids: []string{"1.f"}}} {
+		if err := s.castVote(ctx, "p1", "", v); err != nil { t.Fatal(err) }
+	}
+	now = now.Add(voterRetention - time.Minute)
+	if n, err := s.pruneVoters(ctx); err != nil || n != 0 { t.Fatalf("pruneVoters within the retention = %d, %v", n, err) }
+	now = now.Add(2 * time.Minute)
+	if n, err := s.pruneVoters(ctx); err != nil || n != 2 { t.Errorf("pruneVoters = %d, %v; want the cookie and the kiosk", n, err) }
+}
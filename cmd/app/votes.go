@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// Every vote is a row in votes (migrations/033), kept for good: the cooldown and the
+// vote_profile_cap are index lookups on it, trends and trending sections count it, and
+// profiles.votes_count is its maintained counter (see votebuffer.go). It replaced
+// votes_recent, the live cooldown window, and votes_history, where the vote retention job
+// moved older rows. For the transition LEADERBOARD_VOTES_DUAL_WRITE (on by default) keeps
+// writing those as before, so rolling back to the previous build (033's down migration drops
+// votes) loses nothing; with it off they are only drained, for a later migration to drop.
+// While the previous build still runs somewhere its votes reach the legacy tables only: the
+// vote flusher takes over the uncounted ones, and app copy-legacy-votes copies the rest once
+// the rollout is over. Live votes go through the store (store.Postgres.InsertVote).
+
+// insertPastVotes writes counted votes nobody cast here (imports, seeding): rows selects their
+// id, profile_id and created_at. While dual-writing votes_history gets them too.
+func (s *Server) insertPastVotes(ctx context.Context, tx *sql.Tx, rows string, args ...any) error {
+	q := `INSERT INTO votes (id, profile_id, created_at) ` + rows
+	if s.cfg.VotesDualWrite {
+		q = `WITH v AS (` + q + ` RETURNING id, profile_id, created_at)
+			INSERT INTO votes_history (id, profile_id, created_at) SELECT id, profile_id, created_at FROM v`
+	}
+	_, err := tx.ExecContext(ctx, q, args...)
+	return err
+}
+
+// cmdCopyLegacyVotes copies the votes that instances of the previous build wrote to the legacy
+// tables only into votes: app copy-legacy-votes, once the rollout of 033 is over.
+func cmdCopyLegacyVotes(ctx context.Context, logger *slog.Logger, cfg Config, args []string) error {
+	fs := newFlagSet("copy-legacy-votes", "[-batch 1000]")
+	batch := fs.Int("batch", 1000, "legacy rows read per statement")
+	if err := fs.Parse(args); err != nil { return err }
+	if *batch < 1 { return fmt.Errorf("-batch must be at least 1") }
+	s, err := openServer(ctx, logger, cfg)
+	if err != nil { return err }
+	defer s.db.Close()
+	if err := s.writable(); err != nil { return err }
+	return s.copyLegacyVotes(ctx, *batch)
+}
+
+// copyLegacyVotes is migration 033's copy again. The migration runs before the rollout, so
+// votes that instances of the previous build cast or moved after it are in votes_recent or
+// votes_history only. It reads batch rows at a time in id order and can be stopped and rerun
+// at any point: rows already in votes are skipped. Uncounted votes_recent rows are left to
+// the vote flusher, which copies them as it counts them (flushVotesTx).
+func (s *Server) copyLegacyVotes(ctx context.Context, batch int) error {
+	for _, table := range []struct{ name, cols, where string }{
+		{"votes_history", "id, profile_id, created_at", "true"},
+		{"votes_recent", "id, profile_id, voter, counted, created_at", "counted"},
+	} {
+		after, copied := "00000000-0000-0000-0000-000000000000", 0
+		for {
+			if err := s.writable(); err != nil { return err }
+			var last string
+			var n int
+			err := s.db.QueryRowContext(ctx, `
+				WITH b AS (
+					SELECT `+table.cols+` FROM `+table.name+` WHERE `+table.where+` AND id > $1::UUID ORDER BY id LIMIT $2
+				), copied AS (
+					INSERT INTO votes (`+table.cols+`) SELECT `+table.cols+` FROM b ON CONFLICT (id) DO NOTHING RETURNING 1
+				)
+				SELECT COALESCE((SELECT id::string FROM b ORDER BY id DESC LIMIT 1), ''), (SELECT count(*) FROM copied)
+			`, after, batch).Scan(&last, &n)
+			if err != nil { return err }
+			copied += n
+			if last == "" { break }
+			after = last
+		}
+		s.log.Info("copied legacy votes", "table", table.name, "copied", copied)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// newVoteServer is a server over a Memory store holding an active, a retired and a held profile.
+func newVoteServer(t *testing.T) (*Server, *store.Memory) {
+	t.Helper()
+	mem := store.NewMemory()
+	mem.Put(Profile{ID: "p1", FullName: "Rex"}, "", nil, "")
+	mem.Put(Profile{ID: "p2", FullName: "Bo"}, store.StatusRetired, nil, "")
+	mem.Put(Profile{ID: "p3", FullName: "Kit"}, store.StatusHeld, nil, "")
+	return &Server{store: mem, visitorKeys: newVisitorKeys("secret", 6*time.Hour), log: slog.New(slog.NewTextHandler(io.Discard, nil))}, mem
+}
+
+func votesOf(t *testing.T, mem *store.Memory, id string) int {
+	t.Helper()
+	list, err := mem.ListProfiles(context.Background(), store.Filter{ID: id, Limit: 1})
+	if err != nil || len(list) != 1 { t.Fatalf("profile %s: %v %v", id, list, err) }
+	return list[0].Votes
+}
+
+func TestHandleVote(t *testing.T) {
+	s, mem := newVoteServer(t)
+	vote := func(id, ua, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/profiles/"+id+"/vote", strings.NewReader(url.Values{"vote_token": {token}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr, r.Header["User-Agent"] = "203.0.113.7:1234", []string{ua}
+		r.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		s.handleVote(w, r)
+		return w
+	}
+
+	token := newVoteToken()
+	if w := vote("p1", "Firefox", token); w.Code != http.StatusSeeOther || w.Header().Get("Location") != voteReceiptURL("p1") {
+		t.Fatalf("vote = %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if n := votesOf(t, mem, "p1"); n != 1 { t.Errorf("votes after a vote = %d", n) }
+
+	// A resubmitted form is answered like the first submission, and not counted again.
+	if w := vote("p1", "Chrome", token); w.Code != http.StatusSeeOther { t.Errorf("resubmitted form = %d", w.Code) }
+	// The same voter waits for the cooldown.
+	if w := vote("p1", "Firefox", ""); w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "already voted") {
+		t.Errorf("second vote = %d %q", w.Code, w.Body)
+	}
+	if n := votesOf(t, mem, "p1"); n != 1 { t.Errorf("votes after a resubmission and a second vote = %d", n) }
+
+	// Another voter votes; then the profile's cap is reached for everyone.
+	s.settings.rows.Store(&map[string]storedSetting{settingVoteCap.key: {value: 2}})
+	if w := vote("p1", "Chrome", ""); w.Code != http.StatusSeeOther { t.Errorf("other voter = %d", w.Code) }
+	if w := vote("p1", "Safari", ""); w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "Too many votes") {
+		t.Errorf("vote over the cap = %d %q", w.Code, w.Body)
+	}
+	if n := votesOf(t, mem, "p1"); n != 2 { t.Errorf("votes = %d, want 2", n) }
+
+	for _, tt := range []struct {
+		id     string
+		status int
+	}{{"p2", http.StatusConflict}, {"p3", http.StatusNotFound}, {"nope", http.StatusNotFound}} {
+		if w := vote(tt.id, "Firefox", ""); w.Code != tt.status { t.Errorf("vote for %s = %d, want %d", tt.id, w.Code, tt.status) }
+	}
+	if n := votesOf(t, mem, "p2"); n != 0 { t.Errorf("retired profile took %d votes", n) }
+}
+
+func TestHandleAPIVote(t *testing.T) {
+	s, mem := newVoteServer(t)
+	vote := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/profiles/"+id+"/vote", nil)
+		r.RemoteAddr = "203.0.113.7:1234"
+		r.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		s.handleAPIVote(w, r)
+		return w
+	}
+	w := vote("p1")
+	if w.Code != http.StatusNoContent || w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Fatalf("vote = %d %v", w.Code, w.Header())
+	}
+	if w := vote("p1"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" { t.Errorf("second vote = %d %v", w.Code, w.Header()) }
+	if n := votesOf(t, mem, "p1"); n != 1 { t.Errorf("votes = %d", n) }
+	if w := vote("p2"); w.Code != http.StatusConflict { t.Errorf("retired = %d", w.Code) }
+}
+
+// With a vote buffer, a vote is an uncounted row until the flush, which castVote waits for.
+func TestCastVoteBuffered(t *testing.T) {
+	s, mem := newVoteServer(t)
+	s.votes = newVoteBuffer(time.Hour, 1, s.flushVotes)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.votes.run(ctx, func(err error) { t.Error(err) })
+
+	if err := s.castVote(ctx, "p1", "", voter{kind: "cookie", ids: []string{"cookie.a"}}); err != nil { t.Fatal(err) }
+	if n := votesOf(t, mem, "p1"); n != 1 { t.Errorf("votes after the flush = %d", n) }
+	if err := s.castVote(ctx, "p1", "", voter{kind: "cookie", ids: []string{"cookie.a"}}); !errors.Is(err, ErrVotedRecently) { t.Errorf("second vote = %v", err) }
+	// The zero voter (vote links, released votes) has no cooldown.
+	for range 2 {
+		if err := s.castVote(ctx, "p1", "", voter{}); err != nil { t.Fatal(err) }
+	}
+	if n := votesOf(t, mem, "p1"); n != 3 { t.Errorf("votes = %d, want 3", n) }
+}
+
+// A kiosk is many voters in turn: it may vote for a profile again, but not twice within kioskVoteGap.
+func TestCastVoteKiosk(t *testing.T) {
+	s, mem := newVoteServer(t)
+	mem.Put(Profile{ID: "p4", FullName: "Ash"}, "", nil, "")
+	k := kioskSession{ID: "3f2a9c1e-0000-4000-8000-000000000001"}.voter()
+	ctx := context.Background()
+	if err := s.castVote(ctx, "p1", "", k); err != nil { t.Fatal(err) }
+	if err := s.castVote(ctx, "p4", "", k); !errors.Is(err, ErrKioskBusy) { t.Errorf("vote within the gap = %v", err) }
+	voted, err := s.votedRecently(ctx, k)
+	if err != nil || !voted["p1"] || voted["p4"] { t.Errorf("votedRecently = %v %v", voted, err) }
+}
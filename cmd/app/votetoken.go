@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Vote forms carry a one-time token so a resubmitted POST (a refresh or back button before
+// the redirect landed) isn't counted twice. The token becomes the vote's id in votes, so a used
+// token is found there for good.
+// Tokens are not secret and don't limit anything: a form without one votes as before.
+
+type ErrorDuplicateVote string
+
+func (e ErrorDuplicateVote) Error() string { return string(e) }
+func (ErrorDuplicateVote) DuplicateVote()  {}
+
+const ErrDuplicateVote ErrorDuplicateVote = "this vote was already counted"
+
+// newVoteToken returns a random (version 4) UUID.
+func newVoteToken() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// validVoteToken reports whether t is a UUID in the canonical form newVoteToken produces;
+// anything else is ignored rather than passed to the database.
+func validVoteToken(t string) bool {
+	if len(t) != 36 { return false }
+	for i := 0; i < len(t); i++ {
+		c := t[i]
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' { return false }
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f':
+		default:
+			return false
+		}
+	}
+	return true
+}
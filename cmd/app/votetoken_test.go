@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestVoteToken(t *testing.T) {
+	a, b := newVoteToken(), newVoteToken()
+	if a == b {
+		t.Fatal("tokens repeat")
+	}
+	if !validVoteToken(a) || a[14] != '4' {
+		t.Fatalf("newVoteToken() = %q, want a version 4 UUID", a)
+	}
+	for _, tok := range []string{"", "not-a-token", "7C9E6679-7425-40DE-944B-E07FC1F90AE7", "7c9e6679x7425-40de-944b-e07fc1f90ae7",
+		"7c9e6679-7425-40de-944b-e07fc1f90ae", "7c9e6679-7425-40de-944b-e07fc1f90ae7'"} {
+		if validVoteToken(tok) {
+			t.Errorf("validVoteToken(%q) = true", tok)
+		}
+	}
+}
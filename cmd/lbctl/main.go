@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: lbctl <command> [flags]
+
+Commands:
+  list [-alumni]            list profiles in leaderboard order, or the retired ones
+  search <query>            list profiles matching a substring
+  create -name N -country C -city C [-description D] -photo FILE -photo-alt A
+                            create a profile from a local JPEG/PNG
+  vote <id>                 cast a vote for a profile
+  reset-votes -from T -to T [-reason R] [-yes]
+                            archive votes cast in [from, to); previews unless -yes
+  import-votes -batch ID [-source S] < votes.csv
+                            import historical votes (CSV header: profile,timestamp[,count]); a batch id
+                            is applied once, so rerunning after a failure is safe
+  pins [-clear] [id ...]    list pinned profiles, or replace them with ids in order
+  cities [-country C] [query]
+                            list cities with profile counts, to spot misspelled variants
+  merge-cities -into ID ID...
+                            fold the listed cities into one, moving their profiles
+  vote-links -profile ID [-ttl 168h] < recipients.txt
+                            issue signed single-use vote links, one recipient per input line; prints CSV
+  retire <id>               move a profile to the alumni section; it stops taking votes
+  reinstate <id>            put a retired profile back on the leaderboard
+  held                      list submissions held for moderation
+  approve <id>              publish a held submission
+  reject <id>               discard a held submission (deletes it)
+  read-only [on|off]        show or switch maintenance mode on the instance behind the URL
+
+Env:
+  LEADERBOARD_API_URL       server base URL (default http://localhost:8080)
+  LEADERBOARD_API_TOKEN     admin token, sent as a bearer token (needed for reset-votes, import-votes, pins, cities,
+                            merge-cities, vote-links, retire, reinstate, held, approve, reject and read-only)
+`
+
+type client struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	c := &client{
+		base:  strings.TrimRight(getenv("LEADERBOARD_API_URL", "http://localhost:8080"), "/"),
+		token: os.Getenv("LEADERBOARD_API_TOKEN"),
+		http:  &http.Client{Timeout: 30 * time.Second},
+	}
+	if err := run(c, os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "lbctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		return c.list("", args)
+	case "search":
+		if len(args) < 1 { return errors.New("search needs a query") }
+		return c.list(args[0], args[1:])
+	case "create":
+		return c.create(args)
+	case "vote":
+		if len(args) != 1 { return errors.New("vote needs a profile id") }
+		return c.vote(args[0])
+	case "reset-votes":
+		return c.resetVotes(args)
+	case "import-votes":
+		return c.importVotes(args)
+	case "pins":
+		return c.pins(args)
+	case "cities":
+		return c.cities(args)
+	case "merge-cities":
+		return c.mergeCities(args)
+	case "vote-links":
+		return c.voteLinks(args)
+	case "retire", "reinstate", "approve":
+		if len(args) != 1 { return fmt.Errorf("%s needs a profile id", cmd) }
+		status := "active"
+		if cmd == "retire" { status = "retired" }
+		return c.setStatus(args[0], status, cmd)
+	case "held":
+		return c.held()
+	case "reject":
+		if len(args) != 1 { return errors.New("reject needs a profile id") }
+		if err := c.do(http.MethodDelete, "/api/v1/admin/moderation/held/"+url.PathEscape(args[0]), nil, "", nil); err != nil { return err }
+		fmt.Printf("rejected %s\n", args[0])
+		return nil
+	case "read-only":
+		return c.readOnly(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+type profile struct {
+	ID          string    `json:"id"`
+	FullName    string    `json:"full_name"`
+	Country     string    `json:"country"`
+	City        string    `json:"city"`
+	Description string    `json:"description"`
+	Votes       int       `json:"votes"`
+	RateLimited bool      `json:"rate_limited"`
+	Pinned      bool      `json:"pinned"`
+	Retired     bool      `json:"retired"`
+	FinalRank   int       `json:"final_rank"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (c *client) list(q string, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	limit := fs.Int("limit", 50, "max profiles to list")
+	asJSON := fs.Bool("json", false, "print raw JSON")
+	alumni := fs.Bool("alumni", false, "list retired profiles")
+	if err := fs.Parse(args); err != nil { return err }
+
+	v := url.Values{"limit": {fmt.Sprint(*limit)}}
+	if q != "" { v.Set("q", q) }
+	if *alumni { v.Set("status", "retired") }
+	var out struct {
+		Profiles []profile `json:"profiles"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/profiles?"+v.Encode(), nil, "", &out); err != nil { return err }
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out.Profiles)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VOTES\tID\tNAME\tLOCATION\tCOOLDOWN")
+	for _, p := range out.Profiles {
+		cooldown := ""
+		if p.RateLimited { cooldown = "yes" }
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s, %s\t%s\n", p.Votes, p.ID, p.FullName, p.Country, p.City, cooldown)
+	}
+	return tw.Flush()
+}
+
+// create posts the add page's multipart form to the profile creation API.
+func (c *client) create(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	name := fs.String("name", "", "full name")
+	country := fs.String("country", "", "country")
+	city := fs.String("city", "", "city")
+	desc := fs.String("description", "", "description (max 160 bytes)")
+	photo := fs.String("photo", "", "path to a JPEG or PNG (max 1MB)")
+	photoAlt := fs.String("photo-alt", "", "the photo described for people who can't see it (max 250 characters)")
+	photoOK := fs.Bool("photo-ok", false, "keep the photo despite quality warnings")
+	if err := fs.Parse(args); err != nil { return err }
+	if *name == "" || *country == "" || *city == "" || *photo == "" || *photoAlt == "" {
+		return errors.New("create needs -name, -country, -city, -photo and -photo-alt")
+	}
+	img, err := os.ReadFile(*photo)
+	if err != nil { return err }
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range map[string]string{"full_name": *name, "country": *country, "city": *city, "description": *desc, "photo_alt": *photoAlt} {
+		if err := mw.WriteField(k, v); err != nil { return err }
+	}
+	if *photoOK {
+		if err := mw.WriteField("photo_ok", "1"); err != nil { return err }
+	}
+	fw, err := mw.CreateFormFile("photo", filepath.Base(*photo))
+	if err != nil { return err }
+	if _, err := fw.Write(img); err != nil { return err }
+	if err := mw.Close(); err != nil { return err }
+
+	var res struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/profiles", &body, mw.FormDataContentType(), &res); err != nil { return err }
+	fmt.Println(res.Status, res.ID)
+	return nil
+}
+
+func (c *client) vote(id string) error {
+	if err := c.do(http.MethodPost, "/api/v1/profiles/"+url.PathEscape(id)+"/vote", nil, "", nil); err != nil { return err }
+	fmt.Println("voted")
+	return nil
+}
+
+func (c *client) resetVotes(args []string) error {
+	fs := flag.NewFlagSet("reset-votes", flag.ContinueOnError)
+	from := fs.String("from", "", "window start (RFC3339 or YYYY-MM-DD, UTC)")
+	to := fs.String("to", "", "window end, exclusive (RFC3339 or YYYY-MM-DD, UTC)")
+	reason := fs.String("reason", "", "reason recorded in the audit trail")
+	yes := fs.Bool("yes", false, "apply the reset instead of previewing it")
+	if err := fs.Parse(args); err != nil { return err }
+	fromT, err := parseTime(*from)
+	if err != nil { return fmt.Errorf("-from: %w", err) }
+	toT, err := parseTime(*to)
+	if err != nil { return fmt.Errorf("-to: %w", err) }
+
+	req, _ := json.Marshal(map[string]any{"from": fromT, "to": toT, "reason": *reason, "confirm": *yes})
+	var res struct {
+		ID       string `json:"id"`
+		Votes    int    `json:"votes"`
+		Profiles int    `json:"profiles"`
+		Applied  bool   `json:"applied"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/admin/votes/reset", bytes.NewReader(req), "application/json", &res); err != nil { return err }
+	if res.Applied {
+		fmt.Printf("archived %d votes across %d profiles (reset %s)\n", res.Votes, res.Profiles, res.ID)
+	} else {
+		fmt.Printf("would archive %d votes across %d profiles; rerun with -yes to apply\n", res.Votes, res.Profiles)
+	}
+	return nil
+}
+
+// pins lists the pinned profiles, or replaces them when ids are given. The server keeps
+// the given order, so reordering means passing the full list again.
+func (c *client) pins(args []string) error {
+	fs := flag.NewFlagSet("pins", flag.ContinueOnError)
+	clear := fs.Bool("clear", false, "unpin every profile")
+	if err := fs.Parse(args); err != nil { return err }
+	ids := fs.Args()
+	if *clear && len(ids) > 0 { return errors.New("pins: -clear takes no ids") }
+
+	var out struct {
+		Pins []profile `json:"pins"`
+		Max  int       `json:"max"`
+	}
+	if *clear || len(ids) > 0 {
+		req, _ := json.Marshal(map[string]any{"profile_ids": append([]string{}, ids...)})
+		if err := c.do(http.MethodPut, "/api/v1/admin/pins", bytes.NewReader(req), "application/json", &out); err != nil { return err }
+	} else if err := c.do(http.MethodGet, "/api/v1/admin/pins", nil, "", &out); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "POS\tID\tNAME\tVOTES\t(%d of %d pinned)\n", len(out.Pins), out.Max)
+	for i, p := range out.Pins {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\n", i+1, p.ID, p.FullName, p.Votes)
+	}
+	return tw.Flush()
+}
+
+func (c *client) cities(args []string) error {
+	fs := flag.NewFlagSet("cities", flag.ContinueOnError)
+	country := fs.String("country", "", "only cities in this country")
+	if err := fs.Parse(args); err != nil { return err }
+	v := url.Values{"country": {*country}, "q": {strings.Join(fs.Args(), " ")}}
+	var out struct {
+		Cities []struct {
+			ID       string `json:"id"`
+			Name     string `json:"name"`
+			Country  string `json:"country"`
+			Profiles int    `json:"profiles"`
+		} `json:"cities"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/admin/cities?"+v.Encode(), nil, "", &out); err != nil { return err }
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COUNTRY\tCITY\tPROFILES\tID")
+	for _, ci := range out.Cities {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", ci.Country, ci.Name, ci.Profiles, ci.ID)
+	}
+	return tw.Flush()
+}
+
+func (c *client) mergeCities(args []string) error {
+	fs := flag.NewFlagSet("merge-cities", flag.ContinueOnError)
+	into := fs.String("into", "", "id of the city to keep")
+	if err := fs.Parse(args); err != nil { return err }
+	if *into == "" || fs.NArg() == 0 { return errors.New("merge-cities needs -into and at least one city id") }
+	req, _ := json.Marshal(map[string]any{"into": *into, "from": fs.Args()})
+	var out struct {
+		Merged   int `json:"merged"`
+		Profiles int `json:"profiles"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/admin/cities/merge", bytes.NewReader(req), "application/json", &out); err != nil { return err }
+	fmt.Printf("merged %d cities, moved %d profiles\n", out.Merged, out.Profiles)
+	return nil
+}
+
+// voteLinks reads recipients from stdin and prints "recipient,url" lines for a mail merge.
+// Relative URLs (server without LEADERBOARD_PUBLIC_URL) are resolved against the API URL.
+func (c *client) importVotes(args []string) error {
+	fs := flag.NewFlagSet("import-votes", flag.ContinueOnError)
+	batch := fs.String("batch", "", "batch id; the server applies each id once")
+	source := fs.String("source", "", "system the votes come from, recorded with the batch")
+	if err := fs.Parse(args); err != nil { return err }
+	if *batch == "" { return errors.New("import-votes needs -batch") }
+
+	q := url.Values{"batch_id": {*batch}, "source": {*source}}
+	var res struct {
+		Votes    int  `json:"votes"`
+		Profiles int  `json:"profiles"`
+		Replayed bool `json:"replayed"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/admin/votes:import?"+q.Encode(), os.Stdin, "text/csv", &res); err != nil { return err }
+	if res.Replayed {
+		fmt.Printf("batch %s was already imported: %d votes across %d profiles\n", *batch, res.Votes, res.Profiles)
+	} else {
+		fmt.Printf("imported %d votes across %d profiles (batch %s)\n", res.Votes, res.Profiles, *batch)
+	}
+	return nil
+}
+
+func (c *client) voteLinks(args []string) error {
+	fs := flag.NewFlagSet("vote-links", flag.ContinueOnError)
+	profileID := fs.String("profile", "", "profile id the links vote for")
+	ttl := fs.String("ttl", "168h", "how long the links stay valid")
+	if err := fs.Parse(args); err != nil { return err }
+	if *profileID == "" { return errors.New("vote-links needs -profile") }
+
+	in, err := io.ReadAll(os.Stdin)
+	if err != nil { return err }
+	var recipients []string
+	for _, line := range strings.Split(string(in), "\n") {
+		if line = strings.TrimSpace(line); line != "" { recipients = append(recipients, line) }
+	}
+	if len(recipients) == 0 { return errors.New("vote-links: no recipients on stdin") }
+
+	req, _ := json.Marshal(map[string]any{"profile_id": *profileID, "recipients": recipients, "ttl": *ttl})
+	var out struct {
+		Links []struct {
+			Recipient string `json:"recipient"`
+			URL       string `json:"url"`
+		} `json:"links"`
+	}
+	if err := c.do(http.MethodPost, "/api/v1/admin/vote-links", bytes.NewReader(req), "application/json", &out); err != nil { return err }
+	w := csv.NewWriter(os.Stdout)
+	for _, l := range out.Links {
+		u := l.URL
+		if strings.HasPrefix(u, "/") { u = c.base + u }
+		if err := w.Write([]string{l.Recipient, u}); err != nil { return err }
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// setStatus moves a profile to status for cmd: retire, reinstate, or approve (a held one).
+func (c *client) setStatus(id, status, cmd string) error {
+	req, _ := json.Marshal(map[string]string{"status": status})
+	var p profile
+	if err := c.do(http.MethodPut, "/api/v1/admin/profiles/"+url.PathEscape(id)+"/status", bytes.NewReader(req), "application/json", &p); err != nil { return err }
+	switch {
+	case p.Retired:
+		fmt.Printf("retired %s (%s) at rank #%d\n", p.FullName, p.ID, p.FinalRank)
+	case cmd == "approve":
+		fmt.Printf("approved %s (%s)\n", p.FullName, p.ID)
+	default:
+		fmt.Printf("reinstated %s (%s)\n", p.FullName, p.ID)
+	}
+	return nil
+}
+
+// held lists the submissions moderation holds for review, oldest first.
+func (c *client) held() error {
+	var out struct {
+		Profiles []profile `json:"profiles"`
+	}
+	if err := c.do(http.MethodGet, "/api/v1/admin/moderation/held", nil, "", &out); err != nil { return err }
+	slices.SortFunc(out.Profiles, func(a, b profile) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUBMITTED\tID\tNAME\tLOCATION\tDESCRIPTION")
+	for _, p := range out.Profiles {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s, %s\t%s\n", p.CreatedAt.Format(time.RFC3339), p.ID, p.FullName, p.Country, p.City, p.Description)
+	}
+	return tw.Flush()
+}
+
+func (c *client) readOnly(args []string) error {
+	var out struct {
+		ReadOnly       bool `json:"read_only"`
+		Maintenance    bool `json:"maintenance"`
+		SchemaMismatch bool `json:"schema_mismatch"`
+	}
+	switch {
+	case len(args) == 0:
+		if err := c.do(http.MethodGet, "/api/v1/admin/read-only", nil, "", &out); err != nil { return err }
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		req, _ := json.Marshal(map[string]bool{"read_only": args[0] == "on"})
+		if err := c.do(http.MethodPut, "/api/v1/admin/read-only", bytes.NewReader(req), "application/json", &out); err != nil { return err }
+	default:
+		return errors.New("read-only takes on, off or nothing")
+	}
+	fmt.Printf("read-only: %v (maintenance %v, schema mismatch %v)\n", out.ReadOnly, out.Maintenance, out.SchemaMismatch)
+	return nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil { return t.UTC(), nil }
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", v)
+}
+
+// do sends a request and decodes a JSON response into out (if non-nil). Redirects are not
+// followed: the HTML endpoints answer a successful POST with 303 See Other.
+func (c *client) do(method, path string, body io.Reader, contentType string, out any) error {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil { return err }
+	if contentType != "" { req.Header.Set("Content-Type", contentType) }
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" { req.Header.Set("Authorization", "Bearer "+c.token) }
+
+	hc := *c.http
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := hc.Do(req)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return apiError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent { return nil }
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func apiError(resp *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(b, &e) == nil && e.Error != "" {
+		return fmt.Errorf("%s: %s", resp.Status, e.Error)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+}
+
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" { return v }
+	return def
+}
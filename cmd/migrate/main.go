@@ -1,121 +1,67 @@
+// Command migrate applies, rolls back and lists the schema migrations:
+//
+//	migrate [up|down|status|dry-run|graph] [-to N] [-dry-run] [-parallel N]
+//
+// It is the same as `app migrate` and stays for deployments that run the migrator image.
 package main
 
 import (
 	"context"
 	"database/sql"
-	"errors"
+	"flag"
 	"fmt"
-	"io/fs"
 	"log/slog"
 	"os"
-	"path/filepath"
-	"sort"
 	"strings"
-	"time"
 
 	_ "github.com/lib/pq"
+
+	"github.com/doesnotcommit/bestfriends/internal/migrate"
+	"github.com/doesnotcommit/bestfriends/internal/schemadoc"
+	"github.com/doesnotcommit/bestfriends/migrations"
 )
 
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
-	if err := run(context.Background(), logger); err != nil {
+	if err := run(context.Background(), logger, os.Args[1:]); err != nil {
 		logger.Error("migrate failed", "err", err)
 		os.Exit(1)
 	}
 }
 
-func run(ctx context.Context, log *slog.Logger) error {
+func run(ctx context.Context, log *slog.Logger, args []string) error {
+	action := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") { action, args = args[0], args[1:] }
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	to := fs.Int("to", migrate.Latest, "target version: up applies through it, down rolls back everything above it (default: up all, down one)")
+	dryRun := fs.Bool("dry-run", false, "print the SQL up or down would run instead of running it")
+	parallel := fs.Int("parallel", 0, "apply up to N files marked \"-- migrate: parallel\" at once, each on its own connection (default: one file at a time)")
+	if err := fs.Parse(args); err != nil { return err }
+	if *to < migrate.Latest { return fmt.Errorf("-to must be a version number") }
+	if *parallel < 0 { return fmt.Errorf("-parallel must not be negative") }
+	// The migrations built in, unless LEADERBOARD_MIGRATIONS_DIR points at others.
+	source := migrations.Open(os.Getenv("LEADERBOARD_MIGRATIONS_DIR"))
+	if action == "graph" { return migrate.WriteGraph(os.Stdout, source) }
 	dsn := os.Getenv("LEADERBOARD_DB_URL")
 	if dsn == "" {
 		return fmt.Errorf("LEADERBOARD_DB_URL is required")
 	}
-	migrationsDir := os.Getenv("LEADERBOARD_MIGRATIONS_DIR")
-	if migrationsDir == "" {
-		migrationsDir = "migrations"
+	env := os.Getenv("LEADERBOARD_ENV")
+	if env == "" {
+		env = migrate.Production
 	}
 
 	db, err := sql.Open("postgres", dsn)
 	if err != nil { return fmt.Errorf("open db: %w", err) }
 	defer db.Close()
 	if err := db.PingContext(ctx); err != nil { return fmt.Errorf("ping db: %w", err) }
-
-	if err := ensureSchemaMigrations(ctx, db); err != nil { return fmt.Errorf("ensure schema_migrations: %w", err) }
-
-	files, err := readMigrationFiles(migrationsDir)
-	if err != nil { return fmt.Errorf("read migrations: %w", err) }
-
-	applied, err := getAppliedMigrations(ctx, db)
-	if err != nil { return fmt.Errorf("get applied: %w", err) }
-	for _, f := range files {
-		if applied[f] { continue }
-		log.Info("applying", "file", f)
-		sqlBytes, err := os.ReadFile(filepath.Join(migrationsDir, f))
-		if err != nil { return fmt.Errorf("read %s: %w", f, err) }
-		if err := applyMigration(ctx, db, f, string(sqlBytes)); err != nil {
-			return fmt.Errorf("apply %s: %w", f, err)
-		}
-		log.Info("applied", "file", f)
+	o := migrate.Options{Env: env, To: *to, DryRun: *dryRun, Parallel: *parallel}
+	if err := migrate.Do(ctx, log, db, source, action, o); err != nil { return err }
+	if *dryRun || action == "dry-run" || action == "status" { return nil }
+	// Keep a schema reference next to the deployment's docs in step with every run.
+	if doc := os.Getenv("LEADERBOARD_SCHEMA_DOC"); doc != "" {
+		if err := schemadoc.WriteFile(ctx, db, source, doc); err != nil { return fmt.Errorf("schema doc: %w", err) }
+		log.Info("schema doc written", "file", doc)
 	}
-	log.Info("done")
 	return nil
 }
-
-func ensureSchemaMigrations(ctx context.Context, db *sql.DB) error {
-	_, err := db.ExecContext(ctx, `
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			version STRING PRIMARY KEY,
-			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
-		);
-	`)
-	return err
-}
-
-func readMigrationFiles(dir string) ([]string, error) {
-	var files []string
-	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil { return err }
-		if d.IsDir() { return nil }
-		name := d.Name()
-		if strings.HasSuffix(strings.ToLower(name), ".sql") {
-			files = append(files, name)
-		}
-		return nil
-	})
-	if err != nil { return nil, err }
-	sort.Strings(files)
-	return files, nil
-}
-
-func getAppliedMigrations(ctx context.Context, db *sql.DB) (map[string]bool, error) {
-	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
-	if err != nil { return nil, err }
-	defer rows.Close()
-	m := make(map[string]bool)
-	for rows.Next() {
-		var v string
-		if err := rows.Scan(&v); err != nil { return nil, err }
-		m[v] = true
-	}
-	return m, rows.Err()
-}
-
-func applyMigration(ctx context.Context, db *sql.DB, version, sqlText string) error {
-	return withTx(ctx, db, func(tx *sql.Tx) error {
-		if _, err := tx.ExecContext(ctx, sqlText); err != nil { return err }
-		_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
-		return err
-	})
-}
-
-func withTx(ctx context.Context, db *sql.DB, fn func(*sql.Tx) error) error {
-	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
-	if err != nil { return err }
-	defer func() {
-		if p := recover(); p != nil { _ = tx.Rollback(); panic(p) }
-	}()
-	if err := fn(tx); err != nil {
-		_ = tx.Rollback()
-		return err
-	}
-	return tx.Commit()
-}
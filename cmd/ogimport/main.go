@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+	"github.com/doesnotcommit/bestfriends/internal/profile"
+)
+
+// The photo and description limits are the ones cmd/app enforces, so a draft can be
+// submitted as-is.
+const (
+	maxPageBytes     = 1 * 1024 * 1024 // 1MB of HTML is plenty to reach the <head>
+	maxImageBytes    = imaging.MaxUploadBytes
+	maxRedirects     = 3
+	fetchTimeout     = 15 * time.Second
+	defaultDraftsDir = "drafts"
+)
+
+// Draft is a prefilled profile awaiting operator review before submission via /add.
+type Draft struct {
+	SourceURL   string    `json:"source_url"`
+	FullName    string    `json:"full_name"`
+	Country     string    `json:"country"`
+	City        string    `json:"city"`
+	Description string    `json:"description"`
+	PhotoURL    string    `json:"photo_url,omitempty"`
+	PhotoAlt    string    `json:"photo_alt,omitempty"` // og:image:alt; the operator writes one when it's missing
+	PhotoFile   string    `json:"photo_file,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: ogimport <url>")
+		os.Exit(2)
+	}
+	if err := run(context.Background(), logger, os.Args[1]); err != nil {
+		logger.Error("import failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, log *slog.Logger, rawURL string) error {
+	draftsDir := os.Getenv("LEADERBOARD_DRAFTS_DIR")
+	if draftsDir == "" {
+		draftsDir = defaultDraftsDir
+	}
+
+	client := newSafeClient()
+	pageURL, err := checkURL(rawURL)
+	if err != nil { return err }
+
+	page, _, err := fetch(ctx, client, pageURL, maxPageBytes)
+	if err != nil { return fmt.Errorf("fetch page: %w", err) }
+	meta := parseOpenGraph(page)
+
+	d := Draft{
+		SourceURL:   pageURL.String(),
+		FullName:    strings.TrimSpace(meta["og:title"]),
+		Description: strings.TrimSpace(profile.TruncateDescription(strings.TrimSpace(meta["og:description"]))),
+		FetchedAt:   time.Now().UTC(),
+	}
+	if d.FullName == "" {
+		return fmt.Errorf("no og:title found")
+	}
+
+	var photo []byte
+	if ref := strings.TrimSpace(meta["og:image"]); ref != "" {
+		imgURL, err := pageURL.Parse(ref)
+		if err != nil { return fmt.Errorf("og:image: %w", err) }
+		if imgURL, err = checkURL(imgURL.String()); err != nil { return fmt.Errorf("og:image: %w", err) }
+		b, ct, err := fetch(ctx, client, imgURL, maxImageBytes)
+		if err != nil { return fmt.Errorf("fetch image: %w", err) }
+		ext, ok := imageExt(b)
+		if !ok { return fmt.Errorf("og:image is %q, want jpeg or png", ct) }
+		photo = b
+		d.PhotoURL = imgURL.String()
+		d.PhotoFile = "photo" + ext
+		if alt := strings.TrimSpace(meta["og:image:alt"]); profile.ValidatePhotoAlt(alt) == nil { d.PhotoAlt = alt }
+	} else {
+		log.Warn("no og:image found; photo must be supplied manually")
+	}
+
+	dir := filepath.Join(draftsDir, d.FetchedAt.Format("20060102T150405"))
+	if err := os.MkdirAll(dir, 0o755); err != nil { return fmt.Errorf("create draft dir: %w", err) }
+	if photo != nil {
+		if err := os.WriteFile(filepath.Join(dir, d.PhotoFile), photo, 0o644); err != nil {
+			return fmt.Errorf("write photo: %w", err)
+		}
+	}
+	js, err := json.MarshalIndent(d, "", "  ")
+	if err != nil { return err }
+	if err := os.WriteFile(filepath.Join(dir, "draft.json"), append(js, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write draft: %w", err)
+	}
+	log.Info("draft written", "dir", dir, "full_name", d.FullName, "photo", photo != nil)
+	log.Info("review the draft, fill in country and city, then submit it via /add")
+	return nil
+}
+
+// newSafeClient returns an HTTP client that refuses to connect to non-public addresses.
+// The check runs on the resolved IP at dial time, so DNS rebinding and redirects to
+// internal hosts are covered as well.
+func newSafeClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil { return err }
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		Proxy:                  nil, // a proxy would bypass the address check
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    5 * time.Second,
+		ResponseHeaderTimeout:  10 * time.Second,
+		MaxResponseHeaderBytes: 64 * 1024,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   fetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			_, err := checkURL(req.URL.String())
+			return err
+		},
+	}
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) { return false }
+	}
+	return true
+}
+
+// nonPublicNets are the ranges the net.IP checks miss: "this network" (0.0.0.0/8, which
+// reaches the local host on Linux) and carrier-grade NAT (100.64.0.0/10), which cloud
+// networks often route internally.
+var nonPublicNets = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+}
+
+func checkURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil { return nil, fmt.Errorf("parse url: %w", err) }
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("url has no host")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("credentials in url are not allowed")
+	}
+	return u, nil
+}
+
+// fetch GETs u and returns at most limit bytes; larger bodies are an error rather than truncated.
+func fetch(ctx context.Context, c *http.Client, u *url.URL, limit int64) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil { return nil, "", err }
+	req.Header.Set("User-Agent", "bestfriends-ogimport/1")
+	resp, err := c.Do(req)
+	if err != nil { return nil, "", err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > limit {
+		return nil, "", fmt.Errorf("response too large (%d bytes)", resp.ContentLength)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil { return nil, "", err }
+	if int64(len(b)) > limit {
+		return nil, "", fmt.Errorf("response larger than %d bytes", limit)
+	}
+	return b, resp.Header.Get("Content-Type"), nil
+}
+
+var (
+	metaTagRe  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrRe = regexp.MustCompile(`(?is)([a-z:-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s>]+)`)
+)
+
+// parseOpenGraph extracts og:* properties from <meta> tags; the first occurrence wins.
+func parseOpenGraph(page []byte) map[string]string {
+	out := map[string]string{}
+	for _, tag := range metaTagRe.FindAll(page, -1) {
+		attrs := map[string]string{}
+		for _, m := range metaAttrRe.FindAllSubmatch(tag, -1) {
+			v := strings.Trim(string(m[2]), `"'`)
+			attrs[strings.ToLower(string(m[1]))] = html.UnescapeString(v)
+		}
+		key := attrs["property"]
+		if key == "" { key = attrs["name"] }
+		key = strings.ToLower(key)
+		if !strings.HasPrefix(key, "og:") { continue }
+		if _, seen := out[key]; !seen {
+			out[key] = attrs["content"]
+		}
+	}
+	return out
+}
+
+// imageExt sniffs the payload rather than trusting the server's Content-Type.
+func imageExt(b []byte) (string, bool) {
+	switch http.DetectContentType(b) {
+	case "image/jpeg":
+		return ".jpg", true
+	case "image/png":
+		return ".png", true
+	}
+	return "", false
+}
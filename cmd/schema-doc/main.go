@@ -0,0 +1,50 @@
+// Command schema-doc writes a reference of the live database schema (tables, columns,
+// indexes and foreign keys) as Markdown or HTML, with each table's note taken from the
+// migration that created it. The app serves the same reference on /admin/schema.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	_ "github.com/lib/pq"
+
+	"github.com/doesnotcommit/bestfriends/internal/schemadoc"
+	"github.com/doesnotcommit/bestfriends/migrations"
+)
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	if err := run(context.Background(), os.Args[1:]); err != nil {
+		logger.Error("schema-doc failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("schema-doc", flag.ContinueOnError)
+	format := fs.String("format", "md", "md or html, for stdout")
+	out := fs.String("o", "", "output file, HTML when it ends in .html (default stdout)")
+	migrationsDir := fs.String("migrations", os.Getenv("LEADERBOARD_MIGRATIONS_DIR"), "migrations directory for table notes (default: the ones built in)")
+	if err := fs.Parse(args); err != nil { return err }
+	if *format != "md" && *format != "html" { return fmt.Errorf("-format must be md or html") }
+
+	dsn := os.Getenv("LEADERBOARD_DB_URL")
+	if dsn == "" {
+		return fmt.Errorf("LEADERBOARD_DB_URL is required")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil { return fmt.Errorf("open db: %w", err) }
+	defer db.Close()
+
+	if *out != "" { return schemadoc.WriteFile(ctx, db, migrations.Open(*migrationsDir), *out) }
+	s, err := schemadoc.Inspect(ctx, db)
+	if err != nil { return err }
+	if err := s.Annotate(migrations.Open(*migrationsDir)); err != nil { return err }
+	if *format == "html" { return s.HTML(os.Stdout) }
+	return s.Markdown(os.Stdout)
+}
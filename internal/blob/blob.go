@@ -0,0 +1,64 @@
+// Package blob stores photo bytes outside the database, which keeps only their keys: on a
+// local disk (or a mounted volume) or in an S3-compatible bucket. Memory is a fake for tests.
+package blob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Store holds objects by key. Keys are slash-separated paths of lower-case letters, digits,
+// dots, dashes and underscores, as NewKey makes them.
+type Store interface {
+	// Put stores data under key, replacing any object there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open reads the object under key; ErrNotFound when there is none.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object under key; a missing one is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+type ErrorNotFound string
+
+func (e ErrorNotFound) Error() string { return string(e) }
+func (ErrorNotFound) NotFound()       {}
+
+const ErrNotFound ErrorNotFound = "object not found"
+
+type ErrorBadKey string
+
+func (e ErrorBadKey) Error() string { return fmt.Sprintf("invalid object key %q", string(e)) }
+
+// NewKey returns a fresh key under prefix. Keys are random rather than derived from the
+// content: two profiles may share a photo's bytes, and replacing one must not delete the
+// other's.
+func NewKey(prefix string) string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil { panic(err) } // crypto/rand does not fail on supported platforms
+	h := hex.EncodeToString(b[:])
+	return prefix + "/" + h[:2] + "/" + h[2:]
+}
+
+// checkKey rejects keys that could leave the store's directory or bucket prefix.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") { return ErrorBadKey(key) }
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." { return ErrorBadKey(key) }
+	}
+	for _, r := range key {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9' || strings.ContainsRune("/._-", r)) { return ErrorBadKey(key) }
+	}
+	return nil
+}
+
+// Read returns the whole object under key.
+func Read(ctx context.Context, s Store, key string) ([]byte, error) {
+	rc, err := s.Open(ctx, key)
+	if err != nil { return nil, err }
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,63 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Disk keeps objects as files under a directory, a key's slashes making subdirectories.
+// Writes go to a temporary file renamed into place, so readers see the old object or the
+// new one, never part of one.
+type Disk struct {
+	dir string
+}
+
+// NewDisk returns a Disk over dir, creating it if needed.
+func NewDisk(dir string) (*Disk, error) {
+	if dir == "" { return nil, errors.New("blob directory is required") }
+	if err := os.MkdirAll(dir, 0o750); err != nil { return nil, err }
+	return &Disk{dir: dir}, nil
+}
+
+func (d *Disk) path(key string) (string, error) {
+	if err := checkKey(key); err != nil { return "", err }
+	return filepath.Join(d.dir, filepath.FromSlash(key)), nil
+}
+
+func (d *Disk) Put(_ context.Context, key string, data []byte, _ string) error {
+	p, err := d.path(key)
+	if err != nil { return err }
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil { return err }
+	f, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil { return err }
+	defer os.Remove(f.Name()) // fails harmlessly once renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil { return err }
+	return os.Rename(f.Name(), p)
+}
+
+func (d *Disk) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := d.path(key)
+	if err != nil { return nil, err }
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) { return nil, ErrNotFound }
+	return f, err
+}
+
+func (d *Disk) Delete(_ context.Context, key string) error {
+	p, err := d.path(key)
+	if err != nil { return err }
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) { return err }
+	return nil
+}
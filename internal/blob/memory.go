@@ -0,0 +1,50 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"sync"
+)
+
+// Memory is an in-memory Store for tests.
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func NewMemory() *Memory { return &Memory{objects: map[string][]byte{}} }
+
+func (m *Memory) Put(_ context.Context, key string, data []byte, _ string) error {
+	if err := checkKey(key); err != nil { return err }
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = slices.Clone(data)
+	return nil
+}
+
+func (m *Memory) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.objects[key]
+	if !ok { return nil, ErrNotFound }
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// Keys returns the stored keys, sorted.
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.objects))
+	for k := range m.objects { keys = append(keys, k) }
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,142 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// S3Config names a bucket on an S3-compatible service (AWS S3, MinIO, Ceph, R2, ...).
+type S3Config struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com or http://minio:9000
+	Region    string // signing region; "us-east-1" when empty
+	Bucket    string
+	Prefix    string // prepended to every key, e.g. "leaderboard/"; optional
+	AccessKey string
+	SecretKey string
+	PathStyle bool // address the bucket as endpoint/bucket (MinIO and most self-hosted services) instead of bucket.endpoint
+}
+
+// S3 is a Store over an S3-compatible bucket, signing requests with AWS Signature Version 4.
+type S3 struct {
+	cfg    S3Config
+	base   *url.URL // the bucket's URL
+	client *http.Client
+	now    func() time.Time
+}
+
+// s3Timeout bounds one request; photos are at most a few hundred KB.
+const s3Timeout = 30 * time.Second
+
+// emptySHA256 is the payload hash of requests without a body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("S3 endpoint, bucket, access key and secret key are required")
+	}
+	if cfg.Region == "" { cfg.Region = "us-east-1" }
+	u, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") { return nil, fmt.Errorf("S3 endpoint %q is not an http(s) URL", cfg.Endpoint) }
+	if cfg.PathStyle {
+		u.Path += "/" + cfg.Bucket
+	} else {
+		u.Host = cfg.Bucket + "." + u.Host
+	}
+	return &S3{cfg: cfg, base: u, client: &http.Client{Timeout: s3Timeout}, now: time.Now}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	h := http.Header{}
+	if contentType != "" { h.Set("Content-Type", contentType) }
+	resp, err := s.do(ctx, http.MethodPut, key, data, h)
+	if err != nil { return err }
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil { return nil, err }
+	return resp.Body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if errors.Is(err, ErrNotFound) { return nil }
+	if err != nil { return err }
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for key and returns a successful response; a 404 is ErrNotFound.
+func (s *S3) do(ctx context.Context, method, key string, body []byte, h http.Header) (*http.Response, error) {
+	if err := checkKey(key); err != nil { return nil, err }
+	u := *s.base
+	u.Path += "/" + s.cfg.Prefix + key
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil { return nil, err }
+	for k, v := range h { req.Header[k] = v }
+	req.ContentLength = int64(len(body))
+	s.sign(req, body)
+	resp, err := s.client.Do(req)
+	if err != nil { return nil, err }
+	if resp.StatusCode/100 == 2 { return resp, nil }
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound { return nil, ErrNotFound }
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg))
+}
+
+// sign adds the x-amz-date, x-amz-content-sha256 and Authorization headers of Signature
+// Version 4 (https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html),
+// covering the host and every header already set.
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	stamp, day := now.Format("20060102T150405Z"), now.Format("20060102")
+	payload := emptySHA256
+	if len(body) > 0 { payload = hexSHA256(body) }
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	names := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		k = strings.ToLower(k)
+		names = append(names, k)
+		values[k] = strings.Join(v, ",")
+	}
+	slices.Sort(names)
+	var canonical strings.Builder
+	for _, k := range names { canonical.WriteString(k + ":" + strings.TrimSpace(values[k]) + "\n") }
+	signed := strings.Join(names, ";")
+	request := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery, canonical.String(), signed, payload}, "\n")
+
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hexSHA256([]byte(request))
+	key := []byte("AWS4" + s.cfg.SecretKey)
+	for _, part := range []string{day, s.cfg.Region, "s3", "aws4_request"} { key = hmacSHA256(key, part) }
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+hex.EncodeToString(hmacSHA256(key, toSign)))
+}
+
+func hexSHA256(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(msg))
+	return m.Sum(nil)
+}
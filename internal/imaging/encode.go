@@ -0,0 +1,34 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+)
+
+// Encoding is deterministic: an input gives the same bytes on every architecture and on every
+// Go release the golden tests (encode_test.go) pass on. Reprocessing relies on it to leave
+// photos whose result is unchanged alone, since a rewrite moves updated_at and with it the
+// photo's ETag. So the encoder always sees one pixel format, 8-bit RGBA converted with integer
+// math, which makes every photo baseline 4:2:0 YCbCr, grey ones too; the quality ladder is
+// fixed; and nothing but the image is written: no EXIF, ICC profile, JFIF header or comment.
+
+// qualities is the JPEG quality ladder Process walks down until a photo fits.
+var qualities = [...]int{80, 75, 70, 65, 60, 55, 50, 45, 40, 35}
+
+// canonical returns img as the RGBA image the encoder is given, converting other formats.
+func canonical(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) { return rgba }
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, img, b.Min, draw.Src)
+	return dst
+}
+
+// encodeJPEG encodes a canonical image at quality q.
+func encodeJPEG(img *image.RGBA, q int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: q}); err != nil { return nil, err }
+	return buf.Bytes(), nil
+}
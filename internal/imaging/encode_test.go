@@ -0,0 +1,104 @@
+package imaging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/encode.golden")
+
+// TestEncodeGolden pins the bytes Process produces for synthetic photos covering each way to
+// the encoder. A failure on some GOARCH or Go release means encoding is no longer
+// deterministic there; a deliberate pipeline change regenerates the file with -update (and
+// wants a reprocess run in production).
+func TestEncodeGolden(t *testing.T) {
+	noise := uint32(1)
+	rnd := func() uint8 { noise ^= noise << 13; noise ^= noise >> 17; noise ^= noise << 5; return uint8(noise) }
+	gradient := func(w, h int, grain bool) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), uint8((x + y) % 256), 255}
+				if grain { c.R, c.G, c.B = c.R^rnd()&31, c.G^rnd()&31, c.B^rnd()&31 }
+				img.SetRGBA(x, y, c)
+			}
+		}
+		return img
+	}
+	gray := image.NewGray(image.Rect(0, 0, 200, 150))
+	for i := range gray.Pix { gray.Pix[i] = uint8(i*7) ^ rnd()&15 }
+	wideGray := image.NewGray(image.Rect(0, 0, 1300, 200))
+	for i := range wideGray.Pix { wideGray.Pix[i] = uint8(i%1300/5 + i/1300*3) }
+	alpha := image.NewNRGBA(image.Rect(0, 0, 120, 90))
+	for i := 0; i < len(alpha.Pix); i += 4 { alpha.Pix[i], alpha.Pix[i+1], alpha.Pix[i+2], alpha.Pix[i+3] = 200, uint8(i), 40, uint8(i/4) }
+	encode := func(img image.Image, asJPEG bool) []byte {
+		var buf bytes.Buffer
+		var err error
+		if asJPEG { err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}) } else { err = png.Encode(&buf, img) }
+		if err != nil { t.Fatal(err) }
+		return buf.Bytes()
+	}
+	cases := []struct {
+		name     string
+		input    []byte
+		maxBytes int
+	}{
+		{"png-rgba", encode(gradient(320, 240, false), false), MaxBytes},
+		{"png-gray", encode(gray, false), MaxBytes},
+		{"png-alpha", encode(alpha, false), MaxBytes},
+		{"jpeg-ycbcr", encode(gradient(320, 240, true), true), MaxBytes},
+		{"jpeg-gray", encode(gray, true), MaxBytes},
+		{"png-resized", encode(gradient(1600, 400, true), false), MaxBytes},
+		{"png-squeezed", encode(gradient(640, 480, true), false), 40 * 1024},
+		{"jpeg-resized", encode(gradient(1500, 500, true), true), MaxBytes},
+		{"png-gray-resized", encode(wideGray, false), MaxBytes},
+		{"jpeg-rotated", jpegWithEXIF(encode(gradient(600, 1400, true), true), orientationTIFF(6)), MaxBytes},
+		{"png-mirrored", pngWithChunk(encode(gradient(160, 120, false), false), "eXIf", orientationTIFF(4)), MaxBytes},
+	}
+
+	var got strings.Builder
+	for _, c := range cases {
+		out, _, err := Process(c.input, MaxWidth, c.maxBytes)
+		if err != nil { t.Fatalf("%s: %v", c.name, err) }
+		if again, _, _ := Process(c.input, MaxWidth, c.maxBytes); !bytes.Equal(again, out) { t.Errorf("%s: two runs differ", c.name) }
+		if err := checkJPEGSegments(out); err != nil { t.Errorf("%s: %v", c.name, err) }
+		fmt.Fprintf(&got, "%s %d %x\n", c.name, len(out), sha256.Sum256(out))
+	}
+	golden := filepath.Join("testdata", "encode.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got.String()), 0o644); err != nil { t.Fatal(err) }
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil { t.Fatal(err) }
+	if got.String() != string(want) { t.Errorf("encoded photos differ from %s:\n%s\nwant:\n%s", golden, got.String(), want) }
+}
+
+// checkJPEGSegments fails a JPEG carrying metadata segments or not encoded as 4:2:0 YCbCr.
+func checkJPEGSegments(b []byte) error {
+	if !bytes.HasPrefix(b, []byte{0xFF, 0xD8}) { return fmt.Errorf("no SOI") }
+	for i := 2; i+4 <= len(b); {
+		marker, n := b[i+1], int(binary.BigEndian.Uint16(b[i+2:]))
+		switch {
+		case marker >= 0xE0 && marker <= 0xEF || marker == 0xFE:
+			return fmt.Errorf("metadata segment %#x", marker)
+		case marker == 0xC0:
+			sof := b[i+4 : i+2+n]
+			if sof[5] != 3 || sof[7] != 0x22 || sof[10] != 0x11 || sof[13] != 0x11 { return fmt.Errorf("frame is not 4:2:0 YCbCr: %x", sof) }
+		case marker == 0xDA:
+			return nil
+		}
+		i += 2 + n
+	}
+	return fmt.Errorf("no SOS")
+}
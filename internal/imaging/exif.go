@@ -0,0 +1,183 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"time"
+)
+
+// EXIF is read only for what the board shows and how the photo is turned: Process re-encodes
+// photos upright, which drops every piece of metadata (GPS position included), and
+// StripMetadata does the same for the original uploads kept for reprocessing.
+
+// EXIF tags used here.
+const (
+	tagOrientation       = 0x0112
+	tagExifIFD           = 0x8769
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+)
+
+// CaptureTime is when the photo in b (JPEG or PNG) was taken, per its EXIF DateTimeOriginal
+// or, failing that, DateTimeDigitized. EXIF times carry no zone; the result is that wall
+// clock time in UTC. ok is false without a plausible date (cameras with unset clocks write
+// zeros or 1970).
+func CaptureTime(b []byte) (t time.Time, ok bool) {
+	tf, ok := exifTIFF(b)
+	if !ok { return time.Time{}, false }
+	ifd0, ok := tf.firstIFD()
+	if !ok { return time.Time{}, false }
+	v, ok := tf.lookup(ifd0, tagExifIFD)
+	if !ok || len(v) < 4 { return time.Time{}, false }
+	exif := tf.order.Uint32(v)
+	for _, tag := range []uint16{tagDateTimeOriginal, tagDateTimeDigitized} {
+		v, ok := tf.lookup(exif, tag)
+		if !ok { continue }
+		t, err := time.Parse("2006:01:02 15:04:05", strings.TrimRight(string(v), "\x00 "))
+		if err == nil && t.Year() >= 1900 && t.Year() != 1970 && t.Before(time.Now().AddDate(0, 0, 2)) { return t, true }
+	}
+	return time.Time{}, false
+}
+
+// orientation is the EXIF orientation of the photo in b (JPEG or PNG): 1 is upright, 2 to 8
+// the mirrorings and rotations orient undoes. Missing or invalid values are 1.
+func orientation(b []byte) int {
+	tf, ok := exifTIFF(b)
+	if !ok { return 1 }
+	ifd0, ok := tf.firstIFD()
+	if !ok { return 1 }
+	v, ok := tf.lookup(ifd0, tagOrientation)
+	if !ok || len(v) != 2 { return 1 }
+	if o := int(tf.order.Uint16(v)); o >= 1 && o <= 8 { return o }
+	return 1
+}
+
+// orientationTIFF is an EXIF block holding nothing but orientation o.
+func orientationTIFF(o int) []byte {
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	b = binary.BigEndian.AppendUint16(b, tagOrientation)
+	b = binary.BigEndian.AppendUint16(b, 3) // SHORT
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(o))
+	return append(b, 0, 0, 0, 0, 0, 0) // padding, then no next IFD
+}
+
+// pngMetadata are the PNG chunks StripMetadata drops: EXIF, text and the modification time.
+var pngMetadata = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// StripMetadata returns the photo in b without its metadata: a JPEG loses its APPn segments
+// (but Adobe's, which says how to read its colours) and comments, a PNG its EXIF, text and
+// time chunks. The orientation survives, in an EXIF block of its own, so the photo still
+// comes out upright when processed again. ok is false when b can't be parsed.
+func StripMetadata(b []byte) (out []byte, ok bool) {
+	o := orientation(b)
+	switch mt, _ := Sniff(b); mt {
+	case "image/jpeg":
+		out = append(out, 0xFF, 0xD8)
+		if o != 1 {
+			seg := append([]byte("Exif\x00\x00"), orientationTIFF(o)...)
+			out = append(binary.BigEndian.AppendUint16(append(out, 0xFF, 0xE1), uint16(len(seg)+2)), seg...)
+		}
+		for i := 2; i+4 <= len(b) && b[i] == 0xFF; {
+			marker, n := b[i+1], int(binary.BigEndian.Uint16(b[i+2:]))
+			if marker == 0xDA { return append(out, b[i:]...), true } // image data follows SOS
+			if n < 2 || i+2+n > len(b) { break }
+			adobe := marker == 0xEE && bytes.HasPrefix(b[i+4:i+2+n], []byte("Adobe"))
+			if marker < 0xE0 || marker > 0xEF && marker != 0xFE || adobe { out = append(out, b[i:i+2+n]...) }
+			i += 2 + n
+		}
+	case "image/png":
+		out = append(out, b[:8]...)
+		for i := 8; i+12 <= len(b); {
+			n := int(binary.BigEndian.Uint32(b[i:]))
+			if n < 0 || n > len(b)-i-12 { break }
+			typ := string(b[i+4 : i+8])
+			if typ == "IDAT" && o != 1 {
+				chunk := append([]byte("eXIf"), orientationTIFF(o)...)
+				out = binary.BigEndian.AppendUint32(out, uint32(len(chunk)-4))
+				out = binary.BigEndian.AppendUint32(append(out, chunk...), crc32.ChecksumIEEE(chunk))
+				o = 1
+			}
+			if !pngMetadata[typ] { out = append(out, b[i:i+12+n]...) }
+			if typ == "IEND" { return out, true }
+			i += 12 + n
+		}
+	}
+	return nil, false
+}
+
+// exifTIFF finds the EXIF block of a JPEG (APP1 "Exif") or PNG (eXIf chunk).
+func exifTIFF(b []byte) (tiff, bool) {
+	switch mt, _ := Sniff(b); mt {
+	case "image/jpeg":
+		for i := 2; i+4 <= len(b) && b[i] == 0xFF; {
+			marker, n := b[i+1], int(binary.BigEndian.Uint16(b[i+2:]))
+			if marker == 0xDA || n < 2 || i+2+n > len(b) { break } // image data follows SOS
+			seg := b[i+4 : i+2+n]
+			if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) { return newTIFF(seg[6:]) }
+			i += 2 + n
+		}
+	case "image/png":
+		for i := 8; i+12 <= len(b); {
+			n := int(binary.BigEndian.Uint32(b[i:]))
+			if n < 0 || n > len(b)-i-12 { break }
+			typ := string(b[i+4 : i+8])
+			if typ == "eXIf" { return newTIFF(b[i+8 : i+8+n]) }
+			if typ == "IEND" { break }
+			i += 12 + n
+		}
+	}
+	return tiff{}, false
+}
+
+// tiff is the TIFF structure EXIF data is stored in: a byte order, then IFDs (lists of
+// tagged values) addressed by offsets from the start of b.
+type tiff struct {
+	b     []byte
+	order binary.ByteOrder
+}
+
+func newTIFF(b []byte) (tiff, bool) {
+	if len(b) < 8 { return tiff{}, false }
+	t := tiff{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return tiff{}, false
+	}
+	return t, t.order.Uint16(b[2:]) == 42
+}
+
+func (t tiff) firstIFD() (uint32, bool) {
+	off := t.order.Uint32(t.b[4:])
+	return off, off >= 8 && int64(off) < int64(len(t.b))
+}
+
+// typeSizes are the byte sizes of the TIFF field types, by type number.
+var typeSizes = [...]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// lookup returns the raw value of tag in the IFD at off: inline for up to 4 bytes, else read
+// from the offset the entry holds.
+func (t tiff) lookup(off uint32, tag uint16) ([]byte, bool) {
+	if int64(off)+2 > int64(len(t.b)) { return nil, false }
+	n := int(t.order.Uint16(t.b[off:]))
+	for i := 0; i < n; i++ {
+		e := int64(off) + 2 + int64(i)*12
+		if e+12 > int64(len(t.b)) { return nil, false }
+		entry := t.b[e : e+12]
+		if t.order.Uint16(entry) != tag { continue }
+		typ, count := int(t.order.Uint16(entry[2:])), int64(t.order.Uint32(entry[4:]))
+		if typ <= 0 || typ >= len(typeSizes) { return nil, false }
+		size := count * int64(typeSizes[typ])
+		if size <= 4 { return entry[8 : 8+size], true }
+		at := int64(t.order.Uint32(entry[8:]))
+		if at+size > int64(len(t.b)) { return nil, false }
+		return t.b[at : at+size], true
+	}
+	return nil, false
+}
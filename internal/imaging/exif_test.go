@@ -0,0 +1,153 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// exifBlock is TIFF data in order with IFD0 pointing to an EXIF IFD holding tag as ASCII.
+func exifBlock(order binary.ByteOrder, tag uint16, value string) []byte {
+	var b bytes.Buffer
+	if order == binary.LittleEndian { b.WriteString("II") } else { b.WriteString("MM") }
+	w := func(v any) { binary.Write(&b, order, v) }
+	w(uint16(42))
+	w(uint32(8))
+	// IFD0 at 8: one entry, the EXIF IFD pointer, then the next-IFD link.
+	w(uint16(1))
+	w(uint16(tagExifIFD)); w(uint16(4)); w(uint32(1)); w(uint32(26))
+	w(uint32(0))
+	// EXIF IFD at 26: the tag, its value right after at 44.
+	w(uint16(1))
+	w(uint16(tag)); w(uint16(2)); w(uint32(len(value) + 1)); w(uint32(44))
+	w(uint32(0))
+	b.WriteString(value + "\x00")
+	return b.Bytes()
+}
+
+// withEXIF inserts tiff as an APP1 segment after a small JPEG's SOI marker.
+func withEXIF(t *testing.T, tiff []byte) []byte {
+	t.Helper()
+	var j bytes.Buffer
+	if err := jpeg.Encode(&j, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil { t.Fatal(err) }
+	return jpegWithEXIF(j.Bytes(), tiff)
+}
+
+// jpegWithEXIF inserts tiff as an APP1 segment after j's SOI marker.
+func jpegWithEXIF(j, tiff []byte) []byte {
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	out := append([]byte{0xFF, 0xD8, 0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(len(seg)+2))...)
+	return append(append(out, seg...), j[2:]...)
+}
+
+// pngWithChunk inserts a chunk of typ after p's IHDR.
+func pngWithChunk(p []byte, typ string, data []byte) []byte {
+	chunk := append([]byte(typ), data...)
+	out := append([]byte{}, p[:33]...) // signature and IHDR
+	out = binary.BigEndian.AppendUint32(out, uint32(len(chunk)-4))
+	out = binary.BigEndian.AppendUint32(append(out, chunk...), crc32.ChecksumIEEE(chunk))
+	return append(out, p[33:]...)
+}
+
+func TestCaptureTime(t *testing.T) {
+	want := time.Date(2023, 6, 14, 17, 5, 9, 0, time.UTC)
+	for name, in := range map[string][]byte{
+		"little endian": withEXIF(t, exifBlock(binary.LittleEndian, tagDateTimeOriginal, "2023:06:14 17:05:09")),
+		"big endian":    withEXIF(t, exifBlock(binary.BigEndian, tagDateTimeOriginal, "2023:06:14 17:05:09")),
+		"digitized":     withEXIF(t, exifBlock(binary.BigEndian, tagDateTimeDigitized, "2023:06:14 17:05:09")),
+	} {
+		if got, ok := CaptureTime(in); !ok || !got.Equal(want) { t.Errorf("%s: CaptureTime = %v, %t; want %v", name, got, ok, want) }
+	}
+
+	// PNG keeps the same block in an eXIf chunk.
+	var p bytes.Buffer
+	if err := png.Encode(&p, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil { t.Fatal(err) }
+	png := pngWithChunk(p.Bytes(), "eXIf", exifBlock(binary.LittleEndian, tagDateTimeOriginal, "2023:06:14 17:05:09"))
+	if got, ok := CaptureTime(png); !ok || !got.Equal(want) { t.Errorf("png: CaptureTime = %v, %t", got, ok) }
+
+	for name, in := range map[string][]byte{
+		"empty exif":  withEXIF(t, nil),
+		"unset clock": withEXIF(t, exifBlock(binary.LittleEndian, tagDateTimeOriginal, "0000:00:00 00:00:00")),
+		"epoch":       withEXIF(t, exifBlock(binary.LittleEndian, tagDateTimeOriginal, "1970:01:01 00:00:00")),
+		"future":      withEXIF(t, exifBlock(binary.LittleEndian, tagDateTimeOriginal, time.Now().AddDate(1, 0, 0).Format("2006:01:02 15:04:05"))),
+		"other tag":   withEXIF(t, exifBlock(binary.LittleEndian, 0x9010, "2023:06:14 17:05:09")),
+		"truncated":   withEXIF(t, exifBlock(binary.LittleEndian, tagDateTimeOriginal, "2023:06:14 17:05:09")[:30]),
+	} {
+		if got, ok := CaptureTime(in); ok { t.Errorf("%s: CaptureTime = %v", name, got) }
+	}
+}
+
+func FuzzCaptureTime(f *testing.F) {
+	for _, s := range fuzzSeeds(f) { f.Add(s) }
+	f.Fuzz(func(t *testing.T, in []byte) { CaptureTime(in) })
+}
+
+func TestOrientation(t *testing.T) {
+	for o := 1; o <= 8; o++ {
+		if got := orientation(withEXIF(t, orientationTIFF(o))); got != o { t.Errorf("orientation %d read as %d", o, got) }
+	}
+	for name, in := range map[string][]byte{
+		"none":         withEXIF(t, nil),
+		"out of range": withEXIF(t, orientationTIFF(9)),
+		"date only":    withEXIF(t, exifBlock(binary.LittleEndian, tagDateTimeOriginal, "2023:06:14 17:05:09")),
+	} {
+		if got := orientation(in); got != 1 { t.Errorf("%s: orientation = %d", name, got) }
+	}
+
+	// Two marked pixels of a 3×2 image, (0,0) and (1,0), end up where each orientation puts them.
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Pix[0], src.Pix[4+1] = 255, 255
+	for o, want := range map[int][2]image.Point{
+		1: {{0, 0}, {1, 0}}, 2: {{2, 0}, {1, 0}}, 3: {{2, 1}, {1, 1}}, 4: {{0, 1}, {1, 1}},
+		5: {{0, 0}, {0, 1}}, 6: {{1, 0}, {1, 1}}, 7: {{1, 2}, {1, 1}}, 8: {{0, 2}, {0, 1}},
+	} {
+		got := orient(src, o).(*image.RGBA)
+		if r, g := got.RGBAAt(want[0].X, want[0].Y).R, got.RGBAAt(want[1].X, want[1].Y).G; r != 255 || g != 255 || got.Rect.Dx() != 3 != transposed(o) {
+			t.Errorf("orientation %d: %v misplaces the pixels", o, got.Pix)
+		}
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	var j bytes.Buffer
+	if err := jpeg.Encode(&j, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil { t.Fatal(err) }
+	gps := exifBlock(binary.BigEndian, tagDateTimeOriginal, "2023:06:14 17:05:09")
+	withCOM := append([]byte{0xFF, 0xD8, 0xFF, 0xFE, 0, 7, 'h', 'e', 'l', 'l', 'o'}, j.Bytes()[2:]...)
+	for name, c := range map[string]struct {
+		in   []byte
+		want int
+	}{
+		"exif":    {jpegWithEXIF(j.Bytes(), gps), 1},
+		"comment": {withCOM, 1},
+		"rotated": {jpegWithEXIF(jpegWithEXIF(j.Bytes(), gps), orientationTIFF(6)), 6},
+		"plain":   {j.Bytes(), 1},
+	} {
+		out, ok := StripMetadata(c.in)
+		if !ok { t.Fatalf("%s: not stripped", name) }
+		if _, ok := CaptureTime(out); ok || bytes.Contains(out, []byte("hello")) { t.Errorf("%s: metadata left", name) }
+		if o := orientation(out); o != c.want { t.Errorf("%s: orientation %d, want %d", name, o, c.want) }
+		if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil { t.Errorf("%s: %v", name, err) }
+		if c.want == 1 && !bytes.Equal(out, j.Bytes()) { t.Errorf("%s: image data changed", name) }
+	}
+
+	var p bytes.Buffer
+	if err := png.Encode(&p, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil { t.Fatal(err) }
+	in := pngWithChunk(pngWithChunk(p.Bytes(), "tEXt", []byte("Comment\x00hello")), "eXIf", exifBlock(binary.LittleEndian, tagOrientation, "x"))
+	in = pngWithChunk(in, "eXIf", orientationTIFF(3))
+	out, ok := StripMetadata(in)
+	if !ok || bytes.Contains(out, []byte("hello")) || orientation(out) != 3 { t.Errorf("png: stripped to %q, %t", out, ok) }
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil { t.Errorf("png: %v", err) }
+	if out, ok := StripMetadata(p.Bytes()); !ok || !bytes.Equal(out, p.Bytes()) { t.Errorf("plain png changed: %t", ok) }
+
+	if _, ok := StripMetadata(withCOM[:20]); ok { t.Error("truncated JPEG stripped") }
+}
+
+func FuzzStripMetadata(f *testing.F) {
+	for _, s := range fuzzSeeds(f) { f.Add(s) }
+	f.Fuzz(func(t *testing.T, in []byte) { StripMetadata(in) })
+}
@@ -0,0 +1,66 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/textproto"
+	"testing"
+)
+
+// Fuzz targets for the photo pipeline. Run one with e.g.
+//
+//	go test ./internal/imaging -run '^$' -fuzz FuzzProcess -fuzztime 1m
+//
+// Without -fuzz, go test runs only the seeds below and anything saved under testdata/fuzz.
+
+func fuzzSeeds(f *testing.F) [][]byte {
+	f.Helper()
+	gradient := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ { gradient.Set(x, y, color.RGBA{uint8(x * 6), uint8(y * 8), 90, 255}) }
+	}
+	var p, j, strip bytes.Buffer
+	if err := png.Encode(&p, gradient); err != nil { f.Fatal(err) }
+	if err := jpeg.Encode(&j, gradient, nil); err != nil { f.Fatal(err) }
+	if err := png.Encode(&strip, image.NewGray(image.Rect(0, 0, 3000, 1))); err != nil { f.Fatal(err) }
+	return [][]byte{
+		p.Bytes(), j.Bytes(), strip.Bytes(),
+		p.Bytes()[:len(p.Bytes())/2], j.Bytes()[:len(j.Bytes())/2], // truncated
+		pngHeader(20000, 20000), pngHeader(1, 1<<31-1), pngHeader(0, 0),
+		{0xFF, 0xD8, 0xFF}, []byte("\x89PNG\r\n\x1a\n"),
+	}
+}
+
+func FuzzProcess(f *testing.F) {
+	for _, s := range fuzzSeeds(f) { f.Add(s) }
+	f.Fuzz(func(t *testing.T, in []byte) {
+		const maxWidth = 64 // small, so the resize path runs on small inputs too
+		out, ct, _, err := ProcessInspect(in, maxWidth, MaxBytes)
+		if err != nil {
+			if out != nil { t.Fatalf("output alongside error %v", err) }
+			return
+		}
+		if ct != ContentType || len(out) > MaxBytes { t.Fatalf("content type %q, %d bytes", ct, len(out)) }
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(out))
+		if err != nil { t.Fatalf("output does not decode: %v", err) }
+		if cfg.Width < 1 || cfg.Width > maxWidth || cfg.Height < 1 { t.Fatalf("output is %dx%d", cfg.Width, cfg.Height) }
+	})
+}
+
+func FuzzCheckUpload(f *testing.F) {
+	for _, s := range fuzzSeeds(f) { f.Add(s, "a.png", "image/png") }
+	f.Add([]byte{0xFF, 0xD8, 0xFF}, "photo.JPEG", "image/pjpeg; charset=")
+	f.Add([]byte("GIF89a"), "", `multipart/mixed; boundary="`)
+	f.Fuzz(func(t *testing.T, in []byte, name, contentType string) {
+		h := textproto.MIMEHeader{}
+		if contentType != "" { h.Set("Content-Type", contentType) }
+		err := CheckUpload(in, &multipart.FileHeader{Filename: name, Header: h})
+		if err != nil && !errors.As(err, new(interface{ InvalidImage() })) { t.Fatalf("untyped error %v", err) }
+		if _, serr := Sniff(in); err == nil && serr != nil { t.Fatalf("accepted unsniffable input: %v", serr) }
+	})
+}
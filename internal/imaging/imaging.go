@@ -0,0 +1,158 @@
+// Package imaging is the photo pipeline shared by the server and the reprocess tool:
+// upload validation, decoding limits, resizing and re-encoding for storage.
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"mime/multipart"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Stored photo parameters. Changing them only affects new uploads until cmd/reprocess runs.
+const (
+	MaxUploadBytes = 1 * 1024 * 1024 // largest upload accepted, before processing
+
+	MaxWidth = 1024
+	MaxBytes = 500 * 1024 // 500KB in DB
+
+	ContentType = "image/jpeg" // what Process encodes to
+
+	// Revision counts changes to what Process makes of a photo with the same parameters
+	// (2: Catmull-Rom resizing; 3: EXIF orientation), so reprocess runs tell them apart.
+	Revision = 3
+)
+
+// Decoded size limits; a small compressed file can declare enormous dimensions.
+const (
+	maxImageDimension = 12000
+	maxImagePixels    = 50_000_000 // ~200MB as RGBA
+)
+
+type ErrorInvalidImage string
+
+func (e ErrorInvalidImage) Error() string { return string(e) }
+func (ErrorInvalidImage) InvalidImage()   {}
+
+const (
+	ErrUnsupported ErrorInvalidImage = "unsupported image type (JPEG or PNG only)"
+	ErrMismatch    ErrorInvalidImage = "file name or content type does not match the image data"
+	ErrTooLarge    ErrorInvalidImage = "image dimensions too large"
+)
+
+// Sniff identifies the payload by its magic number and returns its MIME type.
+func Sniff(b []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg", nil
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png", nil
+	}
+	return "", ErrUnsupported
+}
+
+var imageExts = map[string]string{".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png"}
+
+// CheckUpload rejects uploads whose declared file extension or part Content-Type disagrees
+// with the sniffed format. Missing declarations (and the generic octet-stream) are allowed.
+func CheckUpload(b []byte, h *multipart.FileHeader) error {
+	sniffed, err := Sniff(b)
+	if err != nil { return err }
+	if ext := strings.ToLower(filepath.Ext(h.Filename)); ext != "" {
+		if want, ok := imageExts[ext]; !ok || want != sniffed { return ErrMismatch }
+	}
+	if ct := h.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil { return ErrMismatch }
+		if mt == "image/jpg" || mt == "image/pjpeg" { mt = "image/jpeg" }
+		if mt != sniffed && mt != "application/octet-stream" { return ErrMismatch }
+	}
+	return nil
+}
+
+// Process attempts to decode JPEG/PNG, resize to max width, and encode as JPEG as a pure-Go fallback
+// Note: Without CGO/libwebp, high-quality WebP encoding isn't available in stdlib. We'll use JPEG with quality tuning
+// but still set content type properly if/when a pure-Go webp encoder is added.
+func Process(input []byte, maxWidth int, maxBytes int) ([]byte, string, error) {
+	out, contentType, _, err := process(input, maxWidth, maxBytes, false)
+	return out, contentType, err
+}
+
+// ProcessInspect is Process for new uploads: it also returns Inspect's warnings about the
+// photo as stored.
+func ProcessInspect(input []byte, maxWidth int, maxBytes int) ([]byte, string, []Warning, error) {
+	return process(input, maxWidth, maxBytes, true)
+}
+
+func process(input []byte, maxWidth int, maxBytes int, inspect bool) (out []byte, contentType string, warnings []Warning, err error) {
+	o := currentObserver()
+	format, outcome := "unknown", "ok"
+	defer func() { o.Processed(format, outcome, len(out)) }()
+
+	mt, err := Sniff(input)
+	if err != nil {
+		outcome = "unsupported"
+		return nil, "", nil, err
+	}
+	format = strings.TrimPrefix(mt, "image/")
+	// Check dimensions from the header before allocating pixels for a decompression bomb.
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(input))
+	if err != nil {
+		outcome = "decode"
+		return nil, "", nil, fmt.Errorf("decode config: %w", err)
+	}
+	if cfg.Width > maxImageDimension || cfg.Height > maxImageDimension || cfg.Width*cfg.Height > maxImagePixels {
+		outcome = "too_large"
+		return nil, "", nil, ErrTooLarge
+	}
+	start := time.Now()
+	img, _, err := image.Decode(bytes.NewReader(input))
+	o.Stage("decode", 0, time.Since(start))
+	if err != nil {
+		outcome = "decode"
+		return nil, "", nil, fmt.Errorf("decode: %w", err)
+	}
+	// Downscale to max width (see resize.go), the width once turned upright (see orient.go).
+	orientation := orientation(input)
+	b := img.Bounds()
+	w := b.Dx()
+	h := b.Dy()
+	if transposed(orientation) { w, h = h, w }
+	if w > maxWidth {
+		newW := maxWidth
+		// At least one row: a long thin strip would otherwise scale to an empty JPEG.
+		newH := max(1, h*newW/w)
+		if transposed(orientation) { newW, newH = newH, newW }
+		start = time.Now()
+		img = resize(img, newW, newH)
+		o.Stage("resize", 0, time.Since(start))
+	}
+	img = orient(img, orientation)
+	if inspect {
+		start = time.Now()
+		warnings = Inspect(img)
+		o.Stage("inspect", 0, time.Since(start))
+	}
+	// Walk down the quality ladder until the photo fits under maxBytes (see encode.go).
+	rgba := canonical(img)
+	for _, q := range qualities {
+		start = time.Now()
+		out, err := encodeJPEG(rgba, q)
+		o.Stage("encode", q, time.Since(start))
+		if err != nil {
+			outcome = "encode"
+			return nil, "", nil, err
+		}
+		if len(out) <= maxBytes {
+			return out, ContentType, warnings, nil
+		}
+	}
+	outcome = "too_many_bytes"
+	return nil, "", nil, fmt.Errorf("cannot fit image under %d bytes", maxBytes)
+}
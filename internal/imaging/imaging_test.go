@@ -0,0 +1,168 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func tinyPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader returns a PNG signature plus a valid IHDR chunk claiming w x h pixels.
+func pngHeader(w, h uint32) []byte {
+	var ihdr bytes.Buffer
+	ihdr.WriteString("IHDR")
+	binary.Write(&ihdr, binary.BigEndian, w)
+	binary.Write(&ihdr, binary.BigEndian, h)
+	ihdr.Write([]byte{8, 6, 0, 0, 0}) // 8-bit RGBA
+	var b bytes.Buffer
+	b.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&b, binary.BigEndian, uint32(13))
+	b.Write(ihdr.Bytes())
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(ihdr.Bytes()))
+	return b.Bytes()
+}
+
+func TestCheckUpload(t *testing.T) {
+	pngBytes := tinyPNG(t)
+	header := func(name, ct string) *multipart.FileHeader {
+		h := textproto.MIMEHeader{}
+		if ct != "" {
+			h.Set("Content-Type", ct)
+		}
+		return &multipart.FileHeader{Filename: name, Header: h}
+	}
+	tests := []struct {
+		name string
+		data []byte
+		fh   *multipart.FileHeader
+		want error
+	}{
+		{"png", pngBytes, header("a.png", "image/png"), nil},
+		{"no declarations", pngBytes, header("", ""), nil},
+		{"octet-stream", pngBytes, header("a.PNG", "application/octet-stream"), nil},
+		{"wrong extension", pngBytes, header("a.jpg", "image/png"), ErrMismatch},
+		{"wrong content type", pngBytes, header("a.png", "image/jpeg"), ErrMismatch},
+		{"unknown extension", pngBytes, header("a.gif", ""), ErrMismatch},
+		{"not an image", []byte("GIF89a..."), header("a.png", "image/png"), ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckUpload(tt.data, tt.fh); !errors.Is(err, tt.want) {
+				t.Errorf("CheckUpload() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessImageRejectsHugeDimensions(t *testing.T) {
+	_, _, err := Process(pngHeader(20000, 20000), MaxWidth, MaxBytes)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err = %v, want %v", err, ErrTooLarge)
+	}
+	if _, _, err := Process(tinyPNG(t), MaxWidth, MaxBytes); err != nil {
+		t.Fatalf("small image: %v", err)
+	}
+}
+
+func TestProcessTurnsPhotosUpright(t *testing.T) {
+	// A portrait photo stored sideways: 1400×600 pixels, to be turned clockwise.
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1400, 600))); err != nil { t.Fatal(err) }
+	out, _, err := Process(pngWithChunk(buf.Bytes(), "eXIf", orientationTIFF(6)), MaxWidth, MaxBytes)
+	if err != nil { t.Fatal(err) }
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(out))
+	if err != nil || cfg.Width != 600 || cfg.Height != 1400 { t.Errorf("stored %d×%d (%v), want 600×1400", cfg.Width, cfg.Height, err) }
+
+	// The upright width is what MaxWidth caps.
+	buf.Reset()
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 600, 2000))); err != nil { t.Fatal(err) }
+	out, _, err = Process(pngWithChunk(buf.Bytes(), "eXIf", orientationTIFF(8)), MaxWidth, MaxBytes)
+	if err != nil { t.Fatal(err) }
+	cfg, _, err = image.DecodeConfig(bytes.NewReader(out))
+	if err != nil || cfg.Width != MaxWidth || cfg.Height != 307 { t.Errorf("stored %d×%d (%v), want %d×307", cfg.Width, cfg.Height, err, MaxWidth) }
+}
+
+func TestInspect(t *testing.T) {
+	fill := func(w, h int, at func(x, y int) uint8) image.Image {
+		img := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				img.Pix[y*img.Stride+x] = at(x, y)
+			}
+		}
+		return img
+	}
+	checker := func(x, y int) uint8 {
+		if (x/2+y/2)%2 == 0 {
+			return 230
+		}
+		return 30
+	}
+	codes := func(ws []Warning) []string {
+		var out []string
+		for _, w := range ws {
+			out = append(out, w.Code)
+		}
+		return out
+	}
+	tests := []struct {
+		name string
+		img  image.Image
+		want []string
+	}{
+		{"sharp portrait", fill(400, 500, checker), nil},
+		{"flat", fill(400, 500, func(int, int) uint8 { return 128 }), []string{"blurry"}},
+		{"dark strip", fill(100, 600, func(x, y int) uint8 { return checker(x, y) / 8 }), []string{"small", "aspect", "dark"}},
+		{"tiny", fill(16, 16, func(int, int) uint8 { return 0 }), []string{"small", "dark"}},
+	}
+	for _, tt := range tests {
+		if got := codes(Inspect(tt.img)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Inspect = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ { img.Set(x, y, color.RGBA{R: 200, G: uint8(x * 4), B: 40, A: 255}) }
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil { t.Fatal(err) }
+	c, hash, err := Placeholder(buf.Bytes())
+	if err != nil { t.Fatal(err) }
+	if len(hash) != 4+2*PlaceholderX*PlaceholderY { t.Fatalf("hash %q has length %d", hash, len(hash)) }
+	if !strings.HasPrefix(c, "#c8") || len(c) != 7 { t.Errorf("average colour = %s", c) }
+	dec, err := DecodeBlurHash(hash, 8, 1)
+	if err != nil { t.Fatal(err) }
+	left, right := dec.RGBAAt(0, 0), dec.RGBAAt(7, 0)
+	if left.G >= right.G || left.R < 180 || left.B > 80 { t.Errorf("decoded gradient runs %v to %v", left, right) }
+
+	url, err := PlaceholderDataURL(hash)
+	if err != nil { t.Fatal(err) }
+	bmp, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(url, "data:image/bmp;base64,"))
+	if err != nil || len(bmp) != 54+PlaceholderY*((PlaceholderX*3+3)&^3) || string(bmp[:2]) != "BM" { t.Errorf("bitmap %x, %v", bmp, err) }
+
+	for _, bad := range []string{"", "LEHV6", "LEHV6nWB2yk8pyo0adR*.7kCMdnj!", "L\"HV6nWB2yk8pyo0adR*.7kCMdnj"} {
+		if _, err := DecodeBlurHash(bad, 4, 3); !errors.Is(err, ErrBadBlurHash) { t.Errorf("DecodeBlurHash(%q) = %v", bad, err) }
+	}
+	if _, err := DecodeBlurHash("LEHV6nWB2yk8pyo0adR*.7kCMdnj", 4, 3); err != nil { t.Errorf("reference hash: %v", err) }
+}
@@ -0,0 +1,40 @@
+package imaging
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Observer receives measurements of the pipeline, for capacity planning. Calls come from
+// whichever goroutine processes the image, so implementations must be safe for concurrent use.
+type Observer interface {
+	// Stage reports how long one stage took: decode, resize, inspect, or encode, which runs
+	// once per quality attempt (quality is 0 for the other stages).
+	Stage(stage string, quality int, d time.Duration)
+	// Processed reports one Process or ProcessInspect call: the sniffed input format ("jpeg",
+	// "png" or "unknown"), the outcome ("ok" or a failure reason: unsupported, decode,
+	// too_large, encode, too_many_bytes) and the stored size in bytes (0 on failure).
+	Processed(format, outcome string, size int)
+}
+
+var observer atomic.Pointer[Observer]
+
+// SetObserver installs o for all later pipeline runs; nil stops reporting. Without one the
+// pipeline reports nothing.
+func SetObserver(o Observer) {
+	if o == nil {
+		observer.Store(nil)
+		return
+	}
+	observer.Store(&o)
+}
+
+func currentObserver() Observer {
+	if o := observer.Load(); o != nil { return *o }
+	return nopObserver{}
+}
+
+type nopObserver struct{}
+
+func (nopObserver) Stage(string, int, time.Duration) {}
+func (nopObserver) Processed(string, string, int)    {}
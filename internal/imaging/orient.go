@@ -0,0 +1,47 @@
+package imaging
+
+import "image"
+
+// Phones store photos as the sensor read them and record in EXIF how to turn them upright
+// (see orientation). Process applies it to the resized photo: resizing in the stored
+// orientation to the upright size is the same photo, and turns a thousand pixels around
+// instead of the full-size decode.
+
+// transposed reports whether orientation o swaps width and height.
+func transposed(o int) bool { return o >= 5 }
+
+// orient returns img turned upright from EXIF orientation o.
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 { return img }
+	src := canonical(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if transposed(o) { dw, dh = h, w }
+	// The source pixel of output x, y is (ax·x + bx·y + cx, ay·x + by·y + cy).
+	var ax, bx, cx, ay, by, cy int
+	switch o {
+	case 2: // mirrored
+		ax, cx, by = -1, w-1, 1
+	case 3: // upside down
+		ax, cx, by, cy = -1, w-1, -1, h-1
+	case 4: // mirrored upside down
+		ax, by, cy = 1, -1, h-1
+	case 5: // mirrored, turned left
+		bx, ay = 1, 1
+	case 6: // turned left: rotate clockwise
+		bx, ay, cy = 1, -1, h-1
+	case 7: // mirrored, turned right
+		bx, cx, ay, cy = -1, w-1, -1, h-1
+	case 8: // turned right: rotate anticlockwise
+		bx, cx, ay = -1, w-1, 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		out := dst.Pix[y*dst.Stride:][:dw*4]
+		for x := 0; x < dw; x++ {
+			sx, sy := ax*x+bx*y+cx, ay*x+by*y+cy
+			copy(out[x*4:x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
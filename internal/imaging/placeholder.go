@@ -0,0 +1,202 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"strings"
+)
+
+// Placeholder parameters: the BlurHash components stored per photo, and the size of the
+// image they are rendered at for pages (browsers smooth it when scaling it up).
+const (
+	PlaceholderX = 4
+	PlaceholderY = 3
+
+	placeholderSample = 32 // photos are scaled to this width before the transform
+)
+
+// ErrBadBlurHash is returned for a BlurHash that does not decode.
+const ErrBadBlurHash ErrorInvalidImage = "malformed blurhash"
+
+// Placeholder summarizes a stored photo for display while it loads: its average colour as
+// "#rrggbb" and a BlurHash of PlaceholderX×PlaceholderY components.
+func Placeholder(photo []byte) (color, hash string, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(photo))
+	if err != nil { return "", "", fmt.Errorf("decode config: %w", err) }
+	if cfg.Width > maxImageDimension || cfg.Height > maxImageDimension || cfg.Width*cfg.Height > maxImagePixels { return "", "", ErrTooLarge }
+	img, _, err := image.Decode(bytes.NewReader(photo))
+	if err != nil { return "", "", fmt.Errorf("decode: %w", err) }
+	b := img.Bounds()
+	if b.Dx() > placeholderSample { img = resize(img, placeholderSample, max(1, b.Dy()*placeholderSample/b.Dx())) }
+	hash = BlurHash(img, PlaceholderX, PlaceholderY)
+	r, g, bl, _ := blurHashAverage(hash)
+	return fmt.Sprintf("#%02x%02x%02x", r, g, bl), hash, nil
+}
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash encodes img with x by y components (each 1 to 9), see https://blurha.sh.
+func BlurHash(img image.Image, x, y int) string {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	factors := make([][3]float64, 0, x*y)
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			var f [3]float64
+			norm := 2.0
+			if i == 0 && j == 0 { norm = 1 }
+			for py := 0; py < h; py++ {
+				cy := math.Cos(math.Pi * float64(j) * float64(py) / float64(h))
+				for px := 0; px < w; px++ {
+					basis := norm * cy * math.Cos(math.Pi*float64(i)*float64(px)/float64(w))
+					r, g, bl, _ := img.At(b.Min.X+px, b.Min.Y+py).RGBA()
+					f[0] += basis * srgbToLinear(int(r>>8))
+					f[1] += basis * srgbToLinear(int(g>>8))
+					f[2] += basis * srgbToLinear(int(bl>>8))
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{f[0] * scale, f[1] * scale, f[2] * scale})
+		}
+	}
+
+	var sb strings.Builder
+	writeBase83(&sb, (x-1)+(y-1)*9, 1)
+	maxValue := 1.0
+	if len(factors) > 1 {
+		actual := 0.0
+		for _, f := range factors[1:] { actual = max(actual, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2])) }
+		q := min(82, max(0, int(math.Floor(actual*166-0.5))))
+		maxValue = float64(q+1) / 166
+		writeBase83(&sb, q, 1)
+	} else {
+		writeBase83(&sb, 0, 1)
+	}
+	dc := factors[0]
+	writeBase83(&sb, linearToSrgb(dc[0])<<16|linearToSrgb(dc[1])<<8|linearToSrgb(dc[2]), 4)
+	for _, f := range factors[1:] {
+		q := func(v float64) int { return min(18, max(0, int(math.Floor(signPow(v/maxValue, 0.5)*9+9.5)))) }
+		writeBase83(&sb, q(f[0])*19*19+q(f[1])*19+q(f[2]), 2)
+	}
+	return sb.String()
+}
+
+// DecodeBlurHash renders hash at w by h pixels.
+func DecodeBlurHash(hash string, w, h int) (*image.RGBA, error) {
+	if len(hash) < 6 { return nil, ErrBadBlurHash }
+	size, err := readBase83(hash[:1])
+	if err != nil { return nil, err }
+	nx, ny := size%9+1, size/9+1
+	if len(hash) != 4+2*nx*ny { return nil, ErrBadBlurHash }
+	q, err := readBase83(hash[1:2])
+	if err != nil { return nil, err }
+	maxValue := float64(q+1) / 166
+	colors := make([][3]float64, nx*ny)
+	for k := range colors {
+		if k == 0 {
+			v, err := readBase83(hash[2:6])
+			if err != nil { return nil, err }
+			colors[0] = [3]float64{srgbToLinear(v >> 16), srgbToLinear(v >> 8 & 255), srgbToLinear(v & 255)}
+			continue
+		}
+		v, err := readBase83(hash[4+2*k : 6+2*k])
+		if err != nil { return nil, err }
+		ac := func(q int) float64 { return signPow(float64(q-9)/9, 2) * maxValue }
+		colors[k] = [3]float64{ac(v / (19 * 19)), ac(v / 19 % 19), ac(v % 19)}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			var c [3]float64
+			for j := 0; j < ny; j++ {
+				for i := 0; i < nx; i++ {
+					basis := math.Cos(math.Pi*float64(px)*float64(i)/float64(w)) * math.Cos(math.Pi*float64(py)*float64(j)/float64(h))
+					f := colors[i+j*nx]
+					c[0], c[1], c[2] = c[0]+f[0]*basis, c[1]+f[1]*basis, c[2]+f[2]*basis
+				}
+			}
+			o := img.PixOffset(px, py)
+			img.Pix[o], img.Pix[o+1], img.Pix[o+2], img.Pix[o+3] = uint8(linearToSrgb(c[0])), uint8(linearToSrgb(c[1])), uint8(linearToSrgb(c[2])), 255
+		}
+	}
+	return img, nil
+}
+
+// PlaceholderDataURL renders hash as a PlaceholderX by PlaceholderY bitmap in a data: URL,
+// small enough to inline in a page for every card (about 120 bytes).
+func PlaceholderDataURL(hash string) (string, error) {
+	img, err := DecodeBlurHash(hash, PlaceholderX, PlaceholderY)
+	if err != nil { return "", err }
+	return "data:image/bmp;base64," + base64.StdEncoding.EncodeToString(encodeBMP(img)), nil
+}
+
+// encodeBMP writes img as an uncompressed 24-bit BMP, which needs no compressor state and
+// which every browser displays.
+func encodeBMP(img *image.RGBA) []byte {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	stride := (w*3 + 3) &^ 3
+	size := 54 + stride*h
+	buf := make([]byte, size)
+	copy(buf, "BM")
+	le := binary.LittleEndian
+	le.PutUint32(buf[2:], uint32(size))
+	le.PutUint32(buf[10:], 54)
+	le.PutUint32(buf[14:], 40)
+	le.PutUint32(buf[18:], uint32(w))
+	le.PutUint32(buf[22:], uint32(h))
+	le.PutUint16(buf[26:], 1)
+	le.PutUint16(buf[28:], 24)
+	le.PutUint32(buf[34:], uint32(stride*h))
+	for y := 0; y < h; y++ {
+		row := buf[54+(h-1-y)*stride:] // bottom-up
+		for x := 0; x < w; x++ {
+			o := img.PixOffset(x, y)
+			row[x*3], row[x*3+1], row[x*3+2] = img.Pix[o+2], img.Pix[o+1], img.Pix[o]
+		}
+	}
+	return buf
+}
+
+// blurHashAverage is the average colour a BlurHash carries in its DC component.
+func blurHashAverage(hash string) (r, g, b int, err error) {
+	if len(hash) < 6 { return 0, 0, 0, ErrBadBlurHash }
+	v, err := readBase83(hash[2:6])
+	return v >> 16, v >> 8 & 255, v & 255, err
+}
+
+func writeBase83(sb *strings.Builder, v, n int) {
+	for i := 1; i <= n; i++ {
+		d := v
+		for k := 0; k < n-i; k++ { d /= 83 }
+		sb.WriteByte(base83[d%83])
+	}
+}
+
+func readBase83(s string) (int, error) {
+	v := 0
+	for i := 0; i < len(s); i++ {
+		d := strings.IndexByte(base83, s[i])
+		if d < 0 { return 0, ErrBadBlurHash }
+		v = v*83 + d
+	}
+	return v, nil
+}
+
+func srgbToLinear(v int) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 { return f / 12.92 }
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(v float64) int {
+	v = min(1, max(0, v))
+	if v <= 0.0031308 { return int(v*12.92*255 + 0.5) }
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 { return math.Copysign(math.Pow(math.Abs(v), exp), v) }
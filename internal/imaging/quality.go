@@ -0,0 +1,88 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+// Warning is a problem with a photo that doesn't stop it from being stored but that the
+// submitter may want to fix: cards show photos at 160x200 (4:5), cropped to fill.
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Inspect thresholds. They are rough heuristics, tuned to flag photos a person would
+// notice on a card, not to judge photo quality in general.
+const (
+	minShortSide  = 320  // twice the card width, for high-density screens
+	maxAspect     = 2.5  // long side over short side; cards crop to 4:5
+	minBrightness = 40   // mean luma, 0-255
+	minSharpness  = 40.0 // variance of the Laplacian over the center crop
+
+	lumaGrid   = 64  // brightness samples per side
+	sharpCrop  = 256 // side of the center crop sharpness is measured on
+	minSharpPx = 32  // smaller crops are not measured
+)
+
+// Inspect returns the warnings for img, in a stable order: small, aspect, dark, blurry.
+func Inspect(img image.Image) []Warning {
+	var out []Warning
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 { return nil }
+	short, long := min(w, h), max(w, h)
+	if short < minShortSide {
+		out = append(out, Warning{"small", "The photo is small and will look blurry on high-resolution screens; use one at least 320 pixels on its short side."})
+	}
+	if float64(long)/float64(short) > maxAspect {
+		out = append(out, Warning{"aspect", "The photo is very wide or very tall; cards are cropped to a 4:5 portrait, so much of it won't show."})
+	}
+	if meanLuma(img) < minBrightness {
+		out = append(out, Warning{"dark", "The photo looks very dark."})
+	}
+	if s, ok := sharpness(img); ok && s < minSharpness {
+		out = append(out, Warning{"blurry", "The photo looks blurry or out of focus."})
+	}
+	return out
+}
+
+func luma(c color.Color) float64 { return float64(color.GrayModel.Convert(c).(color.Gray).Y) }
+
+// meanLuma averages the brightness of a lumaGrid x lumaGrid sample of img.
+func meanLuma(img image.Image) float64 {
+	b := img.Bounds()
+	var sum float64
+	for i := 0; i < lumaGrid; i++ {
+		for j := 0; j < lumaGrid; j++ {
+			sum += luma(img.At(b.Min.X+(2*j+1)*b.Dx()/(2*lumaGrid), b.Min.Y+(2*i+1)*b.Dy()/(2*lumaGrid)))
+		}
+	}
+	return sum / lumaGrid / lumaGrid
+}
+
+// sharpness is the variance of the 4-neighbour Laplacian of brightness over the center
+// crop of img, where the subject usually is: focused edges give large responses, blur
+// smooths them out. ok is false for images too small to measure.
+func sharpness(img image.Image) (v float64, ok bool) {
+	b := img.Bounds()
+	cw, ch := min(b.Dx(), sharpCrop), min(b.Dy(), sharpCrop)
+	if cw < minSharpPx || ch < minSharpPx { return 0, false }
+	x0, y0 := b.Min.X+(b.Dx()-cw)/2, b.Min.Y+(b.Dy()-ch)/2
+	y := make([][]float64, ch)
+	for i := range y {
+		y[i] = make([]float64, cw)
+		for j := range y[i] { y[i][j] = luma(img.At(x0+j, y0+i)) }
+	}
+	var sum, sq float64
+	n := float64((cw - 2) * (ch - 2))
+	for i := 1; i < ch-1; i++ {
+		for j := 1; j < cw-1; j++ {
+			l := y[i-1][j] + y[i+1][j] + y[i][j-1] + y[i][j+1] - 4*y[i][j]
+			sum += l
+			sq += l * l
+		}
+	}
+	mean := sum / n
+	return sq/n - mean*mean, true
+}
@@ -0,0 +1,210 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Photos are downscaled with a Catmull-Rom filter: each output pixel is a weighted sum of the
+// source pixels around it, the filter stretched by the scale so every source pixel counts
+// (nearest-neighbour sampling skipped most of them and aliased). The weights are integers,
+// derived exactly from the scale, so resizing is as deterministic as encoding (see encode.go)
+// and keeps the golden tests meaningful on every architecture. The two passes, across then
+// down, work on whole rows in buffers allocated once per photo.
+
+// weightBits is the fixed-point precision of the filter weights, which sum to 1<<weightBits.
+const weightBits = 14
+
+// filter holds the weights for resampling one axis: output i is the sum over k below taps of
+// weights[i·taps+k] times input start[i]+k. Windows are padded with zero weights to the same
+// width, shifted inwards at the edges.
+type filter struct {
+	taps    int
+	start   []int
+	weights []int32
+}
+
+// newFilter computes the Catmull-Rom weights for scaling src samples to dst. With
+// d = 2·max(src, dst), the distance from output i to input j in filter units is exactly
+// t = ((2j+1)·dst − (2i+1)·src) / d, so each weight is a ratio of integers, rounded once.
+func newFilter(src, dst int) filter {
+	d := 2 * int64(max(src, dst))
+	first, weights := make([]int, dst), make([][]int32, dst)
+	taps := 0
+	var raw []int64
+	for i := 0; i < dst; i++ {
+		center := int64(2*i+1) * int64(src) // input position times 2·dst
+		lo := max(0, int((center-2*d)/(2*int64(dst)))-1)
+		hi := min(src-1, int((center+2*d)/(2*int64(dst)))+1)
+		raw, first[i] = raw[:0], -1
+		var sum int64
+		for j := lo; j <= hi; j++ {
+			w := catmullRom(int64(2*j+1)*int64(dst)-center, d)
+			if w == 0 && first[i] < 0 { continue }
+			if first[i] < 0 { first[i] = j }
+			raw = append(raw, w)
+			sum += w
+		}
+		for len(raw) > 0 && raw[len(raw)-1] == 0 { raw = raw[:len(raw)-1] }
+		// Normalize to 1<<weightBits, giving the rounding error to the largest weight.
+		ws, total, largest := make([]int32, len(raw)), int32(0), 0
+		for k, w := range raw {
+			ws[k] = int32(divRound(w<<weightBits, sum))
+			total += ws[k]
+			if ws[k] > ws[largest] { largest = k }
+		}
+		ws[largest] += 1<<weightBits - total
+		weights[i], taps = ws, max(taps, len(ws))
+	}
+	f := filter{taps: taps, start: make([]int, dst), weights: make([]int32, dst*taps)}
+	for i, ws := range weights {
+		f.start[i] = min(first[i], src-taps)
+		copy(f.weights[i*taps+first[i]-f.start[i]:], ws)
+	}
+	return f
+}
+
+// catmullRom is the Catmull-Rom kernel at t = n/d, scaled by 2·d³ so it stays an integer.
+func catmullRom(n, d int64) int64 {
+	if n < 0 { n = -n }
+	switch {
+	case n < d:
+		return 3*n*n*n - 5*n*n*d + 2*d*d*d
+	case n < 2*d:
+		return -n*n*n + 5*n*n*d - 8*n*d*d + 4*d*d*d
+	}
+	return 0
+}
+
+// divRound is a/b rounded to the nearest integer, halves away from zero; b is positive.
+func divRound(a, b int64) int64 {
+	if a < 0 { return -((-a + b/2) / b) }
+	return (a + b/2) / b
+}
+
+// clamp8 rounds a weighted sum back to a sample; the kernel's negative lobes can overshoot.
+func clamp8(v int32) uint8 { return uint8(min(255, max(0, (v+1<<(weightBits-1))>>weightBits))) }
+
+// clampPremul is clamp8 for a premultiplied RGBA pixel, also keeping colour within alpha.
+func clampPremul(px *[4]uint8, r, g, b, a int32) {
+	px[3] = clamp8(a)
+	px[0], px[1], px[2] = min(px[3], clamp8(r)), min(px[3], clamp8(g)), min(px[3], clamp8(b))
+}
+
+// resize scales src to newW×newH. The JPEG decoder's YCbCr and Gray images are resized per
+// plane, before converting to RGBA: a third of the work, and the conversion runs on the
+// small image. Other formats are converted row by row as they are read.
+func resize(src image.Image, newW, newH int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	plane := func(dst []uint8, pix []uint8, stride, w, h int) {
+		resample(dst, newW, newH, 1, w, h, func(y int) []uint8 { return pix[y*stride:][:w] })
+	}
+	switch img := src.(type) {
+	case *image.YCbCr:
+		out := image.NewYCbCr(image.Rect(0, 0, newW, newH), image.YCbCrSubsampleRatio444)
+		plane(out.Y, img.Y[img.YOffset(b.Min.X, b.Min.Y):], img.YStride, w, h)
+		cw, ch := chromaSize(img)
+		off := img.COffset(b.Min.X, b.Min.Y)
+		plane(out.Cb, img.Cb[off:], img.CStride, cw, ch)
+		plane(out.Cr, img.Cr[off:], img.CStride, cw, ch)
+		return canonical(out)
+	case *image.Gray:
+		out := image.NewGray(image.Rect(0, 0, newW, newH))
+		plane(out.Pix, img.Pix[img.PixOffset(b.Min.X, b.Min.Y):], img.Stride, w, h)
+		return canonical(out)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, newW, newH))
+	if rgba, ok := src.(*image.RGBA); ok {
+		pix := rgba.Pix[rgba.PixOffset(b.Min.X, b.Min.Y):]
+		resample(dst.Pix, newW, newH, 4, w, h, func(y int) []uint8 { return pix[y*rgba.Stride:][:w*4] })
+		return dst
+	}
+	row := image.NewRGBA(image.Rect(0, 0, w, 1))
+	resample(dst.Pix, newW, newH, 4, w, h, func(y int) []uint8 {
+		draw.Draw(row, row.Rect, src, image.Pt(b.Min.X, b.Min.Y+y), draw.Src)
+		return row.Pix
+	})
+	return dst
+}
+
+// chromaSize is the size of img's Cb and Cr planes.
+func chromaSize(img *image.YCbCr) (w, h int) {
+	r := img.Rect
+	w, h = r.Dx(), r.Dy()
+	switch img.SubsampleRatio {
+	case image.YCbCrSubsampleRatio422:
+		w = (r.Max.X+1)/2 - r.Min.X/2
+	case image.YCbCrSubsampleRatio420:
+		w, h = (r.Max.X+1)/2-r.Min.X/2, (r.Max.Y+1)/2-r.Min.Y/2
+	case image.YCbCrSubsampleRatio440:
+		h = (r.Max.Y+1)/2 - r.Min.Y/2
+	case image.YCbCrSubsampleRatio411:
+		w = (r.Max.X+3)/4 - r.Min.X/4
+	case image.YCbCrSubsampleRatio410:
+		w, h = (r.Max.X+3)/4-r.Min.X/4, (r.Max.Y+1)/2-r.Min.Y/2
+	}
+	return w, h
+}
+
+// resample scales a w×h image of 1 (a plane) or 4 (premultiplied RGBA) channels, whose row y
+// row returns, into dst, newW×newH packed.
+func resample(dst []uint8, newW, newH, channels, w, h int, row func(y int) []uint8) {
+	fx, fy := newFilter(w, newW), newFilter(h, newH)
+	stride := newW * channels
+
+	// Across: each source row into tmp.
+	tmp := make([]uint8, stride*h)
+	across := acrossRGBA
+	if channels == 1 { across = acrossPlane }
+	for y := 0; y < h; y++ { across(tmp[y*stride:][:stride], row(y), fx) }
+
+	// Down: each output row accumulates the tmp rows its filter covers.
+	acc := make([]int32, stride)
+	for y := 0; y < newH; y++ {
+		clear(acc)
+		for k, wt := range fy.weights[y*fy.taps:][:fy.taps] {
+			in := tmp[(fy.start[y]+k)*stride:][:stride]
+			if wt == 0 { continue }
+			acc := acc[:len(in)]
+			for i, v := range in { acc[i] += wt * int32(v) }
+		}
+		out := dst[y*stride:][:stride]
+		if channels == 1 {
+			for i, v := range acc { out[i] = clamp8(v) }
+			continue
+		}
+		for x := 0; x < newW; x++ {
+			clampPremul((*[4]uint8)(out[x*4:]), acc[x*4], acc[x*4+1], acc[x*4+2], acc[x*4+3])
+		}
+	}
+}
+
+// acrossPlane resamples one row of a plane.
+func acrossPlane(out, in []uint8, f filter) {
+	for x := range out {
+		ws := f.weights[x*f.taps:][:f.taps]
+		p := in[f.start[x]:][:len(ws)]
+		var v int32
+		for k, wt := range ws { v += wt * int32(p[k]) }
+		out[x] = clamp8(v)
+	}
+}
+
+// acrossRGBA resamples one row of premultiplied RGBA.
+func acrossRGBA(out, in []uint8, f filter) {
+	for x := 0; x < len(out)/4; x++ {
+		ws := f.weights[x*f.taps:][:f.taps]
+		p := in[f.start[x]*4:][:len(ws)*4]
+		var r, g, b, a int32
+		for _, wt := range ws {
+			px := (*[4]uint8)(p)
+			r += wt * int32(px[0])
+			g += wt * int32(px[1])
+			b += wt * int32(px[2])
+			a += wt * int32(px[3])
+			p = p[4:]
+		}
+		clampPremul((*[4]uint8)(out[x*4:]), r, g, b, a)
+	}
+}
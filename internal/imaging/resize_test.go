@@ -0,0 +1,80 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFilterWeights(t *testing.T) {
+	for _, c := range [][2]int{{4000, 1024}, {1600, 1024}, {1025, 1024}, {3, 1}, {1, 1}, {7, 7}, {10, 3}, {2, 5}} {
+		f := newFilter(c[0], c[1])
+		for i := range f.start {
+			ws := f.weights[i*f.taps:][:f.taps]
+			var sum int32
+			for _, w := range ws { sum += w }
+			if sum != 1<<weightBits || f.start[i] < 0 || f.start[i]+f.taps > c[0] {
+				t.Fatalf("%d→%d: output %d takes inputs %d+%d weighted %v (sum %d)", c[0], c[1], i, f.start[i], f.taps, ws, sum)
+			}
+		}
+	}
+	// Same size is the identity: t is a whole number at every tap, where the kernel is 0 but at 0.
+	f := newFilter(5, 5)
+	for i := range f.start {
+		if f.taps != 1 || f.start[i] != i || f.weights[i] != 1<<weightBits { t.Errorf("5→5: output %d = %d+%d", i, f.start[i], f.taps) }
+	}
+}
+
+func TestResize(t *testing.T) {
+	// A flat colour stays flat, whatever the source format.
+	flat := image.NewNRGBA(image.Rect(3, 5, 203, 105))
+	for i := 0; i < len(flat.Pix); i += 4 { copy(flat.Pix[i:], []uint8{200, 100, 50, 128}) }
+	want := color.RGBAModel.Convert(flat.At(3, 5)).(color.RGBA)
+	got := resize(flat, 64, 32)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			if c := got.RGBAAt(x, y); c != want { t.Fatalf("flat pixel %d,%d = %v, want %v", x, y, c, want) }
+		}
+	}
+
+	// A hard edge overshoots, which must stay valid premultiplied colour.
+	edge := image.NewRGBA(image.Rect(0, 0, 40, 4))
+	for x := 20; x < 40; x++ {
+		for y := 0; y < 4; y++ { edge.SetRGBA(x, y, color.RGBA{255, 255, 255, 255}) }
+	}
+	for i := 0; i < 20; i++ { edge.Pix[i*4+3] = 90 }
+	got = resize(edge, 13, 2)
+	for i := 0; i < len(got.Pix); i += 4 {
+		if p := got.Pix[i : i+4]; p[0] > p[3] || p[1] > p[3] || p[2] > p[3] { t.Fatalf("pixel %d = %v exceeds its alpha", i/4, p) }
+	}
+
+	// Every source pixel counts: a 1px line on a 4× downscale isn't skipped, unlike sampling.
+	lines := image.NewGray(image.Rect(0, 0, 400, 10))
+	for y := 0; y < 10; y++ { lines.SetGray(201, y, color.Gray{255}) }
+	got = resize(lines, 100, 10)
+	if c := got.RGBAAt(50, 5); c.R < 40 { t.Errorf("the line fades to %v", c) }
+
+	if got := resize(image.NewRGBA(image.Rect(0, 0, 4000, 3)), 1024, 1); got.Rect.Dx() != 1024 || got.Rect.Dy() != 1 { t.Errorf("strip resized to %v", got.Rect) }
+}
+
+// benchmarkPhoto is a 4000×3000 camera-sized source in the decoder's format for JPEGs.
+func benchmarkPhoto() image.Image {
+	img := image.NewYCbCr(image.Rect(0, 0, 4000, 3000), image.YCbCrSubsampleRatio420)
+	for i := range img.Y { img.Y[i] = uint8(i * 31) }
+	for i := range img.Cb { img.Cb[i], img.Cr[i] = uint8(i*7), uint8(i*13) }
+	return img
+}
+
+func BenchmarkResize(b *testing.B) {
+	src := benchmarkPhoto()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ { resize(src, MaxWidth, 768) }
+}
+
+func BenchmarkResizeRGBA(b *testing.B) {
+	src := canonical(benchmarkPhoto())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ { resize(src, MaxWidth, 768) }
+}
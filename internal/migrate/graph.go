@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Migrations may name the ones they build on in their leading comments:
+//
+//	-- requires: 030_voters.sql, 015_votes_counted.sql
+//
+// Up applies a file only after what it requires, even one numbered after it, and otherwise in
+// file name order as before; it refuses, before applying anything, a file whose requirements
+// are neither applied nor about to be (held back by -to or an environment guard). Down
+// refuses to roll back a migration an applied one still requires. A requirement naming no
+// migration, or a cycle, fails every action: that is how a branch merged without the
+// migration it was written against shows up, at the latest when its migrations are read.
+
+// graph maps each forward file to the forward files it requires.
+type graph map[string][]string
+
+// requirements returns the files named by "-- requires:" lines (comma or space separated) in
+// the leading comment block of a migration.
+func requirements(sqlText string) []string {
+	var out []string
+	for _, line := range strings.Split(sqlText, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" { continue }
+		rest, ok := strings.CutPrefix(line, "--")
+		if !ok { break }
+		if v, ok := strings.CutPrefix(strings.TrimSpace(rest), "requires:"); ok {
+			out = append(out, strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })...)
+		}
+	}
+	return out
+}
+
+// readGraph reads what each of migrations requires. A requirement may name the forward file
+// or leave out its .sql or .up.sql suffix.
+func readGraph(fsys fs.FS, migrations []migration) (graph, error) {
+	byName := map[string]string{}
+	for _, m := range migrations {
+		byName[m.Up] = m.Up
+		byName[strings.TrimSuffix(strings.TrimSuffix(m.Up, ".sql"), ".up")] = m.Up
+	}
+	g := graph{}
+	for _, m := range migrations {
+		sqlBytes, err := fs.ReadFile(fsys, m.Up)
+		if err != nil { return nil, fmt.Errorf("read %s: %w", m.Up, err) }
+		for _, name := range requirements(string(sqlBytes)) {
+			req, ok := byName[strings.TrimSuffix(name, ".down.sql")]
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("%s requires %s, which is not among the migrations", m.Up, name)
+			case req == m.Up:
+				return nil, fmt.Errorf("%s requires itself", m.Up)
+			case !slices.Contains(g[m.Up], req):
+				g[m.Up] = append(g[m.Up], req)
+			}
+		}
+	}
+	return g, nil
+}
+
+// order returns migrations in the order Up applies them: each after what it requires,
+// otherwise by file name. migrations must be in file name order.
+func (g graph) order(migrations []migration) ([]migration, error) {
+	out := make([]migration, 0, len(migrations))
+	placed := map[string]bool{}
+	left := slices.Clone(migrations)
+	for len(left) > 0 {
+		i := slices.IndexFunc(left, func(m migration) bool {
+			for _, req := range g[m.Up] {
+				if !placed[req] { return false }
+			}
+			return true
+		})
+		if i < 0 {
+			names := make([]string, len(left))
+			for i, m := range left { names[i] = m.Up }
+			return nil, fmt.Errorf("migrations require each other in a cycle: %s", strings.Join(names, ", "))
+		}
+		out = append(out, left[i])
+		placed[left[i].Up] = true
+		left = slices.Delete(left, i, i+1)
+	}
+	return out, nil
+}
+
+// checkUp refuses files (to be applied in this order) requiring one that is neither applied
+// nor earlier among them.
+func (g graph) checkUp(files []string, applied map[string]time.Time) error {
+	done := map[string]bool{}
+	for _, f := range files {
+		for _, req := range g[f] {
+			if _, ok := applied[req]; !ok && !done[req] { return fmt.Errorf("%s requires %s, which is not applied and would not be applied before it", f, req) }
+		}
+		done[f] = true
+	}
+	return nil
+}
+
+// checkDown refuses a rollback plan leaving an applied migration without one it requires.
+func (g graph) checkDown(plan []migration, applied map[string]time.Time) error {
+	leaving := map[string]bool{}
+	for _, m := range plan { leaving[m.Up] = true }
+	for f := range applied {
+		if leaving[f] { continue }
+		for _, req := range g[f] {
+			if leaving[req] { return fmt.Errorf("cannot roll back %s: %s requires it", req, f) }
+		}
+	}
+	return nil
+}
+
+// Graph reads the migrations in fsys and checks their requirements, returning them in the
+// order Up applies them with what each requires. It doesn't need a database.
+func Graph(fsys fs.FS) ([]string, map[string][]string, error) {
+	migrations, g, err := readOrdered(fsys)
+	if err != nil { return nil, nil, err }
+	files := make([]string, len(migrations))
+	for i, m := range migrations { files[i] = m.Up }
+	return files, g, nil
+}
+
+// WriteGraph prints the migrations in fsys in the order Up applies them, each followed by
+// what it requires.
+func WriteGraph(w io.Writer, fsys fs.FS) error {
+	files, g, err := Graph(fsys)
+	if err != nil { return err }
+	for _, f := range files {
+		if reqs := g[f]; len(reqs) > 0 { f += " <- " + strings.Join(reqs, ", ") }
+		if _, err := fmt.Fprintln(w, f); err != nil { return err }
+	}
+	return nil
+}
+
+// readOrdered is readMigrations in the order Up applies them, with their requirements.
+func readOrdered(fsys fs.FS) ([]migration, graph, error) {
+	migrations, err := readMigrations(fsys)
+	if err != nil { return nil, nil, fmt.Errorf("read migrations: %w", err) }
+	g, err := readGraph(fsys, migrations)
+	if err != nil { return nil, nil, err }
+	migrations, err = g.order(migrations)
+	return migrations, g, err
+}
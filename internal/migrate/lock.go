@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Up and Down hold the migration lock while they run, so replicas started with
+// LEADERBOARD_AUTO_MIGRATE don't race each other or an operator's migrator. It is an advisory
+// lock kept in schema_migration_lock, since CockroachDB accepts pg_advisory_lock without
+// locking anything. The lock is a lease renewed while its holder works: one that dies
+// without releasing it blocks the others for at most lockTTL.
+const (
+	lockTTL   = 30 * time.Second
+	lockRetry = 2 * time.Second
+)
+
+// lock waits until it holds the migration lock and returns the func that releases it.
+func lock(ctx context.Context, log *slog.Logger, db *sql.DB) (func(), error) {
+	host, _ := os.Hostname()
+	nonce := make([]byte, 4)
+	rand.Read(nonce)
+	holder := fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(nonce))
+	for waited := false; ; waited = true {
+		var got string
+		err := db.QueryRowContext(ctx, `
+			INSERT INTO schema_migration_lock (id, holder, expires_at) VALUES (1, $1, now() + $2::INT * interval '1 second')
+			ON CONFLICT (id) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+			WHERE schema_migration_lock.expires_at < now()
+			RETURNING holder
+		`, holder, int(lockTTL/time.Second)).Scan(&got)
+		if err == nil { break }
+		if err != sql.ErrNoRows { return nil, fmt.Errorf("take migration lock: %w", err) }
+		if !waited {
+			var other string
+			_ = db.QueryRowContext(ctx, `SELECT holder FROM schema_migration_lock WHERE id = 1`).Scan(&other)
+			log.Info("waiting for the migration lock", "holder", other)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetry):
+		}
+	}
+	log.Info("migration lock taken", "holder", holder)
+
+	renewCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(lockTTL / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-t.C:
+			}
+			_, err := db.ExecContext(renewCtx, `
+				UPDATE schema_migration_lock SET expires_at = now() + $2::INT * interval '1 second' WHERE id = 1 AND holder = $1
+			`, holder, int(lockTTL/time.Second))
+			if err != nil && renewCtx.Err() == nil { log.Error("renew migration lock", "err", err) }
+		}
+	}()
+	return func() {
+		stop()
+		<-done
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if _, err := db.ExecContext(ctx, `DELETE FROM schema_migration_lock WHERE id = 1 AND holder = $1`, holder); err != nil {
+			log.Error("release migration lock", "err", err)
+		}
+	}, nil
+}
@@ -0,0 +1,583 @@
+// Package migrate applies the SQL files in migrations/ and records them in schema_migrations,
+// and rolls them back with their .down.sql pairs.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Production is the environment name env=prod-only migrations are meant for; an empty name
+// counts as production too.
+const Production = "production"
+
+// Environment guards a migration may declare with a "-- migrate: env=..." comment.
+const (
+	envProdOnly = "prod-only" // applied only in production, e.g. backfills sized for real data
+	envDevOnly  = "dev-only"  // never applied in production, e.g. seed data or drops
+)
+
+// Latest as Options.To means no target: Up applies every pending migration and Down rolls
+// back only the newest applied one.
+const Latest = -1
+
+// Options tune Up and Down.
+type Options struct {
+	Env      string    // the deployment (LEADERBOARD_ENV); see Run
+	To       int       // target version, a migration number, or Latest
+	DryRun   bool      // print the SQL that would run to Out instead of running it
+	Out      io.Writer // where dry runs and status print; os.Stdout when nil
+	Parallel int       // how many files marked "-- migrate: parallel" Up applies at once (see parallel.go); 0 or 1 is one at a time
+}
+
+func (o Options) out() io.Writer {
+	if o.Out == nil { return os.Stdout }
+	return o.Out
+}
+
+// migration is one numbered migration: its forward file, NNN_name.sql or NNN_name.up.sql,
+// and the NNN_name.down.sql that undoes it, if there is one. schema_migrations records the
+// forward file's name.
+type migration struct {
+	Version int
+	Up      string
+	Down    string
+}
+
+// Run applies the migrations in fsys that schema_migrations doesn't list yet, in file name
+// order, except that a file comes after the ones it requires (see graph.go). Each file runs in one transaction, or statement by statement when it starts with a
+// "-- migrate: no-transaction" comment. env is the deployment (LEADERBOARD_ENV): files with
+// "-- migrate: env=prod-only" are skipped outside production and "-- migrate: env=dev-only"
+// ones in production. Skipped files are not recorded, so they stay pending. Guards are
+// checked for every pending file before any is applied.
+func Run(ctx context.Context, log *slog.Logger, db *sql.DB, fsys fs.FS, env string) error {
+	return Up(ctx, log, db, fsys, Options{Env: env, To: Latest})
+}
+
+// Up is Run up to version o.To (every pending migration numbered o.To or lower), or, with
+// o.DryRun, prints what it would run without touching the database.
+func Up(ctx context.Context, log *slog.Logger, db *sql.DB, fsys fs.FS, o Options) error {
+	if !o.DryRun {
+		if err := ensureSchemaMigrations(ctx, db); err != nil { return fmt.Errorf("ensure schema_migrations: %w", err) }
+		unlock, err := lock(ctx, log, db)
+		if err != nil { return err }
+		defer unlock()
+	}
+	migrations, g, err := readOrdered(fsys)
+	if err != nil { return err }
+	applied, err := getAppliedMigrations(ctx, db)
+	if err != nil { return fmt.Errorf("get applied: %w", err) }
+
+	var files []string
+	pending := map[string]string{}
+	for _, m := range upPlan(migrations, applied, o.To) {
+		sqlBytes, err := fs.ReadFile(fsys, m.Up)
+		if err != nil { return fmt.Errorf("read %s: %w", m.Up, err) }
+		guard, err := envDirective(string(sqlBytes))
+		if err != nil { return fmt.Errorf("%s: %w", m.Up, err) }
+		if !guardAllows(guard, o.Env) {
+			log.Info("skipping", "file", m.Up, "guard", guard, "env", cmp.Or(o.Env, Production))
+			continue
+		}
+		files = append(files, m.Up)
+		pending[m.Up] = string(sqlBytes)
+	}
+	if err := g.checkUp(files, applied); err != nil { return err }
+	for _, batch := range batches(files, pending, g, o.Parallel > 1) {
+		if o.DryRun {
+			printBatch(o.out(), batch)
+			for _, f := range batch { printScript(o.out(), "up", f, pending[f]) }
+			continue
+		}
+		if err := applyBatch(ctx, log, db, batch, pending, o.Parallel); err != nil { return err }
+	}
+	if o.DryRun && len(files) == 0 { fmt.Fprintln(o.out(), "-- nothing to apply") }
+	log.Info("done")
+	return nil
+}
+
+// Down rolls back the applied migrations numbered above o.To, newest first, or only the
+// newest one when o.To is Latest. Each runs its .down.sql file and drops its
+// schema_migrations row in one transaction, or statement by statement for a down file with
+// "-- migrate: no-transaction" (make those idempotent: a rerun after a failure repeats them
+// all). Every migration to roll back must have a down file, which is checked before any
+// runs, as is that no applied migration left in place requires one of them. With o.DryRun it
+// prints the down files instead.
+func Down(ctx context.Context, log *slog.Logger, db *sql.DB, fsys fs.FS, o Options) error {
+	if !o.DryRun {
+		if err := ensureSchemaMigrations(ctx, db); err != nil { return fmt.Errorf("ensure schema_migrations: %w", err) }
+		unlock, err := lock(ctx, log, db)
+		if err != nil { return err }
+		defer unlock()
+	}
+	migrations, g, err := readOrdered(fsys)
+	if err != nil { return err }
+	applied, err := getAppliedMigrations(ctx, db)
+	if err != nil { return fmt.Errorf("get applied: %w", err) }
+	plan, err := downPlan(migrations, applied, o.To)
+	if err != nil { return err }
+	if err := g.checkDown(plan, applied); err != nil { return err }
+
+	scripts := make([]string, len(plan))
+	for i, m := range plan {
+		sqlBytes, err := fs.ReadFile(fsys, m.Down)
+		if err != nil { return fmt.Errorf("read %s: %w", m.Down, err) }
+		scripts[i] = string(sqlBytes)
+	}
+	for i, m := range plan {
+		if o.DryRun {
+			printScript(o.out(), "down", m.Down, scripts[i])
+			continue
+		}
+		log.Info("rolling back", "file", m.Up, "down", m.Down)
+		if hasDirective(scripts[i], "no-transaction") {
+			err = revertMigrationNoTx(ctx, db, m.Up, scripts[i])
+		} else {
+			err = revertMigration(ctx, db, m.Up, scripts[i])
+		}
+		if err != nil { return fmt.Errorf("roll back %s: %w", m.Up, err) }
+		log.Info("rolled back", "file", m.Up)
+	}
+	if o.DryRun && len(plan) == 0 { fmt.Fprintln(o.out(), "-- nothing to roll back") }
+	log.Info("done")
+	return nil
+}
+
+// upPlan returns the migrations not applied yet and numbered to or lower, in the order of
+// migrations.
+func upPlan(migrations []migration, applied map[string]time.Time, to int) []migration {
+	var plan []migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Up]; ok || to != Latest && m.Version > to { continue }
+		plan = append(plan, m)
+	}
+	return plan
+}
+
+// downPlan returns the applied migrations to roll back to version to, the reverse of the
+// order of migrations (applied ones whose files are gone count as the newest). An applied
+// migration without a down file, or whose files are gone, is an error.
+func downPlan(migrations []migration, applied map[string]time.Time, to int) ([]migration, error) {
+	byUp, pos := map[string]migration{}, map[string]int{}
+	for i, m := range migrations { byUp[m.Up], pos[m.Up] = m, i }
+	var versions []string
+	for v := range applied { versions = append(versions, v) }
+	sort.Slice(versions, func(i, j int) bool {
+		pi, iok := pos[versions[i]]
+		pj, jok := pos[versions[j]]
+		if iok && jok { return pi > pj }
+		if iok != jok { return jok }
+		return versions[i] > versions[j]
+	})
+	if to == Latest && len(versions) > 1 { versions = versions[:1] }
+	var plan []migration
+	for _, v := range versions {
+		m, ok := byUp[v]
+		if !ok { m = migration{Version: versionOf(v), Up: v} }
+		if to != Latest && m.Version <= to { continue }
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("cannot roll back %s: its file is not among the migrations", v)
+		case m.Down == "":
+			return nil, fmt.Errorf("cannot roll back %s: it has no .down.sql file", v)
+		}
+		plan = append(plan, m)
+	}
+	return plan, nil
+}
+
+// State is where one migration stands in a database.
+type State struct {
+	Version   int
+	File      string    // the forward file, as schema_migrations records it
+	Down      string    // the down file, "" when it can't be rolled back
+	Applied   bool
+	AppliedAt time.Time
+	Skipped   string    // for a pending file, the environment guard that keeps it from applying here
+	Missing   bool      // applied, but the file is no longer among the migrations
+	Requires  []string  // the forward files it requires (see graph.go)
+}
+
+// Status lists the migrations in fsys and those schema_migrations records, in order, with
+// whether each is applied. It only reads the database.
+func Status(ctx context.Context, db *sql.DB, fsys fs.FS, env string) ([]State, error) {
+	migrations, g, err := readOrdered(fsys)
+	if err != nil { return nil, err }
+	applied, err := getAppliedMigrations(ctx, db)
+	if err != nil { return nil, fmt.Errorf("get applied: %w", err) }
+	var states []State
+	for _, m := range migrations {
+		st := State{Version: m.Version, File: m.Up, Down: m.Down, Requires: g[m.Up]}
+		st.AppliedAt, st.Applied = applied[m.Up]
+		delete(applied, m.Up)
+		if !st.Applied {
+			sqlBytes, err := fs.ReadFile(fsys, m.Up)
+			if err != nil { return nil, fmt.Errorf("read %s: %w", m.Up, err) }
+			guard, err := envDirective(string(sqlBytes))
+			if err != nil { return nil, fmt.Errorf("%s: %w", m.Up, err) }
+			if !guardAllows(guard, env) { st.Skipped = guard }
+		}
+		states = append(states, st)
+	}
+	for v, at := range applied {
+		states = append(states, State{Version: versionOf(v), File: v, Applied: true, AppliedAt: at, Missing: true})
+	}
+	sort.SliceStable(states, func(i, j int) bool { return states[i].File < states[j].File })
+	return states, nil
+}
+
+// WriteStatus prints states as a table.
+func WriteStatus(w io.Writer, states []State) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tFILE\tSTATE\tDOWN")
+	for _, st := range states {
+		state := "pending"
+		switch {
+		case st.Missing:
+			state = "applied " + st.AppliedAt.UTC().Format(time.DateTime) + ", file missing"
+		case st.Applied:
+			state = "applied " + st.AppliedAt.UTC().Format(time.DateTime)
+		case st.Skipped != "":
+			state = "pending, skipped here (env=" + st.Skipped + ")"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", st.Version, st.File, state, cmp.Or(st.Down, "-"))
+	}
+	return tw.Flush()
+}
+
+// Actions are the migrator's subcommands, shared by `app migrate` and cmd/migrate; up is the
+// default. graph is the only one not using the database, which may then be nil.
+var Actions = []string{"up", "down", "status", "dry-run", "graph"}
+
+// Do runs one of Actions: dry-run is up with o.DryRun; status and graph print to o.Out.
+func Do(ctx context.Context, log *slog.Logger, db *sql.DB, fsys fs.FS, action string, o Options) error {
+	switch action {
+	case "graph":
+		return WriteGraph(o.out(), fsys)
+	case "up", "":
+		return Up(ctx, log, db, fsys, o)
+	case "dry-run":
+		o.DryRun = true
+		return Up(ctx, log, db, fsys, o)
+	case "down":
+		return Down(ctx, log, db, fsys, o)
+	case "status":
+		states, err := Status(ctx, db, fsys, o.Env)
+		if err != nil { return err }
+		return WriteStatus(o.out(), states)
+	}
+	return fmt.Errorf("unknown migrate action %q (want %s)", action, strings.Join(Actions, ", "))
+}
+
+// printScript writes a migration file to w as a dry run shows it.
+func printScript(w io.Writer, direction, file, sqlText string) {
+	fmt.Fprintf(w, "-- %s: %s\n%s\n\n", direction, file, strings.TrimSpace(sqlText))
+}
+
+func ensureSchemaMigrations(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version STRING PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		);
+		CREATE TABLE IF NOT EXISTS schema_migration_steps (
+			version STRING NOT NULL,
+			step INT NOT NULL,
+			status STRING NOT NULL,
+			error STRING NOT NULL DEFAULT '',
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+			PRIMARY KEY (version, step)
+		);
+		CREATE TABLE IF NOT EXISTS schema_migration_lock (
+			id INT PRIMARY KEY CHECK (id = 1),
+			holder STRING NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+	`)
+	return err
+}
+
+// readMigrations pairs the .sql files in fsys into migrations, in file name order. A file is
+// a forward one unless it ends in .down.sql; NNN_name.down.sql belongs to NNN_name.up.sql
+// or NNN_name.sql. Every name must start with its version number.
+func readMigrations(fsys fs.FS) ([]migration, error) {
+	byBase := map[string]*migration{}
+	var downs []string
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil { return err }
+		if d.IsDir() { return nil }
+		name := d.Name()
+		lower := strings.ToLower(name)
+		if !strings.HasSuffix(lower, ".sql") { return nil }
+		if strings.HasSuffix(lower, ".down.sql") {
+			downs = append(downs, name)
+			return nil
+		}
+		base := name[:len(name)-len(".sql")]
+		if strings.HasSuffix(lower, ".up.sql") { base = name[:len(name)-len(".up.sql")] }
+		if m, ok := byBase[base]; ok { return fmt.Errorf("%s and %s are the same migration", m.Up, name) }
+		v := versionOf(name)
+		if v < 0 { return fmt.Errorf("%s: migration names start with a version number", name) }
+		byBase[base] = &migration{Version: v, Up: name}
+		return nil
+	})
+	if err != nil { return nil, err }
+	for _, name := range downs {
+		m, ok := byBase[name[:len(name)-len(".down.sql")]]
+		if !ok { return nil, fmt.Errorf("%s has no forward migration", name) }
+		m.Down = name
+	}
+	migrations := make([]migration, 0, len(byBase))
+	for _, m := range byBase { migrations = append(migrations, *m) }
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Up < migrations[j].Up })
+	return migrations, nil
+}
+
+// versionOf parses the numeric prefix of a migration file name ("006_profile_pins.sql" is
+// 6), or returns -1 when it has none.
+func versionOf(name string) int {
+	digits := name[:len(name)-len(strings.TrimLeft(name, "0123456789"))]
+	n, err := strconv.Atoi(digits)
+	if err != nil { return -1 }
+	return n
+}
+
+// getAppliedMigrations returns when each recorded migration was applied; none when
+// schema_migrations doesn't exist yet, so dry runs and status work on an empty database.
+func getAppliedMigrations(ctx context.Context, db *sql.DB) (map[string]time.Time, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations')
+	`).Scan(&exists)
+	if err != nil || !exists { return map[string]time.Time{}, err }
+	rows, err := db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	m := make(map[string]time.Time)
+	for rows.Next() {
+		var v string
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil { return nil, err }
+		m[v] = at
+	}
+	return m, rows.Err()
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, version, sqlText string) error {
+	return withTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqlText); err != nil { return err }
+		_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+		return err
+	})
+}
+
+// revertMigration runs a down file and forgets version, in one transaction.
+func revertMigration(ctx context.Context, db *sql.DB, version, sqlText string) error {
+	return withTx(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, sqlText); err != nil { return err }
+		return forget(ctx, tx, version)
+	})
+}
+
+// revertMigrationNoTx runs a "-- migrate: no-transaction" down file statement by statement,
+// then forgets version. Nothing tracks its progress, so a rerun starts from the top.
+func revertMigrationNoTx(ctx context.Context, db *sql.DB, version, sqlText string) error {
+	stmts := splitStatements(sqlText)
+	for i, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil { return fmt.Errorf("step %d of %d: %w", i+1, len(stmts), err) }
+	}
+	return withTx(ctx, db, func(tx *sql.Tx) error { return forget(ctx, tx, version) })
+}
+
+// forget drops version's records, so it is pending again.
+func forget(ctx context.Context, tx *sql.Tx, version string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, version); err != nil { return err }
+	_, err := tx.ExecContext(ctx, `DELETE FROM schema_migration_steps WHERE version = $1`, version)
+	return err
+}
+
+// applyMigrationNoTx runs a "-- migrate: no-transaction" file statement by statement, for DDL
+// such as CREATE INDEX CONCURRENTLY that cannot run inside a transaction. Each statement's
+// outcome is recorded in schema_migration_steps so a rerun after a failure resumes with the
+// failed statement instead of repeating ones that already took effect.
+func applyMigrationNoTx(ctx context.Context, log *slog.Logger, db *sql.DB, version, sqlText string) error {
+	stmts := splitStatements(sqlText)
+	done, err := getAppliedSteps(ctx, db, version)
+	if err != nil { return fmt.Errorf("get applied steps: %w", err) }
+	for i, stmt := range stmts {
+		step := i + 1
+		if done[step] { continue }
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			if rerr := recordStep(ctx, db, version, step, "failed", err.Error()); rerr != nil {
+				log.Error("record failed step", "file", version, "step", step, "err", rerr)
+			}
+			return fmt.Errorf("step %d of %d: %w", step, len(stmts), err)
+		}
+		if err := recordStep(ctx, db, version, step, "applied", ""); err != nil {
+			return fmt.Errorf("record step %d: %w", step, err)
+		}
+		log.Info("applied step", "file", version, "step", step, "of", len(stmts))
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, version)
+	return err
+}
+
+func getAppliedSteps(ctx context.Context, db *sql.DB, version string) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT step FROM schema_migration_steps WHERE version = $1 AND status = 'applied'`, version)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	m := make(map[int]bool)
+	for rows.Next() {
+		var step int
+		if err := rows.Scan(&step); err != nil { return nil, err }
+		m[step] = true
+	}
+	return m, rows.Err()
+}
+
+func recordStep(ctx context.Context, db *sql.DB, version string, step int, status, errText string) error {
+	_, err := db.ExecContext(ctx, `
+		UPSERT INTO schema_migration_steps (version, step, status, error, updated_at) VALUES ($1, $2, $3, $4, now())
+	`, version, step, status, errText)
+	return err
+}
+
+// hasDirective reports whether the leading comment block of a migration contains
+// "-- migrate: <name>". Directives after the first statement are ignored.
+func hasDirective(sqlText, name string) bool {
+	for _, d := range directives(sqlText) {
+		if strings.EqualFold(d, name) { return true }
+	}
+	return false
+}
+
+// envDirective returns the environment guard of a migration ("prod-only", "dev-only"), or ""
+// when it has none. A misspelt or repeated guard is an error rather than no guard.
+func envDirective(sqlText string) (string, error) {
+	guard := ""
+	for _, d := range directives(sqlText) {
+		k, v, ok := strings.Cut(d, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(k), "env") { continue }
+		v = strings.ToLower(strings.TrimSpace(v))
+		if v != envProdOnly && v != envDevOnly { return "", fmt.Errorf("unknown migrate directive env=%s (want %s or %s)", v, envProdOnly, envDevOnly) }
+		if guard != "" && guard != v { return "", fmt.Errorf("conflicting migrate directives env=%s and env=%s", guard, v) }
+		guard = v
+	}
+	return guard, nil
+}
+
+// guardAllows reports whether a migration with the environment guard may run in env.
+func guardAllows(guard, env string) bool {
+	prod := env == "" || strings.EqualFold(env, Production)
+	return !(guard == envProdOnly && !prod || guard == envDevOnly && prod)
+}
+
+// directives returns the values of the "-- migrate: <value>" lines in the leading comment
+// block of a migration.
+func directives(sqlText string) []string {
+	var out []string
+	for _, line := range strings.Split(sqlText, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" { continue }
+		rest, ok := strings.CutPrefix(line, "--")
+		if !ok { break }
+		if v, ok := strings.CutPrefix(strings.TrimSpace(rest), "migrate:"); ok { out = append(out, strings.TrimSpace(v)) }
+	}
+	return out
+}
+
+// splitStatements splits a SQL script on top-level semicolons, ignoring those inside
+// quotes, dollar-quoted bodies and comments. Comment-only fragments are dropped.
+func splitStatements(sqlText string) []string {
+	var stmts []string
+	var cur strings.Builder
+	hasCode := false
+	flush := func() {
+		if hasCode { stmts = append(stmts, strings.TrimSpace(cur.String())) }
+		cur.Reset()
+		hasCode = false
+	}
+	for i := 0; i < len(sqlText); i++ {
+		c := sqlText[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sqlText[i:], "--"):
+			end := strings.IndexByte(sqlText[i:], '\n')
+			if end < 0 { end = len(sqlText) - i }
+			cur.WriteString(sqlText[i : i+end])
+			i += end - 1
+		case c == '/' && strings.HasPrefix(sqlText[i:], "/*"):
+			end := strings.Index(sqlText[i+2:], "*/")
+			if end < 0 { end = len(sqlText) - i - 2 } else { end += 2 }
+			cur.WriteString(sqlText[i : i+2+end])
+			i += 1 + end
+		case c == '\'' || c == '"':
+			end := i + 1
+			for end < len(sqlText) {
+				if sqlText[end] == c {
+					if end+1 < len(sqlText) && sqlText[end+1] == c { end += 2; continue } // doubled quote escape
+					break
+				}
+				end++
+			}
+			if end >= len(sqlText) { end = len(sqlText) - 1 }
+			cur.WriteString(sqlText[i : end+1])
+			hasCode = true
+			i = end
+		case c == '$':
+			tag := dollarTag(sqlText[i:])
+			if tag == "" {
+				cur.WriteByte(c)
+				hasCode = true
+				continue
+			}
+			end := strings.Index(sqlText[i+len(tag):], tag)
+			if end < 0 { end = len(sqlText) - i - len(tag) } else { end += len(tag) }
+			cur.WriteString(sqlText[i : i+len(tag)+end])
+			hasCode = true
+			i += len(tag) + end - 1
+		case c == ';':
+			flush()
+		default:
+			cur.WriteByte(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' { hasCode = true }
+		}
+	}
+	flush()
+	return stmts
+}
+
+// dollarTag returns the opening $tag$ at the start of s, or "" if s does not start one.
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		if c == '$' { return s[:j+1] }
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || j > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+func withTx(ctx context.Context, db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil { return err }
+	defer func() {
+		if p := recover(); p != nil { _ = tx.Rollback(); panic(p) }
+	}()
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,222 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/migrations"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}},
+		{"multiple", "SELECT 1;\nSELECT 2;\n", []string{"SELECT 1", "SELECT 2"}},
+		{"comment only", "-- nothing here;\n/* nor; here */\n", nil},
+		{"semicolon in string", "INSERT INTO t VALUES ('a;b', 'it''s;');SELECT 2", []string{"INSERT INTO t VALUES ('a;b', 'it''s;')", "SELECT 2"}},
+		{"semicolon in comment", "SELECT 1 -- trailing; comment\n;SELECT 2", []string{"SELECT 1 -- trailing; comment", "SELECT 2"}},
+		{"dollar quoted", "CREATE FUNCTION f() RETURNS INT AS $fn$ SELECT 1; $fn$ LANGUAGE SQL;", []string{"CREATE FUNCTION f() RETURNS INT AS $fn$ SELECT 1; $fn$ LANGUAGE SQL"}},
+		{"positional param", "SELECT $1; SELECT 2", []string{"SELECT $1", "SELECT 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasDirective(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"-- 004_x.sql\n-- migrate: no-transaction\nCREATE INDEX CONCURRENTLY i ON t (c);", true},
+		{"--migrate:No-Transaction\nSELECT 1", true},
+		{"-- 004_x.sql\nSELECT 1;\n-- migrate: no-transaction\n", false},
+		{"-- migrate: no-transactions\nSELECT 1", false},
+	}
+	for _, tt := range tests {
+		if got := hasDirective(tt.in, "no-transaction"); got != tt.want {
+			t.Errorf("hasDirective(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEnvDirective(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"-- 030_seed.sql\n-- migrate: env=dev-only\nINSERT INTO t VALUES (1);", envDevOnly, false},
+		{"-- migrate: no-transaction\n-- migrate: ENV = Prod-Only\nCREATE INDEX CONCURRENTLY i ON t (c);", envProdOnly, false},
+		{"-- 030_x.sql\nSELECT 1;\n-- migrate: env=dev-only\n", "", false},
+		{"-- migrate: no-transaction\nSELECT 1", "", false},
+		{"-- migrate: env=prod\nSELECT 1", "", true},
+		{"-- migrate: env=dev-only\n-- migrate: env=prod-only\nSELECT 1", "", true},
+	}
+	for _, tt := range tests {
+		got, err := envDirective(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("envDirective(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGuardAllows(t *testing.T) {
+	tests := []struct {
+		guard, env string
+		want       bool
+	}{
+		{"", "production", true},
+		{"", "staging", true},
+		{envProdOnly, "production", true},
+		{envProdOnly, "", true},
+		{envProdOnly, "staging", false},
+		{envDevOnly, "production", false},
+		{envDevOnly, "Production", false},
+		{envDevOnly, "", false},
+		{envDevOnly, "development", true},
+	}
+	for _, tt := range tests {
+		if got := guardAllows(tt.guard, tt.env); got != tt.want {
+			t.Errorf("guardAllows(%q, %q) = %v, want %v", tt.guard, tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	write := func(dir string, names ...string) {
+		for _, n := range names {
+			if err := os.WriteFile(filepath.Join(dir, n), []byte("SELECT 1;"), 0o644); err != nil { t.Fatal(err) }
+		}
+	}
+	dir := t.TempDir()
+	write(dir, "001_init.sql", "002_pins.up.sql", "002_pins.down.sql", "003_seed.sql", "003_seed.down.sql", "README.md")
+	got, err := readMigrations(os.DirFS(dir))
+	if err != nil { t.Fatal(err) }
+	want := []migration{{1, "001_init.sql", ""}, {2, "002_pins.up.sql", "002_pins.down.sql"}, {3, "003_seed.sql", "003_seed.down.sql"}}
+	if !reflect.DeepEqual(got, want) { t.Errorf("readMigrations = %+v, want %+v", got, want) }
+
+	for _, names := range [][]string{{"004_x.down.sql"}, {"004_x.sql", "004_x.up.sql"}, {"x.sql"}} {
+		dir := t.TempDir()
+		write(dir, names...)
+		if _, err := readMigrations(os.DirFS(dir)); err == nil { t.Errorf("readMigrations(%q) succeeded", names) }
+	}
+}
+
+func TestPlans(t *testing.T) {
+	migrations := []migration{{1, "001_init.sql", ""}, {2, "002_pins.up.sql", "002_pins.down.sql"}, {3, "003_seed.up.sql", "003_seed.down.sql"}, {4, "004_idx.up.sql", "004_idx.down.sql"}}
+	applied := map[string]time.Time{"001_init.sql": {}, "002_pins.up.sql": {}, "003_seed.up.sql": {}}
+	files := func(ms []migration) (out []string) {
+		for _, m := range ms { out = append(out, m.Up) }
+		return out
+	}
+
+	if got := files(upPlan(migrations, applied, Latest)); !reflect.DeepEqual(got, []string{"004_idx.up.sql"}) { t.Errorf("up = %q", got) }
+	if got := files(upPlan(migrations, map[string]time.Time{}, 2)); !reflect.DeepEqual(got, []string{"001_init.sql", "002_pins.up.sql"}) { t.Errorf("up -to 2 = %q", got) }
+
+	tests := []struct {
+		to      int
+		want    []string
+		wantErr bool
+	}{
+		{Latest, []string{"003_seed.up.sql"}, false},
+		{1, []string{"003_seed.up.sql", "002_pins.up.sql"}, false},
+		{3, nil, false},
+		{0, nil, true}, // 001_init.sql has no down file
+	}
+	for _, tt := range tests {
+		plan, err := downPlan(migrations, applied, tt.to)
+		if got := files(plan); !reflect.DeepEqual(got, tt.want) || (err != nil) != tt.wantErr {
+			t.Errorf("down -to %d = %q, %v; want %q, error %v", tt.to, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if _, err := downPlan(migrations[:2], applied, 1); err == nil { t.Error("rolled back a migration whose file is gone") }
+}
+
+// TestEmbeddedMigrations checks that the binaries carry every migration in the directory.
+func TestEmbeddedMigrations(t *testing.T) {
+	embedded, err := readMigrations(migrations.Open(""))
+	if err != nil { t.Fatal(err) }
+	onDisk, err := readMigrations(os.DirFS(filepath.Join("..", "..", "migrations")))
+	if err != nil { t.Fatal(err) }
+	if len(embedded) == 0 || !reflect.DeepEqual(embedded, onDisk) { t.Errorf("embedded %d migrations, directory has %d", len(embedded), len(onDisk)) }
+	if _, _, err := Graph(migrations.Open("")); err != nil { t.Error(err) }
+}
+
+func TestGraph(t *testing.T) {
+	if got := requirements("-- migrate: no-transaction\n-- requires: 001_init.sql, 002_pins\n--requires:003_x.sql\nSELECT 1;\n-- requires: 004_y.sql"); !reflect.DeepEqual(got, []string{"001_init.sql", "002_pins", "003_x.sql"}) {
+		t.Errorf("requirements = %q", got)
+	}
+
+	write := func(files map[string]string) fstest.MapFS {
+		fsys := fstest.MapFS{}
+		for name, text := range files { fsys[name] = &fstest.MapFile{Data: []byte(text + "SELECT 1;")} }
+		return fsys
+	}
+	// 002 was written on a branch against 004, which was merged first under a later number.
+	fsys := write(map[string]string{
+		"001_init.sql":      "",
+		"002_pins.up.sql":   "-- requires: 004_idx, 001_init.sql\n",
+		"002_pins.down.sql": "",
+		"003_seed.sql":      "",
+		"003_seed.down.sql": "",
+		"004_idx.up.sql":    "",
+		"004_idx.down.sql":  "",
+	})
+	files, g, err := Graph(fsys)
+	if err != nil { t.Fatal(err) }
+	if want := []string{"001_init.sql", "003_seed.sql", "004_idx.up.sql", "002_pins.up.sql"}; !reflect.DeepEqual(files, want) { t.Errorf("order = %q, want %q", files, want) }
+	var out strings.Builder
+	if err := WriteGraph(&out, fsys); err != nil || !strings.Contains(out.String(), "\n002_pins.up.sql <- 004_idx.up.sql, 001_init.sql\n") { t.Errorf("graph:\n%s%v", out.String(), err) }
+
+	gr := graph(g)
+	if err := gr.checkUp([]string{"004_idx.up.sql", "002_pins.up.sql"}, map[string]time.Time{"001_init.sql": {}}); err != nil { t.Errorf("checkUp: %v", err) }
+	// -to 2, or a guard, holding 004 back leaves 002 without it.
+	if err := gr.checkUp([]string{"002_pins.up.sql"}, map[string]time.Time{"001_init.sql": {}}); err == nil { t.Error("checkUp let 002 run before 004") }
+
+	migrations, _, _ := readOrdered(fsys)
+	applied := map[string]time.Time{"001_init.sql": {}, "002_pins.up.sql": {}, "003_seed.sql": {}, "004_idx.up.sql": {}}
+	plan, err := downPlan(migrations, applied, Latest)
+	if err != nil || len(plan) != 1 || plan[0].Up != "002_pins.up.sql" { t.Errorf("down = %+v, %v", plan, err) }
+	// Rolling back past 004 takes 002 first; stopping at 3 would leave 002 without 004.
+	plan, err = downPlan(migrations, applied, 1)
+	var got []string
+	for _, m := range plan { got = append(got, m.Up) }
+	if want := []string{"002_pins.up.sql", "004_idx.up.sql", "003_seed.sql"}; err != nil || gr.checkDown(plan, applied) != nil || !reflect.DeepEqual(got, want) { t.Errorf("down -to 1 = %q, %v; want %q", got, err, want) }
+	plan, _ = downPlan(migrations, applied, 3)
+	if err := gr.checkDown(plan, applied); err == nil { t.Error("rolled back 004 under 002") }
+
+	for name, files := range map[string]map[string]string{
+		"unknown": {"001_a.sql": "-- requires: 000_gone.sql\n"},
+		"self":    {"001_a.sql": "-- requires: 001_a.sql\n"},
+		"cycle":   {"001_a.sql": "-- requires: 002_b.sql\n", "002_b.sql": "-- requires: 001_a.sql\n"},
+	} {
+		if _, _, err := Graph(write(files)); err == nil { t.Errorf("%s: no error", name) }
+	}
+}
+
+func TestBatches(t *testing.T) {
+	const par = "-- migrate: parallel\n"
+	pending := map[string]string{
+		"010_a.sql": "", "011_fill_1.sql": par, "012_fill_2.sql": par, "013_fill_3.sql": par + "-- requires: 011_fill_1\n",
+		"014_fill_4.sql": par, "015_b.sql": "", "016_fill_5.sql": par,
+	}
+	files := []string{"010_a.sql", "011_fill_1.sql", "012_fill_2.sql", "013_fill_3.sql", "014_fill_4.sql", "015_b.sql", "016_fill_5.sql"}
+	g := graph{"013_fill_3.sql": {"011_fill_1.sql"}}
+	want := [][]string{{"010_a.sql"}, {"011_fill_1.sql", "012_fill_2.sql"}, {"013_fill_3.sql", "014_fill_4.sql"}, {"015_b.sql"}, {"016_fill_5.sql"}}
+	if got := batches(files, pending, g, true); !reflect.DeepEqual(got, want) { t.Errorf("batches = %q, want %q", got, want) }
+	got := batches(files, pending, g, false)
+	if len(got) != len(files) { t.Errorf("batches without Parallel = %q, want one file each", got) }
+}
@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// A large backlog, such as a backfill split into many files, need not apply one file at a
+// time. With Options.Parallel above 1, Up applies files marked
+//
+//	-- migrate: parallel
+//
+// concurrently, each on its own connection and in its own transaction (or statement by
+// statement), up to Parallel at once. Marking a file promises it doesn't touch what the
+// files next to it touch. Everything else keeps its place: a run of consecutive marked files
+// is one batch, which starts once everything before it is applied and must finish before
+// anything after it starts; an unmarked file is a batch of its own, and a marked file
+// requiring one in the current batch (see graph.go) starts the next. Without Parallel,
+// marked files apply in order like any other.
+
+// batches splits files, in the order Up applies them, into the batches described above;
+// with parallel false every file is a batch of its own.
+func batches(files []string, pending map[string]string, g graph, parallel bool) [][]string {
+	var out [][]string
+	var cur []string
+	for _, f := range files {
+		marked := parallel && hasDirective(pending[f], "parallel")
+		if !marked || slices.ContainsFunc(g[f], func(req string) bool { return slices.Contains(cur, req) }) {
+			if len(cur) > 0 { out = append(out, cur) }
+			cur = nil
+		}
+		cur = append(cur, f)
+		if !marked {
+			out = append(out, cur)
+			cur = nil
+		}
+	}
+	if len(cur) > 0 { out = append(out, cur) }
+	return out
+}
+
+// applyBatch applies the files of one batch, at most n at once. After a failure it starts
+// no more of them but lets those running finish, so every file either is recorded in
+// schema_migrations or isn't applied at all (or, without a transaction, resumes where it
+// stopped); a rerun applies what is left. It returns every failure.
+func applyBatch(ctx context.Context, log *slog.Logger, db *sql.DB, batch []string, pending map[string]string, n int) error {
+	if len(batch) == 1 { return apply(ctx, log, db, batch[0], pending[batch[0]]) }
+	log.Info("applying concurrently", "files", len(batch), "at_once", min(n, len(batch)))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+	for _, f := range batch {
+		sem <- struct{}{}
+		mu.Lock()
+		failed := len(errs) > 0
+		mu.Unlock()
+		if failed {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if err := apply(ctx, log, db, f, pending[f]); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// apply applies one migration file.
+func apply(ctx context.Context, log *slog.Logger, db *sql.DB, f, sqlText string) error {
+	log.Info("applying", "file", f)
+	var err error
+	if hasDirective(sqlText, "no-transaction") {
+		err = applyMigrationNoTx(ctx, log, db, f, sqlText)
+	} else {
+		err = applyMigration(ctx, db, f, sqlText)
+	}
+	if err != nil { return fmt.Errorf("apply %s: %w", f, err) }
+	log.Info("applied", "file", f)
+	return nil
+}
+
+// printBatch notes a batch of files a dry run would apply concurrently.
+func printBatch(w io.Writer, batch []string) {
+	if len(batch) > 1 { fmt.Fprintf(w, "-- concurrently: %s\n\n", strings.Join(batch, ", ")) }
+}
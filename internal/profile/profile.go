@@ -0,0 +1,92 @@
+// Package profile holds the rules a profile submission must meet. The server enforces them
+// on POST /profiles; tools that prepare submissions (cmd/ogimport) use them so their drafts
+// are accepted as-is.
+package profile
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Field limits. The add form declares the same ones as maxlength. Names and places count
+// characters; the description counts bytes, as the server always has.
+const (
+	MaxFullName    = 120
+	MaxCountry     = 80
+	MaxCity        = 120
+	MaxDescription = 160
+	MaxPhotoAlt    = 250
+)
+
+type ErrorInvalidProfile string
+
+func (e ErrorInvalidProfile) Error() string { return string(e) }
+func (ErrorInvalidProfile) InvalidProfile() {}
+
+const (
+	ErrMissingFields   ErrorInvalidProfile = "missing required fields"
+	ErrFieldTooLong    ErrorInvalidProfile = "name, country or city too long"
+	ErrDescriptionLong ErrorInvalidProfile = "description too long"
+	ErrPhotoAltMissing ErrorInvalidProfile = "photo_alt required: describe the photo for people who can't see it"
+	ErrPhotoAltLong    ErrorInvalidProfile = "photo_alt too long"
+)
+
+// Validate checks trimmed submission fields: name, country and city are required, and all
+// four must fit their limits.
+func Validate(fullName, country, city, description string) error {
+	if fullName == "" || country == "" || city == "" { return ErrMissingFields }
+	if utf8.RuneCountInString(fullName) > MaxFullName || utf8.RuneCountInString(country) > MaxCountry ||
+		utf8.RuneCountInString(city) > MaxCity {
+		return ErrFieldTooLong
+	}
+	if len(description) > MaxDescription { return ErrDescriptionLong }
+	return nil
+}
+
+// ValidatePhotoAlt checks the trimmed description of a new profile's photo, its alt text:
+// required, and at most MaxPhotoAlt characters.
+func ValidatePhotoAlt(alt string) error {
+	if alt == "" { return ErrPhotoAltMissing }
+	if utf8.RuneCountInString(alt) > MaxPhotoAlt { return ErrPhotoAltLong }
+	return nil
+}
+
+// TruncateDescription cuts s to MaxDescription bytes on a rune boundary.
+func TruncateDescription(s string) string {
+	n := MaxDescription
+	if len(s) <= n { return s }
+	for n > 0 && !utf8.RuneStart(s[n]) { n-- }
+	return s[:n]
+}
+
+// slugNameRunes bounds the name part of a slug.
+const slugNameRunes = 48
+
+// Slug is the path segment of a profile's page, /p/{slug}: the name lowercased, with each run
+// of anything but letters and digits made one dash, then the first eight hex digits of id,
+// which keep apart profiles of the same name. Letters outside ASCII stay; browsers show them
+// in the address bar.
+func Slug(fullName, id string) string {
+	var b strings.Builder
+	n, gap := 0, false
+	for _, r := range strings.ToLower(fullName) {
+		if n >= slugNameRunes { break }
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) {
+			gap = true
+			continue
+		}
+		if gap && b.Len() > 0 { b.WriteByte('-'); n++ }
+		b.WriteRune(r)
+		n, gap = n+1, false
+	}
+	if b.Len() > 0 { b.WriteByte('-') }
+	return b.String() + ShortID(id)
+}
+
+// ShortID is the first eight hex digits of a profile id, the part of its slug that finds it
+// whatever the name says.
+func ShortID(id string) string {
+	short := strings.ReplaceAll(id, "-", "")
+	return short[:min(len(short), 8)]
+}
@@ -0,0 +1,68 @@
+package profile
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name, full, country, city, desc string
+		want                            error
+	}{
+		{"ok", "Ada", "UK", "London", "Poet of numbers", nil},
+		{"no description", "Ada", "UK", "London", "", nil},
+		{"missing city", "Ada", "UK", "", "", ErrMissingFields},
+		{"name at limit in runes", strings.Repeat("é", MaxFullName), "UK", "London", "", nil},
+		{"long name", strings.Repeat("a", MaxFullName+1), "UK", "London", "", ErrFieldTooLong},
+		{"long country", "Ada", strings.Repeat("a", MaxCountry+1), "London", "", ErrFieldTooLong},
+		{"description in bytes", "Ada", "UK", "London", strings.Repeat("é", MaxDescription/2+1), ErrDescriptionLong},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.full, tt.country, tt.city, tt.desc); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Validate = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidatePhotoAlt(t *testing.T) {
+	tests := []struct {
+		alt  string
+		want error
+	}{
+		{"Ada smiling on a beach", nil},
+		{"", ErrPhotoAltMissing},
+		{strings.Repeat("é", MaxPhotoAlt), nil},
+		{strings.Repeat("a", MaxPhotoAlt+1), ErrPhotoAltLong},
+	}
+	for _, tt := range tests {
+		if err := ValidatePhotoAlt(tt.alt); !errors.Is(err, tt.want) {
+			t.Errorf("ValidatePhotoAlt(%d runes) = %v, want %v", utf8.RuneCountInString(tt.alt), err, tt.want)
+		}
+	}
+}
+
+func TestTruncateDescription(t *testing.T) {
+	got := TruncateDescription("a" + strings.Repeat("é", MaxDescription))
+	if len(got) > MaxDescription || !utf8.ValidString(got) || Validate("a", "b", "c", got) != nil {
+		t.Errorf("TruncateDescription = %q (%d bytes)", got, len(got))
+	}
+	if got := TruncateDescription("short"); got != "short" { t.Errorf("short text changed to %q", got) }
+}
+
+func TestSlug(t *testing.T) {
+	const id = "3f2a9c1e-77b0-4c1d-9e2f-0123456789ab"
+	tests := []struct{ name, want string }{
+		{"Ada Lovelace", "ada-lovelace-3f2a9c1e"},
+		{"  Mr. Whiskers (the 2nd)!  ", "mr-whiskers-the-2nd-3f2a9c1e"},
+		{"José Müller", "josé-müller-3f2a9c1e"},
+		{"Бобик", "бобик-3f2a9c1e"},
+		{"!!!", "3f2a9c1e"},
+		{strings.Repeat("ab ", 30), strings.Repeat("ab-", 16) + "a-3f2a9c1e"},
+	}
+	for _, tt := range tests {
+		if got := Slug(tt.name, id); got != tt.want { t.Errorf("Slug(%q) = %q, want %q", tt.name, got, tt.want) }
+	}
+}
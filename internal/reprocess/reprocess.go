@@ -0,0 +1,198 @@
+// Package reprocess re-derives stored photos after the imaging pipeline parameters change.
+package reprocess
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/blob"
+	"github.com/doesnotcommit/bestfriends/internal/imaging"
+	"github.com/doesnotcommit/bestfriends/internal/store"
+)
+
+// Options for one reprocessing run.
+type Options struct {
+	Run         string // checkpoint name; DefaultRun() names it after the pipeline parameters
+	Batch       int
+	Concurrency int
+	Restart     bool
+	Blobs       blob.Store // object storage rewritten photos go to; nil keeps them in the database
+}
+
+// DefaultRun is the checkpoint name for the current pipeline parameters and revision, so a run
+// after they change starts over while a rerun with the same ones resumes.
+func DefaultRun() string {
+	return fmt.Sprintf("w%d-b%d-r%d", imaging.MaxWidth, imaging.MaxBytes, imaging.Revision)
+}
+
+// checkpoint mirrors a photo_reprocess_runs row.
+type checkpoint struct {
+	LastID    sql.NullString
+	Processed int
+	Rewritten int
+	Failed    int
+	Finished  bool
+}
+
+// Run re-derives every profile's photo with the current pipeline, checkpointing after each
+// batch in photo_reprocess_runs so an interrupted run resumes where it stopped.
+func Run(ctx context.Context, log *slog.Logger, db *sql.DB, o Options) error {
+	if o.Batch < 1 || o.Concurrency < 1 || o.Run == "" { return fmt.Errorf("batch, concurrency and run name must be set") }
+	if o.Restart {
+		if _, err := db.ExecContext(ctx, `DELETE FROM photo_reprocess_runs WHERE run = $1`, o.Run); err != nil {
+			return fmt.Errorf("reset checkpoint: %w", err)
+		}
+	}
+	cp, err := loadCheckpoint(ctx, db, o.Run)
+	if err != nil { return fmt.Errorf("load checkpoint: %w", err) }
+	if cp.Finished {
+		log.Info("run already finished; use -restart or another -run to go again", "run", o.Run)
+		return nil
+	}
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM profiles`).Scan(&total); err != nil {
+		return fmt.Errorf("count profiles: %w", err)
+	}
+	log.Info("reprocessing photos", "run", o.Run, "total", total, "resume_after", cp.LastID.String,
+		"max_width", imaging.MaxWidth, "max_bytes", imaging.MaxBytes)
+
+	photos := store.NewPostgres(db, o.Blobs)
+	start := time.Now()
+	for {
+		ids, err := nextBatch(ctx, db, cp.LastID, o.Batch)
+		if err != nil { return fmt.Errorf("list batch: %w", err) }
+		if len(ids) == 0 { break }
+		rewritten, failed := processBatch(ctx, log, db, photos, ids, o.Concurrency)
+		if err := ctx.Err(); err != nil {
+			// The batch may be partly done; it is redone on resume, which is harmless.
+			return fmt.Errorf("interrupted; rerun to resume: %w", err)
+		}
+		cp.LastID = sql.NullString{String: ids[len(ids)-1], Valid: true}
+		cp.Processed += len(ids)
+		cp.Rewritten += rewritten
+		cp.Failed += failed
+		if err := saveCheckpoint(ctx, db, o.Run, cp); err != nil { return fmt.Errorf("save checkpoint: %w", err) }
+		log.Info("progress", "processed", cp.Processed, "total", total, "rewritten", cp.Rewritten, "failed", cp.Failed,
+			"elapsed", time.Since(start).Round(time.Second))
+	}
+	cp.Finished = true
+	if err := saveCheckpoint(ctx, db, o.Run, cp); err != nil { return fmt.Errorf("save checkpoint: %w", err) }
+	log.Info("done", "run", o.Run, "processed", cp.Processed, "rewritten", cp.Rewritten, "failed", cp.Failed)
+	return nil
+}
+
+func loadCheckpoint(ctx context.Context, db *sql.DB, name string) (checkpoint, error) {
+	var cp checkpoint
+	err := db.QueryRowContext(ctx, `
+		SELECT last_id::string, processed, rewritten, failed, finished_at IS NOT NULL
+		FROM photo_reprocess_runs WHERE run = $1`, name).Scan(&cp.LastID, &cp.Processed, &cp.Rewritten, &cp.Failed, &cp.Finished)
+	if err == sql.ErrNoRows { return checkpoint{}, nil }
+	return cp, err
+}
+
+func saveCheckpoint(ctx context.Context, db *sql.DB, name string, cp checkpoint) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO photo_reprocess_runs (run, last_id, processed, rewritten, failed, finished_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $6::BOOL THEN now() END)
+		ON CONFLICT (run) DO UPDATE SET
+			last_id = excluded.last_id, processed = excluded.processed, rewritten = excluded.rewritten,
+			failed = excluded.failed, finished_at = excluded.finished_at, updated_at = now()`,
+		name, cp.LastID, cp.Processed, cp.Rewritten, cp.Failed, cp.Finished)
+	return err
+}
+
+// nextBatch returns up to n profile ids after the checkpoint, in id order.
+func nextBatch(ctx context.Context, db *sql.DB, after sql.NullString, n int) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id::string FROM profiles
+		WHERE $1::UUID IS NULL OR id > $1::UUID
+		ORDER BY id LIMIT $2`, after, n)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil { return nil, err }
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// processBatch re-derives the photos of ids with at most concurrency workers. A photo that
+// fails is logged and counted, not retried; the run carries on with the rest.
+func processBatch(ctx context.Context, log *slog.Logger, db *sql.DB, photos *store.Postgres, ids []string, concurrency int) (rewritten, failed int) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for _, id := range ids {
+		if ctx.Err() != nil { break }
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			changed, err := reprocessPhoto(ctx, db, photos, id)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				failed++
+				log.Warn("photo failed", "profile", id, "err", err)
+			case changed:
+				rewritten++
+			}
+		}()
+	}
+	wg.Wait()
+	return rewritten, failed
+}
+
+// reprocessPhoto runs one profile's photo through the current pipeline and writes it back
+// when the result differs. The kept original is the source when there is one; otherwise the
+// stored photo is, and it is left alone if already within the current limits, since
+// re-encoding a JPEG loses quality every time. updated_at moves with a rewrite so photo
+// ETags change. A rewritten photo goes where new ones do (Options.Blobs), and the object of
+// the one it replaces, if any, is deleted last.
+func reprocessPhoto(ctx context.Context, db *sql.DB, photos *store.Postgres, id string) (bool, error) {
+	var original []byte
+	var storedType string
+	err := db.QueryRowContext(ctx, `
+		SELECT p.photo_content_type, o.data
+		FROM profiles p LEFT JOIN profile_originals o ON o.profile_id = p.id
+		WHERE p.id = $1`, id).Scan(&storedType, &original)
+	if err == sql.ErrNoRows { return false, nil } // deleted since the batch was listed
+	if err != nil { return false, err }
+	stored, err := photos.ReadPhoto(ctx, id)
+	if errors.Is(err, store.ErrNotFound) { return false, nil }
+	if err != nil { return false, err }
+	src := original
+	if src == nil {
+		if conforms(stored, storedType) { return false, nil }
+		src = stored
+	}
+	out, contentType, err := imaging.Process(src, imaging.MaxWidth, imaging.MaxBytes)
+	if err != nil { return false, err }
+	if contentType == storedType && bytes.Equal(out, stored) { return false, nil }
+	old, err := photos.ReplacePhoto(ctx, id, out, contentType)
+	if errors.Is(err, store.ErrNotFound) { return false, nil }
+	if err != nil { return false, err }
+	// The server's photo_placeholders and photo_variants jobs redo them from the new photo.
+	if _, err := db.ExecContext(ctx, `DELETE FROM photo_placeholders WHERE profile_id = $1`, id); err != nil { return true, err }
+	if _, err := db.ExecContext(ctx, `DELETE FROM photo_variants WHERE profile_id = $1`, id); err != nil { return true, err }
+	if old == "" { return true, nil }
+	if err := photos.DeleteObject(ctx, old); err != nil { return true, fmt.Errorf("delete the replaced photo's object %s: %w", old, err) }
+	return true, nil
+}
+
+// conforms reports whether a stored photo already is what the pipeline would produce now.
+func conforms(b []byte, contentType string) bool {
+	if len(b) > imaging.MaxBytes || contentType != imaging.ContentType { return false }
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	return err == nil && cfg.Width <= imaging.MaxWidth
+}
@@ -0,0 +1,289 @@
+// Package schemadoc describes the live database schema (tables, columns, indexes and foreign
+// keys) as a Markdown or HTML reference. Shared by cmd/schema-doc, the migrate commands and
+// the app's /admin/schema page.
+package schemadoc
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Schema is the current schema's tables in name order.
+type Schema struct {
+	Tables      []Table
+	Migration   string // newest applied migration, "" when schema_migrations is empty or missing
+	GeneratedAt time.Time
+}
+
+type Table struct {
+	Name        string
+	Note        string // the header comment of the migration that created it, when known
+	Migration   string // that migration's file name
+	Columns     []Column
+	Indexes     []Index
+	ForeignKeys []ForeignKey
+}
+
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+	Default  string
+}
+
+type Index struct {
+	Name       string
+	Definition string // CREATE INDEX statement as the database reports it
+}
+
+type ForeignKey struct {
+	Name      string
+	Column    string
+	RefTable  string
+	RefColumn string
+	OnDelete  string
+}
+
+// Inspect reads the schema of db's current database schema (public, by default).
+func Inspect(ctx context.Context, db *sql.DB) (*Schema, error) {
+	s := &Schema{GeneratedAt: time.Now().UTC()}
+	tables := map[string]*Table{}
+	table := func(name string) *Table {
+		t := tables[name]
+		if t == nil {
+			t = &Table{Name: name}
+			tables[name] = t
+		}
+		return t
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.table_name, c.column_name, c.data_type, c.is_nullable = 'YES', COALESCE(c.column_default, '')
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = current_schema() AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position
+	`)
+	if err != nil { return nil, fmt.Errorf("columns: %w", err) }
+	for rows.Next() {
+		var tname string
+		var c Column
+		if err := rows.Scan(&tname, &c.Name, &c.Type, &c.Nullable, &c.Default); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t := table(tname)
+		t.Columns = append(t.Columns, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil { return nil, fmt.Errorf("columns: %w", err) }
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT tablename, indexname, indexdef FROM pg_indexes
+		WHERE schemaname = current_schema()
+		ORDER BY tablename, indexname
+	`)
+	if err != nil { return nil, fmt.Errorf("indexes: %w", err) }
+	for rows.Next() {
+		var tname string
+		var ix Index
+		if err := rows.Scan(&tname, &ix.Name, &ix.Definition); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if t := tables[tname]; t != nil { t.Indexes = append(t.Indexes, ix) }
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil { return nil, fmt.Errorf("indexes: %w", err) }
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT DISTINCT tc.table_name, tc.constraint_name, kcu.column_name, ccu.table_name, ccu.column_name, rc.delete_rule
+		FROM information_schema.table_constraints tc
+		JOIN information_schema.key_column_usage kcu
+			ON kcu.constraint_schema = tc.constraint_schema AND kcu.constraint_name = tc.constraint_name AND kcu.table_name = tc.table_name
+		JOIN information_schema.referential_constraints rc
+			ON rc.constraint_schema = tc.constraint_schema AND rc.constraint_name = tc.constraint_name
+		JOIN information_schema.constraint_column_usage ccu
+			ON ccu.constraint_schema = tc.constraint_schema AND ccu.constraint_name = tc.constraint_name
+		WHERE tc.constraint_type = 'FOREIGN KEY' AND tc.table_schema = current_schema()
+		ORDER BY tc.table_name, tc.constraint_name, kcu.column_name
+	`)
+	if err != nil { return nil, fmt.Errorf("foreign keys: %w", err) }
+	for rows.Next() {
+		var tname string
+		var fk ForeignKey
+		if err := rows.Scan(&tname, &fk.Name, &fk.Column, &fk.RefTable, &fk.RefColumn, &fk.OnDelete); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if t := tables[tname]; t != nil { t.ForeignKeys = append(t.ForeignKeys, fk) }
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil { return nil, fmt.Errorf("foreign keys: %w", err) }
+
+	// schema_migrations may not exist yet on a fresh database; that is not an error here.
+	if _, ok := tables["schema_migrations"]; ok {
+		if err := db.QueryRowContext(ctx, `SELECT COALESCE(max(version), '') FROM schema_migrations`).Scan(&s.Migration); err != nil {
+			return nil, fmt.Errorf("schema_migrations: %w", err)
+		}
+	}
+
+	for _, t := range tables { s.Tables = append(s.Tables, *t) }
+	slices.SortFunc(s.Tables, func(a, b Table) int { return strings.Compare(a.Name, b.Name) })
+	return s, nil
+}
+
+var createTableRe = regexp.MustCompile(`(?i)CREATE TABLE (?:IF NOT EXISTS )?"?(\w+)"?`)
+
+// Annotate attaches to each table the header comment of the migration in migrations (see
+// migrations.Open) that creates it: the comment lines at the top of the file after its name
+// and directives; .down.sql files are not read. A missing directory is not an error; tables
+// just go without notes.
+func (s *Schema) Annotate(migrations fs.FS) error {
+	files, err := fs.Glob(migrations, "*.sql")
+	if err != nil { return err }
+	slices.Sort(files)
+	notes := map[string][2]string{}
+	for _, path := range files {
+		if strings.HasSuffix(strings.ToLower(path), ".down.sql") { continue } // rollbacks may recreate tables
+		f, err := migrations.Open(path)
+		if err != nil { return err }
+		note, created, err := parseMigration(f, filepath.Base(path))
+		f.Close()
+		if err != nil { return fmt.Errorf("%s: %w", path, err) }
+		for _, t := range created {
+			if _, ok := notes[t]; !ok { notes[t] = [2]string{note, filepath.Base(path)} }
+		}
+	}
+	for i := range s.Tables {
+		if n, ok := notes[s.Tables[i].Name]; ok { s.Tables[i].Note, s.Tables[i].Migration = n[0], n[1] }
+	}
+	return nil
+}
+
+// parseMigration returns a migration's header comment and the tables it creates.
+func parseMigration(r io.Reader, name string) (note string, tables []string, err error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var lines []string
+	header := true
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if header {
+			if c, ok := strings.CutPrefix(line, "--"); ok {
+				c = strings.TrimSpace(c)
+				if c != name && !strings.HasPrefix(c, "migrate:") { lines = append(lines, c) }
+				continue
+			}
+			header = false
+		}
+		if m := createTableRe.FindStringSubmatch(line); m != nil { tables = append(tables, m[1]) }
+	}
+	return strings.Join(lines, " "), tables, sc.Err()
+}
+
+// Markdown writes s as a Markdown reference.
+func (s *Schema) Markdown(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Database schema\n\nGenerated %s", s.GeneratedAt.Format(time.RFC3339))
+	if s.Migration != "" { fmt.Fprintf(bw, " at migration %s", s.Migration) }
+	fmt.Fprintf(bw, ". %d tables.\n", len(s.Tables))
+	for _, t := range s.Tables {
+		fmt.Fprintf(bw, "\n## %s\n\n", t.Name)
+		if t.Note != "" { fmt.Fprintf(bw, "%s\n\n", t.Note) }
+		if t.Migration != "" { fmt.Fprintf(bw, "Created by `%s`.\n\n", t.Migration) }
+		fmt.Fprintf(bw, "| Column | Type | Null | Default |\n|---|---|---|---|\n")
+		for _, c := range t.Columns {
+			null := ""
+			if c.Nullable { null = "yes" }
+			fmt.Fprintf(bw, "| %s | %s | %s | %s |\n", mdCell(c.Name), mdCell(c.Type), null, mdCode(c.Default))
+		}
+		if len(t.Indexes) > 0 {
+			fmt.Fprintf(bw, "\nIndexes:\n\n")
+			for _, ix := range t.Indexes { fmt.Fprintf(bw, "- %s: %s\n", ix.Name, mdCode(ix.Definition)) }
+		}
+		if len(t.ForeignKeys) > 0 {
+			fmt.Fprintf(bw, "\nForeign keys:\n\n")
+			for _, fk := range t.ForeignKeys {
+				fmt.Fprintf(bw, "- %s → %s.%s (on delete %s)\n", fk.Column, fk.RefTable, fk.RefColumn, strings.ToLower(fk.OnDelete))
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func mdCell(s string) string { return strings.ReplaceAll(s, "|", `\|`) }
+
+func mdCode(s string) string {
+	if s == "" { return "" }
+	return "`" + strings.ReplaceAll(mdCell(s), "`", "'") + "`"
+}
+
+var htmlTmpl = template.Must(template.New("schema").Funcs(template.FuncMap{"lower": strings.ToLower}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Database schema</title>
+<style>
+body{font-family:Inter,system-ui,-apple-system,Segoe UI,Roboto; color:#2B2B2B; background:#FAFAF7; max-width:1100px; margin:0 auto; padding:24px}
+h1,h2{font-family:'Playfair Display',Georgia,serif; font-weight:600}
+h2{margin-top:32px; border-bottom:1px solid #E6E2D9; padding-bottom:4px}
+table{border-collapse:collapse; width:100%; font-size:14px}
+th,td{text-align:left; border-bottom:1px solid #E6E2D9; padding:4px 8px; vertical-align:top}
+code{font-size:12px}
+.small{color:#6B6A66; font-size:12px}
+nav a{margin-right:10px; font-size:13px}
+</style>
+</head>
+<body>
+  <h1>Database schema</h1>
+  <p class="small">Generated {{.GeneratedAt.Format "2006-01-02 15:04:05 UTC"}}{{with .Migration}} at migration {{.}}{{end}} · {{len .Tables}} tables</p>
+  <nav>{{range .Tables}}<a href="#{{.Name}}">{{.Name}}</a>{{end}}</nav>
+  {{range .Tables}}
+  <h2 id="{{.Name}}">{{.Name}}</h2>
+  {{with .Note}}<p>{{.}}</p>{{end}}
+  {{with .Migration}}<p class="small">Created by <code>{{.}}</code></p>{{end}}
+  <table>
+    <tr><th>Column</th><th>Type</th><th>Null</th><th>Default</th></tr>
+    {{range .Columns}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{if .Nullable}}yes{{end}}</td><td>{{with .Default}}<code>{{.}}</code>{{end}}</td></tr>
+    {{end}}
+  </table>
+  {{with .Indexes}}<p class="small">Indexes</p><ul>{{range .}}<li>{{.Name}}: <code>{{.Definition}}</code></li>{{end}}</ul>{{end}}
+  {{with .ForeignKeys}}<p class="small">Foreign keys</p><ul>{{range .}}<li>{{.Column}} → <a href="#{{.RefTable}}">{{.RefTable}}</a>.{{.RefColumn}} (on delete {{lower .OnDelete}})</li>{{end}}</ul>{{end}}
+  {{end}}
+</body>
+</html>
+`))
+
+// HTML writes s as a standalone HTML page.
+func (s *Schema) HTML(w io.Writer) error {
+	return htmlTmpl.Execute(w, s)
+}
+
+// WriteFile inspects db, annotates it from migrations and writes the reference to path:
+// HTML for a .html file, Markdown otherwise. The migrate commands call it after a run.
+func WriteFile(ctx context.Context, db *sql.DB, migrations fs.FS, path string) error {
+	s, err := Inspect(ctx, db)
+	if err != nil { return err }
+	if err := s.Annotate(migrations); err != nil { return err }
+	f, err := os.Create(path)
+	if err != nil { return err }
+	if strings.EqualFold(filepath.Ext(path), ".html") {
+		err = s.HTML(f)
+	} else {
+		err = s.Markdown(f)
+	}
+	if cerr := f.Close(); err == nil { err = cerr }
+	return err
+}
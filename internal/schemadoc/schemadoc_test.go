@@ -0,0 +1,75 @@
+package schemadoc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMigration(t *testing.T) {
+	src := `-- migrate: no-transaction
+-- 009_locations.sql
+-- Normalized countries and cities.
+-- Cities point at their country.
+CREATE TABLE IF NOT EXISTS countries (
+    id UUID PRIMARY KEY
+);
+-- a comment further down is not part of the note
+CREATE TABLE cities (id UUID PRIMARY KEY);
+CREATE INDEX IF NOT EXISTS idx_x ON cities (id);
+`
+	note, tables, err := parseMigration(strings.NewReader(src), "009_locations.sql")
+	if err != nil { t.Fatal(err) }
+	if want := "Normalized countries and cities. Cities point at their country."; note != want { t.Errorf("note = %q, want %q", note, want) }
+	if strings.Join(tables, ",") != "countries,cities" { t.Errorf("tables = %v", tables) }
+}
+
+func TestAnnotateFirstCreatorWins(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil { t.Fatal(err) }
+	}
+	write("001_init.sql", "-- 001_init.sql\n-- Base profiles table\nCREATE TABLE IF NOT EXISTS profiles (id UUID);\n")
+	write("005_again.sql", "-- 005_again.sql\n-- Not the creator\nCREATE TABLE IF NOT EXISTS profiles (id UUID);\n")
+	s := &Schema{Tables: []Table{{Name: "profiles"}, {Name: "orphans"}}}
+	if err := s.Annotate(os.DirFS(dir)); err != nil { t.Fatal(err) }
+	if s.Tables[0].Note != "Base profiles table" || s.Tables[0].Migration != "001_init.sql" { t.Errorf("profiles = %+v", s.Tables[0]) }
+	if s.Tables[1].Note != "" { t.Errorf("orphans got a note: %q", s.Tables[1].Note) }
+	if err := (&Schema{}).Annotate(os.DirFS(filepath.Join(dir, "missing"))); err != nil { t.Errorf("missing dir: %v", err) }
+}
+
+func testSchema() *Schema {
+	return &Schema{Migration: "025_spotlights.sql", GeneratedAt: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC), Tables: []Table{{
+		Name: "spotlights", Note: "Exhibit <of> the day", Migration: "025_spotlights.sql",
+		Columns: []Column{{Name: "day", Type: "DATE"}, {Name: "note", Type: "STRING", Nullable: true, Default: "'a|b'"}},
+		Indexes: []Index{{Name: "idx_spotlights_profile", Definition: "CREATE INDEX idx_spotlights_profile ON spotlights (profile_id ASC)"}},
+		ForeignKeys: []ForeignKey{{Name: "fk", Column: "profile_id", RefTable: "profiles", RefColumn: "id", OnDelete: "CASCADE"}},
+	}}}
+}
+
+func TestMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testSchema().Markdown(&buf); err != nil { t.Fatal(err) }
+	out := buf.String()
+	for _, want := range []string{
+		"Generated 2026-10-16T12:00:00Z at migration 025_spotlights.sql. 1 tables.",
+		"## spotlights\n\nExhibit <of> the day\n\nCreated by `025_spotlights.sql`.",
+		"| day | DATE |  |  |\n",
+		"| note | STRING | yes | `'a\\|b'` |\n",
+		"- idx_spotlights_profile: `CREATE INDEX idx_spotlights_profile ON spotlights (profile_id ASC)`\n",
+		"- profile_id → profiles.id (on delete cascade)\n",
+	} {
+		if !strings.Contains(out, want) { t.Errorf("missing %q in:\n%s", want, out) }
+	}
+}
+
+func TestHTMLEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testSchema().HTML(&buf); err != nil { t.Fatal(err) }
+	out := buf.String()
+	if strings.Contains(out, "<of>") || !strings.Contains(out, "Exhibit &lt;of&gt; the day") { t.Errorf("note not escaped:\n%s", out) }
+	if !strings.Contains(out, `<a href="#profiles">profiles</a>.id (on delete cascade)`) { t.Errorf("foreign key missing:\n%s", out) }
+}
@@ -0,0 +1,479 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/profile"
+)
+
+// Memory is an in-memory ProfileStore for tests. Its transactions (InTx) only take turns:
+// every call applies at once and nothing rolls back. Put seeds profiles with fields the store
+// cannot set itself (pins, champions, retirement).
+type Memory struct {
+	VotesDualWrite bool // also record live votes in the legacy table, as Postgres does
+
+	tx       sync.Mutex // held by the running InTx
+	mu       sync.Mutex
+	profiles map[string]*memProfile
+	ranks    map[string]map[string]int // rank snapshots by day (YYYY-MM-DD), then profile id
+	votes    []memVote                 // the votes table
+	legacy   []memVote                 // the legacy votes_recent table
+	voters   map[string]*memVoter
+	revs     []Revision // oldest first
+	now      func() time.Time
+}
+
+type memVote struct {
+	Vote
+	at time.Time
+}
+
+type memVoter struct {
+	kind string
+	last time.Time
+}
+
+type memProfile struct {
+	Profile
+	status      string
+	photo       []byte
+	photoType   string
+	photoAt     time.Time // photo_updated_at
+	hidden      bool
+	variants    map[string]memVariant
+	placeholder *Placeholder
+	votes       []time.Time // when IncrementVote counted the votes within the last day, oldest first
+}
+
+type memVariant struct {
+	data        []byte
+	contentType string
+}
+
+func NewMemory() *Memory {
+	return &Memory{profiles: map[string]*memProfile{}, ranks: map[string]map[string]int{}, voters: map[string]*memVoter{}, now: time.Now}
+}
+
+// Put adds or replaces p, with status and photo; an empty status is StatusActive.
+func (m *Memory) Put(p Profile, status string, photo []byte, contentType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p.CreatedAt.IsZero() { p.CreatedAt = m.now() }
+	if p.UpdatedAt.IsZero() { p.UpdatedAt = p.CreatedAt }
+	m.profiles[p.ID] = &memProfile{Profile: p, status: cmp.Or(status, StatusActive), photo: photo, photoType: contentType, photoAt: p.UpdatedAt}
+}
+
+// HidePhoto marks profile id's photo hidden, as a takedown does.
+func (m *Memory) HidePhoto(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p := m.profiles[id]; p != nil { p.hidden, p.photoAt, p.UpdatedAt = true, m.now(), m.now() }
+}
+
+// PutPlaceholder stores the placeholder of profile id's photo.
+func (m *Memory) PutPlaceholder(id string, ph Placeholder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if p := m.profiles[id]; p != nil { p.placeholder = &ph }
+}
+
+// PutVariant stores a smaller rendition of profile id's photo, as size.
+func (m *Memory) PutVariant(id, size string, data []byte, contentType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.profiles[id]
+	if p == nil { return }
+	if p.variants == nil { p.variants = map[string]memVariant{} }
+	p.variants[size] = memVariant{data: data, contentType: contentType}
+}
+
+func (m *Memory) ListProfiles(_ context.Context, f Filter) ([]Profile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var list []Profile
+	for _, p := range m.profiles {
+		rank, ok := f.matches(p)
+		if !ok { continue }
+		q := p.Profile
+		q.SearchRank = rank
+		q.Retired = p.status == StatusRetired
+		q.RateLimited = f.VoteCap > 0 && p.votesSince(m.now().Add(-f.Cooldown)) >= f.VoteCap
+		list = append(list, q)
+	}
+	slices.SortFunc(list, func(a, b Profile) int {
+		if f.PinsFirst && a.Pinned != b.Pinned {
+			if a.Pinned { return -1 }
+			return 1
+		}
+		if f.Newest { return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), strings.Compare(a.ID, b.ID)) }
+		return compareVoteOrder(a, b)
+	})
+	if f.Limit > 0 && len(list) > f.Limit { list = list[:f.Limit] }
+	return list, nil
+}
+
+// matches is Filter.SQL's WHERE clause for a Memory profile, with its search rank.
+func (f Filter) matches(p *memProfile) (int, bool) {
+	switch {
+	case f.ID != "" && p.ID != f.ID,
+		f.ID == "" && p.status != cmp.Or(f.Status, StatusActive),
+		len(f.IDs) > 0 && !slices.Contains(f.IDs, p.ID),
+		f.Country != "" && !strings.EqualFold(p.Country, f.Country),
+		f.City != "" && !strings.EqualFold(p.City, f.City),
+		p.Votes < f.MinVotes,
+		f.After != nil && f.PinsFirst && p.Pinned:
+		return 0, false
+	}
+	rank, ok := ParseSearch(f.Query).Rank(p.Profile)
+	if !ok { return 0, false }
+	q := p.Profile
+	q.SearchRank = rank
+	if f.After != nil && f.After.ID != "" && compareVoteOrder(q, Profile{ID: f.After.ID, Votes: f.After.Votes, CreatedAt: f.After.CreatedAt, SearchRank: f.After.Rank}) <= 0 { return 0, false }
+	return rank, true
+}
+
+// compareVoteOrder orders a before b when it comes first in the vote order, after the better
+// search match when there is one.
+func compareVoteOrder(a, b Profile) int {
+	return cmp.Or(cmp.Compare(b.SearchRank, a.SearchRank), cmp.Compare(b.Votes, a.Votes), b.CreatedAt.Compare(a.CreatedAt), strings.Compare(b.ID, a.ID))
+}
+
+func (m *Memory) ProfileStatus(_ context.Context, id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.profiles[id]
+	if p == nil { return "", ErrNotFound }
+	return p.status, nil
+}
+
+func (m *Memory) ProfileBySlug(_ context.Context, slug string) (string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []*memProfile
+	for _, p := range m.profiles {
+		if p.Slug == slug { return p.ID, p.Slug, nil }
+		if lo, hi, ok := shortIDRange(slug); ok && p.ID >= lo && p.ID <= hi { found = append(found, p) }
+	}
+	if len(found) != 1 { return "", "", ErrNotFound }
+	return found[0].ID, found[0].Slug, nil
+}
+
+func (m *Memory) CreateProfile(_ context.Context, np NewProfile) (string, time.Time, error) {
+	id, now := newID(), m.now()
+	m.Put(Profile{ID: id, FullName: np.FullName, Country: np.Country, City: np.City, Description: np.Description, CreatedAt: now, PhotoTaken: np.PhotoTaken,
+		Slug: profile.Slug(np.FullName, id), PhotoAlt: np.PhotoAlt}, np.Status, slices.Clone(np.Photo), np.ContentType)
+	return id, now, nil
+}
+
+func (m *Memory) GetPhoto(_ context.Context, id string) (Photo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.profiles[id]
+	if p == nil { return Photo{}, ErrNotFound }
+	return Photo{ContentType: p.photoType, Updated: p.photoAt, Size: len(p.photo), Hidden: p.hidden}, nil
+}
+
+func (m *Memory) PhotoChunk(_ context.Context, id string, updated time.Time, off, n int, buf []byte) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.profiles[id]
+	if p == nil || !p.photoAt.Equal(updated) { return buf[:0], ErrPhotoChanged }
+	off = min(off, len(p.photo))
+	return append(buf[:0], p.photo[off:min(off+n, len(p.photo))]...), nil
+}
+
+func (m *Memory) PhotoVariant(_ context.Context, id, size string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.profiles[id]
+	if p == nil { return nil, "", ErrNotFound }
+	v, ok := p.variants[size]
+	if !ok || len(v.data) == 0 { return nil, "", ErrNotFound }
+	return v.data, v.contentType, nil
+}
+
+func (m *Memory) Placeholders(_ context.Context, ids []string) (map[string]Placeholder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := map[string]Placeholder{}
+	for _, id := range ids {
+		if p := m.profiles[id]; p != nil && p.placeholder != nil && !p.hidden { found[id] = *p.placeholder }
+	}
+	return found, nil
+}
+
+// OpenPhoto finds nothing: Memory keeps every photo in the "database".
+func (m *Memory) OpenPhoto(context.Context, string) (io.ReadCloser, error) { return nil, ErrNotFound }
+
+func (m *Memory) ReadPhoto(_ context.Context, id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.profiles[id]
+	if p == nil { return nil, ErrNotFound }
+	return slices.Clone(p.photo), nil
+}
+
+func (m *Memory) IncrementVote(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.profiles[id]
+	if p == nil { return ErrNotFound }
+	p.Votes++
+	now := m.now()
+	p.votes = append(p.votes[p.votesSinceIndex(now.Add(-24*time.Hour)):], now)
+	p.UpdatedAt = now
+	return nil
+}
+
+// votesSince counts p's votes after t.
+func (p *memProfile) votesSince(t time.Time) int { return len(p.votes) - p.votesSinceIndex(t) }
+
+func (p *memProfile) votesSinceIndex(t time.Time) int {
+	i, _ := slices.BinarySearchFunc(p.votes, t, func(v, t time.Time) int { return cmp.Or(v.Compare(t), -1) })
+	return i
+}
+
+func (m *Memory) SnapshotRanks(_ context.Context, day time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := day.Format(time.DateOnly)
+	if _, ok := m.ranks[key]; ok { return false, nil }
+	m.ranks[key] = m.currentRanks()
+	cutoff := day.AddDate(0, 0, -RankSnapshotDays).Format(time.DateOnly)
+	for d := range m.ranks {
+		if d < cutoff { delete(m.ranks, d) }
+	}
+	return true, nil
+}
+
+func (m *Memory) RankDeltas(_ context.Context, ids []string) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	deltas := map[string]int{}
+	var newest string
+	for d := range m.ranks { newest = max(newest, d) }
+	if newest == "" { return deltas, nil }
+	current := m.currentRanks()
+	for _, id := range ids {
+		was, ok := m.ranks[newest][id]
+		if now, active := current[id]; ok && active { deltas[id] = was - now }
+	}
+	return deltas, nil
+}
+
+// currentRanks ranks the active profiles like rankOrder, ties sharing a rank.
+func (m *Memory) currentRanks() map[string]int {
+	var active []*memProfile
+	for _, p := range m.profiles {
+		if p.status == StatusActive { active = append(active, p) }
+	}
+	order := func(a, b *memProfile) int { return cmp.Or(cmp.Compare(b.Votes, a.Votes), b.CreatedAt.Compare(a.CreatedAt)) }
+	slices.SortFunc(active, order)
+	ranks := make(map[string]int, len(active))
+	for i, p := range active {
+		ranks[p.ID] = i + 1
+		if i > 0 && order(active[i-1], p) == 0 { ranks[p.ID] = ranks[active[i-1].ID] }
+	}
+	return ranks
+}
+
+type memTxKey struct{}
+
+func (m *Memory) InTx(ctx context.Context, fn func(context.Context) error) error {
+	if ctx.Value(memTxKey{}) != nil { return fn(ctx) }
+	m.tx.Lock()
+	defer m.tx.Unlock()
+	return fn(context.WithValue(ctx, memTxKey{}, true))
+}
+
+func (m *Memory) VoteExists(_ context.Context, id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.ContainsFunc(m.votes, func(v memVote) bool { return v.ID == id }), nil
+}
+
+func (m *Memory) RecentVotes(_ context.Context, profile string, voters []string, within time.Duration, limit int) (RecentVotes, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rv := RecentVotes{Now: m.now()}
+	since := rv.Now.Add(-within)
+	for _, v := range m.votes {
+		if !v.at.After(since) { continue }
+		if (profile == "" || v.Profile == profile) && slices.Contains(voters, v.Voter) && (rv.Last == nil || v.at.After(*rv.Last)) { rv.Last = &v.at }
+		if v.Profile != profile || profile == "" { continue }
+		if rv.Oldest == nil || v.at.Before(*rv.Oldest) { rv.Oldest = &v.at }
+		if rv.Count < limit { rv.Count++ }
+	}
+	return rv, nil
+}
+
+func (m *Memory) VotedProfiles(_ context.Context, voters []string, within time.Duration) (map[string]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	voted, since := map[string]bool{}, m.now().Add(-within)
+	for _, v := range m.votes {
+		if v.at.After(since) && slices.Contains(voters, v.Voter) { voted[v.Profile] = true }
+	}
+	return voted, nil
+}
+
+func (m *Memory) VotesPerDay(_ context.Context, ids []string, since time.Time) ([]DayVotes, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := map[DayVotes]int{}
+	for _, v := range m.votes {
+		if slices.Contains(ids, v.Profile) && !v.at.Before(since) { counts[DayVotes{Profile: v.Profile, Day: v.at.UTC().Truncate(24 * time.Hour)}]++ }
+	}
+	var days []DayVotes
+	for d, n := range counts {
+		d.Votes = n
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+func (m *Memory) InsertVote(_ context.Context, v Vote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.profiles[v.Profile] == nil { return fmt.Errorf("vote for unknown profile %s", v.Profile) }
+	if v.ID == "" { v.ID = newID() }
+	if slices.ContainsFunc(m.votes, func(o memVote) bool { return o.ID == v.ID }) { return fmt.Errorf("duplicate vote %s", v.ID) }
+	mv := memVote{Vote: v, at: m.now()}
+	m.votes = append(m.votes, mv)
+	if m.VotesDualWrite { m.legacy = append(m.legacy, mv) }
+	return nil
+}
+
+// FlushVotes treats the legacy table as Postgres does: votes whose legacy copy was counted
+// are only marked counted, legacy votes without a copy are counted too.
+func (m *Memory) FlushVotes(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.legacy {
+		i := slices.IndexFunc(m.votes, func(o memVote) bool { return o.ID == v.ID })
+		switch {
+		case i >= 0 && v.Counted:
+			m.votes[i].Counted = true
+		case i < 0 && !v.Counted:
+			m.votes = append(m.votes, v)
+		}
+	}
+	for i, v := range m.votes {
+		if v.Counted { continue }
+		m.votes[i].Counted = true
+		if p := m.profiles[v.Profile]; p != nil { p.Votes, p.UpdatedAt = p.Votes+1, m.now() }
+	}
+	for i := range m.legacy { m.legacy[i].Counted = true }
+	return nil
+}
+
+// FlushLegacyVotes does what the vote flusher of the build before migrations/033 does, which
+// counts the legacy table only.
+func (m *Memory) FlushLegacyVotes() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, v := range m.legacy {
+		if v.Counted { continue }
+		m.legacy[i].Counted = true
+		if p := m.profiles[v.Profile]; p != nil { p.Votes++ }
+	}
+}
+
+func (m *Memory) NoteVoter(_ context.Context, id, kind string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.voters[id] = &memVoter{kind: kind, last: m.now()}
+	return nil
+}
+
+func (m *Memory) RetireFingerprints(_ context.Context, live []string, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	retired := func(id string) bool {
+		period, _, ok := strings.Cut(id, ".")
+		return ok && period != "" && strings.Trim(period, "0123456789") == "" && !slices.Contains(live, period)
+	}
+	var voters int64
+	for id, v := range m.voters {
+		if voters < int64(limit) && v.kind == "fingerprint" && retired(id) {
+			delete(m.voters, id)
+			voters++
+		}
+	}
+	most := voters
+	for _, votes := range [][]memVote{m.votes, m.legacy} {
+		var n int64
+		for i := range votes {
+			if n < int64(limit) && retired(votes[i].Voter) {
+				votes[i].Voter = ""
+				n++
+			}
+		}
+		most = max(most, n)
+	}
+	return most, nil
+}
+
+// SetClock makes Memory stamp votes, voters and revisions, and read the vote windows, with now.
+func (m *Memory) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+func (m *Memory) PruneVoters(_ context.Context, kind string, idle time.Duration, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for id, v := range m.voters {
+		if n < int64(limit) && v.kind == kind && v.last.Before(m.now().Add(-idle)) {
+			delete(m.voters, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) InsertRevision(_ context.Context, r Revision) (Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r.ID, r.CreatedAt = newID(), m.now()
+	m.revs = append(m.revs, r)
+	return r, nil
+}
+
+func (m *Memory) GetRevision(_ context.Context, profileID, id string) (Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.IndexFunc(m.revs, func(r Revision) bool { return r.ID == id && r.Profile == profileID })
+	if i < 0 { return Revision{}, ErrNotFound }
+	return m.revs[i], nil
+}
+
+func (m *Memory) Revisions(_ context.Context, profileID string) ([]Revision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := []Revision{}
+	for _, r := range m.revs {
+		if r.Profile == profileID { list = append(list, r) }
+	}
+	slices.SortStableFunc(list, func(a, b Revision) int { return cmp.Or(b.CreatedAt.Compare(a.CreatedAt), cmp.Compare(a.Field, b.Field)) })
+	return list, nil
+}
+
+func (m *Memory) SetProfileText(_ context.Context, id, fullName, description string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := m.profiles[id]
+	if p == nil { return ErrNotFound }
+	now := m.now()
+	p.FullName, p.Description, p.Slug, p.EditedAt, p.UpdatedAt = fullName, description, profile.Slug(fullName, id), &now, now
+	return nil
+}
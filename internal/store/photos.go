@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+
+	"github.com/doesnotcommit/bestfriends/internal/blob"
+	"github.com/lib/pq"
+)
+
+// A profile's photo is either in the database (photo_webp) or, when the server has object
+// storage, an object named by photo_key (migrations/035). Reads handle both, so rows written
+// before object storage was configured, or before `app move-photos` moved them out, still
+// show; new photos go wherever the store is configured to put them.
+
+// photoPrefix is the key prefix of photo objects.
+const photoPrefix = "photos"
+
+type ErrorNoBlobs string
+
+func (e ErrorNoBlobs) Error() string { return string(e) }
+
+// ErrNoBlobs is returned for a photo kept in object storage by a store configured without one.
+const ErrNoBlobs ErrorNoBlobs = "photo is in object storage, and none is configured"
+
+// PutPhoto stores a photo for a profile row: in blobs under a new key, or, when blobs is nil,
+// nowhere yet. It returns what the row's photo_webp and photo_key get.
+func PutPhoto(ctx context.Context, blobs blob.Store, data []byte, contentType string) (inline []byte, key string, err error) {
+	if blobs == nil { return data, "", nil }
+	key = blob.NewKey(photoPrefix)
+	if err := blobs.Put(ctx, key, data, contentType); err != nil { return nil, "", fmt.Errorf("store photo: %w", err) }
+	return nil, key, nil
+}
+
+func (s *Postgres) OpenPhoto(ctx context.Context, key string) (io.ReadCloser, error) {
+	if s.blobs == nil { return nil, ErrNoBlobs }
+	return s.blobs.Open(ctx, key)
+}
+
+func (s *Postgres) ReadPhoto(ctx context.Context, id string) ([]byte, error) {
+	var inline []byte
+	var key sql.NullString
+	err := s.querier(ctx).QueryRowContext(ctx, `SELECT photo_webp, photo_key FROM profiles WHERE id = $1`, id).Scan(&inline, &key)
+	if err == sql.ErrNoRows { return nil, ErrNotFound }
+	if err != nil || !key.Valid { return inline, err }
+	if s.blobs == nil { return nil, ErrNoBlobs }
+	return blob.Read(ctx, s.blobs, key.String)
+}
+
+// ReplacePhoto rewrites profile id's photo, as cmd/reprocess does, putting the new one where
+// new photos go. It returns the key of the old photo's object, if it had one, for the caller
+// to delete with DeleteObject once nothing refers to it.
+func (s *Postgres) ReplacePhoto(ctx context.Context, id string, data []byte, contentType string) (old string, err error) {
+	var oldKey sql.NullString
+	err = s.querier(ctx).QueryRowContext(ctx, `SELECT photo_key FROM profiles WHERE id = $1`, id).Scan(&oldKey)
+	if err == sql.ErrNoRows { return "", ErrNotFound }
+	if err != nil { return "", err }
+	inline, key, err := PutPhoto(ctx, s.blobs, data, contentType)
+	if err != nil { return "", err }
+	_, err = s.querier(ctx).ExecContext(ctx, `
+		UPDATE profiles SET photo_webp = $2, photo_key = NULLIF($3, ''), photo_size = $4, photo_content_type = $5,
+			photo_updated_at = now(), updated_at = now()
+		WHERE id = $1
+	`, id, inline, key, len(data), contentType)
+	if err != nil { return "", err }
+	return oldKey.String, nil
+}
+
+// DeleteObject deletes a photo object no profile refers to any more.
+func (s *Postgres) DeleteObject(ctx context.Context, key string) error {
+	if s.blobs == nil { return ErrNoBlobs }
+	return s.blobs.Delete(ctx, key)
+}
+
+// MovePhoto moves profile id's photo from the database to object storage, and reports
+// whether it did: not when it already is there, or the profile is gone. The photo is the
+// same, so photo_updated_at and the ETag stay; a response streaming it from the database just then
+// ends short, like one for a photo rewritten mid-stream.
+func (s *Postgres) MovePhoto(ctx context.Context, id string) (bool, error) {
+	if s.blobs == nil { return false, ErrNoBlobs }
+	var data []byte
+	var contentType string
+	err := s.querier(ctx).QueryRowContext(ctx, `
+		SELECT photo_webp, photo_content_type FROM profiles WHERE id = $1 AND photo_key IS NULL AND photo_webp IS NOT NULL
+	`, id).Scan(&data, &contentType)
+	if err == sql.ErrNoRows { return false, nil }
+	if err != nil { return false, err }
+	_, key, err := PutPhoto(ctx, s.blobs, data, contentType)
+	if err != nil { return false, err }
+	// Only if the photo is still the one copied: reprocessing may have rewritten it since.
+	res, err := s.querier(ctx).ExecContext(ctx, `
+		UPDATE profiles SET photo_key = $2, photo_size = $3, photo_webp = NULL WHERE id = $1 AND photo_key IS NULL AND photo_webp = $4
+	`, id, key, len(data), data)
+	var n int64
+	if err == nil { n, err = res.RowsAffected() }
+	if err != nil || n == 0 {
+		if derr := s.blobs.Delete(ctx, key); derr != nil && err == nil { err = derr }
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Postgres) Placeholders(ctx context.Context, ids []string) (map[string]Placeholder, error) {
+	rows, err := s.querier(ctx).QueryContext(ctx, `
+		SELECT pp.profile_id::string, pp.color, pp.blurhash
+		FROM photo_placeholders pp JOIN profiles p ON p.id = pp.profile_id
+		WHERE pp.profile_id = ANY($1::uuid[]) AND NOT p.photo_hidden
+	`, pq.Array(ids))
+	if err != nil { return nil, err }
+	defer rows.Close()
+	found := map[string]Placeholder{}
+	for rows.Next() {
+		var id string
+		var ph Placeholder
+		if err := rows.Scan(&id, &ph.Color, &ph.BlurHash); err != nil { return nil, err }
+		found[id] = ph
+	}
+	return found, rows.Err()
+}
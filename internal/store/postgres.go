@@ -0,0 +1,284 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doesnotcommit/bestfriends/internal/blob"
+	"github.com/doesnotcommit/bestfriends/internal/profile"
+	"github.com/lib/pq"
+)
+
+// Profiles read their location through the normalized tables. city_id is nullable so rows
+// written by an older build during a rollout still show, from the text columns.
+const (
+	CountryCol   = `COALESCE(co.name, p.location_country)`
+	CityCol      = `COALESCE(ci.name, p.location_city)`
+	LocationCols = CountryCol + `, ` + CityCol
+	LocationJoin = `LEFT JOIN cities ci ON ci.id = p.city_id LEFT JOIN countries co ON co.id = ci.country_id`
+)
+
+const (
+	// ListFrom is what listings select from: profiles p, their pin pp and location.
+	ListFrom    = `profiles p LEFT JOIN profile_pins pp ON pp.profile_id = p.id ` + LocationJoin
+	ChampionCol = `EXISTS (SELECT 1 FROM country_champions c WHERE c.profile_id = p.id)`
+)
+
+// RateLimitedCol selects whether p took limit votes within cooldown; false when limit is 0.
+// It counts no further than limit.
+func RateLimitedCol(cooldown time.Duration, limit int) string {
+	if limit <= 0 { return `false` }
+	return fmt.Sprintf(`(SELECT count(*) FROM (SELECT 1 FROM votes v WHERE v.profile_id = p.id AND v.created_at > now() - interval '%d seconds' LIMIT %d)) >= %d`,
+		int64(cooldown/time.Second), limit, limit)
+}
+
+// Postgres is the ProfileStore over the application database (CockroachDB), with photos in
+// blobs or, when that is nil, in the database (see photos.go).
+type Postgres struct {
+	db    *sql.DB
+	blobs blob.Store
+
+	VotesDualWrite bool // also write live votes to the legacy votes_recent table (see votes.go)
+}
+
+func NewPostgres(db *sql.DB, blobs blob.Store) *Postgres { return &Postgres{db: db, blobs: blobs} }
+
+// querier is the transaction in ctx, or the pool.
+func (s *Postgres) querier(ctx context.Context) interface {
+	ExecContext(context.Context, string, ...any) (sql.Result, error)
+	QueryContext(context.Context, string, ...any) (*sql.Rows, error)
+	QueryRowContext(context.Context, string, ...any) *sql.Row
+} {
+	if tx := txFrom(ctx); tx != nil { return tx }
+	return s.db
+}
+
+// ListProfiles fetches profiles ordered for the leaderboard. Besides the profile columns it
+// selects whether the profile took Filter.VoteCap votes within the cooldown, so the UI can
+// disable its button for everyone, whether it is its country's current champion, and whether
+// it is pinned, and the search rank.
+func (s *Postgres) ListProfiles(ctx context.Context, f Filter) ([]Profile, error) {
+	cond, order, rank, args := f.sql()
+	rows, err := s.querier(ctx).QueryContext(ctx, `
+		SELECT p.id::string, p.full_name, `+LocationCols+`, p.description, p.votes_count, p.created_at, p.updated_at, p.edited_at,
+			`+RateLimitedCol(f.Cooldown, f.VoteCap)+`, `+ChampionCol+`, pp.position IS NOT NULL,
+			p.status = 'retired', COALESCE(p.final_rank, 0), COALESCE(p.final_champion, ''),
+			CASE WHEN p.photo_taken_hidden THEN NULL ELSE p.photo_taken END, COALESCE(p.slug, ''), p.photo_alt, `+rank+`
+		FROM `+ListFrom+`
+		`+cond+`
+		ORDER BY `+order+`
+		LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	list := make([]Profile, 0, f.Limit)
+	for rows.Next() {
+		var p Profile
+		err := rows.Scan(&p.ID, &p.FullName, &p.Country, &p.City, &p.Description, &p.Votes, &p.CreatedAt, &p.UpdatedAt, &p.EditedAt, &p.RateLimited, &p.Champion, &p.Pinned,
+			&p.Retired, &p.FinalRank, &p.FinalChampion, &p.PhotoTaken, &p.Slug, &p.PhotoAlt, &p.SearchRank)
+		if err != nil { return nil, err }
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// SQL returns the WHERE clause and ORDER BY list for f over ListFrom and their arguments,
+// the last being the limit.
+func (f Filter) SQL() (cond, order string, args []any) {
+	cond, order, _, args = f.sql()
+	return cond, order, args
+}
+
+// sql is SQL with the expression for a row's search rank (Profile.SearchRank).
+func (f Filter) sql() (cond, order, rank string, args []any) {
+	var where []string
+	if f.ID != "" {
+		args = append(args, f.ID)
+		where = append(where, fmt.Sprintf("p.id = $%d", len(args)))
+	} else {
+		args = append(args, cmp.Or(f.Status, StatusActive))
+		where = append(where, fmt.Sprintf("p.status = $%d", len(args)))
+	}
+	if len(f.IDs) > 0 {
+		args = append(args, pq.Array(f.IDs))
+		where = append(where, fmt.Sprintf("p.id = ANY($%d::uuid[])", len(args)))
+	}
+	search, rank, args := ParseSearch(f.Query).sql(args)
+	where = append(where, search...)
+	if f.Country != "" {
+		args = append(args, strings.ToLower(f.Country))
+		where = append(where, fmt.Sprintf("lower(p.location_country) = $%d", len(args)))
+	}
+	if f.City != "" {
+		args = append(args, strings.ToLower(f.City))
+		where = append(where, fmt.Sprintf("lower(p.location_city) = $%d", len(args)))
+	}
+	if f.MinVotes > 0 {
+		args = append(args, f.MinVotes)
+		where = append(where, fmt.Sprintf("p.votes_count >= $%d", len(args)))
+	}
+	if f.After != nil {
+		if f.PinsFirst { where = append(where, "pp.position IS NULL") }
+		switch {
+		case f.After.ID == "":
+		case rank != "0":
+			args = append(args, f.After.Rank, f.After.Votes, f.After.CreatedAt, f.After.ID)
+			where = append(where, fmt.Sprintf("(%s, p.votes_count, p.created_at, p.id) < ($%d, $%d, $%d, $%d::uuid)", rank, len(args)-3, len(args)-2, len(args)-1, len(args)))
+		default:
+			// A row comparison in the order's direction: a seek on idx_profiles_status_page.
+			args = append(args, f.After.Votes, f.After.CreatedAt, f.After.ID)
+			where = append(where, fmt.Sprintf("(p.votes_count, p.created_at, p.id) < ($%d, $%d, $%d::uuid)", len(args)-2, len(args)-1, len(args)))
+		}
+	}
+	if len(where) > 0 { cond = "WHERE " + strings.Join(where, " AND ") }
+	order = "p.votes_count DESC, p.created_at DESC, p.id DESC"
+	if rank != "0" { order = rank + " DESC, " + order }
+	if f.Newest { order = "p.created_at DESC, p.id" }
+	if f.PinsFirst && f.After == nil { order = "pp.position IS NULL, pp.position, " + order }
+	return cond, order, rank, append(args, f.Limit)
+}
+
+func (s *Postgres) ProfileStatus(ctx context.Context, id string) (string, error) {
+	var status string
+	err := s.querier(ctx).QueryRowContext(ctx, `SELECT status FROM profiles WHERE id = $1`, id).Scan(&status)
+	if err == sql.ErrNoRows { return "", ErrNotFound }
+	return status, err
+}
+
+func (s *Postgres) ProfileBySlug(ctx context.Context, slug string) (id, current string, err error) {
+	err = s.querier(ctx).QueryRowContext(ctx, `SELECT id::string, slug FROM profiles WHERE slug = $1`, slug).Scan(&id, &current)
+	if err != sql.ErrNoRows { return id, current, err }
+	lo, hi, ok := shortIDRange(slug)
+	if !ok { return "", "", ErrNotFound }
+	// An id range on the primary key; two ids sharing eight hex digits would make it ambiguous.
+	rows, err := s.querier(ctx).QueryContext(ctx, `SELECT id::string, COALESCE(slug, '') FROM profiles WHERE id BETWEEN $1 AND $2 LIMIT 2`, lo, hi)
+	if err != nil { return "", "", err }
+	defer rows.Close()
+	n := 0
+	for ; rows.Next(); n++ {
+		if err := rows.Scan(&id, &current); err != nil { return "", "", err }
+	}
+	if err := rows.Err(); err != nil { return "", "", err }
+	if n != 1 { return "", "", ErrNotFound }
+	return id, current, nil
+}
+
+// CreateProfile writes the photo to object storage, when there is one, ahead of the row: a
+// transaction that then fails leaves an unreferenced object behind, not a profile without one.
+func (s *Postgres) CreateProfile(ctx context.Context, p NewProfile) (id string, created time.Time, err error) {
+	inline, key, err := PutPhoto(ctx, s.blobs, p.Photo, p.ContentType)
+	if err != nil { return "", created, err }
+	id = newID() // here rather than by the database, for the slug
+	err = s.querier(ctx).QueryRowContext(ctx, `
+		INSERT INTO profiles (id, full_name, location_country, location_city, city_id, description, photo_webp, photo_key, photo_size, photo_content_type, status, photo_taken, name_unique, slug, photo_alt)
+		VALUES ($1,$2,$3,$4,NULLIF($5, '')::UUID,$6,$7,NULLIF($8, ''),$9,$10,$11,$12,$13,$14,$15)
+		RETURNING created_at
+	`, id, p.FullName, p.Country, p.City, p.CityID, p.Description, inline, key, len(p.Photo), p.ContentType, cmp.Or(p.Status, StatusActive), p.PhotoTaken, p.NameUnique,
+		profile.Slug(p.FullName, id), p.PhotoAlt).Scan(&created)
+	if err != nil { return "", created, err }
+	return id, created, nil
+}
+
+func (s *Postgres) GetPhoto(ctx context.Context, id string) (Photo, error) {
+	var ph Photo
+	err := s.querier(ctx).QueryRowContext(ctx, `
+		SELECT photo_content_type, photo_updated_at, coalesce(photo_size, length(photo_webp)), photo_hidden, coalesce(photo_key, '')
+		FROM profiles WHERE id = $1
+	`, id).Scan(&ph.ContentType, &ph.Updated, &ph.Size, &ph.Hidden, &ph.Key)
+	if err == sql.ErrNoRows { return ph, ErrNotFound }
+	return ph, err
+}
+
+// PhotoChunk reads a substring of a photo kept in the database: photos are stored as BYTES,
+// which the driver can only return whole, so large ones are read a piece at a time.
+func (s *Postgres) PhotoChunk(ctx context.Context, id string, updated time.Time, off, n int, buf []byte) ([]byte, error) {
+	err := s.querier(ctx).QueryRowContext(ctx, `
+		SELECT substring(photo_webp FROM $2 FOR $3) FROM profiles WHERE id = $1 AND photo_updated_at = $4
+	`, id, off+1, n, updated).Scan(reuseBytes{&buf})
+	if err == sql.ErrNoRows { return buf[:0], ErrPhotoChanged }
+	return buf, err
+}
+
+// PhotoVariant treats an empty rendition, recorded for a photo that could not be resized, as
+// none.
+func (s *Postgres) PhotoVariant(ctx context.Context, id, size string) ([]byte, string, error) {
+	var data []byte
+	var contentType string
+	err := s.querier(ctx).QueryRowContext(ctx, `
+		SELECT data, content_type FROM photo_variants WHERE profile_id = $1 AND size = $2 AND length(data) > 0
+	`, id, size).Scan(&data, &contentType)
+	if err == sql.ErrNoRows { return nil, "", ErrNotFound }
+	return data, contentType, err
+}
+
+func (s *Postgres) IncrementVote(ctx context.Context, id string) error {
+	res, err := s.querier(ctx).ExecContext(ctx, `UPDATE profiles SET votes_count = votes_count + 1, updated_at = now() WHERE id = $1`, id)
+	if err != nil { return err }
+	if n, err := res.RowsAffected(); err != nil { return err } else if n == 0 { return ErrNotFound }
+	return nil
+}
+
+// rankOrder is the leaderboard ranking, pins aside: what final_rank and snapshots record.
+const rankOrder = `votes_count DESC, created_at DESC`
+
+func (s *Postgres) SnapshotRanks(ctx context.Context, day time.Time) (bool, error) {
+	q := s.querier(ctx)
+	var taken bool
+	if err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM rank_snapshots WHERE day = $1::DATE)`, day).Scan(&taken); err != nil { return false, err }
+	if taken { return false, nil }
+	// Instances racing for the same day insert the same ranks; the loser's rows conflict.
+	res, err := q.ExecContext(ctx, `
+		INSERT INTO rank_snapshots (day, profile_id, rank)
+		SELECT $1::DATE, id, rank() OVER (ORDER BY `+rankOrder+`) FROM profiles WHERE status = 'active'
+		ON CONFLICT (day, profile_id) DO NOTHING
+	`, day)
+	if err != nil { return false, err }
+	n, err := res.RowsAffected()
+	if err != nil { return false, err }
+	_, err = q.ExecContext(ctx, `DELETE FROM rank_snapshots WHERE day < $1::DATE - $2::INT`, day, RankSnapshotDays)
+	return n > 0, err
+}
+
+func (s *Postgres) RankDeltas(ctx context.Context, ids []string) (map[string]int, error) {
+	deltas := map[string]int{}
+	if len(ids) == 0 { return deltas, nil }
+	rows, err := s.querier(ctx).QueryContext(ctx, `
+		WITH current AS (
+			SELECT id, rank() OVER (ORDER BY `+rankOrder+`) AS rank FROM profiles WHERE status = 'active'
+		)
+		SELECT c.id::string, rs.rank - c.rank
+		FROM current c JOIN rank_snapshots rs ON rs.profile_id = c.id
+		WHERE c.id = ANY($1::uuid[]) AND rs.day = (SELECT max(day) FROM rank_snapshots)
+	`, pq.Array(ids))
+	if err != nil { return nil, err }
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		var d int
+		if err := rows.Scan(&id, &d); err != nil { return nil, err }
+		deltas[id] = d
+	}
+	return deltas, rows.Err()
+}
+
+// reuseBytes scans a BYTES column into an existing buffer. Scanning into *[]byte would
+// clone the driver's value into a fresh slice for every chunk.
+type reuseBytes struct{ b *[]byte }
+
+func (r reuseBytes) Scan(v any) error {
+	switch v := v.(type) {
+	case []byte:
+		*r.b = append((*r.b)[:0], v...)
+	case string:
+		*r.b = append((*r.b)[:0], v...)
+	case nil:
+		*r.b = (*r.b)[:0]
+	default:
+		return fmt.Errorf("reuseBytes: cannot scan %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/doesnotcommit/bestfriends/internal/profile"
+)
+
+// Admin edits of a profile's name and description are kept in profile_revisions
+// (migrations/024), one row per changed field, written in the transaction that updates the
+// profile (see cmd/app/revisions.go).
+
+func (s *Postgres) InsertRevision(ctx context.Context, r Revision) (Revision, error) {
+	err := s.querier(ctx).QueryRowContext(ctx, `
+		INSERT INTO profile_revisions (profile_id, field, previous, value, edited_by, reverts)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::UUID)
+		RETURNING id::string, created_at
+	`, r.Profile, r.Field, r.Previous, r.Value, r.EditedBy, r.Reverts).Scan(&r.ID, &r.CreatedAt)
+	return r, err
+}
+
+func (s *Postgres) GetRevision(ctx context.Context, profileID, id string) (Revision, error) {
+	r := Revision{ID: id, Profile: profileID}
+	err := s.querier(ctx).QueryRowContext(ctx, `
+		SELECT field, previous, value, edited_by, COALESCE(reverts::string, ''), created_at
+		FROM profile_revisions WHERE id = $1 AND profile_id = $2
+	`, id, profileID).Scan(&r.Field, &r.Previous, &r.Value, &r.EditedBy, &r.Reverts, &r.CreatedAt)
+	if err == sql.ErrNoRows { return r, ErrNotFound }
+	return r, err
+}
+
+func (s *Postgres) Revisions(ctx context.Context, profileID string) ([]Revision, error) {
+	rows, err := s.querier(ctx).QueryContext(ctx, `
+		SELECT id::string, profile_id::string, field, previous, value, edited_by, COALESCE(reverts::string, ''), created_at
+		FROM profile_revisions WHERE profile_id = $1 ORDER BY created_at DESC, field
+	`, profileID)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	list := []Revision{}
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.ID, &r.Profile, &r.Field, &r.Previous, &r.Value, &r.EditedBy, &r.Reverts, &r.CreatedAt); err != nil { return nil, err }
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// SetProfileText moves the slug with the name; the short id in the slug still finds the
+// profile from the old one (see ProfileBySlug). A name taken in the same city fails on
+// name_unique with the database's unique violation.
+func (s *Postgres) SetProfileText(ctx context.Context, id, fullName, description string) error {
+	res, err := s.querier(ctx).ExecContext(ctx, `
+		UPDATE profiles SET full_name = $2, description = $3, slug = $4, edited_at = now(), updated_at = now() WHERE id = $1
+	`, id, fullName, description, profile.Slug(fullName, id))
+	if err != nil { return err }
+	if n, err := res.RowsAffected(); err != nil { return err } else if n == 0 { return ErrNotFound }
+	return nil
+}
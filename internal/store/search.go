@@ -0,0 +1,145 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// A search (Filter.Query) is words and filters, as in
+//
+//	ada lovelace country:chile city:"la serena"
+//
+// A profile matches when it passes the filters and every word matches: a word matches when
+// the name, location or description contain it, or when the name is similar to it, so
+// "lovelase" still finds Ada Lovelace. Double quotes keep a phrase together as one word
+// ("buenos aires") or one filter value. Matches are ranked by how they matched, best first
+// and then in the vote order: see Search.Rank. The trigram inverted indexes of
+// 040_profiles_search_trgm.sql serve both the substring and the similarity matches.
+
+// MaxSearchWords caps the words of a search; the ones after it are ignored. Each word is one
+// more condition on every candidate row.
+const MaxSearchWords = 8
+
+// SimilarityThreshold is how similar (0 to 1) a word must be to a name for a fuzzy match:
+// pg_trgm.similarity_threshold, which the % operator compares to, at its default.
+const SimilarityThreshold = 0.3
+
+// Search is a parsed Filter.Query.
+type Search struct {
+	Words   []string // lowercased; every one must match
+	Country string   // exact country, case-insensitive, from country:
+	City    string   // exact city, case-insensitive, from city:
+}
+
+// ParseSearch splits q into words and filters. Unknown key:value tokens are plain words.
+func ParseSearch(q string) Search {
+	var s Search
+	for _, tok := range searchTokens(q) {
+		key, value, ok := strings.Cut(tok, ":")
+		switch key = strings.ToLower(key); {
+		case ok && key == "country":
+			s.Country = strings.TrimSpace(strings.ReplaceAll(value, `"`, ""))
+			continue
+		case ok && key == "city":
+			s.City = strings.TrimSpace(strings.ReplaceAll(value, `"`, ""))
+			continue
+		}
+		w := strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(tok, `"`, "")), " "))
+		if w != "" && len(s.Words) < MaxSearchWords { s.Words = append(s.Words, w) }
+	}
+	return s
+}
+
+// searchTokens splits q on white space outside double quotes, keeping the quotes.
+func searchTokens(q string) []string {
+	var toks []string
+	var b strings.Builder
+	quoted := false
+	for _, r := range q {
+		if r == '"' { quoted = !quoted }
+		if unicode.IsSpace(r) && !quoted {
+			if b.Len() > 0 { toks = append(toks, b.String()) }
+			b.Reset()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() > 0 { toks = append(toks, b.String()) }
+	return toks
+}
+
+// Rank scores how p matches s: for each word 3 when the name contains it, 2 when the location
+// or description does, 1 when the name is only similar to it; 0 when a word doesn't match at
+// all or a filter excludes p. Without words every profile the filters pass ranks 0, so the
+// vote order alone applies. Filter.SQL computes the same in the database.
+func (s Search) Rank(p Profile) (int, bool) {
+	if s.Country != "" && !strings.EqualFold(p.Country, s.Country) || s.City != "" && !strings.EqualFold(p.City, s.City) { return 0, false }
+	name := strings.ToLower(p.FullName)
+	text := strings.ToLower(p.FullName + " " + p.Country + " " + p.City + " " + p.Description)
+	rank := 0
+	for _, w := range s.Words {
+		switch {
+		case strings.Contains(name, w):
+			rank += 3
+		case strings.Contains(text, w):
+			rank += 2
+		case similarity(name, w) >= SimilarityThreshold:
+			rank++
+		default:
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+// sql returns the conditions for s, numbering its arguments after args, and the expression
+// for its rank ("0" without words).
+func (s Search) sql(args []any) (where []string, rank string, _ []any) {
+	var terms []string
+	for _, w := range s.Words {
+		// search_text is a STORED computed column (001_init.sql): the database rewrites it on
+		// every insert or update of the name, location or description, so it needs no upkeep.
+		args = append(args, "%"+likeEscaper.Replace(w)+"%", w)
+		like, word := len(args)-1, len(args)
+		where = append(where, fmt.Sprintf("(p.search_text LIKE $%d OR lower(p.full_name) %% $%d)", like, word))
+		terms = append(terms, fmt.Sprintf("CASE WHEN lower(p.full_name) LIKE $%d THEN 3 WHEN p.search_text LIKE $%d THEN 2 ELSE 1 END", like, like))
+	}
+	if s.Country != "" {
+		args = append(args, strings.ToLower(s.Country))
+		where = append(where, fmt.Sprintf("lower(p.location_country) = $%d", len(args)))
+	}
+	if s.City != "" {
+		args = append(args, strings.ToLower(s.City))
+		where = append(where, fmt.Sprintf("lower(p.location_city) = $%d", len(args)))
+	}
+	rank = "0"
+	if len(terms) > 0 { rank = "(" + strings.Join(terms, " + ") + ")" }
+	return where, rank, args
+}
+
+// likeEscaper escapes the LIKE wildcards in a word, which search takes literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// similarity is pg_trgm's similarity(a, b): the share of trigrams the two have in common,
+// out of all the trigrams of either. Each word is padded with two spaces in front and one
+// behind, so short words and word starts weigh in.
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 { return 0 }
+	common := 0
+	for t := range ta {
+		if tb[t] { common++ }
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// trigrams returns the set of trigrams of the words of s (runs of letters and digits), lowercased.
+func trigrams(s string) map[string]bool {
+	set := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		r := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(r); i++ { set[string(r[i:i+3])] = true }
+	}
+	return set
+}
@@ -0,0 +1,275 @@
+// Package store is the profile storage the server's core paths go through: listings, status
+// lookups, creation, photo reads, and votes and their counts. Postgres is the implementation the server
+// runs on; Memory is a fake for handler tests that need no database.
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Profile statuses.
+const (
+	StatusActive  = "active"
+	StatusHeld    = "held" // submitted while moderation holds it for review; not public
+	StatusRetired = "retired"
+)
+
+type ErrorNotFound string
+
+func (e ErrorNotFound) Error() string { return string(e) }
+func (ErrorNotFound) NotFound()       {}
+
+const ErrNotFound ErrorNotFound = "not found"
+
+// ErrPhotoChanged is returned by PhotoChunk when the photo was rewritten since the metadata
+// the caller holds was read.
+const ErrPhotoChanged ErrorNotFound = "photo changed while streaming"
+
+// ProfileStore reads and writes profiles and their votes. Postgres methods run in the
+// transaction ctx carries (see WithTx and InTx), so callers can combine them with their own
+// statements atomically.
+type ProfileStore interface {
+	VoteStore
+	RevisionStore
+	// ListProfiles returns the profiles f selects, in leaderboard order.
+	ListProfiles(ctx context.Context, f Filter) ([]Profile, error)
+	// ProfileStatus returns the status of profile id.
+	ProfileStatus(ctx context.Context, id string) (string, error)
+	// ProfileBySlug returns the id and current slug of the profile slug names: the one with
+	// that slug, else the one whose id starts with its short id (profile.ShortID), as in a
+	// slug from before a rename.
+	ProfileBySlug(ctx context.Context, slug string) (id, current string, err error)
+	// CreateProfile inserts p and returns its id and creation time.
+	CreateProfile(ctx context.Context, p NewProfile) (string, time.Time, error)
+	// GetPhoto returns what a photo response needs before its bytes.
+	GetPhoto(ctx context.Context, id string) (Photo, error)
+	// PhotoChunk reads up to n bytes of photo id, kept in the database, from offset off into
+	// buf (reusing its storage), as long as the photo is still the one of Photo.Updated.
+	PhotoChunk(ctx context.Context, id string, updated time.Time, off, n int, buf []byte) ([]byte, error)
+	// OpenPhoto reads a photo kept in object storage by its Photo.Key.
+	OpenPhoto(ctx context.Context, key string) (io.ReadCloser, error)
+	// ReadPhoto returns the whole photo of profile id, wherever it is kept.
+	ReadPhoto(ctx context.Context, id string) ([]byte, error)
+	// PhotoVariant returns a smaller rendition of photo id and its content type; ErrNotFound
+	// when it has none of that size (yet).
+	PhotoVariant(ctx context.Context, id, size string) ([]byte, string, error)
+	// Placeholders returns the placeholders of the photos of ids that have one and aren't
+	// hidden (a blurred preview of a taken-down photo is still the photo).
+	Placeholders(ctx context.Context, ids []string) (map[string]Placeholder, error)
+	// IncrementVote adds one to profile id's vote count.
+	IncrementVote(ctx context.Context, id string) error
+	// SnapshotRanks records every active profile's rank for day unless that day has a
+	// snapshot already, and reports whether it took one. Snapshots older than
+	// RankSnapshotDays days are dropped.
+	SnapshotRanks(ctx context.Context, day time.Time) (bool, error)
+	// RankDeltas returns, for those of ids ranked in the newest snapshot and still active,
+	// the places they gained (positive) or lost (negative) since.
+	RankDeltas(ctx context.Context, ids []string) (map[string]int, error)
+}
+
+// VoteStore records votes and the voters who cast them. A vote's checks and its writes go in
+// one transaction (InTx), so two votes racing past the vote limits can't both count.
+type VoteStore interface {
+	// InTx runs fn in a serializable transaction, which the ctx fn gets carries. Within a
+	// transaction already, fn joins it.
+	InTx(ctx context.Context, fn func(context.Context) error) error
+	// VoteExists reports whether the vote id was recorded: a form's vote token was used.
+	VoteExists(ctx context.Context, id string) (bool, error)
+	// RecentVotes looks at the votes cast within the last within, for profile and by any of
+	// voters; with profile "" at the voters' votes for any profile only.
+	RecentVotes(ctx context.Context, profile string, voters []string, within time.Duration, limit int) (RecentVotes, error)
+	// VotedProfiles returns the profiles any of voters voted for within the last within.
+	VotedProfiles(ctx context.Context, voters []string, within time.Duration) (map[string]bool, error)
+	// VotesPerDay counts the votes for each of ids per UTC day since since; days without
+	// votes are left out.
+	VotesPerDay(ctx context.Context, ids []string, since time.Time) ([]DayVotes, error)
+	// InsertVote records v, generating its id when it has none.
+	InsertVote(ctx context.Context, v Vote) error
+	// FlushVotes adds every uncounted vote to its profile's vote count and marks it counted.
+	FlushVotes(ctx context.Context) error
+	// NoteVoter records that voter id, of kind, cast a vote.
+	NoteVoter(ctx context.Context, id, kind string) error
+	// PruneVoters forgets up to limit voters of kind that haven't voted within idle and
+	// returns how many it forgot.
+	PruneVoters(ctx context.Context, kind string, idle time.Duration, limit int) (int64, error)
+	// RetireFingerprints forgets the fingerprint voters made with a key whose period is not
+	// in live, and blanks the voter of the votes they cast, up to limit rows of each table.
+	// It returns the most rows it changed in one table: fewer than limit means it is done.
+	RetireFingerprints(ctx context.Context, live []string, limit int) (int64, error)
+}
+
+// RevisionStore keeps the edit history of profile names and descriptions.
+type RevisionStore interface {
+	// InsertRevision records r and returns it with its id and time.
+	InsertRevision(ctx context.Context, r Revision) (Revision, error)
+	// GetRevision returns revision id of profile profileID.
+	GetRevision(ctx context.Context, profileID, id string) (Revision, error)
+	// Revisions returns profile profileID's revisions, newest first.
+	Revisions(ctx context.Context, profileID string) ([]Revision, error)
+	// SetProfileText sets profile id's name and description, and marks it edited.
+	SetProfileText(ctx context.Context, id, fullName, description string) error
+}
+
+// Revision is one change to a profile field ("full_name" or "description").
+type Revision struct {
+	ID        string // "" until recorded
+	Profile   string
+	Field     string
+	Previous  string
+	Value     string
+	EditedBy  string
+	Reverts   string // the revision this one undid; "" for an edit
+	CreatedAt time.Time
+}
+
+// Vote is a vote as cast. Votes left uncounted are counted by the next FlushVotes.
+type Vote struct {
+	ID      string // "" generates one
+	Profile string
+	Voter   string // the voter's id; "" for votes nobody cast directly
+	Counted bool   // already in the profile's vote count
+}
+
+// DayVotes is how many votes a profile took on a UTC day.
+type DayVotes struct {
+	Profile string
+	Day     time.Time // midnight UTC
+	Votes   int
+}
+
+// RecentVotes is what RecentVotes found.
+type RecentVotes struct {
+	Now    time.Time  // the database clock the window ends at
+	Last   *time.Time // the voters' newest vote; nil when none
+	Oldest *time.Time // the profile's oldest vote; nil when none
+	Count  int        // the profile's votes, counted no further than limit
+}
+
+// RankSnapshotDays is how many days of rank snapshots are kept.
+const RankSnapshotDays = 30
+
+// Profile is a profile as listed. The fields after DescriptionLang are not stored on the
+// profile; the server fills them from other tables for the pages that show them.
+type Profile struct {
+	ID            string
+	FullName      string
+	Country       string
+	City          string
+	Description   string
+	Votes         int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	EditedAt      *time.Time // last name or description edit; nil when never edited
+	RateLimited   bool       // took VoteCap votes within the vote cooldown
+	Champion      bool       // current top profile of its country
+	Pinned        bool       // featured by an admin
+	Retired       bool       // in the alumni section; takes no votes
+	FinalRank     int        // overall rank when retired
+	FinalChampion string     // country it was champion of when retired
+	PhotoTaken    *time.Time // month the photo was taken (its first day), from EXIF; nil when unknown or hidden
+	Slug          string     // its page is /p/{Slug} (profile.Slug); empty until the slugs job reaches an older row
+	PhotoAlt      string     // the submitter's description of the photo; empty on profiles from before it was asked for
+	SearchRank    int        // how well it matches Filter.Query (Search.Rank); 0 without search words
+
+	Trend           []int  // votes per day over the last week, oldest first (home page only)
+	DescriptionLang string // detected by an earlier translation; empty when unknown
+	RankDelta       int    // places gained (positive) or lost since the last rank snapshot
+	PhotoColor      string // average colour of the photo, "#rrggbb"; empty when not known yet
+	PhotoBlurHash   string // BlurHash shown until the photo loads; empty when not known yet
+}
+
+// Cursor is a position in the vote order (votes, then newest, then id, all descending),
+// for keyset pagination: Filter.After lists what comes after it without counting rows. The
+// zero Cursor is the start of the order. Pinned profiles come first on the first page only, so
+// with PinsFirst the pages after it leave them out, and a page of nothing but pins continues
+// from the zero Cursor. Paging applies to the vote order, not to Newest. A search with words
+// orders by its rank first, so its cursors carry the rank too.
+type Cursor struct {
+	Rank      int // Profile.SearchRank
+	Votes     int
+	CreatedAt time.Time
+	ID        string
+}
+
+// Filter narrows a leaderboard listing; empty fields don't filter.
+type Filter struct {
+	ID       string   // a single profile
+	IDs      []string // any of these profiles
+	Query    string   // a search: words and country:/city: filters (see ParseSearch)
+	Country  string   // exact country, case-insensitive
+	City     string   // exact city, case-insensitive
+	MinVotes int      // at least this many votes; 0 doesn't filter
+	Limit    int
+	After    *Cursor  // the page after this cursor in vote order; nil is the first page
+
+	PinsFirst bool   // order pinned profiles ahead of the vote ranking
+	Newest    bool   // order by creation, newest first, instead of by votes
+	Status    string // profiles in this status; "" is StatusActive (lookups by ID see every status)
+
+	Cooldown time.Duration // votes within it count towards VoteCap
+	VoteCap  int           // votes within Cooldown that set RateLimited; 0 never sets it
+}
+
+// NewProfile is a profile to create, its photo already processed.
+type NewProfile struct {
+	FullName    string
+	Country     string
+	City        string
+	CityID      string // normalized location (see cmd/app/locations.go); "" leaves it unset
+	Description string
+	PhotoAlt    string // alt text of the photo
+	Photo       []byte
+	ContentType string
+	Status      string
+	PhotoTaken  *time.Time // month the photo was taken (its first day); nil to leave it unknown
+	NameUnique  bool       // submitted under the enforce name policy; see cmd/app/duplicates.go
+}
+
+// Placeholder is what a card shows until its photo loads. Both are empty for a photo that
+// could not be summarized.
+type Placeholder struct {
+	Color    string // average colour, "#rrggbb"
+	BlurHash string
+}
+
+// Photo is what a photo response needs before its bytes, which are read with PhotoChunk.
+type Photo struct {
+	ContentType string
+	Updated     time.Time // when the photo last changed (photo_updated_at), which votes leave alone
+	Size        int
+	Hidden      bool   // a takedown request hides it
+	Key         string // its object in object storage, read with OpenPhoto; "" when it is in the database
+}
+
+type txKey struct{}
+
+// WithTx returns ctx carrying tx, for Postgres methods to run in.
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+func txFrom(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txKey{}).(*sql.Tx)
+	return tx
+}
+
+// newID returns a random (version 4) UUID for a new profile.
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil { panic(err) } // crypto/rand does not fail on supported platforms
+	b[6], b[8] = b[6]&0x0f|0x40, b[8]&0x3f|0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// shortIDRange returns the range of ids starting with the short id that ends slug.
+func shortIDRange(slug string) (lo, hi string, ok bool) {
+	short := slug[strings.LastIndexByte(slug, '-')+1:]
+	if len(short) != 8 || strings.Trim(short, "0123456789abcdef") != "" { return "", "", false }
+	return short + "-0000-0000-0000-000000000000", short + "-ffff-ffff-ffff-ffffffffffff", true
+}
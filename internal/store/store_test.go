@@ -0,0 +1,240 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReuseBytesCopiesIntoBuffer(t *testing.T) {
+	buf := make([]byte, 0, 8)
+	dst := reuseBytes{&buf}
+	src := []byte("chunk")
+	if err := dst.Scan(src); err != nil { t.Fatal(err) }
+	src[0] = 'X' // the driver may reuse its slice for the next row
+	if string(buf) != "chunk" { t.Errorf("buf = %q, want a copy of the scanned value", buf) }
+	if err := dst.Scan([]byte("ab")); err != nil { t.Fatal(err) }
+	if string(buf) != "ab" || cap(buf) != 8 { t.Errorf("buf = %q (cap %d), want \"ab\" in the same backing array", buf, cap(buf)) }
+	if err := dst.Scan(nil); err != nil || len(buf) != 0 { t.Errorf("Scan(nil) = %v, buf %q", err, buf) }
+	if err := dst.Scan(42); err == nil { t.Error("Scan(int) succeeded") }
+}
+
+func TestFilterSQL(t *testing.T) {
+	cond, order, args := Filter{Query: "Ada", Country: "Chile", Limit: 10, PinsFirst: true}.SQL()
+	if cond != "WHERE p.status = $1 AND (p.search_text LIKE $2 OR lower(p.full_name) % $3) AND lower(p.location_country) = $4" { t.Errorf("cond = %s", cond) }
+	rank := "(CASE WHEN lower(p.full_name) LIKE $2 THEN 3 WHEN p.search_text LIKE $2 THEN 2 ELSE 1 END)"
+	if order != "pp.position IS NULL, pp.position, "+rank+" DESC, p.votes_count DESC, p.created_at DESC, p.id DESC" { t.Errorf("order = %s", order) }
+	if len(args) != 5 || args[0] != StatusActive || args[1] != "%ada%" || args[2] != "ada" || args[3] != "chile" || args[4] != 10 { t.Errorf("args = %v", args) }
+
+	at := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	cond, order, args = Filter{Limit: 10, PinsFirst: true, After: &Cursor{Votes: 7, CreatedAt: at, ID: "p1"}}.SQL()
+	if cond != "WHERE p.status = $1 AND pp.position IS NULL AND (p.votes_count, p.created_at, p.id) < ($2, $3, $4::uuid)" { t.Errorf("after: cond = %s", cond) }
+	if order != "p.votes_count DESC, p.created_at DESC, p.id DESC" { t.Errorf("after: order = %s", order) }
+	if len(args) != 5 || args[1] != 7 || args[2] != at || args[3] != "p1" { t.Errorf("after: args = %v", args) }
+
+	cond, _, args = Filter{Query: `50%_off city:"La Serena"`, After: &Cursor{Rank: 3, Votes: 7, CreatedAt: at, ID: "p1"}}.SQL()
+	rank = "(CASE WHEN lower(p.full_name) LIKE $2 THEN 3 WHEN p.search_text LIKE $2 THEN 2 ELSE 1 END)"
+	if cond != "WHERE p.status = $1 AND (p.search_text LIKE $2 OR lower(p.full_name) % $3) AND lower(p.location_city) = $4 AND ("+rank+", p.votes_count, p.created_at, p.id) < ($5, $6, $7, $8::uuid)" {
+		t.Errorf("search after: cond = %s", cond)
+	}
+	if len(args) != 9 || args[1] != `%50\%\_off%` || args[3] != "la serena" || args[4] != 3 { t.Errorf("search after: args = %v", args) }
+
+	cond, order, args = Filter{ID: "p1", Newest: true, Limit: 1}.SQL()
+	if cond != "WHERE p.id = $1" || order != "p.created_at DESC, p.id" || len(args) != 2 { t.Errorf("by id: %s / %s / %v", cond, order, args) }
+}
+
+func TestParseSearch(t *testing.T) {
+	for _, tt := range []struct {
+		q    string
+		want Search
+	}{
+		{"", Search{}},
+		{"  Ada   LOVELACE ", Search{Words: []string{"ada", "lovelace"}}},
+		{`"Buenos  Aires" country:Argentina`, Search{Words: []string{"buenos aires"}, Country: "Argentina"}},
+		{`City:"La Serena" ada`, Search{Words: []string{"ada"}, City: "La Serena"}},
+		{"note:x", Search{Words: []string{"note:x"}}},
+		{"a b c d e f g h i", Search{Words: []string{"a", "b", "c", "d", "e", "f", "g", "h"}}},
+	} {
+		got := ParseSearch(tt.q)
+		if !slices.Equal(got.Words, tt.want.Words) || got.Country != tt.want.Country || got.City != tt.want.City { t.Errorf("ParseSearch(%q) = %+v, want %+v", tt.q, got, tt.want) }
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want float64
+	}{
+		{"word", "word", 1},
+		{"word", "two words", 4.0 / 11}, // pg_trgm's documented example: 0.36363637
+		{"ada", "xyz", 0},
+		{"", "ada", 0},
+	} {
+		if got := similarity(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 { t.Errorf("similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want) }
+	}
+	if similarity("ada lovelace", "lovelase") < SimilarityThreshold { t.Error("a typo in a surname is not similar enough") }
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	base := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	m.Put(Profile{ID: "a", FullName: "Ada", Country: "Chile", City: "Arica", Votes: 5, CreatedAt: base}, "", []byte("photo-a"), "image/jpeg")
+	m.Put(Profile{ID: "b", FullName: "Bo", Country: "Peru", City: "Lima", Votes: 9, CreatedAt: base.Add(time.Hour)}, "", nil, "image/jpeg")
+	m.Put(Profile{ID: "c", FullName: "Cy", Country: "Chile", City: "Lima", Votes: 7, CreatedAt: base, Pinned: true}, "", nil, "image/jpeg")
+	m.Put(Profile{ID: "r", FullName: "Rex", Country: "Chile", Votes: 99, CreatedAt: base}, StatusRetired, nil, "image/jpeg")
+
+	ids := func(list []Profile) string {
+		var out []string
+		for _, p := range list { out = append(out, p.ID) }
+		return strings.Join(out, ",")
+	}
+	for _, tc := range []struct {
+		f    Filter
+		want string
+	}{
+		{Filter{}, "b,c,a"},
+		{Filter{PinsFirst: true}, "c,b,a"},
+		{Filter{Newest: true}, "b,a,c"},
+		{Filter{Country: "chile"}, "c,a"},
+		{Filter{Query: "LIMA", MinVotes: 8}, "b"},
+		{Filter{Limit: 1}, "b"},
+		{Filter{Status: StatusRetired}, "r"},
+		{Filter{ID: "r"}, "r"},
+		{Filter{IDs: []string{"a", "r"}}, "a"},
+		{Filter{After: &Cursor{Votes: 9, CreatedAt: base.Add(time.Hour), ID: "b"}}, "c,a"},
+		{Filter{PinsFirst: true, After: &Cursor{Votes: 9, CreatedAt: base.Add(time.Hour), ID: "b"}}, "a"},
+		{Filter{PinsFirst: true, After: &Cursor{}}, "b,a"},
+		{Filter{After: &Cursor{Votes: 5, CreatedAt: base, ID: "b"}}, "a"},
+		{Filter{Query: "lima country:chile"}, "c"},
+		{Filter{Query: "a"}, "a,b,c"}, // in Ada's name, then in the others' Lima
+		{Filter{Query: "adda"}, "a"},  // similar to Ada
+		{Filter{Query: "a", After: &Cursor{Rank: 3, Votes: 5, CreatedAt: base, ID: "a"}}, "b,c"},
+	} {
+		list, err := m.ListProfiles(ctx, tc.f)
+		if err != nil || ids(list) != tc.want { t.Errorf("ListProfiles(%+v) = %s, %v; want %s", tc.f, ids(list), err, tc.want) }
+	}
+
+	if err := m.IncrementVote(ctx, "a"); err != nil { t.Fatal(err) }
+	list, _ := m.ListProfiles(ctx, Filter{ID: "a", Cooldown: time.Hour, VoteCap: 1})
+	if list[0].Votes != 6 || !list[0].RateLimited { t.Errorf("after a vote: %+v", list[0]) }
+	for _, f := range []Filter{{ID: "a", Cooldown: time.Hour, VoteCap: 2}, {ID: "a", Cooldown: time.Hour}} {
+		if list, _ := m.ListProfiles(ctx, f); list[0].RateLimited { t.Errorf("after a vote, cap %d: rate limited", f.VoteCap) }
+	}
+	if err := m.IncrementVote(ctx, "zz"); !errors.Is(err, ErrNotFound) { t.Errorf("IncrementVote(missing) = %v", err) }
+
+	ph, err := m.GetPhoto(ctx, "a")
+	if err != nil || ph.Size != 7 || ph.ContentType != "image/jpeg" { t.Fatalf("GetPhoto = %+v, %v", ph, err) }
+	buf, err := m.PhotoChunk(ctx, "a", ph.Updated, 6, 4, make([]byte, 0, 4))
+	if err != nil || string(buf) != "a" { t.Errorf("PhotoChunk = %q, %v", buf, err) }
+	if _, err := m.PhotoChunk(ctx, "a", ph.Updated.Add(-time.Second), 0, 4, nil); !errors.Is(err, ErrPhotoChanged) { t.Errorf("stale PhotoChunk = %v", err) }
+
+	id, _, err := m.CreateProfile(ctx, NewProfile{FullName: "Di", Country: "Peru", City: "Cusco", Status: StatusHeld, Photo: []byte("x")})
+	if err != nil { t.Fatal(err) }
+	if status, err := m.ProfileStatus(ctx, id); err != nil || status != StatusHeld { t.Errorf("ProfileStatus(new) = %q, %v", status, err) }
+	if _, err := m.ProfileStatus(ctx, "zz"); !errors.As(err, new(interface{ NotFound() })) { t.Errorf("ProfileStatus(missing) = %v", err) }
+	slug := id[:8]
+	if got, cur, err := m.ProfileBySlug(ctx, "di-"+slug); err != nil || got != id || cur != "di-"+slug { t.Errorf("ProfileBySlug = %q, %q, %v", got, cur, err) }
+	if got, cur, err := m.ProfileBySlug(ctx, "old-name-"+slug); err != nil || got != id || cur != "di-"+slug { t.Errorf("ProfileBySlug(renamed) = %q, %q, %v", got, cur, err) }
+	for _, bad := range []string{"di", "di-zzzzzzzz", "di-" + slug + "0"} {
+		if _, _, err := m.ProfileBySlug(ctx, bad); !errors.Is(err, ErrNotFound) { t.Errorf("ProfileBySlug(%q) = %v", bad, err) }
+	}
+
+	day := base.AddDate(0, 0, 1)
+	if took, err := m.SnapshotRanks(ctx, day); err != nil || !took { t.Fatalf("SnapshotRanks = %t, %v", took, err) }
+	if took, err := m.SnapshotRanks(ctx, day); err != nil || took { t.Errorf("second SnapshotRanks the same day = %t, %v", took, err) }
+	for range 4 { m.IncrementVote(ctx, "a") } // a: 6 -> 10 votes, from third to first
+	deltas, err := m.RankDeltas(ctx, []string{"a", "b", "r", id})
+	if err != nil { t.Fatal(err) }
+	if len(deltas) != 2 || deltas["a"] != 2 || deltas["b"] != -1 { t.Errorf("RankDeltas = %v, want a +2, b -1 and none for retired or unranked", deltas) }
+}
+
+func TestMemoryVotes(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	m.Put(Profile{ID: "a"}, "", nil, "")
+	m.Put(Profile{ID: "b"}, "", nil, "")
+	votes := func(id string) int {
+		list, _ := m.ListProfiles(ctx, Filter{ID: id})
+		return list[0].Votes
+	}
+
+	if err := m.InsertVote(ctx, Vote{ID: "v1", Profile: "a", Voter: "cookie.x"}); err != nil { t.Fatal(err) }
+	now = now.Add(time.Minute)
+	if err := m.InsertVote(ctx, Vote{Profile: "a", Voter: "cookie.y"}); err != nil { t.Fatal(err) }
+	if err := m.InsertVote(ctx, Vote{ID: "v1", Profile: "b"}); err == nil { t.Error("a vote id was used twice") }
+	if used, _ := m.VoteExists(ctx, "v1"); !used { t.Error("VoteExists(v1) = false") }
+
+	rv, err := m.RecentVotes(ctx, "a", []string{"cookie.x"}, time.Hour, 1)
+	if err != nil || rv.Last == nil || !rv.Last.Equal(now.Add(-time.Minute)) || !rv.Oldest.Equal(*rv.Last) || rv.Count != 1 { t.Errorf("RecentVotes = %+v, %v", rv, err) }
+	if rv, _ := m.RecentVotes(ctx, "b", []string{"cookie.x"}, time.Hour, 5); rv.Last != nil || rv.Count != 0 { t.Errorf("RecentVotes(b) = %+v", rv) }
+	if rv, _ := m.RecentVotes(ctx, "", []string{"cookie.x"}, 30*time.Second, 5); rv.Last != nil { t.Errorf("RecentVotes outside the window = %+v", rv) }
+	if voted, _ := m.VotedProfiles(ctx, []string{"cookie.y", "cookie.z"}, time.Hour); len(voted) != 1 || !voted["a"] { t.Errorf("VotedProfiles = %v", voted) }
+
+	if votes("a") != 0 { t.Error("uncounted votes are counted before the flush") }
+	if err := m.FlushVotes(ctx); err != nil { t.Fatal(err) }
+	if err := m.FlushVotes(ctx); err != nil { t.Fatal(err) }
+	if votes("a") != 2 { t.Errorf("votes after flushing twice = %d, want 2", votes("a")) }
+	days, _ := m.VotesPerDay(ctx, []string{"a", "b"}, now.Add(-24*time.Hour))
+	if len(days) != 1 || days[0].Profile != "a" || days[0].Votes != 2 || !days[0].Day.Equal(now.Truncate(24*time.Hour)) { t.Errorf("VotesPerDay = %+v", days) }
+
+	m.NoteVoter(ctx, "cookie.x", "cookie")
+	m.NoteVoter(ctx, "fp.1", "fingerprint")
+	now = now.Add(48 * time.Hour)
+	m.NoteVoter(ctx, "cookie.y", "cookie")
+	if n, _ := m.PruneVoters(ctx, "cookie", 24*time.Hour, 10); n != 1 || m.voters["cookie.x"] != nil || m.voters["fp.1"] == nil { t.Errorf("PruneVoters = %d, left %v", n, m.voters) }
+}
+
+// During the rollout of migrations/033 the previous build's flusher counts the dual-written
+// copies in the legacy table; a vote either flusher counted first is not counted again.
+func TestMemoryFlushVotesAfterLegacyFlush(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.VotesDualWrite = true
+	m.Put(Profile{ID: "a"}, "", nil, "")
+	votes := func() int {
+		list, _ := m.ListProfiles(ctx, Filter{ID: "a"})
+		return list[0].Votes
+	}
+
+	if err := m.InsertVote(ctx, Vote{Profile: "a"}); err != nil { t.Fatal(err) }
+	m.FlushLegacyVotes()
+	if err := m.FlushVotes(ctx); err != nil { t.Fatal(err) }
+	if votes() != 1 { t.Errorf("votes after the old flush, then the new one = %d, want 1", votes()) }
+
+	if err := m.InsertVote(ctx, Vote{Profile: "a"}); err != nil { t.Fatal(err) }
+	if err := m.FlushVotes(ctx); err != nil { t.Fatal(err) }
+	m.FlushLegacyVotes()
+	if votes() != 2 { t.Errorf("votes after the new flush, then the old one = %d, want 2", votes()) }
+}
+
+// Retiring a visitor key unlinks the fingerprints it made, and only those: cookie and kiosk
+// voters are not keyed, and kiosk sessions count their votes by voter.
+func TestMemoryRetireFingerprints(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	m.VotesDualWrite = true
+	m.Put(Profile{ID: "a"}, "", nil, "")
+	voters := map[string]string{"100.old": "fingerprint", "104.new": "fingerprint", "cookie.1f": "cookie", "kiosk.3f2a9c1e-0000": "kiosk"}
+	for id, kind := range voters {
+		if err := m.InsertVote(ctx, Vote{Profile: "a", Voter: id}); err != nil { t.Fatal(err) }
+		m.NoteVoter(ctx, id, kind)
+	}
+
+	n, err := m.RetireFingerprints(ctx, []string{"104", "103"}, 10)
+	if err != nil || n != 1 { t.Fatalf("RetireFingerprints = %d, %v", n, err) }
+	for _, votes := range [][]memVote{m.votes, m.legacy} {
+		var left []string
+		for _, v := range votes { left = append(left, v.Voter) }
+		slices.Sort(left)
+		if want := []string{"", "104.new", "cookie.1f", "kiosk.3f2a9c1e-0000"}; !slices.Equal(left, want) { t.Errorf("voters of the votes = %q, want %q", left, want) }
+	}
+	if len(m.voters) != 3 || m.voters["100.old"] != nil { t.Errorf("voters = %v", m.voters) }
+	if n, _ := m.RetireFingerprints(ctx, []string{"104", "103"}, 10); n != 0 { t.Errorf("second RetireFingerprints = %d", n) }
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Every vote is a row in votes (migrations/033), kept for good: the vote limits are index
+// lookups on it and profiles.votes_count is its maintained counter. It replaced votes_recent,
+// the live cooldown window, which Postgres.VotesDualWrite keeps writing for the transition (see
+// cmd/app/votes.go).
+
+// votesWithin is the condition for votes cast within the last d.
+func votesWithin(d time.Duration) string {
+	return fmt.Sprintf("created_at > now() - interval '%d seconds'", int64(d/time.Second))
+}
+
+func (s *Postgres) InTx(ctx context.Context, fn func(context.Context) error) error {
+	if txFrom(ctx) != nil { return fn(ctx) }
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil { return err }
+	defer func() {
+		if p := recover(); p != nil { _ = tx.Rollback(); panic(p) }
+	}()
+	if err := fn(WithTx(ctx, tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Postgres) VoteExists(ctx context.Context, id string) (bool, error) {
+	var used bool
+	err := s.querier(ctx).QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM votes WHERE id = $1)`, id).Scan(&used)
+	return used, err
+}
+
+func (s *Postgres) RecentVotes(ctx context.Context, profile string, voters []string, d time.Duration, limit int) (RecentVotes, error) {
+	var rv RecentVotes
+	mine := `profile_id = $1 AND voter = ANY($2)`
+	var id any = profile
+	if profile == "" { mine, id = `voter = ANY($2)`, nil } // profile_id = NULL: no votes of the profile's
+	err := s.querier(ctx).QueryRowContext(ctx, `
+		SELECT now(),
+			(SELECT max(created_at) FROM votes WHERE `+mine+` AND `+votesWithin(d)+`),
+			(SELECT created_at FROM votes WHERE profile_id = $1 AND `+votesWithin(d)+` ORDER BY created_at LIMIT 1),
+			(SELECT count(*) FROM (SELECT 1 FROM votes WHERE profile_id = $1 AND `+votesWithin(d)+` LIMIT $3))
+	`, id, pq.Array(voters), limit).Scan(&rv.Now, &rv.Last, &rv.Oldest, &rv.Count)
+	return rv, err
+}
+
+func (s *Postgres) VotedProfiles(ctx context.Context, voters []string, d time.Duration) (map[string]bool, error) {
+	rows, err := s.querier(ctx).QueryContext(ctx, `
+		SELECT DISTINCT profile_id::string FROM votes WHERE voter = ANY($1) AND `+votesWithin(d), pq.Array(voters))
+	if err != nil { return nil, err }
+	defer rows.Close()
+	voted := map[string]bool{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil { return nil, err }
+		voted[id] = true
+	}
+	return voted, rows.Err()
+}
+
+func (s *Postgres) VotesPerDay(ctx context.Context, ids []string, since time.Time) ([]DayVotes, error) {
+	rows, err := s.querier(ctx).QueryContext(ctx, `
+		SELECT profile_id::string, (created_at AT TIME ZONE 'UTC')::date::string AS day, count(*)
+		FROM votes WHERE profile_id = ANY($1::uuid[]) AND created_at >= $2
+		GROUP BY 1, 2
+	`, pq.Array(ids), since)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var days []DayVotes
+	for rows.Next() {
+		var d DayVotes
+		var day string
+		if err := rows.Scan(&d.Profile, &day, &d.Votes); err != nil { return nil, err }
+		if d.Day, err = time.Parse(time.DateOnly, day); err != nil { return nil, err }
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// InsertVote writes votes_recent the same row while dual-writing.
+func (s *Postgres) InsertVote(ctx context.Context, v Vote) error {
+	q := `INSERT INTO votes (id, profile_id, voter, counted) VALUES (coalesce(NULLIF($2, '')::UUID, gen_random_uuid()), $1, $3, $4)`
+	if s.VotesDualWrite {
+		q = `WITH v AS (` + q + ` RETURNING id, profile_id, voter, counted, created_at)
+			INSERT INTO votes_recent (id, profile_id, voter, counted, created_at) SELECT id, profile_id, voter, counted, created_at FROM v`
+	}
+	_, err := s.querier(ctx).ExecContext(ctx, q, v.Profile, v.ID, v.Voter, v.Counted)
+	return err
+}
+
+// FlushVotes counts the uncounted votes of every instance. The dual-written copies in
+// votes_recent are marked counted along with them. During the rollout of migrations/033 the
+// previous build's flusher counts votes_recent too: a vote whose copy it counted already is
+// only marked counted here, and an uncounted votes_recent row without a copy, which one of
+// its instances cast, is copied into votes first, so it is counted here rather than lost.
+func (s *Postgres) FlushVotes(ctx context.Context) error {
+	return s.InTx(ctx, func(ctx context.Context) error {
+		q := s.querier(ctx)
+		_, err := q.ExecContext(ctx, `
+			UPDATE votes v SET counted = true FROM votes_recent r WHERE r.id = v.id AND r.counted AND NOT v.counted
+		`)
+		if err != nil { return err }
+		_, err = q.ExecContext(ctx, `
+			INSERT INTO votes (id, profile_id, voter, counted, created_at)
+			SELECT id, profile_id, voter, false, created_at FROM votes_recent WHERE NOT counted
+			ON CONFLICT (id) DO NOTHING
+		`)
+		if err != nil { return err }
+		_, err = q.ExecContext(ctx, `
+			WITH pending AS (
+				UPDATE votes SET counted = true WHERE NOT counted RETURNING profile_id
+			)
+			UPDATE profiles p SET votes_count = p.votes_count + n.n, updated_at = now()
+			FROM (SELECT profile_id, count(*) AS n FROM pending GROUP BY profile_id) n
+			WHERE p.id = n.profile_id
+		`)
+		if err != nil { return err }
+		_, err = q.ExecContext(ctx, `UPDATE votes_recent SET counted = true WHERE NOT counted`)
+		return err
+	})
+}
+
+func (s *Postgres) NoteVoter(ctx context.Context, id, kind string) error {
+	_, err := s.querier(ctx).ExecContext(ctx, `
+		INSERT INTO voters AS v (id, kind, votes) VALUES ($1, $2, 1)
+		ON CONFLICT (id) DO UPDATE SET votes = v.votes + 1, last_vote_at = now()
+	`, id, kind)
+	return err
+}
+
+// fingerprintVoter matches the voter ids that are fingerprints, "<key period>.<mac>", and not
+// "cookie.<id>" or "kiosk.<session id>".
+const fingerprintVoter = `voter ~ '^[0-9]+\.'`
+
+// RetireFingerprints blanks votes_recent too, whether or not it is still written.
+func (s *Postgres) RetireFingerprints(ctx context.Context, live []string, limit int) (int64, error) {
+	var most int64
+	for _, q := range []string{
+		`DELETE FROM voters WHERE kind = 'fingerprint' AND split_part(id, '.', 1) != ALL($1) LIMIT $2`,
+		`UPDATE votes SET voter = '' WHERE ` + fingerprintVoter + ` AND split_part(voter, '.', 1) != ALL($1) LIMIT $2`,
+		`UPDATE votes_recent SET voter = '' WHERE ` + fingerprintVoter + ` AND split_part(voter, '.', 1) != ALL($1) LIMIT $2`,
+	} {
+		res, err := s.querier(ctx).ExecContext(ctx, q, pq.Array(live), limit)
+		if err != nil { return most, err }
+		n, err := res.RowsAffected()
+		if err != nil { return most, err }
+		most = max(most, n)
+	}
+	return most, nil
+}
+
+func (s *Postgres) PruneVoters(ctx context.Context, kind string, idle time.Duration, limit int) (int64, error) {
+	res, err := s.querier(ctx).ExecContext(ctx, fmt.Sprintf(`
+		DELETE FROM voters WHERE kind = $1 AND last_vote_at < now() - interval '%d seconds' ORDER BY last_vote_at LIMIT $2
+	`, int64(idle/time.Second)), kind, limit)
+	if err != nil { return 0, err }
+	return res.RowsAffected()
+}
@@ -0,0 +1,71 @@
+package views
+
+// Structured data: a profile's page describes its exhibit as schema.org JSON-LD
+// (https://schema.org/Person) for search engines' rich results. html/template writes a value
+// inside <script type="application/ld+json"> as JSON escaped for the script element, so these
+// types only need their JSON shape; build them with ProfileLD.
+
+const schemaOrg = "https://schema.org"
+
+// PersonLD is a schema.org Person.
+type PersonLD struct {
+	Context         string    `json:"@context"`
+	Type            string    `json:"@type"`
+	URL             string    `json:"url"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description,omitempty"`
+	HomeLocation    *PlaceLD  `json:"homeLocation,omitempty"`
+	Image           *ImageLD  `json:"image,omitempty"`
+	AggregateRating *RatingLD `json:"aggregateRating,omitempty"`
+}
+
+// PlaceLD is a schema.org Place given by its address.
+type PlaceLD struct {
+	Type    string          `json:"@type"`
+	Address PostalAddressLD `json:"address"`
+}
+
+// PostalAddressLD is a schema.org PostalAddress, down to the city.
+type PostalAddressLD struct {
+	Type     string `json:"@type"`
+	Locality string `json:"addressLocality,omitempty"`
+	Country  string `json:"addressCountry,omitempty"`
+}
+
+// ImageLD is a schema.org ImageObject.
+type ImageLD struct {
+	Type         string `json:"@type"`
+	ContentURL   string `json:"contentUrl"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"`
+	Caption      string `json:"caption,omitempty"`
+}
+
+// RatingLD is a schema.org AggregateRating.
+type RatingLD struct {
+	Type        string `json:"@type"`
+	RatingValue int    `json:"ratingValue"`
+	BestRating  int    `json:"bestRating"`
+	WorstRating int    `json:"worstRating"`
+	RatingCount int    `json:"ratingCount"`
+}
+
+// ProfileImage is the photo ProfileLD describes: absolute URLs of the full size and thumb.
+type ProfileImage struct {
+	URL, ThumbnailURL string
+}
+
+// ProfileLD builds the structured data of p's page, at the absolute URL pageURL. A nil image
+// leaves the photo out (hidden, or only reachable by expiring URLs). Votes become an aggregate
+// rating in which each vote is a top rating, there being no other kind; a profile without
+// votes has none, since a rating needs at least one.
+func ProfileLD(p ProfileView, pageURL string, image *ProfileImage) PersonLD {
+	ld := PersonLD{Context: schemaOrg, Type: "Person", URL: pageURL, Name: p.FullName, Description: p.Description}
+	if p.City != "" || p.Country != "" {
+		ld.HomeLocation = &PlaceLD{Type: "Place", Address: PostalAddressLD{Type: "PostalAddress", Locality: p.City, Country: p.Country}}
+	}
+	if image != nil {
+		ld.Image = &ImageLD{Type: "ImageObject", ContentURL: image.URL, ThumbnailURL: image.ThumbnailURL, Caption: p.Alt()}
+	}
+	if p.Votes > 0 { ld.AggregateRating = &RatingLD{Type: "AggregateRating", RatingValue: 5, BestRating: 5, WorstRating: 1, RatingCount: p.Votes} }
+	return ld
+}
@@ -0,0 +1,491 @@
+// Package views defines the data each HTML template in cmd/app/templates renders. Handlers
+// build these structs instead of passing ad-hoc values, so a template that refers to a field
+// the handler doesn't provide fails in tests rather than on a live request.
+package views
+
+import "time"
+
+// HomeHead is the home page shell, rendered and flushed before the cards ("home_head").
+type HomeHead struct {
+	Query       string
+	Country     string
+	Alumni      bool       // the retired profiles section rather than the leaderboard
+	Single      bool       // one profile's page (/profiles/{id})
+	ReadOnly    bool       // show the maintenance banner
+	HTMXURL     string     // htmx script; when set, search and votes update the page in place
+	TranslateTo string     // viewer's language when description translation is on; cards then offer it
+	Spotlight   *Spotlight // exhibit of the day, shown on the unfiltered leaderboard
+	Person      *PersonLD  // structured data of the profile a Single page shows; see structured.go
+	More        *PageLinks // the leaderboard's next page; nil on the last
+}
+
+// PageLinks lead to the next page of a listing: the page itself, and the leaderboard fragment
+// whose cards htmx appends in place of the "Load more" link ("load_more").
+type PageLinks struct {
+	Page     string
+	Fragment string
+}
+
+// ProfileView is one card on the home page ("home_card").
+type ProfileView struct {
+	ID          string
+	FullName    string
+	Country     string
+	City        string
+	Description string
+	Votes       int
+	CreatedAt   time.Time
+	EditedAt    *time.Time // last name or description edit; nil when never edited
+	RateLimited bool // took the most votes an exhibit takes per cooldown; the vote button is disabled
+	Voted       bool // the viewer voted for it within the cooldown; the vote button is disabled
+	PhotoTaken  *time.Time // month the photo was taken; set on the profile's own page only
+	Champion    bool
+	Pinned      bool
+	Trend       []int // votes per day over the last week, oldest first; drawn with sparkline
+	TranslateTo string // offer a translation of Description into this language; empty hides the link
+	VoteToken   string // one-time token of the vote form; a reused token is a resubmission
+	Highlight   string // search query marked in the name and description (which shrinks to a snippet)
+	RankDelta   int    // places gained (▲) or lost (▼) since the day's rank snapshot; 0 shows no badge
+	Slug        string // its page is /p/{Slug}; empty until it has one, and the name links nowhere
+
+	PhotoColor    string // shown behind the photo until it loads, with the BlurHash preview
+	PhotoBlurHash string
+	PhotoAlt      string // the submitter's description of the photo; see Alt
+
+	Retired       bool   // alumni card: no vote button, final standing instead
+	FinalRank     int    // overall rank when retired
+	FinalChampion string // country it was champion of when retired
+}
+
+// Alt is the photo's alt text: the submitter's description, or for profiles from before
+// submitters were asked for one, "Photo of" the name.
+func (p ProfileView) Alt() string {
+	if p.PhotoAlt != "" { return p.PhotoAlt }
+	return "Photo of " + p.FullName
+}
+
+// DescriptionView is a card's description, possibly machine-translated ("description").
+// It replaces the description element of the card it came from.
+type DescriptionView struct {
+	ProfileID  string
+	Text       string // translated text, or Original when not translated
+	Original   string
+	Source     string // language the provider detected
+	Target     string
+	Translated bool   // false when the description already was in Target
+	Error      string
+}
+
+// HomeTail closes the home page ("home_tail") or the leaderboard fragment ("leaderboard_tail").
+// The vote range is only known once every card was written, and scales the cards through CSS
+// variables.
+type HomeTail struct {
+	Count    int
+	MinVotes int
+	MaxVotes int
+	Alumni   bool
+	More     *PageLinks // the next page; nil on the last
+}
+
+// HomeSection opens a block of cards on the home page other than the leaderboard
+// ("section_open"); its cards follow as "home_card" and "section_close" ends it. The vote
+// range is known up front since a section's cards are loaded before it is written.
+type HomeSection struct {
+	ID       string // element id, s-<position>
+	Kind     string // top, trending, newest, random or country
+	Title    string
+	MinVotes int
+	MaxVotes int
+}
+
+// AddView is the profile submission form ("add.gohtml").
+type AddView struct {
+	ReadOnly bool
+	Closed   bool // submissions are switched off (the submissions_open setting)
+	Held     bool // the submission was saved but waits for review
+	// Warnings are problems found with the submitted photo. Nothing was saved: the form is
+	// shown again, filled in with Form, to pick another photo or keep this one.
+	Warnings []PhotoWarning
+	// Duplicate is set when the name is taken in the city (the name_uniqueness setting).
+	// Nothing was saved either; the form is shown again with the existing profiles.
+	Duplicate *DuplicateName
+	Form      AddForm
+	Captcha   *Captcha // the visitor must solve a CAPTCHA to submit
+}
+
+// DuplicateName lists the profiles a submission's name clashes with.
+type DuplicateName struct {
+	Existing []Duplicate // the public ones
+	Enforced bool        // the submission can't be kept; otherwise ticking name_ok adds it
+}
+
+// Duplicate is an existing profile with a submitted name.
+type Duplicate struct {
+	URL      string
+	FullName string
+	Country  string
+	City     string
+}
+
+// AddForm is what was entered on the add form.
+type AddForm struct {
+	FullName      string
+	Country       string
+	City          string
+	Description   string
+	PhotoAlt      string
+	ShowPhotoDate bool
+	NameOK        bool // the submitter already confirmed a duplicate name
+}
+
+// PhotoWarning is one of the image pipeline's quality warnings (imaging.Warning).
+type PhotoWarning struct {
+	Code    string
+	Message string
+}
+
+// Spotlight is one day's exhibit of the day.
+type Spotlight struct {
+	Day      time.Time // UTC date
+	Views    int64     // photo views over the 30 days before the choice
+	ChosenAt time.Time
+	Profile  ProfileView // ID, FullName, Country, City, Votes and Retired are set
+}
+
+// SpotlightsView is the spotlight history ("spotlights.gohtml").
+type SpotlightsView struct {
+	Spotlights []Spotlight
+	Paged      bool   // an older page, reached with ?before=
+	Next       string // before= of the next page; empty on the last
+}
+
+// SearchTimeoutView is the page shown when a listing query took too long ("search_timeout.gohtml").
+type SearchTimeoutView struct {
+	Query   string
+	Country string
+}
+
+// QuotaView is the page shown when a visitor has used up today's profile creations ("quota.gohtml").
+type QuotaView struct {
+	Limit    int
+	ResetsAt time.Time
+}
+
+// AdminResetView is the vote reset form with its preview or outcome ("admin_reset.gohtml").
+type AdminResetView struct {
+	Form   AdminResetForm
+	Result *AdminResetResult // nil until the form was submitted
+	Error  string
+}
+
+type AdminResetForm struct {
+	From   time.Time
+	To     time.Time
+	Reason string
+}
+
+type AdminResetResult struct {
+	ID       string
+	From     time.Time
+	To       time.Time
+	Votes    int
+	Profiles int
+	Applied  bool
+}
+
+// VoteLinkView is the page behind an emailed vote link ("vote_link.gohtml"). State is
+// "confirm" (valid, not yet used), "done" (vote recorded) or "error" (Message says why).
+type VoteLinkView struct {
+	Token    string
+	FullName string
+	Country  string
+	City     string
+	Expires  time.Time
+	State    string
+	Message  string
+}
+
+// VoteConfirmView is the non-JavaScript vote page ("vote_confirm.gohtml"). Flash is the
+// outcome of the vote just submitted, nil on a fresh visit.
+type VoteConfirmView struct {
+	Profile  ProfileView
+	CSRF     string
+	Flash    *Flash
+	ReadOnly bool
+	Captcha  *Captcha // the visitor must solve a CAPTCHA to vote
+}
+
+// KioskView is one screen of a vote kiosk ("kiosk.gohtml"): Profile with its vote button,
+// until the screen moves on to Next after Advance seconds. Profile is nil when there are no
+// exhibits; Error replaces everything when the screen is not a running kiosk.
+type KioskView struct {
+	Label    string // the kiosk session's, for the admins who set it up
+	Profile  *ProfileView
+	N        int    // Profile's place in the cycle, posted back with a vote
+	Next     string // the next screen
+	Advance  int
+	Flash    *Flash // the outcome of the vote just cast
+	ReadOnly bool
+	Error    string
+}
+
+// VoteReceiptView is the page after a vote ("vote_receipt.gohtml"). Rank is the profile's place
+// among Total active profiles; 0 for a retired profile, which has no rank or share links.
+type VoteReceiptView struct {
+	Profile   ProfileView
+	Rank      int
+	Total     int
+	ShareURL  string // the profile's page, absolute
+	ShareText string
+	Shares    []ShareLink
+}
+
+// ProfilePageView is a profile's own page, /p/{slug} ("profile.gohtml"). URL and ImageURL are
+// absolute, for the Open Graph tags; ImageURL is empty when the photo is hidden.
+type ProfilePageView struct {
+	Profile  ProfileView
+	URL      string
+	ImageURL string
+	History  []int // votes per UTC day, oldest first; drawn with sparkline
+	Person   *PersonLD
+}
+
+// ShareLink is a share button: a social network's share URL prefilled with the receipt.
+type ShareLink struct {
+	Name string
+	URL  string
+}
+
+// Captcha is a CAPTCHA widget: the provider's script, and the element it turns into the widget.
+type Captcha struct {
+	SiteKey string
+	Script  string
+	Class   string
+}
+
+// Flash is a one-time message shown after a redirect; Error styles it as a failure.
+type Flash struct {
+	Message string
+	Error   bool
+}
+
+// TakedownView is the public takedown form ("takedown.gohtml"). Reference is set once a
+// request was filed; FullName names the exhibit when the form came from its link.
+type TakedownView struct {
+	Form      TakedownForm
+	FullName  string
+	Reasons   []string
+	CSRF      string
+	Reference string
+	Error     string
+	ReadOnly  bool
+}
+
+// TakedownForm is what a requester submits; Profile may be any link containing the id.
+type TakedownForm struct {
+	Profile string
+	Reason  string
+	Details string
+	Contact string
+}
+
+// AdminTakedownsView is the takedown review page ("admin_takedowns.gohtml").
+type AdminTakedownsView struct {
+	Open     []Takedown
+	Resolved []Takedown // most recently resolved first
+	Notice   string
+	Error    string
+}
+
+// Takedown is one takedown request.
+type Takedown struct {
+	ID         string
+	ProfileID  string
+	FullName   string
+	Reason     string
+	Details    string
+	Contact    string
+	Status     string // open, upheld or rejected
+	CreatedAt  time.Time
+	ResolvedAt time.Time
+	ResolvedBy string
+	Note       string
+}
+
+// SiteCopy is the admin-editable text around every page, available to all templates through
+// the site func. Empty Tagline and Welcome are not shown.
+type SiteCopy struct {
+	Title   string `json:"title"`
+	Tagline string `json:"tagline"`
+	Welcome string `json:"welcome"` // blurb above the unfiltered leaderboard
+	Footer  string `json:"footer"`
+}
+
+// AdminModerationView is the moderation page ("admin_moderation.gohtml"): rules, the profiles
+// held for review and recent matches. Form keeps a rejected rule for correction.
+type AdminModerationView struct {
+	Rules   []ModerationRule
+	Held    []ProfileView
+	Matches []ModerationMatch
+	Form    ModerationRule
+	Notice  string
+	Error   string
+}
+
+// ModerationDigestView is the admins' email about profiles waiting for review
+// ("moderation_digest.gohtml"). Its URLs are absolute, as mail clients have no page to resolve
+// them against.
+type ModerationDigestView struct {
+	Pending  int // profiles waiting; Profiles lists the newest of them
+	Profiles []DigestProfile
+	More     int    // waiting but not listed
+	QueueURL string // the moderation page
+}
+
+// DigestProfile is one held profile in the digest, with its one-click review links.
+type DigestProfile struct {
+	Profile    ProfileView
+	PhotoURL   string
+	ApproveURL string
+	RejectURL  string
+}
+
+// ModerationRule is a keyword (Kind "word") or regex rule and what a match does
+// (Action "reject", "hold" or "redact").
+type ModerationRule struct {
+	ID        string
+	Kind      string
+	Pattern   string
+	Action    string
+	Note      string
+	CreatedAt time.Time
+	CreatedBy string
+}
+
+// ModerationMatch is an audit entry: a rule that matched a submitted field.
+type ModerationMatch struct {
+	Pattern   string
+	Action    string
+	Field     string
+	Value     string
+	ProfileID string // empty when the submission was rejected
+	CreatedAt time.Time
+}
+
+// AdminSettingsView is the settings editor ("admin_settings.gohtml").
+type AdminSettingsView struct {
+	Settings []Setting
+	Notice   string
+	Error    string
+}
+
+// Setting is one runtime setting with its current value, as the editor and the admin API
+// show it.
+type Setting struct {
+	Key       string    `json:"key"`
+	Type      string    `json:"type"` // int, bool, duration or choice
+	Value     string    `json:"value"`
+	Default   string    `json:"default"`
+	Choices   []string  `json:"choices,omitempty"` // a choice setting's values
+	Doc       string    `json:"doc"`
+	Custom    bool      `json:"custom"` // changed by an admin; otherwise Value is the default
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+// AdminLayoutView is the home page layout editor ("admin_layout.gohtml"). Rows has the
+// current layout followed by blank rows to add sections with.
+type AdminLayoutView struct {
+	Rows   []LayoutRow
+	Kinds    []LayoutKind
+	Notice   string
+	Error    string
+}
+
+// LayoutSection is one section of the home page layout, as the editor and the admin API
+// show it. Size 0 means the kind's default; the leaderboard ignores it (see page_size).
+type LayoutSection struct {
+	Kind    string `json:"kind"`
+	Title   string `json:"title,omitempty"`
+	Size    int    `json:"size,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// LayoutRow is a row of the layout editor.
+type LayoutRow struct {
+	Position int
+	Section  LayoutSection
+}
+
+// LayoutKind describes a section kind in the editor.
+type LayoutKind struct {
+	Name        string
+	Description string
+}
+
+// AdminSiteView is the site copy editor ("admin_site.gohtml").
+type AdminSiteView struct {
+	Copy  SiteCopy
+	Saved bool
+	Error string
+}
+
+// AdminPhotoTrafficView is the photo traffic page ("admin_photos.gohtml").
+type AdminPhotoTrafficView struct {
+	Days       int
+	Rows       []PhotoTraffic // most bytes first
+	Total      PhotoTraffic   // all profiles, not only Rows
+	Protection bool           // hotlink protection is on
+	Referers   []string       // other hosts allowed under hotlink protection
+	Embeds     bool           // embed URLs can be issued
+}
+
+// PhotoTraffic is one profile's photo requests and bytes served over the page's days.
+type PhotoTraffic struct {
+	ProfileID   string
+	FullName    string
+	Requests    int64
+	NotModified int64
+	Bytes       int64
+	Blocked     int64 // hotlinked requests refused
+}
+
+// AdminVoteReferrersView is the vote referrers page ("admin_referrers.gohtml").
+type AdminVoteReferrersView struct {
+	Days      int
+	Total     int64          // all votes attributed over Days
+	Sources   []VoteReferrer // Source and Votes; "" is direct or unknown
+	Campaigns []VoteReferrer // Campaign and Votes
+	Profiles  []VoteReferrer // every field
+}
+
+// VoteReferrer is the votes of one source, campaign or profile over the page's days.
+type VoteReferrer struct {
+	Source    string
+	Campaign  string
+	ProfileID string
+	FullName  string
+	Votes     int64
+}
+
+// AdminProfileEditView is the profile edit page ("admin_profile.gohtml").
+type AdminProfileEditView struct {
+	Profile   ProfileView // FullName and Description fill the form
+	Revisions []Revision  // newest first
+	Notice    string
+	Error     string
+
+	PhotoTaken       *time.Time // month the photo was taken; nil when not known
+	PhotoTakenHidden bool       // the month is hidden from the profile's page
+}
+
+// Revision is one recorded change of a profile field.
+type Revision struct {
+	ID        string
+	Field     string // "full_name" or "description"
+	Previous  string
+	Value     string
+	EditedBy  string
+	Reverts   string // id of the revision this one undid, if any
+	CreatedAt time.Time
+}
@@ -0,0 +1,23 @@
+-- 003_vote_resets.sql
+-- Archive table for votes removed by admin resets, plus an audit trail of resets
+CREATE TABLE IF NOT EXISTS vote_resets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    window_start TIMESTAMPTZ NOT NULL,
+    window_end TIMESTAMPTZ NOT NULL,
+    reason STRING NOT NULL DEFAULT '',
+    requested_by STRING NOT NULL DEFAULT '',
+    votes_archived INT NOT NULL DEFAULT 0,
+    profiles_affected INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS votes_archive (
+    id UUID PRIMARY KEY,
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL,
+    reset_id UUID NOT NULL REFERENCES vote_resets(id),
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_votes_archive_reset ON votes_archive (reset_id);
+CREATE INDEX IF NOT EXISTS idx_votes_recent_created ON votes_recent (created_at);
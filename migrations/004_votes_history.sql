@@ -0,0 +1,16 @@
+-- 004_votes_history.sql
+-- Long-term vote history. A background job moves votes_recent rows older than the
+-- 60-minute cooldown here in small batches, keeping votes_recent (and the cooldown
+-- check on it) limited to the live window.
+-- Note: a partial index "WHERE created_at > now() - interval '60 minutes'" is not
+-- possible (index predicates must be immutable); with old rows moved out continuously,
+-- idx_votes_recent_created from 003 stays small and serves the retention scan.
+CREATE TABLE IF NOT EXISTS votes_history (
+    id UUID PRIMARY KEY,
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL,
+    moved_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_votes_history_profile_created ON votes_history (profile_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_votes_history_created ON votes_history (created_at);
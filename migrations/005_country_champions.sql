@@ -0,0 +1,12 @@
+-- 005_country_champions.sql
+-- Current top profile per country (case-insensitive), maintained by a periodic job in cmd/app
+CREATE TABLE IF NOT EXISTS country_champions (
+    country STRING PRIMARY KEY,
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    votes INT NOT NULL,
+    awarded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_country_champions_profile ON country_champions (profile_id);
+CREATE INDEX IF NOT EXISTS idx_profiles_country_sort ON profiles (lower(location_country), votes_count DESC, created_at DESC);
@@ -0,0 +1,9 @@
+-- 006_profile_pins.sql
+-- Editorially pinned profiles, shown first on the home page in position order
+CREATE TABLE IF NOT EXISTS profile_pins (
+    profile_id UUID PRIMARY KEY REFERENCES profiles(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    pinned_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_profile_pins_position ON profile_pins (position);
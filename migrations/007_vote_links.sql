@@ -0,0 +1,12 @@
+-- 007_vote_links.sql
+-- Redeemed signed vote links (emailed per recipient). The nonce makes each link single-use;
+-- rows can go once the link has expired since the signature check rejects it from then on.
+CREATE TABLE IF NOT EXISTS vote_link_uses (
+    nonce STRING PRIMARY KEY,
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    recipient STRING NOT NULL,          -- keyed hash of the recipient address, not the address
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_vote_link_uses_expires ON vote_link_uses (expires_at);
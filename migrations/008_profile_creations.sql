@@ -0,0 +1,11 @@
+-- 008_profile_creations.sql
+-- Per-visitor daily counters for the profile creation throttle. visitor is a hash of the
+-- client IP; day is the UTC date. Rows older than a couple of days are pruned.
+CREATE TABLE IF NOT EXISTS profile_creations (
+    visitor STRING NOT NULL,
+    day DATE NOT NULL,
+    count INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (visitor, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_profile_creations_day ON profile_creations (day);
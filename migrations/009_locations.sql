@@ -0,0 +1,45 @@
+-- migrate: no-transaction
+-- 009_locations.sql
+-- Normalized countries and cities. profiles.city_id points at the city; the text columns
+-- location_country/location_city stay as the searchable copy (search_text is computed from
+-- them) and are rewritten when cities are merged. Schema changes and the backfill can't share
+-- a transaction in CockroachDB, hence no-transaction: each statement is tracked separately.
+CREATE TABLE IF NOT EXISTS countries (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name STRING NOT NULL,
+    name_key STRING AS (lower(name)) STORED,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (name_key)
+);
+
+CREATE TABLE IF NOT EXISTS cities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    country_id UUID NOT NULL REFERENCES countries(id),
+    name STRING NOT NULL,
+    name_key STRING AS (lower(name)) STORED,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (country_id, name_key)
+);
+
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS city_id UUID REFERENCES cities(id);
+
+CREATE INDEX IF NOT EXISTS idx_profiles_city ON profiles (city_id);
+
+-- Backfill: the earliest spelling of each case-insensitive name wins.
+INSERT INTO countries (name)
+SELECT DISTINCT ON (lower(trim(location_country))) trim(location_country)
+FROM profiles
+ORDER BY lower(trim(location_country)), created_at
+ON CONFLICT (name_key) DO NOTHING;
+
+INSERT INTO cities (country_id, name)
+SELECT DISTINCT ON (co.id, lower(trim(p.location_city))) co.id, trim(p.location_city)
+FROM profiles p JOIN countries co ON co.name_key = lower(trim(p.location_country))
+ORDER BY co.id, lower(trim(p.location_city)), p.created_at
+ON CONFLICT (country_id, name_key) DO NOTHING;
+
+UPDATE profiles p SET city_id = ci.id
+FROM countries co, cities ci
+WHERE p.city_id IS NULL
+  AND co.name_key = lower(trim(p.location_country))
+  AND ci.country_id = co.id AND ci.name_key = lower(trim(p.location_city));
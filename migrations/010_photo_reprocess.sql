@@ -0,0 +1,14 @@
+-- 010_photo_reprocess.sql
+-- Checkpoints for cmd/reprocess. One row per run (named after the pipeline parameters by
+-- default); last_id is the highest profile id whose batch has finished, so a rerun of the
+-- same run resumes after it.
+CREATE TABLE IF NOT EXISTS photo_reprocess_runs (
+    run STRING PRIMARY KEY,
+    last_id UUID,
+    processed INT NOT NULL DEFAULT 0,
+    rewritten INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
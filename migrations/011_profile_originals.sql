@@ -0,0 +1,12 @@
+-- 011_profile_originals.sql
+-- Original uploads, kept so photos can be re-derived losslessly (cmd/reprocess). Never
+-- served; rows go with their profile and are pruned after LEADERBOARD_ORIGINALS_RETENTION.
+CREATE TABLE IF NOT EXISTS profile_originals (
+    profile_id UUID PRIMARY KEY REFERENCES profiles(id) ON DELETE CASCADE,
+    data BYTES NOT NULL,
+    content_type STRING NOT NULL,
+    size INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_profile_originals_created ON profile_originals (created_at);
@@ -0,0 +1,8 @@
+-- 012_vote_alerts.sql
+-- Last time each vote velocity alert fired, keyed by scope ("global" or "profile:<id>").
+-- The alert job claims a row with a conditional upsert, so replicas share one cool-off.
+CREATE TABLE IF NOT EXISTS vote_alerts (
+    key STRING PRIMARY KEY,
+    fired_at TIMESTAMPTZ NOT NULL,
+    votes INT NOT NULL
+);
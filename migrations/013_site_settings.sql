@@ -0,0 +1,9 @@
+-- 013_site_settings.sql
+-- Admin-editable site copy (title, tagline, welcome blurb, footer). Missing keys fall back to
+-- the defaults compiled into the app.
+CREATE TABLE IF NOT EXISTS site_settings (
+    key STRING PRIMARY KEY,
+    value STRING NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_by STRING NOT NULL DEFAULT ''
+);
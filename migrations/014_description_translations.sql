@@ -0,0 +1,14 @@
+-- 014_description_translations.sql
+-- Cached machine translations of profile descriptions, one per profile and target language.
+-- source_hash is the SHA-256 of the description that was translated, so an edited
+-- description misses the cache. source_lang is what the provider detected; the listing uses
+-- it to skip the translate link for viewers who already read that language.
+CREATE TABLE IF NOT EXISTS description_translations (
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    target STRING NOT NULL,
+    source_hash BYTES NOT NULL,
+    source_lang STRING NOT NULL,
+    text STRING NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (profile_id, target)
+);
@@ -0,0 +1,7 @@
+-- migrate: no-transaction
+-- 015_votes_counted.sql
+-- Buffered votes are inserted with counted = false and folded into profiles.votes_count by
+-- the vote flusher, which flips them to true in the same transaction. votes_recent stays the
+-- source of truth: whatever a crashed instance had not flushed is picked up by the next flush.
+ALTER TABLE votes_recent ADD COLUMN IF NOT EXISTS counted BOOL NOT NULL DEFAULT true;
+CREATE INDEX IF NOT EXISTS idx_votes_recent_uncounted ON votes_recent (profile_id) WHERE NOT counted;
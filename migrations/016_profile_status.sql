@@ -0,0 +1,9 @@
+-- migrate: no-transaction
+-- 016_profile_status.sql
+-- Retired profiles stop taking votes and leave the active leaderboards for the alumni
+-- section. final_rank and final_champion freeze the standing they had when retired.
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS status STRING NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired'));
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS retired_at TIMESTAMPTZ;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS final_rank INT;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS final_champion STRING;
+CREATE INDEX IF NOT EXISTS idx_profiles_status_sort ON profiles (status, votes_count DESC, created_at DESC);
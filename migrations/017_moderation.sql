@@ -0,0 +1,29 @@
+-- migrate: no-transaction
+-- 017_moderation.sql
+-- Keyword and regex rules checked against full_name and description when a profile is
+-- created, and every match they made, for audit. A "hold" rule parks the profile in the new
+-- 'held' status until an admin approves or discards it. The status CHECK from 016 is
+-- replaced (CockroachDB names a column CHECK check_<column>).
+CREATE TABLE IF NOT EXISTS moderation_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind STRING NOT NULL CHECK (kind IN ('word', 'regex')),
+    pattern STRING NOT NULL,
+    action STRING NOT NULL CHECK (action IN ('reject', 'hold', 'redact')),
+    note STRING NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_by STRING NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS moderation_matches (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    rule_id UUID REFERENCES moderation_rules(id) ON DELETE SET NULL,
+    pattern STRING NOT NULL,
+    action STRING NOT NULL,
+    field STRING NOT NULL,
+    value STRING NOT NULL,
+    profile_id UUID REFERENCES profiles(id) ON DELETE SET NULL,
+    visitor STRING NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_moderation_matches_created ON moderation_matches (created_at DESC);
+ALTER TABLE profiles DROP CONSTRAINT IF EXISTS check_status;
+ALTER TABLE profiles ADD CONSTRAINT check_profile_status CHECK (status IN ('active', 'retired', 'held'));
@@ -0,0 +1,22 @@
+-- migrate: no-transaction
+-- 018_takedowns.sql
+-- Takedown requests filed through /takedown against a profile's photo. Filing one hides the
+-- photo at once (profiles.photo_hidden); an admin then upholds the request, keeping it
+-- hidden, or rejects it, showing the photo again unless another request is still open.
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS photo_hidden BOOL NOT NULL DEFAULT false;
+CREATE TABLE IF NOT EXISTS takedown_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    reason STRING NOT NULL CHECK (reason IN ('copyright', 'privacy', 'abuse', 'other')),
+    details STRING NOT NULL,
+    contact STRING NOT NULL,
+    visitor STRING NOT NULL,
+    status STRING NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'upheld', 'rejected')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMPTZ,
+    resolved_by STRING NOT NULL DEFAULT '',
+    resolution_note STRING NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_takedown_requests_status_created ON takedown_requests (status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_takedown_requests_visitor_created ON takedown_requests (visitor, created_at);
+CREATE INDEX IF NOT EXISTS idx_takedown_requests_profile ON takedown_requests (profile_id) WHERE status = 'open';
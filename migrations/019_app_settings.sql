@@ -0,0 +1,11 @@
+-- 019_app_settings.sql
+-- Typed operational settings changed by admins at runtime (vote cooldown, page size, feature
+-- toggles). The app declares every setting with its type and default; a row exists only
+-- once an admin changed it, and deleting it restores the default.
+CREATE TABLE IF NOT EXISTS app_settings (
+    key STRING PRIMARY KEY,
+    type STRING NOT NULL CHECK (type IN ('int', 'bool', 'duration')),
+    value STRING NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_by STRING NOT NULL DEFAULT ''
+);
@@ -0,0 +1,16 @@
+-- 020_vote_imports.sql
+-- Batches of historical votes imported from other systems. The client picks the batch id;
+-- a batch is applied once, and sending the same id again returns the recorded result (or a
+-- conflict when the payload differs, by its SHA-256). Imported votes land in votes_history
+-- like archived live votes, so counts, trends and reconcile treat them the same.
+CREATE TABLE IF NOT EXISTS vote_imports (
+    batch_id STRING PRIMARY KEY,
+    source STRING NOT NULL DEFAULT '',
+    payload_sha256 STRING NOT NULL,
+    votes INT NOT NULL,
+    profiles INT NOT NULL,
+    oldest TIMESTAMPTZ NOT NULL,
+    newest TIMESTAMPTZ NOT NULL,
+    requested_by STRING NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,13 @@
+-- 021_home_sections.sql
+-- The home page layout admins compose from sections (the leaderboard, top N, trending, newest,
+-- a random spotlight, per-country blocks), in position order. Without rows the home page is
+-- the leaderboard alone, as before.
+CREATE TABLE IF NOT EXISTS home_sections (
+    position INT PRIMARY KEY,
+    kind STRING NOT NULL CHECK (kind IN ('leaderboard', 'top', 'trending', 'newest', 'random', 'country')),
+    title STRING NOT NULL DEFAULT '',
+    size INT NOT NULL DEFAULT 0,
+    country STRING NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_by STRING NOT NULL DEFAULT ''
+);
@@ -0,0 +1,13 @@
+-- 022_photo_traffic.sql
+-- Photo requests and bytes served per profile and UTC day, for the admin photo traffic page.
+-- Instances count in memory and add their counts here every minute; blocked counts hotlinked
+-- requests refused by the photo hotlink protection setting.
+CREATE TABLE IF NOT EXISTS photo_traffic (
+    day DATE NOT NULL,
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    requests INT8 NOT NULL DEFAULT 0,
+    not_modified INT8 NOT NULL DEFAULT 0,
+    bytes INT8 NOT NULL DEFAULT 0,
+    blocked INT8 NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, profile_id)
+);
@@ -0,0 +1,15 @@
+-- 023_quarantined_votes.sql
+-- Votes from sources IP reputation rates high-risk. They are kept here instead of counted,
+-- until an admin releases them (they are then counted like a new vote) or discards them.
+CREATE TABLE IF NOT EXISTS quarantined_votes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    visitor STRING NOT NULL,
+    score INT NOT NULL,
+    source STRING NOT NULL,
+    status STRING NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'released', 'discarded')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMPTZ,
+    resolved_by STRING NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_quarantined_votes_status_created ON quarantined_votes (status, created_at DESC);
@@ -0,0 +1,17 @@
+-- migrate: no-transaction
+-- 024_profile_revisions.sql
+-- Edit history of profile names and descriptions: each admin edit (or revert) records the
+-- field's previous and new value, in the transaction that updates the profile. edited_at is
+-- the last such edit, shown publicly as "edited ... ago"; NULL for profiles never edited.
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS edited_at TIMESTAMPTZ;
+CREATE TABLE IF NOT EXISTS profile_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    field STRING NOT NULL CHECK (field IN ('full_name', 'description')),
+    previous STRING NOT NULL,
+    value STRING NOT NULL,
+    edited_by STRING NOT NULL,
+    reverts UUID REFERENCES profile_revisions(id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_profile_revisions_profile_created ON profile_revisions (profile_id, created_at DESC);
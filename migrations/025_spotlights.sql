@@ -0,0 +1,12 @@
+-- 025_spotlights.sql
+-- The exhibit of the day: one profile per UTC day, chosen by weighted random (profiles with
+-- fewer photo views in the last 30 days are likelier) by whichever instance gets there first.
+-- The primary key makes the choice once for all replicas; past rows are the /spotlights history.
+CREATE TABLE IF NOT EXISTS spotlights (
+    day DATE PRIMARY KEY,
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    views INT8 NOT NULL DEFAULT 0,
+    chosen_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_spotlights_profile ON spotlights (profile_id);
@@ -0,0 +1,12 @@
+-- 026_vote_referrers.sql
+-- Votes per profile, referrer and campaign per UTC day, for the admin referrers page. Only the
+-- referring site's domain (or utm_source) and utm_campaign are kept, never full URLs; "" is a
+-- vote with neither. Instances count in memory and add their counts here every minute.
+CREATE TABLE IF NOT EXISTS vote_referrers (
+    day DATE NOT NULL,
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    source STRING NOT NULL,
+    campaign STRING NOT NULL,
+    votes INT8 NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, profile_id, source, campaign)
+);
@@ -0,0 +1,10 @@
+-- 027_photo_placeholders.sql
+-- What cards show while a photo loads: its average colour and a BlurHash (https://blurha.sh),
+-- read for a whole page in one query. Written on upload and by the photo_placeholders job for
+-- photos without one; cmd/reprocess drops the row of a photo it rewrites so the job redoes it.
+CREATE TABLE IF NOT EXISTS photo_placeholders (
+    profile_id UUID PRIMARY KEY REFERENCES profiles(id) ON DELETE CASCADE,
+    color STRING NOT NULL,
+    blurhash STRING NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,10 @@
+-- 028_rank_snapshots.sql
+-- Each active profile's leaderboard rank at the start of a UTC day, written by whichever
+-- instance's rank_snapshots job gets there first. Cards compare current ranks with the newest
+-- snapshot for their ▲/▼ badges. Snapshots are kept 30 days.
+CREATE TABLE IF NOT EXISTS rank_snapshots (
+    day DATE NOT NULL,
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    rank INT NOT NULL,
+    PRIMARY KEY (day, profile_id)
+);
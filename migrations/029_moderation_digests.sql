@@ -0,0 +1,9 @@
+-- 029_moderation_digests.sql
+-- Moderation digests sent to admins, one per period (hour or UTC day, per
+-- LEADERBOARD_DIGEST_SCHEDULE). The instance whose insert wins the period sends it; a failed
+-- send deletes the row again so the next run retries.
+CREATE TABLE IF NOT EXISTS moderation_digests (
+    period TIMESTAMPTZ PRIMARY KEY,
+    profiles INT NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
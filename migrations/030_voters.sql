@@ -0,0 +1,16 @@
+-- 030_voters.sql
+-- Votes are limited per voter instead of per profile. A voter is a browser's voter cookie
+-- ("cookie.<uuid>") or, without one, a keyed fingerprint of the client IP and User-Agent
+-- ("<period>.<mac>", like visitor ids). votes_recent.voter says who cast each vote; it is ''
+-- for votes no voter cast (vote links, imports, released quarantined votes) and for votes
+-- from before this migration.
+CREATE TABLE IF NOT EXISTS voters (
+    id STRING PRIMARY KEY,
+    kind STRING NOT NULL CHECK (kind IN ('cookie', 'fingerprint')),
+    votes INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_vote_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_voters_kind_last_vote ON voters (kind, last_vote_at);
+ALTER TABLE votes_recent ADD COLUMN IF NOT EXISTS voter STRING NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_votes_recent_voter ON votes_recent (voter, created_at) WHERE voter != '';
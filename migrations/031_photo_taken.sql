@@ -0,0 +1,6 @@
+-- 031_photo_taken.sql
+-- The month a profile's photo was taken, read from its EXIF capture date when the submitter
+-- asked for it (stored photos carry no metadata). Only the month is kept, as its first day;
+-- photo_taken_hidden hides it from pages without forgetting it.
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS photo_taken DATE;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS photo_taken_hidden BOOL NOT NULL DEFAULT false;
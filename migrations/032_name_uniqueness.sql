@@ -0,0 +1,9 @@
+-- 032_name_uniqueness.sql
+-- Profiles submitted while the name_uniqueness setting is "enforce" are marked name_unique,
+-- and among those a full name may appear once per city, ignoring case and extra spaces.
+-- Older profiles and those submitted under allow or warn aren't indexed, so switching to
+-- enforce never trips over duplicates already on the board: the app checks submissions
+-- against every profile, and this index settles two racing ones.
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS name_unique BOOL NOT NULL DEFAULT false;
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_name_city_key
+    ON profiles (lower(regexp_replace(btrim(full_name), '\s+', ' ', 'g')), city_id) WHERE name_unique;
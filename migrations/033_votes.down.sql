@@ -0,0 +1,5 @@
+-- 033_votes.down.sql
+-- votes_recent and votes_history hold every vote, counted flags included, as long as the app
+-- dual-wrote them (LEADERBOARD_VOTES_DUAL_WRITE, on by default), so dropping votes loses
+-- nothing. Votes cast with dual writes off are lost.
+DROP TABLE IF EXISTS votes;
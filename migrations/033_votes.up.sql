@@ -0,0 +1,33 @@
+-- migrate: no-transaction
+-- requires: 015_votes_counted.sql, 030_voters.sql
+-- 033_votes.up.sql
+-- One table for every vote: votes replaces votes_recent (the live cooldown window) and
+-- votes_history (everything older), which the app moved rows between. The cooldown check is an
+-- index lookup on (profile_id, voter, created_at), so nothing has to be moved out of the way,
+-- and profiles.votes_count stays the maintained counter, fed by the vote flusher through
+-- counted as before. Both old tables are copied in; every statement is safe to rerun.
+-- Transition: the app keeps writing votes_recent (and moving it to votes_history) too while
+-- LEADERBOARD_VOTES_DUAL_WRITE is on, so rolling back this migration and the build loses no
+-- votes. A later migration drops them once that period is over.
+-- The copy runs before the rollout: votes that instances of the previous build cast or move
+-- afterwards land in the legacy tables only. The new build's vote flusher copies the uncounted
+-- ones as it counts them; once no instance of the previous build is left, run
+-- ./app copy-legacy-votes, which repeats the two INSERTs below in batches and can be rerun.
+CREATE TABLE IF NOT EXISTS votes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    voter STRING NOT NULL DEFAULT '',
+    counted BOOL NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_votes_cooldown ON votes (profile_id, voter, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_votes_profile_created ON votes (profile_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_votes_created ON votes (created_at);
+CREATE INDEX IF NOT EXISTS idx_votes_voter ON votes (voter, created_at) WHERE voter != '';
+CREATE INDEX IF NOT EXISTS idx_votes_uncounted ON votes (profile_id) WHERE NOT counted;
+INSERT INTO votes (id, profile_id, created_at)
+    SELECT id, profile_id, created_at FROM votes_history
+    ON CONFLICT (id) DO NOTHING;
+INSERT INTO votes (id, profile_id, voter, counted, created_at)
+    SELECT id, profile_id, voter, counted, created_at FROM votes_recent
+    ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,13 @@
+-- 034_photo_variants.sql
+-- Smaller renditions of each photo for pages that show it small (/profiles/{id}/photo?size=,
+-- see cmd/app/variants.go); the full size stays in profiles.photo_webp. Written on upload and by
+-- the photo_variants job for photos without them; cmd/reprocess drops the rows of a photo it
+-- rewrites so the job redoes them.
+CREATE TABLE IF NOT EXISTS photo_variants (
+    profile_id UUID NOT NULL REFERENCES profiles(id) ON DELETE CASCADE,
+    size STRING NOT NULL,
+    data BYTES NOT NULL,
+    content_type STRING NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (profile_id, size)
+);
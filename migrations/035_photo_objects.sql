@@ -0,0 +1,9 @@
+-- migrate: no-transaction
+-- 035_photo_objects.sql
+-- Photos kept in object storage (LEADERBOARD_BLOB_STORE, see internal/blob) leave photo_webp NULL:
+-- photo_key names the object and photo_size is its length, which photo responses send ahead of the
+-- bytes. Rows with photo_webp keep their photo in the database as before; `app move-photos` moves
+-- them out.
+ALTER TABLE profiles ALTER COLUMN photo_webp DROP NOT NULL;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS photo_key STRING;
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS photo_size INT8;
@@ -0,0 +1,7 @@
+-- migrate: no-transaction
+-- 036_profile_slugs.sql
+-- Profile pages at /p/{slug} (cmd/app/slugs.go): the name made URL-friendly plus the first eight
+-- hex digits of the id (profile.Slug). Set on insert and on a name edit; the slugs job fills in
+-- rows written before this migration.
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS slug STRING;
+CREATE UNIQUE INDEX IF NOT EXISTS profiles_slug_key ON profiles (slug);
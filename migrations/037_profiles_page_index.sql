@@ -0,0 +1,7 @@
+-- migrate: no-transaction
+-- 037_profiles_page_index.sql
+-- The home page pages through the leaderboard by keyset (store.Cursor): the row after
+-- (votes_count, created_at, id) in that order. With id in the index, each page is a seek
+-- whatever its depth; it replaces the status index without it.
+CREATE INDEX IF NOT EXISTS idx_profiles_status_page ON profiles (status, votes_count DESC, created_at DESC, id DESC);
+DROP INDEX IF EXISTS profiles@idx_profiles_status_sort;
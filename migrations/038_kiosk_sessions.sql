@@ -0,0 +1,15 @@
+-- migrate: no-transaction
+-- 038_kiosk_sessions.sql
+-- Vote kiosks (cmd/app/kiosk.go): a tablet at an event that an admin started a session on.
+-- Its votes are cast by the voter "kiosk.<session id>", a new kind of voter, so votes.voter
+-- ties each one to its session for auditing.
+CREATE TABLE IF NOT EXISTS kiosk_sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    label STRING NOT NULL,
+    created_by STRING NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    ended_at TIMESTAMPTZ
+);
+ALTER TABLE voters DROP CONSTRAINT IF EXISTS check_kind;
+ALTER TABLE voters ADD CONSTRAINT check_kind CHECK (kind IN ('cookie', 'fingerprint', 'kiosk'));
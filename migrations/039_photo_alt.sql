@@ -0,0 +1,5 @@
+-- 039_photo_alt.sql
+-- A description of each profile's photo for people who can't see it, written by the submitter
+-- and rendered as the photo's alt text. Required on new profiles; rows from before this
+-- migration keep '' and fall back to "Photo of <name>".
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS photo_alt STRING NOT NULL DEFAULT '';
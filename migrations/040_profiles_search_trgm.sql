@@ -0,0 +1,9 @@
+-- migrate: no-transaction
+-- 040_profiles_search_trgm.sql
+-- Search (internal/store/search.go) matches each word of the query as a substring of
+-- search_text, LIKE '%word%', or by trigram similarity to the name, lower(full_name) % word.
+-- The ordered index on search_text could serve neither (only a prefix), so every search read
+-- the whole table; trigram inverted indexes serve both.
+CREATE INDEX IF NOT EXISTS idx_profiles_search_trgm ON profiles USING GIN (search_text gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_profiles_name_trgm ON profiles USING GIN (lower(full_name) gin_trgm_ops);
+DROP INDEX IF EXISTS profiles@idx_profiles_search;
@@ -0,0 +1,8 @@
+-- migrate: no-transaction
+-- 041_photo_updated_at.sql
+-- When a profile's photo last changed: a rewrite (reprocessing) or a takedown hiding or
+-- showing it. Photo ETags and the chunks of a streamed photo are pinned to it rather than to
+-- updated_at, which every counted vote bumps. Rows start at their updated_at, so the ETags
+-- clients hold stay valid; a rerun leaves rows already backfilled (never after updated_at).
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS photo_updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+UPDATE profiles SET photo_updated_at = updated_at WHERE photo_updated_at > updated_at;
@@ -0,0 +1,19 @@
+// Package migrations embeds the SQL migrations in this directory, so the app and migrator
+// binaries carry the schema they were built with.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+//go:embed *.sql
+var embedded embed.FS
+
+// Open returns the migrations in dir, or the embedded ones when dir is empty (the default;
+// LEADERBOARD_MIGRATIONS_DIR or -dir point at a checkout instead).
+func Open(dir string) fs.FS {
+	if dir == "" { return embedded }
+	return os.DirFS(dir)
+}